@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/boomyao/crosh/internal/config"
+	"github.com/boomyao/crosh/internal/i18n"
+)
+
+// handleExportAnsible writes the mirror settings as an Ansible role, or prints
+// them as a playbook, so configuration management can set up dev machines
+// the way crosh set up this one
+func handleExportAnsible(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("export ansible", flag.ContinueOnError)
+	dir := fs.String("dir", filepath.Join("roles", "crosh_mirrors"), "Directory to write the role to")
+	playbook := fs.Bool("playbook", false, "Print a self-contained playbook instead of writing a role")
+	fs.Usage = func() {
+		fmt.Println("USAGE:\n    crosh export ansible [--dir roles/crosh_mirrors] [--playbook]")
+		fmt.Println("\nExports the npm, pip, go, cargo, apt and Docker mirrors as idempotent Ansible tasks.")
+		fmt.Println("\nFLAGS:")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	vars := ansibleVars(cfg.Mirror)
+	if len(vars) == 0 {
+		printErrorf("No mirrors configured to export (set them with: crosh config set mirror.npm <url>)")
+		exit(exitConfig)
+	}
+	tasks := ansibleTasks(cfg.Mirror)
+
+	if *playbook {
+		fmt.Print(ansiblePlaybook(vars, tasks))
+		return
+	}
+
+	if err := writeAnsibleRole(*dir, vars, tasks); err != nil {
+		printError(err)
+		exit(exitFailure)
+	}
+	i18n.Printf("✓ Wrote the Ansible role to %s\n", *dir)
+	i18n.Println("  Add it to a playbook:")
+	fmt.Printf("    roles:\n      - %s\n", filepath.Base(*dir))
+}
+
+// ansibleVar is a role default, one per configured mirror
+type ansibleVar struct {
+	name  string
+	value string // YAML
+}
+
+// ansibleVars returns the variables holding the mirrors, so a playbook can
+// override them per host or group
+func ansibleVars(m config.MirrorConfig) []ansibleVar {
+	vars := []ansibleVar{{"crosh_home", yamlString("{{ ansible_facts['env']['HOME'] }}")}}
+	for _, tool := range []struct{ name, value string }{
+		{"npm", m.NPM}, {"pip", m.Pip}, {"cargo", m.Cargo}, {"go", m.Go}, {"apt", m.Apt},
+	} {
+		if tool.value != "" {
+			vars = append(vars, ansibleVar{"crosh_mirror_" + tool.name, yamlString(tool.value)})
+		}
+	}
+	if len(m.Docker) > 0 {
+		registries := make([]string, len(m.Docker))
+		for i, registry := range m.Docker {
+			registries[i] = registryURL(registry)
+		}
+		data, _ := json.Marshal(registries)
+		vars = append(vars, ansibleVar{"crosh_mirror_docker", string(data)})
+	}
+	if len(vars) == 1 {
+		return nil // Only crosh_home
+	}
+	return vars
+}
+
+// yamlString quotes s for YAML; a JSON string is a valid YAML scalar
+func yamlString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+// ansibleTasks returns the tasks that point each configured tool at its
+// mirror. User-level files go to crosh_home; apt and Docker need become.
+// Every task only reports a change when it changed something.
+func ansibleTasks(m config.MirrorConfig) string {
+	var b strings.Builder
+	if m.NPM != "" {
+		b.WriteString(`- name: Point npm at the mirror
+  ansible.builtin.lineinfile:
+    path: "{{ crosh_home }}/.npmrc"
+    regexp: '^registry='
+    line: "registry={{ crosh_mirror_npm }}"
+    create: true
+    mode: "0644"
+
+`)
+	}
+	if m.Pip != "" {
+		b.WriteString(`- name: Create the pip config directory
+  ansible.builtin.file:
+    path: "{{ crosh_home }}/.config/pip"
+    state: directory
+    mode: "0755"
+
+- name: Point pip at the mirror
+  community.general.ini_file:
+    path: "{{ crosh_home }}/.config/pip/pip.conf"
+    section: global
+    option: index-url
+    value: "{{ crosh_mirror_pip }}"
+    mode: "0644"
+
+`)
+	}
+	if m.Cargo != "" {
+		b.WriteString(`- name: Create the cargo directory
+  ansible.builtin.file:
+    path: "{{ crosh_home }}/.cargo"
+    state: directory
+    mode: "0755"
+
+- name: Point cargo at the mirror
+  ansible.builtin.blockinfile:
+    path: "{{ crosh_home }}/.cargo/config.toml"
+    marker: "# {mark} crosh mirror"
+    create: true
+    mode: "0644"
+    block: |
+      [source.crates-io]
+      replace-with = 'crosh'
+
+      [source.crosh]
+      registry = "{{ crosh_mirror_cargo }}"
+
+`)
+	}
+	if m.Go != "" {
+		b.WriteString(`- name: Read GOPROXY
+  ansible.builtin.command: go env GOPROXY
+  register: crosh_goproxy
+  changed_when: false
+  failed_when: false
+
+- name: Point Go at the module proxy
+  ansible.builtin.command: go env -w GOPROXY={{ crosh_mirror_go }}
+  when: crosh_goproxy.rc == 0 and crosh_goproxy.stdout != crosh_mirror_go
+
+`)
+	}
+	if m.Apt != "" {
+		b.WriteString(`- name: Point apt at the mirror
+  ansible.builtin.copy:
+    dest: /etc/apt/sources.list
+    backup: true
+    mode: "0644"
+    content: |
+      # Generated by crosh export ansible
+      deb http://{{ crosh_mirror_apt }}/ubuntu/ {{ ansible_facts['distribution_release'] }} main restricted universe multiverse
+      deb http://{{ crosh_mirror_apt }}/ubuntu/ {{ ansible_facts['distribution_release'] }}-updates main restricted universe multiverse
+      deb http://{{ crosh_mirror_apt }}/ubuntu/ {{ ansible_facts['distribution_release'] }}-backports main restricted universe multiverse
+      deb http://{{ crosh_mirror_apt }}/ubuntu/ {{ ansible_facts['distribution_release'] }}-security main restricted universe multiverse
+  become: true
+  when: ansible_facts['distribution'] == 'Ubuntu'
+  notify: Update apt cache
+
+`)
+	}
+	if len(m.Docker) > 0 {
+		b.WriteString(`- name: Check for Docker
+  ansible.builtin.stat:
+    path: /etc/docker
+  register: crosh_docker_dir
+
+- name: Read the Docker daemon config
+  ansible.builtin.slurp:
+    src: /etc/docker/daemon.json
+  register: crosh_docker_daemon
+  failed_when: false
+  become: true
+  when: crosh_docker_dir.stat.exists
+
+- name: Point Docker at the registry mirrors
+  ansible.builtin.copy:
+    dest: /etc/docker/daemon.json
+    content: "{{ (crosh_docker_daemon.content | default('e30=') | b64decode | from_json) | combine({'registry-mirrors': crosh_mirror_docker}) | to_nice_json }}\n"
+    mode: "0644"
+  become: true
+  when: crosh_docker_dir.stat.exists
+  notify: Restart Docker
+
+`)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// ansibleHandlers returns the handlers the apt and Docker tasks notify
+func ansibleHandlers() string {
+	return `- name: Update apt cache
+  ansible.builtin.apt:
+    update_cache: true
+  become: true
+
+- name: Restart Docker
+  ansible.builtin.service:
+    name: docker
+    state: restarted
+  become: true
+`
+}
+
+// ansiblePlaybook formats vars, tasks and the handlers as one playbook for all hosts
+func ansiblePlaybook(vars []ansibleVar, tasks string) string {
+	var b strings.Builder
+	b.WriteString("# Mirrors exported by crosh (crosh export ansible --playbook)\n")
+	b.WriteString("- name: Set up package mirrors\n  hosts: all\n  vars:\n")
+	for _, v := range vars {
+		fmt.Fprintf(&b, "    %s: %s\n", v.name, v.value)
+	}
+	fmt.Fprintf(&b, "  tasks:\n%s  handlers:\n%s", indent(tasks, "    "), indent(ansibleHandlers(), "    "))
+	return b.String()
+}
+
+// indent prefixes every non-empty line of s
+func indent(s, prefix string) string {
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// writeAnsibleRole writes a role with the mirrors as defaults, the tasks and
+// the handlers
+func writeAnsibleRole(dir string, vars []ansibleVar, tasks string) error {
+	var defaults strings.Builder
+	defaults.WriteString("# Mirrors exported by crosh (crosh export ansible)\n")
+	for _, v := range vars {
+		fmt.Fprintf(&defaults, "%s: %s\n", v.name, v.value)
+	}
+
+	files := map[string]string{
+		"defaults/main.yml": defaults.String(),
+		"tasks/main.yml":    "# Generated by crosh export ansible\n" + tasks,
+		"handlers/main.yml": ansibleHandlers(),
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, []byte("---\n"+content), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+	return nil
+}
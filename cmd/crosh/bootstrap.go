@@ -0,0 +1,164 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/boomyao/crosh/internal/accelerator"
+	"github.com/boomyao/crosh/internal/config"
+	"github.com/boomyao/crosh/internal/logging"
+	"github.com/boomyao/crosh/internal/mirror"
+	"github.com/boomyao/crosh/internal/shell"
+)
+
+// bootstrapOutput is the summary "crosh bootstrap" prints
+type bootstrapOutput struct {
+	Mirrors []bootstrapMirror `json:"mirrors"`
+	Proxy   bootstrapProxy    `json:"proxy"`
+	Env     map[string]string `json:"env,omitempty"` // proxy variables to export
+	Errors  []string          `json:"errors,omitempty"`
+}
+
+// bootstrapMirror is what happened to one tool's mirror
+type bootstrapMirror struct {
+	Tool   string `json:"tool"`
+	Status string `json:"status"` // enabled, failed, not_installed or not_configured
+	URL    string `json:"url,omitempty"`
+}
+
+// bootstrapProxy is the proxy section of the bootstrap summary
+type bootstrapProxy struct {
+	Configured bool   `json:"configured"`
+	Running    bool   `json:"running"`
+	HTTP       string `json:"http,omitempty"`
+	SOCKS      string `json:"socks,omitempty"`
+	Node       string `json:"node,omitempty"`
+}
+
+// handleBootstrap sets up a fresh, short-lived environment such as a
+// Codespace, Gitpod workspace or CI VM without asking anything: it enables
+// the mirrors of the tools that are installed, starts the proxy if one is
+// configured and prints a JSON summary, or the proxy exports with --env.
+// Like --json, progress messages go to stderr.
+func handleBootstrap(manager *accelerator.Manager, cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("bootstrap", flag.ContinueOnError)
+	env := fs.Bool("env", false, "print the proxy environment as shell exports for eval instead of the JSON summary")
+	shellName := fs.String("shell", "", "shell syntax for --env: bash, zsh, fish, nu, csh or powershell (default: detected)")
+	noProxy := fs.Bool("no-proxy", false, "only enable mirrors, don't start the proxy")
+	fs.Usage = func() {
+		fmt.Println("USAGE:\n    crosh bootstrap [--env [--shell <name>]] [--no-proxy]")
+		fmt.Println("\nEnables the mirrors of installed tools and starts the configured proxy without")
+		fmt.Println("asking anything, for Codespaces, Gitpod and other short-lived machines.")
+		fmt.Println("\nFLAGS:")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	sh := shell.Detect()
+	if *shellName != "" {
+		parsed, err := shell.Parse(*shellName)
+		if err != nil {
+			printError(err)
+			exit(exitFailure)
+		}
+		sh = parsed
+	}
+
+	assumeYes = true
+
+	summary := bootstrapOutput{Mirrors: []bootstrapMirror{}}
+	var errs []error
+	attempted := 1
+
+	// Only the installed tools get a mirror; the config keeps the others
+	installed := make(map[string]bool)
+	for _, name := range config.MirrorToolNames {
+		if _, err := mirror.ToolPath(name); err == nil {
+			installed[name] = true
+		}
+	}
+	full := cfg.Mirror
+	cfg.Mirror = onlyMirrors(full, installed)
+	started := time.Now()
+	if err := manager.EnableMirrors(); err != nil {
+		logging.Warn("failed to enable mirrors", "error", err)
+		errs = append(errs, err)
+	}
+	tools := cfg.Mirror.Tools
+	cfg.Mirror = full
+	cfg.Mirror.Tools = tools
+
+	for _, name := range config.MirrorToolNames {
+		entry := bootstrapMirror{Tool: name, URL: cfg.Mirror.URL(name)}
+		state := cfg.Mirror.Tool(name)
+		switch {
+		case entry.URL == "":
+			entry.Status = "not_configured"
+		case !installed[name]:
+			entry.Status = "not_installed"
+			entry.URL = ""
+		case state.Enabled && !state.Applied.Before(started):
+			entry.Status = "enabled"
+		default:
+			entry.Status = "failed"
+		}
+		summary.Mirrors = append(summary.Mirrors, entry)
+	}
+
+	summary.Proxy.Configured = manager.HasProxySource()
+	if summary.Proxy.Configured && !*noProxy {
+		attempted++
+		cfg.Proxy.Enabled = true
+		if err := startProxy(manager, cfg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	xray := manager.GetXrayManager()
+	if xray.IsRunning() {
+		summary.Proxy.Running = true
+		summary.Proxy.HTTP = xray.HTTPProxyURL()
+		summary.Proxy.SOCKS = xray.SocksProxyURL()
+		summary.Proxy.Node = cfg.Proxy.CurrentNode
+		summary.Env = xray.GetProxyEnvVars()
+	}
+
+	if err := cfg.Save(); err != nil {
+		errs = append(errs, err)
+	}
+	for _, err := range errs {
+		summary.Errors = append(summary.Errors, err.Error())
+	}
+
+	if *env {
+		if summary.Env != nil {
+			for _, line := range shell.ExportLines(sh, summary.Env) {
+				fmt.Fprintln(jsonWriter, line)
+			}
+		}
+	} else {
+		printJSON(summary)
+	}
+	exit(exitCodeAll(errs, attempted))
+}
+
+// onlyMirrors returns the mirrors of the given tools, clearing the others so
+// EnableMirrors leaves them alone
+func onlyMirrors(m config.MirrorConfig, tools map[string]bool) config.MirrorConfig {
+	pick := func(tool, value string) string {
+		if tools[tool] {
+			return value
+		}
+		return ""
+	}
+
+	m.NPM = pick("npm", m.NPM)
+	m.Pip = pick("pip", m.Pip)
+	m.Apt = pick("apt", m.Apt)
+	m.Cargo = pick("cargo", m.Cargo)
+	m.Go = pick("go", m.Go)
+	if !tools["docker"] {
+		m.Docker = nil
+	}
+	return m
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/boomyao/crosh/internal/accelerator"
+	"github.com/boomyao/crosh/internal/cache"
+	"github.com/boomyao/crosh/internal/config"
+)
+
+const cacheUsage = `USAGE:
+    crosh cache <command>
+
+COMMANDS:
+    serve [--listen 127.0.0.1:7683]
+                Run a caching proxy for npm, PyPI and the Go module proxy in
+                front of the configured mirrors, and point npm, pip and go at
+                it until stopped; --listen :7683 shares it with the LAN,
+                --offline serves a "crosh prefetch" bundle without network
+    help        Show this help`
+
+// handleCache dispatches "crosh cache" subcommands
+func handleCache(manager *accelerator.Manager, cfg *config.Config, args []string) {
+	if len(args) == 0 {
+		fmt.Println(cacheUsage)
+		exit(exitFailure)
+	}
+
+	switch args[0] {
+	case "serve":
+		handleCacheServe(manager, cfg, args[1:])
+	case "help", "-h", "--help":
+		fmt.Println(cacheUsage)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown cache command: %s\n\n", args[0])
+		fmt.Println(cacheUsage)
+		exit(exitFailure)
+	}
+}
+
+// handleCacheServe serves the package cache until interrupted
+func handleCacheServe(manager *accelerator.Manager, cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("cache serve", flag.ContinueOnError)
+	listen := fs.String("listen", "127.0.0.1:7683", "Address to listen on; :7683 also serves other machines")
+	dir := fs.String("dir", config.CacheDir(), "Directory holding the cached packages")
+	maxSize := fs.Int64("max-size", 10240, "Cache size in MB before the least recently used packages are removed")
+	noRedirect := fs.Bool("no-redirect", false, "Don't point this machine's npm, pip and go at the cache")
+	offline := fs.Bool("offline", false, "Only serve what is cached, e.g. a bundle from \"crosh prefetch\" (--dir <bundle>/cache)")
+	fs.Usage = func() {
+		fmt.Println("USAGE:\n    crosh cache serve [--listen 127.0.0.1:7683] [--max-size 10240] [--no-redirect] [--offline]")
+		fmt.Println("\nCaches npm, PyPI and Go module downloads from the configured mirrors on disk.")
+		fmt.Println("\nFLAGS:")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	limit := *maxSize << 20
+	if *offline {
+		limit = 0 // Nothing could be fetched again
+	}
+	store, err := cache.OpenStore(*dir, limit)
+	if err != nil {
+		printError(err)
+		exit(exitFailure)
+	}
+	server := cache.NewServer(store, cfg.Mirror.NPM, cfg.Mirror.Pip, cfg.Mirror.Go)
+	server.Offline = *offline
+	npm, pip, goproxy := server.URLs(cacheBaseURL(*listen))
+	if npm == "" && pip == "" && goproxy == "" {
+		printErrorf("No npm, pip or go mirror configured to cache")
+		exit(exitConfig)
+	}
+
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		printErrorf("Package cache failed: %v", err)
+		exit(exitCode(err))
+	}
+	size, count := store.Size()
+	fmt.Printf("✓ Package cache running at %s (Ctrl+C to stop)\n", cacheBaseURL(*listen))
+	fmt.Printf("  %d packages, %d MB in %s\n", count, size>>20, *dir)
+	for _, url := range []struct{ name, value string }{{"npm registry", npm}, {"pip index-url", pip}, {"GOPROXY", goproxy}} {
+		if url.value != "" {
+			fmt.Printf("  %-14s %s\n", url.name, url.value)
+		}
+	}
+
+	if !*noRedirect {
+		manager.UseCache(map[string]string{"npm": npm, "pip": pip, "go": goproxy})
+	}
+	// Lets "crosh uninstall" find and stop the cache
+	os.WriteFile(cachePIDFile(), []byte(strconv.Itoa(os.Getpid())), 0644)
+	defer os.Remove(cachePIDFile())
+
+	httpServer := &http.Server{
+		Handler:           server,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		httpServer.Close()
+	}()
+
+	err = httpServer.Serve(listener)
+	if !*noRedirect {
+		fmt.Println()
+		manager.StopUsingCache()
+	}
+	if err != nil && err != http.ErrServerClosed {
+		printErrorf("Package cache failed: %v", err)
+		exit(exitCode(err))
+	}
+}
+
+// cachePIDFile returns the file holding the PID of a running "crosh cache serve"
+func cachePIDFile() string {
+	return filepath.Join(config.StateDir(), "cache.pid")
+}
+
+// cacheBaseURL returns the URL this machine reaches the cache on
+func cacheBaseURL(listen string) string {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return "http://" + listen
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
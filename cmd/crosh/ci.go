@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/boomyao/crosh/internal/config"
+	"github.com/boomyao/crosh/internal/proxy"
+	"github.com/boomyao/crosh/internal/shell"
+)
+
+// handleExportCI prints the mirrors as a GitHub Actions step or GitLab CI
+// variables, so pipelines on self-hosted runners use the same mirrors
+func handleExportCI(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("export ci", flag.ContinueOnError)
+	github := fs.Bool("github", false, "Print a GitHub Actions step that writes to $GITHUB_ENV")
+	gitlab := fs.Bool("gitlab", false, "Print GitLab CI variables and a before_script")
+	proxyURL := fs.String("proxy", "", "Also set HTTP_PROXY and HTTPS_PROXY to this proxy, e.g. a crosh with proxy.allow_lan on the runner's network")
+	fs.Usage = func() {
+		fmt.Println("USAGE:\n    crosh export ci --github|--gitlab [--proxy <url>]")
+		fmt.Println("\nPrints the npm, pip, go, cargo and apt mirrors, and optionally a proxy, for CI pipelines.")
+		fmt.Println("\nFLAGS:")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	if *github == *gitlab {
+		printErrorf("Choose one of --github and --gitlab")
+		exit(exitFailure)
+	}
+	if *proxyURL != "" && !isHTTPURL(*proxyURL) {
+		printErrorf("Invalid proxy URL: %s", *proxyURL)
+		exit(exitConfig)
+	}
+
+	env := containerEnv(cfg.Mirror)
+	if *proxyURL != "" {
+		env = append(env, envVar{"HTTP_PROXY", *proxyURL}, envVar{"HTTPS_PROXY", *proxyURL}, envVar{"NO_PROXY", proxy.NoProxy})
+	}
+	script := ciScript(cfg.Mirror)
+	if len(env) == 0 && script == "" {
+		printErrorf("No mirrors configured to export (set them with: crosh config set mirror.npm <url>)")
+		exit(exitConfig)
+	}
+
+	if *github {
+		fmt.Print(githubStep(env, script))
+	} else {
+		fmt.Print(gitlabCI(env, script))
+	}
+}
+
+// ciScript returns containerScript for runners, which may run the job as a
+// user with sudo rather than as root
+func ciScript(m config.MirrorConfig) string {
+	var b strings.Builder
+	if apt := aptScript(m); apt != "" {
+		fmt.Fprintf(&b, "$(command -v sudo) sh -e <<'CROSH'\n%sCROSH\n", apt)
+	}
+	b.WriteString(cargoScript(m))
+	return b.String()
+}
+
+// githubStep formats a step that exports env to the later steps of the job
+// through $GITHUB_ENV
+func githubStep(env []envVar, script string) string {
+	var run strings.Builder
+	for _, v := range env {
+		fmt.Fprintf(&run, "echo %s >> \"$GITHUB_ENV\"\n", shell.Quote(v.name+"="+v.value))
+	}
+	run.WriteString(script)
+
+	var b strings.Builder
+	b.WriteString("# GitHub Actions step exported by crosh (crosh export ci --github)\n")
+	b.WriteString("- name: Use the crosh mirrors\n  shell: bash\n  run: |\n")
+	b.WriteString(indent(run.String(), "    "))
+	return b.String()
+}
+
+// gitlabCI formats env as GitLab CI variables and script as the default
+// before_script. A job's own before_script replaces the default one.
+func gitlabCI(env []envVar, script string) string {
+	var b strings.Builder
+	b.WriteString("# GitLab CI config exported by crosh (crosh export ci --gitlab)\n")
+	if len(env) > 0 {
+		b.WriteString("variables:\n")
+		for _, v := range env {
+			fmt.Fprintf(&b, "  %s: %s\n", v.name, yamlString(v.value))
+		}
+	}
+	if script != "" {
+		b.WriteString("default:\n  before_script:\n    - |\n")
+		b.WriteString(indent(script, "      "))
+	}
+	return b.String()
+}
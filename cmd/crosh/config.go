@@ -0,0 +1,586 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/boomyao/crosh/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// handleConfig dispatches "crosh config" subcommands. It runs before the
+// config is loaded so a broken config.yaml can still be inspected.
+func handleConfig(args []string) {
+	if len(args) == 0 {
+		printConfigUsage()
+		exit(exitFailure)
+	}
+
+	switch args[0] {
+	case "validate":
+		handleConfigValidate(args[1:])
+	case "edit":
+		handleConfigEdit()
+	case "export":
+		handleConfigExport(args[1:])
+	case "import":
+		handleConfigImport(args[1:])
+	case "get":
+		handleConfigGet(args[1:])
+	case "set":
+		handleConfigSet(args[1:])
+	case "diff":
+		handleConfigDiff(args[1:])
+	case "reset":
+		handleConfigReset(args[1:])
+	case "restore":
+		handleConfigRestore(args[1:])
+	case "encrypt":
+		handleConfigEncrypt(true)
+	case "decrypt":
+		handleConfigEncrypt(false)
+	case "help", "-h", "--help":
+		printConfigUsage()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown config command: %s\n\n", args[0])
+		printConfigUsage()
+		exit(exitFailure)
+	}
+}
+
+func printConfigUsage() {
+	fmt.Println(`USAGE:
+    crosh config <command>
+
+COMMANDS:
+    validate [file]     Check config.yaml (default ~/.config/crosh/config.yaml and
+                        /etc/crosh/config.yaml) for unknown keys, invalid URLs and
+                        ports, and conflicting options
+    edit                Open config.yaml in $EDITOR and only save it if it's valid
+    get <key>           Print a setting, e.g. proxy.local_port or mirror
+    set <key> <value>   Change a setting; lists take "a,b" or "[a, b]"
+    diff                Show the settings that differ from the defaults
+    reset <key>         Put a setting (or a whole section) back to its default
+    export [file]       Write config, profiles and manual nodes as a tar.gz bundle
+                        (to stdout unless a file is given)
+    import <file>       Restore a bundle on this machine (replaced files get .bak)
+    restore [n]         Roll back to the nth most recent backup (default 1); the last
+                        10 versions are kept on every change
+    restore --list      Show the available backups
+    encrypt             Store the subscription URL and mirror credentials encrypted,
+                        with the key in the OS keyring (or a private key file)
+    decrypt             Store them as plain text again
+
+EXAMPLES:
+    crosh config set mirror.npm https://registry.npmmirror.com
+    crosh config get proxy.local_port
+    crosh config set proxy.bypass corp.example.com,10.8.0.0/16
+
+    # Move your setup to a new machine
+    crosh config export > crosh-bundle.tar.gz
+    crosh config import crosh-bundle.tar.gz`)
+}
+
+// handleConfigValidate reports problems in config.yaml with their line numbers
+func handleConfigValidate(args []string) {
+	if len(args) > 1 {
+		fmt.Fprintln(os.Stderr, "Usage: crosh config validate [file]")
+		exit(exitFailure)
+	}
+
+	if len(args) == 1 {
+		if !validateConfigFile(args[0]) {
+			exit(exitConfig)
+		}
+		return
+	}
+
+	valid := true
+	if config.HasSystemConfig() {
+		valid = validateConfigFile(config.SystemConfigPath())
+	}
+
+	path, err := config.GetConfigPath()
+	if err != nil {
+		printError(err)
+		exit(exitCode(err))
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		fmt.Printf("✓ %s doesn't exist, defaults are used\n", path)
+	} else if !validateConfigFile(path) {
+		valid = false
+	}
+
+	if !valid {
+		exit(exitConfig)
+	}
+}
+
+// validateConfigFile prints the problems in a config file, returning false if there are any
+func validateConfigFile(path string) bool {
+	problems, err := config.ValidateFile(path)
+	if err != nil {
+		printErrorf("%s: %v", path, err)
+		return false
+	}
+
+	if len(problems) == 0 {
+		fmt.Printf("✓ %s is valid\n", path)
+		return true
+	}
+
+	fmt.Fprintf(os.Stderr, "✗ %s has %d problem(s):\n", path, len(problems))
+	for _, problem := range problems {
+		fmt.Fprintf(os.Stderr, "  • %v\n", problem)
+	}
+	return false
+}
+
+// handleConfigGet prints the value of a dot-path key
+func handleConfigGet(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: crosh config get <key>")
+		exit(exitFailure)
+	}
+
+	cfg := loadConfigOrExit()
+	value, err := cfg.Get(args[0])
+	if err != nil {
+		printError(err)
+		exit(exitCode(err))
+	}
+	fmt.Println(value)
+}
+
+// handleConfigSet changes a dot-path key, refusing values that would make
+// the config invalid
+func handleConfigSet(args []string) {
+	if len(args) != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: crosh config set <key> <value>")
+		exit(exitFailure)
+	}
+	key, value := args[0], args[1]
+
+	cfg := loadConfigOrExit()
+	before := configProblems(cfg)
+
+	if err := cfg.Set(key, value); err != nil {
+		printError(err)
+		exit(exitConfig)
+	}
+
+	var introduced []string
+	for problem := range configProblems(cfg) {
+		if !before[problem] {
+			introduced = append(introduced, problem)
+		}
+	}
+	if len(introduced) > 0 {
+		fmt.Fprintf(os.Stderr, "✗ Not saved, %s = %s would make the config invalid:\n", key, value)
+		for _, problem := range introduced {
+			fmt.Fprintf(os.Stderr, "  • %s\n", problem)
+		}
+		exit(exitConfig)
+	}
+
+	if err := cfg.Save(); err != nil {
+		printError(err)
+		exit(exitCode(err))
+	}
+
+	fmt.Printf("✓ %s = %s\n", key, value)
+	if cfg.Mirror.AnyEnabled() || cfg.Proxy.Enabled {
+		fmt.Println("  Run \"crosh on\" to apply the change")
+	}
+}
+
+// loadConfigOrExit loads the active config, exiting with an error if it can't be parsed
+func loadConfigOrExit() *config.Config {
+	cfg, err := config.Load()
+	if err != nil {
+		printError(err)
+		exit(configExitCode(err))
+	}
+	printConfigWarnings(cfg)
+	return cfg
+}
+
+// printConfigWarnings reports keys in the config that were ignored while loading it
+func printConfigWarnings(cfg *config.Config) {
+	for _, warning := range cfg.Warnings() {
+		fmt.Fprintf(os.Stderr, "⚠ %s\n", warning)
+	}
+	if len(cfg.Warnings()) > 0 {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+// configProblems validates cfg as it would be saved, ignoring line numbers
+func configProblems(cfg *config.Config) map[string]bool {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return nil
+	}
+	problems, err := config.Validate(data)
+	if err != nil {
+		return nil
+	}
+
+	result := make(map[string]bool)
+	for _, problem := range problems {
+		result[problem.Key+": "+problem.Message] = true
+	}
+	return result
+}
+
+// handleConfigRestore lists the backups of the active profile or rolls back to one
+func handleConfigRestore(args []string) {
+	fs := flag.NewFlagSet("config restore", flag.ContinueOnError)
+	list := fs.Bool("list", false, "List available backups")
+	parseFlags(fs, args)
+
+	profile := config.ActiveProfile()
+	backups, err := config.ListBackups(profile)
+	if err != nil {
+		printError(err)
+		exit(exitCode(err))
+	}
+	if len(backups) == 0 {
+		fmt.Println("No backups yet, one is made every time the config changes")
+		return
+	}
+
+	if *list {
+		fmt.Printf("Backups of %s:\n", config.ProfilePath(profile))
+		for i, backup := range backups {
+			fmt.Printf("  %2d. %s  (%d bytes)\n", i+1, backup.Time.Format("2006-01-02 15:04:05"), backup.Size)
+		}
+		fmt.Println("\nRun \"crosh config restore <n>\" to roll back")
+		return
+	}
+
+	n := 1
+	if fs.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "Usage: crosh config restore [--list] [n]")
+		exit(exitFailure)
+	}
+	if fs.NArg() == 1 {
+		n, err = strconv.Atoi(fs.Arg(0))
+		if err != nil || n < 1 || n > len(backups) {
+			fmt.Fprintf(os.Stderr, "✗ Invalid backup %q, pick 1-%d (see \"crosh config restore --list\")\n", fs.Arg(0), len(backups))
+			exit(exitFailure)
+		}
+	}
+
+	backup := backups[n-1]
+	if err := config.RestoreBackup(profile, backup); err != nil {
+		printError(err)
+		exit(exitCode(err))
+	}
+
+	fmt.Printf("✓ Restored the config from %s\n", backup.Time.Format("2006-01-02 15:04:05"))
+	fmt.Println("  The replaced version was backed up, \"crosh config restore\" again undoes this")
+	fmt.Println("  Run \"crosh on\" to apply the restored config")
+}
+
+// handleConfigEncrypt turns encryption of secrets in the config file on or off
+func handleConfigEncrypt(enable bool) {
+	cfg := loadConfigOrExit()
+	cfg.EncryptSecrets = enable
+	if err := cfg.Save(); err != nil {
+		printError(err)
+		exit(exitCode(err))
+	}
+
+	if enable {
+		fmt.Println("✓ Secrets in the config file are now encrypted")
+		fmt.Printf("  Key: %s\n", config.SecretKeyLocation())
+		fmt.Println("  \"crosh config export\" decrypts them so bundles work on other machines")
+	} else {
+		fmt.Println("✓ Secrets in the config file are now stored as plain text")
+	}
+}
+
+// handleConfigDiff shows how the active config differs from the defaults
+func handleConfigDiff(args []string) {
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: crosh config diff")
+		exit(exitFailure)
+	}
+
+	cfg := loadConfigOrExit()
+	diffs, err := config.DiffDefaults(cfg)
+	if err != nil {
+		printError(err)
+		exit(exitCode(err))
+	}
+
+	if len(diffs) == 0 {
+		fmt.Println("✓ The config matches the defaults")
+		return
+	}
+
+	red, green, _, reset := colorCodes()
+	for _, diff := range diffs {
+		if diff.Default != "" {
+			fmt.Printf("%s- %s: %s%s\n", red, diff.Key, diff.Default, reset)
+		}
+		if diff.Value != "" {
+			fmt.Printf("%s+ %s: %s%s\n", green, diff.Key, diff.Value, reset)
+		}
+	}
+	fmt.Printf("\n%d setting(s) changed, undo one with \"crosh config reset <key>\"\n", len(diffs))
+}
+
+// handleConfigReset puts a setting back to its default
+func handleConfigReset(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: crosh config reset <key>")
+		exit(exitFailure)
+	}
+	key := args[0]
+
+	cfg := loadConfigOrExit()
+	if err := cfg.Reset(key); err != nil {
+		printError(err)
+		exit(exitCode(err))
+	}
+	if err := cfg.Save(); err != nil {
+		printError(err)
+		exit(exitCode(err))
+	}
+
+	value, _ := cfg.Get(key)
+	if strings.Contains(value, "\n") {
+		fmt.Printf("✓ Reset %s\n", key)
+	} else {
+		fmt.Printf("✓ Reset %s = %s\n", key, value)
+	}
+	if cfg.Mirror.AnyEnabled() || cfg.Proxy.Enabled {
+		fmt.Println("  Run \"crosh on\" to apply the change")
+	}
+}
+
+// colorCodes returns ANSI codes for red, green, yellow and reset, or empty
+// strings when stdout isn't a terminal or NO_COLOR is set
+func colorCodes() (string, string, string, string) {
+	if !isTerminal(os.Stdout) || os.Getenv("NO_COLOR") != "" {
+		return "", "", "", ""
+	}
+	return "\033[31m", "\033[32m", "\033[33m", "\033[0m"
+}
+
+// handleConfigEdit opens a copy of config.yaml in the user's editor and only
+// replaces the real file once the edited copy validates
+func handleConfigEdit() {
+	path, err := config.GetConfigPath()
+	if err != nil {
+		printError(err)
+		exit(exitCode(err))
+	}
+
+	original, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		if config.HasSystemConfig() {
+			// Start empty so the system config keeps applying to unset keys
+			original, err = []byte(fmt.Sprintf("# Settings here override %s\n", config.SystemConfigPath())), nil
+		} else {
+			original, err = yaml.Marshal(config.NewConfig())
+		}
+	}
+	if err != nil {
+		printErrorf("Failed to read %s: %v", path, err)
+		exit(exitCode(err))
+	}
+
+	tmp, err := os.CreateTemp("", "crosh-config-*"+filepath.Ext(path))
+	if err != nil {
+		printErrorf("Failed to create temp file: %v", err)
+		exit(exitCode(err))
+	}
+	tmpPath := tmp.Name()
+	_, err = tmp.Write(original)
+	tmp.Close()
+	if err != nil {
+		printErrorf("Failed to write temp file: %v", err)
+		exit(exitCode(err))
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		if err := runEditor(tmpPath); err != nil {
+			printError(err)
+			fmt.Fprintf(os.Stderr, "  Your edits are kept in %s\n", tmpPath)
+			exit(exitCode(err))
+		}
+
+		edited, err := os.ReadFile(tmpPath)
+		if err != nil {
+			printErrorf("Failed to read edited file: %v", err)
+			exit(exitCode(err))
+		}
+
+		if bytes.Equal(edited, original) {
+			os.Remove(tmpPath)
+			fmt.Println("Edit cancelled, no changes made")
+			return
+		}
+
+		problems, err := config.ValidateFormat(path, edited)
+		if err == nil && len(problems) == 0 {
+			if err := config.BackupProfile(config.ActiveProfile()); err != nil {
+				fmt.Fprintf(os.Stderr, "⚠ %v\n", err)
+			}
+			if err := writeFileAtomic(path, edited); err != nil {
+				printError(err)
+				fmt.Fprintf(os.Stderr, "  Your edits are kept in %s\n", tmpPath)
+				exit(exitCode(err))
+			}
+			os.Remove(tmpPath)
+			fmt.Printf("✓ Saved %s\n", path)
+			fmt.Println("  Run \"crosh on\" to apply the changes")
+			return
+		}
+
+		fmt.Fprintln(os.Stderr, "✗ The edited config is invalid:")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "  • %v\n", err)
+		}
+		for _, problem := range problems {
+			fmt.Fprintf(os.Stderr, "  • %v\n", problem)
+		}
+
+		fmt.Print("\nRe-open the editor to fix it? [Y/n] ")
+		answer, _ := reader.ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer != "" && answer != "y" && answer != "yes" {
+			fmt.Fprintf(os.Stderr, "✗ %s was not changed, your edits are kept in %s\n", path, tmpPath)
+			exit(exitConfig)
+		}
+	}
+}
+
+// runEditor opens path in $VISUAL or $EDITOR (which may include arguments,
+// e.g. "code --wait"), falling back to vi or notepad
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+
+	parts := strings.Fields(editor)
+	cmd := exec.Command(parts[0], append(parts[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = rawStdout
+	cmd.Stderr = rawStderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor %q failed: %w", editor, err)
+	}
+	return nil
+}
+
+// writeFileAtomic replaces path with data without leaving a half-written file
+// behind. A symlinked config, e.g. from a dotfiles repository, is written
+// through so the link survives the rename.
+func writeFileAtomic(path string, data []byte) error {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
+
+// handleConfigExport writes the config bundle to a file or stdout
+func handleConfigExport(args []string) {
+	if len(args) > 1 {
+		fmt.Fprintln(os.Stderr, "Usage: crosh config export [file]")
+		exit(exitFailure)
+	}
+
+	cfg := loadConfigOrExit()
+
+	out := rawStdout
+	if len(args) == 1 {
+		file, err := os.OpenFile(args[0], os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			printErrorf("Failed to create %s: %v", args[0], err)
+			exit(exitCode(err))
+		}
+		defer file.Close()
+		out = file
+	} else if isTerminal(rawStdout) {
+		fmt.Fprintln(os.Stderr, "✗ Refusing to write a binary bundle to the terminal")
+		fmt.Fprintln(os.Stderr, "  Usage: crosh config export > crosh-bundle.tar.gz")
+		exit(exitFailure)
+	}
+
+	files, err := config.ExportBundle(out, filepath.Dir(cfg.Proxy.XrayPath))
+	if err != nil {
+		printError(err)
+		exit(exitCode(err))
+	}
+
+	// Status goes to stderr so stdout stays a clean archive
+	fmt.Fprintf(os.Stderr, "✓ Exported %d files:\n", len(files))
+	for _, file := range files {
+		fmt.Fprintf(os.Stderr, "  • %s\n", file)
+	}
+	fmt.Fprintln(os.Stderr, "⚠ The bundle contains subscription URLs and node credentials, keep it private")
+}
+
+// handleConfigImport restores a config bundle
+func handleConfigImport(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: crosh config import <bundle.tar.gz>")
+		exit(exitFailure)
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		printErrorf("Failed to open %s: %v", args[0], err)
+		exit(exitCode(err))
+	}
+	defer file.Close()
+
+	// Use the default data directory rather than whatever config is active
+	// here, since the bundle is about to replace it
+	dataDir := filepath.Dir(config.DefaultConfig().Proxy.XrayPath)
+	written, err := config.ImportBundle(file, dataDir)
+	for _, path := range written {
+		fmt.Printf("✓ Restored %s\n", path)
+	}
+	if err != nil {
+		printError(err)
+		exit(exitCode(err))
+	}
+	if len(written) == 0 {
+		fmt.Println("Nothing to import, everything is already up to date")
+		return
+	}
+
+	fmt.Println("\nRun \"crosh on\" to start using the imported setup")
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/boomyao/crosh/internal/accelerator"
+	"github.com/boomyao/crosh/internal/config"
+	"github.com/boomyao/crosh/internal/i18n"
+	"github.com/boomyao/crosh/internal/userfile"
+)
+
+// assumeYes is set by the global --yes flag, which applies changes without asking
+var assumeYes bool
+
+// confirmChanges makes crosh show the diff of every change to a user file,
+// such as .zshrc or daemon.json, and ask before making it. Scripts, JSON
+// output and --yes skip the question.
+func confirmChanges() {
+	if assumeYes || jsonOutput || !isTerminal(os.Stdin) || !isTerminal(rawStdout) {
+		return
+	}
+	userfile.Confirm = confirmChange
+}
+
+// confirmChange prints the diff of a change and asks whether to make it.
+// Answering "a" makes this and every following change without asking.
+func confirmChange(path, diff string) bool {
+	i18n.Printf("\ncrosh is about to change %s:\n", path)
+	red, green, _, reset := colorCodes()
+	for _, line := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "---"), strings.HasPrefix(line, "+++"):
+			fmt.Println(line)
+		case strings.HasPrefix(line, "-"):
+			fmt.Println(red + line + reset)
+		case strings.HasPrefix(line, "+"):
+			fmt.Println(green + line + reset)
+		default:
+			fmt.Println(line)
+		}
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		i18n.Print("Apply this change? [y]es, [n]o, [a]ll: ")
+		answer, err := reader.ReadString('\n')
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return true
+		case "a", "all":
+			userfile.Confirm = nil
+			return true
+		case "n", "no":
+			return false
+		}
+		if err != nil {
+			fmt.Println()
+			return false
+		}
+	}
+}
+
+// confirmHooks makes crosh ask before running a hook that comes from outside
+// the user's config.yaml, like the system config. --yes doesn't answer for
+// the user here: without a terminal such hooks are skipped.
+func confirmHooks() {
+	if jsonOutput || !isTerminal(os.Stdin) || !isTerminal(rawStdout) {
+		return
+	}
+	accelerator.ConfirmHook = confirmHook
+}
+
+// confirmHook shows a hook and asks whether to run it, now and later
+func confirmHook(hook config.HookConfig) bool {
+	i18n.Printf("\n%s sets a %s hook that runs:\n  %s\n", hook.Source, hook.On, hook.Run)
+	wizard := &initWizard{reader: bufio.NewReader(os.Stdin)}
+	return wizard.confirm(i18n.T("Run it, now and from now on?"), false)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/boomyao/crosh/internal/accelerator"
+	"github.com/boomyao/crosh/internal/config"
+	"github.com/boomyao/crosh/internal/daemon"
+	"github.com/boomyao/crosh/internal/lock"
+	"github.com/boomyao/crosh/internal/proxy"
+)
+
+// daemonUsage is the help printed by "crosh daemon help"
+const daemonUsage = `USAGE:
+    crosh daemon <command>
+
+COMMANDS:
+    run [--port 7681]   Run the daemon in the foreground (for systemd, launchd
+                        or a container entrypoint)
+    start               Run the daemon in the background
+    stop                Stop the daemon and the proxy it owns
+    status              Show the daemon, its API address and the proxy
+
+While the daemon runs, "crosh on" and "crosh off" ask it to start and stop
+the proxy, so concurrent crosh commands can't race. It restarts the proxy if
+it dies, keeps the health monitor running and refreshes the subscription
+every daemon.refresh hours (default 24). Edits of config.yaml, such as new
+ports, another node or a mirror switched on or off, apply as soon as they are
+saved. Other tools can use the same REST
+API on 127.0.0.1 (daemon.port in the config):
+
+    curl http://127.0.0.1:7681/v1/status
+    curl -X POST -H 'X-Crosh-Action: 1' http://127.0.0.1:7681/v1/proxy/restart`
+
+// handleDaemon runs and controls the crosh daemon
+func handleDaemon(manager *accelerator.Manager, cfg *config.Config, args []string) {
+	if len(args) == 0 {
+		fmt.Println(daemonUsage)
+		exit(exitFailure)
+	}
+
+	stateDir := manager.GetXrayManager().StateDir()
+	switch args[0] {
+	case "run":
+		config.SetSaveBackups(false)
+		handleDaemonRun(cfg, stateDir, args[1:])
+	case "start":
+		handleDaemonStart(manager, cfg, stateDir)
+	case "stop":
+		handleDaemonStop(stateDir)
+	case "status":
+		handleDaemonStatus(stateDir)
+	case "help", "-h", "--help":
+		fmt.Println(daemonUsage)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown daemon command: %s\n\n", args[0])
+		fmt.Println(daemonUsage)
+		exit(exitFailure)
+	}
+}
+
+// handleDaemonRun runs the daemon in the foreground until interrupted
+func handleDaemonRun(cfg *config.Config, stateDir string, args []string) {
+	fs := flag.NewFlagSet("daemon run", flag.ContinueOnError)
+	port := fs.Int("port", 0, "API port on 127.0.0.1 (default: daemon.port, or 7681)")
+	parseFlags(fs, args)
+
+	if client := daemon.Connect(stateDir); client != nil {
+		printErrorf("The daemon is already running at http://%s", client.Addr())
+		exit(exitFailure)
+	}
+
+	// The flag only moves the API; the daemon reloads cfg from the file
+	api := *cfg
+	if *port != 0 {
+		api.Daemon.Port = *port
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	stop := make(chan struct{})
+	go func() {
+		<-signals
+		close(stop)
+	}()
+
+	if err := daemon.New(cfg).Run(daemon.Addr(&api), stop); err != nil {
+		printErrorf("Daemon failed: %v", err)
+		exit(exitCode(err))
+	}
+}
+
+// handleDaemonStart starts "crosh daemon run" in the background and waits
+// for its API to answer
+func handleDaemonStart(manager *accelerator.Manager, cfg *config.Config, stateDir string) {
+	if client := daemon.Connect(stateDir); client != nil {
+		fmt.Printf("✓ Daemon already running at http://%s\n", client.Addr())
+		return
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		printErrorf("Failed to locate crosh executable: %v", err)
+		exit(exitFailure)
+	}
+	logDir := manager.GetXrayManager().LogDir()
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		printErrorf("Failed to create log directory: %v", err)
+		exit(exitFailure)
+	}
+
+	logFile := filepath.Join(logDir, "daemon.log")
+	if _, err := proxy.StartBackground(executable, []string{"daemon", "run"}, logFile, filepath.Join(stateDir, "daemon.pid")); err != nil {
+		printErrorf("Failed to start daemon: %v", err)
+		exit(exitCode(err))
+	}
+
+	// The first supervision pass may start the proxy before the API answers
+	deadline := time.Now().Add(time.Minute)
+	for time.Now().Before(deadline) {
+		if client := daemon.Connect(stateDir); client != nil {
+			fmt.Printf("✓ Daemon started, API at http://%s\n", client.Addr())
+			return
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	printErrorf("Daemon didn't start, see %s", logFile)
+	exit(exitFailure)
+}
+
+// handleDaemonStop asks the daemon to stop and waits until it has stopped the proxy
+func handleDaemonStop(stateDir string) {
+	running, err := stopDaemon(stateDir)
+	if err != nil {
+		printError(err)
+		exit(exitFailure)
+	}
+	if !running {
+		fmt.Println("Daemon is not running")
+		return
+	}
+	fmt.Println("✓ Daemon stopped")
+}
+
+// stopDaemon asks a running daemon to stop the proxy and exit, and waits
+// until it has. It reports false if no daemon was running.
+func stopDaemon(stateDir string) (bool, error) {
+	client := daemon.Connect(stateDir)
+	if client == nil {
+		return false, nil
+	}
+
+	if err := client.Shutdown(); err != nil {
+		return true, fmt.Errorf("failed to stop daemon: %w", err)
+	}
+
+	// The daemon removes its state file once the proxy is stopped
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(daemon.StateFile(stateDir)); os.IsNotExist(err) {
+			return true, nil
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	return true, fmt.Errorf("daemon is still shutting down")
+}
+
+// handleDaemonStatus shows the daemon and the proxy it owns
+func handleDaemonStatus(stateDir string) {
+	client := daemon.Connect(stateDir)
+	if client == nil {
+		if jsonOutput {
+			printJSON(map[string]bool{"running": false})
+			return
+		}
+		fmt.Println("Daemon: not running (start it with: crosh daemon start)")
+		return
+	}
+
+	status, err := client.Status()
+	if err != nil {
+		printError(err)
+		exit(exitFailure)
+	}
+	if jsonOutput {
+		printJSON(status)
+		return
+	}
+
+	fmt.Printf("Daemon: running (PID: %d, up %s)\n", status.PID, time.Since(status.StartedAt).Round(time.Second))
+	fmt.Printf("API: http://%s\n", client.Addr())
+	switch {
+	case status.ProxyRunning && status.Node != nil:
+		fmt.Printf("Proxy: running (PID: %d, node: %s)\n", status.ProxyPID, status.Node.Name)
+	case status.ProxyRunning:
+		fmt.Printf("Proxy: running (PID: %d)\n", status.ProxyPID)
+	case status.ProxyEnabled:
+		fmt.Println("Proxy: enabled but not running, the daemon keeps retrying")
+	default:
+		fmt.Println("Proxy: stopped")
+	}
+	if status.SubscriptionUpdated != nil {
+		fmt.Printf("Subscription: updated %s\n", status.SubscriptionUpdated.Format("2006-01-02 15:04"))
+	}
+}
+
+// viaDaemon runs a proxy operation in the running daemon, so it can't race
+// with the daemon's own restarts, and reports false if there is no daemon.
+// cfg is saved first for the daemon to see, then reloaded with its changes.
+func viaDaemon(manager *accelerator.Manager, cfg *config.Config, op func(*daemon.Client) error) (bool, error) {
+	client := daemon.Connect(manager.GetXrayManager().StateDir())
+	if client == nil {
+		return false, nil
+	}
+
+	if err := cfg.Save(); err != nil {
+		return true, err
+	}
+	// The daemon takes the settings lock itself while it works
+	released := lock.Held()
+	if released {
+		lock.Release()
+	}
+	err := op(client)
+	if released {
+		// Going on without the lock could clobber another command's changes
+		if lockErr := lock.Acquire(lockWait); lockErr != nil {
+			printErrorf("The daemon is done, but the settings lock couldn't be taken back: %v", lockErr)
+			exit(exitCode(lockErr))
+		}
+	}
+	if reloaded, loadErr := config.Load(); loadErr == nil {
+		*cfg = *reloaded
+	}
+	return true, err
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boomyao/crosh/internal/accelerator"
+	"github.com/boomyao/crosh/internal/config"
+	"github.com/boomyao/crosh/internal/i18n"
+	"github.com/boomyao/crosh/internal/mirror"
+	"github.com/boomyao/crosh/internal/proxy"
+	"github.com/boomyao/crosh/internal/sysenv"
+)
+
+// Doctor check outcomes
+const (
+	checkOK   = "ok"
+	checkWarn = "warn"
+	checkFail = "fail"
+)
+
+// doctorCheck is the result of one "crosh doctor" check
+type doctorCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"` // ok, warn or fail
+	Detail string `json:"detail"`
+	Fix    string `json:"fix,omitempty"`
+}
+
+// handleDoctor diagnoses the config, mirrors, tools and proxy and suggests fixes
+func handleDoctor(args []string) {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	timeout := fs.Duration("timeout", 5*time.Second, "How long to wait for each mirror to answer")
+	fs.Usage = func() {
+		i18n.Println("USAGE:\n    crosh doctor [--timeout 5s]")
+		i18n.Println("\nChecks the config, mirror reachability, installed tools, conflicting settings")
+		i18n.Println("and the proxy binary, and prints how to fix what's wrong.")
+		i18n.Println("\nFLAGS:")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	cfg, checks := doctorConfig()
+	i18n.SetLanguage(cfg.Language)
+	checks = append(checks, doctorPlatform()...)
+	checks = append(checks, doctorTools(cfg)...)
+	checks = append(checks, doctorMirrors(cfg, *timeout)...)
+	checks = append(checks, doctorConflicts()...)
+	checks = append(checks, doctorProxy(accelerator.NewManager(cfg), cfg)...)
+
+	failures, warnings := 0, 0
+	for _, check := range checks {
+		switch check.Status {
+		case checkWarn:
+			warnings++
+		case checkFail:
+			failures++
+		}
+	}
+
+	if jsonOutput {
+		printJSON(map[string]interface{}{"checks": checks, "failures": failures, "warnings": warnings})
+		if failures > 0 {
+			exit(exitFailure)
+		}
+		return
+	}
+
+	for _, check := range checks {
+		mark := "✓"
+		switch check.Status {
+		case checkWarn:
+			mark = "⚠"
+		case checkFail:
+			mark = "✗"
+		}
+		fmt.Printf("%s %s: %s\n", mark, check.Name, check.Detail)
+		if check.Fix != "" {
+			fmt.Printf("  → %s\n", check.Fix)
+		}
+	}
+
+	fmt.Println()
+	if failures == 0 && warnings == 0 {
+		i18n.Println("✓ No problems found")
+		return
+	}
+	i18n.Printf("%d problem(s), %d warning(s)\n", failures, warnings)
+	if failures > 0 {
+		exit(exitFailure)
+	}
+}
+
+// doctorConfig validates the system and user config files. If the config
+// doesn't load, the remaining checks run against the defaults.
+func doctorConfig() (*config.Config, []doctorCheck) {
+	var checks []doctorCheck
+
+	var paths []string
+	if config.HasSystemConfig() {
+		paths = append(paths, config.SystemConfigPath())
+	}
+	if path, err := config.GetConfigPath(); err == nil {
+		if _, err := os.Stat(path); err == nil {
+			paths = append(paths, path)
+		} else {
+			checks = append(checks, doctorCheck{Name: "config", Status: checkOK, Detail: path + " doesn't exist, defaults are used"})
+		}
+	}
+
+	for _, path := range paths {
+		problems, err := config.ValidateFile(path)
+		switch {
+		case err != nil:
+			checks = append(checks, doctorCheck{Name: "config", Status: checkFail, Detail: fmt.Sprintf("%s: %v", path, err), Fix: "run \"crosh config edit\" to fix it"})
+		case len(problems) > 0:
+			var lines []string
+			for _, problem := range problems {
+				lines = append(lines, problem.Error())
+			}
+			checks = append(checks, doctorCheck{
+				Name:   "config",
+				Status: checkFail,
+				Detail: fmt.Sprintf("%s has %d problem(s): %s", path, len(problems), strings.Join(lines, "; ")),
+				Fix:    "run \"crosh config validate\" for details and \"crosh config edit\" to fix them",
+			})
+		default:
+			checks = append(checks, doctorCheck{Name: "config", Status: checkOK, Detail: path + " is valid"})
+		}
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return config.DefaultConfig(), checks
+	}
+	return cfg, checks
+}
+
+// binaryCheck reports a proxy binary's version, warning when it was built for
+// another CPU than this Mac's and runs translated by Rosetta
+func binaryCheck(name, version, path, arch string) doctorCheck {
+	if arch == "" {
+		return doctorCheck{Name: name, Status: checkOK, Detail: version}
+	}
+	return doctorCheck{
+		Name:   name,
+		Status: checkWarn,
+		Detail: fmt.Sprintf("%s is the %s build, this Mac is %s", version, arch, sysenv.Arch()),
+		Fix:    fmt.Sprintf("delete %s and run \"crosh on\" to download the native build", path),
+	}
+}
+
+// doctorPlatform warns when crosh itself is the Intel build running under
+// Rosetta, which also made it download Intel builds of the proxy before
+func doctorPlatform() []doctorCheck {
+	if !sysenv.UnderRosetta() {
+		return nil
+	}
+	return []doctorCheck{{
+		Name:   "crosh",
+		Status: checkWarn,
+		Detail: "the Intel build is running under Rosetta on Apple Silicon",
+		Fix:    "run \"crosh self-update --force\" to install the arm64 build",
+	}}
+}
+
+// doctorTools checks that the tools with a mirror enabled are installed
+func doctorTools(cfg *config.Config) []doctorCheck {
+	var checks []doctorCheck
+	for _, name := range config.MirrorToolNames {
+		if !cfg.Mirror.Tool(name).Enabled {
+			continue
+		}
+		check := doctorCheck{Name: name}
+		if path, err := mirror.ToolPath(name); err != nil {
+			check.Status = checkWarn
+			check.Detail = "mirror enabled but " + err.Error()
+			check.Fix = fmt.Sprintf("install %s, or stop managing it with \"crosh config set mirror.tools.%s.enabled false\"", name, name)
+		} else {
+			check.Status = checkOK
+			check.Detail = "installed at " + path
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// doctorMirrors probes the configured mirrors in parallel
+func doctorMirrors(cfg *config.Config, timeout time.Duration) []doctorCheck {
+	type target struct{ tool, key, url string }
+	var targets []target
+	add := func(tool, key, url string) {
+		if url != "" {
+			targets = append(targets, target{tool, key, url})
+		}
+	}
+	add("npm", "mirror.npm", cfg.Mirror.NPM)
+	add("pip", "mirror.pip", cfg.Mirror.Pip)
+	if cfg.Mirror.Apt != "" {
+		add("apt", "mirror.apt", "https://"+cfg.Mirror.Apt+"/")
+	}
+	add("cargo", "mirror.cargo", strings.TrimPrefix(cfg.Mirror.Cargo, "sparse+"))
+	for _, url := range strings.Split(cfg.Mirror.Go, ",") {
+		if url != "direct" && url != "off" {
+			add("go", "mirror.go", url)
+		}
+	}
+	for _, registry := range cfg.Mirror.Docker {
+		if !strings.Contains(registry, "://") {
+			registry = "https://" + registry
+		}
+		add("docker", "mirror.docker", strings.TrimSuffix(registry, "/")+"/v2/")
+	}
+
+	checks := make([]doctorCheck, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t target) {
+			defer wg.Done()
+			latency, err := mirror.ProbeMirror(rootCtx, t.url, timeout)
+			if err != nil {
+				checks[i] = doctorCheck{
+					Name:   t.tool + " mirror",
+					Status: checkWarn,
+					Detail: fmt.Sprintf("%s is unreachable: %v", t.url, err),
+					Fix:    fmt.Sprintf("pick another mirror with \"crosh init\" or \"crosh config set %s <url>\"", t.key),
+				}
+				return
+			}
+			checks[i] = doctorCheck{Name: t.tool + " mirror", Status: checkOK, Detail: fmt.Sprintf("%s answered in %dms", t.url, latency.Milliseconds())}
+		}(i, t)
+	}
+	wg.Wait()
+	return checks
+}
+
+// doctorConflicts reports settings outside crosh that override its mirrors
+func doctorConflicts() []doctorCheck {
+	var checks []doctorCheck
+	for _, conflict := range mirror.FindConflicts() {
+		checks = append(checks, doctorCheck{Name: conflict.Tool + " settings", Status: checkWarn, Detail: conflict.Detail, Fix: conflict.Fix})
+	}
+	return checks
+}
+
+// doctorProxy checks the proxy binaries and whether the proxy is running
+// when it should be
+func doctorProxy(manager *accelerator.Manager, cfg *config.Config) []doctorCheck {
+	if !manager.HasProxySource() {
+		return []doctorCheck{{Name: "proxy", Status: checkOK, Detail: "not configured"}}
+	}
+
+	var checks []doctorCheck
+	xray := manager.GetXrayManager()
+	if version, err := xray.Version(nil); err != nil {
+		checks = append(checks, doctorCheck{Name: "Xray-core", Status: checkFail, Detail: err.Error(), Fix: "run \"crosh on\" to download it"})
+	} else {
+		path, arch := xray.ForeignBinary(nil)
+		checks = append(checks, binaryCheck("Xray-core", version, path, arch))
+	}
+
+	if node, err := xray.CurrentNode(); err == nil && proxy.NeedsSingBox(node) {
+		if version, err := xray.Version(node); err != nil {
+			checks = append(checks, doctorCheck{Name: "sing-box", Status: checkFail, Detail: err.Error(), Fix: "run \"crosh on\" to download it"})
+		} else {
+			path, arch := xray.ForeignBinary(node)
+			checks = append(checks, binaryCheck("sing-box", version, path, arch))
+		}
+	}
+
+	switch {
+	case cfg.Proxy.Enabled && !xray.IsRunning():
+		checks = append(checks, doctorCheck{Name: "proxy", Status: checkWarn, Detail: "enabled in config but not running", Fix: "run \"crosh on\" to start it, or \"crosh proxy logs\" to see why it stopped"})
+	case xray.IsRunning():
+		checks = append(checks, doctorCheck{Name: "proxy", Status: checkOK, Detail: fmt.Sprintf("running (PID %d)", xray.PID())})
+	default:
+		checks = append(checks, doctorCheck{Name: "proxy", Status: checkOK, Detail: "configured but disabled"})
+	}
+
+	if warning := xray.GeoDataWarning(); warning != "" {
+		checks = append(checks, doctorCheck{Name: "geodata", Status: checkWarn, Detail: warning, Fix: "run \"crosh proxy geodata update\""})
+	}
+
+	return checks
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+
+	"github.com/boomyao/crosh/internal/errs"
+)
+
+// Exit codes, documented in the README so scripts and CI can branch on them
+const (
+	exitOK           = 0
+	exitFailure      = 1 // anything not covered below, including usage errors
+	exitPartial      = 2 // some steps failed while others succeeded
+	exitConfig       = 3 // the config or a subscription doesn't parse, or a change would make the config invalid
+	exitNetwork      = 4 // a download, subscription, mirror or node was unreachable
+	exitPrivilege    = 5 // root or administrator rights are needed, e.g. for apt or Docker
+	exitNotInstalled = 6 // a tool crosh configures or runs, such as git or Xray-core, is missing
+
+	exitInterrupted = 130 // cancelled with Ctrl+C, like a shell reports SIGINT
+)
+
+// exitCode returns the exit code for a command that failed with err
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	if errors.Is(err, context.Canceled) {
+		return exitInterrupted
+	}
+
+	switch errs.Kind(err) {
+	case errs.ErrPermission:
+		return exitPrivilege
+	case errs.ErrNetwork:
+		return exitNetwork
+	case errs.ErrParse:
+		return exitConfig
+	case errs.ErrNotInstalled:
+		return exitNotInstalled
+	}
+	return exitFailure
+}
+
+// configExitCode is exitCode for errors loading the config, which are
+// config errors unless they have a more specific cause
+func configExitCode(err error) int {
+	if code := exitCode(err); code != exitFailure {
+		return code
+	}
+	return exitConfig
+}
+
+// exitCodeAll returns exitPartial if only some of the attempted steps
+// failed, or the code for the first error if all of them did
+func exitCodeAll(errs []error, attempted int) int {
+	if len(errs) == 0 {
+		return exitOK
+	}
+	if len(errs) < attempted {
+		return exitPartial
+	}
+	return exitCode(errs[0])
+}
+
+// parseFlags parses a subcommand's flags. The flag package's own exit code for
+// bad flags, 2, would read as a partial failure, so bad flags exit with
+// exitFailure and --help with exitOK.
+func parseFlags(flags *flag.FlagSet, args []string) {
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			exit(exitOK)
+		}
+		exit(exitFailure)
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/boomyao/crosh/internal/config"
+	"github.com/boomyao/crosh/internal/i18n"
+	"github.com/boomyao/crosh/internal/proxy"
+	"github.com/boomyao/crosh/internal/shell"
+)
+
+// handleExport dispatches "crosh export" subcommands
+func handleExport(cfg *config.Config, args []string) {
+	if len(args) == 0 {
+		printExportUsage()
+		exit(exitFailure)
+	}
+
+	switch args[0] {
+	case "devcontainer":
+		handleExportDevcontainer(cfg, args[1:])
+	case "ansible":
+		handleExportAnsible(cfg, args[1:])
+	case "docker":
+		handleExportDocker(cfg, args[1:])
+	case "k8s", "kubernetes":
+		handleExportK8s(cfg, args[1:])
+	case "ci":
+		handleExportCI(cfg, args[1:])
+	case "proxychains":
+		handleExportProxychains(cfg, args[1:])
+	case "help", "-h", "--help":
+		printExportUsage()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown export command: %s\n\n", args[0])
+		printExportUsage()
+		exit(exitFailure)
+	}
+}
+
+func printExportUsage() {
+	fmt.Println(`USAGE:
+    crosh export <command>
+
+COMMANDS:
+    devcontainer [--dir d]    Write a devcontainer feature that sets up the current
+                              npm, pip, go, cargo and apt mirrors in the container
+                              (default .devcontainer/crosh-mirrors)
+    devcontainer --dockerfile Print the same setup as a Dockerfile snippet
+    ansible [--dir d]         Write an Ansible role that sets up the current mirrors
+                              on managed machines (default roles/crosh_mirrors)
+    ansible --playbook        Print the same setup as a playbook
+    docker [--dockerfile|--compose]
+                              Print Dockerfile ARG/RUN lines and a docker-compose
+                              build args block with the mirrors and the proxy
+    k8s [--namespace ns]      Print a ConfigMap and DaemonSet that roll the Docker
+                              registry mirrors out to the containerd of every node
+    k8s --configmap           Print only the ConfigMap with containerd's hosts.toml
+    ci --github|--gitlab      Print a GitHub Actions step or GitLab CI variables
+                              with the mirrors (and --proxy <url>)
+    proxychains [--file f]    Write a proxychains.conf that routes programs which
+                              ignore HTTP_PROXY through crosh's SOCKS5 port`)
+}
+
+// handleExportDevcontainer writes the mirror settings as a devcontainer
+// feature, or prints them as Dockerfile lines, so container builds (e.g. in
+// Codespaces) use the same mirrors without crosh installed in the image
+func handleExportDevcontainer(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("export devcontainer", flag.ContinueOnError)
+	dir := fs.String("dir", filepath.Join(".devcontainer", "crosh-mirrors"), "Directory to write the feature to")
+	dockerfile := fs.Bool("dockerfile", false, "Print a Dockerfile snippet instead of writing a feature")
+	fs.Usage = func() {
+		fmt.Println("USAGE:\n    crosh export devcontainer [--dir .devcontainer/crosh-mirrors] [--dockerfile]")
+		fmt.Println("\nExports the npm, pip, go, cargo and apt mirrors for container images.")
+		fmt.Println("\nFLAGS:")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	env := containerEnv(cfg.Mirror)
+	script := containerScript(cfg.Mirror)
+	if len(env) == 0 && script == "" {
+		printErrorf("No mirrors configured to export (set them with: crosh config set mirror.npm <url>)")
+		exit(exitConfig)
+	}
+
+	if *dockerfile {
+		fmt.Print(dockerfileSnippet(env, script))
+		return
+	}
+
+	if err := writeFeature(*dir, env, script); err != nil {
+		printError(err)
+		exit(exitFailure)
+	}
+	i18n.Printf("✓ Wrote the devcontainer feature to %s\n", *dir)
+	i18n.Println("  Add it to .devcontainer/devcontainer.json:")
+	fmt.Printf("    \"features\": { \"./%s\": {} }\n", filepath.Base(*dir))
+}
+
+// envVar is an environment variable set in the container
+type envVar struct {
+	name  string
+	value string
+}
+
+// containerEnv returns the environment variables that point npm, pip and go
+// at the mirrors, which covers every user of the container
+func containerEnv(m config.MirrorConfig) []envVar {
+	var env []envVar
+	if m.NPM != "" {
+		env = append(env, envVar{"NPM_CONFIG_REGISTRY", m.NPM})
+	}
+	if m.Pip != "" {
+		env = append(env, envVar{"PIP_INDEX_URL", m.Pip})
+	}
+	if m.Go != "" {
+		env = append(env, envVar{"GOPROXY", m.Go})
+	}
+	return env
+}
+
+// registryURL returns a Docker registry mirror with https:// added when it
+// has no scheme
+func registryURL(registry string) string {
+	if !strings.HasPrefix(registry, "http://") && !strings.HasPrefix(registry, "https://") {
+		return "https://" + registry
+	}
+	return registry
+}
+
+// containerScript returns the shell commands for the mirrors that have no
+// environment variable: apt sources (Ubuntu images only) and cargo's config.
+// It runs as root; in a feature $_REMOTE_USER is the user cargo runs as.
+func containerScript(m config.MirrorConfig) string {
+	return aptScript(m) + cargoScript(m)
+}
+
+// aptScript returns the commands that point Ubuntu's apt sources at the mirror
+func aptScript(m config.MirrorConfig) string {
+	if m.Apt == "" {
+		return ""
+	}
+	return fmt.Sprintf(`if grep -qs '^ID=ubuntu' /etc/os-release; then
+    sed -i -E %s /etc/apt/sources.list /etc/apt/sources.list.d/*.sources 2>/dev/null || true
+fi
+`, shell.Quote(`s#https?://(archive|security|ports)\.ubuntu\.com#http://`+sedEscape(m.Apt)+`#g`))
+}
+
+// cargoScript returns the commands that point cargo at the mirror
+func cargoScript(m config.MirrorConfig) string {
+	if m.Cargo == "" {
+		return ""
+	}
+	return fmt.Sprintf(`if [ -z "$CARGO_HOME" ]; then
+    CARGO_HOME="${_REMOTE_USER_HOME:-$HOME}/.cargo"
+    owner="$_REMOTE_USER"
+fi
+mkdir -p "$CARGO_HOME"
+if ! grep -qs '^\[source.crates-io\]' "$CARGO_HOME/config.toml"; then
+    printf '%%s\n' '[source.crates-io]' "replace-with = 'ustc'" '' '[source.ustc]' %s >> "$CARGO_HOME/config.toml"
+fi
+if [ -n "$owner" ]; then
+    chown "$owner" "$CARGO_HOME" "$CARGO_HOME/config.toml"
+fi
+`, shell.Quote(fmt.Sprintf("registry = %q", m.Cargo)))
+}
+
+// sedEscape escapes s for the replacement of a sed s#...#...# command or the
+// text of an a command, so a mirror URL with & or # in it is written as is
+func sedEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `&`, `\&`, `#`, `\#`, "\n", `\n`).Replace(s)
+}
+
+// dockerfileSnippet formats the setup as ENV and RUN instructions. The RUN
+// heredoc needs BuildKit, the default builder since Docker 23.
+func dockerfileSnippet(env []envVar, script string) string {
+	var b strings.Builder
+	b.WriteString("# Mirrors exported by crosh (crosh export devcontainer --dockerfile)\n")
+	for i, v := range env {
+		switch {
+		case len(env) == 1:
+			fmt.Fprintf(&b, "ENV %s=%q\n", v.name, v.value)
+		case i == 0:
+			fmt.Fprintf(&b, "ENV %s=%q \\\n", v.name, v.value)
+		case i == len(env)-1:
+			fmt.Fprintf(&b, "    %s=%q\n", v.name, v.value)
+		default:
+			fmt.Fprintf(&b, "    %s=%q \\\n", v.name, v.value)
+		}
+	}
+	if script != "" {
+		fmt.Fprintf(&b, "RUN <<'CROSH'\nset -e\n%sCROSH\n", script)
+	}
+	return b.String()
+}
+
+// devcontainerFeature is the devcontainer-feature.json of the exported feature
+type devcontainerFeature struct {
+	ID            string            `json:"id"`
+	Version       string            `json:"version"`
+	Name          string            `json:"name"`
+	Description   string            `json:"description"`
+	ContainerEnv  map[string]string `json:"containerEnv,omitempty"`
+	InstallsAfter []string          `json:"installsAfter"` // so $CARGO_HOME is set
+}
+
+// writeFeature writes a local devcontainer feature: devcontainer-feature.json
+// with the environment variables and install.sh with the script. The feature
+// id has to be the name of its directory.
+func writeFeature(dir string, env []envVar, script string) error {
+	feature := devcontainerFeature{
+		ID:            filepath.Base(dir),
+		Version:       "1.0.0",
+		Name:          "crosh mirrors",
+		Description:   "Package mirrors exported from crosh",
+		ContainerEnv:  make(map[string]string, len(env)),
+		InstallsAfter: []string{"ghcr.io/devcontainers/features/rust"},
+	}
+	for _, v := range env {
+		feature.ContainerEnv[v.name] = v.value
+	}
+	data, err := json.MarshalIndent(feature, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode devcontainer-feature.json: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "devcontainer-feature.json"), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write devcontainer-feature.json: %w", err)
+	}
+	install := "#!/bin/sh\n# Generated by crosh export devcontainer\nset -e\n" + script
+	if err := os.WriteFile(filepath.Join(dir, "install.sh"), []byte(install), 0755); err != nil {
+		return fmt.Errorf("failed to write install.sh: %w", err)
+	}
+	return nil
+}
+
+// handleExportDocker prints Dockerfile lines and a docker-compose build block
+// that apply the mirrors, and the proxy while it is on, during image builds.
+// The mirrors are build args rather than ENV so they don't end up in images
+// shipped elsewhere.
+func handleExportDocker(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("export docker", flag.ContinueOnError)
+	onlyDockerfile := fs.Bool("dockerfile", false, "Only print the Dockerfile lines")
+	onlyCompose := fs.Bool("compose", false, "Only print the docker-compose build block")
+	noProxy := fs.Bool("no-proxy", false, "Leave the proxy out of the build args")
+	fs.Usage = func() {
+		fmt.Println("USAGE:\n    crosh export docker [--dockerfile | --compose] [--no-proxy]")
+		fmt.Println("\nPrints the mirrors and proxy as Dockerfile ARG/RUN lines and docker-compose build args.")
+		fmt.Println("\nFLAGS:")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	env := containerEnv(cfg.Mirror)
+	script := containerScript(cfg.Mirror)
+	var proxyEnv []envVar
+	if cfg.Proxy.Enabled && !*noProxy {
+		proxyEnv = buildProxyEnv(cfg.Proxy.HTTPPort)
+	}
+	if len(env) == 0 && script == "" && len(proxyEnv) == 0 {
+		printErrorf("No mirrors configured to export (set them with: crosh config set mirror.npm <url>)")
+		exit(exitConfig)
+	}
+
+	if !*onlyCompose {
+		fmt.Print(dockerfileArgs(env, script))
+	}
+	if !*onlyDockerfile {
+		if !*onlyCompose {
+			fmt.Println()
+		}
+		fmt.Print(composeBuild(append(env, proxyEnv...), len(proxyEnv) > 0))
+	}
+}
+
+// buildProxyEnv returns the proxy build args. Docker Desktop reaches the
+// host's loopback through host.docker.internal; on Linux the build runs on
+// the host network instead (see composeBuild).
+func buildProxyEnv(port int) []envVar {
+	host := "host.docker.internal"
+	if runtime.GOOS == "linux" {
+		host = "127.0.0.1"
+	}
+	url := fmt.Sprintf("http://%s:%d", host, port)
+	return []envVar{
+		{"HTTP_PROXY", url},
+		{"HTTPS_PROXY", url},
+		{"NO_PROXY", proxy.NoProxy},
+	}
+}
+
+// dockerfileArgs formats the mirrors as ARG instructions with the exported
+// values as defaults, plus the RUN script for apt and cargo. HTTP_PROXY and
+// friends are predefined build args that need no ARG.
+func dockerfileArgs(env []envVar, script string) string {
+	var b strings.Builder
+	b.WriteString("# Dockerfile: mirrors exported by crosh (crosh export docker)\n")
+	for _, v := range env {
+		fmt.Fprintf(&b, "ARG %s=%q\n", v.name, v.value)
+	}
+	if script != "" {
+		fmt.Fprintf(&b, "RUN <<'CROSH'\nset -e\n%sCROSH\n", script)
+	}
+	return b.String()
+}
+
+// composeBuild formats the build args as the build section of a
+// docker-compose service
+func composeBuild(args []envVar, hostNetwork bool) string {
+	var b strings.Builder
+	b.WriteString("# docker-compose.yml: build args exported by crosh (crosh export docker)\n")
+	b.WriteString("services:\n  app:\n    build:\n      context: .\n")
+	if hostNetwork && runtime.GOOS == "linux" {
+		b.WriteString("      network: host # reach the proxy on 127.0.0.1\n")
+	}
+	b.WriteString("      args:\n")
+	for _, v := range args {
+		fmt.Fprintf(&b, "        %s: %s\n", v.name, yamlString(v.value))
+	}
+	return b.String()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/boomyao/crosh/internal/accelerator"
+)
+
+// handleHistory prints the audit log of state-changing operations
+func handleHistory(manager *accelerator.Manager, args []string) {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	limit := fs.Int("n", 20, "Number of entries to show (0 for all)")
+	action := fs.String("action", "", "Only show actions starting with this, e.g. mirror or proxy.start")
+	file := fs.String("file", "", "Only show operations that touched files containing this, e.g. .npmrc")
+	since := fs.Duration("since", 0, "Only show operations within this long, e.g. 24h")
+	asJSON := fs.Bool("json", jsonOutput, "Print entries as JSON lines")
+	fs.Usage = func() {
+		fmt.Println("USAGE:\n    crosh history [-n 20] [--action mirror] [--file .npmrc] [--since 24h] [--json]")
+		fmt.Println("\nShows who enabled, disabled, started, stopped or switched what, and which files it touched.")
+		fmt.Println("\nFLAGS:")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	entries, err := manager.AuditLog()
+	if err != nil {
+		printError(err)
+		exit(exitCode(err))
+	}
+
+	var matched []accelerator.AuditEntry
+	for _, entry := range entries {
+		if *action != "" && !strings.HasPrefix(entry.Action, *action) {
+			continue
+		}
+		if *since > 0 && time.Since(entry.Time) > *since {
+			continue
+		}
+		if *file != "" && !touchesFile(entry, *file) {
+			continue
+		}
+		matched = append(matched, entry)
+	}
+	if *limit > 0 && len(matched) > *limit {
+		matched = matched[len(matched)-*limit:]
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(jsonWriter)
+		for _, entry := range matched {
+			encoder.Encode(entry)
+		}
+		return
+	}
+
+	if len(matched) == 0 {
+		fmt.Printf("No matching operations in %s\n", manager.AuditLogPath())
+		return
+	}
+
+	for _, entry := range matched {
+		mark := "✓"
+		if entry.Error != "" {
+			mark = "✗"
+		}
+		line := fmt.Sprintf("%s %s  %-8s %s", mark, entry.Time.Format("2006-01-02 15:04:05"), entry.User, entry.Action)
+		if entry.Detail != "" {
+			line += " " + entry.Detail
+		}
+		fmt.Println(line)
+		for _, path := range entry.Files {
+			fmt.Printf("      • %s\n", path)
+		}
+		if entry.Error != "" {
+			fmt.Printf("      error: %s\n", entry.Error)
+		}
+	}
+}
+
+// touchesFile checks if an audit entry wrote a file whose path contains pattern
+func touchesFile(entry accelerator.AuditEntry, pattern string) bool {
+	for _, path := range entry.Files {
+		if strings.Contains(path, pattern) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/boomyao/crosh/internal/accelerator"
+	"github.com/boomyao/crosh/internal/config"
+	"github.com/boomyao/crosh/internal/httpclient"
+	"github.com/boomyao/crosh/internal/logging"
+)
+
+// configureHTTP applies the http section of the config to crosh's own
+// downloads. "managed" routes them through crosh's proxy while it runs and
+// falls back to the environment's proxy otherwise.
+func configureHTTP(cfg *config.Config, manager *accelerator.Manager) {
+	proxyURL := cfg.HTTP.Proxy
+	switch proxyURL {
+	case "environment":
+		proxyURL = ""
+	case "managed":
+		proxyURL = ""
+		if xray := manager.GetXrayManager(); xray.IsRunning() {
+			proxyURL = xray.HTTPProxyURL()
+		}
+	}
+
+	userAgent := cfg.HTTP.UserAgent
+	if userAgent == "" {
+		userAgent = "crosh/" + strings.TrimSpace(version)
+	}
+
+	err := httpclient.Configure(httpclient.Settings{
+		Timeout:         time.Duration(cfg.HTTP.Timeout) * time.Second,
+		DownloadTimeout: time.Duration(cfg.HTTP.DownloadTimeout) * time.Second,
+		Proxy:           proxyURL,
+		UserAgent:       userAgent,
+	})
+	if err != nil {
+		logging.Warn("ignoring http.proxy", "error", err)
+	}
+}
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boomyao/crosh/internal/benchcache"
+	"github.com/boomyao/crosh/internal/config"
+	"github.com/boomyao/crosh/internal/i18n"
+	"github.com/boomyao/crosh/internal/logging"
+	"github.com/boomyao/crosh/internal/mirror"
+)
+
+// handleInit walks the user through creating config.yaml
+func handleInit(args []string) {
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
+	fromURL := fs.String("from-url", "", "Merge an organization template from this URL instead of asking")
+	checksum := fs.String("sha256", "", "Expected SHA-256 of the template")
+	publicKey := fs.String("pubkey", "", "Base64 ed25519 public key that signed the template (<url>.sig)")
+	insecure := fs.Bool("insecure", false, "Use the template without verifying it")
+	allowHooks := fs.Bool("allow-hooks", false, "Keep the hooks the template sets without asking")
+	fs.Usage = printInitUsage
+	parseFlags(fs, args)
+
+	path, err := config.GetConfigPath()
+	if err != nil {
+		printError(err)
+		exit(exitCode(err))
+	}
+
+	if *fromURL != "" {
+		initFromTemplate(path, *fromURL, config.TemplateVerification{SHA256: *checksum, PublicKey: *publicKey}, *insecure, *allowHooks)
+		return
+	}
+
+	wizard := &initWizard{reader: bufio.NewReader(os.Stdin)}
+
+	i18n.Println("Welcome to crosh! Let's set up your config.")
+	fmt.Println()
+
+	if _, err := os.Stat(path); err == nil {
+		if !wizard.confirm(i18n.Sprintf("%s already exists. Replace it?", path), false) {
+			i18n.Println("Nothing changed")
+			return
+		}
+		fmt.Println()
+	}
+
+	cfg := wizard.run()
+	if err := cfg.Save(); err != nil {
+		printError(err)
+		exit(exitCode(err))
+	}
+
+	i18n.Printf("✓ Wrote %s\n", path)
+	i18n.Println("\nRun \"crosh on\" to enable acceleration")
+}
+
+// firstRun checks if crosh has never been set up: there is no config file
+// and no system config to inherit from
+func firstRun() bool {
+	if config.HasSystemConfig() {
+		return false
+	}
+	path, err := config.GetConfigPath()
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return os.IsNotExist(err)
+}
+
+// onboard offers the "crosh init" questions before the first command runs, so
+// nobody ends up on mainland China mirrors without being asked. Without a
+// terminal to ask on, it only points at "crosh init" and the defaults apply.
+func onboard(command string) {
+	switch command {
+	case "off", "uninstall":
+		return
+	}
+
+	if jsonOutput || !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		logging.Warn("no config found, using the defaults (mirrors in mainland China); run \"crosh init\" to set up crosh")
+		return
+	}
+
+	path, err := config.GetConfigPath()
+	if err != nil {
+		return
+	}
+
+	wizard := &initWizard{reader: bufio.NewReader(os.Stdin)}
+	i18n.Println("Welcome to crosh! There's no config yet, so let's set one up.")
+	if !wizard.confirm(i18n.T("Set up crosh now?"), true) {
+		// Save the defaults so the question isn't asked again
+		if err := config.NewConfig().Save(); err != nil {
+			printError(err)
+		}
+		i18n.Println("Using the defaults. Run \"crosh init\" any time to change them.")
+		fmt.Println()
+		return
+	}
+	fmt.Println()
+
+	cfg := wizard.run()
+	if err := cfg.Save(); err != nil {
+		printError(err)
+		exit(exitCode(err))
+	}
+	i18n.Printf("✓ Wrote %s\n\n", path)
+}
+
+func printInitUsage() {
+	fmt.Println(i18n.Text(initUsage, initUsageZh))
+}
+
+// initUsage is the help printed by "crosh init --help"
+const initUsage = `USAGE:
+    crosh init
+    crosh init --from-url <url> (--sha256 <hex> | --pubkey <base64> | --insecure)
+
+Interactively creates config.yaml: whether you are in mainland China (if
+not, package managers keep their official registries), which package managers
+crosh manages, which mirror preset to use (optionally benchmarking them
+first), and your proxy subscription URL. The same questions are offered the
+first time any crosh command runs without a config.
+
+With --from-url, an organization template (mirrors, private registries,
+proxy policy) is downloaded, verified and merged into your config instead.
+Settings the template doesn't mention are kept. Hooks, which run shell
+commands, are only kept once you confirm them.
+
+FLAGS:
+    --sha256 <hex>      Expected SHA-256 checksum of the template
+    --pubkey <base64>   ed25519 public key; the base64 signature is read from <url>.sig
+    --insecure          Skip verification (not recommended)
+    --allow-hooks       Keep the template's hooks without asking`
+
+const initUsageZh = `用法：
+    crosh init
+    crosh init --from-url <url> (--sha256 <hex> | --pubkey <base64> | --insecure)
+
+交互式创建 config.yaml：是否在中国大陆（否则包管理器保留官方源）、
+由 crosh 管理的包管理器、使用的镜像预设（可先测速再选择）以及代理订阅地址。
+首次在没有配置的情况下运行任何 crosh 命令时，也会询问这些问题。
+
+使用 --from-url 时，会下载组织模板（镜像、私有仓库、代理策略），
+校验后合并到你的配置中。模板未涉及的设置保持不变。钩子会执行 shell 命令，
+需经你确认后才会保留。
+
+选项：
+    --sha256 <hex>      模板的 SHA-256 校验和
+    --pubkey <base64>   ed25519 公钥；base64 签名从 <url>.sig 读取
+    --insecure          跳过校验（不推荐）`
+
+// initFromTemplate merges a verified organization template into the config.
+// Hooks it sets are kept only if allowHooks is set or the user confirms them.
+func initFromTemplate(path, url string, verify config.TemplateVerification, insecure, allowHooks bool) {
+	if verify.SHA256 == "" && verify.PublicKey == "" && !insecure {
+		i18n.Fprintln(os.Stderr, "✗ Pass --sha256 or --pubkey so the template can be verified (or --insecure to skip)")
+		exit(exitFailure)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		printError(err)
+		exit(configExitCode(err))
+	}
+
+	i18n.Printf("Fetching template from %s...\n", url)
+	data, err := config.FetchTemplate(url, verify)
+	if err != nil {
+		printError(err)
+		exit(exitCode(err))
+	}
+	switch {
+	case verify.PublicKey != "":
+		i18n.Println("✓ Signature verified")
+	case verify.SHA256 != "":
+		i18n.Println("✓ Checksum verified")
+	default:
+		i18n.Println("⚠ Template not verified (--insecure)")
+	}
+
+	hooks := cfg.Hooks
+	changed, err := cfg.MergeTemplate(data)
+	if err != nil {
+		printError(err)
+		exit(exitCode(err))
+	}
+	if !reflect.DeepEqual(hooks, cfg.Hooks) && !allowHooks && !confirmTemplateHooks(cfg.Hooks) {
+		cfg.Hooks = hooks
+		changed = slices.DeleteFunc(changed, func(setting string) bool {
+			return strings.HasPrefix(setting, "hooks = ")
+		})
+		i18n.Println("⚠ Left out the template's hooks (rerun with --allow-hooks to keep them)")
+	}
+	if len(changed) == 0 {
+		i18n.Println("✓ Your config already matches the template")
+		return
+	}
+
+	if err := cfg.Save(); err != nil {
+		printError(err)
+		exit(exitCode(err))
+	}
+
+	i18n.Printf("✓ Merged %d setting(s) into %s:\n", len(changed), path)
+	for _, setting := range changed {
+		fmt.Printf("  • %s\n", setting)
+	}
+	i18n.Println("\nRun \"crosh on\" to apply it (\"crosh config restore\" undoes the merge)")
+}
+
+// confirmTemplateHooks shows the hooks a template sets and asks whether to
+// keep them. Without a terminal to ask on they are left out.
+func confirmTemplateHooks(hooks []config.HookConfig) bool {
+	if !isTerminal(os.Stdin) || !isTerminal(rawStdout) {
+		return false
+	}
+	i18n.Println("\nThe template sets hooks, which run these commands:")
+	for _, hook := range hooks {
+		fmt.Printf("  %s: %s\n", hook.On, hook.Run)
+	}
+	wizard := &initWizard{reader: bufio.NewReader(os.Stdin)}
+	return wizard.confirm(i18n.T("Keep them?"), false)
+}
+
+// initWizard asks the questions of "crosh init"
+type initWizard struct {
+	reader *bufio.Reader
+}
+
+// ask prints a prompt and returns the trimmed answer, or "" at end of input
+func (w *initWizard) ask(prompt string) string {
+	fmt.Print(prompt)
+	answer, err := w.reader.ReadString('\n')
+	if err == io.EOF && answer == "" {
+		fmt.Println()
+	}
+	return strings.TrimSpace(answer)
+}
+
+// run asks the setup questions and returns the resulting config
+func (w *initWizard) run() *config.Config {
+	cfg := config.NewConfig()
+
+	if w.askRegion() {
+		tools := w.askTools()
+		fmt.Println()
+
+		preset := w.askPreset()
+		applyPreset(cfg, preset, tools)
+	} else {
+		// Official registries are the fastest outside mainland China
+		applyPreset(cfg, &mirror.Presets[0], nil)
+	}
+	fmt.Println()
+
+	cfg.Proxy.SubscriptionURL = w.askSubscription()
+	fmt.Println()
+
+	if mirror.InWSL() {
+		// Developers in WSL usually run the same tools on Windows too
+		cfg.WSL.Windows = w.confirm(i18n.T("crosh is running in WSL. Also set the mirrors and package proxy for your Windows user?"), true)
+		fmt.Println()
+	}
+
+	return cfg
+}
+
+// confirm asks a yes/no question
+func (w *initWizard) confirm(question string, defaultYes bool) bool {
+	hint := "[y/N]"
+	if defaultYes {
+		hint = "[Y/n]"
+	}
+	for {
+		switch strings.ToLower(w.ask(question + " " + hint + " ")) {
+		case "":
+			return defaultYes
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		}
+	}
+}
+
+// askRegion asks whether crosh runs in mainland China, where package managers
+// are pointed at domestic mirrors. A Chinese locale or UTC+8 suggests it does.
+func (w *initWizard) askRegion() bool {
+	suggested := 2
+	if _, offset := time.Now().Zone(); offset == 8*60*60 || i18n.Language() == i18n.Chinese {
+		suggested = 1
+	}
+
+	i18n.Println("Where do you use this machine?")
+	i18n.Println("  1. Mainland China (use domestic mirrors)")
+	i18n.Println("  2. Elsewhere (keep the official registries)")
+	for {
+		switch w.ask(i18n.Sprintf("Region [1-2] (default %d): ", suggested)) {
+		case "":
+			return suggested == 1
+		case "1":
+			return true
+		case "2":
+			return false
+		}
+		i18n.Println("  ✗ Pick 1 or 2")
+	}
+}
+
+// askTools asks which package managers crosh should point at mirrors
+func (w *initWizard) askTools() map[string]bool {
+	defaults := make([]string, 0, len(config.MirrorToolNames))
+	for _, name := range config.MirrorToolNames {
+		if name == "apt" && runtime.GOOS != "linux" && runtime.GOOS != "freebsd" {
+			continue
+		}
+		defaults = append(defaults, name)
+	}
+
+	i18n.Println("Which tools should crosh manage?")
+	i18n.Printf("  Available: %s\n", strings.Join(config.MirrorToolNames, ", "))
+	for {
+		answer := w.ask(i18n.Sprintf("Tools (comma separated) [%s]: ", strings.Join(defaults, ",")))
+		if answer == "" {
+			answer = strings.Join(defaults, ",")
+		}
+
+		tools := make(map[string]bool)
+		var unknown []string
+		for _, name := range strings.Split(answer, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			if !contains(config.MirrorToolNames, name) {
+				unknown = append(unknown, name)
+				continue
+			}
+			tools[name] = true
+		}
+		if len(unknown) == 0 {
+			return tools
+		}
+		i18n.Printf("  ✗ Unknown tool(s): %s\n", strings.Join(unknown, ", "))
+	}
+}
+
+// askPreset lets the user pick a mirror preset, benchmarking them on request
+func (w *initWizard) askPreset() *mirror.Preset {
+	order := make([]*mirror.Preset, len(mirror.Presets))
+	for i := range mirror.Presets {
+		order[i] = &mirror.Presets[i]
+	}
+	notes := make(map[*mirror.Preset]string)
+
+	if w.confirm(i18n.T("Benchmark the mirror presets to find the fastest from here?"), true) {
+		i18n.Println("  Probing mirrors...")
+		cache := benchcache.Open(config.BenchCachePath(), time.Duration(config.DefaultConfig().BenchCacheTTL)*time.Second)
+		for i, result := range mirror.BenchPresets(rootCtx, 5*time.Second, cache) {
+			order[i] = result.Preset
+			if result.Err != nil {
+				notes[result.Preset] = "unreachable"
+			} else {
+				notes[result.Preset] = fmt.Sprintf("%dms", result.Latency.Milliseconds())
+			}
+		}
+	}
+
+	i18n.Println("\nMirror presets:")
+	for i, preset := range order {
+		note := ""
+		if notes[preset] != "" {
+			note = fmt.Sprintf(" [%s]", notes[preset])
+		}
+		fmt.Printf("  %d. %-9s %s%s\n", i+1, preset.Name, preset.Description, note)
+	}
+
+	for {
+		answer := w.ask(i18n.Sprintf("Preset [1-%d] (default 1, %s): ", len(order), order[0].Name))
+		if answer == "" {
+			return order[0]
+		}
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(order) {
+			return order[n-1]
+		}
+		if preset, err := mirror.FindPreset(answer); err == nil {
+			return preset
+		}
+		i18n.Printf("  ✗ Pick a number between 1 and %d\n", len(order))
+	}
+}
+
+// askSubscription asks for an optional proxy subscription URL
+func (w *initWizard) askSubscription() string {
+	i18n.Println("crosh can also run a proxy for GitHub and other blocked sites.")
+	for {
+		answer := w.ask(i18n.T("Proxy subscription URL (leave empty to skip): "))
+		if answer == "" || isHTTPURL(answer) {
+			return answer
+		}
+		i18n.Println("  ✗ Expected an http:// or https:// URL")
+	}
+}
+
+// applyPreset sets the mirrors of the chosen tools from a preset and clears
+// the others so crosh leaves them alone
+func applyPreset(cfg *config.Config, preset *mirror.Preset, tools map[string]bool) {
+	pick := func(tool, value string) string {
+		if tools[tool] {
+			return value
+		}
+		return ""
+	}
+
+	cfg.Mirror.NPM = pick("npm", preset.NPM)
+	cfg.Mirror.Pip = pick("pip", preset.Pip)
+	cfg.Mirror.Apt = pick("apt", preset.Apt)
+	cfg.Mirror.Cargo = pick("cargo", preset.Cargo)
+	cfg.Mirror.Go = pick("go", preset.Go)
+	cfg.Mirror.Docker = nil
+	if tools["docker"] {
+		cfg.Mirror.Docker = append([]string(nil), preset.Docker...)
+	}
+}
+
+// contains checks if list has item
+func contains(list []string, item string) bool {
+	for _, entry := range list {
+		if entry == item {
+			return true
+		}
+	}
+	return false
+}
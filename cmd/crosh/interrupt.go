@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/boomyao/crosh/internal/i18n"
+)
+
+// interruptGrace is how long an interrupted command gets to stop its
+// downloads and node tests and remove their temp files before it is ended
+const interruptGrace = 5 * time.Second
+
+// rootCtx is cancelled when an interruptible command gets Ctrl+C or SIGTERM
+var rootCtx = context.Background()
+
+// interruptibleCommands are the commands, and "command subcommand" pairs,
+// that cancel their downloads, node tests and benchmarks on Ctrl+C instead
+// of being killed halfway through writing a file. Commands with their own
+// signal handling, like the daemon, cache server and proxy exec, aren't
+// listed.
+var interruptibleCommands = map[string]bool{
+	"on":            true,
+	"bootstrap":     true,
+	"init":          true,
+	"doctor":        true,
+	"self-update":   true,
+	"proxy nodes":   true,
+	"proxy geodata": true,
+	"proxy bench":   true,
+}
+
+// handleInterrupts makes rootCtx cancellable for interruptible commands. The
+// first Ctrl+C cancels it and gives the command interruptGrace to clean up,
+// a second one exits at once.
+func handleInterrupts(args []string) {
+	if !interruptible(args) {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rootCtx = ctx
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+		i18n.Fprintf(os.Stderr, "\nInterrupted, cleaning up (press Ctrl+C again to quit now)...\n")
+		select {
+		case <-signals:
+		case <-time.After(interruptGrace):
+		}
+		exit(exitInterrupted)
+	}()
+}
+
+// interruptible checks if the command in args handles interrupts. Running
+// crosh without a command, with a subscription URL or a YAML file starts the
+// proxy like "crosh on".
+func interruptible(args []string) bool {
+	if len(args) == 0 || isHTTPURL(args[0]) || isYAMLFile(args[0]) {
+		return true
+	}
+	if interruptibleCommands[args[0]] {
+		return true
+	}
+	return len(args) >= 2 && interruptibleCommands[args[0]+" "+args[1]]
+}
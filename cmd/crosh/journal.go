@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/boomyao/crosh/internal/accelerator"
+	"github.com/boomyao/crosh/internal/config"
+	"github.com/boomyao/crosh/internal/i18n"
+	"github.com/boomyao/crosh/internal/logging"
+	"github.com/boomyao/crosh/internal/userfile"
+)
+
+// recoverInterrupted deals with operations a killed crosh left half done,
+// which the journal records: on a terminal it asks whether to finish or roll
+// back each one, with --yes it finishes them (or rolls back what can't be
+// finished), and otherwise it warns and leaves them for the next run. The
+// caller holds the settings lock.
+func recoverInterrupted(manager *accelerator.Manager, cfg *config.Config) {
+	journals, err := userfile.Incomplete()
+	if err != nil {
+		logging.Warn("failed to read the operation journal", "error", err)
+		return
+	}
+
+	for _, j := range journals {
+		what := j.Op
+		if len(j.Args) > 0 {
+			what += " " + strings.Join(j.Args, " ")
+		}
+		i18n.Fprintf(os.Stderr, "⚠ crosh was stopped halfway through %s (%s), these files may be half changed:\n", what, j.Started.Format("2006-01-02 15:04"))
+		for _, file := range j.Files {
+			fmt.Fprintf(os.Stderr, "    %s\n", file.Path)
+		}
+
+		switch askRecovery(accelerator.CanFinish(j)) {
+		case "finish":
+			if err := manager.FinishOperation(j); err != nil {
+				printErrorf("Failed to finish %s: %v", what, err)
+				continue
+			}
+			if err := cfg.Save(); err != nil {
+				printErrorf("Failed to save config: %v", err)
+			}
+			j.Discard()
+			i18n.Fprintf(os.Stderr, "✓ Finished %s\n\n", what)
+		case "rollback":
+			if err := j.Rollback(); err != nil {
+				printErrorf("Failed to roll back %s: %v", what, err)
+				continue
+			}
+			i18n.Fprintf(os.Stderr, "✓ Rolled back %s\n\n", what)
+		default:
+			i18n.Fprintf(os.Stderr, "  Left as is; run crosh on a terminal, or with --yes, to finish or roll it back\n\n")
+		}
+	}
+}
+
+// askRecovery returns "finish", "rollback" or "" for leaving an interrupted
+// operation alone, asking on a terminal
+func askRecovery(canFinish bool) string {
+	if assumeYes {
+		if canFinish {
+			return "finish"
+		}
+		return "rollback"
+	}
+	if jsonOutput || !isTerminal(os.Stdin) || !isTerminal(rawStdout) {
+		return ""
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		if canFinish {
+			i18n.Fprintf(os.Stderr, "[f]inish it, [r]oll it back or [l]eave it for now? ")
+		} else {
+			i18n.Fprintf(os.Stderr, "[r]oll it back or [l]eave it for now? ")
+		}
+		answer, err := reader.ReadString('\n')
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "f", "finish":
+			if canFinish {
+				return "finish"
+			}
+		case "r", "roll back", "rollback":
+			return "rollback"
+		case "l", "leave":
+			return ""
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr)
+			return ""
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/boomyao/crosh/internal/config"
+)
+
+// k8sName names the ConfigMap and the DaemonSet
+const k8sName = "crosh-registry-mirrors"
+
+// handleExportK8s prints a ConfigMap with containerd's hosts.toml for
+// docker.io and a DaemonSet that copies it onto every node, so a cluster
+// pulls Docker Hub images through the configured registry mirrors
+func handleExportK8s(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("export k8s", flag.ContinueOnError)
+	namespace := fs.String("namespace", "kube-system", "Namespace of the ConfigMap and the DaemonSet")
+	image := fs.String("image", "", "Image of the DaemonSet, which needs sh, cmp and cp (default busybox through the first mirror)")
+	onlyConfigMap := fs.Bool("configmap", false, "Only print the ConfigMap with hosts.toml")
+	fs.Usage = func() {
+		fmt.Println("USAGE:\n    crosh export k8s [--namespace kube-system] [--image <image>] [--configmap]")
+		fmt.Println("\nPrints Kubernetes manifests that point containerd on every node at the Docker registry mirrors.")
+		fmt.Println("Apply them with: crosh export k8s | kubectl apply -f -")
+		fmt.Println("\nFLAGS:")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	if len(cfg.Mirror.Docker) == 0 {
+		printErrorf("No Docker registry mirrors configured (set them with: crosh config set mirror.docker <registry>)")
+		exit(exitConfig)
+	}
+	if *image == "" {
+		host := registryURL(cfg.Mirror.Docker[0])
+		host = strings.TrimPrefix(strings.TrimPrefix(host, "https://"), "http://")
+		*image = strings.TrimSuffix(host, "/") + "/library/busybox:1.36"
+	}
+
+	fmt.Print(k8sConfigMap(*namespace, containerdHosts(cfg.Mirror.Docker)))
+	if !*onlyConfigMap {
+		fmt.Print(k8sDaemonSet(*namespace, *image))
+	}
+}
+
+// containerdHosts returns the hosts.toml that makes containerd try the
+// mirrors in order before Docker Hub. containerd reads it from
+// /etc/containerd/certs.d/docker.io when its CRI registry config_path is
+// /etc/containerd/certs.d.
+func containerdHosts(registries []string) string {
+	var b strings.Builder
+	b.WriteString("server = \"https://registry-1.docker.io\"\n")
+	for _, registry := range registries {
+		fmt.Fprintf(&b, "\n[host.%q]\n  capabilities = [\"pull\", \"resolve\"]\n", registryURL(registry))
+	}
+	return b.String()
+}
+
+// k8sConfigMap formats hosts as a ConfigMap
+func k8sConfigMap(namespace, hosts string) string {
+	var b strings.Builder
+	b.WriteString("# Registry mirrors exported by crosh (crosh export k8s)\n")
+	fmt.Fprintf(&b, `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: %s
+  namespace: %s
+  labels:
+    app.kubernetes.io/name: %s
+    app.kubernetes.io/managed-by: crosh
+data:
+  hosts.toml: |
+%s`, k8sName, namespace, k8sName, indent(hosts, "    "))
+	return b.String()
+}
+
+// k8sDaemonSet formats a DaemonSet that runs on every node, control plane
+// included, and keeps the node's hosts.toml in sync with the ConfigMap.
+// containerd reads hosts.toml on every pull, so it needs no restart.
+func k8sDaemonSet(namespace, image string) string {
+	return fmt.Sprintf(`---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: %[1]s
+  namespace: %[2]s
+  labels:
+    app.kubernetes.io/name: %[1]s
+    app.kubernetes.io/managed-by: crosh
+spec:
+  selector:
+    matchLabels:
+      app.kubernetes.io/name: %[1]s
+  template:
+    metadata:
+      labels:
+        app.kubernetes.io/name: %[1]s
+    spec:
+      tolerations:
+        - operator: Exists
+      containers:
+        - name: sync
+          image: %[3]s
+          command:
+            - sh
+            - -c
+            - |
+              mkdir -p /certs.d/docker.io
+              while true; do
+                if ! cmp -s /config/hosts.toml /certs.d/docker.io/hosts.toml; then
+                  cp /config/hosts.toml /certs.d/docker.io/hosts.toml
+                  echo "crosh: updated /etc/containerd/certs.d/docker.io/hosts.toml"
+                fi
+                sleep 60
+              done
+          resources:
+            requests:
+              cpu: 1m
+              memory: 8Mi
+            limits:
+              memory: 32Mi
+          volumeMounts:
+            - name: config
+              mountPath: /config
+              readOnly: true
+            - name: certs
+              mountPath: /certs.d
+      volumes:
+        - name: config
+          configMap:
+            name: %[1]s
+        - name: certs
+          hostPath:
+            path: /etc/containerd/certs.d
+            type: DirectoryOrCreate
+`, k8sName, namespace, yamlString(image))
+}
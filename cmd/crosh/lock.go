@@ -0,0 +1,84 @@
+package main
+
+import (
+	"time"
+
+	"github.com/boomyao/crosh/internal/lock"
+)
+
+// lockWait is how long a command waits for another crosh instance to finish
+// changing settings before giving up
+const lockWait = 3 * time.Second
+
+// unlockedCommands are the commands, and "command subcommand" pairs, that
+// don't change settings, or only take the lock while they do, like the
+// long-running daemon, cache server and health monitor
+var unlockedCommands = map[string]bool{
+	"status":           true,
+	"history":          true,
+	"export":           true,
+	"serve":            true,
+	"prefetch":         true,
+	"daemon":           true,
+	"cache":            true,
+	"proxy status":     true,
+	"proxy exec":       true,
+	"proxy env":        true,
+	"proxy logs":       true,
+	"proxy nodes":      true,
+	"proxy qr":         true,
+	"proxy bench":      true,
+	"proxy dashboard":  true,
+	"proxy health":     true,
+	"proxy monitor":    true,
+	"profile list":     true,
+	"config validate":  true,
+	"config get":       true,
+	"config diff":      true,
+	"config export":    true,
+	"telemetry status": true,
+}
+
+// lockCommands are the commands that take the settings lock before
+// telemetry is set up, so usageCommands leaves them out, with their
+// subcommands
+var lockCommands = map[string][]string{
+	"init":   nil,
+	"config": {"edit", "import", "set", "reset", "restore", "encrypt", "decrypt"},
+}
+
+// lockCommand names the command in args for the lock file the way
+// usageCommand does for telemetry, leaving out subscription URLs and
+// anything else the user typed in
+func lockCommand(args []string) string {
+	if len(args) > 0 {
+		if subcommands, ok := lockCommands[args[0]]; ok {
+			return commandWords(args, subcommands)
+		}
+	}
+	return usageCommand(args)
+}
+
+// lockSettings takes the settings lock for commands that change settings, so
+// two crosh instances can't interleave their writes to config.yaml or
+// .npmrc. The lock is held until the process exits.
+func lockSettings(args []string) {
+	if !changesSettings(args) {
+		return
+	}
+	if err := lock.Acquire(lockWait); err != nil {
+		printError(err)
+		exit(exitFailure)
+	}
+}
+
+// changesSettings checks if the command in args needs the settings lock
+func changesSettings(args []string) bool {
+	if len(args) == 0 {
+		return true
+	}
+	if unlockedCommands[args[0]] {
+		return false
+	}
+	return len(args) < 2 || !unlockedCommands[args[0]+" "+args[1]]
+}
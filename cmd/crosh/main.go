@@ -1,27 +1,144 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/boomyao/crosh/internal/accelerator"
 	"github.com/boomyao/crosh/internal/config"
+	"github.com/boomyao/crosh/internal/daemon"
+	"github.com/boomyao/crosh/internal/hint"
+	"github.com/boomyao/crosh/internal/i18n"
+	"github.com/boomyao/crosh/internal/lock"
+	"github.com/boomyao/crosh/internal/logging"
+	"github.com/boomyao/crosh/internal/proxy"
+	"github.com/boomyao/crosh/internal/sysenv"
+	"github.com/boomyao/crosh/internal/update"
 )
 
-// version will be set by ldflags during build
-var version = "dev"
+// Build metadata, set by ldflags during build (see the Makefile)
+var (
+	version   = "dev"
+	commit    = ""
+	buildTime = ""
+)
 
 func main() {
+	os.Args = append(os.Args[:1], parseGlobalFlags(os.Args[1:])...)
+	defer flushOutput()
+
+	// Commands that must feel instant run before anything touches the disk:
+	// no log file, PATH probing, migration, onboarding or stale settings
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "prompt":
+			// Runs on every shell prompt, so it only reads its cache
+			handlePrompt(os.Args[2:])
+			return
+		case "help", "-h", "--help":
+			useConfiguredLanguage()
+			printUsage()
+			return
+		case "version", "-v", "--version":
+			useConfiguredLanguage()
+			handleVersion(os.Args[2:])
+			return
+		}
+	}
+
+	startLogging()
+	defer logging.Close()
+	sysenv.AddHomebrewPath()
+	hint.SetSudoCommand(sysenv.SudoCommand(""))
+	handleInterrupts(os.Args[1:])
+	lock.Command = lockCommand(os.Args[1:])
+
+	// "crosh config" must work even when config.yaml doesn't load
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		lockSettings(os.Args[1:])
+		handleConfig(os.Args[2:])
+		return
+	}
+
+	// Move ~/.crosh into the XDG config/data/state directories
+	if moved, err := config.MigrateLegacyDir(proxy.BackgroundRunning); err != nil {
+		i18n.Fprintf(os.Stderr, "⚠ Failed to move ~/.crosh to the XDG directories: %v\n", err)
+		hint.Fprint(os.Stderr, "  ", err)
+		fmt.Fprintln(os.Stderr)
+	} else if moved {
+		i18n.Fprintf(os.Stderr, "✓ Moved ~/.crosh to %s, %s and %s\n\n", config.ConfigDir(), config.DataDir(), config.StateDir())
+	}
+
+	// "crosh init" writes a fresh config.yaml, so it doesn't need the current one
+	if len(os.Args) > 1 && os.Args[1] == "init" {
+		lockSettings(os.Args[1:])
+		handleInit(os.Args[2:])
+		return
+	}
+
+	// "crosh self-update" must work even when the config is broken
+	if len(os.Args) > 1 && os.Args[1] == "self-update" {
+		handleSelfUpdate(os.Args[2:])
+		return
+	}
+	update.RemoveOld()
+
+	// "crosh doctor" reports a broken config instead of refusing to run
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		handleDoctor(os.Args[2:])
+		return
+	}
+
+	// Offer a guided setup on first run instead of silently using the defaults
+	if firstRun() {
+		command := ""
+		if len(os.Args) > 1 {
+			command = os.Args[1]
+		}
+		onboard(command)
+	}
+
 	// Load config
 	cfg, err := config.Load()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
-		os.Exit(1)
+		printErrorf("Error loading config: %v", err)
+		exit(configExitCode(err))
 	}
+	i18n.SetLanguage(cfg.Language)
+	hint.SetSudoCommand(sysenv.SudoCommand(cfg.Sudo))
+	printConfigWarnings(cfg)
+	usageConfig = cfg
+	defer reportUsage(exitOK)
 
 	// Create manager
 	manager := accelerator.NewManager(cfg)
+	manager.SetContext(rootCtx)
+	configureHTTP(cfg, manager)
+
+	// Commands that change settings hold the lock until they exit
+	lockSettings(os.Args[1:])
+
+	// Undo git/package manager proxy settings left behind by a proxy that
+	// crashed or didn't survive a reboot, deal with mirror changes a killed
+	// crosh left half done and rotate the proxy log, unless another crosh is
+	// busy
+	if lock.Acquire(0) == nil {
+		if released := manager.RecoverStaleSettings(); len(released) > 0 {
+			i18n.Fprintf(os.Stderr, "⚠ Proxy is no longer running, removed stale %s proxy settings (restore with: crosh on)\n\n", strings.Join(released, ", "))
+		}
+		recoverInterrupted(manager, cfg)
+		// A proxy left running without the daemon or the health monitor
+		// only has its log rotated here
+		if xray := manager.GetXrayManager(); xray.IsRunning() {
+			if err := xray.RotateLog(); err != nil {
+				logging.Warn("failed to rotate the proxy log", "error", err)
+			}
+		}
+		lock.Release()
+	}
 
 	// No arguments: default to "on"
 	if len(os.Args) < 2 {
@@ -50,15 +167,43 @@ func main() {
 	case "off":
 		handleOff(manager, cfg)
 	case "status":
-		handleStatus(manager, cfg)
-	case "version", "-v", "--version":
-		fmt.Printf("crosh version %s\n", strings.TrimSpace(version))
-	case "help", "-h", "--help":
-		printUsage()
+		handleStatus(manager, cfg, os.Args[2:])
+	case "proxy":
+		handleProxy(manager, cfg, os.Args[2:])
+	case "profile":
+		handleProfile(manager, cfg, os.Args[2:])
+	case "mirror":
+		handleMirror(manager, cfg, os.Args[2:])
+	case "history":
+		handleHistory(manager, os.Args[2:])
+	case "export":
+		handleExport(cfg, os.Args[2:])
+	case "bootstrap":
+		handleBootstrap(manager, cfg, os.Args[2:])
+	case "daemon":
+		handleDaemon(manager, cfg, os.Args[2:])
+	case "serve":
+		handleServe(manager, cfg, os.Args[2:])
+	case "cache":
+		handleCache(manager, cfg, os.Args[2:])
+	case "prefetch":
+		handlePrefetch(cfg, os.Args[2:])
+	case "uninstall":
+		handleUninstall(manager, os.Args[2:])
+	case "telemetry":
+		handleTelemetry(cfg, os.Args[2:])
 	default:
-		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", arg)
+		i18n.Fprintf(os.Stderr, "Unknown command: %s\n\n", arg)
 		printUsage()
-		os.Exit(1)
+		exit(exitFailure)
+	}
+}
+
+// useConfiguredLanguage switches to the language set in the config, if it
+// loads, without any of the setup regular commands do first
+func useConfiguredLanguage() {
+	if cfg, err := config.Load(); err == nil {
+		i18n.SetLanguage(cfg.Language)
 	}
 }
 
@@ -80,21 +225,82 @@ func isYAMLFile(s string) bool {
 }
 
 func printUsage() {
-	fmt.Println(`crosh - Network acceleration for Chinese developers
+	fmt.Println(i18n.Text(usage, usageZh))
+}
+
+// usage is the help printed by "crosh help"
+const usage = `crosh - Network acceleration for Chinese developers
 
 USAGE:
     crosh [command]
 
 COMMANDS:
     (no args)           Enable acceleration (default)
+    init                Create config.yaml interactively
     on                  Enable acceleration
     off                 Disable acceleration
-    status              Show current status
+    status [--watch]    Show current status; --watch refreshes it every 2s
+                        (--interval) with live proxy latency and traffic
+    proxy <command>     Manage the proxy (run "crosh proxy help")
+    config validate     Check config.yaml for mistakes
+    profile <command>   Switch between named setups (run "crosh profile help")
+    mirror enable [--container <name>]
+                        Enable the mirrors, or set them up inside a running
+                        Docker container
+    history             Show what crosh changed, when, by whom and which files
+    doctor              Diagnose the config, mirrors, tools and proxy and suggest fixes
+    export devcontainer Set up the same mirrors in devcontainer and Docker builds
+    export ansible      Write an Ansible role that sets up the same mirrors
+    export docker       Print Dockerfile and docker-compose lines for image builds
+    export k8s          Print manifests that roll the registry mirrors out to a
+                        Kubernetes cluster's containerd
+    export ci           Print the mirrors for GitHub Actions or GitLab CI
+    export proxychains  Write a proxychains.conf for tools that ignore proxy
+                        environment variables
+    bootstrap [--env]   Set up mirrors for installed tools and start the proxy
+                        without questions (Codespaces, Gitpod); prints JSON,
+                        or proxy exports for eval with --env
+    daemon <command>    Run crosh in the background to own the proxy and serve
+                        a local REST API (run "crosh daemon help")
+    serve [--port 7682] Serve read-only JSON (/status, /mirrors, /nodes) on
+                        localhost for editor extensions and menu-bar apps;
+                        --metrics-addr adds Prometheus metrics
+    cache serve         Cache npm, PyPI and Go module downloads on disk for
+                        offline use and the LAN (run "crosh cache help")
+    prefetch -f <file>  Download listed npm, pip, go packages and Docker images
+                        into a bundle for an air-gapped machine
+    prompt              Print a short status (mirrors, proxy node, latency) for
+                        starship or powerlevel10k; cached, so it takes milliseconds
     <subscription-url>  Configure proxy subscription and auto-start
     <config.yaml>       Use local YAML file (one-time configuration)
-    version             Show version
+    self-update         Install the latest release (checksum verified)
+    uninstall           Revert everything crosh changed and delete its files
+    telemetry on|off    Send anonymous usage metrics (command, OS/arch, success;
+                        off by default, run "crosh telemetry" to see them)
+    version [--check]   Show version, commit and build date; --check also
+                        looks for a newer release
     help                Show this help
 
+GLOBAL FLAGS:
+    -q, --quiet         Only print errors
+    -v, -vv             Print more details (-vv includes debug messages); everything
+                        is also logged to ~/.local/state/crosh/logs/crosh.log
+    --json, --output json
+                        Print status, doctor, history, proxy status, proxy nodes
+                        and proxy bench as JSON for scripts and dashboards
+    --plain             Print ASCII tags ([OK], [WARN], [ERROR]) instead of emoji,
+                        colors and box drawing; on by default when CI is set
+    -y, --yes           Change files such as .zshrc or daemon.json without first
+                        showing the diff and asking (only asked on a terminal)
+
+EXIT CODES:
+    0 ok, 1 error, 2 partial failure, 3 config error, 4 network error,
+    5 needs root or administrator rights
+
+LANGUAGE:
+    Messages are in Chinese or English depending on LC_ALL, LC_MESSAGES or
+    LANG; set language: zh | en | auto in the config to override
+
 EXAMPLES:
     # Enable acceleration
     crosh
@@ -113,220 +319,589 @@ EXAMPLES:
     # Check status
     crosh status
 
-For more information, visit: https://github.com/boomyao/crosh`)
+    # Run a single command through the proxy
+    crosh proxy exec -- git clone https://github.com/user/repo
+
+For more information, visit: https://github.com/boomyao/crosh`
+
+const usageZh = `crosh - 面向中国开发者的网络加速工具
+
+用法：
+    crosh [命令]
+
+命令：
+    (无参数)            开启加速（默认）
+    init                交互式创建 config.yaml
+    on                  开启加速
+    off                 关闭加速
+    status [--watch]    查看当前状态；--watch 每 2 秒（--interval）刷新一次，
+                        并显示代理的实时延迟和流量
+    proxy <命令>        管理代理（运行 "crosh proxy help" 查看）
+    config validate     检查 config.yaml 中的错误
+    profile <命令>      切换命名的配置方案（运行 "crosh profile help" 查看）
+    mirror enable [--container <名称>]
+                        开启镜像，或在运行中的 Docker 容器内配置镜像
+    history             查看 crosh 的修改记录：时间、操作者和涉及的文件
+    doctor              诊断配置、镜像、工具和代理并给出修复建议
+    export devcontainer 在 devcontainer 和 Docker 构建中使用相同的镜像
+    export ansible      生成在受管机器上配置相同镜像的 Ansible role
+    export docker       生成用于镜像构建的 Dockerfile 和 docker-compose 片段
+    export k8s          生成将镜像源下发到 Kubernetes 集群各节点 containerd 的清单
+    export ci           生成 GitHub Actions 或 GitLab CI 使用的镜像配置
+    export proxychains  为不支持代理环境变量的工具生成 proxychains.conf
+    bootstrap [--env]   无需交互地为已安装的工具配置镜像并启动代理
+                        （Codespaces、Gitpod）；输出 JSON，--env 时输出可
+                        eval 的代理环境变量
+    daemon <命令>       在后台运行 crosh，托管代理并提供本地 REST API
+                        （运行 "crosh daemon help" 查看）
+    serve [--port 7682] 在本机提供只读 JSON（/status、/mirrors、/nodes），
+                        供编辑器扩展和菜单栏应用使用；--metrics-addr 同时
+                        提供 Prometheus 指标
+    cache serve         在本地磁盘缓存 npm、PyPI 和 Go 模块下载，
+                        可离线使用并供局域网共享（运行 "crosh cache help" 查看）
+    prefetch -f <文件>  将列出的 npm、pip、go 包和 Docker 镜像下载为离线包，
+                        供无网络的机器使用
+    prompt              输出简短状态（镜像、代理节点、延迟），用于 starship 或
+                        powerlevel10k；带缓存，只需几毫秒
+    <订阅地址>          配置代理订阅并自动启动
+    <config.yaml>       使用本地 YAML 文件（一次性配置）
+    self-update         安装最新版本（校验校验和）
+    uninstall           撤销 crosh 的所有修改并删除其文件
+    telemetry on|off    发送匿名使用统计（命令、系统/架构、是否成功；
+                        默认关闭，运行 "crosh telemetry" 查看内容）
+    version [--check]   查看版本、提交和构建日期；--check 同时检查新版本
+    help                显示本帮助
+
+全局选项：
+    -q, --quiet         只输出错误
+    -v, -vv             输出更多信息（-vv 包含调试信息）；所有信息
+                        也会记录到 ~/.local/state/crosh/logs/crosh.log
+    --json, --output json
+                        以 JSON 格式输出 status、doctor、history、proxy status、
+                        proxy nodes 和 proxy bench，便于脚本和监控面板使用
+    --plain             用 ASCII 标记（[OK]、[WARN]、[ERROR]）代替表情符号、
+                        颜色和制表符；设置了 CI 环境变量时默认开启
+    -y, --yes           修改 .zshrc、daemon.json 等文件前不显示差异、不询问
+                        （仅在终端中才会询问）
+
+退出码：
+    0 成功，1 错误，2 部分失败，3 配置错误，4 网络错误，
+    5 需要 root 或管理员权限
+
+语言：
+    根据 LC_ALL、LC_MESSAGES 或 LANG 自动选择中文或英文，
+    可在配置中用 language: zh | en | auto 覆盖
+
+示例：
+    # 开启加速
+    crosh
+    crosh on
+
+    # 关闭加速
+    crosh off
+
+    # 配置代理订阅（自动启动代理和镜像）
+    crosh https://your-subscription-url
+
+    # 使用本地 YAML 文件（一次性使用，不保存）
+    crosh config.yaml
+    crosh /path/to/proxies.yml
+
+    # 查看状态
+    crosh status
+
+    # 通过代理运行单条命令
+    crosh proxy exec -- git clone https://github.com/user/repo
+
+更多信息请访问：https://github.com/boomyao/crosh`
+
+// offerNoProxyBypass offers to route the hosts of an existing NO_PROXY, such
+// as a company's intranet set up by corporate tooling, around crosh's proxy too
+func offerNoProxyBypass(manager *accelerator.Manager, cfg *config.Config) {
+	var missing []string
+	for _, host := range proxy.EnvNoProxy() {
+		if entry := proxy.NormalizeBypass(host); entry != "" && entry != "*" && !contains(cfg.Proxy.Bypass, entry) {
+			missing = append(missing, entry)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+
+	question := i18n.Sprintf("NO_PROXY has hosts crosh's proxy doesn't bypass: %s. Bypass them too?", strings.Join(missing, ", "))
+	if !assumeYes {
+		if jsonOutput || !isTerminal(os.Stdin) || !isTerminal(rawStdout) {
+			i18n.Printf("\n⚠ NO_PROXY has hosts crosh's proxy doesn't bypass: %s\n", strings.Join(missing, ", "))
+			i18n.Printf("  Bypass them too with: crosh proxy bypass add %s\n", strings.Join(missing, " "))
+			return
+		}
+		fmt.Println()
+		wizard := initWizard{reader: bufio.NewReader(os.Stdin)}
+		if !wizard.confirm(question, true) {
+			return
+		}
+	}
+
+	added, err := manager.AddBypass(missing)
+	if err != nil {
+		printErrorf("Failed to update bypass list: %v", err)
+		return
+	}
+	for _, entry := range added {
+		i18n.Printf("✓ %s now connects directly\n", entry)
+	}
+}
+
+// startProxy starts the proxy, downloading Xray-core and trying again if
+// it fails to start
+func startProxy(manager *accelerator.Manager, cfg *config.Config) error {
+	// A running daemon owns the proxy
+	if handled, err := viaDaemon(manager, cfg, (*daemon.Client).StartProxy); handled {
+		if err != nil {
+			i18n.Fprintf(os.Stderr, "✗ Proxy failed: %v\n", err)
+			return err
+		}
+		i18n.Println("✓ Proxy enabled")
+		return nil
+	}
+
+	err := manager.EnableProxy()
+	if err == nil {
+		i18n.Println("✓ Proxy enabled")
+		return nil
+	}
+
+	// If proxy fails, might be missing xray-core. Its hint would say to run
+	// "crosh on", so only the error is shown.
+	i18n.Fprintf(os.Stderr, "✗ Proxy failed: %v\n", err)
+	i18n.Println("\nTrying to download Xray-core...")
+
+	if downloadErr := manager.GetXrayManager().Download(); downloadErr != nil {
+		printErrorf("Failed to download Xray-core: %v", downloadErr)
+		i18n.Println("\nProxy acceleration is unavailable.")
+		i18n.Println("Mirrors are still enabled and working.")
+		return downloadErr
+	}
+
+	// Retry enabling proxy after download
+	if retryErr := manager.EnableProxy(); retryErr != nil {
+		printErrorf("Proxy still failed: %v", retryErr)
+		return retryErr
+	}
+	i18n.Println("✓ Proxy enabled")
+	return nil
 }
 
 func handleOn(manager *accelerator.Manager, cfg *config.Config) {
-	fmt.Println("Enabling acceleration...")
+	i18n.Println("Enabling acceleration...")
 	fmt.Println()
 
+	var errs []error
+	attempted := 1
+
 	// Always enable mirrors (safe and beneficial)
-	cfg.Mirror.Enabled = true
 	if err := manager.EnableMirrors(); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: Failed to enable mirrors: %v\n", err)
+		logging.Warn("failed to enable mirrors", "error", err)
+		errs = append(errs, err)
 	} else {
-		fmt.Println("✓ Mirrors enabled (npm, pip, apt, cargo, go)")
+		i18n.Println("✓ Mirrors enabled (npm, pip, apt, cargo, go)")
 	}
 
-	// Enable proxy if subscription is configured
-	if cfg.Proxy.SubscriptionURL != "" {
+	// Enable proxy if a subscription or manual nodes are configured
+	if manager.HasProxySource() {
+		attempted++
 		cfg.Proxy.Enabled = true
-		if err := manager.EnableProxy(); err != nil {
-			// If proxy fails, might be missing xray-core
-			fmt.Fprintf(os.Stderr, "✗ Proxy failed: %v\n", err)
-			fmt.Println("\nTrying to download Xray-core...")
-
-			xray := manager.GetXrayManager()
-			if downloadErr := xray.Download(); downloadErr != nil {
-				fmt.Fprintf(os.Stderr, "✗ Failed to download Xray-core: %v\n", downloadErr)
-				fmt.Println("\nProxy acceleration is unavailable.")
-				fmt.Println("Mirrors are still enabled and working.")
-			} else {
-				// Retry enabling proxy after download
-				if retryErr := manager.EnableProxy(); retryErr != nil {
-					fmt.Fprintf(os.Stderr, "✗ Proxy still failed: %v\n", retryErr)
-				} else {
-					fmt.Println("✓ Proxy enabled")
-				}
-			}
-		} else {
-			fmt.Println("✓ Proxy enabled")
+		if err := startProxy(manager, cfg); err != nil {
+			errs = append(errs, err)
+		}
+		if manager.GetXrayManager().IsRunning() {
+			offerNoProxyBypass(manager, cfg)
 		}
 	}
 
 	cfg.Save()
-	fmt.Println("\n✓ Acceleration enabled")
+	if len(errs) > 0 {
+		code := exitCodeAll(errs, attempted)
+		if code == exitPartial {
+			i18n.Println("\n⚠ Acceleration partly enabled, see the errors above")
+		}
+		exit(code)
+	}
+	i18n.Println("\n✓ Acceleration enabled")
 }
 
 func handleOff(manager *accelerator.Manager, cfg *config.Config) {
-	fmt.Println("Disabling acceleration...")
+	i18n.Println("Disabling acceleration...")
 	fmt.Println()
 
+	var errs []error
+
 	// Disable mirrors
 	if err := manager.DisableMirrors(); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: Failed to disable mirrors: %v\n", err)
+		logging.Warn("failed to disable mirrors", "error", err)
+		errs = append(errs, err)
 	} else {
-		fmt.Println("✓ Mirrors disabled")
+		i18n.Println("✓ Mirrors disabled")
 	}
 
-	// Disable proxy
-	if err := manager.DisableProxy(); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: Failed to disable proxy: %v\n", err)
+	// Disable proxy, through the daemon if one owns it
+	wasEnabled := cfg.Proxy.Enabled
+	handled, err := viaDaemon(manager, cfg, (*daemon.Client).StopProxy)
+	if !handled {
+		err = manager.DisableProxy()
+	}
+	if err != nil {
+		logging.Warn("failed to disable proxy", "error", err)
+		errs = append(errs, err)
 	} else {
-		if cfg.Proxy.Enabled {
-			fmt.Println("✓ Proxy disabled")
+		if wasEnabled {
+			i18n.Println("✓ Proxy disabled")
 		}
 	}
 
-	cfg.Mirror.Enabled = false
 	cfg.Proxy.Enabled = false
 	cfg.Save()
 
-	fmt.Println("\n✓ Acceleration disabled")
+	if len(errs) > 0 {
+		code := exitCodeAll(errs, 2)
+		if code == exitPartial {
+			i18n.Println("\n⚠ Acceleration partly disabled, see the errors above")
+		}
+		exit(code)
+	}
+	i18n.Println("\n✓ Acceleration disabled")
+}
+
+func handleStatus(manager *accelerator.Manager, cfg *config.Config, args []string) {
+	watching, interval := parseWatchFlags("status", args)
+	if !watching {
+		printStatus(manager, cfg, nil)
+		return
+	}
+
+	meter := &trafficMeter{}
+	watch(interval, func() {
+		cfg, manager = reloadManager(cfg, manager)
+		printStatus(manager, cfg, meter)
+	})
 }
 
-func handleStatus(manager *accelerator.Manager, cfg *config.Config) {
-	fmt.Println("Current Status")
+// printStatus prints the overview of "crosh status". With a meter, as in
+// watch mode, it also probes the proxy for live latency and traffic rates.
+func printStatus(manager *accelerator.Manager, cfg *config.Config, meter *trafficMeter) {
+	if jsonOutput {
+		printJSON(statusJSON(manager, cfg))
+		return
+	}
+
+	i18n.Println("Current Status")
 	fmt.Println("==============")
 	fmt.Println()
 
-	// Mirror status
-	if cfg.Mirror.Enabled {
-		fmt.Println("✓ Mirrors: enabled")
-		mirrorStatus := manager.GetMirrorStatus()
-		for name, status := range mirrorStatus {
-			if status != "disabled" {
-				fmt.Printf("  • %s: %s\n", name, status)
-			}
-		}
-	} else {
-		fmt.Println("✗ Mirrors: disabled")
+	i18n.Printf("Profile: %s\n", config.ActiveProfile())
+	if path, err := config.GetConfigPath(); err == nil {
+		i18n.Printf("Config:  %s\n", path)
+	}
+	if config.HasSystemConfig() {
+		i18n.Printf("System config: %s\n", config.SystemConfigPath())
 	}
-
 	fmt.Println()
 
+	red, green, yellow, reset := colorCodes()
+	enabled := cell{i18n.T("enabled"), green}
+	disabled := cell{text: i18n.T("disabled")}
+	drifted := cell{i18n.T("drifted"), yellow}
+
+	var rows [][]cell
+	inSync := true
+	mirrorStatus := manager.GetMirrorStatus()
+	for _, name := range config.MirrorToolNames {
+		state := cfg.Mirror.Tool(name)
+		status, known := mirrorStatus[mirrorStatusKeys[name]]
+		switch {
+		case !state.Enabled:
+			rows = append(rows, []cell{{text: name}, disabled})
+		case !known:
+			inSync = false
+			rows = append(rows, []cell{{text: name}, {i18n.T("error"), red}, {text: i18n.T("couldn't read its settings")}})
+		case !mirrorActive(status):
+			inSync = false
+			rows = append(rows, []cell{{text: name}, drifted, {text: i18n.T("not applied (run \"crosh on\")")}})
+		case state.Applied.IsZero():
+			rows = append(rows, []cell{{text: name}, enabled, {text: status}})
+		default:
+			rows = append(rows, []cell{{text: name}, enabled, {text: status}, {text: state.Applied.Format("2006-01-02 15:04")}})
+		}
+	}
+
 	// Proxy status
-	if cfg.Proxy.SubscriptionURL != "" {
-		if cfg.Proxy.Enabled {
-			fmt.Printf("✓ Proxy: enabled (%s)\n", manager.GetProxyStatus())
+	switch {
+	case !manager.HasProxySource():
+		rows = append(rows, []cell{{text: "proxy"}, {text: i18n.T("not configured")}})
+	case !cfg.Proxy.Enabled:
+		rows = append(rows, []cell{{text: "proxy"}, disabled})
+	case !manager.GetXrayManager().IsRunning():
+		inSync = false
+		rows = append(rows, []cell{{text: "proxy"}, drifted, {text: i18n.T("stopped (run \"crosh on\")")}})
+	default:
+		rows = append(rows, []cell{{text: "proxy"}, enabled, {text: manager.GetProxyStatus()}})
+	}
+
+	printTable([]string{i18n.T("NAME"), i18n.T("STATE"), i18n.T("DETAILS"), i18n.T("SINCE")}, rows)
+
+	if meter != nil && cfg.Proxy.Enabled && manager.GetXrayManager().IsRunning() {
+		fmt.Println()
+		if latency, err := manager.CheckProxyHealth(); err != nil {
+			fmt.Printf("%s%s%s\n", red, i18n.Sprintf("Latency: ✗ %v", err), reset)
 		} else {
-			fmt.Println("✗ Proxy: disabled")
+			i18n.Printf("Latency: %dms\n", latency.Milliseconds())
 		}
-		fmt.Printf("  Subscription: %s\n", cfg.Proxy.SubscriptionURL)
-	} else {
-		fmt.Println("○ Proxy: not configured")
-		fmt.Println("\n  To configure proxy, run:")
+		if traffic, err := manager.GetXrayManager().TrafficStats(); err == nil {
+			i18n.Printf("Traffic: %s\n", meter.describe(traffic))
+		}
+	}
+
+	if !manager.HasProxySource() {
+		i18n.Println("\n  To configure proxy, run:")
 		fmt.Println("    crosh https://your-subscription-url")
 	}
+
+	// Settings that drifted from the config and updates that are due
+	var notices []string
+	if url := cfg.Proxy.SubscriptionURL; url != "" {
+		updated, due := manager.SubscriptionUpdated()
+		if updated.IsZero() {
+			i18n.Printf("\nSubscription: %s (never fetched)\n", url)
+		} else {
+			i18n.Printf("\nSubscription: %s (fetched %s ago)\n", url, formatAge(time.Since(updated)))
+		}
+		if due && cfg.Proxy.Enabled {
+			notices = append(notices, i18n.T("the subscription is due for a refresh (run \"crosh on\")"))
+		}
+	}
+	for _, drift := range manager.ProxySettingsDrift() {
+		notices = append(notices, i18n.T(drift))
+	}
+	if warning := manager.GetXrayManager().GeoDataWarning(); warning != "" && manager.HasProxySource() {
+		notices = append(notices, warning)
+	}
+
+	fmt.Println()
+	if len(notices) == 0 && inSync {
+		fmt.Printf("%s%s%s\n", green, i18n.T("✓ Everything is applied and up to date"), reset)
+		return
+	}
+	for _, notice := range notices {
+		fmt.Printf("%s⚠ %s%s\n", yellow, notice, reset)
+	}
+}
+
+// mirrorActive checks if a status from Manager.GetMirrorStatus means the
+// tool's own config points at a mirror
+func mirrorActive(status string) bool {
+	switch status {
+	case "disabled", "default sources", "default registry":
+		return false
+	}
+	return true
+}
+
+// statusOutput is the JSON form of "crosh status"
+type statusOutput struct {
+	Profile      string             `json:"profile"`
+	SystemConfig string             `json:"system_config,omitempty"`
+	Mirrors      []mirrorToolOutput `json:"mirrors"`
+	Proxy        proxySummaryOutput `json:"proxy"`
+	Drift        []string           `json:"drift"` // settings outside crosh that don't match the config
+}
+
+// mirrorToolOutput is the state of one tool's mirror
+type mirrorToolOutput struct {
+	Tool    string     `json:"tool"`
+	Enabled bool       `json:"enabled"`
+	Active  bool       `json:"active"` // the tool's own config points at a mirror
+	Since   *time.Time `json:"since,omitempty"`
+	Status  string     `json:"status"`
+}
+
+// proxySummaryOutput is the proxy section of "crosh status"
+type proxySummaryOutput struct {
+	Configured          bool       `json:"configured"`
+	Enabled             bool       `json:"enabled"`
+	Status              string     `json:"status,omitempty"`
+	SubscriptionURL     string     `json:"subscription_url,omitempty"`
+	SubscriptionUpdated *time.Time `json:"subscription_updated,omitempty"`
+	SubscriptionDue     bool       `json:"subscription_due,omitempty"` // not fetched within 7 days
+	GeoDataWarning      string     `json:"geodata_warning,omitempty"`
+}
+
+// statusJSON collects what "crosh status" prints
+func statusJSON(manager *accelerator.Manager, cfg *config.Config) statusOutput {
+	out := statusOutput{Profile: config.ActiveProfile(), Mirrors: []mirrorToolOutput{}}
+	if config.HasSystemConfig() {
+		out.SystemConfig = config.SystemConfigPath()
+	}
+
+	mirrorStatus := manager.GetMirrorStatus()
+	for _, name := range config.MirrorToolNames {
+		state := cfg.Mirror.Tool(name)
+		status, known := mirrorStatus[mirrorStatusKeys[name]]
+		if !known {
+			status = "unknown"
+		}
+		tool := mirrorToolOutput{
+			Tool:    name,
+			Enabled: state.Enabled,
+			Active:  known && mirrorActive(status),
+			Status:  status,
+		}
+		if !state.Applied.IsZero() {
+			since := state.Applied
+			tool.Since = &since
+		}
+		out.Mirrors = append(out.Mirrors, tool)
+	}
+
+	out.Proxy.Configured = manager.HasProxySource()
+	if out.Proxy.Configured {
+		out.Proxy.Enabled = cfg.Proxy.Enabled
+		out.Proxy.Status = manager.GetProxyStatus()
+		out.Proxy.SubscriptionURL = cfg.Proxy.SubscriptionURL
+		out.Proxy.GeoDataWarning = manager.GetXrayManager().GeoDataWarning()
+		updated, due := manager.SubscriptionUpdated()
+		if !updated.IsZero() {
+			out.Proxy.SubscriptionUpdated = &updated
+		}
+		out.Proxy.SubscriptionDue = due
+	}
+	out.Drift = append([]string{}, manager.ProxySettingsDrift()...)
+	return out
+}
+
+// mirrorStatusKeys maps tool names to their keys in Manager.GetMirrorStatus
+var mirrorStatusKeys = map[string]string{
+	"npm":    "NPM",
+	"pip":    "Pip",
+	"apt":    "Apt",
+	"cargo":  "Cargo",
+	"go":     "Go",
+	"docker": "Docker",
 }
 
 func handleConfigureProxy(manager *accelerator.Manager, cfg *config.Config, url string) {
-	fmt.Printf("Configuring proxy subscription...\n\n")
+	i18n.Printf("Configuring proxy subscription...\n\n")
 
 	// Save subscription URL
 	cfg.Proxy.SubscriptionURL = url
 	if err := cfg.Save(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error saving config: %v\n", err)
-		os.Exit(1)
+		i18n.Fprintf(os.Stderr, "Error saving config: %v\n", err)
+		exit(exitCode(err))
 	}
-	fmt.Printf("✓ Subscription URL saved: %s\n", url)
+	i18n.Printf("✓ Subscription URL saved: %s\n", url)
 
 	// Check if xray-core is installed
 	if _, err := os.Stat(cfg.Proxy.XrayPath); os.IsNotExist(err) {
-		fmt.Println("\nXray-core not found. Downloading...")
+		i18n.Println("\nXray-core not found. Downloading...")
 		xray := manager.GetXrayManager()
 		if err := xray.Download(); err != nil {
-			fmt.Fprintf(os.Stderr, "✗ Failed to download Xray-core: %v\n", err)
-			fmt.Println("\nYou can try again later with: crosh on")
-			return
+			printErrorf("Failed to download Xray-core: %v", err)
+			i18n.Println("\nYou can try again later with: crosh on")
+			exit(exitCode(err))
 		}
-		fmt.Println("✓ Xray-core downloaded successfully")
+		i18n.Println("✓ Xray-core downloaded successfully")
 	}
 
-	fmt.Println("\n✓ Proxy configured successfully")
+	i18n.Println("\n✓ Proxy configured successfully")
 
 	// Automatically enable mirrors
-	fmt.Println("\nEnabling mirrors...")
-	cfg.Mirror.Enabled = true
-	if err := manager.EnableMirrors(); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: Failed to enable mirrors: %v\n", err)
+	i18n.Println("\nEnabling mirrors...")
+	mirrorErr := manager.EnableMirrors()
+	if mirrorErr != nil {
+		logging.Warn("failed to enable mirrors", "error", mirrorErr)
 	}
 
 	// Automatically enable proxy
-	fmt.Println("\nStarting proxy...")
+	i18n.Println("\nStarting proxy...")
 	cfg.Proxy.Enabled = true
 	if err := manager.EnableProxy(); err != nil {
-		fmt.Fprintf(os.Stderr, "✗ Failed to start proxy: %v\n", err)
-		fmt.Println("\nYou can try again with: crosh on")
-		return
+		printErrorf("Failed to start proxy: %v", err)
+		i18n.Println("\nYou can try again with: crosh on")
+		exit(exitCode(err))
 	}
 
 	cfg.Save()
 
-	fmt.Println("\n✓ Acceleration enabled")
-	fmt.Println("\nProxy is running in background.")
+	i18n.Println("\n✓ Acceleration enabled")
+	i18n.Println("\nProxy is running in background.")
+	if mirrorErr != nil {
+		exit(exitPartial)
+	}
 }
 
 func handleLocalYAMLFile(manager *accelerator.Manager, cfg *config.Config, filePath string) {
-	fmt.Printf("Loading proxy configuration from local YAML file...\n\n")
+	i18n.Printf("Loading proxy configuration from local YAML file...\n\n")
 
 	// Clear subscription URL (one-time use, don't save file path)
 	cfg.Proxy.SubscriptionURL = ""
 
 	// Check if xray-core is installed
 	if _, err := os.Stat(cfg.Proxy.XrayPath); os.IsNotExist(err) {
-		fmt.Println("Xray-core not found. Downloading...")
+		i18n.Println("Xray-core not found. Downloading...")
 		xray := manager.GetXrayManager()
 		if err := xray.Download(); err != nil {
-			fmt.Fprintf(os.Stderr, "✗ Failed to download Xray-core: %v\n", err)
-			fmt.Println("\nPlease try again later.")
-			return
+			printErrorf("Failed to download Xray-core: %v", err)
+			i18n.Println("\nPlease try again later.")
+			exit(exitCode(err))
 		}
-		fmt.Println("✓ Xray-core downloaded successfully")
+		i18n.Println("✓ Xray-core downloaded successfully")
 	}
 
 	// Load nodes from local YAML file
-	fmt.Println("\nParsing YAML file...")
+	i18n.Println("\nParsing YAML file...")
 	sub, err := manager.LoadProxyFromFile(filePath)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "✗ Failed to load YAML file: %v\n", err)
-		fmt.Println("\nPlease check your YAML file format and try again.")
-		return
+		printErrorf("Failed to load YAML file: %v", err)
+		i18n.Println("\nPlease check your YAML file format and try again.")
+		exit(exitCode(err))
 	}
 
-	fmt.Printf("✓ Found %d nodes in YAML file\n", len(sub.Nodes))
+	i18n.Printf("✓ Found %d nodes in YAML file\n", len(sub.Nodes))
+
+	xray := manager.GetXrayManager()
+	if err := xray.EnsureSingBox(sub.Nodes); err != nil {
+		i18n.Printf("⚠ %v, skipping hysteria2/TUIC nodes\n", err)
+	}
 
 	// Select fastest node
-	fmt.Println("\nTesting node latency...")
-	node, err := sub.SelectFastestNode()
+	i18n.Println("\nTesting node latency...")
+	node, err := sub.SelectFastestNodeWith(xray.TestLatency)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "✗ Failed to select node: %v\n", err)
-		return
+		printErrorf("Failed to select node: %v", err)
+		exit(exitCode(err))
 	}
 
-	fmt.Printf("✓ Selected node: %s (latency: %dms)\n", node.Name, node.Latency)
+	i18n.Printf("✓ Selected node: %s (latency: %dms)\n", node.Name, node.Latency)
 
 	// Generate Xray config
-	xray := manager.GetXrayManager()
 	if err := xray.GenerateConfig(node); err != nil {
-		fmt.Fprintf(os.Stderr, "✗ Failed to generate Xray config: %v\n", err)
-		return
+		printErrorf("Failed to generate Xray config: %v", err)
+		exit(exitCode(err))
 	}
 
-	fmt.Println("\n✓ Proxy configured successfully (one-time use)")
+	i18n.Println("\n✓ Proxy configured successfully (one-time use)")
 
 	// Automatically enable mirrors
-	fmt.Println("\nEnabling mirrors...")
-	cfg.Mirror.Enabled = true
-	if err := manager.EnableMirrors(); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: Failed to enable mirrors: %v\n", err)
+	i18n.Println("\nEnabling mirrors...")
+	mirrorErr := manager.EnableMirrors()
+	if mirrorErr != nil {
+		logging.Warn("failed to enable mirrors", "error", mirrorErr)
 	}
 
 	// Start Xray
-	fmt.Println("\nStarting proxy...")
+	i18n.Println("\nStarting proxy...")
 	if err := xray.Start(); err != nil {
-		fmt.Fprintf(os.Stderr, "✗ Failed to start proxy: %v\n", err)
-		return
+		printErrorf("Failed to start proxy: %v", err)
+		exit(exitCode(err))
 	}
 
 	cfg.Proxy.Enabled = true
@@ -334,13 +909,16 @@ func handleLocalYAMLFile(manager *accelerator.Manager, cfg *config.Config, fileP
 	cfg.Save()
 
 	// Print proxy environment variables
-	fmt.Println("\n✓ Acceleration enabled")
-	fmt.Println("\nProxy is running in background.")
-	fmt.Println("\nTo use the proxy, set these environment variables:")
+	i18n.Println("\n✓ Acceleration enabled")
+	i18n.Println("\nProxy is running in background.")
+	i18n.Println("\nTo use the proxy, set these environment variables:")
 	envVars := xray.GetProxyEnvVars()
 	for key, value := range envVars {
 		fmt.Printf("  export %s=%s\n", key, value)
 	}
 
-	fmt.Println("\nNote: This is a one-time configuration. To use this YAML file again, run: crosh " + filePath)
+	i18n.Printf("\nNote: This is a one-time configuration. To use this YAML file again, run: crosh %s\n", filePath)
+	if mirrorErr != nil {
+		exit(exitPartial)
+	}
 }
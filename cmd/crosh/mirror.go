@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/boomyao/crosh/internal/accelerator"
+	"github.com/boomyao/crosh/internal/config"
+	"github.com/boomyao/crosh/internal/i18n"
+	"github.com/boomyao/crosh/internal/logging"
+	"github.com/boomyao/crosh/internal/shell"
+)
+
+// handleMirror dispatches "crosh mirror" subcommands
+func handleMirror(manager *accelerator.Manager, cfg *config.Config, args []string) {
+	if len(args) == 0 {
+		printMirrorUsage()
+		exit(exitFailure)
+	}
+
+	switch args[0] {
+	case "enable":
+		handleMirrorEnable(manager, cfg, args[1:])
+	case "help", "-h", "--help":
+		printMirrorUsage()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown mirror command: %s\n\n", args[0])
+		printMirrorUsage()
+		exit(exitFailure)
+	}
+}
+
+func printMirrorUsage() {
+	fmt.Println(`USAGE:
+    crosh mirror <command>
+
+COMMANDS:
+    enable                    Point npm, pip, apt, cargo and go at the mirrors
+    enable --container <name> Do the same inside a running Docker container`)
+}
+
+// handleMirrorEnable enables the mirrors on this machine, or inside a running
+// container so a long-lived dev container picks them up without a rebuild
+func handleMirrorEnable(manager *accelerator.Manager, cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("mirror enable", flag.ContinueOnError)
+	container := fs.String("container", "", "Name or ID of a running Docker container to set the mirrors up in")
+	user := fs.String("user", "", "User to set the mirrors up for in the container (default: the container's user)")
+	fs.Usage = func() {
+		fmt.Println("USAGE:\n    crosh mirror enable [--container <name> [--user <user>]]")
+		fmt.Println("\nPoints npm, pip, apt, cargo and go at the mirrors; with --container, inside that container.")
+		fmt.Println("\nFLAGS:")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	if *container == "" {
+		if err := manager.EnableMirrors(); err != nil {
+			printErrorf("Failed to enable mirrors: %v", err)
+			exit(exitCode(err))
+		}
+		i18n.Println("✓ Mirrors enabled (npm, pip, apt, cargo, go)")
+		return
+	}
+
+	script := containerExecScript(cfg.Mirror)
+	if script == "" {
+		printErrorf("No mirrors configured to export (set them with: crosh config set mirror.npm <url>)")
+		exit(exitConfig)
+	}
+	if err := dockerExec(*container, *user, script); err != nil {
+		printError(err)
+		exit(exitFailure)
+	}
+	logging.Info("enabled mirrors in container", "container", *container)
+	i18n.Printf("✓ Mirrors enabled in container %s\n", *container)
+}
+
+// containerExecScript returns the shell commands that write the mirrors into
+// the config files of the user running them. Unlike an image build, a running
+// container's environment can't be changed, so npm, pip and go get their
+// config files instead of environment variables. apt needs root.
+func containerExecScript(m config.MirrorConfig) string {
+	var b strings.Builder
+	if m.NPM != "" {
+		fmt.Fprintf(&b, `touch "$HOME/.npmrc"
+sed -i '/^registry=/d' "$HOME/.npmrc"
+printf '%%s\n' %s >> "$HOME/.npmrc"
+`, shell.Quote("registry="+m.NPM))
+	}
+	if m.Pip != "" {
+		fmt.Fprintf(&b, `pipconf="${XDG_CONFIG_HOME:-$HOME/.config}/pip/pip.conf"
+mkdir -p "$(dirname "$pipconf")"
+if grep -qs '^index-url' "$pipconf"; then
+    sed -i %s "$pipconf"
+elif grep -qs '^\[global\]' "$pipconf"; then
+    sed -i %s "$pipconf"
+else
+    printf '%%s\n' '[global]' %s >> "$pipconf"
+fi
+`, shell.Quote("s#^index-url.*#index-url = "+sedEscape(m.Pip)+"#"),
+			shell.Quote(`/^\[global\]/a index-url = `+sedEscape(m.Pip)),
+			shell.Quote("index-url = "+m.Pip))
+	}
+	if m.Go != "" {
+		// The file "go env -w" writes, so this works before Go is installed
+		fmt.Fprintf(&b, `goenv="${XDG_CONFIG_HOME:-$HOME/.config}/go/env"
+mkdir -p "$(dirname "$goenv")"
+touch "$goenv"
+sed -i '/^GOPROXY=/d' "$goenv"
+printf '%%s\n' %s >> "$goenv"
+`, shell.Quote("GOPROXY="+m.Go))
+	}
+	if apt := aptScript(m); apt != "" {
+		b.WriteString("if [ \"$(id -u)\" = 0 ]; then\n" + indent(apt, "    ") + "else\n    echo 'crosh: apt needs root (--user root), skipped' >&2\nfi\n")
+	}
+	b.WriteString(cargoScript(m))
+	return b.String()
+}
+
+// dockerExec runs script with sh in a running container, as user if set
+func dockerExec(container, user, script string) error {
+	args := []string{"exec", "-i"}
+	if user != "" {
+		args = append(args, "--user", user)
+	}
+	args = append(args, container, "sh", "-s")
+
+	cmd := exec.Command("docker", args...)
+	cmd.Stdin = strings.NewReader("set -e\n" + script)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to set up the mirrors in container %s: %w", container, err)
+	}
+	return nil
+}
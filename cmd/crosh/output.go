@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/boomyao/crosh/internal/config"
+	"github.com/boomyao/crosh/internal/hint"
+	"github.com/boomyao/crosh/internal/i18n"
+	"github.com/boomyao/crosh/internal/logging"
+	"github.com/boomyao/crosh/internal/sysenv"
+)
+
+// jsonOutput is set by the global --json (or --output json) flag
+var jsonOutput bool
+
+// verbosity is set by the global --quiet, -v and -vv flags
+var verbosity = logging.Normal
+
+// jsonWriter receives JSON output. In JSON mode os.Stdout is pointed at
+// stderr, so progress messages printed along the way can't corrupt it.
+var jsonWriter = os.Stdout
+
+// parseGlobalFlags removes the global output, verbosity and --yes flags from args, wherever they
+// appear before a "--" separator, and returns the remaining arguments
+func parseGlobalFlags(args []string) []string {
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+
+		switch {
+		case arg == "--json" || arg == "-json" || arg == "--output=json" || arg == "-o=json":
+			jsonOutput = true
+		case arg == "-q" || arg == "--quiet":
+			verbosity = logging.Quiet
+		case arg == "--verbose" || (arg == "-v" && len(args) > 1):
+			// "crosh -v" on its own still prints the version
+			verbosity = max(verbosity, logging.Verbose)
+		case arg == "-vv":
+			verbosity = logging.VeryVerbose
+		case arg == "--plain":
+			plainOutput = true
+		case arg == "-y" || arg == "--yes":
+			assumeYes = true
+		case arg == "--output=text" || arg == "-o=text":
+			jsonOutput = false
+		case (arg == "--output" || arg == "-o") && i+1 < len(args):
+			i++
+			switch args[i] {
+			case "json":
+				jsonOutput = true
+			case "text":
+				jsonOutput = false
+			default:
+				i18n.Fprintf(os.Stderr, "✗ Unknown output format %q (expected text or json)\n", args[i])
+				exit(exitFailure)
+			}
+		default:
+			rest = append(rest, arg)
+		}
+	}
+
+	// "crosh bootstrap" is made for scripts and always keeps stdout machine-readable
+	if len(rest) > 0 && rest[0] == "bootstrap" {
+		jsonOutput = true
+	}
+	if jsonOutput {
+		jsonWriter = os.Stdout
+		os.Stdout = os.Stderr
+	}
+	if verbosity == logging.Quiet {
+		// Errors are printed to stderr, so only regular output is dropped
+		if devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0); err == nil {
+			os.Stdout = devNull
+		}
+	}
+	if plainOutput || sysenv.InCI() {
+		plainOutput = true
+		startPlainOutput()
+	}
+	confirmChanges()
+	confirmHooks()
+	return rest
+}
+
+// startLogging opens the log file so failures can be diagnosed later
+func startLogging() {
+	if err := logging.Init(config.LogPath(), verbosity); err != nil {
+		i18n.Fprintf(os.Stderr, "⚠ %v, not logging to %s\n", err, config.LogPath())
+	}
+	logging.Debug("command started", "args", redactArgs(os.Args[1:]), "version", strings.TrimSpace(version))
+}
+
+// redactArgs hides subscription URLs and share links, which carry credentials
+func redactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		if scheme, _, found := strings.Cut(arg, "://"); found {
+			arg = scheme + "://…"
+		}
+		redacted[i] = arg
+	}
+	return redacted
+}
+
+// isTerminal checks if f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// printError prints err to stderr as "✗ <err>", followed by the hints it
+// carries on what to do next
+func printError(err error) {
+	printErrorf("%v", err)
+}
+
+// printErrorf prints a translated failure message to stderr, followed by the
+// hints of any error among args
+func printErrorf(format string, args ...interface{}) {
+	fmt.Fprintln(os.Stderr, "✗ "+i18n.Sprintf(format, args...))
+	for _, arg := range args {
+		if err, ok := arg.(error); ok {
+			hint.Fprint(os.Stderr, "  ", err)
+		}
+	}
+}
+
+// printJSON writes v as indented JSON to the real stdout
+func printJSON(v interface{}) {
+	encoder := json.NewEncoder(jsonWriter)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		printErrorf("Failed to encode JSON: %v", err)
+		exit(exitCode(err))
+	}
+}
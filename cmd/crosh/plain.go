@@ -0,0 +1,166 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// plainOutput is set by the global --plain flag, or when running in CI
+var plainOutput bool
+
+// rawStdout is the real stdout, for editors and binary output that must not
+// go through the plain output filter
+var rawStdout = os.Stdout
+
+// rawStderr is the real stderr
+var rawStderr = os.Stderr
+
+// plainSymbols are the ASCII replacements of the symbols crosh prints. The
+// status marks become tags that stay the same across versions, so CI logs
+// can be grepped for them.
+var plainSymbols = map[rune]string{
+	'✓': "[OK]",
+	'✗': "[ERROR]",
+	'⚠': "[WARN]",
+	'•': "-",
+	'→': "->",
+	'↑': "up",
+	'↓': "down",
+	'…': "...",
+}
+
+// plainDone holds a channel per filter, closed once it has written everything out
+var plainDone []chan struct{}
+
+// startPlainOutput points os.Stdout and os.Stderr at filters that strip
+// colors, emoji and box drawing before passing the output on. Call
+// flushOutput (or exit) before the process ends so nothing is lost.
+func startPlainOutput() {
+	stdout, errOut := os.Stdout.Stat()
+	stderr, errErr := os.Stderr.Stat()
+	if errOut == nil && errErr == nil && os.SameFile(stdout, stderr) {
+		// One filter for "2>&1" keeps the lines in order
+		os.Stdout = plainPipe(os.Stdout)
+		os.Stderr = os.Stdout
+		return
+	}
+	os.Stdout = plainPipe(os.Stdout)
+	os.Stderr = plainPipe(os.Stderr)
+}
+
+// plainPipe returns a pipe whose output is filtered into out
+func plainPipe(out *os.File) *os.File {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return out
+	}
+
+	done := make(chan struct{})
+	plainDone = append(plainDone, done)
+	go func() {
+		defer close(done)
+		filter := &plainFilter{}
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				out.WriteString(filter.convert(buf[:n]))
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return w
+}
+
+// flushOutput waits until the plain output filters have written everything
+func flushOutput() {
+	if len(plainDone) == 0 {
+		return
+	}
+	os.Stdout.Close()
+	os.Stderr.Close()
+	os.Stdout, os.Stderr = rawStdout, rawStderr
+	for _, done := range plainDone {
+		<-done
+	}
+	plainDone = nil
+}
+
+// exit reports the command's outcome, flushes the output and exits with
+// code. Use it instead of os.Exit, which would drop output still in the
+// plain output filters.
+func exit(code int) {
+	reportUsage(code)
+	flushOutput()
+	os.Exit(code)
+}
+
+// plainFilter rewrites a stream of terminal output as plain ASCII symbols,
+// keeping state between chunks so escape codes and runes may be split
+type plainFilter struct {
+	pending []byte // start of a rune cut off at the end of the last chunk
+	escape  bool   // inside an ANSI escape sequence
+	csi     bool   // the escape sequence is a CSI ("\033[...")
+}
+
+// convert filters the next chunk of output
+func (f *plainFilter) convert(chunk []byte) string {
+	data := append(f.pending, chunk...)
+	f.pending = nil
+
+	var b strings.Builder
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError && size <= 1 && !utf8.FullRune(data) {
+			f.pending = append([]byte(nil), data...)
+			break
+		}
+		data = data[size:]
+
+		switch {
+		case f.escape:
+			// CSI sequences end with a letter; other escapes are one character
+			if !f.csi && r == '[' {
+				f.csi = true
+				continue
+			}
+			if !f.csi || (r >= 0x40 && r <= 0x7e) {
+				f.escape, f.csi = false, false
+			}
+		case r == 0x1b:
+			f.escape = true
+		case r < utf8.RuneSelf:
+			b.WriteRune(r)
+		default:
+			b.WriteString(plainRune(r))
+		}
+	}
+	return b.String()
+}
+
+// plainRune returns the replacement of a non-ASCII rune. Text in other
+// languages is kept; symbols without an ASCII form are dropped.
+func plainRune(r rune) string {
+	if s, ok := plainSymbols[r]; ok {
+		return s
+	}
+	switch {
+	case r >= 0x2500 && r <= 0x257f: // box drawing
+		switch r {
+		case '─', '━', '═':
+			return "-"
+		case '│', '┃', '║':
+			return "|"
+		}
+		return "+"
+	case r >= 0x2190 && r <= 0x21ff, // arrows
+		r >= 0x2600 && r <= 0x27bf,   // symbols and dingbats
+		r >= 0x1f000 && r <= 0x1faff, // emoji
+		r == 0xfe0f:                  // emoji presentation selector
+		return ""
+	}
+	return string(r)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/boomyao/crosh/internal/cache"
+	"github.com/boomyao/crosh/internal/config"
+	"github.com/boomyao/crosh/internal/i18n"
+	"github.com/boomyao/crosh/internal/prefetch"
+)
+
+// handlePrefetch downloads the packages and images listed in a file through
+// the mirrors into a bundle directory for an air-gapped machine
+func handlePrefetch(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("prefetch", flag.ContinueOnError)
+	file := fs.String("f", "packages.yaml", "List of the npm, pip, go and docker packages to download")
+	dir := fs.String("dir", "crosh-bundle", "Bundle directory to download into")
+	platform := fs.String("platform", "linux/amd64", "Platform of the Docker images, e.g. linux/arm64")
+	fs.Usage = func() {
+		fmt.Println("USAGE:\n    crosh prefetch [-f packages.yaml] [--dir crosh-bundle] [--platform linux/amd64]")
+		fmt.Println("\nDownloads the listed packages and images through the mirrors for use without network:")
+		fmt.Println("    npm:    [lodash@4.17.21, \"@types/node\"]")
+		fmt.Println("    pip:    [requests==2.31.0, numpy]")
+		fmt.Println("    go:     [golang.org/x/text@v0.14.0]")
+		fmt.Println("    docker: [nginx:1.25]")
+		fmt.Println("    pip_wheels: [cp311, manylinux, none-any]   # optional wheel filter")
+		fmt.Println("\nFLAGS:")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	list, err := prefetch.Load(*file)
+	if err != nil {
+		printError(err)
+		exit(exitConfig)
+	}
+
+	cacheDir := filepath.Join(*dir, "cache")
+	imageDir := filepath.Join(*dir, "images")
+	if err := os.MkdirAll(imageDir, 0755); err != nil {
+		printErrorf("Failed to create %s: %v", imageDir, err)
+		exit(exitFailure)
+	}
+	store, err := cache.OpenStore(cacheDir, 0)
+	if err != nil {
+		printError(err)
+		exit(exitFailure)
+	}
+	fetcher := prefetch.NewFetcher(cache.NewServer(store, cfg.Mirror.NPM, cfg.Mirror.Pip, cfg.Mirror.Go), cfg.Mirror.Docker, imageDir, *platform, list.PipWheels)
+
+	var failed, done int
+	fetch := func(kind, spec string, fn func(string) (string, error)) {
+		got, err := fn(spec)
+		if err != nil {
+			failed++
+			printErrorf("%s %s: %v", kind, spec, err)
+			return
+		}
+		done++
+		fmt.Printf("✓ %s %s (%s)\n", kind, spec, got)
+	}
+	for _, spec := range list.NPM {
+		fetch("npm", spec, fetcher.NPM)
+	}
+	for _, spec := range list.Pip {
+		fetch("pip", spec, fetcher.Pip)
+	}
+	for _, spec := range list.Go {
+		fetch("go", spec, fetcher.Go)
+	}
+	for _, spec := range list.Docker {
+		fetch("docker", spec, func(ref string) (string, error) {
+			archive, err := fetcher.Docker(ref)
+			return filepath.Base(archive), err
+		})
+	}
+
+	size, _ := store.Size()
+	i18n.Printf("\n✓ Downloaded %d of %d into %s (%d MB of packages)\n", done, done+failed, *dir, size>>20)
+	i18n.Println("  On the offline machine, serve the packages and load the images with:")
+	fmt.Printf("    crosh cache serve --offline --dir %s\n", cacheDir)
+	fmt.Printf("    for image in %s/*.tar; do docker load -i \"$image\"; done\n", imageDir)
+	if failed > 0 {
+		exit(exitPartial)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/boomyao/crosh/internal/accelerator"
+	"github.com/boomyao/crosh/internal/config"
+)
+
+// handleProfile dispatches "crosh profile" subcommands
+func handleProfile(manager *accelerator.Manager, cfg *config.Config, args []string) {
+	if len(args) == 0 {
+		handleProfileList()
+		return
+	}
+
+	switch args[0] {
+	case "list":
+		handleProfileList()
+	case "create":
+		handleProfileCreate(cfg, args[1:])
+	case "switch":
+		handleProfileSwitch(manager, cfg, args[1:])
+	case "help", "-h", "--help":
+		printProfileUsage()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown profile command: %s\n\n", args[0])
+		printProfileUsage()
+		exit(exitFailure)
+	}
+}
+
+func printProfileUsage() {
+	fmt.Println(`USAGE:
+    crosh profile <command>
+
+COMMANDS:
+    list                List profiles, marking the active one
+    create <name> [--empty]
+                        Create a profile from the active one (or from defaults)
+    switch <name>       Switch mirrors and proxy to another profile
+
+EXAMPLES:
+    # Keep a separate setup for the office network
+    crosh profile create office
+    crosh profile switch office
+    crosh https://office-subscription-url
+
+    # Back to the original configuration
+    crosh profile switch default`)
+}
+
+// handleProfileList prints all profiles
+func handleProfileList() {
+	profiles, err := config.ListProfiles()
+	if err != nil {
+		printError(err)
+		exit(exitCode(err))
+	}
+
+	active := config.ActiveProfile()
+	for _, name := range profiles {
+		marker := " "
+		if name == active {
+			marker = "*"
+		}
+		fmt.Printf("%s %-20s %s\n", marker, name, config.ProfilePath(name))
+	}
+}
+
+// handleProfileCreate saves a copy of the active configuration, or the
+// defaults, under a new name
+func handleProfileCreate(cfg *config.Config, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: crosh profile create <name> [--empty]")
+		exit(exitFailure)
+	}
+	name := args[0]
+
+	fs := flag.NewFlagSet("profile create", flag.ContinueOnError)
+	empty := fs.Bool("empty", false, "Start from the default configuration")
+	parseFlags(fs, args[1:])
+
+	source := *cfg
+	if *empty {
+		source = *config.NewConfig()
+	}
+	// A new profile starts switched off until it is switched to
+	source.Mirror.Tools = config.MirrorTools{}
+	source.Proxy.Enabled = false
+	source.Proxy.CurrentNode = ""
+
+	if err := config.CreateProfile(name, &source); err != nil {
+		printError(err)
+		exit(exitCode(err))
+	}
+
+	fmt.Printf("✓ Created profile %s (%s)\n", name, config.ProfilePath(name))
+	fmt.Printf("  Switch to it with: crosh profile switch %s\n", name)
+}
+
+// handleProfileSwitch turns acceleration off under the current profile and,
+// if it was on, back on under the new one
+func handleProfileSwitch(manager *accelerator.Manager, cfg *config.Config, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: crosh profile switch <name>")
+		exit(exitFailure)
+	}
+	name := args[0]
+
+	if name == config.ActiveProfile() {
+		fmt.Printf("Already using profile %s\n", name)
+		return
+	}
+	if !config.ProfileExists(name) {
+		fmt.Fprintf(os.Stderr, "✗ Profile %q doesn't exist (create it with: crosh profile create %s)\n", name, name)
+		exit(exitFailure)
+	}
+
+	wasOn := cfg.Mirror.AnyEnabled() || cfg.Proxy.Enabled
+	if wasOn {
+		handleOff(manager, cfg)
+		fmt.Println()
+	}
+
+	if err := config.SetActiveProfile(name); err != nil {
+		printError(err)
+		exit(exitCode(err))
+	}
+	fmt.Printf("✓ Switched to profile %s\n", name)
+
+	if !wasOn {
+		return
+	}
+
+	newCfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading profile %s: %v\n", name, err)
+		exit(exitCode(err))
+	}
+	fmt.Println()
+	handleOn(accelerator.NewManager(newCfg), newCfg)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/boomyao/crosh/internal/accelerator"
+	"github.com/boomyao/crosh/internal/config"
+	"github.com/boomyao/crosh/internal/proxy"
+)
+
+// promptTTL is how long "crosh prompt" prints the cached status before it is
+// refreshed in the background
+const promptTTL = 30 * time.Second
+
+// promptStatus is the status "crosh prompt" caches between shell prompts
+type promptStatus struct {
+	Mirrors   string    `json:"mirrors"`              // on, drifted or off
+	Proxy     string    `json:"proxy"`                // running, stopped or off
+	Node      string    `json:"node,omitempty"`       // current proxy node
+	LatencyMS int64     `json:"latency_ms,omitempty"` // through the running proxy
+	Error     string    `json:"error,omitempty"`      // failed health check
+	Config    string    `json:"config"`               // config file the status was read from
+	Updated   time.Time `json:"updated"`
+}
+
+// promptCachePath returns the file holding the cached prompt status
+func promptCachePath() string {
+	return filepath.Join(config.StateDir(), "prompt.json")
+}
+
+// handlePrompt prints a one-line status for shell prompts. It only reads the
+// cached status so it returns within milliseconds, and refreshes a stale
+// cache in the background for the next prompt.
+func handlePrompt(args []string) {
+	fs := flag.NewFlagSet("prompt", flag.ContinueOnError)
+	refresh := fs.Bool("refresh", false, "Check the mirrors and proxy latency now and update the cache")
+	fs.Usage = func() {
+		fmt.Println("USAGE:\n    crosh prompt [--refresh]")
+		fmt.Println("\nPrints e.g. \"mirrors on · HK-01 128ms\" for starship or powerlevel10k custom segments.")
+		fmt.Println("\nFLAGS:")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	if *refresh {
+		status, err := refreshPromptStatus()
+		if err != nil {
+			printError(err)
+			exit(exitCode(err))
+		}
+		printPromptStatus(status)
+		return
+	}
+
+	status := readPromptStatus()
+	if status == nil || promptStale(status) {
+		startPromptRefresh()
+	}
+	if status != nil {
+		printPromptStatus(status)
+	}
+}
+
+// printPromptStatus prints the prompt segment, or the status as JSON
+func printPromptStatus(status *promptStatus) {
+	if jsonOutput {
+		printJSON(status)
+		return
+	}
+	fmt.Println(status.String())
+}
+
+// String formats the status as a compact prompt segment
+func (s *promptStatus) String() string {
+	segment := "mirrors " + s.Mirrors
+	switch {
+	case s.Proxy != "running":
+		if s.Proxy == "stopped" {
+			segment += " · proxy stopped"
+		}
+	case s.Error != "":
+		segment += fmt.Sprintf(" · %s ✗", s.Node)
+	default:
+		segment += fmt.Sprintf(" · %s %dms", s.Node, s.LatencyMS)
+	}
+	return segment
+}
+
+// readPromptStatus returns the cached status, or nil if there is none
+func readPromptStatus() *promptStatus {
+	data, err := os.ReadFile(promptCachePath())
+	if err != nil {
+		return nil
+	}
+	var status promptStatus
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil
+	}
+	return &status
+}
+
+// promptStale checks if the cached status is past promptTTL, or older than
+// a change to the config or a switch to another profile
+func promptStale(status *promptStatus) bool {
+	if time.Since(status.Updated) > promptTTL {
+		return true
+	}
+	path, err := config.GetConfigPath()
+	if err != nil || path != status.Config {
+		return true
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.ModTime().After(status.Updated)
+}
+
+// startPromptRefresh runs "crosh prompt --refresh" in the background unless
+// one is already running
+func startPromptRefresh() {
+	pidFile := filepath.Join(config.StateDir(), "prompt.pid")
+	if _, alive := proxy.BackgroundRunning(pidFile); alive {
+		return
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(config.StateDir(), 0755); err != nil {
+		return
+	}
+	proxy.StartBackground(executable, []string{"prompt", "--refresh"}, os.DevNull, pidFile)
+}
+
+// refreshPromptStatus checks the mirrors and the proxy and caches the result
+func refreshPromptStatus() (*promptStatus, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+	path, err := config.GetConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	manager := accelerator.NewManager(cfg)
+	status := &promptStatus{Mirrors: "off", Proxy: "off", Config: path, Updated: time.Now()}
+
+	mirrorStatus := manager.GetMirrorStatus()
+	for _, name := range config.MirrorToolNames {
+		if !cfg.Mirror.Tool(name).Enabled {
+			continue
+		}
+		if !mirrorActive(mirrorStatus[mirrorStatusKeys[name]]) {
+			status.Mirrors = "drifted"
+			break
+		}
+		status.Mirrors = "on"
+	}
+
+	if manager.HasProxySource() && cfg.Proxy.Enabled {
+		status.Proxy = "stopped"
+		if manager.GetXrayManager().IsRunning() {
+			status.Proxy = "running"
+			status.Node = cfg.Proxy.CurrentNode
+			if latency, err := manager.CheckProxyHealth(); err != nil {
+				status.Error = err.Error()
+			} else {
+				status.LatencyMS = latency.Milliseconds()
+			}
+		}
+	}
+
+	data, err := json.Marshal(status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode the prompt status: %w", err)
+	}
+	if err := os.MkdirAll(config.StateDir(), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", config.StateDir(), err)
+	}
+	// Write and rename so a prompt never reads half a file
+	tmp := promptCachePath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", promptCachePath(), err)
+	}
+	if err := os.Rename(tmp, promptCachePath()); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", promptCachePath(), err)
+	}
+	return status, nil
+}
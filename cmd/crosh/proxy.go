@@ -0,0 +1,1040 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/boomyao/crosh/internal/accelerator"
+	"github.com/boomyao/crosh/internal/config"
+	"github.com/boomyao/crosh/internal/dashboard"
+	"github.com/boomyao/crosh/internal/logging"
+	"github.com/boomyao/crosh/internal/proxy"
+	"github.com/boomyao/crosh/internal/shell"
+)
+
+// handleProxy dispatches "crosh proxy <subcommand>"
+func handleProxy(manager *accelerator.Manager, cfg *config.Config, args []string) {
+	if len(args) == 0 {
+		printProxyUsage()
+		exit(exitFailure)
+	}
+
+	switch args[0] {
+	case "status":
+		handleProxyStatus(manager, cfg, args[1:])
+	case "exec":
+		handleProxyExec(manager, cfg, args[1:])
+	case "env":
+		handleProxyEnv(manager, args[1:])
+	case "git":
+		handleProxyGit(manager, args[1:])
+	case "pkg":
+		handleProxyPackages(manager, args[1:])
+	case "docker":
+		handleProxyDocker(manager, args[1:])
+	case "system":
+		handleProxySystem(manager, args[1:])
+	case "logs":
+		handleProxyLogs(manager, args[1:])
+	case "add":
+		handleProxyAdd(manager, args[1:])
+	case "import":
+		handleProxyImport(manager, args[1:])
+	case "remove":
+		handleProxyRemove(manager, args[1:])
+	case "nodes":
+		handleProxyNodes(manager)
+	case "qr":
+		handleProxyQR(manager, args[1:])
+	case "lan":
+		handleProxyLAN(manager, args[1:])
+	case "dns":
+		handleProxyDNS(manager, cfg, args[1:])
+	case "udp":
+		handleProxyUDP(manager, cfg, args[1:])
+	case "bypass":
+		handleProxyBypass(manager, cfg, args[1:])
+	case "geodata":
+		handleProxyGeoData(manager, args[1:])
+	case "bench":
+		handleProxyBench(manager, args[1:])
+	case "dashboard":
+		handleProxyDashboard(manager, args[1:])
+	case "health":
+		handleProxyHealth(manager, cfg)
+	case "monitor":
+		config.SetSaveBackups(false)
+		handleProxyMonitor(manager)
+	case "help", "-h", "--help":
+		printProxyUsage()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown proxy command: %s\n\n", args[0])
+		printProxyUsage()
+		exit(exitFailure)
+	}
+}
+
+func printProxyUsage() {
+	fmt.Println(`USAGE:
+    crosh proxy <command>
+
+COMMANDS:
+    status [--watch] [--interval 2s]
+                        Show PID, uptime, ports, current node latency, traffic
+                        and versions; --watch keeps refreshing until Ctrl+C
+    exec -- <command>   Run a single command through the proxy
+    env [--shell <name>] [--unset]
+                        Print proxy environment exports for eval
+    git on|off|status [--hosts <list>] [--all] [--ssh]
+                        Route git remotes through the proxy (github.com by default)
+    pkg on|off|status   Proxy npm, pip, cargo and gradle instead of mirroring them
+    docker on|off|status
+                        Point the Docker daemon at the proxy (Linux: requires sudo)
+    system on|off|status [--winhttp]
+                        Set the Windows system proxy while the proxy runs; --winhttp
+                        also sets WinHTTP (requires an administrator prompt)
+    logs [-f] [-n <lines>] [--level <level>]
+                        Show proxy logs (levels: debug, info, warning, error)
+    add <share-link>... Add standalone nodes (vmess://, vless://, trojan://, ss://,
+                        hysteria2://, tuic://)
+    import <file>       Import nodes from a Clash config.yaml or v2rayN export
+    remove <name>       Remove a manually added node
+    nodes               List manual and subscription nodes
+    qr <name>           Print a QR code to import a node on a phone
+    lan on|off          Allow other devices on the LAN to use the proxy
+    udp on|off|status [--node <name>]
+                        Relay UDP (QUIC, games, voice chat) through the proxy
+    bypass add|remove|list <domain|ip>
+                        Always connect directly to these domains (and subdomains) or IPs
+    geodata update|status
+                        Refresh the geoip/geosite data used for China-direct routing
+    dns on|off|status [--fake-ip]
+                        Resolve domains over DoH so DNS poisoning can't skew routing
+    bench [--url <url>] [--timeout 15s] [-n 10]
+                        Measure download speed through the lowest-latency nodes
+    dashboard [--port 7680]
+                        Serve a web UI on localhost to watch traffic and switch nodes
+    health              Check connectivity through the current node
+    monitor             Run health checks with automatic node failover
+                        (started in the background by "crosh on")
+
+EXAMPLES:
+    # Clone a repository through the proxy without changing global settings
+    crosh proxy exec -- git clone https://github.com/boomyao/crosh
+
+    # Proxy just the current shell
+    eval "$(crosh proxy env)"
+    crosh proxy env --shell fish | source
+    crosh proxy env --shell nu | from nuon | load-env
+    crosh proxy env --shell powershell | Invoke-Expression
+
+    # Proxy git for GitHub and GitLab, including ssh remotes
+    crosh proxy git on --hosts github.com,gitlab.com --ssh`)
+}
+
+// handleProxyExec runs a command with proxy environment variables set.
+// If the proxy isn't running it is started for the duration of the command
+// and stopped again afterwards. What crosh prints meanwhile goes to stderr,
+// so the command's stdout stays its own, e.g. in a pipe.
+func handleProxyExec(manager *accelerator.Manager, cfg *config.Config, args []string) {
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: crosh proxy exec -- <command> [args...]")
+		exit(exitFailure)
+	}
+
+	progress := io.Writer(os.Stderr)
+	if verbosity == logging.Quiet {
+		progress = io.Discard
+	}
+	started, err := manager.StartTemporaryProxy(progress)
+	if err != nil {
+		printErrorf("Failed to start proxy: %v", err)
+		exit(exitCode(err))
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = rawStdout
+	cmd.Stderr = rawStderr
+	cmd.Env = os.Environ()
+	for key, value := range manager.GetXrayManager().GetProxyEnvVars() {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, value))
+	}
+
+	// The terminal delivers Ctrl-C to the child as well; keep running so the
+	// temporary proxy is cleaned up once the child exits
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	defer signal.Stop(signals)
+
+	exitCode := 0
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			exitCode = exitErr.ExitCode()
+		} else {
+			printErrorf("Failed to run %s: %v", args[0], err)
+			exitCode = 1
+		}
+	}
+
+	if started {
+		if err := manager.StopTemporaryProxy(); err != nil {
+			logging.Warn("failed to stop proxy", "error", err)
+		}
+	}
+
+	exit(exitCode)
+}
+
+// handleProxyEnv prints shell commands exporting the proxy environment.
+// Only the commands go to stdout so the output can be passed to eval.
+func handleProxyEnv(manager *accelerator.Manager, args []string) {
+	fs := flag.NewFlagSet("proxy env", flag.ContinueOnError)
+	shellName := fs.String("shell", "", "shell syntax: bash, zsh, fish, nu, csh or powershell (default: detected)")
+	unset := fs.Bool("unset", false, "print commands that remove the proxy variables")
+	parseFlags(fs, args)
+
+	sh := shell.Detect()
+	if *shellName != "" {
+		parsed, err := shell.Parse(*shellName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(exitCode(err))
+		}
+		sh = parsed
+	}
+
+	xray := manager.GetXrayManager()
+	envVars := xray.GetProxyEnvVars()
+
+	var lines []string
+	if *unset {
+		names := make([]string, 0, len(envVars))
+		for key := range envVars {
+			names = append(names, key)
+		}
+		lines = shell.UnsetLines(sh, names)
+	} else {
+		if !xray.IsRunning() {
+			fmt.Fprintln(os.Stderr, "Warning: proxy is not running, start it with: crosh on")
+		}
+		manager.WarnExistingProxies(os.Stderr)
+		lines = shell.ExportLines(sh, envVars)
+	}
+
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+}
+
+// handleProxyGit manages git proxy settings in ~/.gitconfig
+func handleProxyGit(manager *accelerator.Manager, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: crosh proxy git on|off|status [--hosts <list>] [--all] [--ssh]")
+		exit(exitFailure)
+	}
+
+	switch args[0] {
+	case "on":
+		fs := flag.NewFlagSet("proxy git on", flag.ContinueOnError)
+		hostList := fs.String("hosts", strings.Join(proxy.DefaultGitProxyHosts, ","), "comma-separated hosts to proxy")
+		all := fs.Bool("all", false, "proxy every remote instead of specific hosts")
+		ssh := fs.Bool("ssh", false, "also route ssh remotes via core.sshCommand")
+		parseFlags(fs, args[1:])
+
+		var hosts []string
+		if !*all {
+			for _, host := range strings.Split(*hostList, ",") {
+				if host = strings.TrimSpace(host); host != "" {
+					hosts = append(hosts, host)
+				}
+			}
+		}
+
+		if err := manager.EnableGitProxy(hosts, *ssh); err != nil {
+			printErrorf("Failed to enable git proxy: %v", err)
+			exit(exitCode(err))
+		}
+
+		if len(hosts) == 0 {
+			fmt.Println("✓ Git proxy enabled for all remotes")
+		} else {
+			fmt.Printf("✓ Git proxy enabled for %s\n", strings.Join(hosts, ", "))
+		}
+		if *ssh {
+			fmt.Println("✓ SSH remotes routed via core.sshCommand (requires nc)")
+		}
+		if !manager.GetXrayManager().IsRunning() {
+			fmt.Println("\n⚠ Proxy is not running, the settings will be applied with: crosh on")
+		}
+	case "off":
+		if err := manager.DisableGitProxy(); err != nil {
+			printErrorf("Failed to disable git proxy: %v", err)
+			exit(exitCode(err))
+		}
+		fmt.Println("✓ Git proxy disabled")
+	case "status":
+		enabled, detail, err := manager.GetGitProxyStatus()
+		if err != nil {
+			printErrorf("Failed to read git config: %v", err)
+			exit(exitCode(err))
+		}
+		if enabled {
+			fmt.Printf("✓ Git proxy: enabled (%s)\n", detail)
+		} else {
+			fmt.Printf("✗ Git proxy: disabled (%s)\n", detail)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown git proxy command: %s\n", args[0])
+		exit(exitFailure)
+	}
+}
+
+// handleProxyPackages manages proxy settings in package manager configs
+func handleProxyPackages(manager *accelerator.Manager, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: crosh proxy pkg on|off|status")
+		exit(exitFailure)
+	}
+
+	switch args[0] {
+	case "on":
+		if err := manager.EnablePackageProxy(); err != nil {
+			printErrorf("Failed to enable package manager proxy: %v", err)
+			exit(exitCode(err))
+		}
+		fmt.Printf("✓ npm, pip, cargo and gradle now use %s while the proxy runs\n", manager.GetXrayManager().HTTPProxyURL())
+		fmt.Println("  Settings are removed when the proxy stops and restored when it starts")
+		if !manager.GetXrayManager().IsRunning() {
+			fmt.Println("\n⚠ Proxy is not running, the settings will be applied with: crosh on")
+		}
+	case "off":
+		if err := manager.DisablePackageProxy(); err != nil {
+			printErrorf("Failed to disable package manager proxy: %v", err)
+			exit(exitCode(err))
+		}
+		fmt.Println("✓ Package manager proxy disabled")
+	case "status":
+		enabled, detail, err := manager.GetPackageProxyStatus()
+		if err != nil {
+			printErrorf("Failed to read package manager configs: %v", err)
+			exit(exitCode(err))
+		}
+		if enabled {
+			fmt.Printf("✓ Package manager proxy: enabled (%s)\n", detail)
+		} else {
+			fmt.Printf("✗ Package manager proxy: disabled (%s)\n", detail)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown pkg proxy command: %s\n", args[0])
+		exit(exitFailure)
+	}
+}
+
+// handleProxyDocker manages the Docker daemon proxy configuration
+func handleProxyDocker(manager *accelerator.Manager, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: crosh proxy docker on|off|status")
+		exit(exitFailure)
+	}
+
+	switch args[0] {
+	case "on":
+		if err := manager.EnableDockerProxy(); err != nil {
+			printErrorf("Failed to enable Docker proxy: %v", err)
+			exit(exitCode(err))
+		}
+	case "off":
+		if err := manager.DisableDockerProxy(); err != nil {
+			printErrorf("Failed to disable Docker proxy: %v", err)
+			exit(exitCode(err))
+		}
+	case "status":
+		enabled, detail, err := manager.GetDockerProxyStatus()
+		if err != nil {
+			printErrorf("Failed to read Docker proxy config: %v", err)
+			exit(exitCode(err))
+		}
+		if enabled {
+			fmt.Printf("✓ Docker proxy: enabled (%s)\n", detail)
+		} else {
+			fmt.Printf("✗ Docker proxy: disabled (%s)\n", detail)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown docker proxy command: %s\n", args[0])
+		exit(exitFailure)
+	}
+}
+
+// handleProxySystem manages the Windows system proxy
+func handleProxySystem(manager *accelerator.Manager, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: crosh proxy system on|off|status [--winhttp]")
+		exit(exitFailure)
+	}
+
+	switch args[0] {
+	case "on":
+		fs := flag.NewFlagSet("proxy system on", flag.ContinueOnError)
+		winHTTP := fs.Bool("winhttp", false, "also set the WinHTTP proxy used by services (requires an administrator prompt)")
+		parseFlags(fs, args[1:])
+
+		if err := manager.EnableSystemProxy(*winHTTP); err != nil {
+			printErrorf("Failed to enable system proxy: %v", err)
+			exit(exitCode(err))
+		}
+
+		fmt.Printf("✓ Windows system proxy set to %s while the proxy runs\n", manager.GetXrayManager().HTTPProxyURL())
+		fmt.Println("  The previous settings are restored when the proxy stops")
+		if !manager.GetXrayManager().IsRunning() {
+			fmt.Println("\n⚠ Proxy is not running, the settings will be applied with: crosh on")
+		}
+	case "off":
+		if err := manager.DisableSystemProxy(); err != nil {
+			printErrorf("Failed to disable system proxy: %v", err)
+			exit(exitCode(err))
+		}
+		fmt.Println("✓ System proxy disabled, previous settings restored")
+	case "status":
+		enabled, detail, err := manager.GetSystemProxyStatus()
+		if err != nil {
+			printErrorf("Failed to read system proxy settings: %v", err)
+			exit(exitCode(err))
+		}
+		if enabled {
+			fmt.Printf("✓ System proxy: enabled (%s)\n", detail)
+		} else {
+			fmt.Printf("✗ System proxy: disabled (%s)\n", detail)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown system proxy command: %s\n", args[0])
+		exit(exitFailure)
+	}
+}
+
+// handleProxyLogs prints (and optionally follows) the Xray log
+func handleProxyLogs(manager *accelerator.Manager, args []string) {
+	fs := flag.NewFlagSet("proxy logs", flag.ContinueOnError)
+	follow := fs.Bool("f", false, "follow the log as it grows")
+	lines := fs.Int("n", 50, "number of lines to show (0 for all)")
+	level := fs.String("level", "", "only show lines at or above this level")
+	parseFlags(fs, args)
+
+	if *level != "" && !proxy.ValidLogLevel(*level) {
+		fmt.Fprintf(os.Stderr, "Error: unknown log level %q (use debug, info, warning or error)\n", *level)
+		exit(exitFailure)
+	}
+
+	if err := manager.GetXrayManager().TailLog(os.Stdout, *lines, *level, *follow); err != nil {
+		printError(err)
+		exit(exitCode(err))
+	}
+}
+
+// handleProxyHealth runs a single health check through the current node
+func handleProxyHealth(manager *accelerator.Manager, cfg *config.Config) {
+	latency, err := manager.CheckProxyHealth()
+	if err != nil {
+		printErrorf("Proxy unhealthy (node: %s): %v", cfg.Proxy.CurrentNode, err)
+		exit(exitCode(err))
+	}
+
+	fmt.Printf("✓ Proxy healthy (node: %s, latency: %dms)\n", cfg.Proxy.CurrentNode, latency.Milliseconds())
+	if manager.IsHealthMonitorRunning() {
+		fmt.Println("  Automatic failover: active")
+	} else {
+		fmt.Println("  Automatic failover: inactive")
+	}
+}
+
+// handleProxyStatus prints the proxy's runtime state
+func handleProxyStatus(manager *accelerator.Manager, cfg *config.Config, args []string) {
+	watching, interval := parseWatchFlags("proxy status", args)
+	if !watching {
+		printProxyStatus(manager.ProxyStatusDetails(), nil)
+		return
+	}
+
+	meter := &trafficMeter{}
+	watch(interval, func() {
+		cfg, manager = reloadManager(cfg, manager)
+		printProxyStatus(manager.ProxyStatusDetails(), meter)
+	})
+}
+
+// printProxyStatus prints the output of "crosh proxy status". With a meter,
+// as in watch mode, traffic is shown with its rates since the last refresh.
+func printProxyStatus(status *accelerator.ProxyStatus, meter *trafficMeter) {
+	if jsonOutput {
+		printJSON(proxyStatusJSON(status))
+		return
+	}
+
+	if status.Running {
+		fmt.Println("✓ Proxy: running")
+		fmt.Printf("  PID:          %d\n", status.PID)
+		if !status.StartedAt.IsZero() {
+			fmt.Printf("  Uptime:       %s\n", formatAge(time.Since(status.StartedAt)))
+		}
+		fmt.Printf("  Listening:    socks5 %s, http %s\n", status.SocksAddr, status.HTTPAddr)
+	} else {
+		fmt.Println("✗ Proxy: stopped")
+	}
+
+	if status.Node != nil {
+		switch {
+		case !status.Running:
+			fmt.Printf("  Node:         %s (%s, %s:%d)\n", status.Node.Name, status.Node.Type, status.Node.Server, status.Node.Port)
+		case status.LatencyErr != nil:
+			fmt.Printf("  Node:         %s (%s, ✗ unreachable: %v)\n", status.Node.Name, status.Node.Type, status.LatencyErr)
+		default:
+			fmt.Printf("  Node:         %s (%s, %dms)\n", status.Node.Name, status.Node.Type, status.Latency.Milliseconds())
+		}
+	}
+
+	if status.Running && status.Traffic != nil {
+		fmt.Printf("  Traffic:      %s\n", meter.describe(*status.Traffic))
+	}
+
+	if status.Running {
+		if status.MonitorRunning {
+			fmt.Println("  Failover:     active")
+		} else {
+			fmt.Println("  Failover:     inactive")
+		}
+	}
+
+	if status.SubscriptionURL != "" {
+		if status.SubscriptionUpdated.IsZero() {
+			fmt.Println("  Subscription: never fetched")
+		} else {
+			fmt.Printf("  Subscription: fetched %s ago\n", formatAge(time.Since(status.SubscriptionUpdated)))
+		}
+	}
+
+	if status.Backend != "" {
+		fmt.Printf("  Backend:      %s\n", status.Backend)
+	}
+
+	if status.GeoDataWarning != "" {
+		fmt.Printf("  ⚠ %s\n", status.GeoDataWarning)
+	}
+}
+
+// proxyStatusOutput is the JSON form of "crosh proxy status"
+type proxyStatusOutput struct {
+	Running             bool           `json:"running"`
+	PID                 int            `json:"pid,omitempty"`
+	StartedAt           *time.Time     `json:"started_at,omitempty"`
+	SocksAddr           string         `json:"socks_addr"`
+	HTTPAddr            string         `json:"http_addr"`
+	Node                *nodeOutput    `json:"node,omitempty"`
+	LatencyMS           *int64         `json:"latency_ms,omitempty"`
+	LatencyError        string         `json:"latency_error,omitempty"`
+	FailoverActive      bool           `json:"failover_active"`
+	SubscriptionURL     string         `json:"subscription_url,omitempty"`
+	SubscriptionUpdated *time.Time     `json:"subscription_updated,omitempty"`
+	Backend             string         `json:"backend,omitempty"`
+	GeoDataWarning      string         `json:"geodata_warning,omitempty"`
+	Traffic             *proxy.Traffic `json:"traffic,omitempty"`
+}
+
+// nodeOutput is the JSON form of a node, without its credentials
+type nodeOutput struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Source string `json:"source"`
+	Server string `json:"server"`
+	Port   int    `json:"port"`
+}
+
+// nodeJSON converts a node for JSON output
+func nodeJSON(node *proxy.Node) *nodeOutput {
+	source := "subscription"
+	if node.Source == proxy.NodeSourceManual {
+		source = "manual"
+	}
+	return &nodeOutput{Name: node.Name, Type: node.Type, Source: source, Server: node.Server, Port: node.Port}
+}
+
+// proxyStatusJSON converts the proxy status for JSON output
+func proxyStatusJSON(status *accelerator.ProxyStatus) proxyStatusOutput {
+	out := proxyStatusOutput{
+		Running:         status.Running,
+		PID:             status.PID,
+		SocksAddr:       status.SocksAddr,
+		HTTPAddr:        status.HTTPAddr,
+		FailoverActive:  status.Running && status.MonitorRunning,
+		SubscriptionURL: status.SubscriptionURL,
+		Backend:         status.Backend,
+		GeoDataWarning:  status.GeoDataWarning,
+		Traffic:         status.Traffic,
+	}
+	if !status.Running {
+		out.PID = 0
+	}
+	if !status.StartedAt.IsZero() && status.Running {
+		out.StartedAt = &status.StartedAt
+	}
+	if !status.SubscriptionUpdated.IsZero() {
+		out.SubscriptionUpdated = &status.SubscriptionUpdated
+	}
+	if status.Node != nil {
+		out.Node = nodeJSON(status.Node)
+	}
+	if status.Running && status.Node != nil {
+		if status.LatencyErr != nil {
+			out.LatencyError = status.LatencyErr.Error()
+		} else {
+			latency := status.Latency.Milliseconds()
+			out.LatencyMS = &latency
+		}
+	}
+	return out
+}
+
+// formatAge formats a duration coarsely, e.g. "3d 4h", "2h 13m" or "45s"
+func formatAge(d time.Duration) string {
+	d = d.Round(time.Second)
+	switch {
+	case d >= 24*time.Hour:
+		return fmt.Sprintf("%dd %dh", int(d.Hours())/24, int(d.Hours())%24)
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh %dm", int(d.Hours()), int(d.Minutes())%60)
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm %ds", int(d.Minutes()), int(d.Seconds())%60)
+	default:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+}
+
+// handleProxyBench measures download throughput through each node
+func handleProxyBench(manager *accelerator.Manager, args []string) {
+	fs := flag.NewFlagSet("proxy bench", flag.ContinueOnError)
+	testURL := fs.String("url", proxy.DefaultBenchURL, "Payload to download through each node")
+	timeout := fs.Duration("timeout", 15*time.Second, "Maximum time per node")
+	limit := fs.Int("n", 10, "Number of lowest-latency nodes to test (0 for all)")
+	fresh := fs.Bool("fresh", false, "Measure every node again instead of reusing recent results")
+	parseFlags(fs, args)
+
+	if *fresh {
+		manager.ClearBenchCache()
+	}
+
+	results, err := manager.BenchNodes(*testURL, *timeout, *limit, func(r proxy.BenchResult) {
+		if jsonOutput {
+			return
+		}
+		if r.Err != nil {
+			fmt.Printf("  ✗ %s: %v\n", r.Node.Name, r.Err)
+			return
+		}
+		fmt.Printf("  ✓ %s: %s\n", r.Node.Name, proxy.FormatThroughput(r.Throughput()))
+	})
+	if err != nil {
+		printErrorf("Benchmark failed: %v", err)
+		exit(exitCode(err))
+	}
+
+	if jsonOutput {
+		out := []benchOutput{}
+		for _, r := range results {
+			result := benchOutput{
+				Node:          nodeJSON(&r.Node),
+				LatencyMS:     r.Node.Latency,
+				Bytes:         r.Bytes,
+				DurationMS:    r.Duration.Milliseconds(),
+				ThroughputBPS: int64(r.Throughput()),
+			}
+			if r.Err != nil {
+				result.Error = r.Err.Error()
+			}
+			out = append(out, result)
+		}
+		printJSON(out)
+		return
+	}
+
+	fmt.Println("\nResults (fastest first):")
+	for i, r := range results {
+		if r.Err != nil {
+			fmt.Printf("  %2d. %-30s %12s %6dms\n", i+1, r.Node.Name, "failed", r.Node.Latency)
+			continue
+		}
+		fmt.Printf("  %2d. %-30s %12s %6dms\n", i+1, r.Node.Name, proxy.FormatThroughput(r.Throughput()), r.Node.Latency)
+	}
+}
+
+// benchOutput is the JSON form of one "crosh proxy bench" result
+type benchOutput struct {
+	Node          *nodeOutput `json:"node"`
+	LatencyMS     int         `json:"latency_ms"`
+	Bytes         int64       `json:"bytes"`
+	DurationMS    int64       `json:"duration_ms"`
+	ThroughputBPS int64       `json:"throughput_bps"`
+	Error         string      `json:"error,omitempty"`
+}
+
+// handleProxyDashboard serves the local web dashboard until interrupted
+func handleProxyDashboard(manager *accelerator.Manager, args []string) {
+	fs := flag.NewFlagSet("proxy dashboard", flag.ContinueOnError)
+	port := fs.Int("port", 7680, "Local port for the dashboard")
+	parseFlags(fs, args)
+
+	addr := fmt.Sprintf("127.0.0.1:%d", *port)
+	fmt.Printf("✓ Dashboard running at http://%s (Ctrl+C to stop)\n", addr)
+
+	if err := dashboard.NewServer(manager).ListenAndServe(addr); err != nil {
+		printErrorf("Dashboard failed: %v", err)
+		exit(exitCode(err))
+	}
+}
+
+// handleProxyMonitor runs the health monitor in the foreground until interrupted
+func handleProxyMonitor(manager *accelerator.Manager) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	stop := make(chan struct{})
+	go func() {
+		<-signals
+		close(stop)
+	}()
+
+	manager.RunHealthMonitor(stop)
+}
+
+// handleProxyLAN toggles listening on all interfaces
+func handleProxyLAN(manager *accelerator.Manager, args []string) {
+	if len(args) == 0 || (args[0] != "on" && args[0] != "off") {
+		fmt.Fprintln(os.Stderr, "Usage: crosh proxy lan on|off")
+		exit(exitFailure)
+	}
+
+	allow := args[0] == "on"
+	if err := manager.SetAllowLAN(allow); err != nil {
+		printErrorf("Failed to update LAN access: %v", err)
+		exit(exitCode(err))
+	}
+
+	xray := manager.GetXrayManager()
+	if !allow {
+		fmt.Println("✓ LAN access disabled, proxy listens on 127.0.0.1 only")
+		return
+	}
+
+	fmt.Println("✓ LAN access enabled")
+	fmt.Println("\n⚠ The proxy has no authentication: anyone who can reach this machine can use it.")
+	fmt.Println("  Only enable this on trusted networks, and check your firewall allows the ports.")
+	for _, ip := range proxy.LANAddresses() {
+		fmt.Printf("\n  socks5://%s:%d\n  http://%s:%d\n", ip, xray.SocksPort(), ip, xray.HTTPPort())
+	}
+}
+
+// handleProxyDNS toggles DoH resolution and fake-ip mode for the proxy
+func handleProxyDNS(manager *accelerator.Manager, cfg *config.Config, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: crosh proxy dns on [--fake-ip]|off|status")
+		exit(exitFailure)
+	}
+
+	switch args[0] {
+	case "on":
+		fs := flag.NewFlagSet("proxy dns on", flag.ContinueOnError)
+		fakeIP := fs.Bool("fake-ip", false, "Answer with fake IPs for TUN / transparent proxy setups")
+		parseFlags(fs, args[1:])
+
+		if err := manager.SetDNS(true, *fakeIP); err != nil {
+			printErrorf("Failed to update DNS settings: %v", err)
+			exit(exitCode(err))
+		}
+		fmt.Println("✓ Proxy DNS enabled")
+		printProxyDNS(cfg)
+	case "off":
+		if err := manager.SetDNS(false, false); err != nil {
+			printErrorf("Failed to update DNS settings: %v", err)
+			exit(exitCode(err))
+		}
+		fmt.Println("✓ Proxy DNS disabled, domains are resolved by the system resolver")
+	case "status":
+		if !cfg.Proxy.DNS.Enabled {
+			fmt.Println("Proxy DNS: disabled (system resolver)")
+			return
+		}
+		fmt.Println("Proxy DNS: enabled")
+		printProxyDNS(cfg)
+	default:
+		fmt.Fprintln(os.Stderr, "Usage: crosh proxy dns on [--fake-ip]|off|status")
+		exit(exitFailure)
+	}
+}
+
+// handleProxyUDP toggles UDP relay globally or for a single node
+func handleProxyUDP(manager *accelerator.Manager, cfg *config.Config, args []string) {
+	usage := "Usage: crosh proxy udp on|off|status [--node <name>]"
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		exit(exitFailure)
+	}
+
+	fs := flag.NewFlagSet("proxy udp", flag.ContinueOnError)
+	node := fs.String("node", "", "Only change UDP relay for this node")
+	parseFlags(fs, args[1:])
+
+	switch args[0] {
+	case "on", "off":
+		enabled := args[0] == "on"
+		if *node != "" {
+			if _, err := manager.FindNode(*node); err != nil {
+				printError(err)
+				exit(exitCode(err))
+			}
+		}
+		if err := manager.SetUDP(enabled, *node); err != nil {
+			printErrorf("Failed to update UDP relay: %v", err)
+			exit(exitCode(err))
+		}
+
+		state := "disabled, apps fall back to TCP"
+		if enabled {
+			state = "enabled"
+		}
+		if *node != "" {
+			fmt.Printf("✓ UDP relay %s for %s\n", state, *node)
+			if enabled && !cfg.Proxy.UDP.Enabled {
+				fmt.Println("⚠ UDP relay is disabled globally, run: crosh proxy udp on")
+			}
+			return
+		}
+		fmt.Printf("✓ UDP relay %s\n", state)
+	case "status":
+		if !cfg.Proxy.UDP.Enabled {
+			fmt.Println("UDP relay: disabled")
+			return
+		}
+		fmt.Println("UDP relay: enabled")
+		for _, name := range cfg.Proxy.UDP.DisabledNodes {
+			fmt.Printf("  • disabled for %s\n", name)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		exit(exitFailure)
+	}
+}
+
+// handleProxyBypass manages domains and IPs that skip the proxy
+func handleProxyBypass(manager *accelerator.Manager, cfg *config.Config, args []string) {
+	usage := "Usage: crosh proxy bypass add <domain|ip>...|remove <domain|ip>|list"
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		exit(exitFailure)
+	}
+
+	switch args[0] {
+	case "add":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, usage)
+			exit(exitFailure)
+		}
+		added, err := manager.AddBypass(args[1:])
+		if err != nil {
+			printErrorf("Failed to update bypass list: %v", err)
+			exit(exitCode(err))
+		}
+		if len(added) == 0 {
+			fmt.Println("Already in the bypass list, nothing to do")
+			return
+		}
+		for _, entry := range added {
+			fmt.Printf("✓ %s now connects directly\n", entry)
+		}
+	case "remove":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, usage)
+			exit(exitFailure)
+		}
+		if err := manager.RemoveBypass(args[1]); err != nil {
+			printError(err)
+			exit(exitCode(err))
+		}
+		fmt.Printf("✓ Removed %s from the bypass list\n", proxy.NormalizeBypass(args[1]))
+	case "list":
+		if len(cfg.Proxy.Bypass) == 0 {
+			fmt.Println("No bypass entries (Chinese sites and private networks always connect directly)")
+			return
+		}
+		for _, entry := range cfg.Proxy.Bypass {
+			fmt.Printf("  • %s\n", entry)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		exit(exitFailure)
+	}
+}
+
+// handleProxyGeoData updates or reports on geoip.dat/geosite.dat
+func handleProxyGeoData(manager *accelerator.Manager, args []string) {
+	if len(args) == 0 || (args[0] != "update" && args[0] != "status") {
+		fmt.Fprintln(os.Stderr, "Usage: crosh proxy geodata update|status")
+		exit(exitFailure)
+	}
+
+	xray := manager.GetXrayManager()
+
+	if args[0] == "update" {
+		if err := manager.UpdateGeoData(); err != nil {
+			printErrorf("Failed to update geo data: %v", err)
+			exit(exitCode(err))
+		}
+		fmt.Println("✓ Geo data updated")
+		return
+	}
+
+	updated, ok := xray.GeoDataUpdated()
+	if !ok {
+		fmt.Println("✗ Geo data: missing")
+	} else {
+		fmt.Printf("Geo data: updated %s (%d days ago)\n", updated.Format("2006-01-02"), int(time.Since(updated).Hours()/24))
+	}
+	if warning := xray.GeoDataWarning(); warning != "" {
+		fmt.Printf("⚠ %s\n", warning)
+	}
+}
+
+// printProxyDNS prints the configured DNS upstreams
+func printProxyDNS(cfg *config.Config) {
+	dns := cfg.Proxy.DNS
+	for _, server := range dns.Domestic {
+		fmt.Printf("  Domestic (direct): %s\n", server)
+	}
+	for _, server := range dns.Remote {
+		fmt.Printf("  Remote (proxied):  %s\n", server)
+	}
+	if dns.FakeIP {
+		ipRange := dns.FakeIPRange
+		if ipRange == "" {
+			ipRange = proxy.DefaultFakeIPRange
+		}
+		fmt.Printf("  Fake-IP:           %s\n", ipRange)
+	}
+}
+
+// handleProxyAdd adds share links to the manual node store
+func handleProxyAdd(manager *accelerator.Manager, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: crosh proxy add <vmess://...> [more links...]")
+		exit(exitFailure)
+	}
+
+	nodes, err := manager.AddNodes(args)
+	if err != nil {
+		printError(err)
+		exit(exitCode(err))
+	}
+
+	for _, node := range nodes {
+		fmt.Printf("✓ Added %s node: %s (%s:%d)\n", node.Type, node.Name, node.Server, node.Port)
+	}
+	fmt.Println("\nManual nodes are considered together with subscription nodes by: crosh on")
+}
+
+// handleProxyImport adds the nodes from another client's config to the manual node store
+func handleProxyImport(manager *accelerator.Manager, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: crosh proxy import <clash-config.yaml|v2rayN-export.txt>")
+		exit(exitFailure)
+	}
+
+	nodes, err := manager.ImportNodes(args[0])
+	if err != nil {
+		printErrorf("Failed to import %s: %v", args[0], err)
+		exit(exitCode(err))
+	}
+
+	for _, node := range nodes {
+		fmt.Printf("✓ Imported %s node: %s (%s:%d)\n", node.Type, node.Name, node.Server, node.Port)
+	}
+	fmt.Printf("\n%d nodes imported, they are considered together with subscription nodes by: crosh on\n", len(nodes))
+}
+
+// handleProxyRemove removes a node from the manual node store
+func handleProxyRemove(manager *accelerator.Manager, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: crosh proxy remove <name>")
+		exit(exitFailure)
+	}
+
+	if err := manager.RemoveNode(args[0]); err != nil {
+		printError(err)
+		exit(exitCode(err))
+	}
+	fmt.Printf("✓ Removed node: %s\n", args[0])
+}
+
+// handleProxyNodes lists every known node
+func handleProxyNodes(manager *accelerator.Manager) {
+	nodes, err := manager.ListNodes()
+	if err != nil {
+		printError(err)
+		exit(exitCode(err))
+	}
+
+	if jsonOutput {
+		out := []*nodeOutput{}
+		for i := range nodes {
+			out = append(out, nodeJSON(&nodes[i]))
+		}
+		printJSON(out)
+		return
+	}
+
+	for _, node := range nodes {
+		source := "subscription"
+		if node.Source == proxy.NodeSourceManual {
+			source = "manual"
+		}
+		fmt.Printf("  • %s [%s, %s] %s:%d\n", node.Name, node.Type, source, node.Server, node.Port)
+	}
+	fmt.Printf("\n%d nodes\n", len(nodes))
+}
+
+// handleProxyQR prints a node's share link as a terminal QR code
+func handleProxyQR(manager *accelerator.Manager, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: crosh proxy qr <name>")
+		exit(exitFailure)
+	}
+
+	node, err := manager.FindNode(args[0])
+	if err != nil {
+		printError(err)
+		exit(exitCode(err))
+	}
+
+	link, err := node.ShareLink()
+	if err != nil {
+		printError(err)
+		exit(exitCode(err))
+	}
+
+	code, err := proxy.QRCode(link)
+	if err != nil {
+		printError(err)
+		exit(exitCode(err))
+	}
+
+	fmt.Print(code)
+	fmt.Printf("\n%s\n", link)
+}
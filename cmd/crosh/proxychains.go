@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/boomyao/crosh/internal/config"
+	"github.com/boomyao/crosh/internal/i18n"
+)
+
+// handleExportProxychains writes a proxychains.conf that sends connections
+// through crosh's SOCKS5 port, for tools that ignore the proxy variables
+func handleExportProxychains(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("export proxychains", flag.ContinueOnError)
+	file := fs.String("file", "proxychains.conf", "File to write")
+	printConf := fs.Bool("print", false, "Print the config instead of writing it")
+	fs.Usage = func() {
+		fmt.Println("USAGE:\n    crosh export proxychains [--file proxychains.conf] [--print]")
+		fmt.Println("\nWrites a proxychains-ng config that routes any program through crosh's SOCKS5 proxy.")
+		fmt.Println("\nFLAGS:")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	conf := proxychainsConf(cfg.Proxy.LocalPort)
+	if *printConf {
+		fmt.Print(conf)
+		return
+	}
+	if err := os.WriteFile(*file, []byte(conf), 0644); err != nil {
+		printErrorf("Failed to write %s: %v", *file, err)
+		exit(exitFailure)
+	}
+	i18n.Printf("✓ Wrote %s\n", *file)
+	i18n.Println("  Run a program through the proxy with:")
+	fmt.Printf("    proxychains4 -f %s <command>\n", *file)
+	if !cfg.Proxy.Enabled {
+		i18n.Println("⚠ The proxy is off; start it with: crosh on")
+	}
+}
+
+// proxychainsConf returns a proxychains-ng config for the SOCKS5 port.
+// Hostnames are resolved by the proxy (proxy_dns), so the proxy's DNS and
+// bypass rules apply, and loopback connections stay local.
+func proxychainsConf(socksPort int) string {
+	return fmt.Sprintf(`# proxychains.conf: crosh's proxy (crosh export proxychains)
+strict_chain
+quiet_mode
+proxy_dns
+remote_dns_subnet 224
+tcp_read_time_out 15000
+tcp_connect_time_out 8000
+localnet 127.0.0.0/255.0.0.0
+
+[ProxyList]
+socks5 127.0.0.1 %d
+`, socksPort)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/boomyao/crosh/internal/accelerator"
+	"github.com/boomyao/crosh/internal/config"
+	"github.com/boomyao/crosh/internal/dashboard"
+	"github.com/boomyao/crosh/internal/metrics"
+)
+
+// nodesCacheTTL is how long /nodes reuses the node list, so a polling editor
+// extension doesn't fetch the subscription on every request
+const nodesCacheTTL = 5 * time.Minute
+
+// statusServer serves the read-only JSON endpoints of "crosh serve"
+type statusServer struct {
+	mu      sync.Mutex
+	cfg     *config.Config
+	manager *accelerator.Manager
+	nodes   []*nodeOutput
+	nodesAt time.Time
+}
+
+// handleServe serves crosh's state as JSON on localhost until interrupted
+func handleServe(manager *accelerator.Manager, cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	port := fs.Int("port", 7682, "Local port for the status endpoint")
+	metricsAddr := fs.String("metrics-addr", "", "Also serve Prometheus metrics at /metrics on this address, e.g. 127.0.0.1:9476 or :9476 for other machines")
+	fs.Usage = func() {
+		fmt.Println("USAGE:\n    crosh serve [--port 7682] [--metrics-addr <host:port>]")
+		fmt.Println("\nServes read-only JSON for editor extensions, menu-bar apps and scripts:")
+		fmt.Println("    GET /status    what \"crosh status --json\" prints, without the subscription URL")
+		fmt.Println("    GET /mirrors   the mirror of each tool")
+		fmt.Println("    GET /nodes     the proxy nodes, without their credentials")
+		fmt.Println("\nFLAGS:")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	s := &statusServer{cfg: cfg, manager: manager}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", s.handle(s.status))
+	mux.HandleFunc("/mirrors", s.handle(s.mirrors))
+	mux.HandleFunc("/nodes", s.handle(s.listNodes))
+
+	if *metricsAddr != "" {
+		go s.serveMetrics(*metricsAddr)
+	}
+
+	addr := fmt.Sprintf("127.0.0.1:%d", *port)
+	fmt.Printf("✓ Status endpoint running at http://%s/status (Ctrl+C to stop)\n", addr)
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if err := server.ListenAndServe(); err != nil {
+		printErrorf("Status endpoint failed: %v", err)
+		exit(exitCode(err))
+	}
+}
+
+// handle serves a GET with the value fn returns, reloading the config first
+// so the answer follows changes made by other crosh commands
+func (s *statusServer) handle(fn func() (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(map[string]string{"error": "use GET"})
+			return
+		}
+		if !dashboard.LocalRequest(r) {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("unexpected host %q", r.Host)})
+			return
+		}
+
+		s.mu.Lock()
+		s.cfg, s.manager = reloadManager(s.cfg, s.manager)
+		v, err := fn()
+		s.mu.Unlock()
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(v)
+	}
+}
+
+// serveMetrics serves Prometheus metrics on addr. Unlike the JSON endpoints
+// it accepts any Host, so a Prometheus server elsewhere can scrape it; the
+// metrics hold no credentials.
+func (s *statusServer) serveMetrics(addr string) {
+	exporter := metrics.NewExporter(nil)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		s.mu.Lock()
+		s.cfg, s.manager = reloadManager(s.cfg, s.manager)
+		exporter.Write(&buf, s.manager, s.cfg)
+		s.mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write(buf.Bytes())
+	})
+
+	fmt.Printf("✓ Prometheus metrics at http://%s/metrics\n", addr)
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if err := server.ListenAndServe(); err != nil {
+		printErrorf("Metrics endpoint failed: %v", err)
+		exit(exitCode(err))
+	}
+}
+
+// status returns "crosh status --json" without the subscription URL, which
+// carries credentials
+func (s *statusServer) status() (interface{}, error) {
+	out := statusJSON(s.manager, s.cfg)
+	out.Proxy.SubscriptionURL = ""
+	return out, nil
+}
+
+// mirrors returns the mirror section of the status
+func (s *statusServer) mirrors() (interface{}, error) {
+	return statusJSON(s.manager, s.cfg).Mirrors, nil
+}
+
+// listNodes returns the known nodes, cached for nodesCacheTTL
+func (s *statusServer) listNodes() (interface{}, error) {
+	if s.nodes != nil && time.Since(s.nodesAt) < nodesCacheTTL {
+		return s.nodes, nil
+	}
+
+	nodes, err := s.manager.ListNodes()
+	if err != nil {
+		return nil, err
+	}
+	out := []*nodeOutput{}
+	for i := range nodes {
+		out = append(out, nodeJSON(&nodes[i]))
+	}
+	s.nodes, s.nodesAt = out, time.Now()
+	return out, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// cell is a table cell, optionally wrapped in an ANSI color code
+type cell struct {
+	text  string
+	color string
+}
+
+// printTable prints rows as left-aligned columns two spaces apart. Widths
+// ignore color codes and count CJK characters as two columns.
+func printTable(header []string, rows [][]cell) {
+	widths := make([]int, len(header))
+	for i, title := range header {
+		widths[i] = displayWidth(title)
+	}
+	for _, row := range rows {
+		for i, c := range row {
+			if w := displayWidth(c.text); w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+
+	_, _, _, reset := colorCodes()
+	line := func(cells []cell) {
+		var b strings.Builder
+		for i, c := range cells {
+			text := c.text
+			if c.color != "" && reset != "" {
+				text = c.color + text + reset
+			}
+			b.WriteString(text)
+			if i < len(cells)-1 {
+				b.WriteString(strings.Repeat(" ", widths[i]-displayWidth(c.text)+2))
+			}
+		}
+		fmt.Println(strings.TrimRight(b.String(), " "))
+	}
+
+	titles := make([]cell, len(header))
+	for i, title := range header {
+		titles[i] = cell{text: title}
+	}
+	line(titles)
+	for _, row := range rows {
+		line(row)
+	}
+}
+
+// displayWidth returns how many terminal columns s takes
+func displayWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		if isWide(r) {
+			width += 2
+		} else {
+			width++
+		}
+	}
+	return width
+}
+
+// isWide reports whether r is an East Asian wide or fullwidth character
+func isWide(r rune) bool {
+	return r >= 0x1100 && (r <= 0x115F ||
+		(r >= 0x2E80 && r <= 0xA4CF) ||
+		(r >= 0xAC00 && r <= 0xD7A3) ||
+		(r >= 0xF900 && r <= 0xFAFF) ||
+		(r >= 0xFE30 && r <= 0xFE4F) ||
+		(r >= 0xFF00 && r <= 0xFF60) ||
+		(r >= 0xFFE0 && r <= 0xFFE6))
+}
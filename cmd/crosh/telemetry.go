@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/boomyao/crosh/internal/config"
+	"github.com/boomyao/crosh/internal/i18n"
+	"github.com/boomyao/crosh/internal/telemetry"
+)
+
+func printTelemetryUsage() {
+	fmt.Println(`USAGE:
+    crosh telemetry <command>
+
+COMMANDS:
+    status              Show whether usage metrics are sent and what they hold
+    on                  Send anonymous usage metrics to help decide which
+                        mirrors and platforms to improve
+    off                 Stop sending them and delete the ones not sent yet
+
+Telemetry is off unless you turn it on. For each command crosh sends its name
+(e.g. "mirror enable"), whether it succeeded, the crosh version, OS and CPU
+architecture and which tools have a mirror enabled. Never URLs, host or user
+names, paths, or node and profile names. DO_NOT_TRACK=1 turns it off whatever
+the config says.`)
+}
+
+// handleTelemetry turns the anonymous usage metrics on or off
+func handleTelemetry(cfg *config.Config, args []string) {
+	if len(args) == 0 {
+		handleTelemetryStatus(cfg)
+		return
+	}
+
+	switch args[0] {
+	case "status":
+		handleTelemetryStatus(cfg)
+	case "on", "off":
+		cfg.Telemetry.Enabled = args[0] == "on"
+		if err := cfg.Save(); err != nil {
+			printErrorf("Failed to save config: %v", err)
+			exit(exitCode(err))
+		}
+		if !cfg.Telemetry.Enabled {
+			if err := telemetry.Forget(); err != nil {
+				printError(err)
+			}
+			i18n.Println("✓ Telemetry off, nothing more is sent")
+			return
+		}
+		i18n.Println("✓ Telemetry on, thank you! Each command sends:")
+		printTelemetrySample(cfg)
+		if telemetry.DisabledByEnvironment() {
+			i18n.Println("⚠ DO_NOT_TRACK is set, so nothing is sent from this shell")
+		}
+	case "help", "-h", "--help":
+		printTelemetryUsage()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown telemetry command: %s\n\n", args[0])
+		printTelemetryUsage()
+		exit(exitFailure)
+	}
+}
+
+// handleTelemetryStatus shows whether telemetry is on and what it sends
+func handleTelemetryStatus(cfg *config.Config) {
+	switch {
+	case !cfg.Telemetry.Enabled:
+		i18n.Println("Telemetry: off (turn it on with: crosh telemetry on)")
+		return
+	case telemetry.DisabledByEnvironment():
+		i18n.Println("Telemetry: on in the config, but off in this shell because DO_NOT_TRACK is set")
+	default:
+		i18n.Printf("Telemetry: on, sent to %s\n", telemetry.Endpoint(cfg))
+	}
+	i18n.Println("Each command sends:")
+	printTelemetrySample(cfg)
+}
+
+// printTelemetrySample prints the event this command would send
+func printTelemetrySample(cfg *config.Config) {
+	data, _ := json.MarshalIndent(telemetry.NewEvent(cfg, usageCommand(os.Args[1:]), version, exitOK), "  ", "  ")
+	fmt.Printf("  %s\n", data)
+}
+
+// usageCommands are the commands reported by name, with their subcommands.
+// Anything else the user typed is left out, even a mistyped subcommand,
+// which may be a node or profile name.
+var usageCommands = map[string][]string{
+	"on": nil, "off": nil, "status": nil, "history": nil, "bootstrap": nil,
+	"serve": nil, "prefetch": nil, "uninstall": nil,
+	"proxy": {"status", "exec", "env", "git", "pkg", "docker", "system", "logs", "add", "import",
+		"remove", "nodes", "qr", "lan", "dns", "udp", "bypass", "geodata", "bench", "dashboard",
+		"health", "monitor"},
+	"profile":   {"list", "create", "switch"},
+	"mirror":    {"enable"},
+	"export":    {"devcontainer", "ansible", "docker", "k8s", "kubernetes", "ci", "proxychains"},
+	"daemon":    {"run", "start", "stop", "status"},
+	"cache":     {"serve"},
+	"telemetry": {"status", "on", "off"},
+}
+
+// usageCommand names the command in args for telemetry, leaving out
+// anything the user typed in: subscription URLs, files, and node, profile
+// or container names
+func usageCommand(args []string) string {
+	switch {
+	case len(args) == 0:
+		return "on"
+	case isHTTPURL(args[0]):
+		return "subscription"
+	case isYAMLFile(args[0]):
+		return "yaml-file"
+	}
+	subcommands, ok := usageCommands[args[0]]
+	if !ok {
+		return "unknown"
+	}
+	return commandWords(args, subcommands)
+}
+
+// commandWords is the command in args followed by its subcommand, if that
+// is one of subcommands
+func commandWords(args []string, subcommands []string) string {
+	if len(args) > 1 {
+		for _, subcommand := range subcommands {
+			if args[1] == subcommand {
+				return args[0] + " " + subcommand
+			}
+		}
+	}
+	return args[0]
+}
+
+// usageConfig is the config of the running command, once loaded, for
+// reportUsage
+var usageConfig *config.Config
+
+// reportUsage records the command's outcome if telemetry is on. exit calls
+// it, and main defers it for commands that return; only the first call
+// counts.
+func reportUsage(code int) {
+	cfg := usageConfig
+	if cfg == nil {
+		return
+	}
+	usageConfig = nil
+	telemetry.Record(cfg, telemetry.NewEvent(cfg, usageCommand(os.Args[1:]), version, code))
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/boomyao/crosh/internal/accelerator"
+	"github.com/boomyao/crosh/internal/config"
+	"github.com/boomyao/crosh/internal/hint"
+	"github.com/boomyao/crosh/internal/i18n"
+	"github.com/boomyao/crosh/internal/lock"
+	"github.com/boomyao/crosh/internal/logging"
+	"github.com/boomyao/crosh/internal/proxy"
+	"github.com/boomyao/crosh/internal/update"
+	"github.com/boomyao/crosh/internal/userfile"
+)
+
+// handleUninstall reverts every change crosh made and deletes its files
+func handleUninstall(manager *accelerator.Manager, args []string) {
+	fs := flag.NewFlagSet("uninstall", flag.ContinueOnError)
+	// --yes is a global flag, declared again here for the usage text
+	yes := fs.Bool("yes", false, "Don't ask for confirmation")
+	keepConfig := fs.Bool("keep-config", false, "Keep config.yaml, profiles and backups for a later reinstall")
+	fs.Usage = func() {
+		i18n.Println("USAGE:\n    crosh uninstall [--yes] [--keep-config]")
+		i18n.Println("\nStops the proxy, the daemon and the package cache, removes git, package")
+		i18n.Println("manager and Docker proxy settings, disables all mirrors, restores files crosh")
+		i18n.Println("backed up, removes crosh's lines from shell rc files and deletes crosh's")
+		i18n.Println("config, data and state directories and its key in the system keyring.")
+		i18n.Println("\nFLAGS:")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	dirs := []string{config.DataDir(), config.StateDir()}
+	if !*keepConfig {
+		dirs = append(dirs, config.ConfigDir())
+	}
+
+	if !*yes && !assumeYes {
+		i18n.Println("This reverts every change crosh made to this machine and deletes:")
+		seen := make(map[string]bool)
+		for _, dir := range dirs {
+			if !seen[dir] {
+				seen[dir] = true
+				fmt.Printf("  • %s\n", dir)
+			}
+		}
+		i18n.Print("\nContinue? [y/N] ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer != "y" && answer != "yes" {
+			i18n.Println("Uninstall cancelled, nothing was changed")
+			return
+		}
+		fmt.Println()
+		// Confirmed once for every file below
+		userfile.Confirm = nil
+	}
+
+	// A daemon would start the proxy again, and a package cache would point
+	// npm, pip and go back at itself
+	errs := stopBackgroundServices(manager)
+	errs = append(errs, manager.Revert()...)
+
+	// The state and backups are needed to retry, so nothing is deleted yet
+	if len(errs) > 0 {
+		printUninstallErrors(errs)
+		i18n.Fprintln(os.Stderr, "  Nothing was deleted. Fix the cause (e.g. run with sudo for apt and Docker) and run \"crosh uninstall\" again")
+		exit(exitPartial)
+	}
+
+	// The log file is in the state directory that is about to go
+	logging.Close()
+	removed, err := config.RemoveAll(*keepConfig)
+	for _, dir := range removed {
+		i18n.Printf("✓ Deleted %s\n", dir)
+	}
+	if err == nil && !*keepConfig {
+		// A kept config may still hold secrets encrypted with the key
+		err = config.DeleteSecretKey()
+	}
+	if err != nil {
+		printUninstallErrors([]error{err})
+		exit(exitPartial)
+	}
+
+	i18n.Println("\n✓ crosh has been removed")
+	if path, err := update.Executable(); err == nil {
+		i18n.Printf("  Delete the binary too with: rm %s\n", path)
+	}
+}
+
+// stopBackgroundServices stops a running daemon and package cache
+func stopBackgroundServices(manager *accelerator.Manager) []error {
+	var errs []error
+
+	// The daemon takes the settings lock to stop the proxy
+	lock.Release()
+	running, err := stopDaemon(manager.GetXrayManager().StateDir())
+	if lockErr := lock.Acquire(lockWait); lockErr != nil {
+		printError(lockErr)
+		exit(exitCode(lockErr))
+	}
+	if err != nil {
+		errs = append(errs, err)
+	} else if running {
+		i18n.Println("✓ Daemon stopped")
+	}
+
+	if _, alive := proxy.BackgroundRunning(cachePIDFile()); alive {
+		if err := proxy.StopBackground(cachePIDFile()); err != nil {
+			errs = append(errs, fmt.Errorf("package cache: %w", err))
+		} else {
+			i18n.Println("✓ Package cache stopped")
+		}
+	}
+	return errs
+}
+
+// printUninstallErrors lists what uninstall couldn't do, with hints
+func printUninstallErrors(errs []error) {
+	i18n.Fprintln(os.Stderr, "\n⚠ Some changes could not be reverted:")
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "  • %v\n", err)
+		hint.Fprint(os.Stderr, "    ", err)
+	}
+}
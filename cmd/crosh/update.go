@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/boomyao/crosh/internal/i18n"
+	"github.com/boomyao/crosh/internal/logging"
+	"github.com/boomyao/crosh/internal/update"
+)
+
+// handleSelfUpdate replaces the crosh binary with the latest release
+func handleSelfUpdate(args []string) {
+	fs := flag.NewFlagSet("self-update", flag.ContinueOnError)
+	check := fs.Bool("check", false, "Only report whether an update is available")
+	force := fs.Bool("force", false, "Install even if this version is current or a dev build")
+	target := fs.String("version", "", "Install this release instead of the latest, e.g. v1.2.0")
+	fs.Usage = func() {
+		i18n.Println("USAGE:\n    crosh self-update [--check] [--force] [--version v1.2.0]")
+		i18n.Println("\nDownloads the release for this platform, verifies it against the release's")
+		i18n.Println("checksums.txt and replaces the running binary.")
+		i18n.Println("\nFLAGS:")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	current := strings.TrimSpace(version)
+	latest := *target
+	if latest == "" {
+		var err error
+		if latest, err = update.Latest(rootCtx); err != nil {
+			printError(err)
+			exit(exitCode(err))
+		}
+	}
+
+	if *check {
+		if jsonOutput {
+			printJSON(map[string]interface{}{"current": current, "latest": latest, "update_available": update.Newer(latest, current)})
+			return
+		}
+		if update.Newer(latest, current) {
+			i18n.Printf("Update available: %s → %s (run \"crosh self-update\")\n", current, latest)
+		} else {
+			i18n.Printf("✓ crosh %s is up to date (latest: %s)\n", current, latest)
+		}
+		return
+	}
+
+	if !*force && *target == "" && !update.Newer(latest, current) {
+		if current == "dev" {
+			i18n.Printf("This is a dev build, use --force to replace it with %s\n", latest)
+			return
+		}
+		i18n.Printf("✓ crosh %s is up to date\n", current)
+		return
+	}
+
+	path, err := update.Executable()
+	if err != nil {
+		printError(err)
+		exit(exitCode(err))
+	}
+
+	i18n.Printf("Downloading crosh %s (%s)...\n", latest, update.AssetName())
+	data, err := update.Download(rootCtx, latest)
+	if err != nil {
+		printError(err)
+		exit(exitCode(err))
+	}
+	i18n.Println("✓ Checksum verified")
+
+	if err := update.Replace(path, data); err != nil {
+		printError(err)
+		exit(exitCode(err))
+	}
+	logging.Info("self-update", "from", current, "to", latest, "path", path)
+	i18n.Printf("✓ Updated %s from %s to %s\n", path, current, latest)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/boomyao/crosh/internal/i18n"
+	"github.com/boomyao/crosh/internal/update"
+)
+
+// versionOutput is the JSON form of "crosh version"
+type versionOutput struct {
+	Version         string `json:"version"`
+	Commit          string `json:"commit,omitempty"`
+	BuildTime       string `json:"build_time,omitempty"`
+	GoVersion       string `json:"go_version"`
+	Platform        string `json:"platform"`
+	Latest          string `json:"latest,omitempty"`
+	UpdateAvailable *bool  `json:"update_available,omitempty"`
+}
+
+// handleVersion prints the version and build metadata, and with --check
+// whether a newer release is out
+func handleVersion(args []string) {
+	fs := flag.NewFlagSet("version", flag.ContinueOnError)
+	check := fs.Bool("check", false, "Also check whether a newer release is available")
+	fs.Usage = func() {
+		i18n.Println("USAGE:\n    crosh version [--check]")
+		i18n.Println("\nFLAGS:")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	out := buildInfo()
+	if *check {
+		latest, err := update.Latest(context.Background())
+		if err != nil {
+			printError(err)
+			exit(exitCode(err))
+		}
+		available := update.Newer(latest, out.Version)
+		out.Latest, out.UpdateAvailable = latest, &available
+	}
+
+	if jsonOutput {
+		printJSON(out)
+		return
+	}
+
+	fmt.Printf("crosh version %s\n", out.Version)
+	if out.Commit != "" {
+		i18n.Printf("  Commit:  %s\n", out.Commit)
+	}
+	if out.BuildTime != "" {
+		i18n.Printf("  Built:   %s\n", out.BuildTime)
+	}
+	i18n.Printf("  Go:      %s %s\n", out.GoVersion, out.Platform)
+
+	if out.UpdateAvailable != nil {
+		fmt.Println()
+		if *out.UpdateAvailable {
+			i18n.Printf("Update available: %s → %s (run \"crosh self-update\")\n", out.Version, out.Latest)
+		} else {
+			i18n.Printf("✓ crosh %s is up to date (latest: %s)\n", out.Version, out.Latest)
+		}
+	}
+}
+
+// buildInfo collects the version, commit and build time set by ldflags. Builds
+// without a commit, e.g. "go build" in a checkout, fall back to the revision
+// Go embeds.
+func buildInfo() versionOutput {
+	out := versionOutput{
+		Version:   strings.TrimSpace(version),
+		Commit:    commit,
+		BuildTime: buildTime,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		modified := false
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if out.Commit == "" && len(setting.Value) >= 7 {
+					out.Commit = setting.Value[:7]
+				}
+			case "vcs.modified":
+				modified = setting.Value == "true"
+			}
+		}
+		if modified && commit == "" && out.Commit != "" {
+			out.Commit += "-dirty"
+		}
+	}
+	return out
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/boomyao/crosh/internal/accelerator"
+	"github.com/boomyao/crosh/internal/config"
+	"github.com/boomyao/crosh/internal/i18n"
+	"github.com/boomyao/crosh/internal/logging"
+	"github.com/boomyao/crosh/internal/progress"
+	"github.com/boomyao/crosh/internal/proxy"
+)
+
+// minWatchInterval keeps --watch from probing the proxy in a tight loop
+const minWatchInterval = time.Second
+
+// parseWatchFlags parses the --watch and --interval flags of a status command
+func parseWatchFlags(command string, args []string) (bool, time.Duration) {
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	watch := fs.Bool("watch", false, "Refresh every --interval until Ctrl+C")
+	interval := fs.Duration("interval", 2*time.Second, "How often --watch refreshes")
+	fs.Usage = func() {
+		i18n.Printf("USAGE:\n    crosh %s [--watch] [--interval 2s]\n", command)
+		i18n.Println("\nFLAGS:")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	if *interval < minWatchInterval {
+		i18n.Fprintf(os.Stderr, "✗ --interval must be at least %s\n", minWatchInterval)
+		exit(exitFailure)
+	}
+	return *watch, *interval
+}
+
+// watch calls render every interval until interrupted, redrawing the screen
+// on a terminal, and right away when the config is saved. JSON output is
+// printed as a stream of documents instead. render runs on this goroutine
+// only, so it can reload the config without locking.
+func watch(interval time.Duration, render func()) {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		fmt.Println()
+		exit(exitOK)
+	}()
+
+	changed := make(chan struct{}, 1)
+	err := config.Watch(make(chan struct{}), func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		logging.Debug("not watching the config, refreshing on the interval only", "error", err)
+	}
+
+	redraw := isTerminal(os.Stdout) && !jsonOutput
+	for {
+		if redraw {
+			fmt.Print("\033[H\033[2J")
+		}
+		render()
+		if !jsonOutput {
+			i18n.Printf("\nUpdated %s, refreshing every %s (Ctrl+C to stop)\n", time.Now().Format("15:04:05"), interval)
+		}
+		select {
+		case <-time.After(interval):
+		case <-changed:
+		}
+	}
+}
+
+// reloadManager reloads the config so a watched status follows "crosh on",
+// profile switches and edits made in another terminal. The previous config
+// is kept if the new one doesn't load.
+func reloadManager(cfg *config.Config, manager *accelerator.Manager) (*config.Config, *accelerator.Manager) {
+	reloaded, err := config.Load()
+	if err != nil {
+		return cfg, manager
+	}
+	return reloaded, accelerator.NewManager(reloaded)
+}
+
+// trafficMeter turns the proxy's traffic counters into rates between refreshes
+type trafficMeter struct {
+	last   proxy.Traffic
+	lastAt time.Time
+}
+
+// describe formats the traffic totals, with the rates since the previous
+// call when m isn't nil
+func (m *trafficMeter) describe(traffic proxy.Traffic) string {
+	up := "↑ " + progress.FormatBytes(traffic.Uplink)
+	down := "↓ " + progress.FormatBytes(traffic.Downlink)
+	if m == nil {
+		return up + "  " + down
+	}
+
+	now := time.Now()
+	// Counters going backwards mean the proxy restarted
+	if !m.lastAt.IsZero() && traffic.Uplink >= m.last.Uplink && traffic.Downlink >= m.last.Downlink {
+		seconds := now.Sub(m.lastAt).Seconds()
+		up += fmt.Sprintf(" (%s)", proxy.FormatThroughput(float64(traffic.Uplink-m.last.Uplink)/seconds))
+		down += fmt.Sprintf(" (%s)", proxy.FormatThroughput(float64(traffic.Downlink-m.last.Downlink)/seconds))
+	}
+	m.last, m.lastAt = traffic, now
+	return up + "  " + down
+}
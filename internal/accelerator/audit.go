@@ -0,0 +1,133 @@
+package accelerator
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/boomyao/crosh/internal/logging"
+)
+
+// auditLogMaxSize is the size at which audit.log is rotated to audit.log.1
+const auditLogMaxSize = 1 << 20
+
+// AuditEntry is one state-changing operation in the audit log
+type AuditEntry struct {
+	Time   time.Time `json:"time"`
+	User   string    `json:"user"`
+	Action string    `json:"action"` // e.g. mirror.enable, proxy.start, node.switch
+	Detail string    `json:"detail,omitempty"`
+	Files  []string  `json:"files,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// AuditLogPath returns the JSON lines file recording state changes
+func (m *Manager) AuditLogPath() string {
+	return filepath.Join(m.xray.StateDir(), "audit.log")
+}
+
+// audit appends an operation to the audit log. Failures to write the log
+// never fail the operation itself. Credentials and query strings are cut
+// from URLs in detail and the error first.
+func (m *Manager) audit(action, detail string, files []string, opErr error) {
+	entry := AuditEntry{
+		Time:   time.Now(),
+		User:   currentUser(),
+		Action: action,
+		Detail: redactURLs(detail),
+		Files:  files,
+	}
+	if opErr != nil {
+		entry.Error = redactURLs(opErr.Error())
+		logging.Failed(action+" failed", "detail", entry.Detail, "error", entry.Error)
+	} else {
+		logging.Info(action, "detail", entry.Detail, "files", files)
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	path := m.AuditLogPath()
+	if info, err := os.Stat(path); err == nil && info.Size() > auditLogMaxSize {
+		os.Rename(path, path+".1")
+	}
+
+	os.MkdirAll(filepath.Dir(path), 0755)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	// Logs written by older versions were readable by everyone
+	file.Chmod(0600)
+	file.Write(append(data, '\n'))
+}
+
+// urlPattern matches the URLs in an audit detail, which may be separated by
+// spaces or commas
+var urlPattern = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^\s,"']+`)
+
+// redactURLs removes the user info, query string and fragment from every URL
+// in s, e.g. a mirror URL with a token in it
+func redactURLs(s string) string {
+	return urlPattern.ReplaceAllStringFunc(s, func(raw string) string {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return "<invalid URL>"
+		}
+		u.User = nil
+		u.RawQuery = ""
+		u.ForceQuery = false
+		u.Fragment = ""
+		u.RawFragment = ""
+		return u.String()
+	})
+}
+
+// AuditLog returns the recorded operations, oldest first, including the
+// rotated log
+func (m *Manager) AuditLog() ([]AuditEntry, error) {
+	var entries []AuditEntry
+	for _, path := range []string{m.AuditLogPath() + ".1", m.AuditLogPath()} {
+		file, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read audit log: %w", err)
+		}
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var entry AuditEntry
+			// Skip lines cut short by a crash
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err == nil {
+				entries = append(entries, entry)
+			}
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read audit log: %w", err)
+		}
+	}
+	return entries, nil
+}
+
+// currentUser returns the name of the user running crosh
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return os.Getenv("USERNAME")
+}
@@ -0,0 +1,170 @@
+package accelerator
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/boomyao/crosh/internal/benchcache"
+	"github.com/boomyao/crosh/internal/config"
+	"github.com/boomyao/crosh/internal/logging"
+	"github.com/boomyao/crosh/internal/proxy"
+)
+
+// BenchNodes downloads testURL through the limit lowest-latency nodes (all
+// nodes if limit is 0), calling progress after each one, and returns the
+// results fastest first
+func (m *Manager) BenchNodes(testURL string, timeout time.Duration, limit int, progress func(proxy.BenchResult)) ([]proxy.BenchResult, error) {
+	if err := m.xray.Download(); err != nil {
+		return nil, fmt.Errorf("failed to download Xray: %w", err)
+	}
+
+	sub, err := m.collectNodes()
+	if err != nil {
+		return nil, err
+	}
+
+	// Only bandwidth-test nodes that answer at all, best latency first
+	fmt.Println("Testing node latency...")
+	sub.TestAll(m.cachedLatency())
+	defer m.saveBenchCache()
+	if err := m.context().Err(); err != nil {
+		return nil, err
+	}
+	var candidates []proxy.Node
+	for _, node := range sub.Nodes {
+		if node.Latency >= 0 {
+			candidates = append(candidates, node)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, proxy.ErrNoReachableNodes
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Latency < candidates[j].Latency
+	})
+	if limit > 0 && len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+
+	fmt.Printf("Downloading through %d nodes...\n", len(candidates))
+
+	// One node at a time so downloads don't compete for bandwidth
+	results := make([]proxy.BenchResult, 0, len(candidates))
+	for i := range candidates {
+		if err := m.context().Err(); err != nil {
+			return nil, err
+		}
+		result := m.cachedBench(&candidates[i], testURL, timeout)
+		if progress != nil {
+			progress(result)
+		}
+		results = append(results, result)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if (results[i].Err == nil) != (results[j].Err == nil) {
+			return results[i].Err == nil
+		}
+		return results[i].Throughput() > results[j].Throughput()
+	})
+
+	return results, nil
+}
+
+// benchCache returns the cache of recent measurements, or nil if
+// bench_cache_ttl turns it off
+func (m *Manager) benchCache() *benchcache.Cache {
+	if !m.cacheOpened {
+		m.measurements = benchcache.Open(config.BenchCachePath(), time.Duration(m.config.BenchCacheTTL)*time.Second)
+		m.cacheOpened = true
+	}
+	return m.measurements
+}
+
+// saveBenchCache writes new measurements to disk
+func (m *Manager) saveBenchCache() {
+	if err := m.benchCache().Save(); err != nil {
+		logging.Warn("failed to save measurements", "error", err)
+	}
+}
+
+// ClearBenchCache forgets all measurements, so the next test probes every
+// node again
+func (m *Manager) ClearBenchCache() {
+	m.benchCache().Clear()
+	m.saveBenchCache()
+}
+
+// nodeKey identifies a node in the bench cache by what it connects to, so a
+// renamed node keeps its measurements and a changed one loses them
+func nodeKey(kind string, node *proxy.Node, params ...string) string {
+	key := fmt.Sprintf("%s/%s/%s:%d", kind, node.Type, node.Server, node.Port)
+	for _, param := range params {
+		key += "/" + param
+	}
+	return key
+}
+
+// cachedLatency returns the configured latency test, answering from the
+// bench cache when the node was measured recently
+func (m *Manager) cachedLatency() func(*proxy.Node) error {
+	cache := m.benchCache()
+	test := m.xray.LatencyTest()
+	return func(node *proxy.Node) error {
+		key := nodeKey("latency", node, test.Method, test.URL)
+		var latency int
+		if cache.Get(key, &latency) {
+			node.Latency = latency
+			if latency < 0 {
+				return fmt.Errorf("%s was unreachable when last tested", node.Name)
+			}
+			return nil
+		}
+
+		err := m.xray.TestLatency(node)
+		if m.context().Err() != nil {
+			// An interrupted test says nothing about the node
+			return err
+		}
+		if err != nil {
+			cache.Put(key, -1)
+		} else {
+			cache.Put(key, node.Latency)
+		}
+		return err
+	}
+}
+
+// cachedThroughput is a download benchmark as stored in the bench cache
+type cachedThroughput struct {
+	Bytes    int64         `json:"bytes"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// cachedBench benchmarks a node, answering from the bench cache when it was
+// benchmarked recently with the same payload
+func (m *Manager) cachedBench(node *proxy.Node, testURL string, timeout time.Duration) proxy.BenchResult {
+	key := nodeKey("throughput", node, testURL)
+	var cached cachedThroughput
+	if m.benchCache().Get(key, &cached) {
+		result := proxy.BenchResult{Node: *node, Bytes: cached.Bytes, Duration: cached.Duration}
+		if cached.Error != "" {
+			result.Err = errors.New(cached.Error)
+		}
+		return result
+	}
+
+	result := m.xray.BenchNode(node, testURL, timeout)
+	if m.context().Err() != nil {
+		return result
+	}
+	cached = cachedThroughput{Bytes: result.Bytes, Duration: result.Duration}
+	if result.Err != nil {
+		cached.Error = result.Err.Error()
+	}
+	m.benchCache().Put(key, cached)
+	return result
+}
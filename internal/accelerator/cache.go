@@ -0,0 +1,62 @@
+package accelerator
+
+import (
+	"fmt"
+
+	"github.com/boomyao/crosh/internal/i18n"
+	"github.com/boomyao/crosh/internal/mirror"
+	"github.com/boomyao/crosh/internal/userfile"
+)
+
+// cacheTools are the tools "crosh cache serve" can sit in front of
+var cacheTools = []string{"npm", "pip", "go"}
+
+// UseCache points npm, pip and go at a crosh cache, for the tools whose
+// mirror is enabled. urls maps the tool to its cache URL; the configured
+// mirrors stay in the config for StopUsingCache.
+func (m *Manager) UseCache(urls map[string]string) error {
+	return m.setCacheMirrors(urls, "cache")
+}
+
+// StopUsingCache points npm, pip and go back at their configured mirrors
+func (m *Manager) StopUsingCache() error {
+	urls := make(map[string]string)
+	for _, tool := range cacheTools {
+		urls[tool] = m.config.Mirror.URL(tool)
+	}
+	return m.setCacheMirrors(urls, "mirror")
+}
+
+// setCacheMirrors runs the mirror handlers of the cache tools with urls
+func (m *Manager) setCacheMirrors(urls map[string]string, what string) error {
+	defer userfile.Begin("cache.mirrors").Done()
+	var errs []error
+	for _, tool := range cacheTools {
+		url := urls[tool]
+		if url == "" || !m.config.Mirror.Tool(tool).Enabled {
+			continue
+		}
+
+		var handler interface{ Enable() error }
+		switch tool {
+		case "npm":
+			handler = mirror.NewNPMMirror(url)
+		case "pip":
+			handler = mirror.NewPipMirror(url)
+		case "go":
+			handler = mirror.NewGoMirror(url)
+		}
+		err := handler.Enable()
+		m.audit("mirror.enable", tool+" "+url+" ("+what+")", mirror.ConfigFiles(tool), err)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s mirror: %w", tool, err))
+			continue
+		}
+		i18n.Printf("✓ %s uses %s\n", tool, url)
+	}
+	if len(errs) > 0 {
+		printMirrorErrors(errs)
+		return &mirrorErrors{action: "enable", errs: errs}
+	}
+	return nil
+}
@@ -0,0 +1,343 @@
+package accelerator
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/boomyao/crosh/internal/config"
+	"github.com/boomyao/crosh/internal/hint"
+	"github.com/boomyao/crosh/internal/i18n"
+	"github.com/boomyao/crosh/internal/lock"
+	"github.com/boomyao/crosh/internal/notify"
+	"github.com/boomyao/crosh/internal/proxy"
+)
+
+// healthCheckTimeout bounds a single probe through the proxy
+const healthCheckTimeout = 10 * time.Second
+
+// failoverLockWait is how long a failover waits for a crosh command that is
+// changing settings; the next failed probe tries again
+const failoverLockWait = 10 * time.Second
+
+// switchLockWait is how long switching nodes waits for another crosh
+// instance to finish changing settings
+const switchLockWait = 3 * time.Second
+
+// monitorPIDFile returns the PID file of the background health monitor
+func (m *Manager) monitorPIDFile() string {
+	return filepath.Join(m.xray.StateDir(), "monitor.pid")
+}
+
+// StartHealthMonitor launches "crosh proxy monitor" in the background
+func (m *Manager) StartHealthMonitor() error {
+	if !m.config.Proxy.HealthCheck.Enabled {
+		return nil
+	}
+
+	if _, alive := proxy.BackgroundRunning(m.monitorPIDFile()); alive {
+		return nil
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate crosh executable: %w", err)
+	}
+
+	if err := os.MkdirAll(m.xray.LogDir(), 0755); err != nil {
+		return fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	logFile := filepath.Join(m.xray.LogDir(), "monitor.log")
+	if _, err := proxy.StartBackground(executable, []string{"proxy", "monitor"}, logFile, m.monitorPIDFile()); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// StopHealthMonitor stops the background health monitor
+func (m *Manager) StopHealthMonitor() error {
+	return proxy.StopBackground(m.monitorPIDFile())
+}
+
+// IsHealthMonitorRunning checks if the background health monitor is alive
+func (m *Manager) IsHealthMonitorRunning() bool {
+	_, alive := proxy.BackgroundRunning(m.monitorPIDFile())
+	return alive
+}
+
+// CheckProxyHealth probes the health check URL through the running proxy
+func (m *Manager) CheckProxyHealth() (time.Duration, error) {
+	if !m.xray.IsRunning() {
+		return 0, hint.Errorf("start it with \"crosh on\"", "proxy is not running")
+	}
+	return proxy.CheckProxy(m.xray.HTTPProxyURL(), m.healthCheckURL(), healthCheckTimeout)
+}
+
+// healthCheckURL returns the configured probe URL or the default
+func (m *Manager) healthCheckURL() string {
+	if m.config.Proxy.HealthCheck.URL != "" {
+		return m.config.Proxy.HealthCheck.URL
+	}
+	return config.DefaultHealthCheckURL
+}
+
+// RunHealthMonitor probes the proxy every interval and switches to the next
+// best node after the configured number of consecutive failures. After a
+// wake from sleep or a network change it restarts the proxy and probes right
+// away. It runs until stop is closed.
+func (m *Manager) RunHealthMonitor(stop <-chan struct{}) {
+	hc := m.config.Proxy.HealthCheck
+	interval := time.Duration(hc.Interval) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	maxFailures := hc.Failures
+	if maxFailures <= 0 {
+		maxFailures = 3
+	}
+
+	log.Printf("Health monitor started (interval %s, failover after %d failures, probe %s)", interval, maxFailures, m.healthCheckURL())
+
+	failures := 0
+	released := false // global settings removed because no node works
+	down := false     // the user was notified that no node works
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	watcher := newNetworkWatcher()
+	watchTicker := time.NewTicker(netWatchInterval)
+	defer watchTicker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			// Stopped along with a proxy that died, e.g. at shutdown: don't
+			// leave git and package managers pointing at a dead port. A crosh
+			// stopping the proxy holds the lock and releases them itself.
+			if lock.Acquire(0) == nil {
+				if released := m.RecoverStaleSettings(); len(released) > 0 {
+					log.Printf("Proxy is not running, removed %s proxy settings", strings.Join(released, ", "))
+				}
+				lock.Release()
+			}
+			log.Println("Health monitor stopped")
+			return
+		case <-ticker.C:
+		case <-watchTicker.C:
+			reason := watcher.check()
+			if reason == "" || !m.xray.IsRunning() {
+				continue
+			}
+			// Upstream connections are dead after a sleep or network switch;
+			// restart to drop them instead of waiting for timeouts
+			log.Printf("%s, restarting proxy", reason)
+			if err := m.RestartProxy(); err != nil {
+				log.Printf("Restart failed: %v", err)
+			}
+			time.Sleep(reconnectSettleDelay)
+			failures = 0
+			ticker.Reset(interval)
+		}
+
+		// Pick up what crosh commands changed since, e.g. a git proxy
+		// turned off, so it isn't reapplied or saved back
+		if err := m.reloadConfig(); err != nil {
+			log.Printf("Keeping the previous config: %v", err)
+		}
+
+		if !m.xray.IsRunning() {
+			// Don't leave git and package managers pointing at a dead port
+			if released := m.releaseGlobalSettings(); len(released) > 0 {
+				log.Printf("Proxy died, removed %s proxy settings", strings.Join(released, ", "))
+			}
+			m.notify("proxy.down", i18n.T("The proxy stopped running. Run \"crosh on\" to start it again."))
+			log.Println("Proxy is not running, health monitor exiting")
+			return
+		}
+		if err := m.xray.RotateLog(); err != nil {
+			log.Printf("Failed to rotate the proxy log: %v", err)
+		}
+
+		latency, err := m.CheckProxyHealth()
+		if err == nil {
+			if failures > 0 {
+				log.Printf("Proxy recovered (node: %s, latency: %dms)", m.config.Proxy.CurrentNode, latency.Milliseconds())
+			}
+			if released {
+				m.applyGlobalSettings()
+				log.Println("Restored global proxy settings")
+				released = false
+			}
+			if down {
+				m.notify("proxy.recovered", i18n.Sprintf("The proxy is working again (node: %s).", m.config.Proxy.CurrentNode))
+				down = false
+			}
+			failures = 0
+			continue
+		}
+
+		failures++
+		log.Printf("Health check failed (%d/%d) for node %s: %v", failures, maxFailures, m.config.Proxy.CurrentNode, err)
+		if failures < maxFailures {
+			continue
+		}
+
+		// Don't blame the node for a local outage
+		if err := proxy.CheckDirect(healthCheckTimeout); err != nil {
+			log.Printf("Skipping failover: %v", err)
+			continue
+		}
+
+		previous := m.config.Proxy.CurrentNode
+		node, err := m.Failover()
+		if err != nil {
+			log.Printf("Failover failed: %v", err)
+			// Kill switch: with no working node, let git and package
+			// managers connect directly until the proxy recovers
+			if !released {
+				if names := m.releaseGlobalSettings(); len(names) > 0 {
+					log.Printf("Removed %s proxy settings until the proxy recovers", strings.Join(names, ", "))
+					released = true
+				}
+			}
+			if !down {
+				m.notify("proxy.down", i18n.T("The proxy is down and no other node is reachable."))
+				down = true
+			}
+			continue
+		}
+
+		log.Printf("Failed over from %s to %s (latency: %dms)", previous, node.Name, node.Latency)
+		m.notify("proxy.failover", i18n.Sprintf("%s stopped responding, switched to %s.", previous, node.Name))
+		down = false
+		failures = 0
+	}
+}
+
+// notify shows a desktop notification about the proxy unless they are turned
+// off in the config, and posts the event to the webhooks configured for it
+func (m *Manager) notify(event, message string) {
+	m.sendWebhooks(event, message)
+	if !m.config.Proxy.HealthCheck.Notify {
+		return
+	}
+	if err := notify.Send("crosh", message); err != nil {
+		log.Printf("Notification not shown: %v", err)
+	}
+}
+
+// Failover switches the running proxy to the fastest node other than the
+// current one. The monitor runs beside crosh commands and the daemon, so it
+// takes the settings lock and reloads the config before switching, instead
+// of saving over their changes the config it started with.
+func (m *Manager) Failover() (*proxy.Node, error) {
+	if err := lock.Acquire(failoverLockWait); err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+	if err := m.reloadConfig(); err != nil {
+		return nil, err
+	}
+
+	sub, err := m.collectNodes()
+	if err != nil {
+		return nil, err
+	}
+
+	node, err := sub.SelectFastestNodeWith(m.xray.TestLatency, m.config.Proxy.CurrentNode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select node: %w", err)
+	}
+
+	if err := m.switchNode(node); err != nil {
+		return nil, err
+	}
+
+	return node, nil
+}
+
+// SwitchNode makes the running proxy use the named node. Like Failover it
+// takes the settings lock and reloads the config first, since the dashboard
+// and the daemon call it long after their config was loaded.
+func (m *Manager) SwitchNode(name string) (*proxy.Node, error) {
+	if err := lock.Acquire(switchLockWait); err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+	if err := m.reloadConfig(); err != nil {
+		return nil, err
+	}
+
+	if !m.xray.IsRunning() {
+		return nil, fmt.Errorf("proxy is not running")
+	}
+
+	node, err := m.FindNode(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.xray.EnsureSingBox([]proxy.Node{*node}); err != nil {
+		return nil, err
+	}
+
+	if err := m.switchNode(node); err != nil {
+		return nil, err
+	}
+
+	return node, nil
+}
+
+// RestartProxy restarts the proxy process with its current config
+func (m *Manager) RestartProxy() error {
+	if err := m.xray.Restart(); err != nil {
+		return fmt.Errorf("failed to restart proxy: %w", err)
+	}
+	return nil
+}
+
+// reloadConfig replaces the config with what config.yaml holds now
+func (m *Manager) reloadConfig() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to reload config: %w", err)
+	}
+	*m.config = *cfg
+	return nil
+}
+
+// switchNode regenerates the Xray config for node and restarts Xray
+func (m *Manager) switchNode(node *proxy.Node) (err error) {
+	defer func() {
+		m.audit("node.switch", node.Name, []string{m.xray.ConfigPath()}, err)
+	}()
+
+	hookEnv := map[string]string{"CROSH_NODE": node.Name, "CROSH_PREVIOUS_NODE": m.config.Proxy.CurrentNode}
+	if err := m.runHooks("pre-node-switch", hookEnv); err != nil {
+		return err
+	}
+
+	if err := m.xray.GenerateConfig(node); err != nil {
+		return fmt.Errorf("failed to generate Xray config: %w", err)
+	}
+
+	if err := m.xray.Stop(); err != nil {
+		return fmt.Errorf("failed to stop Xray: %w", err)
+	}
+
+	if err := m.xray.Start(); err != nil {
+		return fmt.Errorf("failed to start Xray: %w", err)
+	}
+
+	m.config.Proxy.CurrentNode = node.Name
+	if err := m.config.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	m.runHooks("post-node-switch", hookEnv)
+	return nil
+}
@@ -0,0 +1,184 @@
+package accelerator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/boomyao/crosh/internal/config"
+	"github.com/boomyao/crosh/internal/i18n"
+	"github.com/boomyao/crosh/internal/logging"
+	"github.com/boomyao/crosh/internal/notify"
+)
+
+// defaultHookTimeout bounds how long a hook may run
+const defaultHookTimeout = 60 * time.Second
+
+// ConfirmHook, when set, asks the user whether to run a hook that doesn't
+// come from their own config.yaml. Without it such hooks are skipped until
+// confirmed from a terminal.
+var ConfirmHook func(hook config.HookConfig) bool
+
+// runHooks runs the hooks configured for "pre-<operation>" or
+// "post-<operation>". Pre hooks return an error so the operation can be
+// cancelled; post hook failures are only printed.
+func (m *Manager) runHooks(event string, env map[string]string) error {
+	for _, hook := range m.config.Hooks {
+		if hook.On != event {
+			continue
+		}
+		if !hookConfirmed(hook) {
+			logging.Debug("skipping unconfirmed hook", "event", event, "run", hook.Run, "source", hook.Source)
+			i18n.Fprintf(m.output(), "⚠ Skipping the %s hook %q from %s, run crosh from a terminal to confirm it\n", event, hook.Run, hook.Source)
+			continue
+		}
+
+		logging.Debug("running hook", "event", event, "run", hook.Run)
+		err := m.runHook(hook.Run, hook.Timeout, event, env)
+		m.audit("hook."+event, hook.Run, nil, err)
+		if err == nil {
+			continue
+		}
+		if strings.HasPrefix(event, "pre-") {
+			return fmt.Errorf("%s hook %q failed: %w", event, hook.Run, err)
+		}
+		fmt.Fprintf(m.output(), "⚠ %s hook %q failed: %v\n", event, hook.Run, err)
+	}
+	return nil
+}
+
+// confirmedHooksPath returns the file listing the hooks from outside
+// config.yaml the user confirmed, one hash a line
+func confirmedHooksPath() string {
+	return filepath.Join(config.StateDir(), "confirmed-hooks")
+}
+
+// hookHash identifies a hook by what it runs and when, so a changed command
+// has to be confirmed again
+func hookHash(hook config.HookConfig) string {
+	sum := sha256.Sum256([]byte(hook.On + "\x00" + hook.Run))
+	return hex.EncodeToString(sum[:])
+}
+
+// hookConfirmed checks if hook may run: it is in the user's own config.yaml,
+// or they confirmed it before or now through ConfirmHook
+func hookConfirmed(hook config.HookConfig) bool {
+	if hook.Source == "" {
+		return true
+	}
+
+	hash := hookHash(hook)
+	data, _ := os.ReadFile(confirmedHooksPath())
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == hash {
+			return true
+		}
+	}
+	if ConfirmHook == nil || !ConfirmHook(hook) {
+		return false
+	}
+
+	if err := os.MkdirAll(config.StateDir(), 0700); err == nil {
+		f, err := os.OpenFile(confirmedHooksPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err == nil {
+			fmt.Fprintln(f, hash)
+			err = f.Close()
+		}
+		if err != nil {
+			logging.Warn("failed to remember the confirmed hook", "error", err)
+		}
+	}
+	return true
+}
+
+// runHook runs one hook command through the shell with CROSH_* variables
+// describing the operation
+func (m *Manager) runHook(command string, timeoutSeconds int, event string, env map[string]string) error {
+	timeout := defaultHookTimeout
+	if timeoutSeconds > 0 {
+		timeout = time.Duration(timeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Stdout = m.output()
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"CROSH_EVENT="+event,
+		"CROSH_HTTP_PROXY="+m.xray.HTTPProxyURL(),
+		fmt.Sprintf("CROSH_SOCKS_PORT=%d", m.xray.SocksPort()),
+	)
+	for key, value := range env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("timed out after %s", timeout)
+		}
+		return err
+	}
+	return nil
+}
+
+// sendWebhooks posts an event to the webhooks configured for it. Like post
+// hooks, failures are only logged so an unreachable bot never blocks crosh.
+func (m *Manager) sendWebhooks(event, message string) {
+	for _, webhook := range m.config.Webhooks {
+		if len(webhook.Events) > 0 && !containsString(webhook.Events, event) {
+			continue
+		}
+		if err := notify.PostWebhook(webhook.URL, webhook.Format, event, message); err != nil {
+			logging.Warn("webhook failed", "event", event, "error", err)
+		}
+	}
+}
+
+// sendMirrorWebhook reports the tools whose mirror EnableMirrors or
+// DisableMirrors changed since started; wasEnabled holds the enabled tools
+// from before
+func (m *Manager) sendMirrorWebhook(enable bool, wasEnabled map[string]bool, started time.Time) {
+	var tools []string
+	for _, name := range config.MirrorToolNames {
+		state := m.config.Mirror.Tool(name)
+		switch {
+		case enable && state.Enabled && !state.Applied.Before(started):
+			tools = append(tools, name)
+		case !enable && wasEnabled[name] && !state.Enabled:
+			tools = append(tools, name)
+		}
+	}
+	if len(tools) == 0 {
+		return
+	}
+
+	if enable {
+		m.sendWebhooks("mirror.enable", i18n.Sprintf("Mirrors enabled: %s", strings.Join(tools, ", ")))
+	} else {
+		m.sendWebhooks("mirror.disable", i18n.Sprintf("Mirrors disabled: %s", strings.Join(tools, ", ")))
+	}
+}
+
+// enabledMirrors returns the tools whose mirror is enabled
+func (m *Manager) enabledMirrors() map[string]bool {
+	enabled := make(map[string]bool)
+	for _, name := range config.MirrorToolNames {
+		if m.config.Mirror.Tool(name).Enabled {
+			enabled[name] = true
+		}
+	}
+	return enabled
+}
@@ -0,0 +1,176 @@
+package accelerator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/boomyao/crosh/internal/logging"
+	"github.com/boomyao/crosh/internal/mirror"
+	"github.com/boomyao/crosh/internal/proxy"
+)
+
+// Global settings crosh points at the local proxy while it runs
+const (
+	settingGit      = "git"
+	settingPackages = "packages"
+	settingSystem   = "system"
+	settingDocker   = "docker"
+)
+
+// settingLabels are the display names of global settings
+var settingLabels = map[string]string{
+	settingGit:      "git",
+	settingPackages: "package manager",
+	settingSystem:   "system",
+	settingDocker:   "Docker daemon",
+}
+
+// appliedSettings records which global settings currently point at the local
+// proxy, so they can be undone if the proxy dies without a clean shutdown
+type appliedSettings struct {
+	Applied   map[string]bool `json:"applied"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// appliedSettingsPath returns the path of the applied settings record
+func (m *Manager) appliedSettingsPath() string {
+	return filepath.Join(m.xray.StateDir(), "applied.json")
+}
+
+// loadAppliedSettings reads the applied settings record
+func (m *Manager) loadAppliedSettings() *appliedSettings {
+	state := &appliedSettings{Applied: map[string]bool{}}
+	data, err := os.ReadFile(m.appliedSettingsPath())
+	if err != nil {
+		return state
+	}
+	json.Unmarshal(data, state)
+	if state.Applied == nil {
+		state.Applied = map[string]bool{}
+	}
+	return state
+}
+
+// settingFiles returns the files a global setting writes
+func settingFiles(setting string) []string {
+	switch setting {
+	case settingGit:
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			return []string{filepath.Join(homeDir, ".gitconfig")}
+		}
+	case settingPackages:
+		return mirror.ConfigFiles("packages")
+	case settingDocker:
+		return proxy.NewDockerProxy("").ConfigFiles()
+	}
+	return nil
+}
+
+// markApplied records whether a global setting currently points at the proxy
+func (m *Manager) markApplied(setting string, applied bool) {
+	action := ".release"
+	if applied {
+		action = ".apply"
+	}
+	m.audit(setting+"-proxy"+action, "", settingFiles(setting), nil)
+
+	state := m.loadAppliedSettings()
+	if applied {
+		state.Applied[setting] = true
+	} else {
+		delete(state.Applied, setting)
+	}
+
+	if len(state.Applied) == 0 {
+		os.Remove(m.appliedSettingsPath())
+		return
+	}
+
+	state.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return
+	}
+	os.MkdirAll(filepath.Dir(m.appliedSettingsPath()), 0755)
+	if err := os.WriteFile(m.appliedSettingsPath(), data, 0644); err != nil {
+		logging.Warn("failed to record applied proxy settings", "error", err)
+	}
+}
+
+// applyGlobalSettings points git, package managers, the Windows system
+// proxy and the Docker daemon at the proxy if the user enabled them
+func (m *Manager) applyGlobalSettings() {
+	if m.config.Proxy.Git.Enabled {
+		if err := m.gitProxy().Enable(); err != nil {
+			logging.Warn("failed to apply git proxy settings", "error", err)
+		} else {
+			m.markApplied(settingGit, true)
+		}
+	}
+
+	if m.config.Proxy.PackageManagers {
+		if err := m.applyPackageProxy(); err != nil {
+			logging.Warn("failed to apply package manager proxy settings", "error", err)
+		} else {
+			m.markApplied(settingPackages, true)
+		}
+	}
+
+	if m.config.Proxy.System.Enabled {
+		if err := m.systemProxy().Enable(); err != nil {
+			logging.Warn("failed to apply system proxy settings", "error", err)
+		} else {
+			m.markApplied(settingSystem, true)
+		}
+	}
+
+	if m.config.Proxy.Docker {
+		if err := m.applyDockerProxy(); err != nil {
+			logging.Warn("failed to apply Docker daemon proxy settings", "error", err)
+		} else {
+			m.markApplied(settingDocker, true)
+		}
+	}
+}
+
+// releaseGlobalSettings removes every recorded global setting, leaving the
+// user's preferences in config so they come back with the next start, and
+// returns the display names of the settings it removed
+func (m *Manager) releaseGlobalSettings() []string {
+	var released []string
+	for setting := range m.loadAppliedSettings().Applied {
+		var err error
+		switch setting {
+		case settingGit:
+			err = m.gitProxy().Disable()
+		case settingPackages:
+			err = m.packageProxy().Disable()
+		case settingSystem:
+			err = m.systemProxy().Disable()
+		case settingDocker:
+			err = m.dockerProxy().Disable()
+		}
+		if err != nil {
+			logging.Warn(fmt.Sprintf("failed to remove %s proxy settings", settingLabels[setting]), "error", err)
+			continue
+		}
+		m.markApplied(setting, false)
+		released = append(released, settingLabels[setting])
+	}
+	sort.Strings(released)
+	return released
+}
+
+// RecoverStaleSettings removes global proxy settings left behind by a proxy
+// that is no longer running (crash, kill, reboot), so git and package
+// managers don't keep pointing at a dead port. It returns the settings removed.
+func (m *Manager) RecoverStaleSettings() []string {
+	if len(m.loadAppliedSettings().Applied) == 0 || m.xray.IsRunning() {
+		return nil
+	}
+	return m.releaseGlobalSettings()
+}
@@ -1,23 +1,56 @@
 package accelerator
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
+	"os/exec"
 	"runtime"
+	"strings"
+	"time"
 
+	"github.com/boomyao/crosh/internal/benchcache"
 	"github.com/boomyao/crosh/internal/config"
+	"github.com/boomyao/crosh/internal/hint"
+	"github.com/boomyao/crosh/internal/i18n"
+	"github.com/boomyao/crosh/internal/logging"
 	"github.com/boomyao/crosh/internal/mirror"
 	"github.com/boomyao/crosh/internal/proxy"
+	"github.com/boomyao/crosh/internal/sysenv"
+	"github.com/boomyao/crosh/internal/userfile"
 )
 
 // Manager orchestrates mirror and proxy acceleration
 type Manager struct {
 	config *config.Config
 	xray   *proxy.XrayManager
+
+	measurements *benchcache.Cache // opened on first use, see benchCache
+	cacheOpened  bool
+
+	ctx context.Context
+	out io.Writer
 }
 
 // NewManager creates a new acceleration manager
 func NewManager(cfg *config.Config) *Manager {
 	xray := proxy.NewXrayManager(cfg.Proxy.XrayPath, cfg.Proxy.LocalPort)
+	xray.SetStateDir(config.StateDir())
+	xray.SetHTTPPort(cfg.Proxy.HTTPPort)
+	xray.SetStatsPort(cfg.Proxy.StatsPort)
+	xray.SetAllowLAN(cfg.Proxy.AllowLAN)
+	xray.SetLogLevel(cfg.Proxy.LogLevel)
+	xray.SetLatencyTest(proxy.LatencyTest{
+		Method:         cfg.Proxy.LatencyTest.Method,
+		URL:            cfg.Proxy.LatencyTest.URL,
+		ExpectedStatus: cfg.Proxy.LatencyTest.ExpectedStatus,
+		Timeout:        time.Duration(cfg.Proxy.LatencyTest.Timeout) * time.Second,
+	})
+	xray.SetDNS(dnsSettings(cfg.Proxy.DNS))
+	xray.SetBypass(cfg.Proxy.Bypass)
+	xray.SetUDP(cfg.Proxy.UDP.Enabled, cfg.Proxy.UDP.DisabledNodes)
+	xray.SetNodeOverrides(nodeOverrides(cfg.Proxy.NodeOverrides))
 
 	return &Manager{
 		config: cfg,
@@ -25,62 +58,110 @@ func NewManager(cfg *config.Config) *Manager {
 	}
 }
 
-// EnableMirrors enables all configured mirrors
+// SetContext sets the context that subscription fetches, downloads, node
+// tests and benchmarks run under, so an interrupt can cancel them
+func (m *Manager) SetContext(ctx context.Context) {
+	m.ctx = ctx
+	m.xray.SetContext(ctx)
+}
+
+// context returns the context set by SetContext, or context.Background
+func (m *Manager) context() context.Context {
+	if m.ctx == nil {
+		return context.Background()
+	}
+	return m.ctx
+}
+
+// SetOutput sends the progress of starting and stopping the proxy, and
+// hook output, to out instead of stdout
+func (m *Manager) SetOutput(out io.Writer) {
+	m.out = out
+	m.xray.SetOutput(out)
+}
+
+// output returns the writer set by SetOutput, or os.Stdout
+func (m *Manager) output() io.Writer {
+	if m.out == nil {
+		return os.Stdout
+	}
+	return m.out
+}
+
+// EnableMirrors enables all configured mirrors, recording in the config
+// which tools were enabled
 func (m *Manager) EnableMirrors() error {
-	if !m.config.Mirror.Enabled {
-		return fmt.Errorf("mirrors are not enabled in config")
+	if err := m.runHooks("pre-mirror-enable", nil); err != nil {
+		return err
 	}
+	defer userfile.Begin("mirror.enable").Done()
+	started := time.Now()
 
 	var errors []error
 
 	// Enable NPM mirror
 	if m.config.Mirror.NPM != "" {
 		npm := mirror.NewNPMMirror(m.config.Mirror.NPM)
-		if err := npm.Enable(); err != nil {
+		err := npm.Enable()
+		m.audit("mirror.enable", "npm "+m.config.Mirror.NPM, mirror.ConfigFiles("npm"), err)
+		if err != nil {
 			errors = append(errors, fmt.Errorf("NPM mirror: %w", err))
 		} else {
-			fmt.Println("✓ NPM mirror enabled:", m.config.Mirror.NPM)
+			m.config.Mirror.SetToolEnabled("npm", true)
+			i18n.Printf("✓ NPM mirror enabled: %s\n", m.config.Mirror.NPM)
 		}
 	}
 
 	// Enable Pip mirror
 	if m.config.Mirror.Pip != "" {
 		pip := mirror.NewPipMirror(m.config.Mirror.Pip)
-		if err := pip.Enable(); err != nil {
+		err := pip.Enable()
+		m.audit("mirror.enable", "pip "+m.config.Mirror.Pip, mirror.ConfigFiles("pip"), err)
+		if err != nil {
 			errors = append(errors, fmt.Errorf("Pip mirror: %w", err))
 		} else {
-			fmt.Println("✓ Pip mirror enabled:", m.config.Mirror.Pip)
+			m.config.Mirror.SetToolEnabled("pip", true)
+			i18n.Printf("✓ Pip mirror enabled: %s\n", m.config.Mirror.Pip)
 		}
 	}
 
 	// Enable Apt mirror (Linux only)
 	if m.config.Mirror.Apt != "" {
 		apt := mirror.NewAptMirror(m.config.Mirror.Apt)
-		if err := apt.Enable(); err != nil {
+		err := apt.Enable()
+		m.audit("mirror.enable", "apt "+m.config.Mirror.Apt, mirror.ConfigFiles("apt"), err)
+		if err != nil {
 			// Don't fail on apt error (might not be Linux)
-			fmt.Printf("⚠ Apt mirror skipped: %v\n", err)
+			i18n.Printf("⚠ Apt mirror skipped: %v\n", err)
 		} else {
-			fmt.Println("✓ Apt mirror enabled:", m.config.Mirror.Apt)
+			m.config.Mirror.SetToolEnabled("apt", true)
+			i18n.Printf("✓ Apt mirror enabled: %s\n", m.config.Mirror.Apt)
 		}
 	}
 
 	// Enable Cargo mirror
 	if m.config.Mirror.Cargo != "" {
 		cargo := mirror.NewCargoMirror(m.config.Mirror.Cargo)
-		if err := cargo.Enable(); err != nil {
+		err := cargo.Enable()
+		m.audit("mirror.enable", "cargo "+m.config.Mirror.Cargo, mirror.ConfigFiles("cargo"), err)
+		if err != nil {
 			errors = append(errors, fmt.Errorf("Cargo mirror: %w", err))
 		} else {
-			fmt.Println("✓ Cargo mirror enabled:", m.config.Mirror.Cargo)
+			m.config.Mirror.SetToolEnabled("cargo", true)
+			i18n.Printf("✓ Cargo mirror enabled: %s\n", m.config.Mirror.Cargo)
 		}
 	}
 
 	// Enable Go proxy
 	if m.config.Mirror.Go != "" {
 		goMirror := mirror.NewGoMirror(m.config.Mirror.Go)
-		if err := goMirror.Enable(); err != nil {
+		err := goMirror.Enable()
+		m.audit("mirror.enable", "go "+m.config.Mirror.Go, mirror.ConfigFiles("go"), err)
+		if err != nil {
 			errors = append(errors, fmt.Errorf("Go proxy: %w", err))
 		} else {
-			fmt.Println("✓ Go proxy enabled:", m.config.Mirror.Go)
+			m.config.Mirror.SetToolEnabled("go", true)
+			i18n.Printf("✓ Go proxy enabled: %s\n", m.config.Mirror.Go)
 		}
 	}
 
@@ -88,30 +169,36 @@ func (m *Manager) EnableMirrors() error {
 	dockerEnabled := false
 	if len(m.config.Mirror.Docker) > 0 {
 		dockerMirror := mirror.NewDockerMirror(m.config.Mirror.Docker)
-		if err := dockerMirror.Enable(); err != nil {
+		err := dockerMirror.Enable()
+		m.audit("mirror.enable", "docker "+strings.Join(m.config.Mirror.Docker, ","), mirror.ConfigFiles("docker"), err)
+		if err != nil {
 			errors = append(errors, fmt.Errorf("Docker mirror: %w", err))
 		} else {
 			dockerEnabled = true
+			m.config.Mirror.SetToolEnabled("docker", true)
 			// Format display string (remove https:// prefix for cleaner output)
 			displayRegistries := make([]string, len(m.config.Mirror.Docker))
 			for i, reg := range m.config.Mirror.Docker {
 				displayRegistries[i] = reg
 			}
-			fmt.Printf("✓ Docker mirror enabled: %s\n", displayRegistries[0])
+			i18n.Printf("✓ Docker mirror enabled: %s\n", displayRegistries[0])
 			if len(displayRegistries) > 1 {
 				for _, reg := range displayRegistries[1:] {
-					fmt.Printf("  Additional: %s\n", reg)
+					i18n.Printf("  Additional: %s\n", reg)
 				}
 			}
 		}
 	}
 
+	errors = append(errors, m.setWindowsMirrors(true)...)
+	m.sendMirrorWebhook(true, nil, started)
+
+	// Whatever did get enabled is in place, so post hooks run either way
+	m.runHooks("post-mirror-enable", nil)
+
 	if len(errors) > 0 {
-		fmt.Printf("\n%d errors occurred:\n", len(errors))
-		for _, err := range errors {
-			fmt.Printf("  - %v\n", err)
-		}
-		return fmt.Errorf("some mirrors failed to enable")
+		printMirrorErrors(errors)
+		return &mirrorErrors{action: "enable", errs: errors}
 	}
 
 	// Show Docker restart instructions if Docker was enabled
@@ -122,60 +209,186 @@ func (m *Manager) EnableMirrors() error {
 	return nil
 }
 
-// DisableMirrors disables all mirrors
+// mirrorHandler points a tool at its mirror and back
+type mirrorHandler interface {
+	Enable() error
+	Disable() error
+}
+
+// SetMirror enables or disables the mirror of a single tool, as the daemon
+// does when a tool is switched in config.yaml, recording it in the config
+func (m *Manager) SetMirror(tool string, enable bool) error {
+	var handler mirrorHandler
+	switch tool {
+	case "npm":
+		handler = mirror.NewNPMMirror(m.config.Mirror.NPM)
+	case "pip":
+		handler = mirror.NewPipMirror(m.config.Mirror.Pip)
+	case "apt":
+		handler = mirror.NewAptMirror(m.config.Mirror.Apt)
+	case "cargo":
+		handler = mirror.NewCargoMirror(m.config.Mirror.Cargo)
+	case "go":
+		handler = mirror.NewGoMirror(m.config.Mirror.Go)
+	case "docker":
+		handler = mirror.NewDockerMirror(m.config.Mirror.Docker)
+	default:
+		return fmt.Errorf("unknown mirror tool: %s (supported: %s)", tool, strings.Join(config.MirrorToolNames, ", "))
+	}
+
+	url := m.config.Mirror.URL(tool)
+	var err error
+	if enable {
+		if url == "" {
+			return fmt.Errorf("no %s mirror configured", tool)
+		}
+		defer userfile.Begin("mirror.enable", tool).Done()
+		err = handler.Enable()
+		m.audit("mirror.enable", tool+" "+url, mirror.ConfigFiles(tool), err)
+	} else {
+		defer userfile.Begin("mirror.disable", tool).Done()
+		err = handler.Disable()
+		m.audit("mirror.disable", tool, mirror.ConfigFiles(tool), err)
+	}
+	if err != nil {
+		return err
+	}
+	m.config.Mirror.SetToolEnabled(tool, enable)
+	return nil
+}
+
+// FinishOperation completes an operation that a killed crosh left half done,
+// as found in the journal, by running it again. Turning mirrors on and off
+// can be repeated safely; other operations can only be rolled back.
+func (m *Manager) FinishOperation(j *userfile.Journal) error {
+	if !CanFinish(j) {
+		return fmt.Errorf("%s can't be finished, only rolled back", j.Op)
+	}
+	enable := j.Op == "mirror.enable"
+	if len(j.Args) == 1 {
+		return m.SetMirror(j.Args[0], enable)
+	}
+	if enable {
+		return m.EnableMirrors()
+	}
+	return m.DisableMirrors()
+}
+
+// CanFinish checks if FinishOperation can complete the journal's operation
+func CanFinish(j *userfile.Journal) bool {
+	return j.Op == "mirror.enable" || j.Op == "mirror.disable"
+}
+
+// mirrorErrors reports that some mirrors failed to change while keeping each
+// failure reachable through errors.Is and errors.As
+type mirrorErrors struct {
+	action string
+	errs   []error
+}
+
+func (e *mirrorErrors) Error() string {
+	return "some mirrors failed to " + e.action
+}
+
+func (e *mirrorErrors) Unwrap() []error {
+	return e.errs
+}
+
+// printMirrorErrors lists the mirrors that failed to change and what to do
+// about each
+func printMirrorErrors(errs []error) {
+	i18n.Printf("\n%d errors occurred:\n", len(errs))
+	for _, err := range errs {
+		fmt.Printf("  - %v\n", err)
+		hint.Fprint(os.Stdout, "    ", err)
+	}
+}
+
+// DisableMirrors disables all mirrors, recording in the config which tools
+// were disabled
 func (m *Manager) DisableMirrors() error {
+	if err := m.runHooks("pre-mirror-disable", nil); err != nil {
+		return err
+	}
+	defer userfile.Begin("mirror.disable").Done()
+	wasEnabled := m.enabledMirrors()
+
 	var errors []error
 
 	// Disable NPM mirror
 	npm := mirror.NewNPMMirror("")
-	if err := npm.Disable(); err != nil {
+	err := npm.Disable()
+	m.audit("mirror.disable", "npm", mirror.ConfigFiles("npm"), err)
+	if err != nil {
 		errors = append(errors, fmt.Errorf("NPM mirror: %w", err))
 	} else {
-		fmt.Println("✓ NPM mirror disabled")
+		m.config.Mirror.SetToolEnabled("npm", false)
+		i18n.Println("✓ NPM mirror disabled")
 	}
 
 	// Disable Pip mirror
 	pip := mirror.NewPipMirror("")
-	if err := pip.Disable(); err != nil {
+	err = pip.Disable()
+	m.audit("mirror.disable", "pip", mirror.ConfigFiles("pip"), err)
+	if err != nil {
 		errors = append(errors, fmt.Errorf("Pip mirror: %w", err))
 	} else {
-		fmt.Println("✓ Pip mirror disabled")
+		m.config.Mirror.SetToolEnabled("pip", false)
+		i18n.Println("✓ Pip mirror disabled")
 	}
 
 	// Disable Apt mirror
 	apt := mirror.NewAptMirror("")
-	if err := apt.Disable(); err != nil {
-		fmt.Printf("⚠ Apt mirror skipped: %v\n", err)
+	err = apt.Disable()
+	m.audit("mirror.disable", "apt", mirror.ConfigFiles("apt"), err)
+	if err != nil {
+		i18n.Printf("⚠ Apt mirror skipped: %v\n", err)
 	} else {
-		fmt.Println("✓ Apt mirror disabled")
+		m.config.Mirror.SetToolEnabled("apt", false)
+		i18n.Println("✓ Apt mirror disabled")
 	}
 
 	// Disable Cargo mirror
 	cargo := mirror.NewCargoMirror("")
-	if err := cargo.Disable(); err != nil {
+	err = cargo.Disable()
+	m.audit("mirror.disable", "cargo", mirror.ConfigFiles("cargo"), err)
+	if err != nil {
 		errors = append(errors, fmt.Errorf("Cargo mirror: %w", err))
 	} else {
-		fmt.Println("✓ Cargo mirror disabled")
+		m.config.Mirror.SetToolEnabled("cargo", false)
+		i18n.Println("✓ Cargo mirror disabled")
 	}
 
 	// Disable Go proxy
 	goMirror := mirror.NewGoMirror("")
-	if err := goMirror.Disable(); err != nil {
+	err = goMirror.Disable()
+	m.audit("mirror.disable", "go", mirror.ConfigFiles("go"), err)
+	if err != nil {
 		errors = append(errors, fmt.Errorf("Go proxy: %w", err))
 	} else {
-		fmt.Println("✓ Go proxy disabled")
+		m.config.Mirror.SetToolEnabled("go", false)
+		i18n.Println("✓ Go proxy disabled")
 	}
 
 	// Disable Docker registry mirrors
 	dockerMirror := mirror.NewDockerMirror(nil)
-	if err := dockerMirror.Disable(); err != nil {
+	err = dockerMirror.Disable()
+	m.audit("mirror.disable", "docker", mirror.ConfigFiles("docker"), err)
+	if err != nil {
 		errors = append(errors, fmt.Errorf("Docker mirror: %w", err))
 	} else {
-		fmt.Println("✓ Docker mirror disabled")
+		m.config.Mirror.SetToolEnabled("docker", false)
+		i18n.Println("✓ Docker mirror disabled")
 	}
 
+	errors = append(errors, m.setWindowsMirrors(false)...)
+	m.sendMirrorWebhook(false, wasEnabled, time.Time{})
+
+	m.runHooks("post-mirror-disable", nil)
+
 	if len(errors) > 0 {
-		return fmt.Errorf("some mirrors failed to disable")
+		printMirrorErrors(errors)
+		return &mirrorErrors{action: "disable", errs: errors}
 	}
 
 	return nil
@@ -260,67 +473,189 @@ func (m *Manager) EnableProxy() error {
 		return fmt.Errorf("proxy is not enabled in config")
 	}
 
-	if m.config.Proxy.SubscriptionURL == "" {
-		return fmt.Errorf("no subscription URL configured")
+	if !m.HasProxySource() {
+		return fmt.Errorf("no subscription URL or manual nodes configured")
+	}
+
+	if err := m.startProxy(true); err != nil {
+		return err
+	}
+
+	if err := m.StartHealthMonitor(); err != nil {
+		logging.Warn("failed to start health monitor", "error", err)
+	}
+
+	// Print proxy environment variables
+	i18n.Println("\nTo use the proxy, set these environment variables:")
+	envVars := m.xray.GetProxyEnvVars()
+	for key, value := range envVars {
+		fmt.Printf("  export %s=%s\n", key, value)
 	}
+	m.WarnExistingProxies(os.Stdout)
 
+	return nil
+}
+
+// WarnExistingProxies tells that crosh's proxy variables would replace those
+// of another proxy in the environment, e.g. a corporate one
+func (m *Manager) WarnExistingProxies(w io.Writer) {
+	own := []string{
+		fmt.Sprintf("127.0.0.1:%d", m.xray.HTTPPort()),
+		strings.TrimPrefix(m.xray.SocksProxyURL(), "socks5://"),
+	}
+	var names, values []string
+	for _, existing := range mirror.ExistingProxies(own...) {
+		if existing.Tool != "env" {
+			continue
+		}
+		names = append(names, existing.Source)
+		if !containsString(values, existing.Value) {
+			values = append(values, existing.Value)
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+	i18n.Fprintf(w, "\n⚠ %s already set to %s by other tooling (e.g. a corporate proxy)\n", strings.Join(names, ", "), strings.Join(values, ", "))
+	i18n.Fprintln(w, "  crosh's variables replace it and crosh's proxy connects directly; NO_PROXY keeps its hosts")
+}
+
+// StartTemporaryProxy starts the proxy without marking it enabled in config
+// or saving the node it picked, leaving config.yaml alone. It returns false
+// if the proxy was already running, in which case the caller must not stop
+// it afterwards. Its progress goes to out, as does StopTemporaryProxy's.
+func (m *Manager) StartTemporaryProxy(out io.Writer) (bool, error) {
+	m.SetOutput(out)
+	if m.xray.IsRunning() {
+		return false, nil
+	}
+
+	if m.HasProxySource() {
+		if err := m.startProxy(false); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	// Fall back to the last generated config (e.g. from a local YAML file)
+	if !m.xray.HasConfig() {
+		return false, fmt.Errorf("no proxy configured, run: crosh https://your-subscription-url")
+	}
+	if err := m.xray.Start(); err != nil {
+		return false, fmt.Errorf("failed to start Xray: %w", err)
+	}
+
+	return true, nil
+}
+
+// StopTemporaryProxy stops a proxy started by StartTemporaryProxy, again
+// without saving the config, printing to the same writer
+func (m *Manager) StopTemporaryProxy() error {
+	return m.stopProxy(false)
+}
+
+// startProxy fetches the subscription, selects the fastest node and starts
+// Xray. With save the node is recorded as proxy.current_node in config.yaml.
+func (m *Manager) startProxy(save bool) error {
 	// Download Xray if needed
 	if err := m.xray.Download(); err != nil {
 		return fmt.Errorf("failed to download Xray: %w", err)
 	}
 
-	// Fetch subscription
-	fmt.Println("Fetching subscription...")
-	sub, err := proxy.FetchSubscription(m.config.Proxy.SubscriptionURL)
+	// Fetch subscription and merge manual nodes
+	i18n.Fprintln(m.output(), "Fetching subscription...")
+	sub, err := m.collectNodes()
 	if err != nil {
-		return fmt.Errorf("failed to fetch subscription: %w", err)
+		return err
 	}
 
-	fmt.Printf("Found %d nodes in subscription\n", len(sub.Nodes))
+	i18n.Fprintf(m.output(), "Found %d nodes\n", len(sub.Nodes))
 
 	// Select fastest node
-	fmt.Println("Testing node latency...")
-	node, err := sub.SelectFastestNode()
+	if method := m.xray.LatencyTest().Method; !proxy.ValidLatencyMethod(method) {
+		return fmt.Errorf("invalid proxy.latency_test.method %q (expected tcp or http)", method)
+	}
+	i18n.Fprintf(m.output(), "Testing node latency (%s)...\n", m.xray.LatencyTest().Method)
+	node, err := sub.SelectFastestNodeWith(m.cachedLatency())
+	m.saveBenchCache()
 	if err != nil {
 		return fmt.Errorf("failed to select node: %w", err)
 	}
 
-	fmt.Printf("Selected node: %s (latency: %dms)\n", node.Name, node.Latency)
+	i18n.Fprintf(m.output(), "Selected node: %s (latency: %dms)\n", node.Name, node.Latency)
 
 	// Generate Xray config
 	if err := m.xray.GenerateConfig(node); err != nil {
 		return fmt.Errorf("failed to generate Xray config: %w", err)
 	}
 
+	hookEnv := map[string]string{"CROSH_NODE": node.Name}
+	if err := m.runHooks("pre-proxy-start", hookEnv); err != nil {
+		return err
+	}
+
 	// Start Xray
-	if err := m.xray.Start(); err != nil {
+	err = m.xray.Start()
+	m.audit("proxy.start", node.Name, []string{m.xray.ConfigPath()}, err)
+	if err != nil {
 		return fmt.Errorf("failed to start Xray: %w", err)
 	}
 
+	m.applyGlobalSettings()
+
 	// Update config with current node
 	m.config.Proxy.CurrentNode = node.Name
-	if err := m.config.Save(); err != nil {
-		fmt.Printf("Warning: failed to save config: %v\n", err)
+	if save {
+		if err := m.config.Save(); err != nil {
+			logging.Warn("failed to save config", "error", err)
+		}
 	}
 
-	// Print proxy environment variables
-	fmt.Println("\nTo use the proxy, set these environment variables:")
-	envVars := m.xray.GetProxyEnvVars()
-	for key, value := range envVars {
-		fmt.Printf("  export %s=%s\n", key, value)
-	}
+	m.runHooks("post-proxy-start", hookEnv)
 
 	return nil
 }
 
 // DisableProxy stops the proxy
 func (m *Manager) DisableProxy() error {
-	if err := m.xray.Stop(); err != nil {
+	return m.stopProxy(true)
+}
+
+// stopProxy stops the proxy, and with save clears proxy.current_node in
+// config.yaml
+func (m *Manager) stopProxy(save bool) error {
+	wasRunning := m.xray.IsRunning()
+	hookEnv := map[string]string{"CROSH_NODE": m.config.Proxy.CurrentNode}
+	if wasRunning {
+		if err := m.runHooks("pre-proxy-stop", hookEnv); err != nil {
+			return err
+		}
+	}
+
+	if err := m.StopHealthMonitor(); err != nil {
+		logging.Warn("failed to stop health monitor", "error", err)
+	}
+
+	err := m.xray.Stop()
+	if wasRunning || err != nil {
+		m.audit("proxy.stop", m.config.Proxy.CurrentNode, nil, err)
+	}
+	if err != nil {
 		return err
 	}
 
+	// Git would fail against a stopped proxy; the preference stays in config
+	// so the settings come back with the next EnableProxy
+	m.releaseGlobalSettings()
+
 	m.config.Proxy.CurrentNode = ""
-	m.config.Save()
+	if save {
+		m.config.Save()
+	}
+
+	if wasRunning {
+		m.runHooks("post-proxy-stop", hookEnv)
+	}
 
 	return nil
 }
@@ -328,34 +663,443 @@ func (m *Manager) DisableProxy() error {
 // GetProxyStatus returns the proxy status
 func (m *Manager) GetProxyStatus() string {
 	if m.xray.IsRunning() {
-		return fmt.Sprintf("running (port %d, node: %s)", m.config.Proxy.LocalPort, m.config.Proxy.CurrentNode)
+		return fmt.Sprintf("running (socks5 %d, http %d, node: %s)", m.xray.SocksPort(), m.xray.HTTPPort(), m.config.Proxy.CurrentNode)
 	}
 	return "stopped"
 }
 
+// EnableGitProxy routes git remotes through the proxy and remembers the choice
+func (m *Manager) EnableGitProxy(hosts []string, ssh bool) error {
+	m.config.Proxy.Git = config.GitProxyConfig{
+		Enabled: true,
+		Hosts:   hosts,
+		SSH:     ssh,
+	}
+
+	// Pointing git at a stopped proxy would break it; the settings are
+	// applied with the next start instead
+	if m.xray.IsRunning() {
+		if err := m.gitProxy().Enable(); err != nil {
+			return err
+		}
+		m.markApplied(settingGit, true)
+	}
+
+	return m.config.Save()
+}
+
+// DisableGitProxy removes git proxy settings and forgets the choice
+func (m *Manager) DisableGitProxy() error {
+	if err := m.gitProxy().Disable(); err != nil {
+		return err
+	}
+	m.markApplied(settingGit, false)
+
+	m.config.Proxy.Git.Enabled = false
+	return m.config.Save()
+}
+
+// GetGitProxyStatus returns the git proxy status
+func (m *Manager) GetGitProxyStatus() (bool, string, error) {
+	return m.gitProxy().Status()
+}
+
+// gitProxy creates the git proxy handler from config
+func (m *Manager) gitProxy() *proxy.GitProxy {
+	return proxy.NewGitProxy(m.config.Proxy.LocalPort, m.config.Proxy.Git.Hosts, m.config.Proxy.Git.SSH)
+}
+
+// EnableSystemProxy points the Windows system proxy at the local HTTP proxy
+// and remembers the choice so it is reapplied whenever the proxy starts
+func (m *Manager) EnableSystemProxy(winHTTP bool) error {
+	if runtime.GOOS != "windows" {
+		return fmt.Errorf("system proxy is only supported on Windows")
+	}
+
+	// A previous run may have set WinHTTP as well; put everything back first
+	// so the saved settings stay the user's own
+	if winHTTP != m.config.Proxy.System.WinHTTP {
+		if err := m.systemProxy().Disable(); err != nil {
+			return err
+		}
+		m.markApplied(settingSystem, false)
+	}
+	m.config.Proxy.System = config.SystemProxyConfig{
+		Enabled: true,
+		WinHTTP: winHTTP,
+	}
+
+	if m.xray.IsRunning() {
+		if err := m.systemProxy().Enable(); err != nil {
+			return err
+		}
+		m.markApplied(settingSystem, true)
+	}
+
+	return m.config.Save()
+}
+
+// DisableSystemProxy restores the system proxy settings crosh replaced
+func (m *Manager) DisableSystemProxy() error {
+	if err := m.systemProxy().Disable(); err != nil {
+		return err
+	}
+	m.markApplied(settingSystem, false)
+
+	m.config.Proxy.System.Enabled = false
+	return m.config.Save()
+}
+
+// GetSystemProxyStatus returns the system proxy status
+func (m *Manager) GetSystemProxyStatus() (bool, string, error) {
+	return m.systemProxy().Status()
+}
+
+// systemProxy creates the system proxy handler from config
+func (m *Manager) systemProxy() *proxy.SystemProxy {
+	server := fmt.Sprintf("127.0.0.1:%d", m.xray.HTTPPort())
+	return proxy.NewSystemProxy(server, m.config.Proxy.System.WinHTTP, m.xray.StateDir())
+}
+
+// EnablePackageProxy writes the proxy into package manager configs and
+// remembers the choice so it is reapplied whenever the proxy starts
+func (m *Manager) EnablePackageProxy() error {
+	m.config.Proxy.PackageManagers = true
+
+	if m.xray.IsRunning() {
+		if err := m.applyPackageProxy(); err != nil {
+			return err
+		}
+		m.markApplied(settingPackages, true)
+	}
+
+	return m.config.Save()
+}
+
+// applyPackageProxy writes the proxy into package manager configs and tells
+// which ones kept a proxy set by other tooling
+func (m *Manager) applyPackageProxy() error {
+	packageProxy := m.packageProxy()
+	err := packageProxy.Enable()
+	for _, kept := range packageProxy.Kept() {
+		i18n.Fprintf(m.output(), "⚠ %s already uses the proxy %s (%s), left unchanged\n", kept.Tool, kept.Value, kept.Source)
+	}
+	return err
+}
+
+// DisablePackageProxy removes the proxy from package manager configs
+func (m *Manager) DisablePackageProxy() error {
+	if err := m.packageProxy().Disable(); err != nil {
+		return err
+	}
+	m.markApplied(settingPackages, false)
+
+	m.config.Proxy.PackageManagers = false
+	return m.config.Save()
+}
+
+// GetPackageProxyStatus returns which package managers use the proxy
+func (m *Manager) GetPackageProxyStatus() (bool, string, error) {
+	return m.packageProxy().Status()
+}
+
+// packageProxy creates the package manager proxy handler
+func (m *Manager) packageProxy() *mirror.PackageProxy {
+	packageProxy := mirror.NewPackageProxy(m.xray.HTTPProxyURL())
+	packageProxy.SetWindowsSide(m.config.WSL.Windows)
+	return packageProxy
+}
+
+// EnableDockerProxy points the Docker daemon at the local HTTP proxy and
+// remembers the choice so it is reapplied whenever the proxy starts
+func (m *Manager) EnableDockerProxy() error {
+	dockerProxy := m.dockerProxy()
+	if len(dockerProxy.ConfigFiles()) == 0 {
+		// Docker Desktop is set up by hand; Enable explains how
+		return dockerProxy.Enable()
+	}
+
+	m.config.Proxy.Docker = true
+
+	// A drop-in pointing at a stopped proxy would break pulls after the next
+	// Docker restart; it is written with the next start instead
+	if m.xray.IsRunning() {
+		if err := m.applyDockerProxy(); err != nil {
+			return err
+		}
+		m.markApplied(settingDocker, true)
+		i18n.Printf("✓ Docker daemon proxy set to %s\n", m.xray.HTTPProxyURL())
+		m.printDockerRestartInstructions()
+	} else {
+		i18n.Println("✓ Docker daemon proxy will be set when the proxy starts")
+	}
+
+	return m.config.Save()
+}
+
+// applyDockerProxy writes the Docker daemon drop-in
+func (m *Manager) applyDockerProxy() error {
+	dockerProxy := m.dockerProxy()
+	err := dockerProxy.Enable()
+	m.audit("docker-proxy.enable", m.xray.HTTPProxyURL(), dockerProxy.ConfigFiles(), err)
+	return err
+}
+
+// DisableDockerProxy removes the Docker daemon proxy configuration and
+// forgets the choice
+func (m *Manager) DisableDockerProxy() error {
+	dockerProxy := m.dockerProxy()
+	err := dockerProxy.Disable()
+	m.audit("docker-proxy.disable", "", dockerProxy.ConfigFiles(), err)
+	if err != nil {
+		return err
+	}
+	if len(dockerProxy.ConfigFiles()) == 0 {
+		return nil
+	}
+	m.markApplied(settingDocker, false)
+
+	m.config.Proxy.Docker = false
+	if err := m.config.Save(); err != nil {
+		return err
+	}
+
+	i18n.Println("✓ Docker daemon proxy removed")
+	m.printDockerRestartInstructions()
+	return nil
+}
+
+// dockerProxy creates the Docker daemon proxy handler
+func (m *Manager) dockerProxy() *proxy.DockerProxy {
+	dockerProxy := proxy.NewDockerProxy(m.xray.HTTPProxyURL())
+	dockerProxy.SetOutput(m.output())
+	return dockerProxy
+}
+
+// GetDockerProxyStatus returns the Docker daemon proxy status
+func (m *Manager) GetDockerProxyStatus() (bool, string, error) {
+	return m.dockerProxy().Status()
+}
+
+// SetAllowLAN toggles LAN access and applies it to a running proxy
+func (m *Manager) SetAllowLAN(allow bool) error {
+	m.config.Proxy.AllowLAN = allow
+	m.xray.SetAllowLAN(allow)
+	if err := m.config.Save(); err != nil {
+		return err
+	}
+
+	return m.ApplyProxySettings()
+}
+
+// SetDNS enables or disables DoH resolution and fake-ip mode, then applies
+// the change to the running proxy
+func (m *Manager) SetDNS(enabled, fakeIP bool) error {
+	m.config.Proxy.DNS.Enabled = enabled
+	m.config.Proxy.DNS.FakeIP = fakeIP
+	m.xray.SetDNS(dnsSettings(m.config.Proxy.DNS))
+	if err := m.config.Save(); err != nil {
+		return err
+	}
+
+	return m.ApplyProxySettings()
+}
+
+// SetUDP enables or disables UDP relay, for all nodes or just the named one,
+// then applies the change to the running proxy
+func (m *Manager) SetUDP(enabled bool, node string) error {
+	udp := &m.config.Proxy.UDP
+	if node == "" {
+		udp.Enabled = enabled
+	} else {
+		disabled := udp.DisabledNodes[:0]
+		for _, name := range udp.DisabledNodes {
+			if name != node {
+				disabled = append(disabled, name)
+			}
+		}
+		if !enabled {
+			disabled = append(disabled, node)
+		}
+		udp.DisabledNodes = disabled
+	}
+
+	m.xray.SetUDP(udp.Enabled, udp.DisabledNodes)
+	if err := m.config.Save(); err != nil {
+		return err
+	}
+
+	return m.ApplyProxySettings()
+}
+
+// AddBypass adds domains or IPs to the direct-routing list and applies it
+func (m *Manager) AddBypass(entries []string) ([]string, error) {
+	var added []string
+	for _, entry := range entries {
+		entry = proxy.NormalizeBypass(entry)
+		if entry == "" || containsString(m.config.Proxy.Bypass, entry) {
+			continue
+		}
+		m.config.Proxy.Bypass = append(m.config.Proxy.Bypass, entry)
+		added = append(added, entry)
+	}
+
+	if len(added) == 0 {
+		return nil, nil
+	}
+
+	return added, m.saveBypass()
+}
+
+// RemoveBypass removes an entry from the direct-routing list and applies it
+func (m *Manager) RemoveBypass(entry string) error {
+	entry = proxy.NormalizeBypass(entry)
+
+	kept := m.config.Proxy.Bypass[:0]
+	for _, existing := range m.config.Proxy.Bypass {
+		if existing != entry {
+			kept = append(kept, existing)
+		}
+	}
+	if len(kept) == len(m.config.Proxy.Bypass) {
+		return fmt.Errorf("%s is not in the bypass list", entry)
+	}
+	m.config.Proxy.Bypass = kept
+
+	return m.saveBypass()
+}
+
+// saveBypass persists the bypass list and regenerates the proxy config
+func (m *Manager) saveBypass() error {
+	m.xray.SetBypass(m.config.Proxy.Bypass)
+	if err := m.config.Save(); err != nil {
+		return err
+	}
+	return m.ApplyProxySettings()
+}
+
+// containsString checks if list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// dnsSettings converts the DNS config into Xray settings
+func dnsSettings(dns config.DNSConfig) proxy.DNSSettings {
+	return proxy.DNSSettings{
+		Enabled:     dns.Enabled,
+		Remote:      dns.Remote,
+		Domestic:    dns.Domestic,
+		FakeIP:      dns.FakeIP,
+		FakeIPRange: dns.FakeIPRange,
+	}
+}
+
+// nodeOverrides converts the per-node overrides from config.yaml
+func nodeOverrides(overrides []config.NodeOverride) []proxy.NodeOverride {
+	result := make([]proxy.NodeOverride, 0, len(overrides))
+	for _, o := range overrides {
+		result = append(result, proxy.NodeOverride{
+			Match:       o.Match,
+			Mux:         o.Mux,
+			Fingerprint: o.Fingerprint,
+			ALPN:        strings.Join(o.ALPN, ","),
+			SNI:         o.SNI,
+		})
+	}
+	return result
+}
+
+// ApplyProxySettings regenerates the Xray config from the current node and
+// restarts Xray if it is running, so changed settings take effect
+func (m *Manager) ApplyProxySettings() error {
+	if !m.xray.HasConfig() {
+		return nil
+	}
+
+	if err := m.xray.RegenerateConfig(); err != nil {
+		return fmt.Errorf("failed to regenerate Xray config: %w", err)
+	}
+
+	if !m.xray.IsRunning() {
+		return nil
+	}
+
+	if err := m.xray.Restart(); err != nil {
+		return fmt.Errorf("failed to restart Xray: %w", err)
+	}
+
+	return nil
+}
+
+// ReloadProxySettings regenerates the Xray config and restarts Xray if it
+// is running, but only when the settings changed since the config was
+// generated, and reports whether they had
+func (m *Manager) ReloadProxySettings() (bool, error) {
+	if !m.xray.HasConfig() {
+		return false, nil
+	}
+	outdated, err := m.xray.ConfigOutdated()
+	if err != nil || !outdated {
+		return false, err
+	}
+	return true, m.ApplyProxySettings()
+}
+
+// UpdateGeoData re-downloads the routing geo data and restarts the proxy so it
+// loads the new files
+func (m *Manager) UpdateGeoData() error {
+	if err := m.xray.UpdateGeoData(); err != nil {
+		return err
+	}
+
+	if !m.xray.IsRunning() {
+		return nil
+	}
+
+	if err := m.xray.Restart(); err != nil {
+		return fmt.Errorf("failed to restart Xray: %w", err)
+	}
+
+	return nil
+}
+
 // GetXrayManager returns the Xray manager instance
 func (m *Manager) GetXrayManager() *proxy.XrayManager {
 	return m.xray
 }
 
-// printDockerRestartInstructions prints instructions for restarting Docker daemon
+// printDockerRestartInstructions prints instructions for restarting Docker
+// daemon, unless nobody is there to follow them, as in a container build
 func (m *Manager) printDockerRestartInstructions() {
+	if sysenv.Unattended() {
+		return
+	}
 	fmt.Println()
-	fmt.Println("⚠ Docker daemon restart required to apply changes:")
+	i18n.Println("⚠ Docker daemon restart required to apply changes:")
 	fmt.Println()
 
 	// Detect OS and show appropriate restart instructions
 	if runtime.GOOS == "darwin" {
-		fmt.Println("  macOS (Docker Desktop):")
+		i18n.Println("  macOS (Docker Desktop):")
 		fmt.Println("    killall Docker && open -a Docker")
 	} else if runtime.GOOS == "linux" {
-		fmt.Println("  Linux:")
-		fmt.Println("    sudo systemctl restart docker")
+		i18n.Println("  Linux:")
+		if _, err := exec.LookPath("systemctl"); err != nil {
+			// OpenRC, e.g. on Alpine
+			fmt.Printf("    %s rc-service docker restart\n", sysenv.SudoCommand(m.config.Sudo))
+		} else {
+			fmt.Printf("    %s systemctl restart docker\n", sysenv.SudoCommand(m.config.Sudo))
+		}
 	} else {
 		// Windows or other
-		fmt.Println("  Restart Docker Desktop from the system tray")
+		i18n.Println("  Restart Docker Desktop from the system tray")
 	}
 
 	fmt.Println()
-	fmt.Println("After restart, test with: docker pull nginx:alpine")
+	i18n.Println("After restart, test with: docker pull nginx:alpine")
 }
@@ -0,0 +1,92 @@
+package accelerator
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// netWatchInterval is how often the health monitor looks for wake-ups and
+// network changes, much more often than the health probe itself
+const netWatchInterval = 5 * time.Second
+
+// sleepThreshold is how far the wall clock may run ahead of a watch tick
+// before we assume the machine was suspended
+const sleepThreshold = 30 * time.Second
+
+// reconnectSettleDelay gives a restarted proxy and a freshly joined network
+// a moment before the health check runs
+const reconnectSettleDelay = 3 * time.Second
+
+// networkWatcher detects resume from sleep and interface address changes,
+// which silently kill the proxy's upstream connections (e.g. macOS sleep,
+// switching Wi-Fi networks, VPNs coming up)
+type networkWatcher struct {
+	lastTick time.Time
+	addrs    string
+}
+
+// newNetworkWatcher records the current clock and network state
+func newNetworkWatcher() *networkWatcher {
+	return &networkWatcher{
+		lastTick: wallClock(),
+		addrs:    interfaceFingerprint(),
+	}
+}
+
+// check returns why the proxy should reconnect since the last call, or ""
+func (w *networkWatcher) check() string {
+	now := wallClock()
+	gap := now.Sub(w.lastTick)
+	w.lastTick = now
+
+	addrs := interfaceFingerprint()
+	changed := addrs != w.addrs
+	w.addrs = addrs
+
+	switch {
+	case gap > netWatchInterval+sleepThreshold:
+		return "System resumed from sleep (" + gap.Round(time.Second).String() + " gap)"
+	case changed:
+		return "Network interfaces changed"
+	default:
+		return ""
+	}
+}
+
+// wallClock returns the current time without its monotonic reading, since
+// the monotonic clock stops while the machine sleeps
+func wallClock() time.Time {
+	return time.Now().Round(0)
+}
+
+// interfaceFingerprint lists the addresses of all active non-loopback interfaces
+func interfaceFingerprint() string {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return ""
+	}
+
+	var addrs []string
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		ifaceAddrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range ifaceAddrs {
+			ipnet, ok := addr.(*net.IPNet)
+			// Link-local IPv6 addresses come and go without affecting connectivity
+			if !ok || ipnet.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			addrs = append(addrs, iface.Name+"="+ipnet.String())
+		}
+	}
+
+	sort.Strings(addrs)
+	return strings.Join(addrs, ",")
+}
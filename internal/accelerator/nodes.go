@@ -0,0 +1,200 @@
+package accelerator
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/boomyao/crosh/internal/logging"
+	"github.com/boomyao/crosh/internal/proxy"
+)
+
+// nodeStorePath returns the path of the manual node store
+func (m *Manager) nodeStorePath() string {
+	return filepath.Join(filepath.Dir(m.config.Proxy.XrayPath), "nodes.json")
+}
+
+// loadNodeStore loads the manual node store
+func (m *Manager) loadNodeStore() (*proxy.NodeStore, error) {
+	return proxy.LoadNodeStore(m.nodeStorePath())
+}
+
+// HasProxySource checks if a subscription or manual nodes are configured
+func (m *Manager) HasProxySource() bool {
+	if m.config.Proxy.SubscriptionURL != "" {
+		return true
+	}
+	store, err := m.loadNodeStore()
+	return err == nil && len(store.Nodes) > 0
+}
+
+// AddNodes parses share links and adds them to the manual node store
+func (m *Manager) AddNodes(links []string) ([]proxy.Node, error) {
+	store, err := m.loadNodeStore()
+	if err != nil {
+		return nil, err
+	}
+
+	var added []proxy.Node
+	for i, link := range links {
+		node, err := proxy.ParseShareLink(link)
+		if err != nil {
+			return nil, fmt.Errorf("invalid share link %s: %w", describeLink(i, link), err)
+		}
+		store.Add(node)
+		added = append(added, *store.Find(nodeName(node)))
+	}
+
+	if err := store.Save(); err != nil {
+		return nil, err
+	}
+
+	return added, nil
+}
+
+// describeLink names the i-th share link for errors by its position and
+// scheme only, since the link carries the node's password or UUID
+func describeLink(i int, link string) string {
+	if scheme, _, ok := strings.Cut(strings.TrimSpace(link), "://"); ok {
+		return fmt.Sprintf("%d (%s://…)", i+1, scheme)
+	}
+	return strconv.Itoa(i + 1)
+}
+
+// ImportNodes adds all nodes from a Clash config or v2rayN export to the
+// manual node store
+func (m *Manager) ImportNodes(filePath string) ([]proxy.Node, error) {
+	nodes, err := proxy.ParseNodesFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := m.loadNodeStore()
+	if err != nil {
+		return nil, err
+	}
+
+	var added []proxy.Node
+	for _, node := range nodes {
+		store.Add(node)
+		added = append(added, *store.Find(nodeName(node)))
+	}
+
+	if err := store.Save(); err != nil {
+		return nil, err
+	}
+
+	return added, nil
+}
+
+// RemoveNode deletes a manual node by name
+func (m *Manager) RemoveNode(name string) error {
+	store, err := m.loadNodeStore()
+	if err != nil {
+		return err
+	}
+
+	if !store.Remove(name) {
+		return fmt.Errorf("no manual node named %q", name)
+	}
+
+	return store.Save()
+}
+
+// ListNodes returns manual nodes followed by subscription nodes
+func (m *Manager) ListNodes() ([]proxy.Node, error) {
+	sub, err := m.collectNodes()
+	if err != nil {
+		return nil, err
+	}
+	return sub.Nodes, nil
+}
+
+// TestNodes returns all nodes with their latency measured by the configured
+// test, reusing measurements younger than bench_cache_ttl
+func (m *Manager) TestNodes() ([]proxy.Node, error) {
+	sub, err := m.collectNodes()
+	if err != nil {
+		return nil, err
+	}
+	sub.TestAll(m.cachedLatency())
+	m.saveBenchCache()
+	return sub.Nodes, nil
+}
+
+// FindNode looks up a node by name in the manual store, the current node and
+// the subscription, in that order
+func (m *Manager) FindNode(name string) (*proxy.Node, error) {
+	store, err := m.loadNodeStore()
+	if err != nil {
+		return nil, err
+	}
+	if node := store.Find(name); node != nil {
+		return node, nil
+	}
+
+	if current, err := m.xray.CurrentNode(); err == nil && current.Name == name {
+		return current, nil
+	}
+
+	if m.config.Proxy.SubscriptionURL != "" {
+		sub, err := proxy.FetchSubscription(m.context(), m.config.Proxy.SubscriptionURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch subscription: %w", err)
+		}
+		for i := range sub.Nodes {
+			if sub.Nodes[i].Name == name {
+				return &sub.Nodes[i], nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("node %q not found", name)
+}
+
+// collectNodes merges manual nodes with the subscription's nodes
+func (m *Manager) collectNodes() (*proxy.Subscription, error) {
+	store, err := m.loadNodeStore()
+	if err != nil {
+		return nil, err
+	}
+
+	sub := &proxy.Subscription{
+		URL:   m.config.Proxy.SubscriptionURL,
+		Nodes: append([]proxy.Node(nil), store.Nodes...),
+	}
+
+	if m.config.Proxy.SubscriptionURL != "" {
+		fetched, err := proxy.FetchSubscription(m.context(), m.config.Proxy.SubscriptionURL)
+		if err != nil {
+			// Manual nodes still work when the subscription is unreachable
+			if len(sub.Nodes) == 0 {
+				return nil, fmt.Errorf("failed to fetch subscription: %w", err)
+			}
+			logging.Warn("failed to fetch subscription, using manual nodes only", "error", err)
+		} else {
+			sub.Nodes = append(sub.Nodes, fetched.Nodes...)
+			m.recordSubscriptionFetch(fetched.Nodes)
+		}
+	}
+
+	if len(sub.Nodes) == 0 {
+		return nil, fmt.Errorf("no subscription URL or manual nodes configured")
+	}
+
+	// hysteria2 and TUIC nodes run on sing-box; without it they just fail their latency test
+	if err := m.xray.EnsureSingBox(sub.Nodes); err != nil {
+		logging.Warn("skipping hysteria2/TUIC nodes", "error", err)
+	}
+
+	return sub, nil
+}
+
+// nodeName returns the name a node is stored under
+func nodeName(node proxy.Node) string {
+	if node.Name != "" {
+		return node.Name
+	}
+	return fmt.Sprintf("%s:%d", node.Server, node.Port)
+}
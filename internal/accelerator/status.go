@@ -0,0 +1,156 @@
+package accelerator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/boomyao/crosh/internal/i18n"
+	"github.com/boomyao/crosh/internal/proxy"
+)
+
+// ProxyStatus is a snapshot of the proxy's runtime state
+type ProxyStatus struct {
+	Running             bool
+	PID                 int
+	StartedAt           time.Time
+	SocksAddr           string
+	HTTPAddr            string
+	Node                *proxy.Node
+	Latency             time.Duration
+	LatencyErr          error
+	MonitorRunning      bool
+	SubscriptionURL     string
+	SubscriptionUpdated time.Time
+	Backend             string
+	GeoDataWarning      string
+	Traffic             *proxy.Traffic // nil unless running with the stats API enabled
+}
+
+// ProxyStatusDetails collects the proxy's runtime state, probing the current
+// node for live latency if the proxy is running
+func (m *Manager) ProxyStatusDetails() *ProxyStatus {
+	status := &ProxyStatus{
+		Running:         m.xray.IsRunning(),
+		PID:             m.xray.PID(),
+		MonitorRunning:  m.IsHealthMonitorRunning(),
+		SubscriptionURL: m.config.Proxy.SubscriptionURL,
+		GeoDataWarning:  m.xray.GeoDataWarning(),
+	}
+	status.SocksAddr, status.HTTPAddr = m.xray.ListenAddresses()
+	status.StartedAt, _ = m.xray.StartedAt()
+	status.SubscriptionUpdated = m.subscriptionUpdated()
+
+	if node, err := m.xray.CurrentNode(); err == nil {
+		status.Node = node
+		if version, err := m.xray.Version(node); err == nil {
+			status.Backend = version
+		}
+	}
+
+	if status.Running {
+		status.Latency, status.LatencyErr = m.CheckProxyHealth()
+		if traffic, err := m.xray.TrafficStats(); err == nil {
+			status.Traffic = &traffic
+		}
+	}
+
+	return status
+}
+
+// subscriptionStampPath returns the file recording the last successful subscription fetch
+func (m *Manager) subscriptionStampPath() string {
+	return filepath.Join(m.xray.StateDir(), "subscription.updated")
+}
+
+// recordSubscriptionFetch remembers when the subscription was last fetched
+// and reports to the webhooks when its nodes differ from the previous fetch
+func (m *Manager) recordSubscriptionFetch(nodes []proxy.Node) {
+	os.MkdirAll(m.xray.StateDir(), 0755)
+	os.WriteFile(m.subscriptionStampPath(), []byte(time.Now().Format(time.RFC3339)), 0644)
+
+	// One line per node, sorted so reordering isn't a change
+	lines := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		lines = append(lines, fmt.Sprintf("%s %s %s:%d", node.Name, node.Type, node.Server, node.Port))
+	}
+	sort.Strings(lines)
+	current := strings.Join(lines, "\n")
+
+	path := filepath.Join(m.xray.StateDir(), "subscription.nodes")
+	previous, err := os.ReadFile(path)
+	os.WriteFile(path, []byte(current), 0644)
+	if err != nil || string(previous) == current {
+		return // First fetch or unchanged
+	}
+	before := 0
+	if len(previous) > 0 {
+		before = strings.Count(string(previous), "\n") + 1
+	}
+	m.sendWebhooks("subscription.changed", i18n.Sprintf("Subscription changed: %d nodes (was %d)", len(nodes), before))
+}
+
+// subscriptionUpdated returns when the subscription was last fetched, or the zero time
+func (m *Manager) subscriptionUpdated() time.Time {
+	data, err := os.ReadFile(m.subscriptionStampPath())
+	if err != nil {
+		return time.Time{}
+	}
+	updated, _ := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+	return updated
+}
+
+// SubscriptionMaxAge is how long a fetched subscription counts as current
+const SubscriptionMaxAge = 7 * 24 * time.Hour
+
+// SubscriptionUpdated returns when the subscription was last fetched (the
+// zero time if never) and whether it is due to be fetched again
+func (m *Manager) SubscriptionUpdated() (time.Time, bool) {
+	if m.config.Proxy.SubscriptionURL == "" {
+		return time.Time{}, false
+	}
+	updated := m.subscriptionUpdated()
+	return updated, updated.IsZero() || time.Since(updated) > SubscriptionMaxAge
+}
+
+// ProxySettingsDrift describes git, package manager and system proxy
+// settings that don't match the config and whether the proxy is running
+func (m *Manager) ProxySettingsDrift() []string {
+	var drift []string
+	running := m.xray.IsRunning()
+
+	if enabled, _, err := m.gitProxy().Status(); err == nil {
+		want := m.config.Proxy.Git.Enabled && running
+		switch {
+		case enabled && !want:
+			drift = append(drift, "git still points at the proxy (run \"crosh proxy git off\")")
+		case !enabled && want:
+			drift = append(drift, "git proxy is on in the config but not applied (run \"crosh proxy git on\")")
+		}
+	}
+
+	if enabled, _, err := m.packageProxy().Status(); err == nil {
+		want := m.config.Proxy.PackageManagers && running
+		switch {
+		case enabled && !want:
+			drift = append(drift, "package managers still point at the proxy (run \"crosh proxy pkg off\")")
+		case !enabled && want:
+			drift = append(drift, "package manager proxy is on in the config but not applied (run \"crosh proxy pkg on\")")
+		}
+	}
+
+	if enabled, _, err := m.systemProxy().Status(); err == nil {
+		want := m.config.Proxy.System.Enabled && running
+		switch {
+		case enabled && !want:
+			drift = append(drift, "the Windows system proxy still points at the proxy (run \"crosh proxy system off\")")
+		case !enabled && want:
+			drift = append(drift, "system proxy is on in the config but not applied (run \"crosh proxy system on\")")
+		}
+	}
+
+	return drift
+}
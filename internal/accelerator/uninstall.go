@@ -0,0 +1,84 @@
+package accelerator
+
+import (
+	"fmt"
+
+	"github.com/boomyao/crosh/internal/i18n"
+	"github.com/boomyao/crosh/internal/mirror"
+)
+
+// Revert undoes everything crosh changed outside its own directories: it
+// stops the proxy and health monitor, removes git, package manager, system
+// and Docker proxy settings, disables every mirror, restores files crosh backed
+// up and removes its blocks from shell rc files. It keeps going after a
+// failure and returns every error.
+func (m *Manager) Revert() []error {
+	var errs []error
+
+	if err := m.DisableProxy(); err != nil {
+		errs = append(errs, fmt.Errorf("proxy: %w", err))
+	} else {
+		i18n.Println("✓ Proxy and health monitor stopped")
+	}
+
+	if enabled, _, err := m.gitProxy().Status(); err == nil && enabled {
+		if err := m.gitProxy().Disable(); err != nil {
+			errs = append(errs, fmt.Errorf("git proxy: %w", err))
+		} else {
+			m.markApplied(settingGit, false)
+			i18n.Println("✓ Git proxy settings removed")
+		}
+	}
+
+	if enabled, _, err := m.packageProxy().Status(); err == nil && enabled {
+		if err := m.packageProxy().Disable(); err != nil {
+			errs = append(errs, fmt.Errorf("package manager proxy: %w", err))
+		} else {
+			m.markApplied(settingPackages, false)
+			i18n.Println("✓ Package manager proxy settings removed")
+		}
+	}
+
+	if enabled, _, err := m.systemProxy().Status(); err == nil && enabled {
+		if err := m.systemProxy().Disable(); err != nil {
+			errs = append(errs, fmt.Errorf("system proxy: %w", err))
+		} else {
+			m.markApplied(settingSystem, false)
+			i18n.Println("✓ System proxy settings restored")
+		}
+	}
+
+	if enabled, _, err := m.GetDockerProxyStatus(); err == nil && enabled {
+		dockerProxy := m.dockerProxy()
+		err := dockerProxy.Disable()
+		m.audit("docker-proxy.disable", "", dockerProxy.ConfigFiles(), err)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("docker proxy: %w", err))
+		} else {
+			m.markApplied(settingDocker, false)
+			i18n.Println("✓ Docker daemon proxy removed")
+		}
+	}
+
+	if err := m.DisableMirrors(); err != nil {
+		errs = append(errs, fmt.Errorf("mirrors: %w", err))
+	}
+
+	restored, err := mirror.RestoreBackups()
+	for _, path := range restored {
+		i18n.Printf("✓ Restored %s\n", path)
+	}
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	changed, err := mirror.RemoveShellBlocks()
+	for _, path := range changed {
+		i18n.Printf("✓ Removed crosh lines from %s\n", path)
+	}
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
@@ -0,0 +1,66 @@
+package accelerator
+
+import (
+	"fmt"
+
+	"github.com/boomyao/crosh/internal/i18n"
+	"github.com/boomyao/crosh/internal/mirror"
+)
+
+// windowsMirror is a mirror handler that also applies to the Windows side of WSL
+type windowsMirror struct {
+	tool    string
+	url     string
+	handler mirrorHandler
+}
+
+// windowsMirrors returns the mirrors kept in step on the Windows side. Docker
+// Desktop needs no entry, as WSL and Windows share its daemon.json.
+func (m *Manager) windowsMirrors() []windowsMirror {
+	return []windowsMirror{
+		{"npm", m.config.Mirror.NPM, mirror.NewNPMMirror(m.config.Mirror.NPM)},
+		{"pip", m.config.Mirror.Pip, mirror.NewPipMirror(m.config.Mirror.Pip)},
+		{"cargo", m.config.Mirror.Cargo, mirror.NewCargoMirror(m.config.Mirror.Cargo)},
+		{"go", m.config.Mirror.Go, mirror.NewGoMirror(m.config.Mirror.Go)},
+	}
+}
+
+// setWindowsMirrors enables or disables the mirrors of the Windows user when
+// crosh runs in WSL with wsl.windows set, and returns what failed
+func (m *Manager) setWindowsMirrors(enable bool) []error {
+	if !m.config.WSL.Windows || !mirror.InWSL() {
+		return nil
+	}
+
+	var errs []error
+	err := mirror.OnWindowsSide(func() error {
+		for _, wm := range m.windowsMirrors() {
+			if enable && wm.url == "" {
+				continue
+			}
+
+			var err error
+			if enable {
+				err = wm.handler.Enable()
+				m.audit("mirror.enable", "windows "+wm.tool+" "+wm.url, mirror.ConfigFiles(wm.tool), err)
+			} else {
+				err = wm.handler.Disable()
+				m.audit("mirror.disable", "windows "+wm.tool, mirror.ConfigFiles(wm.tool), err)
+			}
+
+			switch {
+			case err != nil:
+				errs = append(errs, fmt.Errorf("Windows %s mirror: %w", wm.tool, err))
+			case enable:
+				i18n.Printf("✓ Windows %s mirror enabled: %s\n", wm.tool, wm.url)
+			default:
+				i18n.Printf("✓ Windows %s mirror disabled\n", wm.tool)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, fmt.Errorf("Windows mirrors: %w", err))
+	}
+	return errs
+}
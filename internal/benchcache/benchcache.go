@@ -0,0 +1,121 @@
+package benchcache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Cache keeps latency and throughput measurements of nodes and mirrors for a
+// while, so repeated commands don't probe everything again. A nil Cache
+// caches nothing, which is what Open returns when caching is turned off.
+type Cache struct {
+	mu      sync.Mutex
+	path    string
+	ttl     time.Duration
+	entries map[string]entry
+	dirty   bool
+}
+
+// entry is one measurement as stored on disk
+type entry struct {
+	Measured time.Time       `json:"measured"`
+	Value    json.RawMessage `json:"value"`
+}
+
+// Open reads the cache at path, keeping measurements for ttl. A missing or
+// corrupt file starts an empty cache; ttl <= 0 returns nil.
+func Open(path string, ttl time.Duration) *Cache {
+	if ttl <= 0 {
+		return nil
+	}
+
+	c := &Cache{path: path, ttl: ttl, entries: make(map[string]entry)}
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &c.entries)
+	}
+	return c
+}
+
+// Get decodes the measurement stored under key into v, reporting false if
+// there is none younger than the TTL
+func (c *Cache) Get(key string, v interface{}) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok || time.Since(e.Measured) > c.ttl {
+		return false
+	}
+	return json.Unmarshal(e.Value, v) == nil
+}
+
+// Put stores a measurement under key
+func (c *Cache) Put(key string, v interface{}) {
+	if c == nil {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = entry{Measured: time.Now(), Value: data}
+	c.dirty = true
+}
+
+// Save writes the measurements that haven't expired back to disk, if any
+// were added
+func (c *Cache) Save() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return nil
+	}
+
+	for key, e := range c.entries {
+		if time.Since(e.Measured) > c.ttl {
+			delete(c.entries, key)
+		}
+	}
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode bench cache: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(c.path), err)
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write bench cache: %w", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write bench cache: %w", err)
+	}
+	c.dirty = false
+	return nil
+}
+
+// Clear forgets every measurement
+func (c *Cache) Clear() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]entry)
+	c.dirty = true
+}
@@ -0,0 +1,379 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boomyao/crosh/internal/httpclient"
+	"github.com/boomyao/crosh/internal/logging"
+)
+
+// metadataTTL is how long package metadata (npm packuments, PyPI index pages,
+// Go version lists) is served from the cache before it is fetched again.
+// Package files never change and are cached until evicted.
+const metadataTTL = 10 * time.Minute
+
+// fetchTimeout bounds one download from a mirror
+const fetchTimeout = 10 * time.Minute
+
+// route is a package registry served under /<name>/
+type route struct {
+	upstream  string                 // mirror URL without a trailing slash, "" if none is configured
+	immutable func(path string) bool // whether path is a package file
+	rewrite   bool                   // whether metadata links to package files need pointing at the cache
+}
+
+// Server is a pull-through cache for npm (/npm/), PyPI (/pypi/) and the Go
+// module proxy (/go/). Metadata that can't be refreshed because the mirror
+// is down is served stale, so installs keep working offline.
+//
+// Entries are keyed by registry and path rather than by mirror URL, so a
+// cache filled through one mirror serves clients configured for another.
+type Server struct {
+	// Offline serves only what is cached and never contacts the mirrors,
+	// e.g. for a bundle from "crosh prefetch" on an air-gapped machine
+	Offline bool
+
+	store  *Store
+	routes map[string]route
+	pip    string // index path under /pypi, e.g. /simple/
+	goList string // the configured GOPROXY, tried after the cache
+	client *http.Client
+}
+
+// NewServer creates a cache in front of the configured npm registry, pip
+// index and GOPROXY. A tool whose mirror is empty is only served from what
+// is already cached.
+func NewServer(store *Store, npm, pip, goproxy string) *Server {
+	s := &Server{
+		store:  store,
+		pip:    "/simple/",
+		goList: goproxy,
+		client: httpclient.New(fetchTimeout),
+	}
+
+	// Serve the whole PyPI mirror, not just the index, so the relative links
+	// of the index pages to package files go through the cache as well
+	pipBase := strings.TrimSuffix(pip, "/")
+	if strings.HasSuffix(pipBase, "/simple") {
+		pipBase = strings.TrimSuffix(pipBase, "/simple")
+	} else if pipBase != "" {
+		s.pip = "/"
+	}
+
+	s.routes = map[string]route{
+		"npm": {
+			upstream:  strings.TrimSuffix(npm, "/"),
+			immutable: func(path string) bool { return strings.Contains(path, "/-/") },
+			rewrite:   true,
+		},
+		"pypi": {upstream: pipBase, immutable: isPackageFile},
+		"go": {
+			upstream: goUpstream(goproxy),
+			immutable: func(path string) bool {
+				return strings.Contains(path, "/@v/") && !strings.HasSuffix(path, "/@v/list")
+			},
+		},
+	}
+	return s
+}
+
+// URLs returns the npm registry, pip index and GOPROXY that send npm, pip and
+// go through the cache at base (e.g. http://127.0.0.1:7683), or "" for the
+// tools it doesn't serve. go falls back to the configured GOPROXY when the
+// cache is down.
+func (s *Server) URLs(base string) (npm, pip, goproxy string) {
+	if s.serves("npm") {
+		npm = base + "/npm/"
+	}
+	if s.serves("pypi") {
+		pip = base + "/pypi" + s.pip
+	}
+	if s.serves("go") {
+		goproxy = base + "/go"
+		if !s.Offline {
+			goproxy += "|" + s.goList
+		}
+	}
+	return npm, pip, goproxy
+}
+
+// serves checks if clients should be pointed at a registry of the cache
+func (s *Server) serves(name string) bool {
+	return s.Offline || s.routes[name].upstream != ""
+}
+
+// offline checks if a registry is only served from the cache
+func (s *Server) offline(rt route) bool {
+	return s.Offline || rt.upstream == ""
+}
+
+// goUpstream returns the first module proxy URL in a GOPROXY list
+func goUpstream(goproxy string) string {
+	for _, entry := range strings.FieldsFunc(goproxy, func(r rune) bool { return r == ',' || r == '|' }) {
+		if strings.HasPrefix(entry, "http://") || strings.HasPrefix(entry, "https://") {
+			return strings.TrimSuffix(entry, "/")
+		}
+	}
+	return ""
+}
+
+// isPackageFile checks if a PyPI path is a distribution rather than an index page
+func isPackageFile(path string) bool {
+	for _, ext := range []string{".whl", ".tar.gz", ".zip", ".tar.bz2", ".tgz", ".egg", ".metadata"} {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheKey returns the key of path in a registry. Metadata differs by the
+// media type the client prefers, e.g. npm's abbreviated packuments, so that
+// is part of its key; the rest of Accept varies between client versions.
+func cacheKey(name, path, accept string, immutable bool) string {
+	if immutable {
+		return Key(name, path)
+	}
+	mediaType, _, _ := strings.Cut(accept, ",")
+	mediaType, _, _ = strings.Cut(mediaType, ";")
+	if mediaType = strings.TrimSpace(mediaType); mediaType == "*/*" {
+		mediaType = "" // Same as sending no Accept header
+	}
+	return Key(name, path, mediaType)
+}
+
+// rewriteLinks points the absolute tarball URLs in npm metadata at the cache
+func rewriteLinks(body []byte, upstream, local string) []byte {
+	return bytes.ReplaceAll(body, []byte(`"`+upstream+`/`), []byte(`"`+local+`/`))
+}
+
+// ServeHTTP serves a package file or metadata from the cache, fetching it
+// from the mirror on a miss
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "use GET", http.StatusMethodNotAllowed)
+		return
+	}
+	name, path, _ := strings.Cut(strings.TrimPrefix(r.URL.EscapedPath(), "/"), "/")
+	rt, ok := s.routes[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	path = "/" + path
+	if r.URL.RawQuery != "" {
+		path += "?" + r.URL.RawQuery
+	}
+	local := "http://" + r.Host + "/" + name
+	immutable := rt.immutable(path)
+	key := cacheKey(name, path, r.Header.Get("Accept"), immutable)
+
+	cached, meta, err := s.store.Open(key)
+	if err == nil {
+		defer cached.Close()
+		if immutable || s.offline(rt) || time.Since(meta.Fetched) < metadataTTL {
+			s.serveCached(w, r, cached, meta, local, "HIT", rt.rewrite && !immutable)
+			return
+		}
+	} else if s.offline(rt) {
+		http.Error(w, "not in the cache", http.StatusNotFound)
+		return
+	}
+
+	resp, err := s.fetch(rt.upstream+path, r.Header.Get("Accept"), r.Header.Get("User-Agent"))
+	if err != nil || resp.StatusCode >= 500 {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if cached != nil {
+			logging.Warn("mirror unavailable, serving cached metadata", "url", rt.upstream+path, "error", err)
+			s.serveCached(w, r, cached, meta, local, "STALE", rt.rewrite && !immutable)
+			return
+		}
+		if err == nil {
+			err = fmt.Errorf("mirror returned %s", resp.Status)
+		}
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	logging.Debug("cache miss", "url", rt.upstream+path, "status", resp.StatusCode)
+
+	w.Header().Set("X-Crosh-Cache", "MISS")
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	if resp.StatusCode != http.StatusOK {
+		// Not found and the like aren't cached
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		return
+	}
+
+	meta = newMeta(rt, path, resp)
+	if rt.rewrite && !immutable {
+		body, err := s.saveMetadata(resp, key, *meta)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.Write(rewriteLinks(body, rt.upstream, local))
+		return
+	}
+	if resp.ContentLength >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+	}
+	s.save(&clientWriter{w: w}, resp, key, *meta)
+}
+
+// Fetch returns the cached body of path under a registry ("npm", "pypi" or
+// "go"), downloading it from the mirror first unless a fresh copy is cached.
+// Links in npm metadata are left pointing at the mirror. The caller closes
+// the file.
+func (s *Server) Fetch(name, path, accept string) (*os.File, error) {
+	rt, ok := s.routes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown registry %q", name)
+	}
+	immutable := rt.immutable(path)
+	key := cacheKey(name, path, accept, immutable)
+
+	if cached, meta, err := s.store.Open(key); err == nil {
+		if immutable || s.offline(rt) || time.Since(meta.Fetched) < metadataTTL {
+			return cached, nil
+		}
+		cached.Close()
+	}
+	if s.offline(rt) {
+		return nil, fmt.Errorf("%s%s is not in the cache", name, path)
+	}
+
+	resp, err := s.fetch(rt.upstream+path, accept, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", rt.upstream+path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: mirror returned %s", rt.upstream+path, resp.Status)
+	}
+	if err := s.save(io.Discard, resp, key, *newMeta(rt, path, resp)); err != nil {
+		return nil, err
+	}
+	cached, _, err := s.store.Open(key)
+	return cached, err
+}
+
+// Upstream returns the mirror URL of a registry, "" if none is configured
+func (s *Server) Upstream(name string) string {
+	return s.routes[name].upstream
+}
+
+// newMeta returns the Meta of a response from the mirror
+func newMeta(rt route, path string, resp *http.Response) *Meta {
+	return &Meta{
+		URL:         rt.upstream + path,
+		Upstream:    rt.upstream,
+		ContentType: resp.Header.Get("Content-Type"),
+		Fetched:     time.Now(),
+	}
+}
+
+// save streams a response to dst and into the cache at once. It is only
+// cached if it was downloaded completely.
+func (s *Server) save(dst io.Writer, resp *http.Response, key string, meta Meta) error {
+	cw, err := s.store.Writer(key)
+	if err != nil {
+		logging.Warn("failed to cache download", "url", meta.URL, "error", err)
+		io.Copy(dst, resp.Body)
+		return err
+	}
+
+	_, err = io.Copy(io.MultiWriter(cw, dst), resp.Body)
+	if err == nil && resp.ContentLength >= 0 && cw.size != resp.ContentLength {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		logging.Warn("download from mirror incomplete, not cached", "url", meta.URL, "error", err)
+		cw.Abort()
+		return fmt.Errorf("failed to download %s: %w", meta.URL, err)
+	}
+	if err := cw.Commit(meta); err != nil {
+		logging.Warn("failed to cache download", "url", meta.URL, "error", err)
+		return err
+	}
+	return nil
+}
+
+// saveMetadata caches metadata as the mirror sent it and returns it
+func (s *Server) saveMetadata(resp *http.Response, key string, meta Meta) ([]byte, error) {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from mirror: %w", err)
+	}
+	if cw, err := s.store.Writer(key); err == nil {
+		if _, err := cw.Write(body); err != nil {
+			cw.Abort()
+		} else if err := cw.Commit(meta); err != nil {
+			logging.Warn("failed to cache metadata", "url", meta.URL, "error", err)
+		}
+	}
+	return body, nil
+}
+
+// clientWriter writes to the client until the first error and then drops
+// the rest, so a client that goes away doesn't stop the download into the
+// cache
+type clientWriter struct {
+	w   io.Writer
+	err error
+}
+
+// Write writes p unless an earlier write failed, and never fails itself
+func (c *clientWriter) Write(p []byte) (int, error) {
+	if c.err == nil {
+		_, c.err = c.w.Write(p)
+	}
+	return len(p), nil
+}
+
+// fetch gets url from the mirror. The download isn't tied to the client's
+// request, so it still ends up in the cache if the client gives up.
+func (s *Server) fetch(url, accept, userAgent string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if userAgent != "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+	return s.client.Do(req)
+}
+
+// serveCached writes a cached response. Links in npm metadata are pointed at
+// the host the client used, from the mirror the metadata came from.
+func (s *Server) serveCached(w http.ResponseWriter, r *http.Request, body io.ReadSeeker, meta *Meta, local, state string, rewrite bool) {
+	w.Header().Set("X-Crosh-Cache", state)
+	if meta.ContentType != "" {
+		w.Header().Set("Content-Type", meta.ContentType)
+	}
+	if rewrite {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(rewriteLinks(data, meta.Upstream, local))
+		return
+	}
+	http.ServeContent(w, r, "", meta.Fetched, body)
+}
@@ -0,0 +1,210 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store is a disk-backed cache of upstream responses that evicts the least
+// recently used entries once it grows past its size limit
+type Store struct {
+	mu      sync.Mutex
+	dir     string
+	max     int64
+	size    int64
+	entries map[string]*entry
+}
+
+// entry is a cached response on disk: <key> holds the body and <key>.json
+// its Meta
+type entry struct {
+	key  string
+	size int64
+	used time.Time
+}
+
+// Meta describes a cached response
+type Meta struct {
+	URL         string    `json:"url"`
+	Upstream    string    `json:"upstream"` // the mirror URL is relative to
+	ContentType string    `json:"content_type,omitempty"`
+	Fetched     time.Time `json:"fetched"`
+}
+
+// OpenStore opens the cache in dir, creating it if needed, and indexes the
+// entries already there. maxBytes <= 0 means no limit.
+func OpenStore(dir string, maxBytes int64) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	s := &Store{dir: dir, max: maxBytes, entries: make(map[string]*entry)}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		name := info.Name()
+		switch {
+		case strings.HasPrefix(name, ".tmp-"):
+			os.Remove(path) // Left behind by an interrupted download
+		case len(name) == 2*sha256.Size: // A body; <key>.json is its Meta
+			s.entries[name] = &entry{key: name, size: info.Size(), used: info.ModTime()}
+			s.size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	s.mu.Lock()
+	s.evict()
+	s.mu.Unlock()
+	return s, nil
+}
+
+// Key returns the key of a cached response; parts are e.g. the upstream URL
+// and the Accept header the body depends on
+func Key(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// Size returns the bytes held and the number of entries
+func (s *Store) Size() (int64, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size, len(s.entries)
+}
+
+// path returns the file holding the body of key, spread over 256 directories
+func (s *Store) path(key string) string {
+	return filepath.Join(s.dir, key[:2], key)
+}
+
+// Open returns the cached body and meta of key, marking it as recently used.
+// The caller closes the file.
+func (s *Store) Open(key string) (*os.File, *Meta, error) {
+	s.mu.Lock()
+	e, ok := s.entries[key]
+	if ok {
+		e.used = time.Now()
+	}
+	s.mu.Unlock()
+	if !ok {
+		return nil, nil, os.ErrNotExist
+	}
+
+	data, err := os.ReadFile(s.path(key) + ".json")
+	if err != nil {
+		return nil, nil, err
+	}
+	var meta Meta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse cache entry %s: %w", key, err)
+	}
+	f, err := os.Open(s.path(key))
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	os.Chtimes(s.path(key), now, now) // Keeps the LRU order across restarts
+	return f, &meta, nil
+}
+
+// Writer returns a writer for a new body of key. Nothing replaces the cached
+// entry until Commit is called, so a failed download leaves it intact.
+func (s *Store) Writer(key string) (*Writer, error) {
+	dir := filepath.Dir(s.path(key))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	f, err := os.CreateTemp(dir, ".tmp-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache file: %w", err)
+	}
+	return &Writer{store: s, key: key, file: f}, nil
+}
+
+// Writer writes a body into the store
+type Writer struct {
+	store *Store
+	key   string
+	file  *os.File
+	size  int64
+}
+
+// Write writes to the temporary file
+func (w *Writer) Write(p []byte) (int, error) {
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Commit stores the body written so far under the key with meta
+func (w *Writer) Commit(meta Meta) error {
+	s := w.store
+	path := s.path(w.key)
+	if err := w.file.Close(); err != nil {
+		os.Remove(w.file.Name())
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		os.Remove(w.file.Name())
+		return fmt.Errorf("failed to encode cache entry: %w", err)
+	}
+	if err := os.WriteFile(path+".json", data, 0644); err != nil {
+		os.Remove(w.file.Name())
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := os.Rename(w.file.Name(), path); err != nil {
+		os.Remove(w.file.Name())
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.entries[w.key]; ok {
+		s.size -= old.size
+	}
+	s.entries[w.key] = &entry{key: w.key, size: w.size, used: time.Now()}
+	s.size += w.size
+	s.evict()
+	return nil
+}
+
+// Abort discards the body written so far
+func (w *Writer) Abort() {
+	w.file.Close()
+	os.Remove(w.file.Name())
+}
+
+// evict removes the least recently used entries until the store fits its
+// limit. mu must be held.
+func (s *Store) evict() {
+	if s.max <= 0 || s.size <= s.max {
+		return
+	}
+	entries := make([]*entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].used.Before(entries[j].used) })
+	for _, e := range entries {
+		if s.size <= s.max {
+			break
+		}
+		os.Remove(s.path(e.key))
+		os.Remove(s.path(e.key) + ".json")
+		delete(s.entries, e.key)
+		s.size -= e.size
+	}
+}
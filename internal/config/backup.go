@@ -0,0 +1,141 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxBackups is how many previous versions of each profile's config are kept
+const maxBackups = 10
+
+// backupTimeFormat is used in backup file names, e.g. default-20240102-150405.000.yaml
+const backupTimeFormat = "20060102-150405.000"
+
+// Backup is a previous version of a profile's config file
+type Backup struct {
+	Path string
+	Time time.Time
+	Size int64
+}
+
+// saveBackups makes Save back up the previous version of the config
+var saveBackups = true
+
+// SetSaveBackups turns backing up on Save on or off. Background processes
+// turn it off, so the node switches they save don't push the user's own
+// changes out of the backups.
+func SetSaveBackups(enabled bool) {
+	saveBackups = enabled
+}
+
+// backupsDir returns the directory holding config backups
+func backupsDir() string {
+	return filepath.Join(ConfigDir(), "backups")
+}
+
+// BackupProfile copies the current config file of a profile into the
+// backups directory, dropping the oldest backups beyond maxBackups. Nothing
+// is copied if the file doesn't exist or matches the latest backup.
+func BackupProfile(profile string) error {
+	data, err := os.ReadFile(ProfilePath(profile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config for backup: %w", err)
+	}
+
+	backups, err := ListBackups(profile)
+	if err != nil {
+		return err
+	}
+	if len(backups) > 0 {
+		if latest, err := os.ReadFile(backups[0].Path); err == nil && bytes.Equal(latest, data) {
+			return nil
+		}
+	}
+
+	if err := os.MkdirAll(backupsDir(), 0755); err != nil {
+		return fmt.Errorf("failed to create backups directory: %w", err)
+	}
+	name := fmt.Sprintf("%s-%s%s", profile, time.Now().Format(backupTimeFormat), filepath.Ext(ProfilePath(profile)))
+	if err := os.WriteFile(filepath.Join(backupsDir(), name), data, 0600); err != nil {
+		return fmt.Errorf("failed to write config backup: %w", err)
+	}
+
+	// The new backup isn't in the list yet, so keep one less of the old ones
+	for i := maxBackups - 1; i < len(backups); i++ {
+		os.Remove(backups[i].Path)
+	}
+
+	return nil
+}
+
+// ListBackups returns the backups of a profile, newest first
+func ListBackups(profile string) ([]Backup, error) {
+	entries, err := os.ReadDir(backupsDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backups directory: %w", err)
+	}
+
+	var backups []Backup
+	prefix := profile + "-"
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, prefix) || !IsConfigFile(name) {
+			continue
+		}
+		// Profile names may contain dashes, so the rest has to be a timestamp
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), filepath.Ext(name))
+		t, err := time.ParseInLocation(backupTimeFormat, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, Backup{Path: filepath.Join(backupsDir(), name), Time: t, Size: info.Size()})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Time.After(backups[j].Time)
+	})
+	return backups, nil
+}
+
+// RestoreBackup replaces a profile's config file with a backup. The current
+// file is backed up first so the restore can be undone.
+func RestoreBackup(profile string, backup Backup) error {
+	data, err := os.ReadFile(backup.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read backup: %w", err)
+	}
+
+	if err := BackupProfile(profile); err != nil {
+		return err
+	}
+
+	// The backup may be in another format than the current file
+	current := ProfilePath(profile)
+	path := strings.TrimSuffix(current, filepath.Ext(current)) + filepath.Ext(backup.Path)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if current != path {
+		os.Remove(current)
+	}
+
+	return nil
+}
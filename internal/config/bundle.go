@@ -0,0 +1,237 @@
+package config
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Bundle layout: config/... mirrors the config directory (config.yaml,
+// profiles, backups) and data/... holds user data such as manual nodes.
+// Binaries, geodata, logs and runtime state are left out since they are
+// machine specific or downloaded again.
+const (
+	bundleManifest  = "crosh-bundle.json"
+	bundleConfigDir = "config"
+	bundleDataDir   = "data"
+)
+
+// bundleDataFiles are the files from the data directory worth moving
+var bundleDataFiles = []string{"nodes.json"}
+
+// bundleInfo describes where a bundle came from
+type bundleInfo struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	DataDir string    `json:"data_dir"` // exporting machine's data directory, to fix up xray_path
+}
+
+// ExportBundle writes a tar.gz of the config directory and the user data in
+// dataDir to w, returning the bundled file names
+func ExportBundle(w io.Writer, dataDir string) ([]string, error) {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	info, err := json.MarshalIndent(bundleInfo{Version: 1, Created: time.Now(), DataDir: dataDir}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal bundle manifest: %w", err)
+	}
+	if err := writeTarFile(tw, bundleManifest, info, 0644); err != nil {
+		return nil, err
+	}
+
+	var files []string
+	configDir := ConfigDir()
+	err = filepath.Walk(configDir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == configDir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !fi.Mode().IsRegular() || strings.HasSuffix(p, ".bak") || strings.HasSuffix(p, ".tmp") {
+			return nil
+		}
+		rel, err := filepath.Rel(configDir, p)
+		if err != nil {
+			return err
+		}
+		// With the legacy layout everything shares one directory
+		if configDir == dataDir && !isMainConfig(rel) && !strings.HasPrefix(rel, "profiles"+string(filepath.Separator)) && !strings.HasPrefix(rel, "backups"+string(filepath.Separator)) {
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		// The secret key stays on this machine, so bundle secrets in plain text
+		if IsConfigFile(p) {
+			if data, err = decryptSecretsInYAML(data); err != nil {
+				return fmt.Errorf("%s: %w", rel, err)
+			}
+		}
+		name := path.Join(bundleConfigDir, filepath.ToSlash(rel))
+		files = append(files, name)
+		return writeTarFile(tw, name, data, fi.Mode().Perm())
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to bundle config directory: %w", err)
+	}
+
+	for _, file := range bundleDataFiles {
+		p := filepath.Join(dataDir, file)
+		data, err := os.ReadFile(p)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", p, err)
+		}
+		name := path.Join(bundleDataDir, file)
+		files = append(files, name)
+		if err := writeTarFile(tw, name, data, 0600); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write bundle: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write bundle: %w", err)
+	}
+
+	return files, nil
+}
+
+// writeTarFile adds a regular file to the archive
+func writeTarFile(tw *tar.Writer, name string, data []byte, mode os.FileMode) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    int64(mode),
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	return nil
+}
+
+// ImportBundle restores a bundle written by ExportBundle into the config
+// directory and dataDir. Existing files are kept with a .bak suffix. It
+// returns the paths written.
+func ImportBundle(r io.Reader, dataDir string) ([]string, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a crosh bundle: %w", err)
+	}
+	defer gz.Close()
+
+	// Read everything first so a corrupt bundle doesn't leave a half import
+	var info *bundleInfo
+	files := make(map[string][]byte)
+	var order []string
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bundle: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bundle: %w", err)
+		}
+		if header.Name == bundleManifest {
+			info = &bundleInfo{}
+			if err := json.Unmarshal(data, info); err != nil {
+				return nil, fmt.Errorf("invalid bundle manifest: %w", err)
+			}
+			continue
+		}
+		files[header.Name] = data
+		order = append(order, header.Name)
+	}
+	if info == nil {
+		return nil, fmt.Errorf("not a crosh bundle: %s missing", bundleManifest)
+	}
+
+	// Point xray_path at this machine's data directory if it was the default
+	oldXray := filepath.Join(info.DataDir, "xray-core")
+	newXray := filepath.Join(dataDir, "xray-core")
+
+	targets := make(map[string]string)
+	for _, name := range order {
+		target, err := bundleTarget(name, dataDir)
+		if err != nil {
+			return nil, err
+		}
+		targets[name] = target
+	}
+
+	var written []string
+	for _, name := range order {
+		target := targets[name]
+		data := files[name]
+		if IsConfigFile(name) && info.DataDir != "" && oldXray != newXray {
+			data = bytes.ReplaceAll(data, []byte(oldXray), []byte(newXray))
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return written, fmt.Errorf("failed to create %s: %w", filepath.Dir(target), err)
+		}
+		if existing, err := os.ReadFile(target); err == nil {
+			if bytes.Equal(existing, data) {
+				continue
+			}
+			if err := os.Rename(target, target+".bak"); err != nil {
+				return written, fmt.Errorf("failed to back up %s: %w", target, err)
+			}
+		}
+		if err := os.WriteFile(target, data, 0600); err != nil {
+			return written, fmt.Errorf("failed to write %s: %w", target, err)
+		}
+		written = append(written, target)
+	}
+
+	return written, nil
+}
+
+// bundleTarget maps a bundle entry to its destination, rejecting entries
+// that would escape the config or data directory
+func bundleTarget(name, dataDir string) (string, error) {
+	clean := path.Clean(name)
+	if clean != name || strings.HasPrefix(clean, "../") || path.IsAbs(clean) {
+		return "", fmt.Errorf("refusing suspicious bundle entry %q", name)
+	}
+
+	switch {
+	case strings.HasPrefix(clean, bundleConfigDir+"/"):
+		return filepath.Join(ConfigDir(), filepath.FromSlash(strings.TrimPrefix(clean, bundleConfigDir+"/"))), nil
+	case strings.HasPrefix(clean, bundleDataDir+"/"):
+		file := strings.TrimPrefix(clean, bundleDataDir+"/")
+		for _, allowed := range bundleDataFiles {
+			if file == allowed {
+				return filepath.Join(dataDir, file), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("refusing unexpected bundle entry %q", name)
+}
@@ -4,39 +4,215 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/boomyao/crosh/internal/errs"
+	"github.com/boomyao/crosh/internal/hint"
 	"gopkg.in/yaml.v3"
 )
 
 // Config represents the crosh configuration structure
 type Config struct {
-	Mirror MirrorConfig `yaml:"mirror"`
-	Proxy  ProxyConfig  `yaml:"proxy"`
+	Mirror         MirrorConfig    `yaml:"mirror"`
+	Proxy          ProxyConfig     `yaml:"proxy"`
+	EncryptSecrets bool            `yaml:"encrypt_secrets,omitempty"` // store subscription URL and mirror credentials encrypted
+	Hooks          []HookConfig    `yaml:"hooks,omitempty"`
+	Webhooks       []WebhookConfig `yaml:"webhooks,omitempty"`
+	Language       string          `yaml:"language,omitempty"` // auto (from the locale), en or zh
+	Sudo           string          `yaml:"sudo,omitempty"`     // auto, sudo or doas: what crosh suggests for changes that need root
+	WSL            WSLConfig       `yaml:"wsl,omitempty"`
+	Daemon         DaemonConfig    `yaml:"daemon,omitempty"`
+	HTTP           HTTPConfig      `yaml:"http,omitempty"`
+	Telemetry      TelemetryConfig `yaml:"telemetry,omitempty"`
+	BenchCacheTTL  int             `yaml:"bench_cache_ttl"` // seconds node and mirror measurements are reused, 0 disables
+
+	warnings []string          // unknown keys found while loading
+	sealed   map[string]string // encrypted fields that couldn't be decrypted, by key
+}
+
+// HookEvents are the operations hooks can run before or after
+var HookEvents = []string{
+	"pre-mirror-enable", "post-mirror-enable",
+	"pre-mirror-disable", "post-mirror-disable",
+	"pre-proxy-start", "post-proxy-start",
+	"pre-proxy-stop", "post-proxy-stop",
+	"pre-node-switch", "post-node-switch",
+}
+
+// HookConfig runs a shell command around an operation. A failing pre- hook
+// cancels the operation; a failing post- hook only prints a warning.
+type HookConfig struct {
+	On      string `yaml:"on"`                // one of HookEvents
+	Run     string `yaml:"run"`               // shell command
+	Timeout int    `yaml:"timeout,omitempty"` // seconds, default 60
+
+	// Source is the file the hook came from if not the user's own
+	// config.yaml, i.e. the system config. Such hooks only run once the
+	// user confirmed them.
+	Source string `yaml:"-"`
+}
+
+// WebhookEvents are the events webhooks can be sent for
+var WebhookEvents = []string{
+	"proxy.down", "proxy.recovered", "proxy.failover",
+	"mirror.enable", "mirror.disable",
+	"subscription.changed",
+}
+
+// WebhookConfig posts notable events to a URL, such as a Slack or Feishu bot
+type WebhookConfig struct {
+	URL    string   `yaml:"url"`
+	Format string   `yaml:"format,omitempty"` // json (default), slack or feishu
+	Events []string `yaml:"events,omitempty"` // some of WebhookEvents, empty means all
+}
+
+// WSLConfig controls what crosh does on Windows when it runs in WSL
+type WSLConfig struct {
+	Windows bool `yaml:"windows"` // also set the mirrors and package proxy for the Windows user
+}
+
+// DaemonConfig controls "crosh daemon", which owns the proxy and serves a
+// local REST API
+type DaemonConfig struct {
+	Port    int `yaml:"port,omitempty"`    // API port on 127.0.0.1, default 7681
+	Refresh int `yaml:"refresh,omitempty"` // hours between subscription refreshes, default 24
+}
+
+// HTTPConfig controls the HTTP client crosh fetches subscriptions, checksums
+// and downloads with
+type HTTPConfig struct {
+	Timeout         int    `yaml:"timeout,omitempty"`          // seconds per API call or subscription fetch, default 30
+	DownloadTimeout int    `yaml:"download_timeout,omitempty"` // seconds per binary or data file download, default 300
+	Proxy           string `yaml:"proxy,omitempty"`            // environment (default), managed (crosh's proxy while it runs), direct, or a proxy URL
+	UserAgent       string `yaml:"user_agent,omitempty"`       // default crosh/<version>
+}
+
+// TelemetryConfig controls the anonymous usage metrics, which are off
+// unless the user turns them on with "crosh telemetry on"
+type TelemetryConfig struct {
+	Enabled  bool   `yaml:"enabled,omitempty"`
+	Endpoint string `yaml:"endpoint,omitempty"` // default https://crosh.boomyao.com/api/telemetry
 }
 
 // MirrorConfig contains mirror settings for package managers
 type MirrorConfig struct {
-	NPM     string   `yaml:"npm"`
-	Pip     string   `yaml:"pip"`
-	Apt     string   `yaml:"apt"`
-	Cargo   string   `yaml:"cargo"`
-	Go      string   `yaml:"go"`
-	Docker  []string `yaml:"docker"`
-	Enabled bool     `yaml:"enabled"`
+	NPM    string      `yaml:"npm"`
+	Pip    string      `yaml:"pip"`
+	Apt    string      `yaml:"apt"`
+	Cargo  string      `yaml:"cargo"`
+	Go     string      `yaml:"go"`
+	Docker []string    `yaml:"docker"`
+	Tools  MirrorTools `yaml:"tools,omitempty"`
+
+	// LegacyEnabled is the old all-or-nothing switch, only read to migrate old configs
+	LegacyEnabled bool `yaml:"enabled,omitempty"`
+}
+
+// MirrorToolNames lists the package managers crosh points at mirrors
+var MirrorToolNames = []string{"npm", "pip", "apt", "cargo", "go", "docker"}
+
+// MirrorTools records which package managers have their mirror enabled
+type MirrorTools struct {
+	NPM    ToolState `yaml:"npm,omitempty"`
+	Pip    ToolState `yaml:"pip,omitempty"`
+	Apt    ToolState `yaml:"apt,omitempty"`
+	Cargo  ToolState `yaml:"cargo,omitempty"`
+	Go     ToolState `yaml:"go,omitempty"`
+	Docker ToolState `yaml:"docker,omitempty"`
+}
+
+// ToolState is whether a tool's mirror is enabled and when that was last applied
+type ToolState struct {
+	Enabled bool      `yaml:"enabled"`
+	Applied time.Time `yaml:"applied,omitempty"`
 }
 
 // ProxyConfig contains proxy settings
 type ProxyConfig struct {
-	SubscriptionURL string `yaml:"subscription_url"`
-	LocalPort       int    `yaml:"local_port"`
-	Enabled         bool   `yaml:"enabled"`
-	XrayPath        string `yaml:"xray_path"`
-	CurrentNode     string `yaml:"current_node,omitempty"`
+	SubscriptionURL string            `yaml:"subscription_url"`
+	LocalPort       int               `yaml:"local_port"` // SOCKS5 port
+	HTTPPort        int               `yaml:"http_port"`
+	StatsPort       int               `yaml:"stats_port"` // Xray stats API, used for traffic counters (0 disables)
+	AllowLAN        bool              `yaml:"allow_lan"`  // listen on 0.0.0.0 instead of 127.0.0.1
+	Enabled         bool              `yaml:"enabled"`
+	XrayPath        string            `yaml:"xray_path"`
+	CurrentNode     string            `yaml:"current_node,omitempty"`
+	Git             GitProxyConfig    `yaml:"git,omitempty"`
+	PackageManagers bool              `yaml:"package_managers,omitempty"` // write proxy into npm/pip/cargo/gradle
+	System          SystemProxyConfig `yaml:"system,omitempty"`           // Windows system proxy
+	Docker          bool              `yaml:"docker,omitempty"`           // Docker daemon proxy drop-in (Linux)
+	LogLevel        string            `yaml:"log_level,omitempty"`        // xray log level: debug, info, warning, error
+	HealthCheck     HealthCheckConfig `yaml:"health_check"`
+	LatencyTest     LatencyTestConfig `yaml:"latency_test"`
+	DNS             DNSConfig         `yaml:"dns"`
+	Bypass          []string          `yaml:"bypass,omitempty"` // domains and IPs that always connect directly
+	UDP             UDPConfig         `yaml:"udp"`
+	NodeOverrides   []NodeOverride    `yaml:"node_overrides,omitempty"`
+}
+
+// NodeOverride replaces parameters of the nodes whose name matches a regular expression
+type NodeOverride struct {
+	Match       string   `yaml:"match"`                 // regular expression, e.g. "^HK|香港"
+	Mux         *bool    `yaml:"mux,omitempty"`         // multiplex connections (vmess, vless, trojan, ss)
+	Fingerprint string   `yaml:"fingerprint,omitempty"` // uTLS fingerprint, e.g. chrome, firefox, safari
+	ALPN        []string `yaml:"alpn,omitempty"`
+	SNI         string   `yaml:"sni,omitempty"`
+}
+
+// UDPConfig controls relaying UDP traffic (QUIC, games, voice chat) through the proxy
+type UDPConfig struct {
+	Enabled       bool     `yaml:"enabled"`
+	DisabledNodes []string `yaml:"disabled_nodes,omitempty"` // nodes whose servers drop UDP
+}
+
+// DNSConfig controls how the proxy resolves domains for its routing rules
+type DNSConfig struct {
+	Enabled     bool     `yaml:"enabled"`
+	Remote      []string `yaml:"remote"`                  // DoH servers queried through the proxy
+	Domestic    []string `yaml:"domestic"`                // DoH servers queried directly for Chinese domains
+	FakeIP      bool     `yaml:"fake_ip"`                 // for TUN / transparent proxy setups
+	FakeIPRange string   `yaml:"fake_ip_range,omitempty"` // defaults to 198.18.0.0/15
+}
+
+// LatencyTestConfig controls how node latency is measured when picking the fastest node
+type LatencyTestConfig struct {
+	Method         string `yaml:"method"`          // tcp (connect to the node) or http (GET url through the node)
+	URL            string `yaml:"url"`             // requested by the http method
+	ExpectedStatus int    `yaml:"expected_status"` // 0 accepts any 2xx/3xx
+	Timeout        int    `yaml:"timeout"`         // seconds per node
+}
+
+// HealthCheckConfig controls periodic proxy probing and automatic node failover
+type HealthCheckConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	URL      string `yaml:"url"`      // probed through the proxy, must return 2xx/3xx
+	Interval int    `yaml:"interval"` // seconds between checks
+	Failures int    `yaml:"failures"` // consecutive failures before switching node
+	Notify   bool   `yaml:"notify"`   // desktop notification when the proxy fails
+}
+
+// GitProxyConfig controls routing git remotes through the proxy
+type GitProxyConfig struct {
+	Enabled bool     `yaml:"enabled"`
+	Hosts   []string `yaml:"hosts,omitempty"` // empty means all remotes
+	SSH     bool     `yaml:"ssh,omitempty"`
+}
+
+// SystemProxyConfig controls pointing the Windows system proxy at crosh
+type SystemProxyConfig struct {
+	Enabled bool `yaml:"enabled"`
+	WinHTTP bool `yaml:"winhttp,omitempty"` // also set the WinHTTP proxy (needs an administrator prompt)
 }
 
-// DefaultConfig returns a configuration with default values
+// DefaultHealthCheckURL returns HTTP 204 and is reachable through most proxies
+const DefaultHealthCheckURL = "https://www.gstatic.com/generate_204"
+
+// DefaultConfig returns a configuration with default values. Keys missing
+// from a config file take these values, so features that older versions
+// didn't have stay off here; NewConfig turns them on for new configs. UDP
+// stays on, as older versions always relayed it.
 func DefaultConfig() *Config {
-	homeDir, _ := os.UserHomeDir()
 	return &Config{
 		Mirror: MirrorConfig{
 			NPM:   "https://registry.npmmirror.com",
@@ -48,69 +224,267 @@ func DefaultConfig() *Config {
 				"docker.1ms.run",
 				"docker.m.daocloud.io",
 			},
-			Enabled: false,
 		},
 		Proxy: ProxyConfig{
 			SubscriptionURL: "",
 			LocalPort:       7676,
+			HTTPPort:        7677,
+			StatsPort:       7678,
 			Enabled:         false,
-			XrayPath:        filepath.Join(homeDir, ".crosh", "xray-core"),
+			XrayPath:        filepath.Join(DataDir(), "xray-core"),
+			LogLevel:        "warning",
+			HealthCheck: HealthCheckConfig{
+				URL:      DefaultHealthCheckURL,
+				Interval: 60,
+				Failures: 3,
+			},
+			LatencyTest: LatencyTestConfig{
+				Method:  "tcp",
+				URL:     DefaultHealthCheckURL,
+				Timeout: 5,
+			},
+			DNS: DNSConfig{
+				Remote:   []string{"https://1.1.1.1/dns-query", "https://8.8.8.8/dns-query"},
+				Domestic: []string{"https://223.5.5.5/dns-query"},
+			},
+			UDP: UDPConfig{
+				Enabled: true,
+			},
 		},
+		BenchCacheTTL: 300,
 	}
 }
 
-// GetConfigPath returns the path to the config file
+// NewConfig returns the configuration of a new user: the defaults with the
+// health monitor, its notifications and the proxy's DNS on
+func NewConfig() *Config {
+	config := DefaultConfig()
+	config.Proxy.HealthCheck.Enabled = true
+	config.Proxy.HealthCheck.Notify = true
+	config.Proxy.DNS.Enabled = true
+	return config
+}
+
+// GetConfigPath returns the path to the config file of the active profile.
+// Its directory is only created when the config is saved, so read-only
+// commands leave the disk alone.
 func GetConfigPath() (string, error) {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
+	if _, err := os.UserHomeDir(); err != nil {
 		return "", fmt.Errorf("failed to get user home directory: %w", err)
 	}
-
-	configDir := filepath.Join(homeDir, ".crosh")
-	if err := os.MkdirAll(configDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create config directory: %w", err)
-	}
-
-	return filepath.Join(configDir, "config.yaml"), nil
+	return ProfilePath(ActiveProfile()), nil
 }
 
-// Load reads the configuration from the config file
+// fixConfigHint is the hint for a config file that doesn't parse
+const fixConfigHint = "run \"crosh config validate\" for details and \"crosh config edit\" to fix it"
+
+// Load reads the configuration from the config file, layered over the
+// system config if there is one
 func Load() (*Config, error) {
 	configPath, err := GetConfigPath()
 	if err != nil {
 		return nil, err
 	}
 
-	// If config file doesn't exist, return default config
+	// If config file doesn't exist, use the defaults and system config
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		return DefaultConfig(), nil
+		return baseConfig(NewConfig())
+	}
+
+	// Start from defaults so keys missing from older config files keep sane values
+	config, err := baseConfig(DefaultConfig())
+	if err != nil {
+		return nil, err
 	}
 
 	data, err := os.ReadFile(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
+	if data, err = toYAML(configPath, data); err != nil {
+		return nil, hint.Wrap(errs.Errorf(errs.ErrParse, "failed to parse config file: %w", err), fixConfigHint)
+	}
 
-	config := &Config{}
 	if err := yaml.Unmarshal(data, config); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
+		return nil, hint.Wrap(errs.Errorf(errs.ErrParse, "failed to parse config file: %w", err), fixConfigHint)
 	}
+	config.warnUnknownKeys(configPath, data)
+	config.Mirror.migrateLegacyEnabled()
+
+	// Follow Xray-core to the XDG data directory after ~/.crosh was migrated
+	if config.Proxy.XrayPath == filepath.Join(legacyDir(), "xray-core") && !usingLegacyDir() {
+		config.Proxy.XrayPath = filepath.Join(DataDir(), "xray-core")
+	}
+
+	config.decryptSecrets()
 
 	return config, nil
 }
 
-// Save writes the configuration to the config file
+// Tool returns the state of a mirror tool by name (see MirrorToolNames)
+func (m *MirrorConfig) Tool(name string) *ToolState {
+	switch name {
+	case "npm":
+		return &m.Tools.NPM
+	case "pip":
+		return &m.Tools.Pip
+	case "apt":
+		return &m.Tools.Apt
+	case "cargo":
+		return &m.Tools.Cargo
+	case "go":
+		return &m.Tools.Go
+	case "docker":
+		return &m.Tools.Docker
+	}
+	return &ToolState{}
+}
+
+// URL returns the mirror configured for a tool, with Docker's registry
+// mirrors joined by commas, or "" if there is none
+func (m *MirrorConfig) URL(name string) string {
+	switch name {
+	case "npm":
+		return m.NPM
+	case "pip":
+		return m.Pip
+	case "apt":
+		return m.Apt
+	case "cargo":
+		return m.Cargo
+	case "go":
+		return m.Go
+	case "docker":
+		return strings.Join(m.Docker, ",")
+	}
+	return ""
+}
+
+// SetURL sets the mirror of a tool, splitting Docker's registry mirrors at
+// commas. An empty url makes crosh leave the tool alone.
+func (m *MirrorConfig) SetURL(name, url string) error {
+	switch name {
+	case "npm":
+		m.NPM = url
+	case "pip":
+		m.Pip = url
+	case "apt":
+		m.Apt = url
+	case "cargo":
+		m.Cargo = url
+	case "go":
+		m.Go = url
+	case "docker":
+		m.Docker = nil
+		for _, registry := range strings.Split(url, ",") {
+			if registry = strings.TrimSpace(registry); registry != "" {
+				m.Docker = append(m.Docker, registry)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown mirror tool: %s (supported: %s)", name, strings.Join(MirrorToolNames, ", "))
+	}
+	return nil
+}
+
+// SetToolEnabled records that a tool's mirror was just enabled or disabled
+func (m *MirrorConfig) SetToolEnabled(name string, enabled bool) {
+	*m.Tool(name) = ToolState{Enabled: enabled, Applied: time.Now()}
+}
+
+// AnyEnabled checks if the mirror of at least one tool is enabled
+func (m *MirrorConfig) AnyEnabled() bool {
+	for _, name := range MirrorToolNames {
+		if m.Tool(name).Enabled {
+			return true
+		}
+	}
+	return false
+}
+
+// migrateLegacyEnabled turns the old all-or-nothing enabled flag into
+// per-tool flags for the tools that have a mirror configured
+func (m *MirrorConfig) migrateLegacyEnabled() {
+	if !m.LegacyEnabled {
+		return
+	}
+	m.LegacyEnabled = false
+	if m.Tools != (MirrorTools{}) {
+		return
+	}
+	configured := map[string]bool{
+		"npm":    m.NPM != "",
+		"pip":    m.Pip != "",
+		"apt":    m.Apt != "",
+		"cargo":  m.Cargo != "",
+		"go":     m.Go != "",
+		"docker": len(m.Docker) > 0,
+	}
+	for _, name := range MirrorToolNames {
+		m.Tool(name).Enabled = configured[name]
+	}
+}
+
+// Warnings returns problems found while loading that didn't stop the config
+// from being used, such as misspelled keys
+func (c *Config) Warnings() []string {
+	return c.warnings
+}
+
+// warnUnknownKeys records a warning for each key in data that is ignored
+func (c *Config) warnUnknownKeys(path string, data []byte) {
+	for _, problem := range UnknownKeys(data) {
+		c.warnings = append(c.warnings, fmt.Sprintf("%s: %v, it is ignored", path, problem))
+	}
+}
+
+// Save writes the configuration to the config file, backing up the previous
+// version first unless backups on save are turned off
 func (c *Config) Save() error {
 	configPath, err := GetConfigPath()
 	if err != nil {
 		return err
 	}
 
-	data, err := yaml.Marshal(c)
+	if saveBackups {
+		if err := BackupProfile(ActiveProfile()); err != nil {
+			return err
+		}
+	}
+
+	return c.saveTo(configPath)
+}
+
+// saveTo writes the configuration to configPath
+func (c *Config) saveTo(configPath string) error {
+	stored := *c
+	// Encrypting must not change the caller's webhooks
+	stored.Webhooks = append([]WebhookConfig(nil), c.Webhooks...)
+	stored.restoreSealed()
+	if c.EncryptSecrets {
+		if err := stored.encryptSecrets(); err != nil {
+			return err
+		}
+	}
+
+	// Only keep the user's own settings when there is a system layer below
+	var data []byte
+	var err error
+	if HasSystemConfig() {
+		data, err = marshalOverrides(&stored)
+	} else {
+		data, err = yaml.Marshal(&stored)
+	}
+	if err == nil {
+		data, err = fromYAML(configPath, data)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
 
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
 	if err := os.WriteFile(configPath, data, 0644); err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// KeyDiff is a setting whose value differs from the default
+type KeyDiff struct {
+	Key     string
+	Default string // empty if the default doesn't have the key
+	Value   string // empty if the config doesn't have the key
+}
+
+// DiffDefaults lists the settings of c that differ from DefaultConfig(),
+// in config file order. Lists are compared as a whole.
+func DiffDefaults(c *Config) ([]KeyDiff, error) {
+	current, err := flattenConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	defaults, err := flattenConfig(DefaultConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []KeyDiff
+	seen := make(map[string]bool)
+	for _, entry := range current {
+		seen[entry.key] = true
+		if def, ok := lookupFlat(defaults, entry.key); !ok || def != entry.value {
+			diffs = append(diffs, KeyDiff{Key: entry.key, Default: def, Value: entry.value})
+		}
+	}
+	for _, entry := range defaults {
+		if !seen[entry.key] {
+			diffs = append(diffs, KeyDiff{Key: entry.key, Default: entry.value})
+		}
+	}
+	return diffs, nil
+}
+
+// flatEntry is a leaf setting rendered as inline YAML
+type flatEntry struct {
+	key   string
+	value string
+}
+
+// flattenConfig turns a config into dot-path keys and inline YAML values
+func flattenConfig(c *Config) ([]flatEntry, error) {
+	var node yaml.Node
+	if err := node.Encode(c); err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	var entries []flatEntry
+	var walk func(node *yaml.Node, path string) error
+	walk = func(node *yaml.Node, path string) error {
+		if node.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key := joinPath(path, node.Content[i].Value)
+				// Which tools are enabled is state, not a customization
+				if key == "mirror.tools" {
+					continue
+				}
+				if err := walk(node.Content[i+1], key); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		value, err := inlineYAML(node)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, flatEntry{key: path, value: value})
+		return nil
+	}
+
+	return entries, walk(&node, "")
+}
+
+// inlineYAML renders a node on a single line, e.g. [a, b] for lists
+func inlineYAML(node *yaml.Node) (string, error) {
+	flow := *node
+	flow.Style |= yaml.FlowStyle
+	data, err := yaml.Marshal(&flow)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal config: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// lookupFlat finds a key in flattened entries
+func lookupFlat(entries []flatEntry, key string) (string, bool) {
+	for _, entry := range entries {
+		if entry.key == key {
+			return entry.value, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// configExtensions are the supported config file formats, in the order they
+// are looked for when more than one exists
+var configExtensions = []string{".yaml", ".yml", ".json", ".toml"}
+
+// findConfigFile returns base plus the extension of the config file that
+// exists, or base.yaml if there is none yet
+func findConfigFile(base string) string {
+	for _, ext := range configExtensions {
+		if _, err := os.Stat(base + ext); err == nil {
+			return base + ext
+		}
+	}
+	return base + ".yaml"
+}
+
+// IsConfigFile checks if name has a supported config file extension
+func IsConfigFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, supported := range configExtensions {
+		if ext == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// isMainConfig checks if name is the default profile's config file
+func isMainConfig(name string) bool {
+	return strings.TrimSuffix(name, filepath.Ext(name)) == "config" && IsConfigFile(name)
+}
+
+// isTOML checks if path is a TOML config
+func isTOML(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".toml")
+}
+
+// isJSON checks if path is a JSON config
+func isJSON(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".json")
+}
+
+// toYAML converts config file content to YAML based on the file extension.
+// JSON is valid YAML and is returned as is, keeping line numbers for errors.
+func toYAML(path string, data []byte) ([]byte, error) {
+	if !isTOML(path) {
+		return data, nil
+	}
+
+	var values map[string]interface{}
+	if err := toml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("failed to parse TOML: %w", err)
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+	return yaml.Marshal(values)
+}
+
+// fromYAML converts YAML config content to the format of path
+func fromYAML(path string, data []byte) ([]byte, error) {
+	switch {
+	case isJSON(path):
+		var node yaml.Node
+		if err := yaml.Unmarshal(data, &node); err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if len(node.Content) > 0 {
+			if err := writeJSON(&buf, node.Content[0], ""); err != nil {
+				return nil, err
+			}
+		} else {
+			buf.WriteString("{}")
+		}
+		buf.WriteString("\n")
+		return buf.Bytes(), nil
+	case isTOML(path):
+		var values map[string]interface{}
+		if err := yaml.Unmarshal(data, &values); err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(values); err != nil {
+			return nil, fmt.Errorf("failed to encode TOML: %w", err)
+		}
+		return buf.Bytes(), nil
+	}
+	return data, nil
+}
+
+// writeJSON writes a YAML node as indented JSON, keeping the key order of
+// the config struct (encoding/json would sort map keys)
+func writeJSON(buf *bytes.Buffer, node *yaml.Node, indent string) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		if len(node.Content) == 0 {
+			buf.WriteString("{}")
+			return nil
+		}
+		buf.WriteString("{\n")
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, _ := json.Marshal(node.Content[i].Value)
+			buf.WriteString(indent + "  ")
+			buf.Write(key)
+			buf.WriteString(": ")
+			if err := writeJSON(buf, node.Content[i+1], indent+"  "); err != nil {
+				return err
+			}
+			if i+2 < len(node.Content) {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString(indent + "}")
+	case yaml.SequenceNode:
+		if len(node.Content) == 0 {
+			buf.WriteString("[]")
+			return nil
+		}
+		buf.WriteString("[\n")
+		for i, item := range node.Content {
+			buf.WriteString(indent + "  ")
+			if err := writeJSON(buf, item, indent+"  "); err != nil {
+				return err
+			}
+			if i+1 < len(node.Content) {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString(indent + "]")
+	case yaml.ScalarNode:
+		var value interface{}
+		if err := node.Decode(&value); err != nil {
+			return err
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+	default:
+		return fmt.Errorf("unsupported YAML node kind %d", node.Kind)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Get returns the value at a dot-path key such as proxy.local_port. Scalars
+// are returned as is, sections and lists as YAML.
+func (c *Config) Get(key string) (string, error) {
+	value, err := lookup(reflect.ValueOf(c).Elem(), key)
+	if err != nil {
+		return "", err
+	}
+
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return "", nil
+		}
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Map:
+		data, err := yaml.Marshal(value.Interface())
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal %s: %w", key, err)
+		}
+		return strings.TrimSuffix(string(data), "\n"), nil
+	default:
+		return fmt.Sprint(value.Interface()), nil
+	}
+}
+
+// Set parses raw as YAML into the value at a dot-path key. Lists of strings
+// also accept comma separated values, e.g. "a.com,b.com".
+func (c *Config) Set(key, raw string) error {
+	value, err := lookup(reflect.ValueOf(c).Elem(), key)
+	if err != nil {
+		return err
+	}
+	if !value.CanSet() {
+		return fmt.Errorf("%s can't be set", key)
+	}
+
+	parsed := reflect.New(value.Type())
+	if isStringList(value.Type()) && !strings.HasPrefix(strings.TrimSpace(raw), "[") {
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		parsed.Elem().Set(reflect.ValueOf(items))
+	} else if value.Kind() == reflect.String {
+		// Keep strings verbatim so values like "off" or "1.10" aren't reinterpreted
+		parsed.Elem().SetString(raw)
+	} else if err := yaml.Unmarshal([]byte(raw), parsed.Interface()); err != nil {
+		return fmt.Errorf("invalid value for %s (expected %s): %w", key, describeType(value.Type()), err)
+	}
+
+	value.Set(parsed.Elem())
+	return nil
+}
+
+// Reset restores the value at a dot-path key to its default, or to the
+// system config's value if it sets one
+func (c *Config) Reset(key string) error {
+	base, err := baseConfig(DefaultConfig())
+	if err != nil {
+		return err
+	}
+
+	original, err := lookup(reflect.ValueOf(base).Elem(), key)
+	if err != nil {
+		return err
+	}
+	value, err := lookup(reflect.ValueOf(c).Elem(), key)
+	if err != nil {
+		return err
+	}
+	if !value.CanSet() {
+		return fmt.Errorf("%s can't be reset", key)
+	}
+
+	value.Set(original)
+	return nil
+}
+
+// lookup walks the yaml keys (and list indexes) of a dot-path
+func lookup(value reflect.Value, key string) (reflect.Value, error) {
+	if key == "" {
+		return reflect.Value{}, fmt.Errorf("empty key")
+	}
+
+	path := ""
+	for _, part := range strings.Split(key, ".") {
+		path = joinPath(path, part)
+		for value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				value.Set(reflect.New(value.Type().Elem()))
+			}
+			value = value.Elem()
+		}
+
+		switch value.Kind() {
+		case reflect.Struct:
+			field, ok := structField(value, part)
+			if !ok {
+				return reflect.Value{}, fmt.Errorf("unknown key %s", path)
+			}
+			value = field
+		case reflect.Slice:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= value.Len() {
+				return reflect.Value{}, fmt.Errorf("%s: no list item %s (list has %d items)", path, part, value.Len())
+			}
+			value = value.Index(i)
+		default:
+			return reflect.Value{}, fmt.Errorf("unknown key %s", path)
+		}
+	}
+
+	return value, nil
+}
+
+// structField returns the field of a struct value with the given yaml key
+func structField(value reflect.Value, key string) (reflect.Value, bool) {
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if name == "" {
+			name = strings.ToLower(t.Field(i).Name)
+		}
+		if name == key && t.Field(i).IsExported() {
+			return value.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// isStringList checks if t is []string
+func isStringList(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.String
+}
+
+// describeType names a config value type for error messages
+func describeType(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int:
+		return "a number"
+	case reflect.Slice:
+		return "a list"
+	case reflect.Struct:
+		return "a YAML mapping"
+	default:
+		return t.Kind().String()
+	}
+}
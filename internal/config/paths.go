@@ -0,0 +1,225 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/boomyao/crosh/internal/hint"
+)
+
+// stateFiles are the legacy ~/.crosh entries that belong in the state directory
+var stateFiles = map[string]bool{
+	"logs":                 true,
+	"xray.pid":             true,
+	"monitor.pid":          true,
+	"applied.json":         true,
+	"subscription.updated": true,
+	"profile":              true,
+	"audit.log":            true,
+	"audit.log.1":          true,
+}
+
+// legacyDir returns the pre-XDG directory that held all of crosh's files
+func legacyDir() string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".crosh")
+}
+
+// usingLegacyDir checks if ~/.crosh is still in use because it hasn't been
+// migrated yet (or because this platform keeps everything there)
+func usingLegacyDir() bool {
+	_, err := os.Stat(legacyDir())
+	return err == nil
+}
+
+// xdgDir returns $env/crosh, falling back to ~/<fallback>/crosh. Windows has
+// no XDG convention, so it keeps ~/.crosh unless the variable is set.
+func xdgDir(env, fallback string) string {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "crosh")
+	}
+	if runtime.GOOS == "windows" {
+		return legacyDir()
+	}
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, fallback, "crosh")
+}
+
+// ConfigDir returns the directory holding config.yaml ($XDG_CONFIG_HOME/crosh)
+func ConfigDir() string {
+	if usingLegacyDir() {
+		return legacyDir()
+	}
+	return xdgDir("XDG_CONFIG_HOME", ".config")
+}
+
+// DataDir returns the directory holding Xray-core, sing-box, geodata and
+// nodes ($XDG_DATA_HOME/crosh)
+func DataDir() string {
+	if usingLegacyDir() {
+		return legacyDir()
+	}
+	return xdgDir("XDG_DATA_HOME", filepath.Join(".local", "share"))
+}
+
+// StateDir returns the directory holding logs, PID files and applied
+// settings ($XDG_STATE_HOME/crosh)
+func StateDir() string {
+	if usingLegacyDir() {
+		return legacyDir()
+	}
+	return xdgDir("XDG_STATE_HOME", filepath.Join(".local", "state"))
+}
+
+// CacheDir returns the directory holding downloaded packages cached by
+// "crosh cache serve" ($XDG_CACHE_HOME/crosh)
+func CacheDir() string {
+	if usingLegacyDir() {
+		return filepath.Join(legacyDir(), "cache")
+	}
+	return xdgDir("XDG_CACHE_HOME", ".cache")
+}
+
+// BenchCachePath returns the file holding recent node and mirror measurements
+func BenchCachePath() string {
+	return filepath.Join(StateDir(), "bench-cache.json")
+}
+
+// LogPath returns crosh's own log file, next to the proxy logs
+func LogPath() string {
+	return filepath.Join(StateDir(), "logs", "crosh.log")
+}
+
+// RemoveAll deletes crosh's data, state and cache directories, and its config
+// directory unless keepConfig is set. It returns the directories removed.
+func RemoveAll(keepConfig bool) ([]string, error) {
+	// ~/.crosh holds everything, so with keepConfig only the rest goes
+	if usingLegacyDir() {
+		dir := legacyDir()
+		var err error
+		if keepConfig {
+			err = removeLegacyExceptConfig(dir)
+		} else if err = os.RemoveAll(dir); err != nil {
+			err = fmt.Errorf("failed to remove %s: %w", dir, err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return []string{dir}, nil
+	}
+
+	dirs := []string{DataDir(), StateDir(), CacheDir()}
+	if !keepConfig {
+		dirs = append(dirs, ConfigDir())
+	}
+
+	var removed []string
+	for _, dir := range dirs {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return removed, fmt.Errorf("failed to remove %s: %w", dir, err)
+		}
+		removed = append(removed, dir)
+	}
+	return removed, nil
+}
+
+// removeLegacyExceptConfig empties ~/.crosh except for the config files
+func removeLegacyExceptConfig(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	for _, entry := range entries {
+		if isMainConfig(entry.Name()) || entry.Name() == "profiles" || entry.Name() == "backups" {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", entry.Name(), err)
+		}
+	}
+	return nil
+}
+
+// MigrateLegacyDir moves the files in ~/.crosh into the XDG directories. It
+// returns false without doing anything if there is nothing to migrate, and
+// an error if the proxy or health monitor is still running from the old
+// location, which running reports for a PID file (proxy.BackgroundRunning).
+// On failure everything is put back.
+func MigrateLegacyDir(running func(pidFile string) (int, bool)) (bool, error) {
+	legacy := legacyDir()
+	entries, err := os.ReadDir(legacy)
+	if err != nil {
+		return false, nil
+	}
+
+	configDir := xdgDir("XDG_CONFIG_HOME", ".config")
+	dataDir := xdgDir("XDG_DATA_HOME", filepath.Join(".local", "share"))
+	stateDir := xdgDir("XDG_STATE_HOME", filepath.Join(".local", "state"))
+	if configDir == legacy || dataDir == legacy || stateDir == legacy {
+		return false, nil
+	}
+
+	// Moving files under a running proxy or monitor would make crosh lose
+	// track of them. A PID file left by one that died doesn't count.
+	for _, process := range []struct{ pidFile, name string }{
+		{"xray.pid", "the proxy"},
+		{"monitor.pid", "the health monitor"},
+	} {
+		if pid, alive := running(filepath.Join(legacy, process.pidFile)); alive {
+			return false, hint.Errorf(`stop it with "crosh off", and the next crosh command moves the files`,
+				"%s is still running from %s (PID %d)", process.name, legacy, pid)
+		}
+	}
+
+	type move struct{ from, to string }
+	var moved []move
+	rollback := func() {
+		for i := len(moved) - 1; i >= 0; i-- {
+			os.Rename(moved[i].to, moved[i].from)
+		}
+	}
+
+	for _, entry := range entries {
+		// Only downloads that can be fetched again
+		if entry.Name() == "cache" {
+			os.RemoveAll(filepath.Join(legacy, entry.Name()))
+			continue
+		}
+
+		target := dataDir
+		switch {
+		case isMainConfig(entry.Name()) || entry.Name() == "profiles" || entry.Name() == "backups":
+			target = configDir
+		case stateFiles[entry.Name()]:
+			target = stateDir
+		}
+
+		from := filepath.Join(legacy, entry.Name())
+		to := filepath.Join(target, entry.Name())
+		if _, err := os.Stat(to); err == nil {
+			rollback()
+			return false, fmt.Errorf("both %s and %s exist, remove one of them", from, to)
+		}
+		if err := os.MkdirAll(target, 0755); err != nil {
+			rollback()
+			return false, fmt.Errorf("failed to create %s: %w", target, err)
+		}
+		if err := os.Rename(from, to); err != nil {
+			rollback()
+			return false, fmt.Errorf("failed to move %s: %w", from, err)
+		}
+		moved = append(moved, move{from, to})
+	}
+
+	if err := os.Remove(legacy); err != nil {
+		rollback()
+		return false, fmt.Errorf("failed to remove %s: %w", legacy, err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultProfile is the profile stored in config.yaml itself
+const DefaultProfile = "default"
+
+// profileNamePattern restricts profile names to safe file names
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// ValidProfileName checks if name can be used as a profile name
+func ValidProfileName(name string) bool {
+	return profileNamePattern.MatchString(name)
+}
+
+// profilesDir returns the directory holding the non-default profiles
+func profilesDir() string {
+	return filepath.Join(ConfigDir(), "profiles")
+}
+
+// activeProfilePath returns the state file recording the active profile
+func activeProfilePath() string {
+	return filepath.Join(StateDir(), "profile")
+}
+
+// ProfilePath returns the config file of a profile
+func ProfilePath(name string) string {
+	if name == DefaultProfile {
+		return findConfigFile(filepath.Join(ConfigDir(), "config"))
+	}
+	return findConfigFile(filepath.Join(profilesDir(), name))
+}
+
+// ActiveProfile returns the name of the profile in use
+func ActiveProfile() string {
+	data, err := os.ReadFile(activeProfilePath())
+	if err != nil {
+		return DefaultProfile
+	}
+	name := strings.TrimSpace(string(data))
+	if !ValidProfileName(name) || !ProfileExists(name) {
+		return DefaultProfile
+	}
+	return name
+}
+
+// SetActiveProfile makes name the profile loaded by future commands
+func SetActiveProfile(name string) error {
+	if !ProfileExists(name) {
+		return fmt.Errorf("profile %q doesn't exist", name)
+	}
+
+	if err := os.MkdirAll(StateDir(), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	if err := os.WriteFile(activeProfilePath(), []byte(name+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to record active profile: %w", err)
+	}
+
+	return nil
+}
+
+// ProfileExists checks if a profile has been created. The default profile
+// always exists, even before config.yaml is first written.
+func ProfileExists(name string) bool {
+	if name == DefaultProfile {
+		return true
+	}
+	_, err := os.Stat(ProfilePath(name))
+	return err == nil
+}
+
+// ListProfiles returns the default profile followed by the others, sorted
+func ListProfiles() ([]string, error) {
+	entries, err := os.ReadDir(profilesDir())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read profiles: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		if !entry.IsDir() && IsConfigFile(entry.Name()) && ValidProfileName(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return append([]string{DefaultProfile}, names...), nil
+}
+
+// CreateProfile saves cfg as a new profile
+func CreateProfile(name string, cfg *Config) error {
+	if !ValidProfileName(name) {
+		return fmt.Errorf("invalid profile name %q (use letters, digits, - and _)", name)
+	}
+	if ProfileExists(name) {
+		return fmt.Errorf("profile %q already exists", name)
+	}
+
+	if err := os.MkdirAll(profilesDir(), 0755); err != nil {
+		return fmt.Errorf("failed to create profiles directory: %w", err)
+	}
+
+	return cfg.saveTo(ProfilePath(name))
+}
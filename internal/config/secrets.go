@@ -0,0 +1,394 @@
+package config
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// encryptedPrefix marks a config value encrypted with the secret key
+const encryptedPrefix = "enc:v1:"
+
+// Keyring entry holding the secret key
+const (
+	keyringService = "crosh"
+	keyringAccount = "config-secret-key"
+)
+
+// errNoSecretKey is returned when no secret key has been created yet, as
+// opposed to one that can't be read right now, say from a locked keyring
+var errNoSecretKey = errors.New("no secret key was found")
+
+// encryptedPattern finds encrypted values in raw YAML
+var encryptedPattern = regexp.MustCompile(`"?enc:v1:[A-Za-z0-9+/=]+"?`)
+
+// IsEncrypted checks if a config value is stored encrypted
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// secretField is a config value that may hold credentials, named by its
+// key, e.g. mirror.npm
+type secretField struct {
+	name  string
+	value *string
+}
+
+// secretFields returns the config values that may hold credentials. Mirror
+// URLs only count when they embed a user name or password.
+func (c *Config) secretFields() []secretField {
+	fields := []secretField{{"proxy.subscription_url", &c.Proxy.SubscriptionURL}}
+	for i := range c.Webhooks {
+		// Bot URLs carry their token
+		fields = append(fields, secretField{fmt.Sprintf("webhooks.%d.url", i), &c.Webhooks[i].URL})
+	}
+	mirrors := []secretField{
+		{"mirror.npm", &c.Mirror.NPM},
+		{"mirror.pip", &c.Mirror.Pip},
+		{"mirror.cargo", &c.Mirror.Cargo},
+		{"mirror.go", &c.Mirror.Go},
+	}
+	for _, mirror := range mirrors {
+		if hasUserInfo(*mirror.value) || IsEncrypted(*mirror.value) || c.sealed[mirror.name] != "" {
+			fields = append(fields, mirror)
+		}
+	}
+	return fields
+}
+
+// hasUserInfo checks if any URL in a comma separated list contains credentials
+func hasUserInfo(value string) bool {
+	for _, entry := range strings.Split(value, ",") {
+		if u, err := url.Parse(strings.TrimSpace(entry)); err == nil && u.User != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// encryptSecrets encrypts the secret fields in place. It only creates a
+// secret key while no field is sealed: a new key would leave the values
+// sealed under the missing one undecryptable for good.
+func (c *Config) encryptSecrets() error {
+	for _, field := range c.secretFields() {
+		if *field.value == "" || IsEncrypted(*field.value) {
+			continue
+		}
+		encrypted, err := encryptSecret(*field.value, len(c.sealed) == 0)
+		if errors.Is(err, errNoSecretKey) {
+			return fmt.Errorf("failed to encrypt %s: %w, and a new one would leave %s unreadable", field.name, err, strings.Join(c.sealedNames(), ", "))
+		}
+		if err != nil {
+			return err
+		}
+		*field.value = encrypted
+	}
+	return nil
+}
+
+// decryptSecrets decrypts any encrypted secret fields in place. A field
+// that can't be decrypted, say while the keyring is locked, is left empty
+// with a warning instead of failing every command, and Save writes it back
+// as it was.
+func (c *Config) decryptSecrets() {
+	var sealed []string
+	var lastErr error
+	for _, field := range c.secretFields() {
+		if !IsEncrypted(*field.value) {
+			continue
+		}
+		plain, err := decryptSecret(*field.value)
+		if err != nil {
+			if c.sealed == nil {
+				c.sealed = make(map[string]string)
+			}
+			c.sealed[field.name] = *field.value
+			*field.value = ""
+			sealed, lastErr = append(sealed, field.name), err
+			continue
+		}
+		*field.value = plain
+	}
+	if len(sealed) > 0 {
+		c.warnings = append(c.warnings, fmt.Sprintf("%v; crosh works as if %s weren't set", lastErr, strings.Join(sealed, ", ")))
+	}
+}
+
+// sealedNames returns the fields decryptSecrets couldn't decrypt
+func (c *Config) sealedNames() []string {
+	var names []string
+	for _, field := range c.secretFields() {
+		if c.sealed[field.name] != "" {
+			names = append(names, field.name)
+		}
+	}
+	return names
+}
+
+// restoreSealed puts back the fields decryptSecrets couldn't decrypt, unless
+// they were set to something else since
+func (c *Config) restoreSealed() {
+	for _, field := range c.secretFields() {
+		if sealed := c.sealed[field.name]; sealed != "" && *field.value == "" {
+			*field.value = sealed
+		}
+	}
+}
+
+// decryptSecretsInYAML replaces encrypted values in a raw YAML, JSON or TOML
+// config with their quoted plaintext, for moving a config to a machine without the key
+func decryptSecretsInYAML(data []byte) ([]byte, error) {
+	var firstErr error
+	result := encryptedPattern.ReplaceAllFunc(data, func(match []byte) []byte {
+		plain, err := decryptSecret(strings.Trim(string(match), `"`))
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			return match
+		}
+		return []byte(strconv.Quote(plain))
+	})
+	return result, firstErr
+}
+
+// encryptSecret encrypts value with AES-256-GCM, creating the secret key if
+// create is set and none exists yet
+func encryptSecret(value string, create bool) (string, error) {
+	gcm, err := secretCipher(create)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(value), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptSecret decrypts a value produced by encryptSecret
+func decryptSecret(value string) (string, error) {
+	gcm, err := secretCipher(false)
+	if err != nil {
+		return "", fmt.Errorf("config contains encrypted values but %w", err)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("corrupt encrypted value")
+	}
+
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt config secret (wrong key?): %w", err)
+	}
+	return string(plain), nil
+}
+
+// The secret key, read once per process since every encrypted field needs
+// it and reading the keyring starts a program. A failure is kept too.
+var (
+	secretKeyMu  sync.Mutex
+	secretKey    []byte
+	secretKeyErr error
+)
+
+// secretCipher returns an AES-GCM cipher using the secret key, creating the
+// key if create is set and none exists yet. A key that exists but can't be
+// read is never replaced.
+func secretCipher(create bool) (cipher.AEAD, error) {
+	key, err := cachedSecretKey()
+	if create && errors.Is(err, errNoSecretKey) {
+		key, err = createSecretKey()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// secretKeyFile is the fallback key location when no OS keyring is
+// available. It lives in the data directory so config backups and bundles
+// never contain it.
+func secretKeyFile() string {
+	return filepath.Join(DataDir(), "secret.key")
+}
+
+// SecretKeyLocation describes where the secret key is kept
+func SecretKeyLocation() string {
+	if _, err := os.Stat(secretKeyFile()); err == nil {
+		return secretKeyFile()
+	}
+	return "OS keyring (" + keyringService + "/" + keyringAccount + ")"
+}
+
+// cachedSecretKey returns the key loadSecretKey read first
+func cachedSecretKey() ([]byte, error) {
+	secretKeyMu.Lock()
+	defer secretKeyMu.Unlock()
+	if secretKey == nil && secretKeyErr == nil {
+		secretKey, secretKeyErr = loadSecretKey()
+	}
+	return secretKey, secretKeyErr
+}
+
+// loadSecretKey reads the key from the key file or the OS keyring
+func loadSecretKey() ([]byte, error) {
+	encoded, err := os.ReadFile(secretKeyFile())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("the secret key can't be read: %w", err)
+	}
+	if err != nil {
+		if encoded, err = keyringGet(); err != nil {
+			return nil, err
+		}
+	}
+
+	key, err := hex.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("the secret key is corrupt")
+	}
+	return key, nil
+}
+
+// createSecretKey generates a new key, storing it in the OS keyring if
+// possible and in a private key file otherwise
+func createSecretKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate secret key: %w", err)
+	}
+	encoded := hex.EncodeToString(key)
+	defer func() {
+		secretKeyMu.Lock()
+		secretKey, secretKeyErr = key, nil
+		secretKeyMu.Unlock()
+	}()
+
+	if keyringSet(encoded) == nil {
+		return key, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(secretKeyFile()), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+	if err := os.WriteFile(secretKeyFile(), []byte(encoded+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write secret key: %w", err)
+	}
+	return key, nil
+}
+
+// keyringGet reads the key from the macOS keychain or the Secret Service
+// (GNOME Keyring, KWallet) via secret-tool. It returns errNoSecretKey only
+// when the key isn't there, not when the keyring can't be read.
+func keyringGet() ([]byte, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", keyringService, "-a", keyringAccount, "-w")
+	case "linux", "freebsd":
+		cmd = exec.Command("secret-tool", "lookup", "service", keyringService, "account", keyringAccount)
+	default:
+		return nil, errNoSecretKey
+	}
+
+	out, err := cmd.Output()
+	if err == nil && len(strings.TrimSpace(string(out))) > 0 {
+		return out, nil
+	}
+	if keyringMissing(err) {
+		return nil, errNoSecretKey
+	}
+	return nil, fmt.Errorf("the secret key can't be read from the OS keyring (is it unlocked?)")
+}
+
+// keyringMissing checks if keyringGet's lookup failed with err because the
+// key isn't in the keyring, rather than because the keyring is locked or
+// unreachable. security exits with 44 for a missing item, and secret-tool
+// exits without a message.
+func keyringMissing(err error) bool {
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil, errors.Is(err, exec.ErrNotFound):
+		return true
+	case !errors.As(err, &exitErr):
+		return false
+	case runtime.GOOS == "darwin":
+		return exitErr.ExitCode() == 44
+	default:
+		return len(bytes.TrimSpace(exitErr.Stderr)) == 0
+	}
+}
+
+// DeleteSecretKey removes the key from the OS keyring, where there is one.
+// The key file goes with the data directory.
+func DeleteSecretKey() error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "delete-generic-password", "-s", keyringService, "-a", keyringAccount)
+	case "linux", "freebsd":
+		if _, err := exec.LookPath("secret-tool"); err != nil {
+			return nil
+		}
+		cmd = exec.Command("secret-tool", "clear", "service", keyringService, "account", keyringAccount)
+	default:
+		return nil
+	}
+
+	if _, err := keyringGet(); err != nil {
+		return nil // Never stored there, or the keyring is unavailable
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to remove the secret key from the OS keyring: %w", err)
+	}
+	return nil
+}
+
+// keyringSet stores the key in the OS keyring
+func keyringSet(encoded string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		// Read from stdin in interactive mode, since arguments show in ps
+		cmd = exec.Command("security", "-i")
+		cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n", keyringService, keyringAccount, encoded))
+	case "linux", "freebsd":
+		cmd = exec.Command("secret-tool", "store", "--label=crosh config secret key", "service", keyringService, "account", keyringAccount)
+		cmd.Stdin = strings.NewReader(encoded)
+	default:
+		return fmt.Errorf("no OS keyring support on %s", runtime.GOOS)
+	}
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to store secret key in the OS keyring: %w", err)
+	}
+
+	// Make sure it can be read back before relying on it
+	if stored, err := keyringGet(); err != nil || strings.TrimSpace(string(stored)) != encoded {
+		return fmt.Errorf("OS keyring didn't keep the secret key")
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/boomyao/crosh/internal/errs"
+)
+
+// SystemConfigPath returns the admin-provided config that user configs are
+// layered on top of (/etc/crosh/config.yaml)
+func SystemConfigPath() string {
+	if path := os.Getenv("CROSH_SYSTEM_CONFIG"); path != "" {
+		return path
+	}
+	if runtime.GOOS == "windows" {
+		programData := os.Getenv("ProgramData")
+		if programData == "" {
+			programData = `C:\ProgramData`
+		}
+		return filepath.Join(programData, "crosh", "config.yaml")
+	}
+	return "/etc/crosh/config.yaml"
+}
+
+// HasSystemConfig checks if a system config is present
+func HasSystemConfig() bool {
+	_, err := os.Stat(SystemConfigPath())
+	return err == nil
+}
+
+// baseConfig merges the system config over config and returns it
+func baseConfig(config *Config) (*Config, error) {
+	data, err := os.ReadFile(SystemConfigPath())
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read system config: %w", err)
+	}
+
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, errs.Errorf(errs.ErrParse, "failed to parse system config %s: %w", SystemConfigPath(), err)
+	}
+	config.warnUnknownKeys(SystemConfigPath(), data)
+	// A user config that sets hooks replaces the list, and with it these
+	for i := range config.Hooks {
+		config.Hooks[i].Source = SystemConfigPath()
+	}
+	return config, nil
+}
+
+// marshalOverrides marshals c leaving out the values it shares with the
+// system config, so later changes by the admin still reach the user
+func marshalOverrides(c *Config) ([]byte, error) {
+	base, err := baseConfig(DefaultConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	var node, baseNode yaml.Node
+	if err := node.Encode(c); err != nil {
+		return nil, err
+	}
+	if err := baseNode.Encode(base); err != nil {
+		return nil, err
+	}
+
+	stripInherited(&node, &baseNode)
+	return yaml.Marshal(&node)
+}
+
+// stripInherited removes the keys of a mapping node whose values equal those
+// in base, recursing into nested mappings
+func stripInherited(node, base *yaml.Node) {
+	if node.Kind != yaml.MappingNode || base.Kind != yaml.MappingNode {
+		return
+	}
+
+	baseValues := make(map[string]*yaml.Node)
+	for i := 0; i+1 < len(base.Content); i += 2 {
+		baseValues[base.Content[i].Value] = base.Content[i+1]
+	}
+
+	var kept []*yaml.Node
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if baseValue, ok := baseValues[key.Value]; ok {
+			if value.Kind == yaml.MappingNode {
+				stripInherited(value, baseValue)
+				if len(value.Content) == 0 {
+					continue
+				}
+			} else if sameNode(value, baseValue) {
+				continue
+			}
+		}
+		kept = append(kept, key, value)
+	}
+	node.Content = kept
+}
+
+// sameNode checks if two nodes marshal to the same YAML
+func sameNode(a, b *yaml.Node) bool {
+	dataA, errA := yaml.Marshal(a)
+	dataB, errB := yaml.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(dataA, dataB)
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/boomyao/crosh/internal/httpclient"
+)
+
+// maxTemplateSize bounds how much of a template URL is read
+const maxTemplateSize = 1 << 20
+
+// TemplateVerification says how a fetched template must be verified
+type TemplateVerification struct {
+	SHA256    string // expected hex checksum of the template
+	PublicKey string // base64 ed25519 key that signed it; the signature is fetched from <url>.sig
+}
+
+// FetchTemplate downloads an organization template and verifies it against
+// a checksum and/or signature
+func FetchTemplate(url string, verify TemplateVerification) ([]byte, error) {
+	data, err := fetchURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	if verify.SHA256 != "" {
+		sum := sha256.Sum256(data)
+		if !strings.EqualFold(hex.EncodeToString(sum[:]), strings.TrimSpace(verify.SHA256)) {
+			return nil, fmt.Errorf("template checksum mismatch: got sha256 %s", hex.EncodeToString(sum[:]))
+		}
+	}
+
+	if verify.PublicKey != "" {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(verify.PublicKey))
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid public key, expected a base64 ed25519 key")
+		}
+		sigData, err := fetchURL(url + ".sig")
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch template signature: %w", err)
+		}
+		sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sigData)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid template signature: %w", err)
+		}
+		if !ed25519.Verify(ed25519.PublicKey(key), data, sig) {
+			return nil, fmt.Errorf("template signature doesn't match the public key")
+		}
+	}
+
+	return data, nil
+}
+
+// fetchURL downloads a small file
+func fetchURL(url string) ([]byte, error) {
+	resp, err := httpclient.Client().Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status: %d", url, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxTemplateSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", url, err)
+	}
+	if len(data) > maxTemplateSize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", url, maxTemplateSize)
+	}
+	return data, nil
+}
+
+// MergeTemplate validates a template and applies the settings it contains
+// on top of c, leaving everything else alone. It returns the changed
+// settings as "key = value".
+func (c *Config) MergeTemplate(data []byte) ([]string, error) {
+	problems, err := Validate(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	if len(problems) > 0 {
+		var lines []string
+		for _, problem := range problems {
+			lines = append(lines, problem.Error())
+		}
+		return nil, fmt.Errorf("invalid template:\n  %s", strings.Join(lines, "\n  "))
+	}
+
+	before, err := flattenConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(c); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	after, err := flattenConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	for _, entry := range after {
+		if value, ok := lookupFlat(before, entry.key); !ok || value != entry.value {
+			changed = append(changed, entry.key+" = "+entry.value)
+		}
+	}
+	return changed, nil
+}
@@ -0,0 +1,541 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/boomyao/crosh/internal/errs"
+)
+
+// ValidationError describes a problem in config.yaml and where it is
+type ValidationError struct {
+	Line    int    // 0 when the key isn't in the file (its default is used)
+	Key     string // dotted path, e.g. proxy.local_port
+	Message string
+}
+
+// Error formats the problem as "line 12: proxy.local_port: message"
+func (e ValidationError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s: %s", e.Line, e.Key, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Key, e.Message)
+}
+
+// ValidateFile checks the config file at path. It returns the problems
+// found, or an error if the file can't be read or isn't YAML at all.
+func ValidateFile(path string) ([]ValidationError, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return ValidateFormat(path, data)
+}
+
+// ValidateFormat checks config content in the format given by the extension
+// of path: YAML, JSON or TOML
+func ValidateFormat(path string, data []byte) ([]ValidationError, error) {
+	data, err := toYAML(path, data)
+	if err != nil {
+		return nil, errs.Errorf(errs.ErrParse, "failed to parse config file: %w", err)
+	}
+	return Validate(data)
+}
+
+// Validate checks config.yaml content for unknown keys, wrong types, invalid
+// URLs and ports, and conflicting options
+func Validate(data []byte) ([]ValidationError, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, errs.Errorf(errs.ErrParse, "failed to parse config file: %w", err)
+	}
+	if len(root.Content) == 0 {
+		return nil, nil // empty file, defaults apply
+	}
+
+	v := &validator{root: root.Content[0]}
+	v.checkKeys(v.root, reflect.TypeOf(Config{}), "")
+
+	cfg := DefaultConfig()
+	if err := v.root.Decode(cfg); err != nil {
+		typeErr, ok := err.(*yaml.TypeError)
+		if !ok {
+			return nil, errs.Errorf(errs.ErrParse, "failed to parse config file: %w", err)
+		}
+		// Type errors read "line N: cannot unmarshal ..."
+		for _, msg := range typeErr.Errors {
+			v.errors = append(v.errors, v.typeError(msg))
+		}
+	}
+
+	v.checkMirror(&cfg.Mirror)
+	v.checkProxy(&cfg.Proxy)
+	v.checkHooks(cfg.Hooks)
+	v.checkWebhooks(cfg.Webhooks)
+	v.checkPort("daemon.port", cfg.Daemon.Port, true)
+	if cfg.Daemon.Refresh < 0 {
+		v.addf("daemon.refresh", "must not be negative")
+	}
+	v.checkHTTP(&cfg.HTTP)
+	v.checkURL("telemetry.endpoint", cfg.Telemetry.Endpoint, "http", "https")
+	if cfg.BenchCacheTTL < 0 {
+		v.addf("bench_cache_ttl", "must not be negative")
+	}
+	if cfg.Language != "" && !oneOf(cfg.Language, "auto", "en", "zh") {
+		v.addf("language", "unknown language %q (expected auto, en or zh)", cfg.Language)
+	}
+	if cfg.Sudo != "" && !oneOf(cfg.Sudo, "auto", "sudo", "doas") {
+		v.addf("sudo", "unknown command %q (expected auto, sudo or doas)", cfg.Sudo)
+	}
+
+	sort.SliceStable(v.errors, func(i, j int) bool {
+		return v.errors[i].Line < v.errors[j].Line
+	})
+	return v.errors, nil
+}
+
+// UnknownKeys returns the keys in config.yaml content that don't match any
+// setting and would be silently ignored when loading it
+func UnknownKeys(data []byte) []ValidationError {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil || len(root.Content) == 0 {
+		return nil
+	}
+
+	v := &validator{root: root.Content[0]}
+	v.checkKeys(v.root, reflect.TypeOf(Config{}), "")
+	return v.errors
+}
+
+// validator collects problems, looking up line numbers in the YAML tree
+type validator struct {
+	root   *yaml.Node
+	errors []ValidationError
+}
+
+// addf records a problem with the key at path
+func (v *validator) addf(path, format string, args ...interface{}) {
+	v.errors = append(v.errors, ValidationError{
+		Line:    v.line(path),
+		Key:     path,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// line returns the line of the value at a dotted path (list items are
+// addressed by index, e.g. proxy.bypass.2), or 0 if it isn't in the file
+func (v *validator) line(path string) int {
+	node := v.root
+	for _, part := range strings.Split(path, ".") {
+		node = child(node, part)
+		if node == nil {
+			return 0
+		}
+	}
+	return node.Line
+}
+
+// child returns the value of a mapping key or sequence index
+func child(node *yaml.Node, part string) *yaml.Node {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == part {
+				return node.Content[i+1]
+			}
+		}
+	case yaml.SequenceNode:
+		if i, err := strconv.Atoi(part); err == nil && i >= 0 && i < len(node.Content) {
+			return node.Content[i]
+		}
+	}
+	return nil
+}
+
+// checkKeys reports mapping keys that don't correspond to a config field
+func (v *validator) checkKeys(node *yaml.Node, t reflect.Type, path string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case node.Kind == yaml.SequenceNode && t.Kind() == reflect.Slice:
+		for i, item := range node.Content {
+			v.checkKeys(item, t.Elem(), joinPath(path, strconv.Itoa(i)))
+		}
+	case node.Kind == yaml.MappingNode && t.Kind() == reflect.Struct:
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			field, ok := fields[key.Value]
+			if !ok {
+				msg := "unknown key"
+				if suggestion := closestKey(key.Value, fields); suggestion != "" {
+					msg += fmt.Sprintf(" (did you mean %q?)", suggestion)
+				} else if sections := keySections(key.Value, reflect.TypeOf(Config{}), ""); len(sections) == 1 {
+					if sections[0] == "" {
+						msg += " (it belongs at the top level)"
+					} else {
+						msg += fmt.Sprintf(" (it belongs under %s)", sections[0])
+					}
+				}
+				v.errors = append(v.errors, ValidationError{Line: key.Line, Key: joinPath(path, key.Value), Message: msg})
+				continue
+			}
+			v.checkKeys(value, field, joinPath(path, key.Value))
+		}
+	}
+}
+
+// yamlFields maps the yaml keys of a struct to their field types
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+// closestKey suggests a known key for common slips like "local-port",
+// "LocalPort" or "mirorr"
+func closestKey(key string, fields map[string]reflect.Type) string {
+	normalize := func(s string) string {
+		return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(s))
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	best, bestDistance := "", 3 // more than two typos is probably a different key
+	for _, name := range names {
+		distance := editDistance(normalize(name), normalize(key))
+		if distance < bestDistance && distance < len(name)/2+1 {
+			best, bestDistance = name, distance
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// keySections returns the config sections that have key, to point out keys
+// put under the wrong section like subscription_url under mirror
+func keySections(key string, t reflect.Type, path string) []string {
+	var sections []string
+	fields := yamlFields(t)
+	if _, ok := fields[key]; ok {
+		sections = append(sections, path)
+	}
+	for name, field := range fields {
+		for field.Kind() == reflect.Ptr {
+			field = field.Elem()
+		}
+		if field.Kind() == reflect.Struct {
+			sections = append(sections, keySections(key, field, joinPath(path, name))...)
+		}
+	}
+	return sections
+}
+
+// joinPath appends a key to a dotted path
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// typeErrorPattern matches yaml.v3 type errors such as
+// "line 3: cannot unmarshal !!str `abc` into int"
+var typeErrorPattern = regexp.MustCompile(`^line (\d+): (.*)$`)
+
+// typeError converts a yaml.v3 type error message into a ValidationError
+func (v *validator) typeError(msg string) ValidationError {
+	if m := typeErrorPattern.FindStringSubmatch(msg); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		key := pathAtLine(v.root, line, "")
+		if key == "" {
+			key = "value"
+		}
+		return ValidationError{Line: line, Key: key, Message: m[2]}
+	}
+	return ValidationError{Key: "value", Message: msg}
+}
+
+// pathAtLine returns the dotted path of the value starting on line
+func pathAtLine(node *yaml.Node, line int, path string) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if value.Line == line && value.Kind == yaml.ScalarNode {
+				return joinPath(path, key.Value)
+			}
+			if found := pathAtLine(value, line, joinPath(path, key.Value)); found != "" {
+				return found
+			}
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			if item.Line == line && item.Kind == yaml.ScalarNode {
+				return joinPath(path, strconv.Itoa(i))
+			}
+			if found := pathAtLine(item, line, joinPath(path, strconv.Itoa(i))); found != "" {
+				return found
+			}
+		}
+	}
+	return ""
+}
+
+// checkMirror validates the mirror section
+func (v *validator) checkMirror(m *MirrorConfig) {
+	v.checkURL("mirror.npm", m.NPM, "http", "https")
+	v.checkURL("mirror.pip", m.Pip, "http", "https")
+	v.checkURL("mirror.cargo", m.Cargo, "http", "https", "sparse+https", "sparse+http")
+	for _, entry := range strings.Split(m.Go, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "direct" || entry == "off" {
+			continue
+		}
+		v.checkURL("mirror.go", entry, "http", "https", "file")
+	}
+	v.checkHost("mirror.apt", m.Apt)
+	for i, registry := range m.Docker {
+		v.checkHost(fmt.Sprintf("mirror.docker.%d", i), registry)
+	}
+}
+
+// checkProxy validates the proxy section
+func (v *validator) checkProxy(p *ProxyConfig) {
+	if p.SubscriptionURL != "" {
+		v.checkURL("proxy.subscription_url", p.SubscriptionURL, "http", "https")
+	}
+
+	v.checkPort("proxy.local_port", p.LocalPort, false)
+	v.checkPort("proxy.http_port", p.HTTPPort, false)
+	v.checkPort("proxy.stats_port", p.StatsPort, true)
+	if p.HTTPPort == p.LocalPort {
+		v.addf("proxy.http_port", "must differ from local_port (both are %d)", p.LocalPort)
+	}
+	if p.StatsPort != 0 && (p.StatsPort == p.LocalPort || p.StatsPort == p.HTTPPort) {
+		v.addf("proxy.stats_port", "clashes with local_port or http_port (%d)", p.StatsPort)
+	}
+
+	if p.XrayPath == "" {
+		v.addf("proxy.xray_path", "must not be empty")
+	}
+
+	if p.LogLevel != "" && !oneOf(p.LogLevel, "debug", "info", "warning", "error", "none") {
+		v.addf("proxy.log_level", "unknown level %q (expected debug, info, warning, error or none)", p.LogLevel)
+	}
+
+	hc := p.HealthCheck
+	if hc.URL != "" {
+		v.checkURL("proxy.health_check.url", hc.URL, "http", "https")
+	}
+	if hc.Interval < 0 {
+		v.addf("proxy.health_check.interval", "must not be negative")
+	}
+	if hc.Failures < 0 {
+		v.addf("proxy.health_check.failures", "must not be negative")
+	}
+
+	lt := p.LatencyTest
+	if lt.Method != "" && !oneOf(lt.Method, "tcp", "http") {
+		v.addf("proxy.latency_test.method", "unknown method %q (expected tcp or http)", lt.Method)
+	}
+	if lt.URL != "" {
+		v.checkURL("proxy.latency_test.url", lt.URL, "http", "https")
+	}
+	if lt.ExpectedStatus != 0 && (lt.ExpectedStatus < 100 || lt.ExpectedStatus > 599) {
+		v.addf("proxy.latency_test.expected_status", "%d is not an HTTP status code", lt.ExpectedStatus)
+	}
+	if lt.Timeout < 0 {
+		v.addf("proxy.latency_test.timeout", "must not be negative")
+	}
+
+	dns := p.DNS
+	for i, server := range dns.Remote {
+		v.checkDNSServer(fmt.Sprintf("proxy.dns.remote.%d", i), server)
+	}
+	for i, server := range dns.Domestic {
+		v.checkDNSServer(fmt.Sprintf("proxy.dns.domestic.%d", i), server)
+	}
+	if dns.FakeIPRange != "" {
+		if _, _, err := net.ParseCIDR(dns.FakeIPRange); err != nil {
+			v.addf("proxy.dns.fake_ip_range", "%q is not a CIDR range", dns.FakeIPRange)
+		}
+	}
+	if dns.FakeIP && !dns.Enabled {
+		v.addf("proxy.dns.fake_ip", "has no effect while proxy.dns.enabled is false")
+	}
+	if dns.Enabled && len(dns.Remote) == 0 && len(dns.Domestic) == 0 {
+		v.addf("proxy.dns.enabled", "no remote or domestic servers configured")
+	}
+
+	for i, entry := range p.Bypass {
+		if strings.TrimSpace(entry) == "" {
+			v.addf(fmt.Sprintf("proxy.bypass.%d", i), "must not be empty")
+		}
+	}
+
+	for i, override := range p.NodeOverrides {
+		path := fmt.Sprintf("proxy.node_overrides.%d", i)
+		if override.Match == "" {
+			v.addf(path, "match is required")
+			continue
+		}
+		if _, err := regexp.Compile(override.Match); err != nil {
+			v.addf(path+".match", "invalid regular expression: %v", err)
+		}
+	}
+
+	if p.Git.SSH && !p.Git.Enabled {
+		v.addf("proxy.git.ssh", "has no effect while proxy.git.enabled is false")
+	}
+	if p.System.WinHTTP && !p.System.Enabled {
+		v.addf("proxy.system.winhttp", "has no effect while proxy.system.enabled is false")
+	}
+}
+
+// checkHTTP checks the http section
+func (v *validator) checkHTTP(h *HTTPConfig) {
+	if h.Timeout < 0 {
+		v.addf("http.timeout", "must not be negative")
+	}
+	if h.DownloadTimeout < 0 {
+		v.addf("http.download_timeout", "must not be negative")
+	}
+	if h.Proxy != "" && !oneOf(h.Proxy, "environment", "managed", "direct") {
+		v.checkURL("http.proxy", h.Proxy, "http", "https", "socks5", "socks5h")
+	}
+}
+
+// checkURL reports values that aren't absolute URLs with one of the schemes
+func (v *validator) checkURL(path, value string, schemes ...string) {
+	// Encrypted secrets can only be checked once decrypted
+	if value == "" || IsEncrypted(value) {
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		v.addf(path, "invalid URL: %v", err)
+		return
+	}
+	if !oneOf(u.Scheme, schemes...) || (u.Host == "" && u.Scheme != "file") {
+		v.addf(path, "%q is not a valid %s URL", value, strings.Join(schemes, "/"))
+	}
+}
+
+// checkHost reports values that aren't a bare host name (with optional port)
+func (v *validator) checkHost(path, value string) {
+	if value == "" {
+		return
+	}
+	if strings.Contains(value, "://") || strings.ContainsAny(value, " /") {
+		v.addf(path, "expected a host name like mirrors.aliyun.com, got %q", value)
+	}
+}
+
+// checkPort reports ports outside 1-65535 (0 is allowed when optional)
+func (v *validator) checkPort(path string, port int, optional bool) {
+	if optional && port == 0 {
+		return
+	}
+	if port < 1 || port > 65535 {
+		v.addf(path, "port %d out of range (1-65535)", port)
+	}
+}
+
+// checkDNSServer reports DNS servers Xray wouldn't understand
+func (v *validator) checkDNSServer(path, server string) {
+	if net.ParseIP(server) != nil || server == "localhost" {
+		return
+	}
+	v.checkURL(path, server, "https", "https+local", "tcp", "tcp+local", "quic+local")
+}
+
+// checkHooks validates the hooks section
+func (v *validator) checkHooks(hooks []HookConfig) {
+	for i, hook := range hooks {
+		path := fmt.Sprintf("hooks.%d", i)
+		if !oneOf(hook.On, HookEvents...) {
+			v.addf(path+".on", "unknown event %q (expected one of %s)", hook.On, strings.Join(HookEvents, ", "))
+		}
+		if strings.TrimSpace(hook.Run) == "" {
+			v.addf(path+".run", "command is empty")
+		}
+		if hook.Timeout < 0 {
+			v.addf(path+".timeout", "must not be negative")
+		}
+	}
+}
+
+// checkWebhooks validates the webhooks section
+func (v *validator) checkWebhooks(webhooks []WebhookConfig) {
+	for i, webhook := range webhooks {
+		path := fmt.Sprintf("webhooks.%d", i)
+		if webhook.URL == "" {
+			v.addf(path+".url", "must not be empty")
+		}
+		v.checkURL(path+".url", webhook.URL, "http", "https")
+		if webhook.Format != "" && !oneOf(webhook.Format, "json", "slack", "feishu") {
+			v.addf(path+".format", "unknown format %q (expected json, slack or feishu)", webhook.Format)
+		}
+		for j, event := range webhook.Events {
+			if !oneOf(event, WebhookEvents...) {
+				v.addf(fmt.Sprintf("%s.events.%d", path, j), "unknown event %q (expected one of %s)", event, strings.Join(WebhookEvents, ", "))
+			}
+		}
+	}
+}
+
+// oneOf checks if s is one of the options
+func oneOf(s string, options ...string) bool {
+	for _, option := range options {
+		if s == option {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce groups the events of one save, which editors make as a
+// burst of writes, renames and chmods
+const watchDebounce = 300 * time.Millisecond
+
+// Watch calls onChange from its own goroutine after the config file of the
+// active profile changes or another profile becomes active, until stop is
+// closed. The directories are watched rather than the files, since editors
+// and crosh replace a file by renaming a new one over it.
+func Watch(stop <-chan struct{}, onChange func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch the config: %w", err)
+	}
+
+	for _, dir := range []string{ConfigDir(), profilesDir(), StateDir()} {
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+	}
+
+	go func() {
+		defer watcher.Close()
+		var pending <-chan time.Time
+		for {
+			select {
+			case <-stop:
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if watched(event.Name) {
+					pending = time.After(watchDebounce)
+				}
+			case _, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				// Events were lost, so the file may have changed
+				pending = time.After(watchDebounce)
+			case <-pending:
+				pending = nil
+				onChange()
+			}
+		}
+	}()
+	return nil
+}
+
+// watched checks if a changed file is the active profile's config or the
+// file recording which profile is active
+func watched(name string) bool {
+	name = filepath.Clean(name)
+	if name == activeProfilePath() {
+		return true
+	}
+	path, err := GetConfigPath()
+	return err == nil && name == path
+}
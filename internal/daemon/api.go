@@ -0,0 +1,188 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/boomyao/crosh/internal/dashboard"
+	"github.com/boomyao/crosh/internal/lock"
+	"github.com/boomyao/crosh/internal/proxy"
+)
+
+// Status is the daemon and proxy state served at GET /v1/status
+type Status struct {
+	PID                 int         `json:"pid"`
+	StartedAt           time.Time   `json:"started_at"`
+	ProxyEnabled        bool        `json:"proxy_enabled"`
+	ProxyRunning        bool        `json:"proxy_running"`
+	ProxyPID            int         `json:"proxy_pid,omitempty"`
+	Node                *proxy.Node `json:"node,omitempty"`
+	HTTPProxy           string      `json:"http_proxy,omitempty"`
+	SOCKSProxy          string      `json:"socks_proxy,omitempty"`
+	MonitorRunning      bool        `json:"monitor_running"`
+	SubscriptionUpdated *time.Time  `json:"subscription_updated,omitempty"`
+}
+
+// Handler returns the REST API:
+//
+//	GET  /v1/status                status of the daemon and the proxy
+//	GET  /v1/nodes                 all nodes, tested with ?test=1
+//	POST /v1/proxy/start           start the proxy
+//	POST /v1/proxy/stop            stop the proxy
+//	POST /v1/proxy/restart         restart the proxy
+//	POST /v1/proxy/switch          switch to {"name": "<node>"}
+//	POST /v1/subscription/refresh  fetch the subscription now
+//	POST /v1/shutdown              stop the proxy and the daemon
+//
+// Every route only answers requests addressed to localhost, and POSTs need
+// the X-Crosh-Action header, like the dashboard's.
+func (d *Daemon) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/status", d.handleStatus)
+	mux.HandleFunc("/v1/nodes", d.handleNodes)
+	mux.HandleFunc("/v1/proxy/start", d.action(d.startProxy))
+	mux.HandleFunc("/v1/proxy/stop", d.action(d.stopProxy))
+	mux.HandleFunc("/v1/proxy/restart", d.action(func() error { return d.manager.RestartProxy() }))
+	mux.HandleFunc("/v1/proxy/switch", d.handleSwitch)
+	mux.HandleFunc("/v1/subscription/refresh", d.action(d.refreshSubscription))
+	mux.HandleFunc("/v1/shutdown", d.handleShutdown)
+	return dashboard.LocalOnly(mux)
+}
+
+// action serves a POST that runs fn with the config reloaded, and mu and the
+// settings lock held
+func (d *Daemon) action(fn func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !dashboard.CheckAction(w, r) {
+			return
+		}
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if !lockSettings(w) {
+			return
+		}
+		defer lock.Release()
+		d.reload()
+
+		if err := fn(); err != nil {
+			dashboard.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		dashboard.WriteJSON(w, http.StatusOK, map[string]bool{"ok": true})
+	}
+}
+
+// handleStatus returns the state of the daemon and the proxy
+func (d *Daemon) handleStatus(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.reload()
+
+	xray := d.manager.GetXrayManager()
+	status := Status{
+		PID:            os.Getpid(),
+		StartedAt:      d.started,
+		ProxyEnabled:   d.cfg.Proxy.Enabled,
+		ProxyRunning:   xray.IsRunning(),
+		MonitorRunning: d.manager.IsHealthMonitorRunning(),
+	}
+	if updated := d.subscriptionUpdated(); !updated.IsZero() {
+		status.SubscriptionUpdated = &updated
+	}
+	if status.ProxyRunning {
+		status.ProxyPID = xray.PID()
+		status.HTTPProxy = xray.HTTPProxyURL()
+		status.SOCKSProxy = xray.SocksProxyURL()
+		if node, err := xray.CurrentNode(); err == nil {
+			public := node.WithoutCredentials()
+			status.Node = &public
+		}
+	}
+
+	dashboard.WriteJSON(w, http.StatusOK, status)
+}
+
+// handleNodes lists all nodes, testing their latency when ?test=1 is given
+func (d *Daemon) handleNodes(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.reload()
+
+	var nodes []proxy.Node
+	var err error
+	if r.URL.Query().Get("test") == "1" {
+		nodes, err = d.manager.TestNodes()
+	} else {
+		nodes, err = d.manager.ListNodes()
+	}
+	if err != nil {
+		dashboard.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	for i := range nodes {
+		nodes[i] = nodes[i].WithoutCredentials()
+	}
+	dashboard.WriteJSON(w, http.StatusOK, nodes)
+}
+
+// handleSwitch switches the running proxy to the node named in the request body
+func (d *Daemon) handleSwitch(w http.ResponseWriter, r *http.Request) {
+	if !dashboard.CheckAction(w, r) {
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		dashboard.WriteError(w, http.StatusBadRequest, fmt.Errorf("expected {\"name\": \"<node>\"}"))
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !lockSettings(w) {
+		return
+	}
+	defer lock.Release()
+	d.reload()
+
+	node, err := d.manager.SwitchNode(req.Name)
+	if err != nil {
+		dashboard.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	dashboard.WriteJSON(w, http.StatusOK, node.WithoutCredentials())
+}
+
+// handleShutdown stops the daemon after answering
+func (d *Daemon) handleShutdown(w http.ResponseWriter, r *http.Request) {
+	if !dashboard.CheckAction(w, r) {
+		return
+	}
+
+	dashboard.WriteJSON(w, http.StatusOK, map[string]bool{"ok": true})
+	d.Shutdown()
+}
+
+// lockSettings takes the settings lock for a request that changes settings,
+// answering 409 Conflict while a crosh command holds it
+func lockSettings(w http.ResponseWriter) bool {
+	err := lock.Acquire(lockWait)
+	if errors.Is(err, lock.ErrLocked) {
+		dashboard.WriteError(w, http.StatusConflict, err)
+		return false
+	}
+	if err != nil {
+		dashboard.WriteError(w, http.StatusInternalServerError, err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,133 @@
+package daemon
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/boomyao/crosh/internal/dashboard"
+	"github.com/boomyao/crosh/internal/proxy"
+)
+
+// Client talks to a running daemon's REST API
+type Client struct {
+	addr string
+	http *http.Client
+}
+
+// Connect returns a client for the daemon announced in stateDir, or nil if
+// no daemon is running
+func Connect(stateDir string) *Client {
+	data, err := os.ReadFile(StateFile(stateDir))
+	if err != nil {
+		return nil
+	}
+	var s state
+	if err := json.Unmarshal(data, &s); err != nil || s.Addr == "" {
+		return nil
+	}
+
+	// Proxy starts can download Xray-core and test every node
+	client := &Client{addr: s.Addr, http: &http.Client{Timeout: 5 * time.Minute}}
+	if _, err := client.Status(); err != nil {
+		return nil // Left behind by a daemon that was killed
+	}
+	return client
+}
+
+// Addr returns the address the daemon's API listens on
+func (c *Client) Addr() string {
+	return c.addr
+}
+
+// Status returns the state of the daemon and the proxy
+func (c *Client) Status() (*Status, error) {
+	var status Status
+	if err := c.do(http.MethodGet, "/v1/status", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// StartProxy asks the daemon to start the proxy
+func (c *Client) StartProxy() error {
+	return c.do(http.MethodPost, "/v1/proxy/start", nil, nil)
+}
+
+// StopProxy asks the daemon to stop the proxy
+func (c *Client) StopProxy() error {
+	return c.do(http.MethodPost, "/v1/proxy/stop", nil, nil)
+}
+
+// RestartProxy asks the daemon to restart the proxy
+func (c *Client) RestartProxy() error {
+	return c.do(http.MethodPost, "/v1/proxy/restart", nil, nil)
+}
+
+// SwitchNode asks the daemon to move the proxy to the named node
+func (c *Client) SwitchNode(name string) (*proxy.Node, error) {
+	var node proxy.Node
+	if err := c.do(http.MethodPost, "/v1/proxy/switch", map[string]string{"name": name}, &node); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+// RefreshSubscription asks the daemon to fetch the subscription now
+func (c *Client) RefreshSubscription() error {
+	return c.do(http.MethodPost, "/v1/subscription/refresh", nil, nil)
+}
+
+// Shutdown asks the daemon to stop the proxy and exit
+func (c *Client) Shutdown() error {
+	return c.do(http.MethodPost, "/v1/shutdown", nil, nil)
+}
+
+// do sends a request with body encoded as JSON and decodes the response into
+// out, turning {"error": ...} responses into errors
+func (c *Client) do(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, "http://"+c.addr+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if method == http.MethodPost {
+		req.Header.Set(dashboard.ActionHeader, "1")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach crosh daemon: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.Error != "" {
+			return fmt.Errorf("%s", apiErr.Error)
+		}
+		return fmt.Errorf("crosh daemon returned %s", resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode daemon response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boomyao/crosh/internal/accelerator"
+	"github.com/boomyao/crosh/internal/config"
+	"github.com/boomyao/crosh/internal/lock"
+)
+
+// DefaultPort is the API port when daemon.port isn't set
+const DefaultPort = 7681
+
+// superviseInterval is how often the daemon checks on the proxy
+const superviseInterval = 30 * time.Second
+
+// refreshRetryDelay is how long the daemon waits after a failed subscription
+// refresh before trying again
+const refreshRetryDelay = 15 * time.Minute
+
+// lockWait is how long an API request waits for a crosh command that is
+// changing settings to finish
+const lockWait = 3 * time.Second
+
+// Daemon owns the proxy process: it starts it, restarts it when it dies,
+// keeps the health monitor running, refreshes the subscription on schedule
+// and serves the REST API the CLI uses instead of touching the proxy itself.
+// Every operation holds mu, so concurrent crosh invocations and config
+// reloads can't race.
+type Daemon struct {
+	mu      sync.Mutex
+	cfg     *config.Config
+	applied config.Config // the settings last brought into effect, see apply
+	manager *accelerator.Manager
+	started time.Time
+	tried   time.Time // last scheduled subscription refresh
+	stop    chan struct{}
+	once    sync.Once
+}
+
+// New creates a daemon for the config of the active profile
+func New(cfg *config.Config) *Daemon {
+	return &Daemon{
+		cfg:     cfg,
+		applied: *cfg,
+		manager: accelerator.NewManager(cfg),
+		stop:    make(chan struct{}),
+	}
+}
+
+// Addr returns the API address of cfg
+func Addr(cfg *config.Config) string {
+	port := cfg.Daemon.Port
+	if port == 0 {
+		port = DefaultPort
+	}
+	return fmt.Sprintf("127.0.0.1:%d", port)
+}
+
+// state is written to StateFile so clients can find the running daemon
+type state struct {
+	PID  int    `json:"pid"`
+	Addr string `json:"addr"`
+}
+
+// StateFile returns the file announcing the running daemon
+func StateFile(stateDir string) string {
+	return filepath.Join(stateDir, "daemon.json")
+}
+
+// Run serves the API on addr and supervises the proxy until stop is closed
+// or a client asks the daemon to shut down. The proxy is stopped on the way
+// out but stays enabled in the config, so the next daemon starts it again.
+func (d *Daemon) Run(addr string, stop <-chan struct{}) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	stateFile := StateFile(d.manager.GetXrayManager().StateDir())
+	data, _ := json.Marshal(state{PID: os.Getpid(), Addr: listener.Addr().String()})
+	if err := os.MkdirAll(filepath.Dir(stateFile), 0755); err != nil {
+		listener.Close()
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	if err := os.WriteFile(stateFile, data, 0644); err != nil {
+		listener.Close()
+		return fmt.Errorf("failed to write %s: %w", stateFile, err)
+	}
+	defer os.Remove(stateFile)
+
+	server := &http.Server{
+		Handler:           d.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+
+	d.started = time.Now()
+	log.Printf("Daemon started (pid %d, API http://%s)", os.Getpid(), listener.Addr())
+	d.supervise()
+
+	watchStop := make(chan struct{})
+	defer close(watchStop)
+	d.watchConfig(watchStop)
+
+	ticker := time.NewTicker(superviseInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return d.shutdown(server)
+		case <-d.stop:
+			return d.shutdown(server)
+		case err := <-served:
+			return fmt.Errorf("API server failed: %w", err)
+		case <-ticker.C:
+			d.supervise()
+		}
+	}
+}
+
+// Shutdown makes Run return
+func (d *Daemon) Shutdown() {
+	d.once.Do(func() { close(d.stop) })
+}
+
+// shutdown stops the API server and the proxy
+func (d *Daemon) shutdown(server *http.Server) error {
+	server.Close()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := lock.Acquire(lockWait); err != nil {
+		log.Printf("Stopping anyway: %v", err)
+	} else {
+		defer lock.Release()
+	}
+	d.reload()
+	if d.manager.GetXrayManager().IsRunning() {
+		if err := d.manager.DisableProxy(); err != nil {
+			log.Printf("Failed to stop proxy: %v", err)
+		}
+	} else if released := d.manager.RecoverStaleSettings(); len(released) > 0 {
+		log.Printf("Proxy is not running, removed %s proxy settings", strings.Join(released, ", "))
+	}
+	log.Println("Daemon stopped")
+	return nil
+}
+
+// reload picks up config changes made by the CLI since the last operation.
+// The caller holds mu.
+func (d *Daemon) reload() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Printf("Failed to reload config, keeping the previous one: %v", err)
+		return
+	}
+	d.cfg = cfg
+	d.manager = accelerator.NewManager(cfg)
+}
+
+// supervise applies config changes the watcher missed, restarts the proxy
+// if it should be running but isn't, keeps the health monitor alive, rotates
+// the proxy log and refreshes the subscription when it is due. It skips a round while a crosh
+// command is changing settings.
+func (d *Daemon) supervise() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if lock.Acquire(0) != nil {
+		return
+	}
+	defer lock.Release()
+	d.reload()
+	d.apply()
+
+	running := d.manager.GetXrayManager().IsRunning()
+	if d.cfg.Proxy.Enabled && !running && d.manager.HasProxySource() {
+		log.Println("Proxy is enabled but not running, starting it")
+		if err := d.startProxy(); err != nil {
+			log.Printf("Failed to start proxy: %v", err)
+		}
+		running = d.manager.GetXrayManager().IsRunning()
+	}
+	if running {
+		if err := d.manager.StartHealthMonitor(); err != nil {
+			log.Printf("Failed to start health monitor: %v", err)
+		}
+		if err := d.manager.GetXrayManager().RotateLog(); err != nil {
+			log.Printf("Failed to rotate the proxy log: %v", err)
+		}
+	}
+
+	if d.cfg.Proxy.SubscriptionURL != "" && time.Since(d.subscriptionUpdated()) > d.refreshInterval() && time.Since(d.tried) > refreshRetryDelay {
+		d.tried = time.Now()
+		if err := d.refreshSubscription(); err != nil {
+			log.Printf("Subscription refresh failed: %v", err)
+		}
+	}
+}
+
+// refreshInterval returns the time between scheduled subscription refreshes
+func (d *Daemon) refreshInterval() time.Duration {
+	if d.cfg.Daemon.Refresh > 0 {
+		return time.Duration(d.cfg.Daemon.Refresh) * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// subscriptionUpdated returns when the subscription was last fetched
+func (d *Daemon) subscriptionUpdated() time.Time {
+	updated, _ := d.manager.SubscriptionUpdated()
+	return updated
+}
+
+// startProxy starts the proxy, downloading Xray-core first if it is missing,
+// and records in the config that it is on. The caller holds mu.
+func (d *Daemon) startProxy() error {
+	d.cfg.Proxy.Enabled = true
+	err := d.manager.EnableProxy()
+	if err != nil && d.manager.HasProxySource() {
+		// Most likely Xray-core is missing
+		if downloadErr := d.manager.GetXrayManager().Download(); downloadErr != nil {
+			return err
+		}
+		err = d.manager.EnableProxy()
+	}
+	if err != nil {
+		return err
+	}
+	return d.cfg.Save()
+}
+
+// stopProxy stops the proxy and records in the config that it is off. The
+// caller holds mu.
+func (d *Daemon) stopProxy() error {
+	if err := d.manager.DisableProxy(); err != nil {
+		return err
+	}
+	d.cfg.Proxy.Enabled = false
+	return d.cfg.Save()
+}
+
+// refreshSubscription fetches the subscription again. The caller holds mu.
+func (d *Daemon) refreshSubscription() error {
+	nodes, err := d.manager.ListNodes()
+	if err != nil {
+		return err
+	}
+	log.Printf("Subscription refreshed (%d nodes)", len(nodes))
+	return nil
+}
@@ -0,0 +1,127 @@
+package daemon
+
+import (
+	"log"
+
+	"github.com/boomyao/crosh/internal/config"
+	"github.com/boomyao/crosh/internal/lock"
+)
+
+// watchConfig applies edits of config.yaml as soon as they are saved,
+// instead of at the next supervision round, until stop is closed
+func (d *Daemon) watchConfig(stop <-chan struct{}) {
+	if err := config.Watch(stop, d.configChanged); err != nil {
+		log.Printf("Not watching the config, changes apply within %s: %v", superviseInterval, err)
+	}
+}
+
+// configChanged reloads the config and applies what changed. While a crosh
+// command holds the settings lock it is the one changing them, so the next
+// supervision round picks its changes up instead.
+func (d *Daemon) configChanged() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if lock.Acquire(lockWait) != nil {
+		return
+	}
+	defer lock.Release()
+	d.reload()
+	d.apply()
+}
+
+// apply brings the changes made to the config since the last call into
+// effect: a new subscription is fetched, a changed node is switched to,
+// changed ports, DNS, bypass and node settings restart the proxy, a changed
+// health check restarts the monitor, and mirrors switched on or off in
+// config.yaml are enabled or disabled. Each step checks the actual state
+// first, so changes a crosh command already applied aren't applied twice.
+// The caller holds mu and the settings lock.
+func (d *Daemon) apply() {
+	old, cfg := d.applied, d.cfg
+	d.applied = *cfg
+	xray := d.manager.GetXrayManager()
+	running := xray.IsRunning()
+
+	if cfg.Proxy.SubscriptionURL != old.Proxy.SubscriptionURL && cfg.Proxy.SubscriptionURL != "" {
+		log.Println("Subscription URL changed, fetching it")
+		if err := d.refreshSubscription(); err != nil {
+			log.Printf("Subscription refresh failed: %v", err)
+		}
+	}
+
+	if running && cfg.Proxy.CurrentNode != "" {
+		if node, err := xray.CurrentNode(); err == nil && node.Name != cfg.Proxy.CurrentNode {
+			log.Printf("Node changed in the config, switching to %s", cfg.Proxy.CurrentNode)
+			if _, err := d.manager.SwitchNode(cfg.Proxy.CurrentNode); err != nil {
+				log.Printf("Failed to switch node: %v", err)
+			}
+		}
+	}
+
+	switch changed, err := d.manager.ReloadProxySettings(); {
+	case err != nil:
+		log.Printf("Failed to apply the proxy settings: %v", err)
+	case changed && running:
+		log.Println("Proxy settings changed, restarted the proxy")
+	case running && cfg.Proxy.XrayPath != old.Proxy.XrayPath:
+		log.Println("Proxy binary changed, restarting the proxy")
+		if err := d.manager.RestartProxy(); err != nil {
+			log.Printf("Failed to restart proxy: %v", err)
+		}
+	}
+
+	if cfg.Proxy.HealthCheck != old.Proxy.HealthCheck && d.manager.IsHealthMonitorRunning() {
+		log.Println("Health check settings changed, restarting the monitor")
+		if err := d.manager.StopHealthMonitor(); err != nil {
+			log.Printf("Failed to stop health monitor: %v", err)
+		}
+		if running {
+			if err := d.manager.StartHealthMonitor(); err != nil {
+				log.Printf("Failed to start health monitor: %v", err)
+			}
+		}
+	}
+
+	d.applyMirrors(&old.Mirror)
+
+	if cfg.Daemon.Port != old.Daemon.Port {
+		log.Printf("daemon.port changed to %d, restart the daemon to move the API there", cfg.Daemon.Port)
+	}
+}
+
+// applyMirrors enables or disables the mirrors switched in config.yaml, and
+// enables an enabled mirror again if its URL changed. A tool whose applied
+// time changed was switched by a crosh command, which already did it. The
+// caller holds mu and the settings lock.
+func (d *Daemon) applyMirrors(old *config.MirrorConfig) {
+	mirrors := &d.cfg.Mirror
+	changed := false
+	for _, tool := range config.MirrorToolNames {
+		was, now := old.Tool(tool), mirrors.Tool(tool)
+		if !now.Applied.Equal(was.Applied) {
+			continue
+		}
+		urlChanged := now.Enabled && mirrors.URL(tool) != old.URL(tool)
+		if now.Enabled == was.Enabled && !urlChanged {
+			continue
+		}
+
+		if err := d.manager.SetMirror(tool, now.Enabled); err != nil {
+			log.Printf("Failed to switch the %s mirror: %v", tool, err)
+			continue
+		}
+		changed = true
+		if now.Enabled {
+			log.Printf("%s mirror enabled: %s", tool, mirrors.URL(tool))
+		} else {
+			log.Printf("%s mirror disabled", tool)
+		}
+	}
+
+	if changed {
+		if err := d.cfg.Save(); err != nil {
+			log.Printf("Failed to save config: %v", err)
+		}
+		d.applied.Mirror = d.cfg.Mirror
+	}
+}
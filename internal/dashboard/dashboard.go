@@ -0,0 +1,234 @@
+package dashboard
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/boomyao/crosh/internal/accelerator"
+	"github.com/boomyao/crosh/internal/lock"
+	"github.com/boomyao/crosh/internal/proxy"
+)
+
+//go:embed index.html
+var indexHTML []byte
+
+// ActionHeader must be set on state-changing requests. Browsers can't send a
+// custom header cross-origin without a CORS preflight, which the server never
+// approves, so other websites can't switch nodes behind the user's back.
+const ActionHeader = "X-Crosh-Action"
+
+// Server serves the proxy dashboard
+type Server struct {
+	manager *accelerator.Manager
+	mu      sync.Mutex // serializes proxy restarts and node switches
+}
+
+// NewServer creates a new dashboard server
+func NewServer(manager *accelerator.Manager) *Server {
+	return &Server{
+		manager: manager,
+	}
+}
+
+// statusResponse is the JSON form of the proxy status
+type statusResponse struct {
+	Running        bool           `json:"running"`
+	PID            int            `json:"pid,omitempty"`
+	UptimeSeconds  int64          `json:"uptime_seconds,omitempty"`
+	SocksAddr      string         `json:"socks_addr"`
+	HTTPAddr       string         `json:"http_addr"`
+	Node           *proxy.Node    `json:"node,omitempty"`
+	LatencyMS      int64          `json:"latency_ms,omitempty"`
+	LatencyError   string         `json:"latency_error,omitempty"`
+	Failover       bool           `json:"failover"`
+	Backend        string         `json:"backend,omitempty"`
+	Traffic        *proxy.Traffic `json:"traffic,omitempty"`
+	GeoDataWarning string         `json:"geodata_warning,omitempty"`
+}
+
+// Handler returns the HTTP handler serving the UI and its JSON API
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleIndex)
+	mux.HandleFunc("/api/status", s.handleStatus)
+	mux.HandleFunc("/api/nodes", s.handleNodes)
+	mux.HandleFunc("/api/switch", s.handleSwitch)
+	mux.HandleFunc("/api/restart", s.handleRestart)
+	return LocalOnly(mux)
+}
+
+// LocalOnly rejects requests not addressed to localhost on every route, so
+// a DNS rebinding page can neither read the nodes nor start latency tests
+func LocalOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !LocalRequest(r) {
+			WriteError(w, http.StatusForbidden, fmt.Errorf("unexpected host %q", r.Host))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ListenAndServe serves the dashboard on addr until it fails
+func (s *Server) ListenAndServe(addr string) error {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return server.ListenAndServe()
+}
+
+// handleIndex serves the embedded single page UI
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(indexHTML)
+}
+
+// handleStatus returns the proxy status with live latency and traffic
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	status := s.manager.ProxyStatusDetails()
+
+	resp := statusResponse{
+		Running:        status.Running,
+		PID:            status.PID,
+		SocksAddr:      status.SocksAddr,
+		HTTPAddr:       status.HTTPAddr,
+		Failover:       status.MonitorRunning,
+		Backend:        status.Backend,
+		GeoDataWarning: status.GeoDataWarning,
+	}
+	if status.Node != nil {
+		node := status.Node.WithoutCredentials()
+		resp.Node = &node
+	}
+	if !status.StartedAt.IsZero() {
+		resp.UptimeSeconds = int64(time.Since(status.StartedAt).Seconds())
+	}
+	if status.Running {
+		if status.LatencyErr != nil {
+			resp.LatencyError = status.LatencyErr.Error()
+		} else {
+			resp.LatencyMS = status.Latency.Milliseconds()
+		}
+		resp.Traffic = status.Traffic
+	}
+
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+// handleNodes lists all nodes, testing their latency when ?test=1 is given
+func (s *Server) handleNodes(w http.ResponseWriter, r *http.Request) {
+	var nodes []proxy.Node
+	var err error
+	if r.URL.Query().Get("test") == "1" {
+		nodes, err = s.manager.TestNodes()
+	} else {
+		nodes, err = s.manager.ListNodes()
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	for i := range nodes {
+		nodes[i] = nodes[i].WithoutCredentials()
+	}
+	WriteJSON(w, http.StatusOK, nodes)
+}
+
+// handleSwitch switches the running proxy to the node named in the request body
+func (s *Server) handleSwitch(w http.ResponseWriter, r *http.Request) {
+	if !CheckAction(w, r) {
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		WriteError(w, http.StatusBadRequest, fmt.Errorf("expected {\"name\": \"<node>\"}"))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	node, err := s.manager.SwitchNode(req.Name)
+	if errors.Is(err, lock.ErrLocked) {
+		WriteError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, node.WithoutCredentials())
+}
+
+// handleRestart restarts the proxy process
+func (s *Server) handleRestart(w http.ResponseWriter, r *http.Request) {
+	if !CheckAction(w, r) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.manager.RestartProxy(); err != nil {
+		WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+// CheckAction rejects anything but same-origin POSTs carrying the action header
+func CheckAction(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		WriteError(w, http.StatusMethodNotAllowed, fmt.Errorf("use POST"))
+		return false
+	}
+	if !LocalRequest(r) {
+		WriteError(w, http.StatusForbidden, fmt.Errorf("unexpected host %q", r.Host))
+		return false
+	}
+	if r.Header.Get(ActionHeader) == "" {
+		WriteError(w, http.StatusForbidden, fmt.Errorf("missing %s header", ActionHeader))
+		return false
+	}
+	return true
+}
+
+// LocalRequest checks if r is addressed to localhost, which guards against
+// DNS rebinding: a website resolving its own name to 127.0.0.1
+func LocalRequest(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	return host == "127.0.0.1" || host == "localhost" || host == "::1"
+}
+
+// WriteJSON writes v as a JSON response
+func WriteJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// WriteError writes err as a JSON error response
+func WriteError(w http.ResponseWriter, code int, err error) {
+	WriteJSON(w, code, map[string]string{"error": err.Error()})
+}
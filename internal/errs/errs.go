@@ -0,0 +1,87 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// Kinds of failure, which the CLI turns into exit codes and library users
+// can check with errors.Is or Kind. ErrPermission is fs.ErrPermission, so
+// it also matches the errors of the os package.
+var (
+	ErrNotInstalled = errors.New("not installed") // a tool such as git, go or Xray-core is missing
+	ErrPermission   = fs.ErrPermission            // root or administrator rights are needed
+	ErrParse        = errors.New("parse error")   // a config, subscription or checksum file is malformed
+	ErrNetwork      = errors.New("network error") // a download, subscription, mirror or node was unreachable
+)
+
+// kinds lists the kinds in the order Kind checks them
+var kinds = []error{ErrPermission, ErrNotInstalled, ErrParse, ErrNetwork}
+
+// kindError marks an error as being of a kind while keeping its message
+type kindError struct {
+	err  error
+	kind error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() []error {
+	return []error{e.err, e.kind}
+}
+
+// Mark makes errors.Is(err, kind) hold, returning nil if err is nil
+func Mark(err, kind error) error {
+	if err == nil {
+		return nil
+	}
+	return &kindError{err: err, kind: kind}
+}
+
+// Errorf formats an error like fmt.Errorf and marks it as kind
+func Errorf(kind error, format string, args ...any) error {
+	return &kindError{err: fmt.Errorf(format, args...), kind: kind}
+}
+
+// httpStatusPattern matches the "HTTP 404" style errors of failed downloads
+var httpStatusPattern = regexp.MustCompile(`\bHTTP \d{3}\b|returned status: \d{3}`)
+
+// Kind returns the kind of err, or nil if it is none of them. Errors that
+// weren't marked are classified by their cause where possible, and by
+// their text for the output of external commands.
+func Kind(err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, kind := range kinds {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, exec.ErrNotFound):
+		return ErrNotInstalled
+	case errors.As(err, &netErr):
+		return ErrNetwork
+	}
+
+	msg := err.Error()
+	lower := strings.ToLower(msg)
+	switch {
+	case strings.Contains(lower, "permission denied"), strings.Contains(lower, "access is denied"),
+		strings.Contains(lower, "operation not permitted"):
+		return ErrPermission
+	case httpStatusPattern.MatchString(msg):
+		return ErrNetwork
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package fsys
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FS is the filesystem crosh reads and writes the user's config files and
+// its own state on. OS is the real one; Dir confines every path to a
+// directory, so the mirror handlers, the journal, telemetry and the lock can
+// be pointed at a scratch tree instead.
+type FS interface {
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte, perm os.FileMode) error
+	Open(name string) (*os.File, error)
+	OpenFile(name string, flag int, perm os.FileMode) (*os.File, error)
+	Stat(name string) (os.FileInfo, error)
+	ReadDir(name string) ([]os.DirEntry, error)
+	EvalSymlinks(path string) (string, error)
+	MkdirAll(path string, perm os.FileMode) error
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+	RemoveAll(path string) error
+	Chtimes(name string, atime, mtime time.Time) error
+}
+
+// OS is the real filesystem
+var OS FS = osFS{}
+
+type osFS struct{}
+
+func (osFS) ReadFile(name string) ([]byte, error) { return os.ReadFile(name) }
+func (osFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
+func (osFS) Open(name string) (*os.File, error) { return os.Open(name) }
+func (osFS) OpenFile(name string, flag int, perm os.FileMode) (*os.File, error) {
+	return os.OpenFile(name, flag, perm)
+}
+func (osFS) Stat(name string) (os.FileInfo, error)        { return os.Stat(name) }
+func (osFS) ReadDir(name string) ([]os.DirEntry, error)   { return os.ReadDir(name) }
+func (osFS) EvalSymlinks(path string) (string, error)     { return filepath.EvalSymlinks(path) }
+func (osFS) MkdirAll(path string, perm os.FileMode) error { return os.MkdirAll(path, perm) }
+func (osFS) Rename(oldpath, newpath string) error         { return os.Rename(oldpath, newpath) }
+func (osFS) Remove(name string) error                     { return os.Remove(name) }
+func (osFS) RemoveAll(path string) error                  { return os.RemoveAll(path) }
+func (osFS) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
+
+// Dir returns a filesystem rooted at root: /etc/pip.conf is root/etc/pip.conf
+// and ~/.npmrc is root/home/me/.npmrc. Paths are cleaned first, so ".."
+// can't climb out of root.
+func Dir(root string) FS {
+	return dirFS{root: root}
+}
+
+type dirFS struct {
+	root string
+}
+
+// path maps name into the root, dropping any volume name on Windows
+func (d dirFS) path(name string) string {
+	name = name[len(filepath.VolumeName(name)):]
+	return filepath.Join(d.root, filepath.Clean(string(filepath.Separator)+name))
+}
+
+func (d dirFS) ReadFile(name string) ([]byte, error) { return os.ReadFile(d.path(name)) }
+func (d dirFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return os.WriteFile(d.path(name), data, perm)
+}
+func (d dirFS) Open(name string) (*os.File, error) { return os.Open(d.path(name)) }
+func (d dirFS) OpenFile(name string, flag int, perm os.FileMode) (*os.File, error) {
+	return os.OpenFile(d.path(name), flag, perm)
+}
+func (d dirFS) Stat(name string) (os.FileInfo, error)      { return os.Stat(d.path(name)) }
+func (d dirFS) ReadDir(name string) ([]os.DirEntry, error) { return os.ReadDir(d.path(name)) }
+
+// EvalSymlinks resolves path inside the root, failing for links that lead
+// out of it
+func (d dirFS) EvalSymlinks(path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(d.path(path))
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(d.root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s links outside of %s", path, d.root)
+	}
+	return filepath.Join(string(filepath.Separator), rel), nil
+}
+
+func (d dirFS) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(d.path(path), perm)
+}
+func (d dirFS) Rename(oldpath, newpath string) error {
+	return os.Rename(d.path(oldpath), d.path(newpath))
+}
+func (d dirFS) Remove(name string) error    { return os.Remove(d.path(name)) }
+func (d dirFS) RemoveAll(path string) error { return os.RemoveAll(d.path(path)) }
+func (d dirFS) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(d.path(name), atime, mtime)
+}
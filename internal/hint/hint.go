@@ -0,0 +1,98 @@
+package hint
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/boomyao/crosh/internal/i18n"
+)
+
+// Sudo is the hint for changes only root or an administrator may make. It
+// names doas instead where that replaces sudo, see SetSudoCommand.
+var Sudo = sudoHint
+
+const (
+	sudoHint = "rerun with sudo (or from an administrator prompt on Windows)"
+	doasHint = "rerun with doas"
+)
+
+// SetSudoCommand makes Sudo suggest cmd, "sudo" or "doas"
+func SetSudoCommand(cmd string) {
+	if cmd == "doas" {
+		Sudo = doasHint
+	} else {
+		Sudo = sudoHint
+	}
+}
+
+// Error is an error with advice on what to do next, which the CLI prints on
+// its own line below the error. Hints are English and translated when shown.
+type Error struct {
+	Err  error
+	Hint string
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Wrap attaches a hint to err, returning nil if err is nil
+func Wrap(err error, hint string) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Err: err, Hint: hint}
+}
+
+// Errorf formats an error like fmt.Errorf and attaches a hint to it
+func Errorf(hint, format string, args ...any) error {
+	return &Error{Err: fmt.Errorf(format, args...), Hint: hint}
+}
+
+// IfDenied attaches a hint to err only if it was caused by missing permissions
+func IfDenied(err error, hint string) error {
+	if !errors.Is(err, fs.ErrPermission) {
+		return err
+	}
+	return Wrap(err, hint)
+}
+
+// All returns the hints attached anywhere in err's tree, outermost first and
+// without duplicates
+func All(err error) []string {
+	var hints []string
+	seen := make(map[string]bool)
+	var walk func(error)
+	walk = func(err error) {
+		if err == nil {
+			return
+		}
+		if e, ok := err.(*Error); ok && !seen[e.Hint] {
+			seen[e.Hint] = true
+			hints = append(hints, e.Hint)
+		}
+		switch wrapped := err.(type) {
+		case interface{ Unwrap() error }:
+			walk(wrapped.Unwrap())
+		case interface{ Unwrap() []error }:
+			for _, err := range wrapped.Unwrap() {
+				walk(err)
+			}
+		}
+	}
+	walk(err)
+	return hints
+}
+
+// Fprint writes the translated hints of err to w as "→ hint" lines
+func Fprint(w io.Writer, indent string, err error) {
+	for _, hint := range All(err) {
+		fmt.Fprintf(w, "%s→ %s\n", indent, i18n.T(hint))
+	}
+}
@@ -0,0 +1,109 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+
+	"github.com/boomyao/crosh/internal/errs"
+	"github.com/boomyao/crosh/internal/progress"
+	"github.com/boomyao/crosh/internal/retry"
+)
+
+// DownloadTo streams url into the file at path, showing progress as name.
+// If path already holds the start of the file, only the rest is requested
+// with a Range header, falling back to the whole file when the server
+// doesn't support ranges or sends another range. A failed download leaves path in place so the
+// next attempt resumes it; the caller removes path once it has checked and
+// installed the file, or if the check fails.
+func DownloadTo(ctx context.Context, url, path, name string) error {
+	var offset int64
+	if info, err := os.Stat(path); err == nil {
+		offset = info.Size()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := Download().Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	total := resp.ContentLength
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0 && rangeStart(resp) == offset:
+		flags = os.O_WRONLY | os.O_APPEND
+		if total >= 0 {
+			total += offset
+		}
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		// Some other range than asked for; the part kept can't be trusted
+		// to line up with it, so fetch the whole file instead
+		resp.Body.Close()
+		if err := os.Truncate(path, 0); err != nil {
+			return fmt.Errorf("failed to restart the download: %w", err)
+		}
+		return DownloadTo(ctx, url, path, name)
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// Nothing left to fetch: the last attempt got the whole file but
+		// failed afterwards. The caller's checksum tells if it is intact.
+		return nil
+	case resp.StatusCode != http.StatusOK:
+		return StatusError(resp.StatusCode)
+	default:
+		offset = 0
+	}
+
+	out, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	body := progress.NewReader(resp.Body, name, total).Resumed(offset)
+	_, err = io.Copy(out, body)
+	body.Finish()
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save file: %w", err)
+	}
+	return nil
+}
+
+// contentRangePattern matches the start of a Content-Range header
+var contentRangePattern = regexp.MustCompile(`^bytes (\d+)-`)
+
+// rangeStart returns where the body of a 206 response starts, or -1
+func rangeStart(resp *http.Response) int64 {
+	match := contentRangePattern.FindStringSubmatch(resp.Header.Get("Content-Range"))
+	if match == nil {
+		return -1
+	}
+	start, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return start
+}
+
+// StatusError reports an unexpected HTTP status, marked retry.Permanent
+// unless retrying may help
+func StatusError(code int) error {
+	err := errs.Errorf(errs.ErrNetwork, "HTTP %d", code)
+	if !retry.TransientStatus(code) {
+		return retry.Permanent(err)
+	}
+	return err
+}
@@ -0,0 +1,159 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Default timeouts, used until Configure sets others
+const (
+	DefaultTimeout         = 30 * time.Second
+	DefaultDownloadTimeout = 5 * time.Minute
+)
+
+// Settings shape every client handed out. Zero values keep the defaults.
+type Settings struct {
+	Timeout         time.Duration // API calls, subscriptions and checksums
+	DownloadTimeout time.Duration // binaries and data files
+	Proxy           string        // proxy URL, "direct", or "" for HTTPS_PROXY/HTTP_PROXY
+	UserAgent       string
+}
+
+var (
+	mu        sync.Mutex
+	current   = Settings{Timeout: DefaultTimeout, DownloadTimeout: DefaultDownloadTimeout, UserAgent: "crosh"}
+	transport = newTransport("")
+)
+
+// Configure applies settings to the clients handed out from now on. The
+// connection pool is replaced if the proxy changes.
+func Configure(s Settings) error {
+	if s.Timeout <= 0 {
+		s.Timeout = DefaultTimeout
+	}
+	if s.DownloadTimeout <= 0 {
+		s.DownloadTimeout = DefaultDownloadTimeout
+	}
+	if s.UserAgent == "" {
+		s.UserAgent = current.UserAgent
+	}
+	if s.Proxy != "" && s.Proxy != "direct" {
+		if _, err := parseProxy(s.Proxy); err != nil {
+			return err
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if s.Proxy != current.Proxy {
+		transport.CloseIdleConnections()
+		transport = newTransport(s.Proxy)
+	}
+	current = s
+	return nil
+}
+
+// Client returns a client for API calls and other small requests
+func Client() *http.Client {
+	mu.Lock()
+	defer mu.Unlock()
+	return client(current.Timeout)
+}
+
+// Download returns a client for downloading binaries and data files
+func Download() *http.Client {
+	mu.Lock()
+	defer mu.Unlock()
+	return client(current.DownloadTimeout)
+}
+
+// New returns a client with its own timeout, 0 meaning none, sharing the
+// connection pool of the others
+func New(timeout time.Duration) *http.Client {
+	mu.Lock()
+	defer mu.Unlock()
+	return client(timeout)
+}
+
+// Via returns a client that goes through proxyURL, such as a node being
+// tested, instead of the configured proxy. It doesn't keep connections
+// alive, so every request measures a fresh connection.
+func Via(proxyURL string, timeout time.Duration) (*http.Client, error) {
+	parsed, err := parseProxy(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &userAgent{
+			base:  &http.Transport{Proxy: http.ProxyURL(parsed), DisableKeepAlives: true},
+			agent: current.UserAgent,
+		},
+	}, nil
+}
+
+// Get fetches url with client, giving up when ctx is cancelled
+func Get(ctx context.Context, client *http.Client, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+// client builds a client on the shared transport. The caller holds mu.
+func client(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &userAgent{base: transport, agent: current.UserAgent},
+	}
+}
+
+// newTransport creates the connection pool for a proxy setting
+func newTransport(proxy string) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	switch proxy {
+	case "":
+		t.Proxy = http.ProxyFromEnvironment
+	case "direct":
+		t.Proxy = nil
+	default:
+		parsed, _ := parseProxy(proxy)
+		t.Proxy = http.ProxyURL(parsed)
+	}
+	return t
+}
+
+// parseProxy parses an http, https or socks5 proxy URL
+func parseProxy(proxy string) (*url.URL, error) {
+	parsed, err := url.Parse(proxy)
+	if err != nil || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q", proxy)
+	}
+	switch parsed.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return parsed, nil
+	}
+	return nil, fmt.Errorf("invalid proxy URL %q (expected http, https or socks5)", proxy)
+}
+
+// userAgent sets the User-Agent of requests that don't have one
+type userAgent struct {
+	base  http.RoundTripper
+	agent string
+}
+
+func (u *userAgent) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", u.agent)
+	}
+	return u.base.RoundTrip(req)
+}
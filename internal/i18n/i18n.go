@@ -0,0 +1,101 @@
+package i18n
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Languages crosh has messages for
+const (
+	English = "en"
+	Chinese = "zh"
+)
+
+// catalogs map English messages to their translations
+var catalogs = map[string]map[string]string{
+	Chinese: zh,
+}
+
+var lang = Detect()
+
+// Detect returns the language of the locale in LC_ALL, LC_MESSAGES or LANG,
+// e.g. zh_CN.UTF-8 is Chinese. Anything without a translation is English.
+func Detect() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		locale := os.Getenv(name)
+		if locale == "" {
+			continue
+		}
+		// The first set variable wins, even if it's English
+		if strings.HasPrefix(strings.ToLower(locale), "zh") {
+			return Chinese
+		}
+		return English
+	}
+	return English
+}
+
+// SetLanguage overrides the language from the locale. "" and "auto" keep
+// the detected one.
+func SetLanguage(language string) {
+	switch language {
+	case "", "auto":
+		lang = Detect()
+	case English, Chinese:
+		lang = language
+	}
+}
+
+// Language returns the language messages are printed in
+func Language() string {
+	return lang
+}
+
+// T returns the translation of msg, or msg itself if there is none
+func T(msg string) string {
+	if translated, ok := catalogs[lang][msg]; ok {
+		return translated
+	}
+	return msg
+}
+
+// Text picks the English or Chinese version of a long text, such as a
+// command's help, that is kept next to the code printing it
+func Text(en, zh string) string {
+	if lang == Chinese {
+		return zh
+	}
+	return en
+}
+
+// Sprintf formats the translation of format
+func Sprintf(format string, args ...any) string {
+	return fmt.Sprintf(T(format), args...)
+}
+
+// Print prints the translation of msg to stdout
+func Print(msg string) {
+	fmt.Print(T(msg))
+}
+
+// Println prints the translation of msg and a newline to stdout
+func Println(msg string) {
+	fmt.Println(T(msg))
+}
+
+// Printf prints the translation of format to stdout
+func Printf(format string, args ...any) {
+	fmt.Printf(T(format), args...)
+}
+
+// Fprintln prints the translation of msg and a newline to w
+func Fprintln(w io.Writer, msg string) {
+	fmt.Fprintln(w, T(msg))
+}
+
+// Fprintf prints the translation of format to w
+func Fprintf(w io.Writer, format string, args ...any) {
+	fmt.Fprintf(w, T(format), args...)
+}
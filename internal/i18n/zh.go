@@ -0,0 +1,335 @@
+package i18n
+
+// zh holds the Simplified Chinese messages. Keys are the exact English
+// strings passed to T, format verbs included.
+var zh = map[string]string{
+	// crosh
+	"⚠ Failed to move ~/.crosh to the XDG directories: %v\n":                                     "⚠ 无法将 ~/.crosh 迁移到 XDG 目录：%v\n",
+	"✓ Moved ~/.crosh to %s, %s and %s\n\n":                                                      "✓ 已将 ~/.crosh 迁移到 %s、%s 和 %s\n\n",
+	`stop it with "crosh off", and the next crosh command moves the files`:                       `用 "crosh off" 停止它，下一条 crosh 命令会迁移这些文件`,
+	"Error loading config: %v":                                                                   "加载配置失败：%v",
+	"run \"crosh config validate\" for details and \"crosh config edit\" to fix it":              "运行 \"crosh config validate\" 查看详情，并用 \"crosh config edit\" 修复",
+	"⚠ Proxy is no longer running, removed stale %s proxy settings (restore with: crosh on)\n\n": "⚠ 代理已不在运行，已移除残留的 %s 代理设置（恢复请运行：crosh on）\n\n",
+	"Unknown command: %s\n\n":                                                                    "未知命令：%s\n\n",
+
+	// crosh on / off
+	"Enabling acceleration...":                               "正在开启加速...",
+	"✓ Mirrors enabled (npm, pip, apt, cargo, go)":           "✓ 镜像已开启（npm、pip、apt、cargo、go）",
+	"✗ Proxy failed: %v\n":                                   "✗ 代理启动失败：%v\n",
+	"\nTrying to download Xray-core...":                      "\n正在尝试下载 Xray-core...",
+	"Failed to download Xray-core: %v":                       "下载 Xray-core 失败：%v",
+	"\nProxy acceleration is unavailable.":                   "\n代理加速不可用。",
+	"Mirrors are still enabled and working.":                 "镜像仍已开启并正常工作。",
+	"Proxy still failed: %v":                                 "代理仍然启动失败：%v",
+	"✓ Proxy enabled":                                        "✓ 代理已开启",
+	"\n⚠ Acceleration partly enabled, see the errors above":  "\n⚠ 加速仅部分开启，请查看上方的错误",
+	"\n⚠ Acceleration partly disabled, see the errors above": "\n⚠ 加速仅部分关闭，请查看上方的错误",
+	"\n✓ Acceleration enabled":                               "\n✓ 加速已开启",
+	"Disabling acceleration...":                              "正在关闭加速...",
+	"✓ Mirrors disabled":                                     "✓ 镜像已关闭",
+	"✓ Proxy disabled":                                       "✓ 代理已关闭",
+	"\n✓ Acceleration disabled":                              "\n✓ 加速已关闭",
+
+	// crosh status
+	"Current Status":                        "当前状态",
+	"Profile: %s\n":                         "配置方案：%s\n",
+	"System config: %s\n":                   "系统配置：%s\n",
+	"NAME":                                  "名称",
+	"STATE":                                 "状态",
+	"DETAILS":                               "详情",
+	"SINCE":                                 "生效时间",
+	"enabled":                               "已开启",
+	"disabled":                              "已关闭",
+	"drifted":                               "未生效",
+	"error":                                 "错误",
+	"not configured":                        "未配置",
+	"couldn't read its settings":            "无法读取其设置",
+	"not applied (run \"crosh on\")":        "尚未应用（请运行 \"crosh on\"）",
+	"stopped (run \"crosh on\")":            "已停止（请运行 \"crosh on\"）",
+	"Config:  %s\n":                         "配置文件：%s\n",
+	"\nSubscription: %s (never fetched)\n":  "\n订阅：%s（从未获取）\n",
+	"\nSubscription: %s (fetched %s ago)\n": "\n订阅：%s（%s 前获取）\n",
+	"✓ Everything is applied and up to date":                                                 "✓ 所有设置均已生效且为最新",
+	"the subscription is due for a refresh (run \"crosh on\")":                               "订阅需要刷新（请运行 \"crosh on\"）",
+	"git still points at the proxy (run \"crosh proxy git off\")":                            "git 仍指向代理（请运行 \"crosh proxy git off\"）",
+	"git proxy is on in the config but not applied (run \"crosh proxy git on\")":             "配置中已开启 git 代理但尚未生效（请运行 \"crosh proxy git on\"）",
+	"package managers still point at the proxy (run \"crosh proxy pkg off\")":                "包管理器仍指向代理（请运行 \"crosh proxy pkg off\"）",
+	"package manager proxy is on in the config but not applied (run \"crosh proxy pkg on\")": "配置中已开启包管理器代理但尚未生效（请运行 \"crosh proxy pkg on\"）",
+	"\n  To configure proxy, run:":                                                           "\n  配置代理请运行：",
+	"Latency: ✗ %v":                                                                          "延迟：✗ %v",
+	"Latency: %dms\n":                                                                        "延迟：%dms\n",
+	"Traffic: %s\n":                                                                          "流量：%s\n",
+
+	// --watch
+	"USAGE:\n    crosh %s [--watch] [--interval 2s]\n":     "用法：\n    crosh %s [--watch] [--interval 2s]\n",
+	"✗ --interval must be at least %s\n":                   "✗ --interval 不能小于 %s\n",
+	"\nUpdated %s, refreshing every %s (Ctrl+C to stop)\n": "\n更新于 %s，每 %s 刷新一次（按 Ctrl+C 退出）\n",
+
+	// crosh <subscription-url> / crosh <config.yaml>
+	"Configuring proxy subscription...\n\n":                   "正在配置代理订阅...\n\n",
+	"Error saving config: %v\n":                               "保存配置失败：%v\n",
+	"✓ Subscription URL saved: %s\n":                          "✓ 订阅地址已保存：%s\n",
+	"\nXray-core not found. Downloading...":                   "\n未找到 Xray-core，正在下载...",
+	"Xray-core not found. Downloading...":                     "未找到 Xray-core，正在下载...",
+	"\nYou can try again later with: crosh on":                "\n稍后可运行 crosh on 重试",
+	"✓ Xray-core downloaded successfully":                     "✓ Xray-core 下载成功",
+	"\n✓ Proxy configured successfully":                       "\n✓ 代理配置成功",
+	"\nEnabling mirrors...":                                   "\n正在开启镜像...",
+	"\nStarting proxy...":                                     "\n正在启动代理...",
+	"Failed to start proxy: %v":                               "启动代理失败：%v",
+	"\nYou can try again with: crosh on":                      "\n可运行 crosh on 重试",
+	"\nProxy is running in background.":                       "\n代理正在后台运行。",
+	"Loading proxy configuration from local YAML file...\n\n": "正在从本地 YAML 文件加载代理配置...\n\n",
+	"\nPlease try again later.":                               "\n请稍后重试。",
+	"\nParsing YAML file...":                                  "\n正在解析 YAML 文件...",
+	"Failed to load YAML file: %v":                            "加载 YAML 文件失败：%v",
+	"\nPlease check your YAML file format and try again.":     "\n请检查 YAML 文件格式后重试。",
+	"✓ Found %d nodes in YAML file\n":                         "✓ 在 YAML 文件中找到 %d 个节点\n",
+	"⚠ %v, skipping hysteria2/TUIC nodes\n":                   "⚠ %v，跳过 hysteria2/TUIC 节点\n",
+	"\nTesting node latency...":                               "\n正在测试节点延迟...",
+	"Failed to select node: %v":                               "选择节点失败：%v",
+	"✓ Selected node: %s (latency: %dms)\n":                   "✓ 已选择节点：%s（延迟：%dms）\n",
+	"Failed to generate Xray config: %v":                      "生成 Xray 配置失败：%v",
+	"\n✓ Proxy configured successfully (one-time use)":        "\n✓ 代理配置成功（一次性使用）",
+	"\nTo use the proxy, set these environment variables:":    "\n如需使用代理，请设置以下环境变量：",
+	"\nNote: This is a one-time configuration. To use this YAML file again, run: crosh %s\n": "\n注意：这是一次性配置。再次使用该 YAML 文件请运行：crosh %s\n",
+
+	// crosh uninstall
+	"USAGE:\n    crosh uninstall [--yes] [--keep-config]":                           "用法：\n    crosh uninstall [--yes] [--keep-config]",
+	"\nStops the proxy, the daemon and the package cache, removes git, package":     "\n停止代理、守护进程和包缓存，移除 git、",
+	"manager and Docker proxy settings, disables all mirrors, restores files crosh": "包管理器和 Docker 的代理设置，关闭所有镜像，恢复 crosh",
+	"backed up, removes crosh's lines from shell rc files and deletes crosh's":      "备份过的文件，移除 shell rc 文件中 crosh 添加的行，并删除 crosh 的",
+	"config, data and state directories and its key in the system keyring.":         "配置、数据和状态目录，以及它在系统密钥环中的密钥。",
+	"\nFLAGS:": "\n选项：",
+	"This reverts every change crosh made to this machine and deletes:": "此操作将撤销 crosh 对本机的所有修改，并删除：",
+	"\nContinue? [y/N] ":                       "\n是否继续？[y/N] ",
+	"Uninstall cancelled, nothing was changed": "已取消卸载，未做任何修改",
+	"✓ Deleted %s\n":                           "✓ 已删除 %s\n",
+	"\n⚠ Some changes could not be reverted:":  "\n⚠ 部分修改无法撤销：",
+	"  Nothing was deleted. Fix the cause (e.g. run with sudo for apt and Docker) and run \"crosh uninstall\" again": "  尚未删除任何文件。请解决问题后（例如 apt 和 Docker 需要 sudo）再次运行 \"crosh uninstall\"",
+	"✓ Daemon stopped":                         "✓ 守护进程已停止",
+	"✓ Package cache stopped":                  "✓ 包缓存已停止",
+	"\n✓ crosh has been removed":               "\n✓ crosh 已卸载",
+	"  Delete the binary too with: rm %s\n":    "  如需删除程序本身，请运行：rm %s\n",
+	"✓ Proxy and health monitor stopped":       "✓ 代理和健康监控已停止",
+	"✓ Git proxy settings removed":             "✓ Git 代理设置已移除",
+	"✓ Package manager proxy settings removed": "✓ 包管理器代理设置已移除",
+	"✓ Restored %s\n":                          "✓ 已恢复 %s\n",
+	"✓ Removed crosh lines from %s\n":          "✓ 已从 %s 中移除 crosh 添加的内容\n",
+
+	// crosh self-update
+	"USAGE:\n    crosh self-update [--check] [--force] [--version v1.2.0]":         "用法：\n    crosh self-update [--check] [--force] [--version v1.2.0]",
+	"\nDownloads the release for this platform, verifies it against the release's": "\n下载适用于本平台的发布版本，使用该版本的 checksums.txt",
+	"checksums.txt and replaces the running binary.":                               "校验后替换当前运行的程序。",
+	"Update available: %s → %s (run \"crosh self-update\")\n":                      "有可用更新：%s → %s（运行 \"crosh self-update\"）\n",
+	"✓ crosh %s is up to date (latest: %s)\n":                                      "✓ crosh %s 已是最新版本（最新：%s）\n",
+	"This is a dev build, use --force to replace it with %s\n":                     "当前为开发版本，使用 --force 可替换为 %s\n",
+	"✓ crosh %s is up to date\n":                                                   "✓ crosh %s 已是最新版本\n",
+	"Downloading crosh %s (%s)...\n":                                               "正在下载 crosh %s（%s）...\n",
+	"✓ Checksum verified":                                                          "✓ 校验和验证通过",
+	"✓ Updated %s from %s to %s\n":                                                 "✓ 已将 %s 从 %s 更新到 %s\n",
+
+	// crosh doctor
+	"USAGE:\n    crosh doctor [--timeout 5s]":                                         "用法：\n    crosh doctor [--timeout 5s]",
+	"\nChecks the config, mirror reachability, installed tools, conflicting settings": "\n检查配置、镜像可达性、已安装的工具、冲突的设置",
+	"and the proxy binary, and prints how to fix what's wrong.":                       "以及代理程序，并给出修复建议。",
+	"✓ No problems found":            "✓ 未发现问题",
+	"%d problem(s), %d warning(s)\n": "%d 个问题，%d 个警告\n",
+
+	// crosh init
+	"Welcome to crosh! Let's set up your config.":                 "欢迎使用 crosh！下面来创建你的配置。",
+	"%s already exists. Replace it?":                              "%s 已存在，是否替换？",
+	"Tools (comma separated) [%s]: ":                              "工具（逗号分隔）[%s]：",
+	"Benchmark the mirror presets to find the fastest from here?": "是否测速镜像预设，找出当前网络下最快的？",
+	"Preset [1-%d] (default 1, %s): ":                             "预设 [1-%d]（默认 1，%s）：",
+	"Proxy subscription URL (leave empty to skip): ":              "代理订阅地址（留空跳过）：",
+	"Nothing changed":                                             "未做任何修改",
+	"✓ Wrote %s\n":                                                "✓ 已写入 %s\n",
+	"\nRun \"crosh on\" to enable acceleration":                   "\n运行 \"crosh on\" 开启加速",
+	"✗ Pass --sha256 or --pubkey so the template can be verified (or --insecure to skip)": "✗ 请传入 --sha256 或 --pubkey 以校验模板（或使用 --insecure 跳过）",
+	"Fetching template from %s...\n":                                          "正在从 %s 获取模板...\n",
+	"✓ Signature verified":                                                    "✓ 签名验证通过",
+	"⚠ Template not verified (--insecure)":                                    "⚠ 模板未经校验（--insecure）",
+	"✓ Your config already matches the template":                              "✓ 你的配置已与模板一致",
+	"⚠ Left out the template's hooks (rerun with --allow-hooks to keep them)": "⚠ 未保留模板中的钩子（使用 --allow-hooks 重新运行以保留）",
+	"\nThe template sets hooks, which run these commands:":                    "\n模板设置了钩子，会执行以下命令：",
+	"Keep them?":                             "保留它们？",
+	"\n%s sets a %s hook that runs:\n  %s\n": "\n%s 设置了一个 %s 钩子，会执行：\n  %s\n",
+	"Run it, now and from now on?":           "现在及以后都执行它？",
+	"⚠ Skipping the %s hook %q from %s, run crosh from a terminal to confirm it\n": "⚠ 跳过来自 %[3]s 的 %[1]s 钩子 %[2]q，请在终端中运行 crosh 以确认它\n",
+	"✓ Merged %d setting(s) into %s:\n":                                            "✓ 已将 %d 项设置合并到 %s：\n",
+	"\nRun \"crosh on\" to apply it (\"crosh config restore\" undoes the merge)":   "\n运行 \"crosh on\" 使其生效（\"crosh config restore\" 可撤销合并）",
+	"Which tools should crosh manage?":                                             "需要 crosh 管理哪些工具？",
+	"  Available: %s\n":                                                            "  可选：%s\n",
+	"  ✗ Unknown tool(s): %s\n":                                                    "  ✗ 未知工具：%s\n",
+	"  Probing mirrors...":                                                         "  正在测速镜像...",
+	"\nMirror presets:":                                                            "\n镜像预设：",
+	"  ✗ Pick a number between 1 and %d\n":                                         "  ✗ 请输入 1 到 %d 之间的数字\n",
+	"crosh can also run a proxy for GitHub and other blocked sites.":               "crosh 还可以为 GitHub 等无法访问的网站运行代理。",
+	"  ✗ Expected an http:// or https:// URL":                                      "  ✗ 请输入 http:// 或 https:// 开头的地址",
+
+	// Global flags and logging
+	"✗ Unknown output format %q (expected text or json)\n":  "✗ 未知的输出格式 %q（应为 text 或 json）\n",
+	"⚠ %v, not logging to %s\n":                             "⚠ %v，不写入日志 %s\n",
+	"  %s: %s of %s (%d%%), %s\n":                           "  %s：%s / %s（%d%%），%s\n",
+	"ETA %s":                                                "剩余 %s",
+	"Failed to encode JSON: %v":                             "JSON 编码失败：%v",
+	"existing daemon.json is invalid, moved it aside":       "现有的 daemon.json 无效，已将其备份",
+	"failed to apply git proxy settings":                    "应用 git 代理设置失败",
+	"failed to apply package manager proxy settings":        "应用包管理器代理设置失败",
+	"failed to disable mirrors":                             "关闭镜像失败",
+	"failed to disable proxy":                               "关闭代理失败",
+	"failed to download geo data":                           "下载 geo 数据失败",
+	"failed to enable mirrors":                              "开启镜像失败",
+	"failed to fetch subscription, using manual nodes only": "获取订阅失败，仅使用手动配置的节点",
+	"failed to get latest release info":                     "获取最新版本信息失败",
+	"failed to get latest sing-box release":                 "获取 sing-box 最新版本失败",
+	"failed to record applied proxy settings":               "记录已应用的代理设置失败",
+	"failed to save config":                                 "保存配置失败",
+	"failed to start health monitor":                        "启动健康监控失败",
+	"failed to stop health monitor":                         "停止健康监控失败",
+	"failed to stop proxy":                                  "停止代理失败",
+	"skipping hysteria2/TUIC nodes":                         "跳过 hysteria2/TUIC 节点",
+
+	// Mirrors and proxy
+	"✓ NPM mirror enabled: %s\n":                              "✓ NPM 镜像已开启：%s\n",
+	"✓ Pip mirror enabled: %s\n":                              "✓ Pip 镜像已开启：%s\n",
+	"⚠ Apt mirror skipped: %v\n":                              "⚠ 已跳过 Apt 镜像：%v\n",
+	"✓ Apt mirror enabled: %s\n":                              "✓ Apt 镜像已开启：%s\n",
+	"✓ Cargo mirror enabled: %s\n":                            "✓ Cargo 镜像已开启：%s\n",
+	"✓ Go proxy enabled: %s\n":                                "✓ Go 代理已开启：%s\n",
+	"✓ Docker mirror enabled: %s\n":                           "✓ Docker 镜像已开启：%s\n",
+	"  Additional: %s\n":                                      "  其他：%s\n",
+	"\n%d errors occurred:\n":                                 "\n发生了 %d 个错误：\n",
+	"✓ NPM mirror disabled":                                   "✓ NPM 镜像已关闭",
+	"✓ Pip mirror disabled":                                   "✓ Pip 镜像已关闭",
+	"✓ Apt mirror disabled":                                   "✓ Apt 镜像已关闭",
+	"✓ Cargo mirror disabled":                                 "✓ Cargo 镜像已关闭",
+	"✓ Go proxy disabled":                                     "✓ Go 代理已关闭",
+	"✓ Docker mirror disabled":                                "✓ Docker 镜像已关闭",
+	"Fetching subscription...":                                "正在获取订阅...",
+	"Found %d nodes\n":                                        "找到 %d 个节点\n",
+	"Testing node latency (%s)...\n":                          "正在测试节点延迟（%s）...\n",
+	"Selected node: %s (latency: %dms)\n":                     "已选择节点：%s（延迟：%dms）\n",
+	"✓ Docker daemon proxy set to %s\n":                       "✓ Docker 守护进程代理已设置为 %s\n",
+	"✓ Docker daemon proxy will be set when the proxy starts": "✓ Docker 守护进程代理将在代理启动时设置",
+	"✓ Docker daemon proxy removed":                           "✓ Docker 守护进程代理已移除",
+	"⚠ Docker daemon restart required to apply changes:":      "⚠ 需要重启 Docker 守护进程使修改生效：",
+	"  macOS (Docker Desktop):":                               "  macOS（Docker Desktop）：",
+	"  Linux:":                                                "  Linux：",
+	"  Restart Docker Desktop from the system tray":           "  从系统托盘重启 Docker Desktop",
+	"After restart, test with: docker pull nginx:alpine":      "重启后可运行以下命令测试：docker pull nginx:alpine",
+
+	// Hints printed below errors
+	"rerun with sudo (or from an administrator prompt on Windows)": "请用 sudo 重新运行（Windows 上请在管理员命令提示符中运行）",
+	"start it with \"crosh on\"":                                   "运行 \"crosh on\" 启动代理",
+	"~/.docker is owned by root, probably from running docker with sudo; fix it with \"sudo chown -R $USER ~/.docker\"": "~/.docker 属于 root，可能是用 sudo 运行过 docker；可运行 \"sudo chown -R $USER ~/.docker\" 修复",
+	"fix the JSON in ~/.docker/daemon.json, or remove the file":                                                         "请修正 ~/.docker/daemon.json 中的 JSON，或删除该文件",
+	"run \"crosh on\" to download it": "运行 \"crosh on\" 下载",
+	"run \"crosh <subscription-url>\" or \"crosh proxy add <share-link>\" to add nodes":           "运行 \"crosh <订阅地址>\" 或 \"crosh proxy add <分享链接>\" 添加节点",
+	"check your network, or download Xray-core yourself and point proxy.xray_path at it":          "请检查网络，或手动下载 Xray-core 并将 proxy.xray_path 指向它",
+	"pick another port with \"crosh config set proxy.http_port <port>\"":                          "运行 \"crosh config set proxy.http_port <端口>\" 换一个端口",
+	"pick another port with \"crosh config set proxy.stats_port <port>\"":                         "运行 \"crosh config set proxy.stats_port <端口>\" 换一个端口",
+	"check your network, or refresh the subscription with \"crosh on\" in case the nodes changed": "请检查网络，或运行 \"crosh on\" 刷新订阅（节点可能已变更）",
+	"check your network and the subscription URL":                                                 "请检查网络和订阅地址",
+	"check the subscription URL, it may have expired or been reset":                               "请检查订阅地址，它可能已过期或被重置",
+
+	// Desktop notifications from the health monitor
+	"The proxy stopped running. Run \"crosh on\" to start it again.": "代理已停止运行。运行 \"crosh on\" 重新启动。",
+	"The proxy is working again (node: %s).":                         "代理已恢复正常（节点：%s）。",
+	"The proxy is down and no other node is reachable.":              "代理不可用，且没有其他可连接的节点。",
+	"%s stopped responding, switched to %s.":                         "%s 无响应，已切换到 %s。",
+
+	// First run
+	"no config found, using the defaults (mirrors in mainland China); run \"crosh init\" to set up crosh": "未找到配置，使用默认设置（中国大陆镜像）；运行 \"crosh init\" 进行设置",
+	"Welcome to crosh! There's no config yet, so let's set one up.":                                       "欢迎使用 crosh！还没有配置，我们来创建一个。",
+	"Set up crosh now?": "现在设置 crosh？",
+	"Using the defaults. Run \"crosh init\" any time to change them.": "使用默认设置。随时可以运行 \"crosh init\" 修改。",
+	"Where do you use this machine?":                                  "这台机器在哪里使用？",
+	"  1. Mainland China (use domestic mirrors)":                      "  1. 中国大陆（使用国内镜像）",
+	"  2. Elsewhere (keep the official registries)":                   "  2. 其他地区（保留官方源）",
+	"Region [1-2] (default %d): ":                                     "地区 [1-2]（默认 %d）：",
+	"  ✗ Pick 1 or 2":                                                 "  ✗ 请选择 1 或 2",
+
+	// crosh version
+	"USAGE:\n    crosh version [--check]": "用法：\n    crosh version [--check]",
+	"  Commit:  %s\n":                     "  提交：  %s\n",
+	"  Built:   %s\n":                     "  构建于：%s\n",
+	"  Go:      %s %s\n":                  "  Go：    %s %s\n",
+
+	// Confirming changes to user files
+	"\ncrosh is about to change %s:\n":                 "\ncrosh 即将修改 %s：\n",
+	"Apply this change? [y]es, [n]o, [a]ll: ":          "应用此修改？[y] 是，[n] 否，[a] 全部：",
+	"rerun with --yes to apply changes without asking": "加上 --yes 重新运行可不经询问直接修改",
+
+	// WSL
+	"crosh is running in WSL. Also set the mirrors and package proxy for your Windows user?": "crosh 正在 WSL 中运行。是否同时为 Windows 用户设置镜像和包管理器代理？",
+	"✓ Windows %s mirror enabled: %s\n":                                                      "✓ Windows %s 镜像已启用：%s\n",
+	"✓ Windows %s mirror disabled\n":                                                         "✓ Windows %s 镜像已禁用\n",
+
+	// crosh export
+	"No mirrors configured to export (set them with: crosh config set mirror.npm <url>)":               "没有可导出的镜像（使用 crosh config set mirror.npm <url> 设置）",
+	"✓ Wrote the devcontainer feature to %s\n":                                                         "✓ 已将 devcontainer feature 写入 %s\n",
+	"  Add it to .devcontainer/devcontainer.json:":                                                     "  将其添加到 .devcontainer/devcontainer.json：",
+	"✓ Wrote the Ansible role to %s\n":                                                                 "✓ 已将 Ansible role 写入 %s\n",
+	"No Docker registry mirrors configured (set them with: crosh config set mirror.docker <registry>)": "没有配置 Docker 镜像源（使用 crosh config set mirror.docker <registry> 设置）",
+	"Choose one of --github and --gitlab":                                                              "请在 --github 和 --gitlab 中选择一个",
+	"Invalid proxy URL: %s":                                                                            "无效的代理地址：%s",
+	"  Add it to a playbook:":                                                                          "  将其添加到 playbook：",
+	"Failed to write %s: %v":                                                                           "写入 %s 失败：%v",
+	"  Run a program through the proxy with:":                                                          "  通过代理运行程序：",
+	"⚠ The proxy is off; start it with: crosh on":                                                      "⚠ 代理未开启，请运行：crosh on",
+
+	// Existing (corporate) proxies
+	"⚠ %s already uses the proxy %s (%s), left unchanged\n":                                        "⚠ %s 已在使用代理 %s（%s），保持不变\n",
+	"\n⚠ %s already set to %s by other tooling (e.g. a corporate proxy)\n":                         "\n⚠ %s 已被其他工具（如公司代理）设置为 %s\n",
+	"  crosh's variables replace it and crosh's proxy connects directly; NO_PROXY keeps its hosts": "  crosh 的变量会替换它，且 crosh 的代理直接连接；NO_PROXY 中的主机会保留",
+	"NO_PROXY has hosts crosh's proxy doesn't bypass: %s. Bypass them too?":                        "NO_PROXY 中有 crosh 代理未绕过的主机：%s。是否也绕过它们？",
+	"\n⚠ NO_PROXY has hosts crosh's proxy doesn't bypass: %s\n":                                    "\n⚠ NO_PROXY 中有 crosh 代理未绕过的主机：%s\n",
+	"  Bypass them too with: crosh proxy bypass add %s\n":                                          "  可用以下命令绕过：crosh proxy bypass add %s\n",
+	"✓ %s now connects directly\n":                                                                 "✓ %s 现在直接连接\n",
+	"Failed to update bypass list: %v":                                                             "更新绕过列表失败：%v",
+
+	// doas
+	"rerun with doas": "请用 doas 重新运行",
+
+	// Windows system proxy
+	"✓ System proxy settings restored":                                                    "✓ 系统代理设置已恢复",
+	"the Windows system proxy still points at the proxy (run \"crosh proxy system off\")": "Windows 系统代理仍指向代理（请运行 \"crosh proxy system off\"）",
+	"system proxy is on in the config but not applied (run \"crosh proxy system on\")":    "配置中已开启系统代理但尚未生效（请运行 \"crosh proxy system on\"）",
+
+	// Webhooks
+	"Mirrors enabled: %s":                     "已启用镜像：%s",
+	"Mirrors disabled: %s":                    "已关闭镜像：%s",
+	"Subscription changed: %d nodes (was %d)": "订阅已变更：%d 个节点（原为 %d 个）",
+
+	// crosh mirror
+	"Failed to enable mirrors: %v":        "开启镜像失败：%v",
+	"✓ Mirrors enabled in container %s\n": "✓ 已在容器 %s 内开启镜像\n",
+
+	// crosh cache
+	"✓ %s uses %s\n": "✓ %s 已使用 %s\n",
+	"No npm, pip or go mirror configured to cache":                           "没有可缓存的 npm、pip 或 go 镜像",
+	"Failed to create %s: %v":                                                "创建 %s 失败：%v",
+	"\n✓ Downloaded %d of %d into %s (%d MB of packages)\n":                  "\n✓ 已下载 %d/%d 项到 %s（软件包共 %d MB）\n",
+	"  On the offline machine, serve the packages and load the images with:": "  在离线机器上用以下命令提供软件包并导入镜像：",
+	"Package cache failed: %v":                                               "包缓存运行失败：%v",
+	"\nInterrupted, cleaning up (press Ctrl+C again to quit now)...\n":       "\n已中断，正在清理（再按 Ctrl+C 立即退出）...\n",
+
+	// interrupted operations
+	"⚠ crosh was stopped halfway through %s (%s), these files may be half changed:\n": "⚠ crosh 在执行 %s 时中途被终止（%s），以下文件可能只改了一半：\n",
+	"Failed to finish %s: %v":    "完成 %s 失败：%v",
+	"Failed to roll back %s: %v": "回滚 %s 失败：%v",
+	"✓ Finished %s\n\n":          "✓ 已完成 %s\n\n",
+	"✓ Rolled back %s\n\n":       "✓ 已回滚 %s\n\n",
+	"  Left as is; run crosh on a terminal, or with --yes, to finish or roll it back\n\n": "  暂不处理；在终端中运行 crosh 或加上 --yes 即可完成或回滚\n\n",
+	"[f]inish it, [r]oll it back or [l]eave it for now? ":                                 "[f] 完成，[r] 回滚，[l] 暂不处理？",
+	"[r]oll it back or [l]eave it for now? ":                                              "[r] 回滚，[l] 暂不处理？",
+	"✓ Telemetry off, nothing more is sent":                                               "✓ 已关闭使用统计，不会再发送任何数据",
+	"✓ Telemetry on, thank you! Each command sends:":                                      "✓ 已开启使用统计，感谢支持！每条命令发送：",
+	"⚠ DO_NOT_TRACK is set, so nothing is sent from this shell":                           "⚠ 已设置 DO_NOT_TRACK，此 shell 中不会发送任何数据",
+	"Telemetry: off (turn it on with: crosh telemetry on)":                                "使用统计：关闭（开启：crosh telemetry on）",
+	"Telemetry: on in the config, but off in this shell because DO_NOT_TRACK is set":      "使用统计：配置中已开启，但此 shell 设置了 DO_NOT_TRACK，因此不会发送",
+	"Telemetry: on, sent to %s\n":                                                         "使用统计：开启，发送到 %s\n",
+	"Each command sends:":                                                                 "每条命令发送：",
+}
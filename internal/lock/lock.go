@@ -0,0 +1,108 @@
+package lock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boomyao/crosh/internal/config"
+	"github.com/boomyao/crosh/internal/fsys"
+	"github.com/boomyao/crosh/internal/hint"
+)
+
+// FS holds the lock file; tests point it at fsys.Dir. On Windows the file is
+// opened with CreateFile to share it, which only the real filesystem can do.
+var FS = fsys.OS
+
+// ErrLocked is returned when another crosh process holds the lock
+var ErrLocked = errors.New("another crosh instance is running")
+
+// Command names the running command in the lock file, for whoever has to
+// wait; main sets it. It mustn't hold anything the user typed in, like a
+// subscription URL: the file stays behind after crosh exits.
+var Command string
+
+// errBusy is returned by lockFile when another process holds the lock
+var errBusy = errors.New("lock is held")
+
+// The lock is held by this process while count > 0
+var (
+	mu    sync.Mutex
+	file  *os.File
+	count int
+)
+
+// Path returns the lock file
+func Path() string {
+	return filepath.Join(config.StateDir(), "crosh.lock")
+}
+
+// Acquire takes the lock that crosh changes config.yaml and the package
+// managers' files under, waiting up to wait for another crosh process to
+// release it. The same process can take it again; every Acquire that
+// succeeds needs a Release.
+func Acquire(wait time.Duration) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if count > 0 {
+		count++
+		return nil
+	}
+
+	if err := FS.MkdirAll(config.StateDir(), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", config.StateDir(), err)
+	}
+	deadline := time.Now().Add(wait)
+	for {
+		f, err := lockFile(Path())
+		if err == nil {
+			// Tell whoever has to wait who they are waiting for
+			if f.Truncate(0) == nil {
+				fmt.Fprintf(f, "PID %d: crosh %s", os.Getpid(), Command)
+			}
+			file, count = f, 1
+			return nil
+		}
+		if !errors.Is(err, errBusy) {
+			return fmt.Errorf("failed to lock %s: %w", Path(), err)
+		}
+		if time.Now().After(deadline) {
+			return hint.Wrap(fmt.Errorf("%w (%s)", ErrLocked, holder()), "wait for it to finish, then try again")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Release gives the lock up once every Acquire has been released
+func Release() {
+	mu.Lock()
+	defer mu.Unlock()
+	if count == 0 {
+		return
+	}
+	count--
+	if count == 0 {
+		file.Close()
+		file = nil
+	}
+}
+
+// Held checks if this process holds the lock
+func Held() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return count > 0
+}
+
+// holder describes the process holding the lock, as it wrote into the file
+func holder() string {
+	data, err := FS.ReadFile(Path())
+	if err != nil || len(data) == 0 {
+		return "unknown process"
+	}
+	return strings.TrimSpace(string(data))
+}
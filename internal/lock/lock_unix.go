@@ -0,0 +1,35 @@
+//go:build !windows
+
+package lock
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// lockFile opens path and takes an exclusive flock on it without waiting.
+// The kernel drops the lock when the process exits, even if it crashes.
+func lockFile(path string) (*os.File, error) {
+	f, err := FS.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err == nil {
+		// Older versions created it readable by everyone
+		f.Chmod(0600)
+	}
+	if errors.Is(err, fs.ErrPermission) {
+		// Created by another user, e.g. with sudo; a read-only handle still locks
+		f, err = FS.Open(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, errBusy
+		}
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,145 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/boomyao/crosh/internal/i18n"
+)
+
+// Console verbosity, set by --quiet, -v and -vv
+const (
+	Quiet       = -1 // only errors
+	Normal      = 0  // warnings and errors
+	Verbose     = 1  // also info
+	VeryVerbose = 2  // also debug
+)
+
+// Log rotation limits for crosh.log
+const (
+	maxLogSize    = 5 * 1024 * 1024
+	maxLogBackups = 3
+)
+
+var (
+	verbosity = Normal
+	file      *os.File
+	logger    = slog.New(slog.NewTextHandler(io.Discard, nil))
+)
+
+// Init sets the console verbosity and starts writing every message, at
+// debug level, to the log file at path. The console keeps working if the
+// file can't be opened.
+func Init(path string, level int) error {
+	verbosity = level
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create log directory: %w", err)
+	}
+	if err := rotate(path); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+
+	file = f
+	logger = slog.New(slog.NewJSONHandler(f, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	return nil
+}
+
+// Close flushes and closes the log file
+func Close() {
+	if file != nil {
+		file.Close()
+	}
+}
+
+// Verbosity returns the console verbosity
+func Verbosity() int {
+	return verbosity
+}
+
+// Debug logs a debug message, shown on the console with -vv
+func Debug(msg string, args ...any) {
+	log(slog.LevelDebug, VeryVerbose, "", msg, args)
+}
+
+// Info logs an informational message, shown on the console with -v
+func Info(msg string, args ...any) {
+	log(slog.LevelInfo, Verbose, "", msg, args)
+}
+
+// Warn logs a warning, shown on the console unless --quiet is set
+func Warn(msg string, args ...any) {
+	log(slog.LevelWarn, Normal, "⚠ ", msg, args)
+}
+
+// Error logs an error, which is always shown on the console
+func Error(msg string, args ...any) {
+	log(slog.LevelError, Quiet, "✗ ", msg, args)
+}
+
+// Failed logs an error that the caller already reports to the user in its
+// own words, so it's only repeated on the console with -v
+func Failed(msg string, args ...any) {
+	log(slog.LevelError, Verbose, "✗ ", msg, args)
+}
+
+// log writes a message to the log file and, if verbosity is at least
+// minVerbosity, to stderr as "<mark><msg>: <error> (key=value ...)"
+func log(level slog.Level, minVerbosity int, mark, msg string, args []any) {
+	logger.Log(context.Background(), level, msg, args...)
+
+	if verbosity < minVerbosity || msg == "" {
+		return
+	}
+
+	// Warnings and errors read as sentences, info and debug keep their keys
+	line := msg
+	if mark != "" {
+		line = i18n.T(msg)
+		r, size := utf8.DecodeRuneInString(line)
+		line = mark + string(unicode.ToUpper(r)) + line[size:]
+	}
+	var attrs []string
+	for i := 0; i+1 < len(args); i += 2 {
+		key := fmt.Sprint(args[i])
+		if key == "error" {
+			line += fmt.Sprintf(": %v", args[i+1])
+			continue
+		}
+		attrs = append(attrs, fmt.Sprintf("%s=%v", key, args[i+1]))
+	}
+	if len(attrs) > 0 {
+		line += " (" + strings.Join(attrs, " ") + ")"
+	}
+	fmt.Fprintln(os.Stderr, line)
+}
+
+// rotate shifts path to path.1, path.1 to path.2 and so on once it exceeds maxLogSize
+func rotate(path string) error {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() < maxLogSize {
+		return nil
+	}
+
+	os.Remove(fmt.Sprintf("%s.%d", path, maxLogBackups))
+	for i := maxLogBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1))
+	}
+
+	if err := os.Rename(path, path+".1"); err != nil {
+		return fmt.Errorf("failed to rotate log: %w", err)
+	}
+
+	return nil
+}
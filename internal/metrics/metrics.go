@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boomyao/crosh/internal/accelerator"
+	"github.com/boomyao/crosh/internal/config"
+	"github.com/boomyao/crosh/internal/mirror"
+)
+
+// benchInterval is how often the mirror presets are benchmarked; probing
+// them on every scrape would load the mirrors and slow the scrape down
+const benchInterval = 15 * time.Minute
+
+// benchTimeout bounds probing one mirror
+const benchTimeout = 5 * time.Second
+
+// Exporter writes crosh's state in the Prometheus text format
+type Exporter struct {
+	mu      sync.Mutex
+	bench   []mirror.PresetLatency
+	benchAt time.Time
+}
+
+// NewExporter creates a new exporter and benchmarks the mirror presets in the
+// background until stop is closed
+func NewExporter(stop <-chan struct{}) *Exporter {
+	e := &Exporter{}
+	go e.runBench(stop)
+	return e
+}
+
+// runBench refreshes the mirror bench results every benchInterval
+func (e *Exporter) runBench(stop <-chan struct{}) {
+	ticker := time.NewTicker(benchInterval)
+	defer ticker.Stop()
+	for {
+		// Fresh results every time, this is a monitor
+		results := mirror.BenchPresets(context.Background(), benchTimeout, nil)
+		e.mu.Lock()
+		e.bench, e.benchAt = results, time.Now()
+		e.mu.Unlock()
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Write writes the metrics of the proxy and mirrors described by manager and cfg
+func (e *Exporter) Write(w io.Writer, manager *accelerator.Manager, cfg *config.Config) {
+	status := manager.ProxyStatusDetails()
+
+	gauge(w, "crosh_proxy_up", "Whether the proxy process is running.", boolValue(status.Running))
+	if status.Running && status.Node != nil {
+		header(w, "crosh_proxy_node_info", "gauge", "The node the proxy connects through.")
+		fmt.Fprintf(w, "crosh_proxy_node_info{node=%s,type=%s} 1\n", quote(status.Node.Name), quote(status.Node.Type))
+
+		header(w, "crosh_proxy_latency_seconds", "gauge", "Latency of the health check through the current node.")
+		if status.LatencyErr == nil {
+			fmt.Fprintf(w, "crosh_proxy_latency_seconds %g\n", status.Latency.Seconds())
+		} else {
+			fmt.Fprintln(w, "crosh_proxy_latency_seconds NaN")
+		}
+	}
+	gauge(w, "crosh_proxy_failover_active", "Whether the health monitor watches the proxy.", boolValue(status.Running && status.MonitorRunning))
+
+	if status.Traffic != nil {
+		header(w, "crosh_proxy_traffic_bytes_total", "counter", "Bytes sent through the proxy since it started.")
+		fmt.Fprintf(w, "crosh_proxy_traffic_bytes_total{direction=\"up\"} %d\n", status.Traffic.Uplink)
+		fmt.Fprintf(w, "crosh_proxy_traffic_bytes_total{direction=\"down\"} %d\n", status.Traffic.Downlink)
+	}
+	if !status.StartedAt.IsZero() && status.Running {
+		gauge(w, "crosh_proxy_start_time_seconds", "When the proxy was started, as a Unix timestamp.", float64(status.StartedAt.Unix()))
+	}
+	if !status.SubscriptionUpdated.IsZero() {
+		gauge(w, "crosh_subscription_last_refresh_timestamp_seconds", "When the subscription was last fetched, as a Unix timestamp.", float64(status.SubscriptionUpdated.Unix()))
+	}
+
+	header(w, "crosh_mirror_enabled", "gauge", "Whether crosh points the tool at a mirror.")
+	for _, name := range config.MirrorToolNames {
+		fmt.Fprintf(w, "crosh_mirror_enabled{tool=%s} %g\n", quote(name), boolValue(cfg.Mirror.Tool(name).Enabled))
+	}
+
+	e.mu.Lock()
+	bench, benchAt := e.bench, e.benchAt
+	e.mu.Unlock()
+	if len(bench) == 0 {
+		return
+	}
+	header(w, "crosh_mirror_preset_up", "gauge", "Whether any mirror of the preset answered the last bench.")
+	for _, result := range bench {
+		fmt.Fprintf(w, "crosh_mirror_preset_up{preset=%s} %g\n", quote(result.Preset.Name), boolValue(result.Err == nil))
+	}
+	header(w, "crosh_mirror_preset_latency_seconds", "gauge", "Average latency of the preset's npm, pip and apt mirrors in the last bench.")
+	for _, result := range bench {
+		if result.Err == nil {
+			fmt.Fprintf(w, "crosh_mirror_preset_latency_seconds{preset=%s} %g\n", quote(result.Preset.Name), result.Latency.Seconds())
+		}
+	}
+	gauge(w, "crosh_mirror_bench_timestamp_seconds", "When the mirror presets were last benchmarked, as a Unix timestamp.", float64(benchAt.Unix()))
+}
+
+// header writes the HELP and TYPE lines of a metric
+func header(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// gauge writes a gauge without labels
+func gauge(w io.Writer, name, help string, value float64) {
+	header(w, name, "gauge", help)
+	fmt.Fprintf(w, "%s %s\n", name, strconv.FormatFloat(value, 'f', -1, 64)) // timestamps without an exponent
+}
+
+// boolValue returns 1 for true and 0 for false
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// quote returns a label value in double quotes with \, " and newlines escaped
+func quote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+	return `"` + s + `"`
+}
@@ -3,12 +3,13 @@ package mirror
 import (
 	"fmt"
 	"os"
-	"os/exec"
-	"runtime"
 	"strings"
+
+	"github.com/boomyao/crosh/internal/hint"
+	"github.com/boomyao/crosh/internal/userfile"
 )
 
-// AptMirror handles apt sources configuration
+// AptMirror handles apt sources configuration, and the pkg repository on FreeBSD
 type AptMirror struct {
 	mirrorURL string
 }
@@ -23,7 +24,7 @@ func NewAptMirror(mirrorURL string) *AptMirror {
 // detectUbuntuVersion detects the Ubuntu/Debian version codename
 func detectUbuntuVersion() (string, error) {
 	// Try to read /etc/os-release
-	data, err := os.ReadFile("/etc/os-release")
+	data, err := userfile.FS.ReadFile("/etc/os-release")
 	if err != nil {
 		return "", fmt.Errorf("failed to read /etc/os-release: %w", err)
 	}
@@ -39,10 +40,8 @@ func detectUbuntuVersion() (string, error) {
 	}
 
 	// Fallback: try lsb_release command
-	cmd := exec.Command("lsb_release", "-cs")
-	output, err := cmd.Output()
-	if err == nil {
-		return strings.TrimSpace(string(output)), nil
+	if codename, err := run("lsb_release", "-cs"); err == nil {
+		return codename, nil
 	}
 
 	return "", fmt.Errorf("failed to detect Ubuntu version")
@@ -50,9 +49,12 @@ func detectUbuntuVersion() (string, error) {
 
 // Enable configures apt to use the mirror
 func (a *AptMirror) Enable() error {
+	if goos == "freebsd" {
+		return NewPkgMirror(a.mirrorURL).Enable()
+	}
 	// Only works on Linux
-	if runtime.GOOS != "linux" {
-		return fmt.Errorf("apt mirror only works on Linux systems")
+	if goos != "linux" {
+		return fmt.Errorf("apt mirror only works on Linux and FreeBSD systems")
 	}
 
 	// Detect Ubuntu version
@@ -65,13 +67,13 @@ func (a *AptMirror) Enable() error {
 	backupPath := "/etc/apt/sources.list.crosh.backup"
 
 	// Backup original sources.list if not already backed up
-	if _, err := os.Stat(backupPath); os.IsNotExist(err) {
-		data, err := os.ReadFile(sourcesPath)
+	if _, err := userfile.FS.Stat(backupPath); os.IsNotExist(err) {
+		data, err := userfile.FS.ReadFile(sourcesPath)
 		if err != nil {
 			return fmt.Errorf("failed to read sources.list: %w", err)
 		}
-		if err := os.WriteFile(backupPath, data, 0644); err != nil {
-			return fmt.Errorf("failed to backup sources.list: %w", err)
+		if err := userfile.FS.WriteFile(backupPath, data, 0644); err != nil {
+			return hint.IfDenied(fmt.Errorf("failed to backup sources.list: %w", err), hint.Sudo)
 		}
 	}
 
@@ -84,8 +86,8 @@ deb http://%s/ubuntu/ %s-security main restricted universe multiverse
 `, a.mirrorURL, codename, a.mirrorURL, codename, a.mirrorURL, codename, a.mirrorURL, codename)
 
 	// Write new sources.list (requires sudo)
-	if err := os.WriteFile(sourcesPath, []byte(content), 0644); err != nil {
-		return fmt.Errorf("failed to write sources.list (try running with sudo): %w", err)
+	if err := userfile.Write(sourcesPath, []byte(content), 0644); err != nil {
+		return hint.IfDenied(fmt.Errorf("failed to write sources.list: %w", err), hint.Sudo)
 	}
 
 	return nil
@@ -93,41 +95,47 @@ deb http://%s/ubuntu/ %s-security main restricted universe multiverse
 
 // Disable restores the original apt sources
 func (a *AptMirror) Disable() error {
-	if runtime.GOOS != "linux" {
-		return fmt.Errorf("apt mirror only works on Linux systems")
+	if goos == "freebsd" {
+		return NewPkgMirror(a.mirrorURL).Disable()
+	}
+	if goos != "linux" {
+		return fmt.Errorf("apt mirror only works on Linux and FreeBSD systems")
 	}
 
 	sourcesPath := "/etc/apt/sources.list"
 	backupPath := "/etc/apt/sources.list.crosh.backup"
 
 	// Restore from backup
-	if _, err := os.Stat(backupPath); os.IsNotExist(err) {
+	if _, err := userfile.FS.Stat(backupPath); os.IsNotExist(err) {
 		return fmt.Errorf("no backup found to restore")
 	}
 
-	data, err := os.ReadFile(backupPath)
+	data, err := userfile.FS.ReadFile(backupPath)
 	if err != nil {
 		return fmt.Errorf("failed to read backup: %w", err)
 	}
 
-	if err := os.WriteFile(sourcesPath, data, 0644); err != nil {
-		return fmt.Errorf("failed to restore sources.list: %w", err)
+	if err := userfile.Write(sourcesPath, data, 0644); err != nil {
+		return hint.IfDenied(fmt.Errorf("failed to restore sources.list: %w", err), hint.Sudo)
 	}
 
 	// Remove backup file
-	os.Remove(backupPath)
+	userfile.FS.Remove(backupPath)
 
 	return nil
 }
 
 // Status checks if the mirror is currently enabled
 func (a *AptMirror) Status() (bool, string, error) {
-	if runtime.GOOS != "linux" {
-		return false, "", fmt.Errorf("apt mirror only works on Linux systems")
+	if goos == "freebsd" {
+		return NewPkgMirror(a.mirrorURL).Status()
+	}
+	if goos != "linux" {
+		return false, "", fmt.Errorf("apt mirror only works on Linux and FreeBSD systems")
 	}
 
 	sourcesPath := "/etc/apt/sources.list"
-	data, err := os.ReadFile(sourcesPath)
+	data, err := userfile.FS.ReadFile(sourcesPath)
 	if err != nil {
 		return false, "", fmt.Errorf("failed to read sources.list: %w", err)
 	}
@@ -5,6 +5,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/boomyao/crosh/internal/userfile"
 )
 
 // CargoMirror handles Rust cargo registry configuration
@@ -21,18 +23,17 @@ func NewCargoMirror(registryURL string) *CargoMirror {
 
 // getCargoConfigPath returns the path to cargo config.toml
 func getCargoConfigPath() (string, error) {
-	homeDir, err := os.UserHomeDir()
+	homeDir, err := userHome()
 	if err != nil {
 		return "", fmt.Errorf("failed to get user home directory: %w", err)
 	}
 
-	// ~/.cargo/config.toml
-	cargoDir := filepath.Join(homeDir, ".cargo")
-	if err := os.MkdirAll(cargoDir, 0755); err != nil {
+	path := cargoConfigFile(homeDir)
+	if err := userfile.FS.MkdirAll(filepath.Dir(path), 0755); err != nil {
 		return "", fmt.Errorf("failed to create cargo directory: %w", err)
 	}
 
-	return filepath.Join(cargoDir, "config.toml"), nil
+	return path, nil
 }
 
 // Enable configures cargo to use the mirror registry
@@ -44,7 +45,7 @@ func (c *CargoMirror) Enable() error {
 
 	// Read existing config if it exists
 	var existingContent string
-	if data, err := os.ReadFile(cargoConfigPath); err == nil {
+	if data, err := userfile.FS.ReadFile(cargoConfigPath); err == nil {
 		existingContent = string(data)
 	}
 
@@ -112,7 +113,7 @@ func (c *CargoMirror) Enable() error {
 
 	// Write back
 	content := strings.Join(newLines, "\n") + "\n"
-	if err := os.WriteFile(cargoConfigPath, []byte(content), 0644); err != nil {
+	if err := userfile.Write(cargoConfigPath, []byte(content), 0644); err != nil {
 		return fmt.Errorf("failed to write cargo config: %w", err)
 	}
 
@@ -126,7 +127,7 @@ func (c *CargoMirror) Disable() error {
 		return err
 	}
 
-	data, err := os.ReadFile(cargoConfigPath)
+	data, err := userfile.FS.ReadFile(cargoConfigPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil
@@ -159,11 +160,11 @@ func (c *CargoMirror) Disable() error {
 	// Write back or remove file if empty
 	if len(newLines) > 0 {
 		content := strings.Join(newLines, "\n") + "\n"
-		if err := os.WriteFile(cargoConfigPath, []byte(content), 0644); err != nil {
+		if err := userfile.Write(cargoConfigPath, []byte(content), 0644); err != nil {
 			return fmt.Errorf("failed to write cargo config: %w", err)
 		}
 	} else {
-		os.Remove(cargoConfigPath)
+		userfile.Remove(cargoConfigPath)
 	}
 
 	return nil
@@ -176,7 +177,7 @@ func (c *CargoMirror) Status() (bool, string, error) {
 		return false, "", err
 	}
 
-	data, err := os.ReadFile(cargoConfigPath)
+	data, err := userfile.FS.ReadFile(cargoConfigPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return false, "default registry", nil
@@ -0,0 +1,114 @@
+package mirror
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/boomyao/crosh/internal/userfile"
+)
+
+// proxyEnvNames are the variables proxy tooling exports, e.g. a corporate
+// setup script in /etc/profile.d
+var proxyEnvNames = []string{"HTTP_PROXY", "HTTPS_PROXY", "ALL_PROXY", "http_proxy", "https_proxy", "all_proxy"}
+
+// ExistingProxy is a proxy configured by something other than crosh, such
+// as corporate tooling
+type ExistingProxy struct {
+	Tool   string // "env", "npm", "pip", "cargo" or "gradle"
+	Source string // the variable or the file it is set in
+	Value  string
+}
+
+// ExistingProxies finds the proxies in the environment and in the npm, pip,
+// cargo and gradle configs that don't point at crosh's proxy on one of
+// ownHosts (host:port)
+func ExistingProxies(ownHosts ...string) []ExistingProxy {
+	isOwn := func(value string) bool {
+		for _, host := range ownHosts {
+			if strings.Contains(value, host) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var found []ExistingProxy
+	for _, name := range proxyEnvNames {
+		if value := os.Getenv(name); value != "" && !isOwn(value) {
+			found = append(found, ExistingProxy{Tool: "env", Source: name, Value: value})
+		}
+	}
+
+	homeDir, err := userHome()
+	if err != nil {
+		return found
+	}
+	files := []struct {
+		tool, path, section string
+		keys                []string
+	}{
+		{"npm", npmrcFile(homeDir), "", []string{"proxy", "https-proxy"}},
+		{"pip", pipConfigFile(homeDir), "global", []string{"proxy"}},
+		{"cargo", cargoConfigFile(homeDir), "http", []string{"proxy"}},
+	}
+	for _, file := range files {
+		data, err := userfile.FS.ReadFile(file.path)
+		if err != nil {
+			continue
+		}
+		for _, key := range file.keys {
+			if value := valueInSection(string(data), file.section, key); value != "" && !isOwn(value) {
+				found = append(found, ExistingProxy{Tool: file.tool, Source: fmt.Sprintf("%s (%s)", file.path, key), Value: value})
+				break
+			}
+		}
+	}
+
+	gradlePath := gradlePropertiesFile(homeDir)
+	if host := gradleProxyHost(gradlePath); host != "" {
+		found = append(found, ExistingProxy{Tool: "gradle", Source: gradlePath + " (systemProp.https.proxyHost)", Value: host})
+	}
+	return found
+}
+
+// valueInSection returns the unquoted value of key in a section of an
+// INI/TOML style file, or "" if it isn't set. An empty section refers to the
+// top of the file.
+func valueInSection(content, section, key string) string {
+	inSection := section == ""
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			inSection = trimmed == "["+section+"]"
+			continue
+		}
+		if inSection && keyOf(trimmed) == key {
+			value := strings.TrimSpace(strings.SplitN(trimmed, "=", 2)[1])
+			return strings.Trim(value, `"'`)
+		}
+	}
+	return ""
+}
+
+// gradleProxyHost returns the HTTPS proxy host set in gradle.properties
+// outside crosh's block
+func gradleProxyHost(path string) string {
+	data, err := userfile.FS.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	inBlock := false
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == gradleBlockStart:
+			inBlock = true
+		case trimmed == gradleBlockEnd:
+			inBlock = false
+		case !inBlock && keyOf(trimmed) == "systemProp.https.proxyHost":
+			return strings.TrimSpace(strings.SplitN(trimmed, "=", 2)[1])
+		}
+	}
+	return ""
+}
@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"runtime"
 	"strings"
+
+	"github.com/boomyao/crosh/internal/hint"
+	"github.com/boomyao/crosh/internal/logging"
+	"github.com/boomyao/crosh/internal/userfile"
 )
 
 // DockerMirror handles Docker registry mirror configuration
@@ -21,20 +24,28 @@ func NewDockerMirror(registries []string) *DockerMirror {
 	}
 }
 
+// dockerOwnerHint is the hint for a ~/.docker crosh may not write to
+const dockerOwnerHint = "~/.docker is owned by root, probably from running docker with sudo; fix it with \"sudo chown -R $USER ~/.docker\""
+
 // getDockerConfigPath returns the path to Docker daemon config file
 func (d *DockerMirror) getDockerConfigPath() (string, error) {
-	homeDir, err := os.UserHomeDir()
+	homeDir, err := localHome()
 	if err != nil {
 		return "", fmt.Errorf("failed to get user home directory: %w", err)
 	}
 
-	// For Docker Desktop on macOS and Windows, use ~/.docker/daemon.json
+	// Docker Desktop on Windows, also when used from WSL2
+	if goos == "windows" || (goos == "linux" && d.isDockerDesktop()) {
+		return desktopDaemonConfig()
+	}
+
+	// For Docker Desktop on macOS, use ~/.docker/daemon.json
 	// For Linux, it's typically /etc/docker/daemon.json but we'll use user config
 	// to avoid requiring sudo permissions
-	if runtime.GOOS == "linux" {
+	if goos == "linux" {
 		// Check if /etc/docker/daemon.json exists (system-wide config)
 		systemPath := "/etc/docker/daemon.json"
-		if _, err := os.Stat(systemPath); err == nil {
+		if _, err := userfile.FS.Stat(systemPath); err == nil {
 			// System config exists, but we can't modify it without sudo
 			// Use user-level config instead
 			return filepath.Join(homeDir, ".docker", "daemon.json"), nil
@@ -46,16 +57,56 @@ func (d *DockerMirror) getDockerConfigPath() (string, error) {
 
 // isDockerDesktop checks if Docker Desktop is being used
 func (d *DockerMirror) isDockerDesktop() bool {
-	if runtime.GOOS == "darwin" {
+	switch goos {
+	case "darwin":
 		// Check if Docker Desktop is installed on macOS
 		dockerDesktopPath := "/Applications/Docker.app"
-		if _, err := os.Stat(dockerDesktopPath); err == nil {
+		if _, err := userfile.FS.Stat(dockerDesktopPath); err == nil {
 			return true
 		}
+	case "windows":
+		// Docker on Windows is Docker Desktop, whose daemon runs in a VM
+		return true
+	case "linux":
+		// The WSL2 backend mounts Docker Desktop into every integrated distro
+		if InWSL() {
+			if _, err := userfile.FS.Stat("/mnt/wsl/docker-desktop"); err == nil {
+				return true
+			}
+		}
 	}
 	return false
 }
 
+// manualSetup reports whether the mirrors must be set by hand in the Docker
+// Desktop settings, which is the case on macOS. On Windows and WSL2 crosh
+// writes Docker Desktop's daemon.json itself.
+func (d *DockerMirror) manualSetup() bool {
+	return goos == "darwin" && d.isDockerDesktop()
+}
+
+// desktopDaemonConfig returns the Docker Engine config of Docker Desktop on
+// Windows: ~/.docker/daemon.json, or %APPDATA%\Docker\daemon.json where older
+// releases kept it. From WSL2 the Windows paths are translated with wslpath.
+func desktopDaemonConfig() (string, error) {
+	userProfile, err := windowsDir("USERPROFILE")
+	if err != nil {
+		return "", err
+	}
+	current := filepath.Join(userProfile, ".docker", "daemon.json")
+	if _, err := userfile.FS.Stat(current); err == nil {
+		return current, nil
+	}
+
+	if appData, err := windowsDir("APPDATA"); err == nil {
+		legacy := filepath.Join(appData, "Docker", "daemon.json")
+		if _, err := userfile.FS.Stat(legacy); err == nil {
+			return legacy, nil
+		}
+	}
+	return current, nil
+}
+
 // enableDockerDesktop provides instructions for Docker Desktop users
 func (d *DockerMirror) enableDockerDesktop() error {
 	fmt.Println("\n⚠ Docker Desktop detected!")
@@ -93,8 +144,8 @@ func (d *DockerMirror) enableDockerDesktop() error {
 
 // Enable configures Docker to use registry mirrors
 func (d *DockerMirror) Enable() error {
-	// For Docker Desktop, provide instructions instead
-	if d.isDockerDesktop() {
+	// For Docker Desktop on macOS, provide instructions instead
+	if d.manualSetup() {
 		return d.enableDockerDesktop()
 	}
 
@@ -105,27 +156,27 @@ func (d *DockerMirror) Enable() error {
 
 	// Ensure .docker directory exists
 	configDir := filepath.Dir(configPath)
-	if err := os.MkdirAll(configDir, 0755); err != nil {
-		return fmt.Errorf("failed to create .docker directory: %w", err)
+	if err := userfile.FS.MkdirAll(configDir, 0755); err != nil {
+		return hint.IfDenied(fmt.Errorf("failed to create .docker directory: %w", err), dockerOwnerHint)
 	}
 
 	// Read existing config or create new one
 	var config map[string]interface{}
-	data, err := os.ReadFile(configPath)
+	data, err := userfile.FS.ReadFile(configPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			// Create new config
 			config = make(map[string]interface{})
 		} else {
-			return fmt.Errorf("failed to read daemon.json: %w", err)
+			return hint.IfDenied(fmt.Errorf("failed to read daemon.json: %w", err), dockerOwnerHint)
 		}
 	} else {
 		// Parse existing config
 		if err := json.Unmarshal(data, &config); err != nil {
 			// Backup corrupted file
 			backupPath := configPath + ".backup"
-			os.WriteFile(backupPath, data, 0644)
-			fmt.Printf("Warning: existing daemon.json is invalid, backed up to %s\n", backupPath)
+			userfile.FS.WriteFile(backupPath, data, 0644)
+			logging.Warn("existing daemon.json is invalid, moved it aside", "backup", backupPath)
 			config = make(map[string]interface{})
 		}
 	}
@@ -150,17 +201,18 @@ func (d *DockerMirror) Enable() error {
 		return fmt.Errorf("failed to marshal daemon.json: %w", err)
 	}
 
-	if err := os.WriteFile(configPath, jsonData, 0644); err != nil {
-		return fmt.Errorf("failed to write daemon.json: %w", err)
+	if err := userfile.Write(configPath, jsonData, 0644); err != nil {
+		return hint.IfDenied(fmt.Errorf("failed to write daemon.json: %w", err), dockerOwnerHint)
 	}
 
+	d.printRestartNote()
 	return nil
 }
 
 // Disable removes registry mirror configuration
 func (d *DockerMirror) Disable() error {
-	// For Docker Desktop, provide instructions
-	if d.isDockerDesktop() {
+	// For Docker Desktop on macOS, provide instructions
+	if d.manualSetup() {
 		fmt.Println("\n⚠ Docker Desktop detected!")
 		fmt.Println("To disable registry mirrors:")
 		fmt.Println("1. Open Docker Desktop → Settings → Docker Engine")
@@ -176,18 +228,18 @@ func (d *DockerMirror) Disable() error {
 	}
 
 	// Read existing config
-	data, err := os.ReadFile(configPath)
+	data, err := userfile.FS.ReadFile(configPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil // Nothing to disable
 		}
-		return fmt.Errorf("failed to read daemon.json: %w", err)
+		return hint.IfDenied(fmt.Errorf("failed to read daemon.json: %w", err), dockerOwnerHint)
 	}
 
 	// Parse config
 	var config map[string]interface{}
 	if err := json.Unmarshal(data, &config); err != nil {
-		return fmt.Errorf("failed to parse daemon.json: %w", err)
+		return hint.Errorf("fix the JSON in ~/.docker/daemon.json, or remove the file", "failed to parse daemon.json: %w", err)
 	}
 
 	// Remove registry-mirrors
@@ -195,9 +247,10 @@ func (d *DockerMirror) Disable() error {
 
 	// If config is now empty, remove the file
 	if len(config) == 0 {
-		if err := os.Remove(configPath); err != nil && !os.IsNotExist(err) {
-			return fmt.Errorf("failed to remove daemon.json: %w", err)
+		if err := userfile.Remove(configPath); err != nil && !os.IsNotExist(err) {
+			return hint.IfDenied(fmt.Errorf("failed to remove daemon.json: %w", err), dockerOwnerHint)
 		}
+		d.printRestartNote()
 		return nil
 	}
 
@@ -207,17 +260,26 @@ func (d *DockerMirror) Disable() error {
 		return fmt.Errorf("failed to marshal daemon.json: %w", err)
 	}
 
-	if err := os.WriteFile(configPath, jsonData, 0644); err != nil {
-		return fmt.Errorf("failed to write daemon.json: %w", err)
+	if err := userfile.Write(configPath, jsonData, 0644); err != nil {
+		return hint.IfDenied(fmt.Errorf("failed to write daemon.json: %w", err), dockerOwnerHint)
 	}
 
+	d.printRestartNote()
 	return nil
 }
 
+// printRestartNote reminds Docker Desktop users on Windows that the changed
+// daemon.json only applies once Docker Desktop restarts
+func (d *DockerMirror) printRestartNote() {
+	if d.isDockerDesktop() {
+		fmt.Println("  Restart Docker Desktop (right-click its tray icon → Restart) to apply the registry mirrors")
+	}
+}
+
 // Status checks if registry mirrors are currently configured
 func (d *DockerMirror) Status() (bool, string, error) {
-	// For Docker Desktop, we can't easily read the config
-	if d.isDockerDesktop() {
+	// For Docker Desktop on macOS, we can't easily read the config
+	if d.manualSetup() {
 		return false, "check Docker Desktop settings", nil
 	}
 
@@ -226,7 +288,7 @@ func (d *DockerMirror) Status() (bool, string, error) {
 		return false, "", err
 	}
 
-	data, err := os.ReadFile(configPath)
+	data, err := userfile.FS.ReadFile(configPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return false, "default registry", nil
@@ -0,0 +1,152 @@
+package mirror
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/boomyao/crosh/internal/errs"
+	"github.com/boomyao/crosh/internal/userfile"
+)
+
+// toolCommands are the executables that show a mirror tool is installed
+var toolCommands = map[string][]string{
+	"npm":    {"npm"},
+	"pip":    {"pip3", "pip"},
+	"apt":    {"apt-get"},
+	"cargo":  {"cargo"},
+	"go":     {"go"},
+	"docker": {"docker"},
+}
+
+// ToolPath returns the path of a mirror tool's executable, or an error if
+// the tool isn't installed
+func ToolPath(tool string) (string, error) {
+	for _, name := range toolCommands[tool] {
+		if path, err := lookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", errs.Errorf(errs.ErrNotInstalled, "%s is not installed", tool)
+}
+
+// ProbeMirror returns how long a mirror takes to answer a HEAD request
+func ProbeMirror(ctx context.Context, url string, timeout time.Duration) (time.Duration, error) {
+	latency, err := probeMirrors(ctx, timeout, nil, url)
+	if err != nil {
+		// Drop the "no mirror answered" wrapping meant for several URLs
+		return 0, errors.Unwrap(err)
+	}
+	return latency, nil
+}
+
+// Conflict is a setting outside crosh's files that overrides or contradicts
+// the mirror crosh configures
+type Conflict struct {
+	Tool   string
+	Detail string
+	Fix    string
+}
+
+// FindConflicts looks for environment variables, go env settings and shell
+// rc files that would override the mirrors
+func FindConflicts() []Conflict {
+	var conflicts []Conflict
+
+	envOverrides := []struct{ tool, name, file string }{
+		{"npm", "NPM_CONFIG_REGISTRY", "~/.npmrc"},
+		{"npm", "npm_config_registry", "~/.npmrc"},
+		{"pip", "PIP_INDEX_URL", "pip.conf"},
+		{"cargo", "CARGO_REGISTRIES_CRATES_IO_PROTOCOL", "~/.cargo/config.toml"},
+	}
+	for _, env := range envOverrides {
+		if value := os.Getenv(env.name); value != "" {
+			conflicts = append(conflicts, Conflict{
+				Tool:   env.tool,
+				Detail: fmt.Sprintf("%s=%s in the environment overrides the mirror in %s", env.name, value, env.file),
+				Fix:    fmt.Sprintf("remove %s from your shell profile", env.name),
+			})
+		}
+	}
+
+	// GOPROXY set to different values in the environment, rc files and go env
+	if sources := goProxySources(); len(sources) > 1 {
+		if others := goProxyConflicts(sources); len(others) > 0 {
+			conflicts = append(conflicts, Conflict{
+				Tool:   "go",
+				Detail: fmt.Sprintf("GOPROXY is %s in %s, but set differently in %s", sources[0].value, sources[0].where, describeGoProxySources(others)),
+				Fix:    "run \"crosh mirror enable\" to keep only crosh's GOPROXY, then open a new shell",
+			})
+		}
+	}
+
+	return conflicts
+}
+
+// goProxyExport is an "export GOPROXY=" line in a shell rc file
+type goProxyExport struct {
+	file  string
+	value string
+}
+
+// goProxyExports returns the GOPROXY exports in the usual shell rc files
+func goProxyExports() []goProxyExport {
+	homeDir, err := localHome()
+	if err != nil {
+		return nil
+	}
+
+	var exports []goProxyExport
+	for _, path := range shellRCPaths(homeDir) {
+		file, err := userfile.FS.Open(path)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if value, ok := goProxyValue(scanner.Text()); ok {
+				exports = append(exports, goProxyExport{file: path, value: value})
+			}
+		}
+		file.Close()
+	}
+	return exports
+}
+
+// goEnvPath returns the go env file that "go env -w" writes and Go reads on
+// every run: $GOENV, or go/env in the user config directory. It is "" if Go
+// isn't installed or GOENV is off.
+func goEnvPath() string {
+	if _, err := lookPath("go"); err != nil {
+		return ""
+	}
+	homeDir, err := localHome()
+	if err != nil {
+		return ""
+	}
+	if path := goEnvFile(homeDir); path != "off" {
+		return path
+	}
+	return ""
+}
+
+// goEnvValue returns a variable set in a go env file, or "" if it isn't set
+func goEnvValue(path, name string) string {
+	if path == "" {
+		return ""
+	}
+	data, err := userfile.FS.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(line), name+"="); ok {
+			return value
+		}
+	}
+	return ""
+}
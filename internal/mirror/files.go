@@ -0,0 +1,42 @@
+package mirror
+
+// ConfigFiles returns the files a mirror tool ("npm", "pip", "apt", "cargo",
+// "go", "docker") writes when enabled or disabled, or those PackageProxy
+// writes for "packages"
+func ConfigFiles(tool string) []string {
+	homeDir, err := userHome()
+	if err != nil {
+		return nil
+	}
+
+	npmrc := npmrcFile(homeDir)
+	pipConf := pipConfigFile(homeDir)
+	cargoConf := cargoConfigFile(homeDir)
+
+	switch tool {
+	case "npm":
+		return []string{npmrc}
+	case "pip":
+		return []string{pipConf}
+	case "apt":
+		if goos == "freebsd" {
+			return []string{pkgRepoFile}
+		}
+		return []string{"/etc/apt/sources.list"}
+	case "cargo":
+		return []string{cargoConf}
+	case "go":
+		if targetsWindows() || useGoEnv() {
+			return []string{goEnvFile(homeDir)}
+		}
+		return []string{shellRCFile(homeDir)}
+	case "docker":
+		if path, err := NewDockerMirror(nil).getDockerConfigPath(); err == nil {
+			return []string{path}
+		}
+		return nil
+	case "packages":
+		return []string{npmrc, pipConf, cargoConf, gradlePropertiesFile(homeDir)}
+	}
+	return nil
+}
@@ -3,7 +3,11 @@ package mirror
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
+
+	"github.com/boomyao/crosh/internal/sysenv"
+	"github.com/boomyao/crosh/internal/userfile"
 )
 
 // GoMirror handles Go module proxy configuration
@@ -21,45 +25,46 @@ func NewGoMirror(proxyURL string) *GoMirror {
 // Enable configures Go to use the mirror proxy
 // This is done via environment variable GOPROXY
 func (g *GoMirror) Enable() error {
+	if targetsWindows() || useGoEnv() {
+		return g.enableGoEnv()
+	}
+	if usesFish() {
+		return g.enableFish()
+	}
+
 	// For Go, we typically set environment variables
 	// This will output the command to set the environment variable
-	fmt.Printf("# Run the following command to enable Go proxy:\n")
-	fmt.Printf("export GOPROXY=%s\n", g.proxyURL)
-	fmt.Printf("# To make it permanent, add it to your ~/.bashrc or ~/.zshrc\n")
+	if !sysenv.Unattended() {
+		fmt.Printf("# Run the following command to enable Go proxy:\n")
+		fmt.Printf("%s\n", g.GetEnvCommand())
+		fmt.Printf("# To make it permanent, add it to your ~/.bashrc or ~/.zshrc\n")
+	}
 
 	// We can also try to append to shell rc files
-	homeDir, err := os.UserHomeDir()
+	homeDir, err := userHome()
 	if err != nil {
 		return fmt.Errorf("failed to get user home directory: %w", err)
 	}
 
-	// Try to detect shell
-	shell := os.Getenv("SHELL")
-	var rcFile string
-
-	if strings.Contains(shell, "zsh") {
-		rcFile = fmt.Sprintf("%s/.zshrc", homeDir)
-	} else if strings.Contains(shell, "bash") {
-		rcFile = fmt.Sprintf("%s/.bashrc", homeDir)
-	} else {
-		// Default to bashrc
-		rcFile = fmt.Sprintf("%s/.bashrc", homeDir)
+	rcFile := shellRCFile(homeDir)
+	if err := userfile.FS.MkdirAll(filepath.Dir(rcFile), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(rcFile), err)
 	}
 
 	// Read existing rc file
 	var existingContent string
-	if data, err := os.ReadFile(rcFile); err == nil {
+	if data, err := userfile.FS.ReadFile(rcFile); err == nil {
 		existingContent = string(data)
 	}
 
 	// Check if GOPROXY is already set
-	exportLine := fmt.Sprintf("export GOPROXY=%s", g.proxyURL)
-	if strings.Contains(existingContent, "export GOPROXY=") {
+	exportLine := g.GetEnvCommand()
+	if hasGoProxyLine(existingContent) {
 		// Replace existing GOPROXY
 		lines := strings.Split(existingContent, "\n")
 		newLines := []string{}
 		for _, line := range lines {
-			if strings.Contains(line, "export GOPROXY=") {
+			if _, ok := goProxyValue(line); ok {
 				newLines = append(newLines, exportLine)
 			} else {
 				newLines = append(newLines, line)
@@ -75,84 +80,237 @@ func (g *GoMirror) Enable() error {
 	}
 
 	// Write back
-	if err := os.WriteFile(rcFile, []byte(existingContent), 0644); err != nil {
+	if err := userfile.Write(rcFile, []byte(existingContent), 0644); err != nil {
 		return fmt.Errorf("failed to write %s: %w", rcFile, err)
 	}
 
 	// Set for current session
-	os.Setenv("GOPROXY", g.proxyURL)
+	setenv("GOPROXY", g.proxyURL)
 
-	return nil
+	return consolidateGoProxy(rcFile, g.proxyURL)
 }
 
 // Disable removes the Go proxy configuration
 func (g *GoMirror) Disable() error {
-	homeDir, err := os.UserHomeDir()
+	if targetsWindows() || useGoEnv() {
+		return g.disableGoEnv()
+	}
+	if usesFish() {
+		return g.disableFish()
+	}
+
+	homeDir, err := userHome()
 	if err != nil {
 		return fmt.Errorf("failed to get user home directory: %w", err)
 	}
 
-	shell := os.Getenv("SHELL")
-	var rcFile string
+	rcFile := shellRCFile(homeDir)
+	if err := dropGoProxy(rcFile, ""); err != nil {
+		return err
+	}
 
-	if strings.Contains(shell, "zsh") {
-		rcFile = fmt.Sprintf("%s/.zshrc", homeDir)
-	} else if strings.Contains(shell, "bash") {
-		rcFile = fmt.Sprintf("%s/.bashrc", homeDir)
-	} else {
-		rcFile = fmt.Sprintf("%s/.bashrc", homeDir)
+	// Unset for current session
+	setenv("GOPROXY", "")
+
+	return consolidateGoProxy(rcFile, "")
+}
+
+// Status checks if the Go proxy is currently enabled. GOPROXY may be set in
+// the environment, several rc files, go env and on Windows the user
+// environment; the value Go uses is reported, followed by any that
+// contradict it.
+func (g *GoMirror) Status() (bool, string, error) {
+	sources := goProxySources()
+	if len(sources) == 0 {
+		return false, "default proxy", nil
 	}
 
-	data, err := os.ReadFile(rcFile)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
-		return fmt.Errorf("failed to read %s: %w", rcFile, err)
+	goproxy := sources[0].value
+	if conflicts := goProxyConflicts(sources); len(conflicts) > 0 {
+		goproxy = fmt.Sprintf("%s (conflicts with %s)", goproxy, describeGoProxySources(conflicts))
 	}
+	return true, goproxy, nil
+}
 
-	// Remove GOPROXY lines
-	lines := strings.Split(string(data), "\n")
-	newLines := []string{}
-	skipNext := false
+// GetEnvCommand returns the command to set environment variable for current
+// session. The value is quoted, as a GOPROXY list may contain "|".
+func (g *GoMirror) GetEnvCommand() string {
+	if usesFish() {
+		return fmt.Sprintf("set -gx GOPROXY %q", g.proxyURL)
+	}
+	if usesNu() {
+		return fmt.Sprintf("$env.GOPROXY = %q", g.proxyURL)
+	}
+	if usesCsh() {
+		return fmt.Sprintf("setenv GOPROXY %q", g.proxyURL)
+	}
+	return fmt.Sprintf("export GOPROXY=%q", g.proxyURL)
+}
 
-	for _, line := range lines {
-		if strings.TrimSpace(line) == "# Added by crosh" {
-			skipNext = true
-			continue
-		}
-		if skipNext && strings.Contains(line, "export GOPROXY=") {
-			skipNext = false
-			continue
-		}
-		if !strings.Contains(line, "export GOPROXY=") {
-			newLines = append(newLines, line)
+// hasGoProxyLine checks if an rc file sets GOPROXY
+func hasGoProxyLine(content string) bool {
+	for _, line := range strings.Split(content, "\n") {
+		if _, ok := goProxyValue(line); ok {
+			return true
 		}
 	}
+	return false
+}
 
-	// Write back
-	content := strings.Join(newLines, "\n")
-	if err := os.WriteFile(rcFile, []byte(content), 0644); err != nil {
-		return fmt.Errorf("failed to write %s: %w", rcFile, err)
+// enableFish sets GOPROXY as a universal variable from crosh's own file in
+// fish's conf.d, leaving config.fish alone
+func (g *GoMirror) enableFish() error {
+	homeDir, err := userHome()
+	if err != nil {
+		return fmt.Errorf("failed to get user home directory: %w", err)
 	}
 
-	// Unset for current session
-	os.Unsetenv("GOPROXY")
+	if !sysenv.Unattended() {
+		fmt.Printf("# Run the following command to enable Go proxy:\n")
+		fmt.Printf("%s\n", g.GetEnvCommand())
+	}
 
-	return nil
+	confFile := fishConfFile(homeDir)
+	if err := userfile.FS.MkdirAll(filepath.Dir(confFile), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(confFile), err)
+	}
+	content := fmt.Sprintf("# Managed by crosh, removed when the Go mirror is disabled\nset -Ux GOPROXY %s\n", g.proxyURL)
+	if err := userfile.Write(confFile, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", confFile, err)
+	}
+
+	setenv("GOPROXY", g.proxyURL)
+	return consolidateGoProxy(confFile, g.proxyURL)
 }
 
-// Status checks if the Go proxy is currently enabled
-func (g *GoMirror) Status() (bool, string, error) {
-	goproxy := os.Getenv("GOPROXY")
-	if goproxy != "" {
-		return true, goproxy, nil
+// disableFish removes crosh's conf.d file and the universal variable it set,
+// which fish would otherwise keep in fish_variables
+func (g *GoMirror) disableFish() error {
+	homeDir, err := userHome()
+	if err != nil {
+		return fmt.Errorf("failed to get user home directory: %w", err)
 	}
 
-	return false, "default proxy", nil
+	confFile := fishConfFile(homeDir)
+	if err := userfile.Remove(confFile); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %w", confFile, err)
+	}
+	eraseFishVariable("GOPROXY")
+
+	setenv("GOPROXY", "")
+	return consolidateGoProxy(confFile, "")
 }
 
-// GetEnvCommand returns the command to set environment variable for current session
-func (g *GoMirror) GetEnvCommand() string {
-	return fmt.Sprintf("export GOPROXY=%s", g.proxyURL)
+// eraseFishVariable erases a universal fish variable, if fish is installed
+func eraseFishVariable(name string) {
+	if fish, err := lookPath("fish"); err == nil {
+		run(fish, "--no-config", "-c", "set -Ue "+name)
+	}
+}
+
+// useGoEnv reports whether GOPROXY goes in go env rather than an rc file: as
+// root with Go installed, e.g. in a Dockerfile, where no shell reads rc files
+func useGoEnv() bool {
+	if !systemWide() {
+		return false
+	}
+	_, err := lookPath("go")
+	return err == nil
+}
+
+// enableGoEnv sets GOPROXY in the go env file the way "go env -w" does,
+// which Go reads on every run, or on Windows as a user environment variable
+// with setx if Go isn't installed yet. From WSL the Windows go env file is
+// written.
+func (g *GoMirror) enableGoEnv() error {
+	if windowsSide.home != "" {
+		return setGoEnvFile(goEnvFile(windowsSide.home), "GOPROXY", g.proxyURL)
+	}
+
+	keep := userEnvSource
+	if path := goEnvPath(); path != "" {
+		if err := setGoEnvFile(path, "GOPROXY", g.proxyURL); err != nil {
+			return err
+		}
+		keep = path
+	} else if goos != "windows" {
+		return fmt.Errorf("GOENV is off, set GOPROXY=%s in the environment instead", g.proxyURL)
+	} else if _, err := run("setx", "GOPROXY", g.proxyURL); err != nil {
+		return fmt.Errorf("failed to run setx: %w", err)
+	}
+
+	setenv("GOPROXY", g.proxyURL)
+	return consolidateGoProxy(keep, g.proxyURL)
+}
+
+// disableGoEnv removes GOPROXY from go env and the Windows user environment
+func (g *GoMirror) disableGoEnv() error {
+	if windowsSide.home != "" {
+		return setGoEnvFile(goEnvFile(windowsSide.home), "GOPROXY", "")
+	}
+
+	if path := goEnvPath(); path != "" {
+		if err := setGoEnvFile(path, "GOPROXY", ""); err != nil {
+			return err
+		}
+	}
+	if goos == "windows" && windowsUserEnv("GOPROXY") != "" {
+		if err := removeWindowsUserEnv("GOPROXY"); err != nil {
+			return err
+		}
+	}
+
+	setenv("GOPROXY", "")
+	return consolidateGoProxy("", "")
+}
+
+// windowsUserEnv returns a user environment variable set with setx, which
+// only shows up in processes started after it was set
+func windowsUserEnv(name string) string {
+	out, err := run("reg", "query", `HKCU\Environment`, "/v", name)
+	if err != nil {
+		return ""
+	}
+	// "    GOPROXY    REG_SZ    https://goproxy.cn"
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && strings.EqualFold(fields[0], name) {
+			return strings.Join(fields[2:], " ")
+		}
+	}
+	return ""
+}
+
+// setGoEnvFile sets a variable in a go env file the way "go env -w" does, or
+// removes it ("go env -u") if value is empty
+func setGoEnvFile(path, name, value string) error {
+	data, err := userfile.FS.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		if line != "" && !strings.HasPrefix(line, name+"=") {
+			lines = append(lines, line)
+		}
+	}
+	if value != "" {
+		lines = append(lines, name+"="+value)
+	}
+	if len(lines) == 0 && os.IsNotExist(err) {
+		return nil
+	}
+
+	if err := userfile.FS.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	content := strings.Join(lines, "\n")
+	if content != "" {
+		content += "\n"
+	}
+	if err := userfile.Write(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
 }
@@ -0,0 +1,165 @@
+package mirror
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/boomyao/crosh/internal/logging"
+	"github.com/boomyao/crosh/internal/userfile"
+)
+
+// userEnvSource names the Windows user environment, where setx puts GOPROXY
+const userEnvSource = "the user environment"
+
+// goProxySource is a place GOPROXY is set
+type goProxySource struct {
+	where string // the rc or go env file, or the environment
+	value string
+}
+
+// goProxySources returns the places GOPROXY is set, the one Go uses first:
+// the environment, which the shell rc files export, then the rc files
+// themselves for shells started later, "go env -w" and on Windows the user
+// environment set with setx
+func goProxySources() []goProxySource {
+	if windowsSide.home != "" {
+		path := goEnvFile(windowsSide.home)
+		if value := goEnvValue(path, "GOPROXY"); value != "" {
+			return []goProxySource{{where: path, value: value}}
+		}
+		return nil
+	}
+
+	var sources []goProxySource
+	if value := os.Getenv("GOPROXY"); value != "" {
+		sources = append(sources, goProxySource{where: "the environment", value: value})
+	}
+	for _, export := range goProxyExports() {
+		sources = append(sources, goProxySource{where: export.file, value: export.value})
+	}
+	if path := goEnvPath(); path != "" {
+		if value := goEnvValue(path, "GOPROXY"); value != "" {
+			sources = append(sources, goProxySource{where: path, value: value})
+		}
+	}
+	if goos == "windows" {
+		if value := windowsUserEnv("GOPROXY"); value != "" {
+			sources = append(sources, goProxySource{where: userEnvSource, value: value})
+		}
+	}
+	return sources
+}
+
+// goProxyConflicts returns the sources that disagree with the first one,
+// each place once
+func goProxyConflicts(sources []goProxySource) []goProxySource {
+	var conflicts []goProxySource
+	seen := make(map[string]bool)
+	for _, source := range sources[1:] {
+		if source.value != sources[0].value && !seen[source.where] {
+			seen[source.where] = true
+			conflicts = append(conflicts, source)
+		}
+	}
+	return conflicts
+}
+
+// describeGoProxySources lists sources as "~/.bashrc (https://...)"
+func describeGoProxySources(sources []goProxySource) string {
+	described := make([]string, len(sources))
+	for i, source := range sources {
+		described[i] = fmt.Sprintf("%s (%s)", source.where, source.value)
+	}
+	return strings.Join(described, ", ")
+}
+
+// consolidateGoProxy removes the GOPROXY settings that disagree with value
+// from every rc file, the go env file and the Windows user environment,
+// except keep, the place crosh just wrote. With value "" every setting
+// outside keep is removed, so a disabled mirror doesn't linger in a shell
+// crosh doesn't write to. Each file change is confirmed like any other.
+func consolidateGoProxy(keep, value string) error {
+	if windowsSide.home != "" {
+		// The Linux side of WSL has its own Go, which the mirror doesn't cover
+		return nil
+	}
+
+	if homeDir, err := localHome(); err == nil {
+		for _, path := range shellRCPaths(homeDir) {
+			if path == keep {
+				continue
+			}
+			if err := dropGoProxy(path, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	if path := goEnvPath(); path != "" && path != keep {
+		if current := goEnvValue(path, "GOPROXY"); current != "" && current != value {
+			if err := setGoEnvFile(path, "GOPROXY", ""); err != nil {
+				return err
+			}
+			logging.Info("removed conflicting GOPROXY", "file", path, "value", current)
+		}
+	}
+
+	if goos == "windows" && keep != userEnvSource {
+		if current := windowsUserEnv("GOPROXY"); current != "" && current != value {
+			if err := removeWindowsUserEnv("GOPROXY"); err != nil {
+				return err
+			}
+			logging.Info("removed conflicting GOPROXY", "file", userEnvSource, "value", current)
+		}
+	}
+	return nil
+}
+
+// dropGoProxy removes the lines setting GOPROXY from an rc file, along with
+// the "# Added by crosh" marker before them, except those set to keep
+func dropGoProxy(path, keep string) error {
+	data, err := userfile.FS.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var kept []string
+	var dropped []string
+	for _, line := range strings.Split(string(data), "\n") {
+		value, ok := goProxyValue(line)
+		if !ok || (keep != "" && value == keep) {
+			kept = append(kept, line)
+			continue
+		}
+		dropped = append(dropped, value)
+		if n := len(kept); n > 0 && strings.TrimSpace(kept[n-1]) == "# Added by crosh" {
+			kept = kept[:n-1]
+			// Drop the blank line written before the marker
+			if n > 1 && kept[n-2] == "" {
+				kept = kept[:n-2]
+			}
+		}
+	}
+	if len(dropped) == 0 {
+		return nil
+	}
+
+	content := strings.Join(kept, "\n")
+	if err := userfile.Write(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	logging.Info("removed GOPROXY", "file", path, "value", strings.Join(dropped, ", "))
+	return nil
+}
+
+// removeWindowsUserEnv deletes a user environment variable set with setx
+func removeWindowsUserEnv(name string) error {
+	if _, err := run("reg", "delete", `HKCU\Environment`, "/v", name, "/f"); err != nil {
+		return fmt.Errorf("failed to remove the %s user variable: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,284 @@
+package mirror
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/boomyao/crosh/internal/fsys"
+	"github.com/boomyao/crosh/internal/userfile"
+)
+
+// testHome is the home directory inside the scratch tree
+const testHome = "/home/me"
+
+// fakeSystem stands in for the commands and environment the handlers use
+type fakeSystem struct {
+	root      string
+	installed map[string]bool   // commands lookPath finds
+	outputs   map[string]string // what a command line prints
+	commands  []string          // the command lines run, in order
+	env       map[string]string // what setenv set, "" for unset
+}
+
+// setup points the handlers at a scratch tree for the rest of the test: the
+// files at fsys.Dir, the home directory at /home/me in it, a bash user on
+// Linux who isn't root and none of the tools installed
+func setup(t *testing.T) *fakeSystem {
+	t.Helper()
+	sys := &fakeSystem{
+		root:      t.TempDir(),
+		installed: map[string]bool{},
+		outputs:   map[string]string{},
+		env:       map[string]string{},
+	}
+
+	oldFS, oldGOOS, oldIsRoot, oldLookPath, oldRun, oldSetenv := userfile.FS, goos, isRoot, lookPath, run, setenv
+	t.Cleanup(func() {
+		userfile.FS, goos, isRoot, lookPath, run, setenv = oldFS, oldGOOS, oldIsRoot, oldLookPath, oldRun, oldSetenv
+		SetHome("")
+		windowsSide.home, windowsSide.appData = "", ""
+		profileOnce, profilePath = sync.Once{}, ""
+	})
+
+	userfile.FS = fsys.Dir(sys.root)
+	if err := userfile.FS.MkdirAll(testHome, 0755); err != nil {
+		t.Fatal(err)
+	}
+	SetHome(testHome)
+	goos = "linux"
+	isRoot = func() bool { return false }
+	lookPath = func(name string) (string, error) {
+		if sys.installed[name] {
+			return "/usr/bin/" + name, nil
+		}
+		return "", errors.New(name + " not found")
+	}
+	run = func(name string, args ...string) (string, error) {
+		line := strings.Join(append([]string{name}, args...), " ")
+		sys.commands = append(sys.commands, line)
+		if out, ok := sys.outputs[line]; ok {
+			return out, nil
+		}
+		return "", errors.New(name + " failed")
+	}
+	setenv = func(name, value string) {
+		sys.env[name] = value
+	}
+
+	t.Setenv("HOME", testHome)
+	t.Setenv("SHELL", "/bin/bash")
+	for _, name := range []string{"XDG_CONFIG_HOME", "APPDATA", "GOENV", "GOPROXY", "CARGO_HOME", "NPM_CONFIG_USERCONFIG", "npm_config_userconfig"} {
+		t.Setenv(name, "")
+	}
+	return sys
+}
+
+// write creates a file in the scratch tree
+func (s *fakeSystem) write(t *testing.T, path, content string) {
+	t.Helper()
+	if err := userfile.FS.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := userfile.FS.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// read returns a file in the scratch tree, or "<missing>"
+func (s *fakeSystem) read(t *testing.T, path string) string {
+	t.Helper()
+	data, err := userfile.FS.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "<missing>"
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// handler is what every mirror handler implements
+type handler interface {
+	Enable() error
+	Disable() error
+	Status() (bool, string, error)
+}
+
+func TestHandlers(t *testing.T) {
+	tests := []struct {
+		name        string
+		root        bool // run as root
+		handler     handler
+		path        string
+		existing    string // "" for no file
+		wantEnabled string
+		wantStatus  string
+		wantRemoved string // after Disable
+	}{
+		{
+			name:        "npm new",
+			handler:     NewNPMMirror("https://registry.npmmirror.com"),
+			path:        "/home/me/.npmrc",
+			wantEnabled: "registry=https://registry.npmmirror.com\n",
+			wantStatus:  "https://registry.npmmirror.com",
+			wantRemoved: "<missing>",
+		},
+		{
+			name:        "npm replaces registry and keeps the rest",
+			handler:     NewNPMMirror("https://registry.npmmirror.com"),
+			path:        "/home/me/.npmrc",
+			existing:    "save-exact=true\nregistry=https://registry.npmjs.org/\n",
+			wantEnabled: "save-exact=true\nregistry=https://registry.npmmirror.com\n",
+			wantStatus:  "https://registry.npmmirror.com",
+			wantRemoved: "save-exact=true\n",
+		},
+		{
+			name:        "pip new",
+			handler:     NewPipMirror("https://mirrors.aliyun.com/pypi/simple/"),
+			path:        "/home/me/.config/pip/pip.conf",
+			wantEnabled: "[global]\nindex-url = https://mirrors.aliyun.com/pypi/simple/\n",
+			wantStatus:  "https://mirrors.aliyun.com/pypi/simple/",
+			wantRemoved: "[global]\n",
+		},
+		{
+			name:        "pip adds index-url to global before the next section",
+			handler:     NewPipMirror("https://mirrors.aliyun.com/pypi/simple/"),
+			path:        "/home/me/.config/pip/pip.conf",
+			existing:    "[global]\ntimeout = 60\n[install]\nuser = true\n",
+			wantEnabled: "[global]\ntimeout = 60\nindex-url = https://mirrors.aliyun.com/pypi/simple/\n[install]\nuser = true\n",
+			wantStatus:  "https://mirrors.aliyun.com/pypi/simple/",
+			wantRemoved: "[global]\ntimeout = 60\n[install]\nuser = true\n",
+		},
+		{
+			name:        "pip as root",
+			root:        true,
+			handler:     NewPipMirror("https://mirrors.aliyun.com/pypi/simple/"),
+			path:        "/etc/pip.conf",
+			wantEnabled: "[global]\nindex-url = https://mirrors.aliyun.com/pypi/simple/\n",
+			wantStatus:  "https://mirrors.aliyun.com/pypi/simple/",
+			wantRemoved: "[global]\n",
+		},
+		{
+			name:        "cargo new",
+			handler:     NewCargoMirror("https://mirrors.ustc.edu.cn/crates.io-index"),
+			path:        "/home/me/.cargo/config.toml",
+			wantEnabled: "\n[source.crates-io]\nreplace-with = 'ustc'\n\n[source.ustc]\nregistry = \"https://mirrors.ustc.edu.cn/crates.io-index\"\n",
+			wantStatus:  "https://mirrors.ustc.edu.cn/crates.io-index",
+		},
+		{
+			name:        "go in the bash rc file",
+			handler:     NewGoMirror("https://goproxy.cn,direct"),
+			path:        "/home/me/.bashrc",
+			existing:    "alias ll='ls -l'\n",
+			wantEnabled: "alias ll='ls -l'\n\n# Added by crosh\nexport GOPROXY=\"https://goproxy.cn,direct\"\n",
+			wantStatus:  "https://goproxy.cn,direct",
+			wantRemoved: "alias ll='ls -l'\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sys := setup(t)
+			isRoot = func() bool { return tt.root }
+			if tt.existing != "" {
+				sys.write(t, tt.path, tt.existing)
+			}
+
+			if err := tt.handler.Enable(); err != nil {
+				t.Fatalf("Enable: %v", err)
+			}
+			if got := sys.read(t, tt.path); got != tt.wantEnabled {
+				t.Errorf("after Enable %s =\n%q\nwant\n%q", tt.path, got, tt.wantEnabled)
+			}
+			// Status reads the rc files, not the environment, for go
+			t.Setenv("GOPROXY", "")
+			if enabled, status, err := tt.handler.Status(); err != nil || !enabled || status != tt.wantStatus {
+				t.Errorf("Status = %v, %q, %v, want true, %q", enabled, status, err, tt.wantStatus)
+			}
+
+			if tt.wantRemoved == "" {
+				return
+			}
+			if err := tt.handler.Disable(); err != nil {
+				t.Fatalf("Disable: %v", err)
+			}
+			if got := sys.read(t, tt.path); got != tt.wantRemoved {
+				t.Errorf("after Disable %s =\n%q\nwant\n%q", tt.path, got, tt.wantRemoved)
+			}
+		})
+	}
+}
+
+func TestHandlersStayInTheScratchTree(t *testing.T) {
+	sys := setup(t)
+	if err := NewNPMMirror("https://registry.npmmirror.com").Enable(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(sys.root, testHome, ".npmrc")); err != nil {
+		t.Errorf(".npmrc wasn't written to the scratch tree: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(testHome, ".npmrc")); err == nil {
+		t.Errorf("%s/.npmrc was written outside the scratch tree", testHome)
+	}
+}
+
+func TestGoMirrorSetsTheEnvironment(t *testing.T) {
+	sys := setup(t)
+	if err := NewGoMirror("https://goproxy.cn,direct").Enable(); err != nil {
+		t.Fatal(err)
+	}
+	if got := sys.env["GOPROXY"]; got != "https://goproxy.cn,direct" {
+		t.Errorf("GOPROXY = %q after Enable", got)
+	}
+	if err := NewGoMirror("https://goproxy.cn,direct").Disable(); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := sys.env["GOPROXY"]; !ok || got != "" {
+		t.Errorf("GOPROXY = %q after Disable, want it unset", got)
+	}
+	if len(sys.commands) > 0 {
+		t.Errorf("ran %q, want no commands", sys.commands)
+	}
+}
+
+func TestGoMirrorUsesGoEnvAsRoot(t *testing.T) {
+	sys := setup(t)
+	isRoot = func() bool { return true }
+	sys.installed["go"] = true
+	envFile := "/home/me/.config/go/env"
+	sys.write(t, envFile, "GOFLAGS=-mod=mod\n")
+
+	if err := NewGoMirror("https://goproxy.cn,direct").Enable(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := sys.read(t, envFile), "GOFLAGS=-mod=mod\nGOPROXY=https://goproxy.cn,direct\n"; got != want {
+		t.Errorf("go env file = %q, want %q", got, want)
+	}
+	if got := sys.read(t, "/home/me/.bashrc"); got != "<missing>" {
+		t.Errorf(".bashrc = %q, want it left alone", got)
+	}
+
+	if err := NewGoMirror("https://goproxy.cn,direct").Disable(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := sys.read(t, envFile), "GOFLAGS=-mod=mod\n"; got != want {
+		t.Errorf("go env file = %q after Disable, want %q", got, want)
+	}
+}
+
+func TestGoMirrorDisableWithoutGoEnvFile(t *testing.T) {
+	sys := setup(t)
+	isRoot = func() bool { return true }
+	sys.installed["go"] = true
+
+	if err := NewGoMirror("https://goproxy.cn,direct").Disable(); err != nil {
+		t.Fatalf("Disable: %v", err)
+	}
+	if got := sys.read(t, "/home/me/.config/go/env"); got != "<missing>" {
+		t.Errorf("go env file = %q, want it not created", got)
+	}
+}
@@ -3,8 +3,9 @@ package mirror
 import (
 	"fmt"
 	"os"
-	"path/filepath"
 	"strings"
+
+	"github.com/boomyao/crosh/internal/userfile"
 )
 
 // NPMMirror handles npm registry configuration
@@ -21,16 +22,16 @@ func NewNPMMirror(registryURL string) *NPMMirror {
 
 // Enable configures npm to use the mirror registry
 func (n *NPMMirror) Enable() error {
-	homeDir, err := os.UserHomeDir()
+	homeDir, err := userHome()
 	if err != nil {
 		return fmt.Errorf("failed to get user home directory: %w", err)
 	}
 
-	npmrcPath := filepath.Join(homeDir, ".npmrc")
+	npmrcPath := npmrcFile(homeDir)
 
 	// Read existing .npmrc file if it exists
 	var existingContent string
-	if data, err := os.ReadFile(npmrcPath); err == nil {
+	if data, err := userfile.FS.ReadFile(npmrcPath); err == nil {
 		existingContent = string(data)
 	}
 
@@ -57,7 +58,7 @@ func (n *NPMMirror) Enable() error {
 
 	// Write back to .npmrc
 	content := strings.Join(newLines, "\n") + "\n"
-	if err := os.WriteFile(npmrcPath, []byte(content), 0644); err != nil {
+	if err := userfile.Write(npmrcPath, []byte(content), 0644); err != nil {
 		return fmt.Errorf("failed to write .npmrc: %w", err)
 	}
 
@@ -66,15 +67,15 @@ func (n *NPMMirror) Enable() error {
 
 // Disable removes the mirror configuration
 func (n *NPMMirror) Disable() error {
-	homeDir, err := os.UserHomeDir()
+	homeDir, err := userHome()
 	if err != nil {
 		return fmt.Errorf("failed to get user home directory: %w", err)
 	}
 
-	npmrcPath := filepath.Join(homeDir, ".npmrc")
+	npmrcPath := npmrcFile(homeDir)
 
 	// Read existing .npmrc file
-	data, err := os.ReadFile(npmrcPath)
+	data, err := userfile.FS.ReadFile(npmrcPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil // Nothing to disable
@@ -96,12 +97,12 @@ func (n *NPMMirror) Disable() error {
 	// Write back
 	if len(newLines) > 0 {
 		content := strings.Join(newLines, "\n") + "\n"
-		if err := os.WriteFile(npmrcPath, []byte(content), 0644); err != nil {
+		if err := userfile.Write(npmrcPath, []byte(content), 0644); err != nil {
 			return fmt.Errorf("failed to write .npmrc: %w", err)
 		}
 	} else {
 		// Remove file if empty
-		os.Remove(npmrcPath)
+		userfile.Remove(npmrcPath)
 	}
 
 	return nil
@@ -109,14 +110,14 @@ func (n *NPMMirror) Disable() error {
 
 // Status checks if the mirror is currently enabled
 func (n *NPMMirror) Status() (bool, string, error) {
-	homeDir, err := os.UserHomeDir()
+	homeDir, err := userHome()
 	if err != nil {
 		return false, "", fmt.Errorf("failed to get user home directory: %w", err)
 	}
 
-	npmrcPath := filepath.Join(homeDir, ".npmrc")
+	npmrcPath := npmrcFile(homeDir)
 
-	data, err := os.ReadFile(npmrcPath)
+	data, err := userfile.FS.ReadFile(npmrcPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return false, "default registry", nil
@@ -0,0 +1,236 @@
+package mirror
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/boomyao/crosh/internal/userfile"
+)
+
+// windowsSide holds the Windows user's directories, as seen from WSL, while
+// OnWindowsSide points the handlers at them
+var windowsSide struct {
+	home    string
+	appData string
+}
+
+// home replaces the user's home directory while set, see SetHome
+var home string
+
+// SetHome points the handlers at dir instead of the user's home directory,
+// or back at it if dir is "". Together with userfile.FS this lets the
+// handlers run against a scratch tree.
+func SetHome(dir string) {
+	home = dir
+}
+
+// userHome returns the home directory whose files the handlers configure
+func userHome() (string, error) {
+	if windowsSide.home != "" {
+		return windowsSide.home, nil
+	}
+	return localHome()
+}
+
+// localHome returns the home directory on this side of WSL
+func localHome() (string, error) {
+	if home != "" {
+		return home, nil
+	}
+	return os.UserHomeDir()
+}
+
+// targetsWindows reports whether the handlers configure Windows files, either
+// on Windows or on the Windows side of WSL
+func targetsWindows() bool {
+	return goos == "windows" || windowsSide.home != ""
+}
+
+// systemWide reports whether the handlers configure the whole system rather
+// than the user, which they do as root except on the Windows side of WSL
+func systemWide() bool {
+	return isRoot() && windowsSide.home == ""
+}
+
+// localEnv returns an environment variable that locates a config file. On
+// the Windows side of WSL the Linux environment doesn't apply.
+func localEnv(name string) string {
+	if windowsSide.home != "" {
+		return ""
+	}
+	return os.Getenv(name)
+}
+
+// npmrcFile returns npm's user config: $NPM_CONFIG_USERCONFIG, or .npmrc in
+// the home directory. On Windows that is %USERPROFILE%\.npmrc too; only the
+// global prefix and its npmrc move to %APPDATA%\npm, and crosh leaves those
+// alone unless it runs as root.
+func npmrcFile(homeDir string) string {
+	for _, name := range []string{"NPM_CONFIG_USERCONFIG", "npm_config_userconfig"} {
+		if path := localEnv(name); path != "" {
+			return path
+		}
+	}
+	if systemWide() {
+		if path, err := run("npm", "config", "get", "globalconfig"); err == nil && path != "" {
+			return path
+		}
+	}
+	return filepath.Join(homeDir, ".npmrc")
+}
+
+// pipConfigFile returns pip's user config: %APPDATA%\pip\pip.ini on Windows
+// and ~/.config/pip/pip.conf elsewhere, or /etc/pip.conf as root
+func pipConfigFile(homeDir string) string {
+	if systemWide() {
+		return "/etc/pip.conf"
+	}
+	if targetsWindows() {
+		return filepath.Join(appDataDir(homeDir), "pip", "pip.ini")
+	}
+	return filepath.Join(homeDir, ".config", "pip", "pip.conf")
+}
+
+// cargoConfigFile returns cargo's user config in $CARGO_HOME, which defaults
+// to ~/.cargo (%USERPROFILE%\.cargo on Windows)
+func cargoConfigFile(homeDir string) string {
+	if cargoHome := localEnv("CARGO_HOME"); cargoHome != "" {
+		return filepath.Join(cargoHome, "config.toml")
+	}
+	return filepath.Join(homeDir, ".cargo", "config.toml")
+}
+
+// gradlePropertiesFile returns gradle.properties in $GRADLE_USER_HOME, which
+// defaults to ~/.gradle (%USERPROFILE%\.gradle on Windows)
+func gradlePropertiesFile(homeDir string) string {
+	if gradleHome := localEnv("GRADLE_USER_HOME"); gradleHome != "" {
+		return filepath.Join(gradleHome, "gradle.properties")
+	}
+	return filepath.Join(homeDir, ".gradle", "gradle.properties")
+}
+
+// goEnvFile returns the file "go env -w" writes, which is how GOPROXY is set
+// on Windows
+func goEnvFile(homeDir string) string {
+	if path := localEnv("GOENV"); path != "" {
+		return path
+	}
+	return filepath.Join(appDataDir(homeDir), "go", "env")
+}
+
+// appDataDir returns %APPDATA% on Windows, or the user config directory elsewhere
+func appDataDir(homeDir string) string {
+	if windowsSide.appData != "" {
+		return windowsSide.appData
+	}
+	if goos == "windows" {
+		if dir := os.Getenv("APPDATA"); dir != "" {
+			return dir
+		}
+		return filepath.Join(homeDir, "AppData", "Roaming")
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		return dir
+	}
+	return filepath.Join(homeDir, ".config")
+}
+
+// shellRCFile returns the startup file of the user's shell: ~/.zshrc,
+// ~/.bashrc, ~/.cshrc (or ~/.tcshrc), ~/.profile for a plain sh as on
+// FreeBSD, crosh's own file in fish's conf.d, Nushell's env.nu, or the
+// PowerShell $PROFILE on Windows outside Git Bash and WSL
+func shellRCFile(homeDir string) string {
+	shell := os.Getenv("SHELL")
+	switch {
+	case strings.Contains(shell, "zsh"):
+		return filepath.Join(homeDir, ".zshrc")
+	case usesFish():
+		return fishConfFile(homeDir)
+	case usesNu():
+		return nuEnvFile(homeDir)
+	case usesCsh():
+		// tcsh reads ~/.tcshrc instead of ~/.cshrc when it exists
+		tcshrc := filepath.Join(homeDir, ".tcshrc")
+		if _, err := userfile.FS.Stat(tcshrc); err == nil && filepath.Base(shell) == "tcsh" {
+			return tcshrc
+		}
+		return filepath.Join(homeDir, ".cshrc")
+	case filepath.Base(shell) == "sh":
+		return filepath.Join(homeDir, ".profile")
+	case shell == "" && goos == "windows":
+		return powerShellProfile(homeDir)
+	}
+	return filepath.Join(homeDir, ".bashrc")
+}
+
+// usesFish checks if the user's shell is fish, which can't read the bash
+// syntax crosh writes to rc files
+func usesFish() bool {
+	return strings.Contains(filepath.Base(os.Getenv("SHELL")), "fish")
+}
+
+// fishConfFile returns the fish config file crosh manages on its own. Fish
+// sources every file in conf.d at startup, so the user's config.fish is
+// never edited.
+func fishConfFile(homeDir string) string {
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		configDir = filepath.Join(homeDir, ".config")
+	}
+	return filepath.Join(configDir, "fish", "conf.d", "crosh.fish")
+}
+
+// usesCsh checks if the user's shell is csh or tcsh, the default shells on
+// FreeBSD, which set variables with setenv
+func usesCsh() bool {
+	base := filepath.Base(os.Getenv("SHELL"))
+	return base == "csh" || base == "tcsh"
+}
+
+// usesNu checks if the user's shell is Nushell
+func usesNu() bool {
+	return strings.TrimSuffix(filepath.Base(os.Getenv("SHELL")), ".exe") == "nu"
+}
+
+// nuEnvFile returns Nushell's env.nu, which is in the user config directory
+// like the go env file: ~/.config/nushell, ~/Library/Application
+// Support/nushell on macOS and %APPDATA%\nushell on Windows
+func nuEnvFile(homeDir string) string {
+	return filepath.Join(appDataDir(homeDir), "nushell", "env.nu")
+}
+
+var (
+	profileOnce sync.Once
+	profilePath string
+)
+
+// powerShellProfile returns the PowerShell $PROFILE of the current user,
+// asking PowerShell itself since Documents may be redirected (e.g. to OneDrive)
+func powerShellProfile(homeDir string) string {
+	profileOnce.Do(func() {
+		for _, name := range []string{"pwsh", "powershell"} {
+			if path, err := run(name, "-NoProfile", "-NonInteractive", "-Command", "$PROFILE"); err == nil && path != "" {
+				profilePath = path
+				return
+			}
+		}
+		profilePath = filepath.Join(homeDir, "Documents", "WindowsPowerShell", "Microsoft.PowerShell_profile.ps1")
+	})
+	return profilePath
+}
+
+// powerShellProfiles returns the profiles of Windows PowerShell and
+// PowerShell 7, either of which may hold lines crosh wrote
+func powerShellProfiles(homeDir string) []string {
+	profiles := []string{powerShellProfile(homeDir)}
+	dir := filepath.Dir(filepath.Dir(profiles[0]))
+	for _, name := range []string{"WindowsPowerShell", "PowerShell"} {
+		path := filepath.Join(dir, name, "Microsoft.PowerShell_profile.ps1")
+		if path != profiles[0] {
+			profiles = append(profiles, path)
+		}
+	}
+	return profiles
+}
@@ -5,6 +5,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/boomyao/crosh/internal/userfile"
 )
 
 // PipMirror handles pip index configuration
@@ -21,18 +23,17 @@ func NewPipMirror(indexURL string) *PipMirror {
 
 // getPipConfigPath returns the path to pip.conf or pip.ini
 func getPipConfigPath() (string, error) {
-	homeDir, err := os.UserHomeDir()
+	homeDir, err := userHome()
 	if err != nil {
 		return "", fmt.Errorf("failed to get user home directory: %w", err)
 	}
 
-	// Linux/macOS: ~/.config/pip/pip.conf
-	configDir := filepath.Join(homeDir, ".config", "pip")
-	if err := os.MkdirAll(configDir, 0755); err != nil {
+	path := pipConfigFile(homeDir)
+	if err := userfile.FS.MkdirAll(filepath.Dir(path), 0755); err != nil {
 		return "", fmt.Errorf("failed to create pip config directory: %w", err)
 	}
 
-	return filepath.Join(configDir, "pip.conf"), nil
+	return path, nil
 }
 
 // Enable configures pip to use the mirror index
@@ -44,7 +45,7 @@ func (p *PipMirror) Enable() error {
 
 	// Read existing config if it exists
 	var existingContent string
-	if data, err := os.ReadFile(pipConfigPath); err == nil {
+	if data, err := userfile.FS.ReadFile(pipConfigPath); err == nil {
 		existingContent = string(data)
 	}
 
@@ -100,7 +101,7 @@ func (p *PipMirror) Enable() error {
 
 	// Write back
 	content := strings.Join(newLines, "\n") + "\n"
-	if err := os.WriteFile(pipConfigPath, []byte(content), 0644); err != nil {
+	if err := userfile.Write(pipConfigPath, []byte(content), 0644); err != nil {
 		return fmt.Errorf("failed to write pip config: %w", err)
 	}
 
@@ -114,7 +115,7 @@ func (p *PipMirror) Disable() error {
 		return err
 	}
 
-	data, err := os.ReadFile(pipConfigPath)
+	data, err := userfile.FS.ReadFile(pipConfigPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil
@@ -136,11 +137,11 @@ func (p *PipMirror) Disable() error {
 	// Write back or remove file if empty
 	if len(newLines) > 0 {
 		content := strings.Join(newLines, "\n") + "\n"
-		if err := os.WriteFile(pipConfigPath, []byte(content), 0644); err != nil {
+		if err := userfile.Write(pipConfigPath, []byte(content), 0644); err != nil {
 			return fmt.Errorf("failed to write pip config: %w", err)
 		}
 	} else {
-		os.Remove(pipConfigPath)
+		userfile.Remove(pipConfigPath)
 	}
 
 	return nil
@@ -153,7 +154,7 @@ func (p *PipMirror) Status() (bool, string, error) {
 		return false, "", err
 	}
 
-	data, err := os.ReadFile(pipConfigPath)
+	data, err := userfile.FS.ReadFile(pipConfigPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return false, "default index", nil
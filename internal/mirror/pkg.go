@@ -0,0 +1,104 @@
+package mirror
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/boomyao/crosh/internal/hint"
+	"github.com/boomyao/crosh/internal/userfile"
+)
+
+const (
+	// pkgRepoFile overrides the FreeBSD repository of /etc/pkg/FreeBSD.conf
+	pkgRepoFile   = "/usr/local/etc/pkg/repos/FreeBSD.conf"
+	pkgBackupFile = pkgRepoFile + ".crosh.backup"
+	pkgMarker     = "# Generated by crosh"
+)
+
+// PkgMirror handles the FreeBSD pkg repository, which crosh points at the
+// same mirror host as apt
+type PkgMirror struct {
+	mirrorURL string
+}
+
+// NewPkgMirror creates a new pkg mirror handler
+func NewPkgMirror(mirrorURL string) *PkgMirror {
+	return &PkgMirror{
+		mirrorURL: mirrorURL,
+	}
+}
+
+// pkgBranch returns the package branch the system uses, "quarterly" or "latest"
+func pkgBranch() string {
+	data, err := userfile.FS.ReadFile("/etc/pkg/FreeBSD.conf")
+	if err == nil && strings.Contains(string(data), "/latest") {
+		return "latest"
+	}
+	return "quarterly"
+}
+
+// Enable overrides the FreeBSD repository with the mirror, backing up an
+// override the user already had
+func (p *PkgMirror) Enable() error {
+	existing, err := userfile.FS.ReadFile(pkgRepoFile)
+	if err == nil && !strings.Contains(string(existing), pkgMarker) {
+		if _, err := userfile.FS.Stat(pkgBackupFile); os.IsNotExist(err) {
+			if err := userfile.FS.WriteFile(pkgBackupFile, existing, 0644); err != nil {
+				return hint.IfDenied(fmt.Errorf("failed to backup %s: %w", pkgRepoFile, err), hint.Sudo)
+			}
+		}
+	}
+
+	content := fmt.Sprintf(`%s - Chinese mirror acceleration
+FreeBSD: {
+  url: "http://%s/freebsd-pkg/${ABI}/%s",
+  mirror_type: "none"
+}
+`, pkgMarker, p.mirrorURL, pkgBranch())
+
+	if err := userfile.FS.MkdirAll(filepath.Dir(pkgRepoFile), 0755); err != nil {
+		return hint.IfDenied(fmt.Errorf("failed to create %s: %w", filepath.Dir(pkgRepoFile), err), hint.Sudo)
+	}
+	if err := userfile.Write(pkgRepoFile, []byte(content), 0644); err != nil {
+		return hint.IfDenied(fmt.Errorf("failed to write %s: %w", pkgRepoFile, err), hint.Sudo)
+	}
+	return nil
+}
+
+// Disable restores the user's override, or removes crosh's so pkg goes back
+// to pkg.FreeBSD.org
+func (p *PkgMirror) Disable() error {
+	if data, err := userfile.FS.ReadFile(pkgBackupFile); err == nil {
+		if err := userfile.Write(pkgRepoFile, data, 0644); err != nil {
+			return hint.IfDenied(fmt.Errorf("failed to restore %s: %w", pkgRepoFile, err), hint.Sudo)
+		}
+		userfile.FS.Remove(pkgBackupFile)
+		return nil
+	}
+
+	data, err := userfile.FS.ReadFile(pkgRepoFile)
+	if err != nil || !strings.Contains(string(data), pkgMarker) {
+		return fmt.Errorf("no backup found to restore")
+	}
+	if err := userfile.Remove(pkgRepoFile); err != nil {
+		return hint.IfDenied(fmt.Errorf("failed to remove %s: %w", pkgRepoFile, err), hint.Sudo)
+	}
+	return nil
+}
+
+// Status checks if the FreeBSD repository points at a mirror crosh set
+func (p *PkgMirror) Status() (bool, string, error) {
+	data, err := userfile.FS.ReadFile(pkgRepoFile)
+	if err != nil || !strings.Contains(string(data), pkgMarker) {
+		return false, "default sources", nil
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(line), "url:"); ok {
+			return true, strings.Trim(strings.TrimSpace(value), `",`), nil
+		}
+	}
+	return false, "default sources", nil
+}
@@ -0,0 +1,181 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/boomyao/crosh/internal/benchcache"
+	"github.com/boomyao/crosh/internal/httpclient"
+	"github.com/boomyao/crosh/internal/logging"
+	"github.com/boomyao/crosh/internal/retry"
+)
+
+// Preset is a set of mirrors from one provider
+type Preset struct {
+	Name        string
+	Description string
+	NPM         string
+	Pip         string
+	Apt         string
+	Cargo       string
+	Go          string
+	Docker      []string
+}
+
+// defaultDockerMirrors are public Docker Hub mirrors shared by all presets,
+// since the big providers only serve theirs to their own cloud customers
+var defaultDockerMirrors = []string{"docker.1ms.run", "docker.m.daocloud.io"}
+
+// Presets are the built-in mirror sets, the first one being the default
+var Presets = []Preset{
+	{
+		Name:        "mixed",
+		Description: "Fastest mirror of each tool from different providers (default)",
+		NPM:         "https://registry.npmmirror.com",
+		Pip:         "https://mirrors.aliyun.com/pypi/simple/",
+		Apt:         "mirrors.aliyun.com",
+		Cargo:       "https://mirrors.ustc.edu.cn/crates.io-index",
+		Go:          "https://goproxy.cn,direct",
+		Docker:      defaultDockerMirrors,
+	},
+	{
+		Name:        "aliyun",
+		Description: "Alibaba Cloud",
+		NPM:         "https://registry.npmmirror.com",
+		Pip:         "https://mirrors.aliyun.com/pypi/simple/",
+		Apt:         "mirrors.aliyun.com",
+		Cargo:       "sparse+https://mirrors.aliyun.com/crates.io-index/",
+		Go:          "https://mirrors.aliyun.com/goproxy/,direct",
+		Docker:      defaultDockerMirrors,
+	},
+	{
+		Name:        "tencent",
+		Description: "Tencent Cloud",
+		NPM:         "https://mirrors.cloud.tencent.com/npm/",
+		Pip:         "https://mirrors.cloud.tencent.com/pypi/simple/",
+		Apt:         "mirrors.cloud.tencent.com",
+		Cargo:       "sparse+https://mirrors.cloud.tencent.com/cargo/",
+		Go:          "https://mirrors.cloud.tencent.com/go/,direct",
+		Docker:      defaultDockerMirrors,
+	},
+	{
+		Name:        "tsinghua",
+		Description: "Tsinghua University TUNA (npm and Go from npmmirror/goproxy.cn)",
+		NPM:         "https://registry.npmmirror.com",
+		Pip:         "https://pypi.tuna.tsinghua.edu.cn/simple/",
+		Apt:         "mirrors.tuna.tsinghua.edu.cn",
+		Cargo:       "sparse+https://mirrors.tuna.tsinghua.edu.cn/crates.io-index/",
+		Go:          "https://goproxy.cn,direct",
+		Docker:      defaultDockerMirrors,
+	},
+	{
+		Name:        "ustc",
+		Description: "University of Science and Technology of China (npm and Go from npmmirror/goproxy.cn)",
+		NPM:         "https://registry.npmmirror.com",
+		Pip:         "https://mirrors.ustc.edu.cn/pypi/simple/",
+		Apt:         "mirrors.ustc.edu.cn",
+		Cargo:       "sparse+https://mirrors.ustc.edu.cn/crates.io-index/",
+		Go:          "https://goproxy.cn,direct",
+		Docker:      defaultDockerMirrors,
+	},
+}
+
+// FindPreset returns the preset with the given name
+func FindPreset(name string) (*Preset, error) {
+	for i := range Presets {
+		if Presets[i].Name == name {
+			return &Presets[i], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown mirror preset %q", name)
+}
+
+// PresetLatency is the result of probing a preset's mirrors
+type PresetLatency struct {
+	Preset  *Preset
+	Latency time.Duration // average over the mirrors that answered
+	Err     error         // set if none of them answered
+}
+
+// BenchPresets probes the npm, pip and apt mirrors of every preset in
+// parallel and returns the presets sorted from fastest to slowest. Mirrors
+// probed recently are answered from cache, if it isn't nil. Cancelling ctx
+// fails the probes still running.
+func BenchPresets(ctx context.Context, timeout time.Duration, cache *benchcache.Cache) []PresetLatency {
+	results := make([]PresetLatency, len(Presets))
+	var wg sync.WaitGroup
+	for i := range Presets {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			preset := &Presets[i]
+			latency, err := probeMirrors(ctx, timeout, cache, preset.NPM, preset.Pip, "https://"+preset.Apt+"/")
+			results[i] = PresetLatency{Preset: preset, Latency: latency, Err: err}
+		}(i)
+	}
+	wg.Wait()
+	if err := cache.Save(); err != nil {
+		logging.Warn("failed to save measurements", "error", err)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if (results[i].Err == nil) != (results[j].Err == nil) {
+			return results[i].Err == nil
+		}
+		return results[i].Latency < results[j].Latency
+	})
+	return results
+}
+
+// probeMirrors returns the average time the URLs take to answer a HEAD
+// request. Any HTTP response counts, since some mirrors reject HEAD. A URL
+// that fails is tried once more, and only the answering try is timed.
+// Latencies measured recently come from cache instead, if it isn't nil.
+func probeMirrors(ctx context.Context, timeout time.Duration, cache *benchcache.Cache, urls ...string) (time.Duration, error) {
+	client := httpclient.New(timeout)
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	var total time.Duration
+	answered := 0
+	var lastErr error
+	for _, url := range urls {
+		var latency time.Duration
+		if cache.Get("mirror/"+url, &latency) {
+			total += latency
+			answered++
+			continue
+		}
+		err := retry.Quick.Do(ctx, "mirror probe", func() error {
+			req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+			if err != nil {
+				return retry.Permanent(err)
+			}
+			start := time.Now()
+			resp, err := client.Do(req)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			latency = time.Since(start)
+			return nil
+		})
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		cache.Put("mirror/"+url, latency)
+		total += latency
+		answered++
+	}
+
+	if answered == 0 {
+		return 0, fmt.Errorf("no mirror answered: %w", lastErr)
+	}
+	return total / time.Duration(answered), nil
+}
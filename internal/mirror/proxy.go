@@ -0,0 +1,404 @@
+package mirror
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/boomyao/crosh/internal/userfile"
+)
+
+// gradleBlockStart and gradleBlockEnd mark the crosh-managed block in gradle.properties
+const (
+	gradleBlockStart = "# Added by crosh (proxy)"
+	gradleBlockEnd   = "# End crosh (proxy)"
+)
+
+// PackageProxy writes the local proxy into package manager configs
+// (npm, pip, cargo and gradle) as an alternative to mirrors
+type PackageProxy struct {
+	proxyURL string
+	windows  bool
+	kept     []ExistingProxy
+}
+
+// NewPackageProxy creates a new package manager proxy handler
+func NewPackageProxy(proxyURL string) *PackageProxy {
+	return &PackageProxy{
+		proxyURL: proxyURL,
+	}
+}
+
+// SetWindowsSide also configures the package managers of the Windows user
+// when crosh runs in WSL. WSL forwards localhost, so Windows reaches the proxy.
+func (p *PackageProxy) SetWindowsSide(enabled bool) {
+	p.windows = enabled
+}
+
+// hostPort returns the host:port of the proxy URL, used to recognise our settings
+func (p *PackageProxy) hostPort() string {
+	u, err := url.Parse(p.proxyURL)
+	if err != nil {
+		return p.proxyURL
+	}
+	return u.Host
+}
+
+// Enable writes the proxy into every supported package manager config
+func (p *PackageProxy) Enable() error {
+	return p.applyBothSides(true)
+}
+
+// Disable removes the proxy settings written by Enable
+func (p *PackageProxy) Disable() error {
+	return p.applyBothSides(false)
+}
+
+// applyBothSides applies the proxy in WSL and, if enabled, on the Windows side
+func (p *PackageProxy) applyBothSides(enable bool) error {
+	err := p.apply(enable)
+	if !p.windows || !InWSL() {
+		return err
+	}
+
+	if winErr := OnWindowsSide(func() error { return p.apply(enable) }); winErr != nil {
+		if err != nil {
+			return fmt.Errorf("%v; Windows: %w", err, winErr)
+		}
+		return fmt.Errorf("Windows: %w", winErr)
+	}
+	return err
+}
+
+// Kept returns the proxies of other tooling that the last Enable left in
+// place instead of replacing them with crosh's
+func (p *PackageProxy) Kept() []ExistingProxy {
+	return p.kept
+}
+
+// apply enables or disables the proxy for each package manager. A package
+// manager that already uses another proxy, e.g. the company's, keeps it.
+func (p *PackageProxy) apply(enable bool) error {
+	steps := []struct {
+		name string
+		fn   func(bool) error
+	}{
+		{"npm", p.applyNPM},
+		{"pip", p.applyPip},
+		{"cargo", p.applyCargo},
+		{"gradle", p.applyGradle},
+	}
+
+	skip := make(map[string]bool)
+	if enable {
+		for _, existing := range ExistingProxies(p.hostPort()) {
+			if existing.Tool != "env" {
+				skip[existing.Tool] = true
+				p.kept = append(p.kept, existing)
+			}
+		}
+	}
+
+	var failed []string
+	for _, step := range steps {
+		if skip[step.name] {
+			continue
+		}
+		if err := step.fn(enable); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", step.name, err))
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%s", strings.Join(failed, "; "))
+	}
+
+	return nil
+}
+
+// Status reports which package managers currently use the local proxy
+func (p *PackageProxy) Status() (bool, string, error) {
+	homeDir, err := userHome()
+	if err != nil {
+		return false, "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+
+	pipPath, err := getPipConfigPath()
+	if err != nil {
+		return false, "", err
+	}
+	cargoPath, err := getCargoConfigPath()
+	if err != nil {
+		return false, "", err
+	}
+
+	files := []struct {
+		name string
+		path string
+	}{
+		{"npm", npmrcFile(homeDir)},
+		{"pip", pipPath},
+		{"cargo", cargoPath},
+		{"gradle", gradlePropertiesFile(homeDir)},
+	}
+
+	var configured []string
+	for _, file := range files {
+		data, err := userfile.FS.ReadFile(file.path)
+		if err == nil && (strings.Contains(string(data), p.hostPort()) || strings.Contains(string(data), gradleBlockStart)) {
+			configured = append(configured, file.name)
+		}
+	}
+
+	if len(configured) == 0 {
+		return false, "not configured", nil
+	}
+
+	return true, strings.Join(configured, ", "), nil
+}
+
+// applyNPM sets proxy and https-proxy in ~/.npmrc
+func (p *PackageProxy) applyNPM(enable bool) error {
+	homeDir, err := userHome()
+	if err != nil {
+		return fmt.Errorf("failed to get user home directory: %w", err)
+	}
+
+	npmrcPath := npmrcFile(homeDir)
+	data, err := userfile.FS.ReadFile(npmrcPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read .npmrc: %w", err)
+	}
+
+	content := string(data)
+	for _, key := range []string{"proxy", "https-proxy"} {
+		if enable {
+			content = setKeyInSection(content, "", key, p.proxyURL, "=")
+		} else {
+			content = removeKeyInSection(content, "", key, p.hostPort())
+		}
+	}
+
+	return writeOrRemove(npmrcPath, content)
+}
+
+// applyPip sets proxy in the [global] section of pip.conf
+func (p *PackageProxy) applyPip(enable bool) error {
+	pipConfigPath, err := getPipConfigPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := userfile.FS.ReadFile(pipConfigPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read pip config: %w", err)
+	}
+
+	content := string(data)
+	if enable {
+		content = setKeyInSection(content, "global", "proxy", p.proxyURL, " = ")
+	} else {
+		content = removeKeyInSection(content, "global", "proxy", p.hostPort())
+	}
+
+	return writeOrRemove(pipConfigPath, content)
+}
+
+// applyCargo sets proxy in the [http] section of ~/.cargo/config.toml
+func (p *PackageProxy) applyCargo(enable bool) error {
+	cargoConfigPath, err := getCargoConfigPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := userfile.FS.ReadFile(cargoConfigPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read cargo config: %w", err)
+	}
+
+	content := string(data)
+	if enable {
+		content = setKeyInSection(content, "http", "proxy", fmt.Sprintf("\"%s\"", p.proxyURL), " = ")
+	} else {
+		content = removeKeyInSection(content, "http", "proxy", p.hostPort())
+	}
+
+	return writeOrRemove(cargoConfigPath, content)
+}
+
+// applyGradle manages a marked block of JVM proxy properties in ~/.gradle/gradle.properties
+func (p *PackageProxy) applyGradle(enable bool) error {
+	homeDir, err := userHome()
+	if err != nil {
+		return fmt.Errorf("failed to get user home directory: %w", err)
+	}
+
+	gradlePath := gradlePropertiesFile(homeDir)
+	data, err := userfile.FS.ReadFile(gradlePath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read gradle.properties: %w", err)
+	}
+
+	// Remove any existing crosh block
+	lines := strings.Split(string(data), "\n")
+	newLines := []string{}
+	inBlock := false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == gradleBlockStart {
+			inBlock = true
+			continue
+		}
+		if trimmed == gradleBlockEnd {
+			inBlock = false
+			continue
+		}
+		if !inBlock && trimmed != "" {
+			newLines = append(newLines, line)
+		}
+	}
+
+	if enable {
+		u, err := url.Parse(p.proxyURL)
+		if err != nil {
+			return fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		newLines = append(newLines,
+			gradleBlockStart,
+			"systemProp.http.proxyHost="+u.Hostname(),
+			"systemProp.http.proxyPort="+u.Port(),
+			"systemProp.https.proxyHost="+u.Hostname(),
+			"systemProp.https.proxyPort="+u.Port(),
+			"systemProp.http.nonProxyHosts=localhost|127.0.0.1",
+			gradleBlockEnd,
+		)
+		if err := userfile.FS.MkdirAll(filepath.Dir(gradlePath), 0755); err != nil {
+			return fmt.Errorf("failed to create gradle directory: %w", err)
+		}
+	}
+
+	content := ""
+	if len(newLines) > 0 {
+		content = strings.Join(newLines, "\n") + "\n"
+	}
+
+	return writeOrRemove(gradlePath, content)
+}
+
+// setKeyInSection sets key to value inside an INI/TOML style section, creating
+// the section if needed. An empty section refers to the top of the file.
+func setKeyInSection(content, section, key, value, sep string) string {
+	line := key + sep + value
+	lines := strings.Split(content, "\n")
+	newLines := []string{}
+	inSection := section == ""
+	hasSection := section == ""
+	done := false
+
+	for _, l := range lines {
+		trimmed := strings.TrimSpace(l)
+
+		if strings.HasPrefix(trimmed, "[") {
+			if inSection && !done {
+				newLines = append(newLines, line)
+				done = true
+			}
+			inSection = trimmed == "["+section+"]"
+			if inSection {
+				hasSection = true
+			}
+			newLines = append(newLines, l)
+			continue
+		}
+
+		if inSection && !done && keyOf(trimmed) == key {
+			newLines = append(newLines, line)
+			done = true
+			continue
+		}
+
+		if trimmed != "" {
+			newLines = append(newLines, l)
+		}
+	}
+
+	if !done {
+		if !hasSection {
+			newLines = append(newLines, "["+section+"]")
+		} else if section == "" && len(newLines) > 0 && strings.HasPrefix(strings.TrimSpace(newLines[0]), "[") {
+			// Top-level keys must come before the first section
+			newLines = append([]string{line}, newLines...)
+			return strings.Join(newLines, "\n") + "\n"
+		}
+		newLines = append(newLines, line)
+	}
+
+	return strings.Join(newLines, "\n") + "\n"
+}
+
+// removeKeyInSection removes key from a section if its value contains match
+func removeKeyInSection(content, section, key, match string) string {
+	lines := strings.Split(content, "\n")
+	newLines := []string{}
+	inSection := section == ""
+	sectionStart := -1
+
+	for _, l := range lines {
+		trimmed := strings.TrimSpace(l)
+
+		if strings.HasPrefix(trimmed, "[") {
+			inSection = trimmed == "["+section+"]"
+			if inSection {
+				sectionStart = len(newLines)
+			}
+			newLines = append(newLines, l)
+			continue
+		}
+
+		if inSection && keyOf(trimmed) == key && strings.Contains(trimmed, match) {
+			continue
+		}
+
+		if trimmed != "" {
+			newLines = append(newLines, l)
+		}
+	}
+
+	// Drop the section header if it is now empty
+	if sectionStart >= 0 && (sectionStart == len(newLines)-1 || strings.HasPrefix(strings.TrimSpace(newLines[sectionStart+1]), "[")) {
+		newLines = append(newLines[:sectionStart], newLines[sectionStart+1:]...)
+	}
+
+	if len(newLines) == 0 {
+		return ""
+	}
+
+	return strings.Join(newLines, "\n") + "\n"
+}
+
+// keyOf returns the key of a "key = value" or "key=value" line
+func keyOf(line string) string {
+	parts := strings.SplitN(line, "=", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	return strings.TrimSpace(parts[0])
+}
+
+// writeOrRemove writes content to path, removing the file if content is empty
+func writeOrRemove(path, content string) error {
+	if strings.TrimSpace(content) == "" {
+		if err := userfile.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+		return nil
+	}
+
+	if err := userfile.Write(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package mirror
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/boomyao/crosh/internal/sysenv"
+)
+
+// The handlers reach the system besides the user's files only through these.
+// Together with userfile.FS and SetHome, tests replace them to run the
+// handlers, the Windows ones included, without touching the machine.
+var (
+	// goos is the system whose tools the handlers configure
+	goos = runtime.GOOS
+
+	// isRoot reports whether crosh runs as root, see systemWide
+	isRoot = sysenv.SystemWide
+
+	// lookPath finds an installed command
+	lookPath = exec.LookPath
+
+	// run runs a command and returns what it printed, trimmed, or an error
+	// with its error message
+	run = runCommand
+
+	// setenv sets an environment variable for crosh and the commands it
+	// runs, or unsets it if value is ""
+	setenv = setProcessEnv
+)
+
+// runCommand runs name with args
+func runCommand(name string, args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		// setx prints its errors to stdout
+		if msg := strings.TrimSpace(stderr.String() + string(out)); msg != "" {
+			return "", errors.New(msg)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// setProcessEnv sets or unsets name in crosh's own environment
+func setProcessEnv(name, value string) {
+	if value == "" {
+		os.Unsetenv(name)
+		return
+	}
+	os.Setenv(name, value)
+}
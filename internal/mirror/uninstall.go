@@ -0,0 +1,129 @@
+package mirror
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/boomyao/crosh/internal/userfile"
+)
+
+// shellRCFiles are the shell startup files crosh may have written to
+var shellRCFiles = []string{".bashrc", ".zshrc", ".profile", ".bash_profile", ".zprofile", ".cshrc", ".tcshrc"}
+
+// shellRCPaths returns the paths of shellRCFiles, and on Windows those of the
+// PowerShell profiles
+func shellRCPaths(homeDir string) []string {
+	var paths []string
+	for _, name := range shellRCFiles {
+		paths = append(paths, filepath.Join(homeDir, name))
+	}
+	paths = append(paths, fishConfFile(homeDir), nuEnvFile(homeDir))
+	if goos == "windows" {
+		paths = append(paths, powerShellProfiles(homeDir)...)
+	}
+	return paths
+}
+
+// goProxyValue returns the value of a line setting GOPROXY: "export
+// GOPROXY=...", fish's "set -Ux GOPROXY ...", csh's "setenv GOPROXY ...",
+// Nushell's "$env.GOPROXY = ..." or PowerShell's "$env:GOPROXY = ..."
+func goProxyValue(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if value, ok := strings.CutPrefix(line, "$env.GOPROXY"); ok {
+		if value, ok = strings.CutPrefix(strings.TrimSpace(value), "="); ok {
+			return strings.Trim(strings.TrimSpace(value), `"'`), true
+		}
+	}
+	if fields := strings.Fields(line); len(fields) >= 4 && fields[0] == "set" && strings.HasPrefix(fields[1], "-") && fields[2] == "GOPROXY" {
+		return strings.Trim(strings.Join(fields[3:], " "), `"'`), true
+	}
+	if fields := strings.Fields(line); len(fields) >= 3 && fields[0] == "setenv" && fields[1] == "GOPROXY" {
+		return strings.Trim(strings.Join(fields[2:], " "), `"'`), true
+	}
+	value, ok := strings.CutPrefix(line, "export GOPROXY=")
+	if !ok && len(line) > len("$env:GOPROXY") && strings.EqualFold(line[:len("$env:GOPROXY")], "$env:GOPROXY") {
+		value, ok = strings.CutPrefix(strings.TrimSpace(line[len("$env:GOPROXY"):]), "=")
+	}
+	return strings.Trim(strings.TrimSpace(value), `"'`), ok
+}
+
+// RemoveShellBlocks removes the "# Added by crosh" blocks from every shell rc
+// file, not just the current shell's, and crosh's fish config file, and
+// returns the files it changed
+func RemoveShellBlocks() ([]string, error) {
+	homeDir, err := localHome()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user home directory: %w", err)
+	}
+
+	var changed []string
+	confFile := fishConfFile(homeDir)
+	if _, err := userfile.FS.Stat(confFile); err == nil {
+		if err := userfile.Remove(confFile); err != nil {
+			return changed, fmt.Errorf("failed to remove %s: %w", confFile, err)
+		}
+		eraseFishVariable("GOPROXY")
+		changed = append(changed, confFile)
+	}
+
+	for _, path := range shellRCPaths(homeDir) {
+		data, err := userfile.FS.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		var kept []string
+		lines := strings.Split(string(data), "\n")
+		for i := 0; i < len(lines); i++ {
+			if strings.TrimSpace(lines[i]) == "# Added by crosh" {
+				// The marker is followed by the line it annotates
+				if i+1 < len(lines) {
+					if _, ok := goProxyValue(lines[i+1]); ok {
+						i++
+					}
+				}
+				// Drop the blank line written before the marker
+				if len(kept) > 0 && kept[len(kept)-1] == "" {
+					kept = kept[:len(kept)-1]
+				}
+				continue
+			}
+			kept = append(kept, lines[i])
+		}
+
+		content := strings.Join(kept, "\n")
+		if content == string(data) {
+			continue
+		}
+		if !strings.HasSuffix(content, "\n") && content != "" {
+			content += "\n"
+		}
+		if err := userfile.Write(path, []byte(content), 0644); err != nil {
+			return changed, fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		changed = append(changed, path)
+	}
+	return changed, nil
+}
+
+// RestoreBackups puts back the files crosh moved aside before overwriting
+// them, and returns the restored paths. The apt sources.list backup is
+// restored by AptMirror.Disable instead.
+func RestoreBackups() ([]string, error) {
+	var restored []string
+
+	// An invalid daemon.json that was replaced by the mirror config
+	configPath, err := NewDockerMirror(nil).getDockerConfigPath()
+	if err == nil {
+		backupPath := configPath + ".backup"
+		if _, err := userfile.FS.Stat(backupPath); err == nil {
+			if err := userfile.FS.Rename(backupPath, configPath); err != nil {
+				return restored, fmt.Errorf("failed to restore %s: %w", configPath, err)
+			}
+			restored = append(restored, configPath)
+		}
+	}
+
+	return restored, nil
+}
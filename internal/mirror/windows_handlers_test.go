@@ -0,0 +1,302 @@
+package mirror
+
+import (
+	"strings"
+	"testing"
+)
+
+// testAppData is %APPDATA% inside the scratch tree
+const testAppData = "/home/me/AppData/Roaming"
+
+// setupWindows is setup for a Windows user in PowerShell, with %APPDATA% set
+func setupWindows(t *testing.T) *fakeSystem {
+	t.Helper()
+	sys := setup(t)
+	goos = "windows"
+	t.Setenv("SHELL", "")
+	t.Setenv("APPDATA", testAppData)
+	return sys
+}
+
+func TestWindowsConfigFiles(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		got  func() string
+		want string
+	}{
+		{
+			name: "pip in APPDATA",
+			got:  func() string { return pipConfigFile(testHome) },
+			want: testAppData + "/pip/pip.ini",
+		},
+		{
+			name: "pip without APPDATA",
+			env:  map[string]string{"APPDATA": ""},
+			got:  func() string { return pipConfigFile(testHome) },
+			want: "/home/me/AppData/Roaming/pip/pip.ini",
+		},
+		{
+			name: "npm in the profile directory",
+			got:  func() string { return npmrcFile(testHome) },
+			want: "/home/me/.npmrc",
+		},
+		{
+			name: "npm from NPM_CONFIG_USERCONFIG",
+			env:  map[string]string{"NPM_CONFIG_USERCONFIG": "/d/npm/npmrc"},
+			got:  func() string { return npmrcFile(testHome) },
+			want: "/d/npm/npmrc",
+		},
+		{
+			name: "cargo in the profile directory",
+			got:  func() string { return cargoConfigFile(testHome) },
+			want: "/home/me/.cargo/config.toml",
+		},
+		{
+			name: "go env in APPDATA",
+			got:  func() string { return goEnvFile(testHome) },
+			want: testAppData + "/go/env",
+		},
+		{
+			name: "go env from GOENV",
+			env:  map[string]string{"GOENV": "/d/go/env"},
+			got:  func() string { return goEnvFile(testHome) },
+			want: "/d/go/env",
+		},
+		{
+			name: "PowerShell profile without PowerShell",
+			got:  func() string { return shellRCFile(testHome) },
+			want: "/home/me/Documents/WindowsPowerShell/Microsoft.PowerShell_profile.ps1",
+		},
+		{
+			name: "Git Bash",
+			env:  map[string]string{"SHELL": "/usr/bin/bash"},
+			got:  func() string { return shellRCFile(testHome) },
+			want: "/home/me/.bashrc",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupWindows(t)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			if got := tt.got(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWindowsPowerShellProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		outputs map[string]string
+		want    string
+	}{
+		{
+			name: "PowerShell 7",
+			outputs: map[string]string{
+				"pwsh -NoProfile -NonInteractive -Command $PROFILE": "/home/me/OneDrive/Documents/PowerShell/Microsoft.PowerShell_profile.ps1",
+			},
+			want: "/home/me/OneDrive/Documents/PowerShell/Microsoft.PowerShell_profile.ps1",
+		},
+		{
+			name: "Windows PowerShell",
+			outputs: map[string]string{
+				"powershell -NoProfile -NonInteractive -Command $PROFILE": "/home/me/Documents/WindowsPowerShell/Microsoft.PowerShell_profile.ps1",
+			},
+			want: "/home/me/Documents/WindowsPowerShell/Microsoft.PowerShell_profile.ps1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sys := setupWindows(t)
+			sys.outputs = tt.outputs
+			if got := shellRCFile(testHome); got != tt.want {
+				t.Errorf("shellRCFile = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWindowsHandlers(t *testing.T) {
+	tests := []struct {
+		name        string
+		handler     handler
+		path        string
+		wantEnabled string
+	}{
+		{
+			name:        "pip",
+			handler:     NewPipMirror("https://mirrors.aliyun.com/pypi/simple/"),
+			path:        testAppData + "/pip/pip.ini",
+			wantEnabled: "[global]\nindex-url = https://mirrors.aliyun.com/pypi/simple/\n",
+		},
+		{
+			name:        "npm",
+			handler:     NewNPMMirror("https://registry.npmmirror.com"),
+			path:        "/home/me/.npmrc",
+			wantEnabled: "registry=https://registry.npmmirror.com\n",
+		},
+		{
+			name:        "cargo",
+			handler:     NewCargoMirror("https://mirrors.ustc.edu.cn/crates.io-index"),
+			path:        "/home/me/.cargo/config.toml",
+			wantEnabled: "\n[source.crates-io]\nreplace-with = 'ustc'\n\n[source.ustc]\nregistry = \"https://mirrors.ustc.edu.cn/crates.io-index\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sys := setupWindows(t)
+			if err := tt.handler.Enable(); err != nil {
+				t.Fatalf("Enable: %v", err)
+			}
+			if got := sys.read(t, tt.path); got != tt.wantEnabled {
+				t.Errorf("%s =\n%q\nwant\n%q", tt.path, got, tt.wantEnabled)
+			}
+		})
+	}
+}
+
+func TestWindowsGoMirror(t *testing.T) {
+	const (
+		proxyURL = "https://goproxy.cn,direct"
+		envFile  = testAppData + "/go/env"
+		setx     = "setx GOPROXY " + proxyURL
+	)
+
+	tests := []struct {
+		name         string
+		goInstalled  bool
+		userEnv      string // GOPROXY set with setx before
+		wantEnvFile  string
+		wantCommands []string // run by Enable, besides those withoutQueries drops
+	}{
+		{
+			name:         "Go not installed yet",
+			wantEnvFile:  "<missing>",
+			wantCommands: []string{setx},
+		},
+		{
+			name:        "Go installed",
+			goInstalled: true,
+			wantEnvFile: "GOPROXY=" + proxyURL + "\n",
+		},
+		{
+			name:         "Go installed with a conflicting user variable",
+			goInstalled:  true,
+			userEnv:      "https://proxy.golang.org",
+			wantEnvFile:  "GOPROXY=" + proxyURL + "\n",
+			wantCommands: []string{`reg delete HKCU\Environment /v GOPROXY /f`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sys := setupWindows(t)
+			sys.installed["go"] = tt.goInstalled
+			sys.outputs[setx] = "SUCCESS: Specified value was saved."
+			if tt.userEnv != "" {
+				sys.setUserEnv("GOPROXY", tt.userEnv)
+			}
+
+			if err := NewGoMirror(proxyURL).Enable(); err != nil {
+				t.Fatalf("Enable: %v", err)
+			}
+			if got := sys.read(t, envFile); got != tt.wantEnvFile {
+				t.Errorf("go env file = %q, want %q", got, tt.wantEnvFile)
+			}
+			if got := withoutQueries(sys.commands); strings.Join(got, "\n") != strings.Join(tt.wantCommands, "\n") {
+				t.Errorf("ran %q, want %q", got, tt.wantCommands)
+			}
+			if got := sys.env["GOPROXY"]; got != proxyURL {
+				t.Errorf("GOPROXY = %q in crosh's environment, want %q", got, proxyURL)
+			}
+		})
+	}
+}
+
+func TestWindowsGoMirrorDisable(t *testing.T) {
+	sys := setupWindows(t)
+	sys.setUserEnv("GOPROXY", "https://goproxy.cn")
+
+	if err := NewGoMirror("https://goproxy.cn").Disable(); err != nil {
+		t.Fatalf("Disable: %v", err)
+	}
+	want := []string{`reg delete HKCU\Environment /v GOPROXY /f`}
+	if got := withoutQueries(sys.commands); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("ran %q, want %q", got, want)
+	}
+	if got, ok := sys.env["GOPROXY"]; !ok || got != "" {
+		t.Errorf("GOPROXY = %q in crosh's environment, want it unset", got)
+	}
+}
+
+func TestWSLWindowsSide(t *testing.T) {
+	sys := setup(t)
+	sys.outputs["cmd.exe /c echo %USERPROFILE%"] = `C:\Users\me`
+	sys.outputs["cmd.exe /c echo %APPDATA%"] = `C:\Users\me\AppData\Roaming`
+	sys.outputs[`wslpath -u C:\Users\me`] = "/mnt/c/Users/me"
+	sys.outputs[`wslpath -u C:\Users\me\AppData\Roaming`] = "/mnt/c/Users/me/AppData/Roaming"
+
+	err := OnWindowsSide(func() error {
+		if err := NewPipMirror("https://mirrors.aliyun.com/pypi/simple/").Enable(); err != nil {
+			return err
+		}
+		if err := NewNPMMirror("https://registry.npmmirror.com").Enable(); err != nil {
+			return err
+		}
+		return NewGoMirror("https://goproxy.cn,direct").Enable()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]string{
+		"/mnt/c/Users/me/AppData/Roaming/pip/pip.ini": "[global]\nindex-url = https://mirrors.aliyun.com/pypi/simple/\n",
+		"/mnt/c/Users/me/.npmrc":                      "registry=https://registry.npmmirror.com\n",
+		"/mnt/c/Users/me/AppData/Roaming/go/env":      "GOPROXY=https://goproxy.cn,direct\n",
+		"/home/me/.bashrc":                            "<missing>",
+	} {
+		if got := sys.read(t, path); got != want {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+	if windowsSide.home != "" {
+		t.Errorf("the handlers still point at %s after OnWindowsSide", windowsSide.home)
+	}
+}
+
+// setUserEnv sets a Windows user environment variable, as setx would, for
+// reg query to find until reg delete removes it
+func (s *fakeSystem) setUserEnv(name, value string) {
+	query := `reg query HKCU\Environment /v ` + name
+	remove := `reg delete HKCU\Environment /v ` + name + " /f"
+	s.outputs[query] = "HKEY_CURRENT_USER\\Environment\n    " + name + "    REG_SZ    " + value
+	s.outputs[remove] = "The operation completed successfully."
+
+	next := run
+	run = func(command string, args ...string) (string, error) {
+		out, err := next(command, args...)
+		if err == nil && strings.Join(append([]string{command}, args...), " ") == remove {
+			delete(s.outputs, query)
+		}
+		return out, err
+	}
+}
+
+// withoutQueries drops the commands that only read: reg query and asking
+// PowerShell for $PROFILE
+func withoutQueries(commands []string) []string {
+	var changes []string
+	for _, command := range commands {
+		if !strings.HasPrefix(command, "reg query ") && !strings.HasSuffix(command, " $PROFILE") {
+			changes = append(changes, command)
+		}
+	}
+	return changes
+}
@@ -0,0 +1,58 @@
+package mirror
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/boomyao/crosh/internal/userfile"
+)
+
+// InWSL checks if crosh runs inside the Windows Subsystem for Linux
+func InWSL() bool {
+	if goos != "linux" {
+		return false
+	}
+	data, err := userfile.FS.ReadFile("/proc/sys/kernel/osrelease")
+	return err == nil && strings.Contains(strings.ToLower(string(data)), "microsoft")
+}
+
+// OnWindowsSide runs fn with the npm, pip, cargo, Go and package proxy
+// handlers pointed at the Windows user's files, which WSL reaches through
+// /mnt/c, so both halves of a WSL setup use the same mirrors and proxy
+func OnWindowsSide(fn func() error) error {
+	home, err := windowsDir("USERPROFILE")
+	if err != nil {
+		return err
+	}
+	appData, err := windowsDir("APPDATA")
+	if err != nil {
+		return err
+	}
+
+	windowsSide.home, windowsSide.appData = home, appData
+	defer func() {
+		windowsSide.home, windowsSide.appData = "", ""
+	}()
+	return fn()
+}
+
+// windowsDir returns the directory in a Windows environment variable, such
+// as USERPROFILE, as a path crosh can open on Windows or in WSL
+func windowsDir(name string) (string, error) {
+	if goos == "windows" {
+		if dir := os.Getenv(name); dir != "" {
+			return dir, nil
+		}
+		return "", fmt.Errorf("%%%s%% is not set", name)
+	}
+
+	dir, err := run("cmd.exe", "/c", "echo %"+name+"%")
+	if err != nil {
+		return "", fmt.Errorf("failed to read %%%s%% from Windows: %w", name, err)
+	}
+	if dir, err = run("wslpath", "-u", dir); err != nil {
+		return "", fmt.Errorf("failed to translate %%%s%% with wslpath: %w", name, err)
+	}
+	return dir, nil
+}
@@ -0,0 +1,41 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// sendTimeout bounds how long showing a notification may take
+const sendTimeout = 10 * time.Second
+
+// Send shows a desktop notification: osascript on macOS, a toast on Windows
+// and notify-send elsewhere. It fails if the desktop can't show one, e.g.
+// without a graphical session.
+func Send(title, message string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+
+	cmd, err := command(ctx, title, message)
+	if err != nil {
+		return err
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if detail := strings.TrimSpace(string(out)); detail != "" {
+			return fmt.Errorf("failed to show notification: %w: %s", err, detail)
+		}
+		return fmt.Errorf("failed to show notification: %w", err)
+	}
+	return nil
+}
+
+// lookPath finds a notifier binary, explaining what's missing if it isn't installed
+func lookPath(name string) (string, error) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("%s not found, can't show desktop notifications", name)
+	}
+	return path, nil
+}
@@ -0,0 +1,26 @@
+//go:build darwin
+
+package notify
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// command returns an osascript call that shows the notification
+func command(ctx context.Context, title, message string) (*exec.Cmd, error) {
+	osascript, err := lookPath("osascript")
+	if err != nil {
+		return nil, err
+	}
+	script := fmt.Sprintf("display notification %s with title %s", appleScriptString(message), appleScriptString(title))
+	return exec.CommandContext(ctx, osascript, "-e", script), nil
+}
+
+// appleScriptString quotes s as an AppleScript string literal
+func appleScriptString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
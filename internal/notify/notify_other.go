@@ -0,0 +1,17 @@
+//go:build !darwin && !windows
+
+package notify
+
+import (
+	"context"
+	"os/exec"
+)
+
+// command returns a notify-send call that shows the notification
+func command(ctx context.Context, title, message string) (*exec.Cmd, error) {
+	notifySend, err := lookPath("notify-send")
+	if err != nil {
+		return nil, err
+	}
+	return exec.CommandContext(ctx, notifySend, "--app-name=crosh", title, message), nil
+}
@@ -0,0 +1,35 @@
+//go:build windows
+
+package notify
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// toastScript shows a toast through the WinRT API, reading the text from the
+// environment so it needs no escaping. Toasts need a registered app ID, so
+// PowerShell's own is used.
+const toastScript = `
+[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$template = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $template.GetElementsByTagName('text')
+$text.Item(0).AppendChild($template.CreateTextNode($env:CROSH_NOTIFY_TITLE)) > $null
+$text.Item(1).AppendChild($template.CreateTextNode($env:CROSH_NOTIFY_MESSAGE)) > $null
+$appID = '{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe'
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier($appID).Show([Windows.UI.Notifications.ToastNotification]::new($template))
+`
+
+// command returns a hidden PowerShell call that shows the notification as a toast
+func command(ctx context.Context, title, message string) (*exec.Cmd, error) {
+	powershell, err := lookPath("powershell")
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, powershell, "-NoProfile", "-NonInteractive", "-Command", toastScript)
+	cmd.Env = append(os.Environ(), "CROSH_NOTIFY_TITLE="+title, "CROSH_NOTIFY_MESSAGE="+message)
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	return cmd, nil
+}
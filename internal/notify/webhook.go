@@ -0,0 +1,54 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// webhookPayload is the body of a json webhook
+type webhookPayload struct {
+	Event   string    `json:"event"`
+	Message string    `json:"message"`
+	Host    string    `json:"host"`
+	Time    time.Time `json:"time"`
+}
+
+// PostWebhook posts an event to a webhook URL. format picks the body: json
+// (the default), slack for Slack incoming webhooks or feishu for Feishu/Lark
+// custom bots.
+func PostWebhook(url, format, event, message string) error {
+	host, _ := os.Hostname()
+	text := fmt.Sprintf("[crosh@%s] %s", host, message)
+
+	var body interface{}
+	switch format {
+	case "slack":
+		body = map[string]string{"text": text}
+	case "feishu":
+		body = map[string]interface{}{
+			"msg_type": "text",
+			"content":  map[string]string{"text": text},
+		}
+	default:
+		body = webhookPayload{Event: event, Message: message, Host: host, Time: time.Now()}
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook: %w", err)
+	}
+
+	client := &http.Client{Timeout: sendTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to post webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
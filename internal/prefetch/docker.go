@@ -0,0 +1,347 @@
+package prefetch
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// manifestTypes are the manifest and index media types the registry may answer with
+var manifestTypes = []string{
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+}
+
+// descriptor points at a blob or manifest by digest
+type descriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Platform  *struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+		Variant      string `json:"variant"`
+	} `json:"platform,omitempty"`
+}
+
+// manifest is an image manifest, or an index of manifests per platform
+type manifest struct {
+	Manifests []descriptor `json:"manifests"`
+	Config    descriptor   `json:"config"`
+	Layers    []descriptor `json:"layers"`
+}
+
+// registry is the Docker Registry HTTP API v2 of one repository
+type registry struct {
+	base   string
+	repo   string
+	token  string
+	client *http.Client
+}
+
+// Docker downloads an image for the fetcher's platform through the registry
+// mirrors and writes it as a "docker load" archive. It returns the archive.
+func (f *Fetcher) Docker(ref string) (string, error) {
+	host, repo, reference, tag := parseImage(ref)
+	repoTag := ""
+	if tag != "" {
+		repoTag = strings.TrimSuffix(ref, ":"+tag) + ":" + tag
+	}
+	archive := filepath.Join(f.imageDir, strings.NewReplacer("/", "_", ":", "_", "@", "_").Replace(ref)+".tar")
+	if _, err := os.Stat(archive); err == nil {
+		return archive, nil
+	}
+
+	bases := []string{"https://" + host}
+	if host == "" {
+		bases = nil
+		for _, mirror := range f.registries {
+			if !strings.HasPrefix(mirror, "http://") && !strings.HasPrefix(mirror, "https://") {
+				mirror = "https://" + mirror
+			}
+			bases = append(bases, strings.TrimSuffix(mirror, "/"))
+		}
+		bases = append(bases, "https://registry-1.docker.io")
+	}
+
+	var errs []string
+	for _, base := range bases {
+		r := &registry{base: base, repo: repo, client: f.client}
+		err := f.pullImage(r, reference, repoTag, archive)
+		if err == nil {
+			return archive, nil
+		}
+		errs = append(errs, err.Error())
+	}
+	return "", fmt.Errorf("failed to pull %s: %s", ref, strings.Join(errs, "; "))
+}
+
+// pullImage downloads the manifest, config and layers of an image and
+// writes them to archive
+func (f *Fetcher) pullImage(r *registry, reference, repoTag, archive string) error {
+	m, err := r.manifest(reference)
+	if err != nil {
+		return err
+	}
+	if len(m.Manifests) > 0 {
+		digest := f.pickPlatform(m.Manifests)
+		if digest == "" {
+			return fmt.Errorf("no image for %s", f.platform)
+		}
+		if m, err = r.manifest(digest); err != nil {
+			return err
+		}
+	}
+	if m.Config.Digest == "" {
+		return fmt.Errorf("unsupported manifest")
+	}
+
+	tmp, err := os.MkdirTemp(f.imageDir, ".tmp-")
+	if err != nil {
+		return fmt.Errorf("failed to create a temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	blobs := append([]descriptor{m.Config}, m.Layers...)
+	for _, blob := range blobs {
+		if err := r.blob(blob.Digest, filepath.Join(tmp, digestHex(blob.Digest))); err != nil {
+			return err
+		}
+	}
+	return writeArchive(archive, tmp, m, repoTag)
+}
+
+// pickPlatform returns the manifest digest for the fetcher's platform
+func (f *Fetcher) pickPlatform(manifests []descriptor) string {
+	goos, arch, _ := strings.Cut(f.platform, "/")
+	arch, variant, _ := strings.Cut(arch, "/")
+	for _, m := range manifests {
+		if m.Platform == nil || m.Platform.OS != goos || m.Platform.Architecture != arch {
+			continue
+		}
+		if variant == "" || m.Platform.Variant == variant {
+			return m.Digest
+		}
+	}
+	return ""
+}
+
+// manifest fetches a manifest or index by tag or digest
+func (r *registry) manifest(reference string) (*manifest, error) {
+	resp, err := r.get("/manifests/"+reference, strings.Join(manifestTypes, ", "))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var m manifest
+	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+		return nil, fmt.Errorf("failed to parse the manifest from %s: %w", r.base, err)
+	}
+	return &m, nil
+}
+
+// blob downloads a blob to path, checking its digest
+func (r *registry) blob(digest, path string) error {
+	resp, err := r.get("/blobs/"+digest, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(file, hash), resp.Body); err != nil {
+		return fmt.Errorf("failed to download %s: %w", digest, err)
+	}
+	if "sha256:"+hex.EncodeToString(hash.Sum(nil)) != digest {
+		return fmt.Errorf("%s from %s doesn't match its digest", digest, r.base)
+	}
+	return nil
+}
+
+// get requests a path of the repository, getting an anonymous pull token
+// first if the registry asks for one
+func (r *registry) get(path, accept string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(http.MethodGet, r.base+"/v2/"+r.repo+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if r.token != "" {
+			req.Header.Set("Authorization", "Bearer "+r.token)
+		}
+		resp, err := r.client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to %s: %w", r.base, err)
+		}
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			challenge := resp.Header.Get("WWW-Authenticate")
+			resp.Body.Close()
+			if err := r.authenticate(challenge); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("%s returned %s", r.base, resp.Status)
+		}
+		return resp, nil
+	}
+}
+
+// challengeParam is a key="value" pair of a WWW-Authenticate header
+var challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// authenticate gets an anonymous token for a Bearer challenge
+func (r *registry) authenticate(challenge string) error {
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return fmt.Errorf("%s needs credentials", r.base)
+	}
+	params := map[string]string{}
+	for _, match := range challengeParam.FindAllStringSubmatch(challenge, -1) {
+		params[match[1]] = match[2]
+	}
+	if params["realm"] == "" {
+		return fmt.Errorf("%s sent no token realm", r.base)
+	}
+	if params["scope"] == "" {
+		params["scope"] = "repository:" + r.repo + ":pull"
+	}
+
+	query := url.Values{"service": {params["service"]}, "scope": {params["scope"]}}
+	resp, err := r.client.Get(params["realm"] + "?" + query.Encode())
+	if err != nil {
+		return fmt.Errorf("failed to get a token from %s: %w", params["realm"], err)
+	}
+	defer resp.Body.Close()
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil || resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to get a token from %s: %s", params["realm"], resp.Status)
+	}
+	r.token = token.Token
+	if r.token == "" {
+		r.token = token.AccessToken
+	}
+	return nil
+}
+
+// parseImage splits an image reference into the registry host ("" for
+// Docker Hub), the repository, the tag or digest to pull, and the tag to
+// record in the archive ("" when pulling by digest)
+func parseImage(ref string) (host, repo, reference, tag string) {
+	name, digest, _ := strings.Cut(ref, "@")
+	tag = "latest"
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, tag = name[:i], name[i+1:]
+	}
+
+	if first, rest, ok := strings.Cut(name, "/"); ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		host, name = first, rest
+	}
+	if host == "docker.io" || host == "index.docker.io" {
+		host = ""
+	}
+	if host == "" && !strings.Contains(name, "/") {
+		name = "library/" + name
+	}
+
+	reference = tag
+	if digest != "" {
+		reference, tag = digest, ""
+	}
+	return host, name, reference, tag
+}
+
+// digestHex returns the hex part of a sha256 digest
+func digestHex(digest string) string {
+	return strings.TrimPrefix(digest, "sha256:")
+}
+
+// writeArchive writes the blobs in dir as a "docker save" archive tagged
+// repoTag, if set. The layers stay compressed, which "docker load" accepts.
+func writeArchive(archive, dir string, m *manifest, repoTag string) error {
+	configName := digestHex(m.Config.Digest) + ".json"
+	entry := struct {
+		Config   string
+		RepoTags []string
+		Layers   []string
+	}{Config: configName, RepoTags: []string{}}
+	files := map[string]string{configName: m.Config.Digest}
+	for _, layer := range m.Layers {
+		name := digestHex(layer.Digest) + "/layer.tar"
+		entry.Layers = append(entry.Layers, name)
+		files[name] = layer.Digest
+	}
+	if repoTag != "" {
+		entry.RepoTags = append(entry.RepoTags, repoTag)
+	}
+	manifestJSON, err := json.Marshal([]interface{}{entry})
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest.json: %w", err)
+	}
+
+	tmp := archive + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", archive, err)
+	}
+	defer os.Remove(tmp)
+	tw := tar.NewWriter(out)
+
+	add := func(name string, size int64, r io.Reader) error {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: size, Typeflag: tar.TypeReg}); err != nil {
+			return err
+		}
+		_, err := io.Copy(tw, r)
+		return err
+	}
+	names := append([]string{configName}, entry.Layers...)
+	for _, name := range names {
+		blob, err := os.Open(filepath.Join(dir, digestHex(files[name])))
+		if err != nil {
+			out.Close()
+			return err
+		}
+		info, _ := blob.Stat()
+		err = add(name, info.Size(), blob)
+		blob.Close()
+		if err != nil {
+			out.Close()
+			return fmt.Errorf("failed to write %s: %w", archive, err)
+		}
+	}
+	if err := add("manifest.json", int64(len(manifestJSON)), strings.NewReader(string(manifestJSON))); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to write %s: %w", archive, err)
+	}
+	if err := tw.Close(); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to write %s: %w", archive, err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", archive, err)
+	}
+	return os.Rename(tmp, archive)
+}
@@ -0,0 +1,330 @@
+package prefetch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/boomyao/crosh/internal/cache"
+	"github.com/boomyao/crosh/internal/httpclient"
+)
+
+// npmAccept and pipAccept are what npm and pip send, so the prefetched
+// metadata is what they ask for later
+const (
+	npmAccept = "application/vnd.npm.install-v1+json; q=1.0, application/json; q=0.8, */*"
+	pipAccept = "application/vnd.pypi.simple.v1+json, application/vnd.pypi.simple.v1+html; q=0.1, text/html; q=0.01"
+)
+
+// List is the packages.yaml read by "crosh prefetch"
+type List struct {
+	NPM    []string `yaml:"npm"`    // name or name@version/tag, e.g. lodash@4.17.21
+	Pip    []string `yaml:"pip"`    // name or name==version
+	Go     []string `yaml:"go"`     // module or module@version
+	Docker []string `yaml:"docker"` // image reference, e.g. nginx:1.25
+
+	// PipWheels keeps only the wheels whose file name contains one of these,
+	// e.g. cp311, manylinux or none-any; sdists are always kept
+	PipWheels []string `yaml:"pip_wheels"`
+}
+
+// Load reads a package list
+func Load(path string) (*List, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	var list List
+	if err := yaml.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return &list, nil
+}
+
+// Fetcher downloads packages into a cache and images into a directory
+type Fetcher struct {
+	cache      *cache.Server
+	registries []string // Docker registry mirrors
+	imageDir   string
+	platform   string // e.g. linux/amd64
+	pipWheels  []string
+	client     *http.Client
+}
+
+// NewFetcher creates a fetcher that downloads packages through server and
+// images through the Docker registry mirrors into imageDir
+func NewFetcher(server *cache.Server, registries []string, imageDir, platform string, pipWheels []string) *Fetcher {
+	return &Fetcher{
+		cache:      server,
+		registries: registries,
+		imageDir:   imageDir,
+		platform:   platform,
+		pipWheels:  pipWheels,
+		client:     httpclient.New(0),
+	}
+}
+
+// get fetches path from a registry of the cache and returns the body
+func (f *Fetcher) get(registry, path, accept string) ([]byte, error) {
+	file, err := f.cache.Fetch(registry, path, accept)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// download fetches path from a registry of the cache without reading it
+func (f *Fetcher) download(registry, path string) error {
+	file, err := f.cache.Fetch(registry, path, "")
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// mirrorPath returns the path of a link from metadata relative to the
+// registry's mirror, as the cache keys it
+func (f *Fetcher) mirrorPath(registry, link, base string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(link)
+	if err != nil {
+		return "", fmt.Errorf("invalid link %q: %w", link, err)
+	}
+	resolved := u.ResolveReference(ref)
+	resolved.Fragment = ""
+
+	upstream := f.cache.Upstream(registry)
+	path, ok := strings.CutPrefix(resolved.String(), upstream)
+	if !ok || !strings.HasPrefix(path, "/") {
+		return "", fmt.Errorf("%s is not on the mirror %s", resolved, upstream)
+	}
+	return path, nil
+}
+
+// NPM downloads the metadata and tarball of a package and returns the
+// version fetched
+func (f *Fetcher) NPM(spec string) (string, error) {
+	name, version := spec, "latest"
+	if i := strings.LastIndex(spec, "@"); i > 0 {
+		name, version = spec[:i], spec[i+1:]
+	}
+	path := "/" + strings.Replace(name, "/", "%2f", 1) // npm's form of @scope/name
+
+	body, err := f.get("npm", path, npmAccept)
+	if err != nil {
+		return "", err
+	}
+	var packument struct {
+		DistTags map[string]string `json:"dist-tags"`
+		Versions map[string]struct {
+			Dist struct {
+				Tarball string `json:"tarball"`
+			} `json:"dist"`
+		} `json:"versions"`
+	}
+	if err := json.Unmarshal(body, &packument); err != nil {
+		return "", fmt.Errorf("failed to parse the metadata of %s: %w", name, err)
+	}
+	if tagged, ok := packument.DistTags[version]; ok {
+		version = tagged
+	}
+	v, ok := packument.Versions[version]
+	if !ok {
+		return "", fmt.Errorf("%s has no version %s (ranges aren't supported)", name, version)
+	}
+
+	tarball, err := f.mirrorPath("npm", v.Dist.Tarball, f.cache.Upstream("npm")+path)
+	if err != nil {
+		return "", err
+	}
+	return version, f.download("npm", tarball)
+}
+
+// pipLink is a file listed on a PyPI index page
+var pipLink = regexp.MustCompile(`<a\s([^>]*)>([^<]+)</a>`)
+
+// pipHref is the link of a file on a PyPI index page
+var pipHref = regexp.MustCompile(`href="([^"]+)"`)
+
+// pipFile is a file of a PyPI project
+type pipFile struct {
+	name     string
+	url      string
+	metadata bool // whether the index offers its metadata as <url>.metadata (PEP 658)
+}
+
+// Pip downloads the index page and the files of one version of a project
+// and returns the version fetched. Without a version it fetches the newest
+// final release listed.
+func (f *Fetcher) Pip(spec string) (string, error) {
+	name, version, _ := strings.Cut(spec, "==")
+	name = normalizePip(strings.TrimSpace(name))
+	version = strings.TrimSpace(version)
+
+	// The index path the cache points pip at, e.g. /simple/
+	_, index, _ := f.cache.URLs("")
+	path := strings.TrimPrefix(index, "/pypi") + name + "/"
+	body, err := f.get("pypi", path, pipAccept)
+	if err != nil {
+		return "", err
+	}
+	files := parsePipIndex(body)
+	if len(files) == 0 {
+		return "", fmt.Errorf("no files listed for %s", name)
+	}
+
+	if version == "" {
+		for _, file := range files {
+			if v := pipFileVersion(file.name); !strings.ContainsFunc(v, unicode.IsLetter) {
+				version = v // Files are listed oldest first
+			}
+		}
+	}
+
+	base := f.cache.Upstream("pypi") + path
+	fetched := 0
+	for _, file := range files {
+		if pipFileVersion(file.name) != version || !f.keepWheel(file.name) {
+			continue
+		}
+		filePath, err := f.mirrorPath("pypi", file.url, base)
+		if err != nil {
+			return "", err
+		}
+		if err := f.download("pypi", filePath); err != nil {
+			return "", err
+		}
+		if file.metadata {
+			f.download("pypi", filePath+".metadata")
+		}
+		fetched++
+	}
+	if fetched == 0 {
+		return "", fmt.Errorf("%s has no files for version %q", name, version)
+	}
+	return version, nil
+}
+
+// keepWheel checks if a file passes the pip_wheels filter
+func (f *Fetcher) keepWheel(name string) bool {
+	if len(f.pipWheels) == 0 || !strings.HasSuffix(name, ".whl") {
+		return true
+	}
+	for _, tag := range f.pipWheels {
+		if strings.Contains(name, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePipIndex returns the files of a PyPI project page in the JSON or the
+// HTML form of the simple API
+func parsePipIndex(body []byte) []pipFile {
+	var page struct {
+		Files []struct {
+			Filename     string      `json:"filename"`
+			URL          string      `json:"url"`
+			CoreMetadata interface{} `json:"core-metadata"`
+		} `json:"files"`
+	}
+	if json.Unmarshal(body, &page) == nil {
+		var files []pipFile
+		for _, file := range page.Files {
+			hasMetadata := file.CoreMetadata != nil && file.CoreMetadata != false
+			files = append(files, pipFile{file.Filename, file.URL, hasMetadata})
+		}
+		return files
+	}
+
+	var files []pipFile
+	for _, match := range pipLink.FindAllStringSubmatch(string(body), -1) {
+		href := pipHref.FindStringSubmatch(match[1])
+		if href == nil {
+			continue
+		}
+		hasMetadata := strings.Contains(match[1], "data-core-metadata") || strings.Contains(match[1], "data-dist-info-metadata")
+		files = append(files, pipFile{strings.TrimSpace(match[2]), strings.ReplaceAll(href[1], "&amp;", "&"), hasMetadata})
+	}
+	return files
+}
+
+// pipSeparators are the runs of characters PEP 503 normalizes to "-"
+var pipSeparators = regexp.MustCompile(`[-_.]+`)
+
+// normalizePip returns a project name as the simple API spells it (PEP 503)
+func normalizePip(name string) string {
+	return strings.ToLower(pipSeparators.ReplaceAllString(name, "-"))
+}
+
+// pipFileVersion returns the version in a wheel or sdist file name
+func pipFileVersion(name string) string {
+	if strings.HasSuffix(name, ".whl") {
+		if parts := strings.Split(name, "-"); len(parts) >= 2 {
+			return parts[1]
+		}
+		return ""
+	}
+	for _, ext := range []string{".tar.gz", ".tar.bz2", ".tgz", ".zip"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+	if i := strings.LastIndex(name, "-"); i >= 0 {
+		return name[i+1:]
+	}
+	return ""
+}
+
+// Go downloads the version list, .info, .mod and .zip of a module version
+// and returns the version fetched
+func (f *Fetcher) Go(spec string) (string, error) {
+	module, version, _ := strings.Cut(spec, "@")
+	if version == "" {
+		version = "latest"
+	}
+	path := "/" + escapeModule(module)
+
+	f.get("go", path+"/@v/list", "") // Not served by every proxy for every module
+	if version == "latest" {
+		body, err := f.get("go", path+"/@latest", "")
+		if err != nil {
+			return "", err
+		}
+		var info struct{ Version string }
+		if err := json.Unmarshal(body, &info); err != nil || info.Version == "" {
+			return "", fmt.Errorf("failed to parse the latest version of %s", module)
+		}
+		version = info.Version
+	}
+	for _, ext := range []string{".info", ".mod", ".zip"} {
+		if err := f.download("go", path+"/@v/"+escapeModule(version)+ext); err != nil {
+			return "", err
+		}
+	}
+	return version, nil
+}
+
+// escapeModule escapes a module path or version for the module proxy
+// protocol: upper-case letters become "!" and the lower-case letter
+func escapeModule(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,135 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/boomyao/crosh/internal/i18n"
+	"github.com/boomyao/crosh/internal/logging"
+)
+
+// Refresh rates of the progress bar on a terminal and of the plain lines
+// printed when stderr isn't one
+const (
+	redrawInterval = 200 * time.Millisecond
+	logInterval    = 5 * time.Second
+	barWidth       = 24
+)
+
+// Reader reports the progress of a download on stderr as it is read: a bar
+// with speed and ETA on a terminal, a line every few seconds otherwise
+type Reader struct {
+	r           io.Reader
+	name        string
+	total       int64 // -1 when the server didn't send a length
+	resumed     int64 // bytes downloaded before, when resuming
+	read        int64
+	start       time.Time
+	last        time.Time
+	interactive bool
+	drawn       bool
+}
+
+// NewReader wraps the body of a download of total bytes (-1 if unknown).
+// Call Finish when the download ends.
+func NewReader(r io.Reader, name string, total int64) *Reader {
+	now := time.Now()
+	logging.Debug("download started", "name", name, "size", total)
+	return &Reader{
+		r:           r,
+		name:        name,
+		total:       total,
+		start:       now,
+		last:        now,
+		interactive: isTerminal(os.Stderr),
+	}
+}
+
+// Resumed tells the reader that offset of the total bytes were downloaded
+// before, so the progress of a resumed download starts there
+func (p *Reader) Resumed(offset int64) *Reader {
+	p.resumed = offset
+	return p
+}
+
+// Read reads from the download and redraws the progress when it's due
+func (p *Reader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+
+	interval := logInterval
+	if p.interactive {
+		interval = redrawInterval
+	}
+	if now := time.Now(); now.Sub(p.last) >= interval {
+		p.last = now
+		p.report(now)
+	}
+	return n, err
+}
+
+// Finish clears the progress bar and logs how the download went
+func (p *Reader) Finish() {
+	if p.drawn {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+	}
+	logging.Debug("download finished", "name", p.name, "bytes", p.read, "duration", time.Since(p.start).Round(time.Millisecond))
+}
+
+// report prints the current progress
+func (p *Reader) report(now time.Time) {
+	if logging.Verbosity() < logging.Normal {
+		return
+	}
+
+	elapsed := now.Sub(p.start).Seconds()
+	speed := float64(p.read) / elapsed
+	rate := FormatBytes(int64(speed)) + "/s"
+	have := p.resumed + p.read
+
+	if !p.interactive {
+		if p.total > 0 {
+			i18n.Fprintf(os.Stderr, "  %s: %s of %s (%d%%), %s\n", p.name, FormatBytes(have), FormatBytes(p.total), have*100/p.total, rate)
+		} else {
+			i18n.Fprintf(os.Stderr, "  %s: %s, %s\n", p.name, FormatBytes(have), rate)
+		}
+		return
+	}
+
+	line := fmt.Sprintf("  %s  %s  %s", p.name, FormatBytes(have), rate)
+	if p.total > 0 {
+		done := have * barWidth / p.total
+		if done > barWidth {
+			done = barWidth
+		}
+		bar := strings.Repeat("=", int(done)) + strings.Repeat(" ", barWidth-int(done))
+		eta := "?"
+		if speed > 0 {
+			eta = time.Duration(float64(p.total-have) / speed * float64(time.Second)).Round(time.Second).String()
+		}
+		line = fmt.Sprintf("  %s [%s] %3d%%  %s/%s  %s  %s", p.name, bar, have*100/p.total, FormatBytes(have), FormatBytes(p.total), rate, i18n.Sprintf("ETA %s", eta))
+	}
+	fmt.Fprint(os.Stderr, "\r\033[K"+line)
+	p.drawn = true
+}
+
+// FormatBytes formats a byte count as B, KB or MB
+func FormatBytes(n int64) string {
+	switch {
+	case n >= 1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1024*1024))
+	case n >= 1024:
+		return fmt.Sprintf("%.0f KB", float64(n)/1024)
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
+
+// isTerminal checks if f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
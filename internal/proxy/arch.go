@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"debug/macho"
+	"runtime"
+
+	"github.com/boomyao/crosh/internal/sysenv"
+)
+
+// machoArchs maps Mach-O CPU types to GOARCH names
+var machoArchs = map[macho.Cpu]string{
+	macho.CpuAmd64: "amd64",
+	macho.CpuArm64: "arm64",
+}
+
+// ForeignBinary returns the path of node's proxy binary (Xray-core if node is
+// nil) and the architecture it was built for when that isn't this Mac's,
+// such as an Intel build downloaded while crosh ran under Rosetta
+func (x *XrayManager) ForeignBinary(node *Node) (path, arch string) {
+	if runtime.GOOS != "darwin" {
+		return "", ""
+	}
+	path, err := x.binaryFor(node)
+	if err != nil {
+		return "", ""
+	}
+	// Universal binaries don't open as a single Mach-O file and run natively
+	f, err := macho.Open(path)
+	if err != nil {
+		return "", ""
+	}
+	defer f.Close()
+	if arch := machoArchs[f.Cpu]; arch != "" && arch != sysenv.Arch() {
+		return path, arch
+	}
+	return "", ""
+}
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/boomyao/crosh/internal/httpclient"
+)
+
+// DefaultBenchURL serves a 10MB payload from a global CDN
+const DefaultBenchURL = "https://speed.cloudflare.com/__down?bytes=10000000"
+
+// BenchResult holds the outcome of a download benchmark through one node
+type BenchResult struct {
+	Node     Node
+	Bytes    int64
+	Duration time.Duration
+	Err      error
+}
+
+// Throughput returns the download speed in bytes per second
+func (r BenchResult) Throughput() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Bytes) / r.Duration.Seconds()
+}
+
+// FormatThroughput formats bytes per second as a human readable rate
+func FormatThroughput(bytesPerSecond float64) string {
+	switch {
+	case bytesPerSecond >= 1024*1024:
+		return fmt.Sprintf("%.2f MB/s", bytesPerSecond/(1024*1024))
+	case bytesPerSecond >= 1024:
+		return fmt.Sprintf("%.1f KB/s", bytesPerSecond/1024)
+	default:
+		return fmt.Sprintf("%.0f B/s", bytesPerSecond)
+	}
+}
+
+// BenchNode downloads testURL through node for at most timeout and measures
+// the throughput. A download cut short by the timeout still counts.
+func (x *XrayManager) BenchNode(node *Node, testURL string, timeout time.Duration) BenchResult {
+	result := BenchResult{Node: *node}
+
+	result.Err = x.withNodeProxy(node, func(proxyURL string) error {
+		bytes, duration, err := download(x.context(), proxyURL, testURL, timeout)
+		result.Bytes = bytes
+		result.Duration = duration
+		return err
+	})
+
+	return result
+}
+
+// download fetches testURL through proxyURL and returns how much was read
+// and how long it took. Cancelling ctx fails the download, unlike the timeout.
+func download(ctx context.Context, proxyURL, testURL string, timeout time.Duration) (int64, time.Duration, error) {
+	client, err := httpclient.Via(proxyURL, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, testURL, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid test URL: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, 0, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, 0, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	// Time the body only, so slow handshakes don't dilute the throughput
+	start := time.Now()
+	n, err := io.Copy(io.Discard, resp.Body)
+	duration := time.Since(start)
+
+	if err != nil && !(errors.Is(err, context.DeadlineExceeded) && n > 0) {
+		return n, duration, fmt.Errorf("download failed: %w", err)
+	}
+
+	return n, duration, nil
+}
@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"net"
+	"strings"
+)
+
+// xrayDomainPrefixes are Xray domain matchers that are passed through as is
+var xrayDomainPrefixes = []string{"domain:", "full:", "regexp:", "keyword:", "geosite:", "ext:"}
+
+// SetBypass sets the domains and IPs that always connect directly
+func (x *XrayManager) SetBypass(entries []string) {
+	x.bypass = entries
+}
+
+// NormalizeBypass cleans up a user supplied bypass entry such as
+// "https://Example.com/" or ".example.com" into "example.com"
+func NormalizeBypass(entry string) string {
+	entry = strings.TrimSpace(strings.ToLower(entry))
+	for _, prefix := range xrayDomainPrefixes {
+		if strings.HasPrefix(entry, prefix) {
+			return entry
+		}
+	}
+	entry = strings.TrimPrefix(entry, "http://")
+	entry = strings.TrimPrefix(entry, "https://")
+	entry = strings.TrimSuffix(entry, "/")
+	entry = strings.TrimPrefix(entry, "*.")
+	return strings.TrimPrefix(entry, ".")
+}
+
+// isIPEntry checks if a bypass entry is an IP address or CIDR range
+func isIPEntry(entry string) bool {
+	if net.ParseIP(entry) != nil {
+		return true
+	}
+	_, _, err := net.ParseCIDR(entry)
+	return err == nil
+}
+
+// splitBypass separates bypass entries into domains and IPs
+func splitBypass(entries []string) (domains, ips []string) {
+	for _, entry := range entries {
+		if isIPEntry(entry) {
+			ips = append(ips, entry)
+		} else {
+			domains = append(domains, entry)
+		}
+	}
+	return domains, ips
+}
+
+// generateBypassRules generates Xray routing rules sending bypass entries direct
+func (x *XrayManager) generateBypassRules() []map[string]interface{} {
+	domains, ips := splitBypass(x.bypass)
+
+	var rules []map[string]interface{}
+	if len(domains) > 0 {
+		matchers := make([]string, 0, len(domains))
+		for _, domain := range domains {
+			matchers = append(matchers, xrayDomainMatcher(domain))
+		}
+		rules = append(rules, map[string]interface{}{
+			"type":        "field",
+			"domain":      matchers,
+			"outboundTag": "direct",
+		})
+	}
+	if len(ips) > 0 {
+		rules = append(rules, map[string]interface{}{
+			"type":        "field",
+			"ip":          ips,
+			"outboundTag": "direct",
+		})
+	}
+	return rules
+}
+
+// xrayDomainMatcher makes a plain domain match itself and its subdomains
+func xrayDomainMatcher(domain string) string {
+	for _, prefix := range xrayDomainPrefixes {
+		if strings.HasPrefix(domain, prefix) {
+			return domain
+		}
+	}
+	return "domain:" + domain
+}
+
+// generateSingBoxBypassRules generates sing-box route rules sending bypass entries direct
+func (x *XrayManager) generateSingBoxBypassRules() []map[string]interface{} {
+	domains, ips := splitBypass(x.bypass)
+
+	var suffixes []string
+	for _, domain := range domains {
+		// Xray-only matchers like geosite: have no sing-box equivalent here
+		if strings.Contains(domain, ":") {
+			continue
+		}
+		suffixes = append(suffixes, domain)
+	}
+
+	var rules []map[string]interface{}
+	if len(suffixes) > 0 {
+		rules = append(rules, map[string]interface{}{"domain_suffix": suffixes, "outbound": "direct"})
+	}
+	if len(ips) > 0 {
+		rules = append(rules, map[string]interface{}{"ip_cidr": ips, "outbound": "direct"})
+	}
+	return rules
+}
@@ -0,0 +1,88 @@
+package proxy
+
+import "strings"
+
+// DefaultFakeIPRange is the reserved benchmarking range used for fake-ip answers
+const DefaultFakeIPRange = "198.18.0.0/15"
+
+// DNSSettings controls the DNS section of the generated Xray config
+type DNSSettings struct {
+	Enabled     bool
+	Remote      []string // DoH upstreams queried through the proxy
+	Domestic    []string // DoH upstreams queried directly for Chinese domains
+	FakeIP      bool     // answer with fake IPs so TUN/transparent traffic keeps its domain
+	FakeIPRange string
+}
+
+// SetDNS sets the DNS settings written into generated configs
+func (x *XrayManager) SetDNS(dns DNSSettings) {
+	x.dns = dns
+}
+
+// DNS returns the DNS settings
+func (x *XrayManager) DNS() DNSSettings {
+	return x.dns
+}
+
+// applyDNSConfig adds the dns and fakedns sections to config. Without them
+// Xray resolves domains for the geoip rules with the (possibly poisoned)
+// system resolver, which sends blocked sites to the direct outbound.
+func (x *XrayManager) applyDNSConfig(config map[string]interface{}) {
+	if !x.dns.Enabled {
+		return
+	}
+
+	var servers []interface{}
+
+	if x.dns.FakeIP {
+		ipRange := x.dns.FakeIPRange
+		if ipRange == "" {
+			ipRange = DefaultFakeIPRange
+		}
+		config["fakedns"] = []map[string]interface{}{
+			{
+				"ipPool":   ipRange,
+				"poolSize": 65535,
+			},
+		}
+		servers = append(servers, "fakedns")
+
+		// Recover the real domain from fake-ip connections
+		for _, inbound := range config["inbounds"].([]map[string]interface{}) {
+			inbound["sniffing"] = map[string]interface{}{
+				"enabled":      true,
+				"destOverride": []string{"http", "tls", "quic", "fakedns"},
+			}
+		}
+	}
+
+	for _, server := range x.dns.Domestic {
+		servers = append(servers, map[string]interface{}{
+			"address":   localDNSAddress(server),
+			"domains":   []string{"geosite:cn"},
+			"expectIPs": []string{"geoip:cn"},
+		})
+	}
+
+	for _, server := range x.dns.Remote {
+		servers = append(servers, server)
+	}
+
+	if len(servers) == 0 {
+		return
+	}
+
+	config["dns"] = map[string]interface{}{
+		"servers":       servers,
+		"queryStrategy": "UseIP",
+	}
+}
+
+// localDNSAddress makes a DoH upstream bypass the routing rules
+// (https://... becomes https+local://...) so domestic queries go out directly
+func localDNSAddress(server string) string {
+	if strings.HasPrefix(server, "https://") {
+		return "https+local://" + strings.TrimPrefix(server, "https://")
+	}
+	return server
+}
@@ -0,0 +1,177 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/boomyao/crosh/internal/hint"
+	"github.com/boomyao/crosh/internal/userfile"
+)
+
+// dockerDropInPath is the systemd drop-in that sets the docker daemon's proxy
+const dockerDropInPath = "/etc/systemd/system/docker.service.d/http-proxy.conf"
+
+// dockerDropInMarker identifies drop-ins written by crosh
+const dockerDropInMarker = "# Managed by crosh"
+
+// DockerProxy handles proxy configuration for the Docker daemon, which
+// ignores the shell environment when pulling images
+type DockerProxy struct {
+	proxyURL string
+	out      io.Writer
+}
+
+// NewDockerProxy creates a new Docker daemon proxy handler
+func NewDockerProxy(proxyURL string) *DockerProxy {
+	return &DockerProxy{
+		proxyURL: proxyURL,
+	}
+}
+
+// SetOutput sends the Docker Desktop instructions to out instead of stdout
+func (d *DockerProxy) SetOutput(out io.Writer) {
+	d.out = out
+}
+
+// output returns the writer set by SetOutput, or os.Stdout
+func (d *DockerProxy) output() io.Writer {
+	if d.out == nil {
+		return os.Stdout
+	}
+	return d.out
+}
+
+// isDockerDesktop checks if Docker Desktop is being used
+func (d *DockerProxy) isDockerDesktop() bool {
+	if runtime.GOOS == "darwin" {
+		if _, err := os.Stat("/Applications/Docker.app"); err == nil {
+			return true
+		}
+	}
+	return runtime.GOOS == "windows"
+}
+
+// ConfigFiles returns the files Enable and Disable write
+func (d *DockerProxy) ConfigFiles() []string {
+	if d.isDockerDesktop() || runtime.GOOS != "linux" {
+		return nil // Docker Desktop is configured by hand
+	}
+	return []string{dockerDropInPath}
+}
+
+// Enable points the Docker daemon at the local proxy
+func (d *DockerProxy) Enable() error {
+	if d.isDockerDesktop() {
+		d.printDockerDesktopInstructions(true)
+		return nil
+	}
+
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("docker daemon proxy is only supported on Linux and Docker Desktop")
+	}
+
+	content := fmt.Sprintf(`%s
+[Service]
+Environment="HTTP_PROXY=%s"
+Environment="HTTPS_PROXY=%s"
+Environment="NO_PROXY=%s"
+`, dockerDropInMarker, d.proxyURL, d.proxyURL, MergedNoProxy())
+
+	if err := os.MkdirAll(filepath.Dir(dockerDropInPath), 0755); err != nil {
+		return hint.IfDenied(fmt.Errorf("failed to create %s: %w", filepath.Dir(dockerDropInPath), err), hint.Sudo)
+	}
+
+	if err := userfile.Write(dockerDropInPath, []byte(content), 0644); err != nil {
+		return hint.IfDenied(fmt.Errorf("failed to write %s: %w", dockerDropInPath, err), hint.Sudo)
+	}
+
+	return reloadSystemd()
+}
+
+// Disable removes the crosh-managed drop-in
+func (d *DockerProxy) Disable() error {
+	if d.isDockerDesktop() {
+		d.printDockerDesktopInstructions(false)
+		return nil
+	}
+
+	if runtime.GOOS != "linux" {
+		return nil
+	}
+
+	data, err := os.ReadFile(dockerDropInPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil // Nothing to disable
+		}
+		return fmt.Errorf("failed to read %s: %w", dockerDropInPath, err)
+	}
+
+	if !strings.Contains(string(data), dockerDropInMarker) {
+		return fmt.Errorf("%s was not created by crosh, leaving it untouched", dockerDropInPath)
+	}
+
+	if err := userfile.Remove(dockerDropInPath); err != nil {
+		return hint.IfDenied(fmt.Errorf("failed to remove %s: %w", dockerDropInPath, err), hint.Sudo)
+	}
+
+	return reloadSystemd()
+}
+
+// Status checks if the Docker daemon is configured to use the local proxy
+func (d *DockerProxy) Status() (bool, string, error) {
+	if d.isDockerDesktop() {
+		return false, "check Docker Desktop settings", nil
+	}
+
+	data, err := os.ReadFile(dockerDropInPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, "direct", nil
+		}
+		return false, "", fmt.Errorf("failed to read %s: %w", dockerDropInPath, err)
+	}
+
+	if strings.Contains(string(data), d.proxyURL) {
+		return true, d.proxyURL, nil
+	}
+
+	return false, "configured outside crosh", nil
+}
+
+// reloadSystemd makes systemd pick up changed drop-ins
+func reloadSystemd() error {
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		return nil // Not a systemd system; the file is picked up on next boot
+	}
+
+	out, err := exec.Command("systemctl", "daemon-reload").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl daemon-reload failed: %s", strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// printDockerDesktopInstructions explains how to set the proxy in Docker Desktop
+func (d *DockerProxy) printDockerDesktopInstructions(enable bool) {
+	fmt.Fprintln(d.output(), "\n⚠ Docker Desktop detected!")
+	fmt.Fprintln(d.output(), "\nDocker Desktop manages its proxy in the app settings:")
+	fmt.Fprintln(d.output())
+	fmt.Fprintln(d.output(), "1. Open Docker Desktop → Settings → Resources → Proxies")
+	if enable {
+		fmt.Fprintln(d.output(), "2. Enable 'Manual proxy configuration'")
+		fmt.Fprintf(d.output(), "3. Set both Web Server (HTTP) and Secure Web Server (HTTPS) to: %s\n", d.proxyURL)
+		fmt.Fprintf(d.output(), "4. Set 'Bypass proxy settings for these hosts' to: %s\n", MergedNoProxy())
+		fmt.Fprintln(d.output(), "5. Click 'Apply & Restart'")
+	} else {
+		fmt.Fprintln(d.output(), "2. Switch back to 'System proxy' or disable manual configuration")
+		fmt.Fprintln(d.output(), "3. Click 'Apply & Restart'")
+	}
+	fmt.Fprintln(d.output())
+}
@@ -0,0 +1,164 @@
+package proxy
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/boomyao/crosh/internal/errs"
+	"github.com/boomyao/crosh/internal/hint"
+)
+
+// DefaultGitProxyHosts are the hosts proxied for git when none are configured
+var DefaultGitProxyHosts = []string{"github.com"}
+
+// GitProxy handles git http/ssh proxy configuration in ~/.gitconfig
+type GitProxy struct {
+	localPort int
+	hosts     []string
+	ssh       bool
+}
+
+// NewGitProxy creates a new git proxy handler. An empty hosts list proxies
+// every remote instead of scoping to specific hosts.
+func NewGitProxy(localPort int, hosts []string, ssh bool) *GitProxy {
+	return &GitProxy{
+		localPort: localPort,
+		hosts:     hosts,
+		ssh:       ssh,
+	}
+}
+
+// proxyURL returns the proxy URL written to http.proxy (DNS resolved by the proxy)
+func (g *GitProxy) proxyURL() string {
+	return fmt.Sprintf("socks5h://127.0.0.1:%d", g.localPort)
+}
+
+// sshCommand returns the core.sshCommand routing ssh remotes through the proxy
+func (g *GitProxy) sshCommand() string {
+	return fmt.Sprintf("ssh -o ProxyCommand='nc -X 5 -x 127.0.0.1:%d %%h %%p'", g.localPort)
+}
+
+// Enable writes the proxy settings into the global git config. With ssh it
+// refuses to replace a core.sshCommand of the user's own, which Disable
+// couldn't bring back.
+func (g *GitProxy) Enable() error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return errs.Errorf(errs.ErrNotInstalled, "git not found in PATH")
+	}
+
+	if g.ssh {
+		if command := gitConfigValue("core.sshCommand"); command != "" && command != g.sshCommand() {
+			return hint.Errorf(fmt.Sprintf("add -o ProxyCommand='nc -X 5 -x 127.0.0.1:%d %%h %%p' to it yourself, or leave out --ssh", g.localPort),
+				"core.sshCommand is already set in the global git config: %s", command)
+		}
+	}
+
+	// Drop settings from a previous run so changed hosts don't linger
+	if err := g.Disable(); err != nil {
+		return err
+	}
+
+	// http.proxy covers https remotes too
+	if len(g.hosts) == 0 {
+		if err := gitConfig("http.proxy", g.proxyURL()); err != nil {
+			return err
+		}
+	} else {
+		for _, host := range g.hosts {
+			if err := gitConfig(fmt.Sprintf("http.https://%s.proxy", host), g.proxyURL()); err != nil {
+				return err
+			}
+		}
+	}
+
+	if g.ssh {
+		if err := gitConfig("core.sshCommand", g.sshCommand()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Disable removes every git proxy setting that points at the local proxy
+func (g *GitProxy) Disable() error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil // Nothing to disable
+	}
+
+	settings, err := g.managedSettings()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range settings {
+		out, err := exec.Command("git", "config", "--global", "--unset-all", key).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("failed to unset %s: %s", key, strings.TrimSpace(string(out)))
+		}
+	}
+
+	return nil
+}
+
+// Status checks if git is currently configured to use the local proxy
+func (g *GitProxy) Status() (bool, string, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return false, "git not installed", nil
+	}
+
+	settings, err := g.managedSettings()
+	if err != nil {
+		return false, "", err
+	}
+
+	if len(settings) == 0 {
+		return false, "direct", nil
+	}
+
+	return true, strings.Join(settings, ", "), nil
+}
+
+// managedSettings lists the global git config keys crosh wrote for the local proxy
+func (g *GitProxy) managedSettings() ([]string, error) {
+	out, err := exec.Command("git", "config", "--global", "--get-regexp", `^(https?\..*proxy|core\.sshcommand)$`).Output()
+	if err != nil {
+		// Exit status 1 means no matching keys
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read git config: %w", err)
+	}
+
+	marker := fmt.Sprintf("127.0.0.1:%d", g.localPort)
+	seen := make(map[string]bool)
+	var keys []string
+	for _, line := range strings.Split(string(out), "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), " ", 2)
+		if len(parts) == 2 && strings.Contains(parts[1], marker) && !seen[parts[0]] {
+			seen[parts[0]] = true
+			keys = append(keys, parts[0])
+		}
+	}
+
+	return keys, nil
+}
+
+// gitConfigValue returns a global git config value, "" if it isn't set
+func gitConfigValue(key string) string {
+	out, err := exec.Command("git", "config", "--global", "--get", key).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// gitConfig sets a single global git config value
+func gitConfig(key, value string) error {
+	out, err := exec.Command("git", "config", "--global", key, value).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to set %s: %s", key, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
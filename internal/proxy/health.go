@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/boomyao/crosh/internal/httpclient"
+)
+
+// directCheckAddrs are reachable from mainland China without a proxy and are
+// used to tell a dead node apart from a local network outage
+var directCheckAddrs = []string{
+	"223.5.5.5:53",    // AliDNS
+	"119.29.29.29:53", // DNSPod
+	"www.baidu.com:443",
+}
+
+// CheckProxy requests testURL through the HTTP proxy at proxyURL and returns
+// the round-trip time
+func CheckProxy(proxyURL, testURL string, timeout time.Duration) (time.Duration, error) {
+	return checkProxyStatus(context.Background(), proxyURL, testURL, 0, timeout)
+}
+
+// checkProxyStatus is CheckProxy requiring expectedStatus, or any 2xx/3xx if it is 0
+func checkProxyStatus(ctx context.Context, proxyURL, testURL string, expectedStatus int, timeout time.Duration) (time.Duration, error) {
+	client, err := httpclient.Via(proxyURL, timeout)
+	if err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	resp, err := httpclient.Get(ctx, client, testURL)
+	if err != nil {
+		return 0, fmt.Errorf("request failed: %w", err)
+	}
+	resp.Body.Close()
+
+	if expectedStatus != 0 && resp.StatusCode != expectedStatus {
+		return 0, fmt.Errorf("HTTP %d, expected %d", resp.StatusCode, expectedStatus)
+	}
+	if expectedStatus == 0 && resp.StatusCode >= 400 {
+		return 0, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	return time.Since(start), nil
+}
+
+// CheckDirect checks if the internet is reachable without the proxy
+func CheckDirect(timeout time.Duration) error {
+	var lastErr error
+	for _, addr := range directCheckAddrs {
+		conn, err := net.DialTimeout("tcp", addr, timeout)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		lastErr = err
+	}
+	return fmt.Errorf("network unreachable: %w", lastErr)
+}
@@ -0,0 +1,252 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/boomyao/crosh/internal/config"
+)
+
+// Latency test methods
+const (
+	LatencyMethodTCP  = "tcp"  // time a TCP connect to the node
+	LatencyMethodHTTP = "http" // time an HTTP GET through the node
+)
+
+// latencyTestWorkers bounds how many nodes are tested at once
+const latencyTestWorkers = 8
+
+// LatencyTest describes how node latency is measured
+type LatencyTest struct {
+	Method         string
+	URL            string
+	ExpectedStatus int // 0 accepts any 2xx/3xx
+	Timeout        time.Duration
+}
+
+// DefaultLatencyTest returns the TCP connect test used when nothing is configured
+func DefaultLatencyTest() LatencyTest {
+	return LatencyTest{
+		Method:  LatencyMethodTCP,
+		URL:     config.DefaultHealthCheckURL,
+		Timeout: 5 * time.Second,
+	}
+}
+
+// SetLatencyTest sets how nodes are tested when selecting the fastest one.
+// Empty fields keep their defaults.
+func (x *XrayManager) SetLatencyTest(test LatencyTest) {
+	defaults := DefaultLatencyTest()
+	if test.Method == "" {
+		test.Method = defaults.Method
+	}
+	if test.URL == "" {
+		test.URL = defaults.URL
+	}
+	if test.Timeout <= 0 {
+		test.Timeout = defaults.Timeout
+	}
+	x.latencyTest = test
+}
+
+// LatencyTest returns the configured latency test
+func (x *XrayManager) LatencyTest() LatencyTest {
+	return x.latencyTest
+}
+
+// ValidLatencyMethod checks if method is a known latency test method
+func ValidLatencyMethod(method string) bool {
+	return method == LatencyMethodTCP || method == LatencyMethodHTTP
+}
+
+// TestLatency measures the latency of a node with the configured method
+func (x *XrayManager) TestLatency(node *Node) error {
+	if err := x.context().Err(); err != nil {
+		return err
+	}
+	switch x.latencyTest.Method {
+	case LatencyMethodTCP, "":
+		if NeedsSingBox(node) {
+			// QUIC-based nodes don't accept TCP connections
+			return x.testHTTPLatency(node)
+		}
+		return node.testTCPLatency(x.context(), x.latencyTest.Timeout)
+	case LatencyMethodHTTP:
+		return x.testHTTPLatency(node)
+	default:
+		return fmt.Errorf("unknown latency test method %q (expected tcp or http)", x.latencyTest.Method)
+	}
+}
+
+// testTCPLatency times a TCP connect to the node
+func (n *Node) testTCPLatency(ctx context.Context, timeout time.Duration) error {
+	start := time.Now()
+
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(n.Server, fmt.Sprint(n.Port)))
+	if err != nil {
+		n.Latency = -1 // Mark as unreachable
+		return err
+	}
+	defer conn.Close()
+
+	n.Latency = int(time.Since(start).Milliseconds())
+	return nil
+}
+
+// testHTTPLatency starts a throwaway Xray instance for the node and times a
+// request to the test URL through it, which catches nodes that accept
+// connections but can't actually reach the internet
+func (x *XrayManager) testHTTPLatency(node *Node) error {
+	var latency time.Duration
+	err := x.withNodeProxy(node, func(proxyURL string) error {
+		var err error
+		latency, err = checkProxyStatus(x.context(), proxyURL, x.latencyTest.URL, x.latencyTest.ExpectedStatus, x.latencyTest.Timeout)
+		return err
+	})
+	if err != nil {
+		node.Latency = -1
+		return err
+	}
+
+	node.Latency = int(latency.Milliseconds())
+	return nil
+}
+
+// withNodeProxy runs a temporary Xray instance that sends all traffic through
+// node, calls fn with its HTTP proxy URL and stops the instance afterwards
+func (x *XrayManager) withNodeProxy(node *Node, fn func(proxyURL string) error) error {
+	binary, err := x.binaryFor(node)
+	if err != nil {
+		return err
+	}
+
+	port, err := freePort()
+	if err != nil {
+		return err
+	}
+
+	config, err := x.buildConfig(node)
+	if err != nil {
+		return err
+	}
+	// No routing rules or DNS: everything goes out through the node
+	if NeedsSingBox(node) {
+		delete(config, "route")
+		delete(config, "dns")
+		delete(config, "experimental")
+		config["log"] = map[string]interface{}{"disabled": true}
+		config["inbounds"] = []map[string]interface{}{
+			{
+				"type":        "http",
+				"tag":         "probe-in",
+				"listen":      "127.0.0.1",
+				"listen_port": port,
+			},
+		}
+	} else {
+		delete(config, "routing")
+		delete(config, "dns")
+		delete(config, "fakedns")
+		delete(config, "api")
+		delete(config, "stats")
+		delete(config, "policy")
+		config["log"] = map[string]interface{}{"loglevel": "none"}
+		config["inbounds"] = []map[string]interface{}{
+			{
+				"tag":      "probe-in",
+				"port":     port,
+				"listen":   "127.0.0.1",
+				"protocol": "http",
+				"settings": map[string]interface{}{},
+			},
+		}
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	configFile, err := os.CreateTemp(filepath.Dir(x.xrayPath), "probe-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to create probe config: %w", err)
+	}
+	defer os.Remove(configFile.Name())
+	if _, err := configFile.Write(data); err != nil {
+		configFile.Close()
+		return fmt.Errorf("failed to write probe config: %w", err)
+	}
+	configFile.Close()
+
+	// Killed on interrupt too, so no probe outlives crosh holding its port
+	cmd := exec.CommandContext(x.context(), binary, "run", "-c", configFile.Name())
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start Xray-core: %w", err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	if err := waitForPort(port, 5*time.Second); err != nil {
+		return err
+	}
+
+	return fn(fmt.Sprintf("http://127.0.0.1:%d", port))
+}
+
+// freePort asks the OS for an unused local TCP port
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("failed to find a free port: %w", err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// waitForPort waits until something listens on the local port
+func waitForPort(port int, timeout time.Duration) error {
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		conn, err := net.DialTimeout("tcp", addr, 200*time.Millisecond)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("proxy did not start listening on %s", addr)
+}
+
+// testNodes runs test on every node not in skip, a few at a time
+func testNodes(nodes []Node, skip map[string]bool, test func(*Node) error) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, latencyTestWorkers)
+
+	for i := range nodes {
+		if skip[nodes[i].Name] {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(node *Node) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := test(node); err != nil {
+				node.Latency = -1
+			}
+		}(&nodes[i])
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,238 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Log rotation limits for the Xray log file
+const (
+	maxLogSize    = 10 * 1024 * 1024
+	maxLogBackups = 3
+)
+
+// logLevels orders Xray log levels from most to least verbose
+var logLevels = []string{"debug", "info", "warning", "error"}
+
+// LogDir returns the directory holding proxy logs
+func (x *XrayManager) LogDir() string {
+	return filepath.Join(x.stateDir, "logs")
+}
+
+// LogFile returns the path of the current Xray log file
+func (x *XrayManager) LogFile() string {
+	return filepath.Join(x.LogDir(), "xray.log")
+}
+
+// SetLogLevel sets the Xray log level written into generated configs
+func (x *XrayManager) SetLogLevel(level string) {
+	x.logLevel = level
+}
+
+// generateLogConfig generates the Xray log section
+func (x *XrayManager) generateLogConfig() map[string]interface{} {
+	level := x.logLevel
+	if level == "" {
+		level = "warning"
+	}
+	return map[string]interface{}{
+		"loglevel": level,
+	}
+}
+
+// ValidLogLevel checks if level is a known Xray log level
+func ValidLogLevel(level string) bool {
+	return logLevelIndex(level) >= 0
+}
+
+// logLevelIndex returns the position of level in logLevels, or -1
+func logLevelIndex(level string) int {
+	for i, l := range logLevels {
+		if strings.EqualFold(l, level) {
+			return i
+		}
+	}
+	return -1
+}
+
+// RotateLog rotates the log of the running proxy once it exceeds
+// maxLogSize, so a proxy that runs for weeks doesn't fill the disk. The
+// daemon and health monitor call it as they check on the proxy, and every
+// crosh command while it runs; with none of them the log grows until the
+// proxy restarts.
+func (x *XrayManager) RotateLog() error {
+	return rotateLog(x.LogFile(), true)
+}
+
+// rotateLog shifts path to path.1, path.1 to path.2 and so on once it
+// exceeds maxLogSize. A log still open in a running proxy is copied to
+// path.1 and emptied instead of renamed, since the proxy would go on
+// writing to the renamed file; it appends, so its next line starts the
+// emptied one.
+func rotateLog(path string, inUse bool) error {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() < maxLogSize {
+		return nil
+	}
+
+	os.Remove(fmt.Sprintf("%s.%d", path, maxLogBackups))
+	for i := maxLogBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1))
+	}
+
+	if inUse {
+		return copyTruncate(path, path+".1")
+	}
+	if err := os.Rename(path, path+".1"); err != nil {
+		return fmt.Errorf("failed to rotate log: %w", err)
+	}
+
+	return nil
+}
+
+// copyTruncate copies path to dst and empties path. Lines written between
+// the copy and the truncation are lost.
+func copyTruncate(path, dst string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to rotate log: %w", err)
+	}
+	defer src.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to rotate log: %w", err)
+	}
+	_, err = io.Copy(out, src)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to rotate log: %w", err)
+	}
+
+	if err := os.Truncate(path, 0); err != nil {
+		return fmt.Errorf("failed to rotate log: %w", err)
+	}
+	return nil
+}
+
+// lineLevel extracts the level from an Xray log line such as
+// "2024/01/02 15:04:05 [Warning] ...", returning "" if there is none
+func lineLevel(line string) string {
+	start := strings.Index(line, "[")
+	if start < 0 {
+		return ""
+	}
+	end := strings.Index(line[start:], "]")
+	if end < 0 {
+		return ""
+	}
+
+	level := line[start+1 : start+end]
+	if logLevelIndex(level) < 0 {
+		return ""
+	}
+	return level
+}
+
+// matchesLevel checks if a log line is at or above minLevel.
+// Lines without a level (e.g. the startup banner) always match.
+func matchesLevel(line, minLevel string) bool {
+	if minLevel == "" {
+		return true
+	}
+	level := lineLevel(line)
+	if level == "" {
+		return true
+	}
+	return logLevelIndex(level) >= logLevelIndex(minLevel)
+}
+
+// TailLog writes the last n lines of the Xray log at or above minLevel to out.
+// With follow it keeps polling for new lines until the process is interrupted.
+func (x *XrayManager) TailLog(out io.Writer, n int, minLevel string, follow bool) error {
+	path := x.LogFile()
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no proxy log yet at %s", path)
+		}
+		return fmt.Errorf("failed to open log: %w", err)
+	}
+	defer file.Close()
+
+	// Print the last n matching lines
+	var tail []string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !matchesLevel(line, minLevel) {
+			continue
+		}
+		tail = append(tail, line)
+		if n > 0 && len(tail) > n {
+			tail = tail[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read log: %w", err)
+	}
+	for _, line := range tail {
+		fmt.Fprintln(out, line)
+	}
+
+	if !follow {
+		return nil
+	}
+
+	offset, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to read log: %w", err)
+	}
+
+	reader := bufio.NewReader(file)
+	partial := ""
+	for {
+		chunk, err := reader.ReadString('\n')
+		offset += int64(len(chunk))
+		partial += chunk
+
+		if err == nil {
+			line := strings.TrimRight(partial, "\r\n")
+			partial = ""
+			if matchesLevel(line, minLevel) {
+				fmt.Fprintln(out, line)
+			}
+			continue
+		}
+		if err != io.EOF {
+			return fmt.Errorf("failed to read log: %w", err)
+		}
+
+		time.Sleep(500 * time.Millisecond)
+
+		// Reopen the file if it was rotated or truncated
+		info, statErr := os.Stat(path)
+		if statErr != nil {
+			continue
+		}
+		current, _ := file.Stat()
+		if !os.SameFile(info, current) || info.Size() < offset {
+			file.Close()
+			if file, err = os.Open(path); err != nil {
+				return fmt.Errorf("failed to reopen log: %w", err)
+			}
+			reader = bufio.NewReader(file)
+			offset = 0
+			partial = ""
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package proxy
+
+import (
+	"os"
+	"strings"
+)
+
+// EnvNoProxy returns the hosts in NO_PROXY and no_proxy that crosh didn't
+// add itself, such as a company's internal domains
+func EnvNoProxy() []string {
+	own := strings.Split(NoProxy, ",")
+	var hosts []string
+	for _, name := range []string{"NO_PROXY", "no_proxy"} {
+		for _, host := range strings.Split(os.Getenv(name), ",") {
+			host = strings.TrimSpace(host)
+			if host != "" && !containsHost(own, host) && !containsHost(hosts, host) {
+				hosts = append(hosts, host)
+			}
+		}
+	}
+	return hosts
+}
+
+// MergedNoProxy returns crosh's NoProxy hosts followed by those already in
+// the environment, so exporting crosh's proxy keeps the existing exceptions
+func MergedNoProxy() string {
+	return strings.Join(append([]string{NoProxy}, EnvNoProxy()...), ",")
+}
+
+// containsHost checks if hosts has host, ignoring case
+func containsHost(hosts []string, host string) bool {
+	for _, h := range hosts {
+		if strings.EqualFold(h, host) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// NodeOverride replaces parameters of the nodes whose name matches Match,
+// for providers whose advertised settings need local tweaks to connect
+type NodeOverride struct {
+	Match       string // regular expression matched against the node name
+	Mux         *bool  // multiplex connections over one TCP stream (vmess, vless, trojan, ss)
+	Fingerprint string // uTLS client fingerprint, e.g. chrome or firefox
+	ALPN        string // comma separated, e.g. h2,http/1.1
+	SNI         string
+}
+
+// SetNodeOverrides sets the per-node overrides applied when generating configs
+func (x *XrayManager) SetNodeOverrides(overrides []NodeOverride) {
+	x.overrides = overrides
+}
+
+// applyNodeOverrides returns a copy of node with all matching overrides
+// applied in order (later entries win) and whether mux is enabled for it
+func (x *XrayManager) applyNodeOverrides(node *Node) (*Node, bool, error) {
+	result := *node
+	mux := false
+
+	for _, override := range x.overrides {
+		re, err := regexp.Compile(override.Match)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid node override pattern %q: %w", override.Match, err)
+		}
+		if !re.MatchString(node.Name) {
+			continue
+		}
+
+		if override.Mux != nil {
+			mux = *override.Mux
+		}
+		if override.Fingerprint != "" {
+			result.Fingerprint = override.Fingerprint
+		}
+		if override.ALPN != "" {
+			result.ALPN = override.ALPN
+		}
+		if override.SNI != "" {
+			result.SNI = override.SNI
+		}
+	}
+
+	// XTLS Vision splices the raw TLS stream, which mux would wrap
+	if result.Flow != "" {
+		mux = false
+	}
+
+	return &result, mux, nil
+}
+
+// muxSettings enables Xray's connection multiplexing for the proxy outbound
+func muxSettings() map[string]interface{} {
+	return map[string]interface{}{
+		"enabled":     true,
+		"concurrency": 8,
+	}
+}
@@ -0,0 +1,77 @@
+//go:build !windows
+
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// processAlive checks if a process with the given PID exists
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return process.Signal(syscall.Signal(0)) == nil
+}
+
+// processCommandLine returns the command line of a running process, from
+// /proc on Linux and ps elsewhere. ok is false if it can't be read.
+func processCommandLine(pid int) (string, bool) {
+	if data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid)); err == nil {
+		return string(bytes.ReplaceAll(bytes.TrimRight(data, "\x00"), []byte{0}, []byte{' '})), true
+	}
+	out, err := exec.Command("ps", "-o", "command=", "-p", fmt.Sprint(pid)).Output()
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(out)), true
+}
+
+// terminate asks a process to exit with SIGTERM and kills it if it is still
+// running after timeout. A process started with detachedAttr leads its own
+// process group, and the whole group is signalled so nothing it spawned is
+// left behind.
+func terminate(pid int, timeout time.Duration) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return nil
+	}
+	if syscall.Kill(-pid, syscall.SIGTERM) != nil {
+		// Not a group leader, e.g. started by an older crosh
+		if err := process.Signal(syscall.SIGTERM); err != nil {
+			return nil // already gone
+		}
+	}
+	if waitExit(pid, timeout) {
+		return nil
+	}
+
+	syscall.Kill(-pid, syscall.SIGKILL)
+	if err := process.Kill(); err != nil && processAlive(pid) {
+		return err
+	}
+	return nil
+}
+
+// reap collects the exit status of pid if it is an exited child of this
+// process, which otherwise stays a zombie that processAlive counts as alive
+func reap(pid int) {
+	var status syscall.WaitStatus
+	syscall.Wait4(pid, &status, syscall.WNOHANG, nil)
+}
+
+// detachedAttr returns process attributes that detach a background process
+// from the terminal so it survives the parent shell exiting
+func detachedAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
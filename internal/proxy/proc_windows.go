@@ -0,0 +1,53 @@
+//go:build windows
+
+package proxy
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// processAlive checks if a process with the given PID exists
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	// FindProcess opens a handle on Windows and fails for unknown PIDs
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	process.Release()
+	return true
+}
+
+// terminate ends a process. Windows has no SIGTERM for processes without a
+// console window, so it is killed right away and timeout is unused.
+func terminate(pid int, timeout time.Duration) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return nil
+	}
+	defer process.Release()
+	if err := process.Kill(); err != nil && processAlive(pid) {
+		return err
+	}
+	return nil
+}
+
+// processCommandLine can't read other processes' command lines on Windows
+// without WMI, so ok is always false
+func processCommandLine(pid int) (string, bool) {
+	return "", false
+}
+
+// reap does nothing: Windows has no zombie processes
+func reap(pid int) {}
+
+// detachedAttr returns process attributes that detach a background process
+// from the console so it survives the parent shell exiting
+func detachedAttr() *syscall.SysProcAttr {
+	const createNewProcessGroup = 0x00000200
+	return &syscall.SysProcAttr{CreationFlags: createNewProcessGroup}
+}
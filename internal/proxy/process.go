@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stopTimeout is how long a process gets to exit after being asked to
+// before it is killed
+const stopTimeout = 5 * time.Second
+
+// readPIDFile returns the PID stored in pidFile, or 0 if there is none
+func readPIDFile(pidFile string) int {
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
+
+// BackgroundRunning returns the PID recorded in pidFile and whether it is alive
+func BackgroundRunning(pidFile string) (int, bool) {
+	pid := readPIDFile(pidFile)
+	return pid, processAlive(pid)
+}
+
+// StartBackground starts a detached process with output appended to logFile
+// and records its PID in pidFile
+func StartBackground(name string, args []string, logFile, pidFile string) (int, error) {
+	logHandle, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create log file: %w", err)
+	}
+	// The child keeps its own copy of the handle
+	defer logHandle.Close()
+
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = logHandle
+	cmd.Stderr = logHandle
+	cmd.SysProcAttr = detachedAttr()
+
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("failed to start %s: %w", name, err)
+	}
+
+	pid := cmd.Process.Pid
+	if err := os.WriteFile(pidFile, []byte(strconv.Itoa(pid)), 0644); err != nil {
+		return pid, fmt.Errorf("failed to write PID file: %w", err)
+	}
+
+	// Don't wait on the child; release it so it outlives this process
+	cmd.Process.Release()
+
+	return pid, nil
+}
+
+// StopBackground stops the process recorded in pidFile, killing it if it
+// doesn't exit within stopTimeout, and removes the file
+func StopBackground(pidFile string) error {
+	pid, alive := BackgroundRunning(pidFile)
+	defer os.Remove(pidFile)
+
+	if !alive {
+		return nil
+	}
+
+	if err := terminate(pid, stopTimeout); err != nil {
+		return fmt.Errorf("failed to stop process %d: %w", pid, err)
+	}
+
+	return nil
+}
+
+// waitExit waits up to timeout for the process to exit, reporting whether it did
+func waitExit(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for reap(pid); processAlive(pid); reap(pid) {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return true
+}
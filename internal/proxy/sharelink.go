@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// ShareLink encodes the node as a share link that other clients (e.g. mobile apps) can import
+func (n *Node) ShareLink() (string, error) {
+	hostPort := fmt.Sprintf("%s:%d", n.Server, n.Port)
+	fragment := "#" + url.PathEscape(n.Name)
+
+	switch n.Type {
+	case "vmess":
+		network := n.Network
+		if network == "" {
+			network = "tcp"
+		}
+		data, err := json.Marshal(map[string]string{
+			"v":    "2",
+			"ps":   n.Name,
+			"add":  n.Server,
+			"port": strconv.Itoa(n.Port),
+			"id":   n.UUID,
+			"aid":  "0",
+			"net":  network,
+			"type": "none",
+			"tls":  n.TLS,
+			"sni":  n.SNI,
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to encode vmess node: %w", err)
+		}
+		return "vmess://" + base64.StdEncoding.EncodeToString(data), nil
+	case "vless":
+		query := url.Values{}
+		query.Set("encryption", "none")
+		if n.Network != "" {
+			query.Set("type", n.Network)
+		}
+		if n.Security != "" {
+			query.Set("security", n.Security)
+		}
+		if n.SNI != "" {
+			query.Set("sni", n.SNI)
+		}
+		if n.Flow != "" {
+			query.Set("flow", n.Flow)
+		}
+		if n.Fingerprint != "" {
+			query.Set("fp", n.Fingerprint)
+		}
+		if n.PublicKey != "" {
+			query.Set("pbk", n.PublicKey)
+		}
+		if n.ShortID != "" {
+			query.Set("sid", n.ShortID)
+		}
+		if n.SpiderX != "" {
+			query.Set("spx", n.SpiderX)
+		}
+		return fmt.Sprintf("vless://%s@%s?%s%s", n.UUID, hostPort, query.Encode(), fragment), nil
+	case "trojan":
+		query := ""
+		if n.SNI != "" {
+			query = "?sni=" + url.QueryEscape(n.SNI)
+		}
+		return fmt.Sprintf("trojan://%s@%s%s%s", url.PathEscape(n.Password), hostPort, query, fragment), nil
+	case "hysteria2":
+		query := url.Values{}
+		if n.SNI != "" {
+			query.Set("sni", n.SNI)
+		}
+		if n.Insecure {
+			query.Set("insecure", "1")
+		}
+		if n.Obfs != "" {
+			query.Set("obfs", n.Obfs)
+			query.Set("obfs-password", n.ObfsPassword)
+		}
+		return fmt.Sprintf("hysteria2://%s@%s/?%s%s", url.User(n.Password).String(), hostPort, query.Encode(), fragment), nil
+	case "tuic":
+		query := url.Values{}
+		if n.SNI != "" {
+			query.Set("sni", n.SNI)
+		}
+		if n.ALPN != "" {
+			query.Set("alpn", n.ALPN)
+		}
+		if n.CongestionControl != "" {
+			query.Set("congestion_control", n.CongestionControl)
+		}
+		if n.Insecure {
+			query.Set("allow_insecure", "1")
+		}
+		userinfo := url.UserPassword(n.UUID, n.Password).String()
+		return fmt.Sprintf("tuic://%s@%s?%s%s", userinfo, hostPort, query.Encode(), fragment), nil
+	case "ss", "shadowsocks":
+		credentials := base64.URLEncoding.EncodeToString([]byte(n.Security + ":" + n.Password))
+		return fmt.Sprintf("ss://%s@%s%s", credentials, hostPort, fragment), nil
+	default:
+		return "", fmt.Errorf("cannot create share link for node type: %s", n.Type)
+	}
+}
+
+// QRCode renders content as a QR code using Unicode half blocks for terminals
+func QRCode(content string) (string, error) {
+	code, err := qrcode.New(content, qrcode.Low)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate QR code: %w", err)
+	}
+	return code.ToSmallString(false), nil
+}
@@ -0,0 +1,379 @@
+package proxy
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/boomyao/crosh/internal/hint"
+	"github.com/boomyao/crosh/internal/httpclient"
+	"github.com/boomyao/crosh/internal/retry"
+	"github.com/boomyao/crosh/internal/sysenv"
+)
+
+// singBoxReleaseAPI is the GitHub API endpoint for the latest sing-box release
+const singBoxReleaseAPI = "https://api.github.com/repos/SagerNet/sing-box/releases/latest"
+
+// singBoxRuleSetURL is where the geoip/geosite rule sets for direct routing come from
+const singBoxRuleSetURL = "https://raw.githubusercontent.com/SagerNet/sing-%s/rule-set/%s.srs"
+
+// NeedsSingBox checks if a node uses a protocol Xray-core can't handle
+func NeedsSingBox(node *Node) bool {
+	return node.Type == "hysteria2" || node.Type == "tuic"
+}
+
+// SingBoxPath returns the path of the sing-box binary, kept next to Xray-core
+func (x *XrayManager) SingBoxPath() string {
+	name := "sing-box"
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return filepath.Join(filepath.Dir(x.xrayPath), name)
+}
+
+// EnsureSingBox downloads sing-box if any of the nodes needs it
+func (x *XrayManager) EnsureSingBox(nodes []Node) error {
+	for i := range nodes {
+		if NeedsSingBox(&nodes[i]) {
+			return x.DownloadSingBox()
+		}
+	}
+	return nil
+}
+
+// DownloadSingBox downloads the sing-box binary used for hysteria2 and TUIC nodes
+func (x *XrayManager) DownloadSingBox() error {
+	if _, err := os.Stat(x.SingBoxPath()); err == nil {
+		return nil
+	}
+
+	fmt.Fprintln(x.output(), "Downloading sing-box (needed for hysteria2/TUIC nodes)...")
+
+	// The release API is also where the checksums come from, so there is no
+	// falling back to a default version without it
+	version, digests, err := latestSingBoxRelease(x.context())
+	if err != nil {
+		return hint.Errorf(verifyHint, "failed to get the latest sing-box release: %w", err)
+	}
+
+	archive := singBoxAssetName(version)
+	checksum, ok := digests[archive]
+	if !ok {
+		return hint.Errorf(verifyHint, "sing-box %s publishes no sha256 for %s", version, archive)
+	}
+	downloadURL := fmt.Sprintf("https://github.com/SagerNet/sing-box/releases/download/%s/%s", version, archive)
+
+	// An interrupted download is kept and resumed by the next attempt
+	tmpArchive := x.SingBoxPath() + ".archive.part"
+	err = retry.Do(x.context(), "sing-box download", func() error {
+		return httpclient.DownloadTo(x.context(), downloadURL, tmpArchive, "sing-box")
+	})
+	if err != nil {
+		return fmt.Errorf("failed to download sing-box: %w", err)
+	}
+	defer os.Remove(tmpArchive)
+	if err := verifyFile(tmpArchive, checksum); err != nil {
+		return fmt.Errorf("failed to verify sing-box: %w", err)
+	}
+
+	if strings.HasSuffix(archive, ".zip") {
+		err = x.extractSingBoxFromZip(tmpArchive)
+	} else {
+		err = x.extractSingBoxFromTarGz(tmpArchive)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to extract sing-box: %w", err)
+	}
+
+	fmt.Fprintf(x.output(), "✓ sing-box %s downloaded successfully\n", version)
+	return nil
+}
+
+// latestSingBoxRelease fetches the tag of the latest sing-box release and
+// the sha256 GitHub records for each of its assets
+func latestSingBoxRelease(ctx context.Context) (string, map[string]string, error) {
+	resp, err := httpclient.Get(ctx, httpclient.Client(), singBoxReleaseAPI)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("API returned status %d", resp.StatusCode)
+	}
+
+	var release struct {
+		TagName string `json:"tag_name"`
+		Assets  []struct {
+			Name   string `json:"name"`
+			Digest string `json:"digest"`
+		} `json:"assets"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return "", nil, err
+	}
+
+	digests := make(map[string]string)
+	for _, asset := range release.Assets {
+		if sum, ok := strings.CutPrefix(asset.Digest, "sha256:"); ok {
+			if sum, err := validChecksum(sum); err == nil {
+				digests[asset.Name] = sum
+			}
+		}
+	}
+	return release.TagName, digests, nil
+}
+
+// singBoxAssetName returns the release archive name for this platform,
+// e.g. sing-box-1.10.7-linux-amd64.tar.gz
+func singBoxAssetName(version string) string {
+	ext := ".tar.gz"
+	if runtime.GOOS == "windows" {
+		ext = ".zip"
+	}
+	return fmt.Sprintf("sing-box-%s-%s-%s%s", strings.TrimPrefix(version, "v"), runtime.GOOS, sysenv.Arch(), ext)
+}
+
+// extractSingBoxFromTarGz extracts the sing-box binary from a .tar.gz archive
+func (x *XrayManager) extractSingBoxFromTarGz(archivePath string) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return fmt.Errorf("sing-box binary not found in archive")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+		if header.Typeflag == tar.TypeReg && filepath.Base(header.Name) == "sing-box" {
+			return x.installSingBox(tr)
+		}
+	}
+}
+
+// extractSingBoxFromZip extracts the sing-box binary from a .zip archive
+func (x *XrayManager) extractSingBoxFromZip(archivePath string) error {
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open zip: %w", err)
+	}
+	defer reader.Close()
+
+	for _, file := range reader.File {
+		name := filepath.Base(file.Name)
+		if name != "sing-box" && name != "sing-box.exe" {
+			continue
+		}
+		src, err := file.Open()
+		if err != nil {
+			return fmt.Errorf("failed to open file in zip: %w", err)
+		}
+		defer src.Close()
+		return x.installSingBox(src)
+	}
+
+	return fmt.Errorf("sing-box binary not found in zip")
+}
+
+// installSingBox writes the binary from src into place
+func (x *XrayManager) installSingBox(src io.Reader) error {
+	tmpFile := x.SingBoxPath() + ".tmp"
+	dst, err := os.OpenFile(tmpFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create destination file: %w", err)
+	}
+
+	_, err = io.Copy(dst, src)
+	dst.Close()
+	if err != nil {
+		os.Remove(tmpFile)
+		return fmt.Errorf("failed to copy file: %w", err)
+	}
+
+	if err := os.Rename(tmpFile, x.SingBoxPath()); err != nil {
+		os.Remove(tmpFile)
+		return fmt.Errorf("failed to move to final location: %w", err)
+	}
+
+	return nil
+}
+
+// generateSingBoxConfig generates a sing-box configuration for hysteria2 and
+// TUIC nodes with the same local inbounds and China-direct routing as Xray
+func (x *XrayManager) generateSingBoxConfig(node *Node) (map[string]interface{}, error) {
+	outbound, err := singBoxOutbound(node)
+	if err != nil {
+		return nil, err
+	}
+
+	if !x.UDPEnabled(node) {
+		outbound["network"] = "tcp"
+	}
+
+	level := x.logLevel
+	if level == "" || level == "warning" {
+		level = "warn"
+	}
+
+	config := map[string]interface{}{
+		"log": map[string]interface{}{
+			"level":     level,
+			"timestamp": true,
+		},
+		"inbounds": []map[string]interface{}{
+			{
+				"type":        "socks",
+				"tag":         "socks-in",
+				"listen":      x.listenAddress(),
+				"listen_port": x.localPort,
+				"sniff":       true,
+			},
+			{
+				"type":        "http",
+				"tag":         "http-in",
+				"listen":      x.listenAddress(),
+				"listen_port": x.HTTPPort(),
+				"sniff":       true,
+			},
+		},
+		"outbounds": []map[string]interface{}{
+			outbound,
+			{"type": "direct", "tag": "direct"},
+		},
+		"route": map[string]interface{}{
+			"rules": append(x.generateSingBoxBypassRules(), []map[string]interface{}{
+				{"ip_is_private": true, "outbound": "direct"},
+				{"rule_set": []string{"geoip-cn", "geosite-cn"}, "outbound": "direct"},
+			}...),
+			"rule_set": []map[string]interface{}{
+				singBoxRuleSet("geoip", "geoip-cn"),
+				singBoxRuleSet("geosite", "geosite-cn"),
+			},
+			"final": "proxy",
+		},
+		"experimental": map[string]interface{}{
+			// Cache downloaded rule sets across restarts
+			"cache_file": map[string]interface{}{
+				"enabled": true,
+				"path":    filepath.Join(filepath.Dir(x.xrayPath), "sing-box.db"),
+			},
+		},
+	}
+
+	if dns := x.generateSingBoxDNS(); dns != nil {
+		config["dns"] = dns
+	}
+
+	return config, nil
+}
+
+// singBoxRuleSet describes a remote rule set fetched through the proxy,
+// since raw.githubusercontent.com is often unreachable directly
+func singBoxRuleSet(kind, tag string) map[string]interface{} {
+	return map[string]interface{}{
+		"tag":             tag,
+		"type":            "remote",
+		"format":          "binary",
+		"url":             fmt.Sprintf(singBoxRuleSetURL, kind, tag),
+		"download_detour": "proxy",
+	}
+}
+
+// generateSingBoxDNS converts the DoH settings into sing-box's DNS section
+func (x *XrayManager) generateSingBoxDNS() map[string]interface{} {
+	if !x.dns.Enabled || len(x.dns.Remote) == 0 {
+		return nil
+	}
+
+	servers := []map[string]interface{}{
+		{"tag": "remote", "address": x.dns.Remote[0], "detour": "proxy"},
+	}
+	var rules []map[string]interface{}
+	if len(x.dns.Domestic) > 0 {
+		servers = append(servers, map[string]interface{}{
+			"tag": "domestic", "address": x.dns.Domestic[0], "detour": "direct",
+		})
+		rules = append(rules, map[string]interface{}{
+			"rule_set": []string{"geosite-cn"}, "server": "domestic",
+		})
+	}
+
+	return map[string]interface{}{
+		"servers": servers,
+		"rules":   rules,
+		"final":   "remote",
+	}
+}
+
+// singBoxOutbound generates the proxy outbound for a hysteria2 or TUIC node
+func singBoxOutbound(node *Node) (map[string]interface{}, error) {
+	sni := node.SNI
+	if sni == "" {
+		sni = node.Server
+	}
+
+	tls := map[string]interface{}{
+		"enabled":     true,
+		"server_name": sni,
+		"insecure":    node.Insecure,
+	}
+	if node.ALPN != "" {
+		tls["alpn"] = strings.Split(node.ALPN, ",")
+	}
+
+	outbound := map[string]interface{}{
+		"tag":         "proxy",
+		"type":        node.Type,
+		"server":      node.Server,
+		"server_port": node.Port,
+		"tls":         tls,
+	}
+
+	switch node.Type {
+	case "hysteria2":
+		outbound["password"] = node.Password
+		if node.Obfs != "" {
+			outbound["obfs"] = map[string]interface{}{
+				"type":     node.Obfs,
+				"password": node.ObfsPassword,
+			}
+		}
+	case "tuic":
+		if node.ALPN == "" {
+			tls["alpn"] = []string{"h3"}
+		}
+		congestion := node.CongestionControl
+		if congestion == "" {
+			congestion = "bbr"
+		}
+		outbound["uuid"] = node.UUID
+		outbound["password"] = node.Password
+		outbound["congestion_control"] = congestion
+		outbound["udp_relay_mode"] = "native"
+	default:
+		return nil, fmt.Errorf("unsupported sing-box node type: %s", node.Type)
+	}
+
+	return outbound, nil
+}
@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Traffic holds bytes sent and received through the proxy outbound since Xray started
+type Traffic struct {
+	Uplink   int64 `json:"uplink"`
+	Downlink int64 `json:"downlink"`
+}
+
+// SetStatsPort sets the local port of Xray's stats API (0 disables it)
+func (x *XrayManager) SetStatsPort(port int) {
+	x.statsPort = port
+}
+
+// applyStatsConfig enables Xray's stats API on 127.0.0.1 so traffic counters
+// can be queried with "xray api statsquery"
+func (x *XrayManager) applyStatsConfig(config map[string]interface{}) {
+	if x.statsPort <= 0 {
+		return
+	}
+
+	config["stats"] = map[string]interface{}{}
+	config["api"] = map[string]interface{}{
+		"tag":      "api",
+		"services": []string{"StatsService"},
+	}
+	config["policy"] = map[string]interface{}{
+		"system": map[string]interface{}{
+			"statsOutboundUplink":   true,
+			"statsOutboundDownlink": true,
+		},
+	}
+
+	config["inbounds"] = append(config["inbounds"].([]map[string]interface{}), map[string]interface{}{
+		"tag":      "api",
+		"port":     x.statsPort,
+		"listen":   "127.0.0.1",
+		"protocol": "dokodemo-door",
+		"settings": map[string]interface{}{
+			"address": "127.0.0.1",
+		},
+	})
+
+	// The API rule must come before everything else
+	routing := config["routing"].(map[string]interface{})
+	routing["rules"] = append([]map[string]interface{}{
+		{
+			"type":        "field",
+			"inboundTag":  []string{"api"},
+			"outboundTag": "api",
+		},
+	}, routing["rules"].([]map[string]interface{})...)
+}
+
+// TrafficStats queries the running Xray for proxy outbound traffic
+func (x *XrayManager) TrafficStats() (Traffic, error) {
+	var traffic Traffic
+	if x.statsPort <= 0 {
+		return traffic, fmt.Errorf("traffic stats are disabled")
+	}
+	if !x.IsRunning() {
+		return traffic, fmt.Errorf("proxy is not running")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, x.xrayPath, "api", "statsquery",
+		fmt.Sprintf("--server=127.0.0.1:%d", x.statsPort), "-pattern", "outbound>>>proxy>>>").Output()
+	if err != nil {
+		return traffic, fmt.Errorf("failed to query traffic stats: %w", err)
+	}
+
+	var result struct {
+		Stat []struct {
+			Name  string `json:"name"`
+			Value int64  `json:"value"`
+		} `json:"stat"`
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		return traffic, fmt.Errorf("failed to parse traffic stats: %w", err)
+	}
+
+	for _, stat := range result.Stat {
+		switch {
+		case strings.HasSuffix(stat.Name, ">>>uplink"):
+			traffic.Uplink = stat.Value
+		case strings.HasSuffix(stat.Name, ">>>downlink"):
+			traffic.Downlink = stat.Value
+		}
+	}
+
+	return traffic, nil
+}
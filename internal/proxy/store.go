@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/boomyao/crosh/internal/errs"
+)
+
+// NodeSourceManual marks nodes added by hand rather than from a subscription
+const NodeSourceManual = "manual"
+
+// NodeStore holds standalone nodes added outside any subscription
+type NodeStore struct {
+	path  string
+	Nodes []Node `json:"nodes"`
+}
+
+// LoadNodeStore reads the node store at path, returning an empty store if it doesn't exist
+func LoadNodeStore(path string) (*NodeStore, error) {
+	store := &NodeStore{path: path}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return store, nil
+		}
+		return nil, fmt.Errorf("failed to read node store: %w", err)
+	}
+
+	if err := json.Unmarshal(data, store); err != nil {
+		return nil, errs.Errorf(errs.ErrParse, "failed to parse node store: %w", err)
+	}
+
+	return store, nil
+}
+
+// Add stores a node, replacing any node with the same name.
+// It returns true if an existing node was replaced.
+func (s *NodeStore) Add(node Node) bool {
+	if node.Name == "" {
+		node.Name = fmt.Sprintf("%s:%d", node.Server, node.Port)
+	}
+	node.Latency = 0
+	node.Source = NodeSourceManual
+
+	for i := range s.Nodes {
+		if s.Nodes[i].Name == node.Name {
+			s.Nodes[i] = node
+			return true
+		}
+	}
+
+	s.Nodes = append(s.Nodes, node)
+	return false
+}
+
+// Remove deletes the named node, returning false if it wasn't found
+func (s *NodeStore) Remove(name string) bool {
+	for i := range s.Nodes {
+		if s.Nodes[i].Name == name {
+			s.Nodes = append(s.Nodes[:i], s.Nodes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Find returns the named node, or nil
+func (s *NodeStore) Find(name string) *Node {
+	for i := range s.Nodes {
+		if s.Nodes[i].Name == name {
+			return &s.Nodes[i]
+		}
+	}
+	return nil
+}
+
+// Save writes the node store to disk. Nodes contain credentials, so the
+// file is only readable by the current user.
+func (s *NodeStore) Save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal node store: %w", err)
+	}
+
+	if err := os.WriteFile(s.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write node store: %w", err)
+	}
+
+	return nil
+}
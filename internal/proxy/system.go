@@ -0,0 +1,280 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/boomyao/crosh/internal/hint"
+)
+
+// internetSettingsKey holds the WinINET proxy settings of the current user,
+// which browsers and most Windows apps follow
+const internetSettingsKey = `HKCU\Software\Microsoft\Windows\CurrentVersion\Internet Settings`
+
+// SystemProxy handles the Windows system proxy: the WinINET settings in the
+// registry and, optionally, the machine-wide WinHTTP proxy that services and
+// tools such as PowerShell's Invoke-WebRequest use
+type SystemProxy struct {
+	server   string // host:port of the local HTTP inbound
+	winHTTP  bool
+	stateDir string
+}
+
+// NewSystemProxy creates a new system proxy handler. The settings it replaces
+// are saved in stateDir and put back by Disable.
+func NewSystemProxy(server string, winHTTP bool, stateDir string) *SystemProxy {
+	return &SystemProxy{
+		server:   server,
+		winHTTP:  winHTTP,
+		stateDir: stateDir,
+	}
+}
+
+// savedSystemProxy is the system proxy configuration from before Enable. An
+// empty value didn't exist in the registry.
+type savedSystemProxy struct {
+	ProxyEnable   string `json:"proxy_enable,omitempty"`
+	ProxyServer   string `json:"proxy_server,omitempty"`
+	ProxyOverride string `json:"proxy_override,omitempty"`
+	WinHTTP       bool   `json:"winhttp,omitempty"`        // WinHTTP was changed too
+	WinHTTPServer string `json:"winhttp_server,omitempty"` // empty for direct access
+	WinHTTPBypass string `json:"winhttp_bypass,omitempty"`
+}
+
+// savedPath returns the file holding the replaced settings
+func (s *SystemProxy) savedPath() string {
+	return filepath.Join(s.stateDir, "system-proxy.json")
+}
+
+// ConfigFiles returns the file Enable and Disable write; the registry has no path
+func (s *SystemProxy) ConfigFiles() []string {
+	return []string{s.savedPath()}
+}
+
+// Enable points the WinINET proxy (and WinHTTP if asked) at the local proxy
+func (s *SystemProxy) Enable() error {
+	if runtime.GOOS != "windows" {
+		return fmt.Errorf("system proxy is only supported on Windows")
+	}
+
+	// Keep the settings from before the first Enable, not crosh's own
+	if _, err := os.Stat(s.savedPath()); os.IsNotExist(err) {
+		if err := s.save(); err != nil {
+			return err
+		}
+	}
+
+	if err := regSet("ProxyServer", "REG_SZ", s.server); err != nil {
+		return err
+	}
+	if err := regSet("ProxyOverride", "REG_SZ", systemProxyBypass()); err != nil {
+		return err
+	}
+	if err := regSet("ProxyEnable", "REG_DWORD", "1"); err != nil {
+		return err
+	}
+	refreshInternetSettings()
+
+	if s.winHTTP {
+		if err := netshWinHTTP("set", "proxy", "proxy-server="+s.server, "bypass-list="+systemProxyBypass()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Disable restores the settings Enable replaced
+func (s *SystemProxy) Disable() error {
+	if runtime.GOOS != "windows" {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.savedPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil // Nothing to disable
+		}
+		return fmt.Errorf("failed to read %s: %w", s.savedPath(), err)
+	}
+	var saved savedSystemProxy
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", s.savedPath(), err)
+	}
+
+	for _, value := range []struct{ name, typ, data string }{
+		{"ProxyEnable", "REG_DWORD", saved.ProxyEnable},
+		{"ProxyServer", "REG_SZ", saved.ProxyServer},
+		{"ProxyOverride", "REG_SZ", saved.ProxyOverride},
+	} {
+		if value.data == "" {
+			err = regDelete(value.name)
+		} else {
+			err = regSet(value.name, value.typ, value.data)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	refreshInternetSettings()
+
+	if saved.WinHTTP {
+		if saved.WinHTTPServer == "" {
+			err = netshWinHTTP("reset", "proxy")
+		} else {
+			args := []string{"set", "proxy", "proxy-server=" + saved.WinHTTPServer}
+			if saved.WinHTTPBypass != "" {
+				args = append(args, "bypass-list="+saved.WinHTTPBypass)
+			}
+			err = netshWinHTTP(args...)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := os.Remove(s.savedPath()); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", s.savedPath(), err)
+	}
+	return nil
+}
+
+// Status checks if the WinINET proxy points at the local proxy
+func (s *SystemProxy) Status() (bool, string, error) {
+	if runtime.GOOS != "windows" {
+		return false, "Windows only", nil
+	}
+
+	enable, _ := regQuery("ProxyEnable")
+	server, _ := regQuery("ProxyServer")
+	switch {
+	case enable != "0x1":
+		return false, "direct", nil
+	case server != s.server:
+		return false, "set to " + server, nil
+	}
+
+	detail := server
+	if s.winHTTP {
+		if winHTTPServer, _ := winHTTPProxy(); winHTTPServer == s.server {
+			detail += ", WinHTTP too"
+		}
+	}
+	return true, detail, nil
+}
+
+// save records the current settings before Enable replaces them
+func (s *SystemProxy) save() error {
+	var saved savedSystemProxy
+	saved.ProxyEnable, _ = regQuery("ProxyEnable")
+	saved.ProxyServer, _ = regQuery("ProxyServer")
+	saved.ProxyOverride, _ = regQuery("ProxyOverride")
+	if s.winHTTP {
+		saved.WinHTTP = true
+		saved.WinHTTPServer, saved.WinHTTPBypass = winHTTPProxy()
+	}
+
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode system proxy settings: %w", err)
+	}
+	if err := os.MkdirAll(s.stateDir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", s.stateDir, err)
+	}
+	if err := os.WriteFile(s.savedPath(), data, 0644); err != nil {
+		return fmt.Errorf("failed to save system proxy settings: %w", err)
+	}
+	return nil
+}
+
+// systemProxyBypass returns the WinINET bypass list: loopback, private
+// networks, plain host names (<local>) and the hosts in NO_PROXY
+func systemProxyBypass() string {
+	hosts := []string{"localhost", "127.*", "10.*", "192.168.*"}
+	for i := 16; i <= 31; i++ {
+		hosts = append(hosts, fmt.Sprintf("172.%d.*", i))
+	}
+	for _, host := range EnvNoProxy() {
+		switch {
+		case strings.Contains(host, "/"):
+			continue // WinINET has no CIDR ranges
+		case strings.HasPrefix(host, "."):
+			host = "*" + host
+		}
+		hosts = append(hosts, host)
+	}
+	return strings.Join(append(hosts, "<local>"), ";")
+}
+
+// regQuery returns a value under internetSettingsKey as reg prints it, e.g.
+// "0x1" for a DWORD, and false if it doesn't exist
+func regQuery(name string) (string, bool) {
+	out, err := exec.Command("reg", "query", internetSettingsKey, "/v", name).Output()
+	if err != nil {
+		return "", false
+	}
+	// "    ProxyServer    REG_SZ    127.0.0.1:7677"
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && strings.EqualFold(fields[0], name) {
+			return strings.Join(fields[2:], " "), true
+		}
+	}
+	return "", false
+}
+
+// regSet writes a value under internetSettingsKey
+func regSet(name, typ, data string) error {
+	if out, err := exec.Command("reg", "add", internetSettingsKey, "/v", name, "/t", typ, "/d", data, "/f").CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to set %s: %s", name, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// regDelete removes a value under internetSettingsKey if it exists
+func regDelete(name string) error {
+	if _, ok := regQuery(name); !ok {
+		return nil
+	}
+	if out, err := exec.Command("reg", "delete", internetSettingsKey, "/v", name, "/f").CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to remove %s: %s", name, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// winHTTPProxy returns the WinHTTP proxy server and bypass list, or empty
+// strings for direct access
+func winHTTPProxy() (server, bypass string) {
+	out, err := exec.Command("netsh", "winhttp", "show", "proxy").Output()
+	if err != nil {
+		return "", ""
+	}
+	// "    Proxy Server(s) :  127.0.0.1:7677"
+	// "    Bypass List     :  <local>"
+	for _, line := range strings.Split(string(out), "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "Proxy Server(s)":
+			server = strings.TrimSpace(value)
+		case "Bypass List":
+			bypass = strings.TrimSpace(value)
+		}
+	}
+	return server, bypass
+}
+
+// netshWinHTTP runs "netsh winhttp" with args, which needs an administrator prompt
+func netshWinHTTP(args ...string) error {
+	out, err := exec.Command("netsh", append([]string{"winhttp"}, args...)...).CombinedOutput()
+	if err != nil {
+		return hint.Errorf(hint.Sudo, "failed to change the WinHTTP proxy: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
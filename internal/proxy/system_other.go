@@ -0,0 +1,6 @@
+//go:build !windows
+
+package proxy
+
+// refreshInternetSettings does nothing outside Windows, which has no WinINET
+func refreshInternetSettings() {}
@@ -0,0 +1,20 @@
+//go:build windows
+
+package proxy
+
+import "syscall"
+
+// refreshInternetSettings tells running apps that the WinINET settings
+// changed, so browsers pick up the proxy without a restart
+func refreshInternetSettings() {
+	const (
+		internetOptionSettingsChanged = 39
+		internetOptionRefresh         = 37
+	)
+	setOption := syscall.NewLazyDLL("wininet.dll").NewProc("InternetSetOptionW")
+	if setOption.Find() != nil {
+		return
+	}
+	setOption.Call(0, internetOptionSettingsChanged, 0, 0)
+	setOption.Call(0, internetOptionRefresh, 0, 0)
+}
@@ -0,0 +1,46 @@
+package proxy
+
+// SetUDP sets whether UDP is relayed through the proxy, globally and for
+// nodes listed by name in disabledNodes
+func (x *XrayManager) SetUDP(enabled bool, disabledNodes []string) {
+	x.udp = enabled
+	x.udpDisabledNodes = disabledNodes
+}
+
+// UDPEnabled checks if UDP (QUIC, DNS, games, voice chat) is relayed for node
+func (x *XrayManager) UDPEnabled(node *Node) bool {
+	if !x.udp {
+		return false
+	}
+	for _, name := range x.udpDisabledNodes {
+		if name == node.Name {
+			return false
+		}
+	}
+	return true
+}
+
+// applyUDPConfig turns off UDP ASSOCIATE on the SOCKS inbound when UDP is
+// disabled for the node, so apps fall back to TCP instead of timing out
+// on a node that drops UDP
+func (x *XrayManager) applyUDPConfig(config map[string]interface{}, node *Node) {
+	if x.UDPEnabled(node) {
+		return
+	}
+	for _, inbound := range config["inbounds"].([]map[string]interface{}) {
+		if inbound["protocol"] == "socks" {
+			inbound["settings"] = map[string]interface{}{"udp": false}
+		}
+	}
+}
+
+// sniffingSettings recovers the domain of proxied connections (including
+// QUIC) for routing only, so geosite rules match without breaking apps that
+// connect to a specific IP
+func sniffingSettings() map[string]interface{} {
+	return map[string]interface{}{
+		"enabled":      true,
+		"destOverride": []string{"http", "tls", "quic"},
+		"routeOnly":    true,
+	}
+}
@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSingBoxConfigUDP(t *testing.T) {
+	hysteria2 := &Node{
+		Name:         "hk-hy2",
+		Type:         "hysteria2",
+		Server:       "hk.example.com",
+		Port:         443,
+		Password:     "secret",
+		Obfs:         "salamander",
+		ObfsPassword: "obfs-secret",
+	}
+	tuic := &Node{
+		Name:     "jp-tuic",
+		Type:     "tuic",
+		Server:   "jp.example.com",
+		Port:     8443,
+		UUID:     "2dd61d93-75d8-4da4-ac0e-6aece7eac365",
+		Password: "secret",
+		SNI:      "cdn.example.com",
+	}
+
+	tests := []struct {
+		name          string
+		node          *Node
+		udp           bool
+		disabledNodes []string
+		want          map[string]interface{} // outbound fields
+		wantTCPOnly   bool
+	}{
+		{
+			name: "hysteria2",
+			node: hysteria2,
+			udp:  true,
+			want: map[string]interface{}{
+				"type":        "hysteria2",
+				"server":      "hk.example.com",
+				"server_port": 443,
+				"password":    "secret",
+				"obfs":        map[string]interface{}{"type": "salamander", "password": "obfs-secret"},
+				"tls":         map[string]interface{}{"enabled": true, "server_name": "hk.example.com", "insecure": false},
+			},
+		},
+		{
+			name:        "hysteria2 with UDP off",
+			node:        hysteria2,
+			udp:         false,
+			want:        map[string]interface{}{"type": "hysteria2"},
+			wantTCPOnly: true,
+		},
+		{
+			name: "tuic",
+			node: tuic,
+			udp:  true,
+			want: map[string]interface{}{
+				"type":               "tuic",
+				"server":             "jp.example.com",
+				"server_port":        8443,
+				"uuid":               "2dd61d93-75d8-4da4-ac0e-6aece7eac365",
+				"password":           "secret",
+				"congestion_control": "bbr",
+				"udp_relay_mode":     "native",
+				"tls":                map[string]interface{}{"enabled": true, "server_name": "cdn.example.com", "insecure": false, "alpn": []string{"h3"}},
+			},
+		},
+		{
+			name:          "tuic with UDP off for the node",
+			node:          tuic,
+			udp:           true,
+			disabledNodes: []string{"jp-tuic"},
+			want:          map[string]interface{}{"type": "tuic", "udp_relay_mode": "native"},
+			wantTCPOnly:   true,
+		},
+		{
+			name:          "tuic with UDP off for another node",
+			node:          tuic,
+			udp:           true,
+			disabledNodes: []string{"hk-hy2"},
+			want:          map[string]interface{}{"type": "tuic"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x := NewXrayManager(filepath.Join(t.TempDir(), "xray"), 1080)
+			x.SetUDP(tt.udp, tt.disabledNodes)
+
+			config, err := x.buildConfig(tt.node)
+			if err != nil {
+				t.Fatalf("buildConfig: %v", err)
+			}
+
+			outbound := config["outbounds"].([]map[string]interface{})[0]
+			for key, want := range tt.want {
+				if got := outbound[key]; !reflect.DeepEqual(got, want) {
+					t.Errorf("outbound %s = %#v, want %#v", key, got, want)
+				}
+			}
+			if network, ok := outbound["network"]; tt.wantTCPOnly != ok || (ok && network != "tcp") {
+				t.Errorf("outbound network = %v, want TCP only: %v", network, tt.wantTCPOnly)
+			}
+
+			for _, inbound := range config["inbounds"].([]map[string]interface{}) {
+				if inbound["sniff"] != true {
+					t.Errorf("%s inbound doesn't sniff domains", inbound["tag"])
+				}
+			}
+		})
+	}
+}
+
+func TestXrayConfigUDP(t *testing.T) {
+	node := &Node{Name: "us-trojan", Type: "trojan", Server: "us.example.com", Port: 443, Password: "secret"}
+
+	tests := []struct {
+		name          string
+		udp           bool
+		disabledNodes []string
+		wantUDP       bool
+	}{
+		{name: "on", udp: true, wantUDP: true},
+		{name: "off", udp: false, wantUDP: false},
+		{name: "off for the node", udp: true, disabledNodes: []string{"us-trojan"}, wantUDP: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x := NewXrayManager(filepath.Join(t.TempDir(), "xray"), 1080)
+			x.SetUDP(tt.udp, tt.disabledNodes)
+
+			config, err := x.buildConfig(node)
+			if err != nil {
+				t.Fatalf("buildConfig: %v", err)
+			}
+			for _, inbound := range config["inbounds"].([]map[string]interface{}) {
+				if inbound["protocol"] == "socks" {
+					settings := inbound["settings"].(map[string]interface{})
+					if settings["udp"] != tt.wantUDP {
+						t.Errorf("socks udp = %v, want %v", settings["udp"], tt.wantUDP)
+					}
+				}
+				if inbound["sniffing"] == nil {
+					t.Errorf("%s inbound doesn't sniff domains", inbound["tag"])
+				}
+			}
+		})
+	}
+}
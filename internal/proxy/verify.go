@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/boomyao/crosh/internal/errs"
+	"github.com/boomyao/crosh/internal/hint"
+	"github.com/boomyao/crosh/internal/httpclient"
+	"github.com/boomyao/crosh/internal/retry"
+)
+
+// maxChecksumSize caps the size of a checksum file
+const maxChecksumSize = 64 << 10
+
+// verifyHint is shown when a download can't be verified
+const verifyHint = "check your network and try again; crosh won't install files it can't verify"
+
+// fetchChecksum downloads a checksum file and returns the sha256 in it for
+// name. It understands sha256sum output ("<hex>  name" or just "<hex>") and
+// Xray-core's .dgst files ("SHA2-256= <hex>").
+func fetchChecksum(ctx context.Context, url, name string) (string, error) {
+	resp, err := httpclient.Get(ctx, httpclient.Client(), url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", httpclient.StatusError(resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxChecksumSize))
+	if err != nil {
+		return "", err
+	}
+	checksum, err := parseChecksum(string(data), name)
+	return checksum, retry.Permanent(err)
+}
+
+// parseChecksum finds the sha256 for name in a checksum file
+func parseChecksum(data, name string) (string, error) {
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if rest, ok := strings.CutPrefix(line, "SHA2-256="); ok {
+			return validChecksum(strings.TrimSpace(rest))
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 1:
+			return validChecksum(fields[0])
+		case len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name:
+			return validChecksum(fields[0])
+		}
+	}
+	return "", errs.Errorf(errs.ErrParse, "no sha256 for %s", name)
+}
+
+// validChecksum checks that sum looks like a sha256 and lowercases it
+func validChecksum(sum string) (string, error) {
+	sum = strings.ToLower(sum)
+	if _, err := hex.DecodeString(sum); err != nil || len(sum) != sha256.Size*2 {
+		return "", errs.Errorf(errs.ErrParse, "malformed sha256 %q", sum)
+	}
+	return sum, nil
+}
+
+// verifyFile checks the sha256 of the file at path
+func verifyFile(path, expected string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != expected {
+		return hint.Errorf(verifyHint, "checksum mismatch: expected %s, got %s", expected, got)
+	}
+	return nil
+}
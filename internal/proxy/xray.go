@@ -2,9 +2,12 @@ package proxy
 
 import (
 	"archive/zip"
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
@@ -12,6 +15,13 @@ import (
 	"runtime"
 	"strings"
 	"time"
+
+	"github.com/boomyao/crosh/internal/errs"
+	"github.com/boomyao/crosh/internal/hint"
+	"github.com/boomyao/crosh/internal/httpclient"
+	"github.com/boomyao/crosh/internal/logging"
+	"github.com/boomyao/crosh/internal/retry"
+	"github.com/boomyao/crosh/internal/sysenv"
 )
 
 // XraySource represents a download source with both API and download URLs
@@ -35,20 +45,48 @@ var xraySources = []XraySource{
 	},
 }
 
+// NoProxy lists the hosts that should always bypass the proxy
+const NoProxy = "localhost,127.0.0.1,::1"
+
+// Hints for a proxy that can't start yet
+const (
+	downloadHint = "run \"crosh on\" to download it"
+	noNodeHint   = "run \"crosh <subscription-url>\" or \"crosh proxy add <share-link>\" to add nodes"
+)
+
 // XrayManager manages Xray-core process
 type XrayManager struct {
-	xrayPath   string
-	configPath string
-	cmd        *exec.Cmd
-	localPort  int
+	xrayPath    string
+	configPath  string
+	stateDir    string
+	cmd         *exec.Cmd
+	exited      chan struct{} // closed once cmd has exited and been reaped
+	localPort   int
+	httpPort    int
+	allowLAN    bool
+	logLevel    string
+	latencyTest LatencyTest
+	dns         DNSSettings
+	bypass      []string
+	statsPort   int
+
+	udp              bool
+	udpDisabledNodes []string
+	overrides        []NodeOverride
+
+	ctx context.Context
+	out io.Writer
 }
 
 // NewXrayManager creates a new Xray manager
 func NewXrayManager(xrayPath string, localPort int) *XrayManager {
 	return &XrayManager{
-		xrayPath:   xrayPath,
-		configPath: filepath.Join(filepath.Dir(xrayPath), "config.json"),
-		localPort:  localPort,
+		xrayPath:    xrayPath,
+		configPath:  filepath.Join(filepath.Dir(xrayPath), "config.json"),
+		stateDir:    filepath.Dir(xrayPath),
+		localPort:   localPort,
+		latencyTest: DefaultLatencyTest(),
+		udp:         true,
 	}
 }
 
@@ -56,9 +94,9 @@ func NewXrayManager(xrayPath string, localPort int) *XrayManager {
 func (x *XrayManager) Download() error {
 	// Check if already exists
 	if _, err := os.Stat(x.xrayPath); err == nil {
-		fmt.Println("Xray-core already exists, skipping download")
+		fmt.Fprintln(x.output(), "Xray-core already exists, skipping download")
 	} else {
-		fmt.Println("Downloading Xray-core...")
+		fmt.Fprintln(x.output(), "Downloading Xray-core...")
 
 		// Create directory
 		if err := os.MkdirAll(filepath.Dir(x.xrayPath), 0755); err != nil {
@@ -67,101 +105,140 @@ func (x *XrayManager) Download() error {
 
 		// Get latest release info
 		version, assetName, err := x.getLatestReleaseInfo()
+		if err := x.context().Err(); err != nil {
+			return err
+		}
 		if err != nil {
-			fmt.Printf("Warning: failed to get latest release info: %v\n", err)
-			fmt.Println("Falling back to default version v1.8.4")
+			logging.Warn("failed to get latest release info", "error", err)
+			fmt.Fprintln(x.output(), "Falling back to default version v1.8.4")
 			version = "v1.8.4"
 			assetName = x.getDefaultAssetName()
 		}
 
-		fmt.Printf("Downloading Xray-core version %s...\n", version)
+		fmt.Fprintf(x.output(), "Downloading Xray-core version %s...\n", version)
+
+		checksum, err := xrayChecksum(x.context(), version, assetName)
+		if err != nil {
+			return hint.Errorf(verifyHint, "failed to get the checksum of %s: %w", assetName, err)
+		}
 
 		// Try multiple download sources
 		var lastErr error
 		for i, source := range xraySources {
 			downloadURL := fmt.Sprintf("%s/%s/%s", source.DownloadURL, version, assetName)
-			fmt.Printf("Trying source %d/%d: %s\n", i+1, len(xraySources), source.Name)
+			fmt.Fprintf(x.output(), "Trying source %d/%d: %s\n", i+1, len(xraySources), source.Name)
 
-			err := x.downloadFromURL(downloadURL)
+			err := retry.Do(x.context(), "Xray-core download", func() error {
+				return x.downloadFromURL(downloadURL, checksum)
+			})
 			if err == nil {
-				fmt.Println("✓ Xray-core downloaded successfully")
+				fmt.Fprintln(x.output(), "✓ Xray-core downloaded successfully")
+				lastErr = nil
 				break
 			}
 
-			fmt.Printf("✗ Failed: %v\n", err)
+			fmt.Fprintf(x.output(), "✗ Failed: %v\n", err)
 			lastErr = err
+			if x.context().Err() != nil {
+				return x.context().Err()
+			}
 		}
 
 		if lastErr != nil {
-			return fmt.Errorf("failed to download from all sources: %w", lastErr)
+			return hint.Errorf("check your network, or download Xray-core yourself and point proxy.xray_path at it", "failed to download from all sources: %w", lastErr)
 		}
 	}
 
 	// Download geoip and geosite data files
-	fmt.Println("Downloading geoip and geosite data files...")
-	if err := x.downloadGeoData(); err != nil {
-		fmt.Printf("Warning: failed to download geo data: %v\n", err)
-		fmt.Println("Routing rules may not work properly without geo data files")
+	fmt.Fprintln(x.output(), "Downloading geoip and geosite data files...")
+	if err := x.downloadGeoData(false); err != nil {
+		logging.Warn("failed to download geo data", "error", err)
+		fmt.Fprintln(x.output(), "Routing rules may not work properly without geo data files")
 	}
 
 	return nil
 }
 
-// downloadGeoData downloads geoip.dat and geosite.dat files
-func (x *XrayManager) downloadGeoData() error {
-	dataDir := filepath.Dir(x.xrayPath)
+// GeoDataMaxAge is how old geoip.dat/geosite.dat may get before they are refreshed
+const GeoDataMaxAge = 30 * 24 * time.Hour
 
-	// Geo data file sources (Cloudflare CDN first for best China access)
-	geoFiles := []struct {
-		name     string
-		sources  []string
-		filename string
-	}{
-		{
-			name:     "geoip.dat",
-			filename: "geoip.dat",
-			sources: []string{
-				"https://crosh.boomyao.com/xray/geoip.dat",
-				"https://github.com/Loyalsoldier/v2ray-rules-dat/releases/latest/download/geoip.dat",
-			},
+// geoDataFiles lists the geo data files and their sources (Cloudflare CDN
+// first for best China access)
+var geoDataFiles = []struct {
+	name     string
+	sources  []string
+	filename string
+}{
+	{
+		name:     "geoip.dat",
+		filename: "geoip.dat",
+		sources: []string{
+			"https://crosh.boomyao.com/xray/geoip.dat",
+			"https://github.com/Loyalsoldier/v2ray-rules-dat/releases/latest/download/geoip.dat",
 		},
-		{
-			name:     "geosite.dat",
-			filename: "geosite.dat",
-			sources: []string{
-				"https://crosh.boomyao.com/xray/geosite.dat",
-				"https://github.com/Loyalsoldier/v2ray-rules-dat/releases/latest/download/geosite.dat",
-			},
+	},
+	{
+		name:     "geosite.dat",
+		filename: "geosite.dat",
+		sources: []string{
+			"https://crosh.boomyao.com/xray/geosite.dat",
+			"https://github.com/Loyalsoldier/v2ray-rules-dat/releases/latest/download/geosite.dat",
 		},
-	}
+	},
+}
+
+// downloadGeoData downloads geoip.dat and geosite.dat files. Existing files
+// are kept unless force is set or they are older than GeoDataMaxAge.
+func (x *XrayManager) downloadGeoData(force bool) error {
+	dataDir := filepath.Dir(x.xrayPath)
 
-	for _, geoFile := range geoFiles {
+	for _, geoFile := range geoDataFiles {
 		targetPath := filepath.Join(dataDir, geoFile.filename)
 
-		// Skip if file already exists
-		if _, err := os.Stat(targetPath); err == nil {
-			fmt.Printf("✓ %s already exists\n", geoFile.name)
-			continue
+		// Skip if file already exists and is fresh
+		info, statErr := os.Stat(targetPath)
+		exists := statErr == nil
+		if exists && !force {
+			if time.Since(info.ModTime()) < GeoDataMaxAge {
+				fmt.Fprintf(x.output(), "✓ %s already exists\n", geoFile.name)
+				continue
+			}
+			fmt.Fprintf(x.output(), "%s is %d days old, updating...\n", geoFile.name, int(time.Since(info.ModTime()).Hours()/24))
 		}
 
-		fmt.Printf("Downloading %s...\n", geoFile.name)
+		fmt.Fprintf(x.output(), "Downloading %s...\n", geoFile.name)
 
-		// Try multiple sources
+		// Try multiple sources, each with the checksum it publishes
 		var lastErr error
 		for i, source := range geoFile.sources {
-			fmt.Printf("  Trying source %d/%d...\n", i+1, len(geoFile.sources))
+			fmt.Fprintf(x.output(), "  Trying source %d/%d...\n", i+1, len(geoFile.sources))
 
-			err := x.downloadGeoFile(source, targetPath)
+			err := retry.Do(x.context(), "geodata download", func() error {
+				checksum, err := fetchChecksum(x.context(), source+".sha256sum", geoFile.filename)
+				if err != nil {
+					return fmt.Errorf("failed to get checksum: %w", err)
+				}
+				return x.downloadGeoFile(source, targetPath, checksum)
+			})
 			if err == nil {
-				fmt.Printf("✓ %s downloaded successfully\n", geoFile.name)
+				fmt.Fprintf(x.output(), "✓ %s downloaded successfully\n", geoFile.name)
+				lastErr = nil
 				break
 			}
 
-			fmt.Printf("  ✗ Failed: %v\n", err)
+			fmt.Fprintf(x.output(), "  ✗ Failed: %v\n", err)
 			lastErr = err
+			if x.context().Err() != nil {
+				return x.context().Err()
+			}
 		}
 
 		if lastErr != nil {
+			// An outdated file still routes most traffic correctly
+			if exists && !force {
+				fmt.Fprintf(x.output(), "⚠ Keeping outdated %s: %v\n", geoFile.name, lastErr)
+				continue
+			}
 			return fmt.Errorf("failed to download %s: %w", geoFile.name, lastErr)
 		}
 	}
@@ -169,35 +246,54 @@ func (x *XrayManager) downloadGeoData() error {
 	return nil
 }
 
-// downloadGeoFile downloads a single geo data file
-func (x *XrayManager) downloadGeoFile(url, targetPath string) error {
-	client := &http.Client{
-		Timeout: 3 * time.Minute,
+// UpdateGeoData re-downloads geoip.dat and geosite.dat even if they exist
+func (x *XrayManager) UpdateGeoData() error {
+	if err := os.MkdirAll(filepath.Dir(x.xrayPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
 	}
+	return x.downloadGeoData(true)
+}
 
-	resp, err := client.Get(url)
-	if err != nil {
-		return fmt.Errorf("request failed: %w", err)
+// GeoDataUpdated returns when the oldest geo data file was last updated, or
+// false if any of them is missing
+func (x *XrayManager) GeoDataUpdated() (time.Time, bool) {
+	var oldest time.Time
+	for _, geoFile := range geoDataFiles {
+		info, err := os.Stat(filepath.Join(filepath.Dir(x.xrayPath), geoFile.filename))
+		if err != nil {
+			return time.Time{}, false
+		}
+		if oldest.IsZero() || info.ModTime().Before(oldest) {
+			oldest = info.ModTime()
+		}
 	}
-	defer resp.Body.Close()
+	return oldest, true
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP %d", resp.StatusCode)
+// GeoDataWarning describes missing or stale geo data, or returns "" if it is fine
+func (x *XrayManager) GeoDataWarning() string {
+	updated, ok := x.GeoDataUpdated()
+	if !ok {
+		return "geoip.dat/geosite.dat missing, China-direct routing won't work (run: crosh proxy geodata update)"
 	}
-
-	// Create temporary file
-	tmpFile := targetPath + ".tmp"
-	out, err := os.Create(tmpFile)
-	if err != nil {
-		return fmt.Errorf("failed to create temp file: %w", err)
+	if age := time.Since(updated); age > GeoDataMaxAge {
+		return fmt.Sprintf("geoip.dat/geosite.dat are %d days old (run: crosh proxy geodata update)", int(age.Hours()/24))
 	}
+	return ""
+}
 
-	_, err = io.Copy(out, resp.Body)
-	out.Close()
+// downloadGeoFile downloads a single geo data file, installing it only if
+// its sha256 matches checksum. An interrupted download is resumed by the
+// next attempt.
+func (x *XrayManager) downloadGeoFile(url, targetPath, checksum string) error {
+	tmpFile := targetPath + ".part"
+	if err := httpclient.DownloadTo(x.context(), url, tmpFile, filepath.Base(targetPath)); err != nil {
+		return err
+	}
 
-	if err != nil {
+	if err := verifyFile(tmpFile, checksum); err != nil {
 		os.Remove(tmpFile)
-		return fmt.Errorf("failed to save file: %w", err)
+		return err
 	}
 
 	// Rename to final location
@@ -209,35 +305,18 @@ func (x *XrayManager) downloadGeoFile(url, targetPath string) error {
 	return nil
 }
 
-// downloadFromURL downloads Xray-core from a specific URL
-func (x *XrayManager) downloadFromURL(downloadURL string) error {
-	client := &http.Client{
-		Timeout: 5 * time.Minute,
-	}
-
-	resp, err := client.Get(downloadURL)
-	if err != nil {
-		return fmt.Errorf("request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP %d", resp.StatusCode)
-	}
-
-	// Save to temporary zip file
-	tmpZip := x.xrayPath + ".tmp.zip"
-	out, err := os.Create(tmpZip)
-	if err != nil {
-		return fmt.Errorf("failed to create temp file: %w", err)
+// downloadFromURL downloads Xray-core from a specific URL, installing it only
+// if the sha256 of the archive matches checksum. An interrupted download is
+// resumed by the next attempt, from this source or another.
+func (x *XrayManager) downloadFromURL(downloadURL, checksum string) error {
+	tmpZip := x.xrayPath + ".zip.part"
+	if err := httpclient.DownloadTo(x.context(), downloadURL, tmpZip, "Xray-core"); err != nil {
+		return err
 	}
 
-	_, err = io.Copy(out, resp.Body)
-	out.Close()
-
-	if err != nil {
+	if err := verifyFile(tmpZip, checksum); err != nil {
 		os.Remove(tmpZip)
-		return fmt.Errorf("failed to save file: %w", err)
+		return err
 	}
 
 	// Extract xray binary from zip
@@ -252,6 +331,27 @@ func (x *XrayManager) downloadFromURL(downloadURL string) error {
 	return nil
 }
 
+// xrayChecksum fetches the sha256 of a release archive from the .dgst file
+// published next to it. The official release is asked first, so a
+// tampered mirror can't vouch for its own archive; the mirror is only
+// trusted when GitHub is unreachable.
+func xrayChecksum(ctx context.Context, version, assetName string) (string, error) {
+	var lastErr error
+	for i := len(xraySources) - 1; i >= 0; i-- {
+		source := xraySources[i]
+		checksum, err := fetchChecksum(ctx, fmt.Sprintf("%s/%s/%s.dgst", source.DownloadURL, version, assetName), assetName)
+		if err == nil {
+			return checksum, nil
+		}
+		if ctx.Err() != nil {
+			return "", err
+		}
+		logging.Warn("failed to get Xray-core checksum", "source", source.Name, "error", err)
+		lastErr = err
+	}
+	return "", lastErr
+}
+
 // extractXrayFromZip extracts the xray binary from a zip file
 func (x *XrayManager) extractXrayFromZip(zipPath string) error {
 	reader, err := zip.OpenReader(zipPath)
@@ -330,7 +430,7 @@ func getXrayPlatformNames() (osName, archName string) {
 	}
 
 	// Map architecture names
-	switch runtime.GOARCH {
+	switch sysenv.Arch() {
 	case "amd64":
 		archName = "64"
 	case "386":
@@ -348,7 +448,7 @@ func getXrayPlatformNames() (osName, archName string) {
 	case "riscv64":
 		archName = "riscv64"
 	default:
-		archName = runtime.GOARCH
+		archName = sysenv.Arch()
 	}
 
 	return osName, archName
@@ -376,9 +476,7 @@ func (x *XrayManager) getLatestReleaseInfo() (version, assetName string, err err
 
 // getVersionFromCDN fetches version info from Cloudflare CDN
 func (x *XrayManager) getVersionFromCDN(source XraySource) (string, string, error) {
-	client := &http.Client{Timeout: 10 * time.Second}
-
-	resp, err := client.Get(source.APIURL)
+	resp, err := httpclient.Get(x.context(), httpclient.Client(), source.APIURL)
 	if err != nil {
 		return "", "", err
 	}
@@ -407,11 +505,7 @@ func (x *XrayManager) getVersionFromGitHub(source XraySource) (version, assetNam
 
 // fetchReleaseInfo fetches release info from a specific API endpoint
 func (x *XrayManager) fetchReleaseInfo(apiURL string) (version, assetName string, err error) {
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
-
-	resp, err := client.Get(apiURL)
+	resp, err := httpclient.Get(x.context(), httpclient.Client(), apiURL)
 	if err != nil {
 		return "", "", err
 	}
@@ -444,11 +538,58 @@ func (x *XrayManager) fetchReleaseInfo(apiURL string) (version, assetName string
 		}
 	}
 
-	return "", "", fmt.Errorf("no suitable binary found for %s/%s (looking for %s)", runtime.GOOS, runtime.GOARCH, assetPattern)
+	return "", "", fmt.Errorf("no suitable binary found for %s/%s (looking for %s)", runtime.GOOS, sysenv.Arch(), assetPattern)
 }
 
 // GenerateConfig generates Xray configuration from a node
 func (x *XrayManager) GenerateConfig(node *Node) error {
+	if x.HTTPPort() == x.localPort {
+		return hint.Errorf("pick another port with \"crosh config set proxy.http_port <port>\"", "http_port and local_port must differ (both are %d)", x.localPort)
+	}
+	if x.statsPort > 0 && (x.statsPort == x.localPort || x.statsPort == x.HTTPPort()) {
+		return hint.Errorf("pick another port with \"crosh config set proxy.stats_port <port>\"", "stats_port %d clashes with the proxy ports", x.statsPort)
+	}
+
+	config, err := x.buildConfig(node)
+	if err != nil {
+		return err
+	}
+
+	// Write config to file
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	if err := os.WriteFile(x.configPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+
+	// Remember the node so the config can be regenerated when settings change
+	nodeData, err := json.MarshalIndent(node, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal node: %w", err)
+	}
+
+	if err := os.WriteFile(x.nodePath(), nodeData, 0600); err != nil {
+		return fmt.Errorf("failed to write node: %w", err)
+	}
+
+	return nil
+}
+
+// buildConfig builds the full configuration for a node: an Xray config, or a
+// sing-box config for protocols Xray doesn't support
+func (x *XrayManager) buildConfig(node *Node) (map[string]interface{}, error) {
+	node, mux, err := x.applyNodeOverrides(node)
+	if err != nil {
+		return nil, err
+	}
+
+	if NeedsSingBox(node) {
+		return x.generateSingBoxConfig(node)
+	}
+
 	var config map[string]interface{}
 
 	switch node.Type {
@@ -461,27 +602,91 @@ func (x *XrayManager) GenerateConfig(node *Node) error {
 	case "ss":
 		config = x.generateShadowsocksConfig(node)
 	default:
-		return fmt.Errorf("unsupported node type: %s", node.Type)
+		return nil, fmt.Errorf("unsupported node type: %s", node.Type)
 	}
 
-	// Write config to file
+	if mux {
+		config["outbounds"].([]map[string]interface{})[0]["mux"] = muxSettings()
+	}
+
+	x.applyUDPConfig(config, node)
+	x.applyDNSConfig(config)
+	x.applyStatsConfig(config)
+
+	return config, nil
+}
+
+// CurrentNode returns the node the current config was generated from
+func (x *XrayManager) CurrentNode() (*Node, error) {
+	data, err := os.ReadFile(x.nodePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, hint.Errorf(noNodeHint, "no proxy node configured yet")
+		}
+		return nil, fmt.Errorf("failed to read node: %w", err)
+	}
+
+	node := &Node{}
+	if err := json.Unmarshal(data, node); err != nil {
+		return nil, fmt.Errorf("failed to parse node: %w", err)
+	}
+
+	return node, nil
+}
+
+// RegenerateConfig rewrites the config for the current node, picking up
+// changed settings such as ports or LAN access
+func (x *XrayManager) RegenerateConfig() error {
+	node, err := x.CurrentNode()
+	if err != nil {
+		return err
+	}
+	return x.GenerateConfig(node)
+}
+
+// ConfigOutdated checks if the current settings would generate a different
+// config for the current node than the one on disk, as after config.yaml
+// was edited by hand
+func (x *XrayManager) ConfigOutdated() (bool, error) {
+	node, err := x.CurrentNode()
+	if err != nil {
+		return false, err
+	}
+	config, err := x.buildConfig(node)
+	if err != nil {
+		return false, err
+	}
 	data, err := json.MarshalIndent(config, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to marshal config: %w", err)
+		return false, fmt.Errorf("failed to marshal config: %w", err)
 	}
 
-	if err := os.WriteFile(x.configPath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write config: %w", err)
+	current, err := os.ReadFile(x.configPath)
+	if err != nil {
+		return true, nil
 	}
+	return !bytes.Equal(data, current), nil
+}
 
-	return nil
+// Restart stops and starts Xray-core so a regenerated config takes effect
+func (x *XrayManager) Restart() error {
+	if err := x.Stop(); err != nil {
+		return err
+	}
+	return x.Start()
 }
 
-// generateRoutingRules generates routing rules for China IP direct connection
+// nodePath returns the path where the current node is stored
+func (x *XrayManager) nodePath() string {
+	return filepath.Join(filepath.Dir(x.configPath), "node.json")
+}
+
+// generateRoutingRules generates routing rules for China IP direct connection,
+// preceded by the user's bypass list
 func (x *XrayManager) generateRoutingRules() map[string]interface{} {
 	return map[string]interface{}{
 		"domainStrategy": "IPIfNonMatch",
-		"rules": []map[string]interface{}{
+		"rules": append(x.generateBypassRules(), []map[string]interface{}{
 			{
 				"type":        "field",
 				"ip":          []string{"geoip:private"},
@@ -497,10 +702,42 @@ func (x *XrayManager) generateRoutingRules() map[string]interface{} {
 				"domain":      []string{"geosite:cn"},
 				"outboundTag": "direct",
 			},
+		}...),
+	}
+}
+
+// generateInbounds generates the local SOCKS5 and HTTP inbounds
+func (x *XrayManager) generateInbounds() []map[string]interface{} {
+	return []map[string]interface{}{
+		{
+			"tag":      "socks-in",
+			"port":     x.localPort,
+			"listen":   x.listenAddress(),
+			"protocol": "socks",
+			"settings": map[string]interface{}{
+				"udp": true,
+			},
+			"sniffing": sniffingSettings(),
+		},
+		{
+			"tag":      "http-in",
+			"port":     x.HTTPPort(),
+			"listen":   x.listenAddress(),
+			"protocol": "http",
+			"settings": map[string]interface{}{},
+			"sniffing": sniffingSettings(),
 		},
 	}
 }
 
+// listenAddress returns the inbound listen address (all interfaces with LAN access)
+func (x *XrayManager) listenAddress() string {
+	if x.allowLAN {
+		return "0.0.0.0"
+	}
+	return "127.0.0.1"
+}
+
 // generateDirectOutbound generates direct connection outbound
 func (x *XrayManager) generateDirectOutbound() map[string]interface{} {
 	return map[string]interface{}{
@@ -533,15 +770,8 @@ func (x *XrayManager) generateVMessConfig(node *Node) map[string]interface{} {
 	}
 
 	return map[string]interface{}{
-		"inbounds": []map[string]interface{}{
-			{
-				"port":     x.localPort,
-				"protocol": "socks",
-				"settings": map[string]interface{}{
-					"udp": true,
-				},
-			},
-		},
+		"log":      x.generateLogConfig(),
+		"inbounds": x.generateInbounds(),
 		"outbounds": []map[string]interface{}{
 			proxyOutbound,
 			x.generateDirectOutbound(),
@@ -564,23 +794,18 @@ func (x *XrayManager) generateVLessConfig(node *Node) map[string]interface{} {
 						{
 							"id":         node.UUID,
 							"encryption": "none",
+							"flow":       node.Flow,
 						},
 					},
 				},
 			},
 		},
+		"streamSettings": x.generateVLessStreamSettings(node),
 	}
 
 	return map[string]interface{}{
-		"inbounds": []map[string]interface{}{
-			{
-				"port":     x.localPort,
-				"protocol": "socks",
-				"settings": map[string]interface{}{
-					"udp": true,
-				},
-			},
-		},
+		"log":      x.generateLogConfig(),
+		"inbounds": x.generateInbounds(),
 		"outbounds": []map[string]interface{}{
 			proxyOutbound,
 			x.generateDirectOutbound(),
@@ -589,6 +814,56 @@ func (x *XrayManager) generateVLessConfig(node *Node) map[string]interface{} {
 	}
 }
 
+// generateVLessStreamSettings generates the transport and TLS/REALITY settings
+// for a VLESS node
+func (x *XrayManager) generateVLessStreamSettings(node *Node) map[string]interface{} {
+	network := node.Network
+	if network == "" {
+		network = "tcp"
+	}
+
+	sni := node.SNI
+	if sni == "" {
+		sni = node.Server
+	}
+
+	fingerprint := node.Fingerprint
+	if fingerprint == "" {
+		fingerprint = "chrome"
+	}
+
+	streamSettings := map[string]interface{}{
+		"network":  network,
+		"security": "none",
+	}
+
+	switch node.Security {
+	case "tls":
+		tlsSettings := map[string]interface{}{
+			"serverName":  sni,
+			"fingerprint": fingerprint,
+		}
+		if node.ALPN != "" {
+			tlsSettings["alpn"] = strings.Split(node.ALPN, ",")
+		}
+		streamSettings["security"] = "tls"
+		streamSettings["tlsSettings"] = tlsSettings
+	case "reality":
+		// REALITY borrows the handshake of a real site, so SNI, public key
+		// and short id must match the server exactly
+		streamSettings["security"] = "reality"
+		streamSettings["realitySettings"] = map[string]interface{}{
+			"serverName":  sni,
+			"fingerprint": fingerprint,
+			"publicKey":   node.PublicKey,
+			"shortId":     node.ShortID,
+			"spiderX":     node.SpiderX,
+		}
+	}
+
+	return streamSettings
+}
+
 // generateTrojanConfig generates Trojan configuration
 func (x *XrayManager) generateTrojanConfig(node *Node) map[string]interface{} {
 	// Determine SNI - use explicit SNI if set, otherwise use server address
@@ -597,6 +872,20 @@ func (x *XrayManager) generateTrojanConfig(node *Node) map[string]interface{} {
 		sni = node.Server
 	}
 
+	tlsSettings := map[string]interface{}{
+		"serverName":              sni,
+		"allowInsecure":           true,
+		"alpn":                    "chrome",
+		"disableSystemRoot":       false,
+		"enableSessionResumption": true,
+	}
+	if node.ALPN != "" {
+		tlsSettings["alpn"] = strings.Split(node.ALPN, ",")
+	}
+	if node.Fingerprint != "" {
+		tlsSettings["fingerprint"] = node.Fingerprint
+	}
+
 	proxyOutbound := map[string]interface{}{
 		"tag":      "proxy",
 		"protocol": "trojan",
@@ -610,28 +899,15 @@ func (x *XrayManager) generateTrojanConfig(node *Node) map[string]interface{} {
 			},
 		},
 		"streamSettings": map[string]interface{}{
-			"network":  "tcp",
-			"security": "tls",
-			"tlsSettings": map[string]interface{}{
-				"serverName":              sni,
-				"allowInsecure":           true,
-				"alpn":                    "chrome",
-				"disableSystemRoot":       false,
-				"enableSessionResumption": true,
-			},
+			"network":     "tcp",
+			"security":    "tls",
+			"tlsSettings": tlsSettings,
 		},
 	}
 
 	return map[string]interface{}{
-		"inbounds": []map[string]interface{}{
-			{
-				"port":     x.localPort,
-				"protocol": "socks",
-				"settings": map[string]interface{}{
-					"udp": true,
-				},
-			},
-		},
+		"log":      x.generateLogConfig(),
+		"inbounds": x.generateInbounds(),
 		"outbounds": []map[string]interface{}{
 			proxyOutbound,
 			x.generateDirectOutbound(),
@@ -658,15 +934,8 @@ func (x *XrayManager) generateShadowsocksConfig(node *Node) map[string]interface
 	}
 
 	return map[string]interface{}{
-		"inbounds": []map[string]interface{}{
-			{
-				"port":     x.localPort,
-				"protocol": "socks",
-				"settings": map[string]interface{}{
-					"udp": true,
-				},
-			},
-		},
+		"log":      x.generateLogConfig(),
+		"inbounds": x.generateInbounds(),
 		"outbounds": []map[string]interface{}{
 			proxyOutbound,
 			x.generateDirectOutbound(),
@@ -675,11 +944,42 @@ func (x *XrayManager) generateShadowsocksConfig(node *Node) map[string]interface
 	}
 }
 
-// Start starts the Xray-core process
-func (x *XrayManager) Start() error {
-	// Check if Xray binary exists
+// ConfigPath returns the path of the generated proxy config
+func (x *XrayManager) ConfigPath() string {
+	return x.configPath
+}
+
+// HasConfig checks if an Xray config has been generated
+func (x *XrayManager) HasConfig() bool {
+	_, err := os.Stat(x.configPath)
+	return err == nil
+}
+
+// binaryFor returns the proxy binary that runs node's config, Xray-core if
+// node is nil
+func (x *XrayManager) binaryFor(node *Node) (string, error) {
+	if node != nil && NeedsSingBox(node) {
+		if _, err := os.Stat(x.SingBoxPath()); os.IsNotExist(err) {
+			return "", hint.Wrap(errs.Errorf(errs.ErrNotInstalled, "sing-box not found, it is required for %s nodes", node.Type), downloadHint)
+		}
+		return x.SingBoxPath(), nil
+	}
+
 	if _, err := os.Stat(x.xrayPath); os.IsNotExist(err) {
-		return fmt.Errorf("xray-core not found, please run download first")
+		return "", hint.Wrap(errs.Errorf(errs.ErrNotInstalled, "xray-core not found"), downloadHint)
+	}
+	return x.xrayPath, nil
+}
+
+// Start starts the Xray-core process, or sing-box if the current node needs it
+func (x *XrayManager) Start() error {
+	binary := x.xrayPath
+	if node, err := x.CurrentNode(); err == nil {
+		if binary, err = x.binaryFor(node); err != nil {
+			return err
+		}
+	} else if _, err := os.Stat(x.xrayPath); os.IsNotExist(err) {
+		return hint.Wrap(errs.Errorf(errs.ErrNotInstalled, "xray-core not found"), downloadHint)
 	}
 
 	// Check if already running
@@ -688,110 +988,283 @@ func (x *XrayManager) Start() error {
 	}
 
 	// Create log file for background process
-	logFile := filepath.Join(filepath.Dir(x.xrayPath), "xray.log")
+	if err := os.MkdirAll(x.LogDir(), 0755); err != nil {
+		return fmt.Errorf("failed to create log directory: %w", err)
+	}
+	logFile := x.LogFile()
+	if err := rotateLog(logFile, false); err != nil {
+		logging.Warn(err.Error())
+	}
 	logFileHandle, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to create log file: %w", err)
 	}
 
-	// Start Xray process with output redirected to log file
-	x.cmd = exec.Command(x.xrayPath, "run", "-config", x.configPath)
+	// Start Xray process with output redirected to log file, in its own
+	// process group so Ctrl+C in the terminal that ran crosh doesn't reach it
+	x.cmd = exec.Command(binary, "run", "-c", x.configPath)
 	x.cmd.Stdout = logFileHandle
 	x.cmd.Stderr = logFileHandle
+	x.cmd.SysProcAttr = detachedAttr()
 
 	if err := x.cmd.Start(); err != nil {
+		x.cmd = nil
 		logFileHandle.Close()
 		return fmt.Errorf("failed to start Xray-core: %w", err)
 	}
 
+	// Reap the process as soon as it exits, so a long-running crosh (the
+	// daemon or health monitor) doesn't keep a zombie that looks alive
+	cmd, exited := x.cmd, make(chan struct{})
+	x.exited = exited
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+
 	// Close the file handle in the parent process (child process keeps its copy)
 	logFileHandle.Close()
 
-	fmt.Printf("Xray-core started on port %d (PID: %d)\n", x.localPort, x.cmd.Process.Pid)
-	fmt.Printf("Logs: %s\n", logFile)
+	fmt.Fprintf(x.output(), "%s started on ports %d (socks5) and %d (http) (PID: %d)\n", backendName(binary), x.localPort, x.HTTPPort(), x.cmd.Process.Pid)
+	if x.allowLAN {
+		fmt.Fprintln(x.output(), "⚠ LAN access enabled: anyone on your network can use this proxy without authentication")
+		for _, ip := range LANAddresses() {
+			fmt.Fprintf(x.output(), "  Other devices can use: socks5://%s:%d or http://%s:%d\n", ip, x.localPort, ip, x.HTTPPort())
+		}
+	}
+	fmt.Fprintf(x.output(), "Logs: %s\n", logFile)
 
 	// Save PID to file
-	pidFile := filepath.Join(filepath.Dir(x.xrayPath), "xray.pid")
-	os.WriteFile(pidFile, []byte(fmt.Sprintf("%d", x.cmd.Process.Pid)), 0644)
+	os.WriteFile(x.pidFile(), []byte(fmt.Sprintf("%d", x.cmd.Process.Pid)), 0644)
 
 	return nil
 }
 
-// Stop stops the Xray-core process
+// backendName returns a display name for a proxy binary
+func backendName(binary string) string {
+	if strings.HasPrefix(filepath.Base(binary), "sing-box") {
+		return "sing-box"
+	}
+	return "Xray-core"
+}
+
+// Stop asks the Xray-core process to exit, killing it if it doesn't within
+// a few seconds, so it never lingers holding the proxy ports
 func (x *XrayManager) Stop() error {
-	pidFile := filepath.Join(filepath.Dir(x.xrayPath), "xray.pid")
+	pidFile := x.pidFile()
 
 	// Try to stop via cmd object first
 	if x.cmd != nil && x.cmd.Process != nil {
-		if err := x.cmd.Process.Kill(); err != nil {
+		if err := terminate(x.cmd.Process.Pid, stopTimeout); err != nil {
 			return fmt.Errorf("failed to stop Xray-core: %w", err)
 		}
-		x.cmd.Wait()
+		<-x.exited
 		x.cmd = nil
-	} else {
+	} else if x.IsRunning() {
 		// Try to stop via PID file (for processes started in previous sessions)
-		data, err := os.ReadFile(pidFile)
-		if err == nil {
-			var pid int
-			fmt.Sscanf(string(data), "%d", &pid)
-
-			if pid > 0 {
-				process, err := os.FindProcess(pid)
-				if err == nil {
-					// Try to kill the process
-					if err := process.Kill(); err != nil {
-						// Process might already be dead, that's ok
-						fmt.Printf("Note: Process %d may have already stopped\n", pid)
-					}
-				}
-			}
+		if err := StopBackground(pidFile); err != nil {
+			// Process might already be dead, that's ok
+			fmt.Fprintf(x.output(), "Note: %v\n", err)
 		}
 	}
 
 	// Remove PID file
 	os.Remove(pidFile)
 
-	fmt.Println("Xray-core stopped")
+	fmt.Fprintln(x.output(), "Xray-core stopped")
 	return nil
 }
 
 // IsRunning checks if Xray-core is running
 func (x *XrayManager) IsRunning() bool {
 	if x.cmd != nil && x.cmd.Process != nil {
-		// Check if process is still alive
-		err := x.cmd.Process.Signal(os.Signal(nil))
-		return err == nil
+		select {
+		case <-x.exited:
+			return false
+		default:
+			return true
+		}
 	}
 
-	// Check PID file
-	pidFile := filepath.Join(filepath.Dir(x.xrayPath), "xray.pid")
-	data, err := os.ReadFile(pidFile)
-	if err != nil {
-		return false
+	pid, alive := BackgroundRunning(x.pidFile())
+	return alive && x.ownsProcess(pid)
+}
+
+// ownsProcess checks that pid runs this proxy's config, not an unrelated
+// process that got the PID of one that died, e.g. after a reboot. It
+// assumes so where the command line can't be read.
+func (x *XrayManager) ownsProcess(pid int) bool {
+	commandLine, ok := processCommandLine(pid)
+	return !ok || strings.Contains(commandLine, x.configPath)
+}
+
+// PID returns the PID of the running Xray-core process, or 0
+func (x *XrayManager) PID() int {
+	if x.IsRunning() && x.cmd != nil {
+		return x.cmd.Process.Pid
+	}
+	pid, alive := BackgroundRunning(x.pidFile())
+	if !alive || !x.ownsProcess(pid) {
+		return 0
+	}
+	return pid
+}
+
+// pidFile returns the path of the Xray PID file
+func (x *XrayManager) pidFile() string {
+	return filepath.Join(x.stateDir, "xray.pid")
+}
+
+// SetStateDir sets where logs and the PID file are kept (defaults to the Xray-core directory)
+func (x *XrayManager) SetStateDir(dir string) {
+	x.stateDir = dir
+}
+
+// StateDir returns the directory holding logs and the PID file
+func (x *XrayManager) StateDir() string {
+	return x.stateDir
+}
+
+// SetContext sets the context downloads and node tests run under, so they
+// can be cancelled (defaults to context.Background)
+func (x *XrayManager) SetContext(ctx context.Context) {
+	x.ctx = ctx
+}
+
+// context returns the context set by SetContext
+func (x *XrayManager) context() context.Context {
+	if x.ctx == nil {
+		return context.Background()
+	}
+	return x.ctx
+}
+
+// SetOutput sends the progress Download, Start and Stop print to out
+// instead of stdout
+func (x *XrayManager) SetOutput(out io.Writer) {
+	x.out = out
+}
+
+// output returns the writer set by SetOutput, or os.Stdout
+func (x *XrayManager) output() io.Writer {
+	if x.out == nil {
+		return os.Stdout
 	}
+	return x.out
+}
+
+// SetHTTPPort sets the port of the local HTTP inbound
+func (x *XrayManager) SetHTTPPort(port int) {
+	x.httpPort = port
+}
+
+// SetAllowLAN makes the inbounds listen on all interfaces so other devices
+// on the local network can use the proxy
+func (x *XrayManager) SetAllowLAN(allow bool) {
+	x.allowLAN = allow
+}
+
+// AllowLAN reports whether the inbounds listen on all interfaces
+func (x *XrayManager) AllowLAN() bool {
+	return x.allowLAN
+}
+
+// SocksPort returns the port of the local SOCKS5 inbound
+func (x *XrayManager) SocksPort() int {
+	return x.localPort
+}
 
-	var pid int
-	fmt.Sscanf(string(data), "%d", &pid)
+// HTTPPort returns the port of the local HTTP inbound
+func (x *XrayManager) HTTPPort() int {
+	if x.httpPort > 0 {
+		return x.httpPort
+	}
+	return x.localPort + 1
+}
 
-	// Check if process with this PID exists
-	process, err := os.FindProcess(pid)
+// LANAddresses returns the non-loopback IPv4 addresses other devices can use
+func LANAddresses() []string {
+	addrs, err := net.InterfaceAddrs()
 	if err != nil {
-		return false
+		return nil
 	}
 
-	err = process.Signal(os.Signal(nil))
-	return err == nil
+	var ips []string
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() || ipNet.IP.To4() == nil {
+			continue
+		}
+		ips = append(ips, ipNet.IP.String())
+	}
+	return ips
+}
+
+// SocksProxyURL returns the URL of the local SOCKS5 inbound
+func (x *XrayManager) SocksProxyURL() string {
+	return fmt.Sprintf("socks5://127.0.0.1:%d", x.localPort)
+}
+
+// HTTPProxyURL returns the URL of the local HTTP inbound
+func (x *XrayManager) HTTPProxyURL() string {
+	return fmt.Sprintf("http://127.0.0.1:%d", x.HTTPPort())
 }
 
 // GetProxyEnvVars returns environment variables for using the proxy
 func (x *XrayManager) GetProxyEnvVars() map[string]string {
-	proxyURL := fmt.Sprintf("socks5://127.0.0.1:%d", x.localPort)
+	httpURL := x.HTTPProxyURL()
+	socksURL := x.SocksProxyURL()
+	noProxy := MergedNoProxy()
 	return map[string]string{
-		"HTTP_PROXY":  proxyURL,
-		"HTTPS_PROXY": proxyURL,
-		"ALL_PROXY":   proxyURL,
-		"http_proxy":  proxyURL,
-		"https_proxy": proxyURL,
-		"all_proxy":   proxyURL,
+		"HTTP_PROXY":  httpURL,
+		"HTTPS_PROXY": httpURL,
+		"ALL_PROXY":   socksURL,
+		"NO_PROXY":    noProxy,
+		"http_proxy":  httpURL,
+		"https_proxy": httpURL,
+		"all_proxy":   socksURL,
+		"no_proxy":    noProxy,
+	}
+}
+
+// StartedAt returns when the running proxy was started, based on its PID file
+func (x *XrayManager) StartedAt() (time.Time, bool) {
+	if !x.IsRunning() {
+		return time.Time{}, false
+	}
+	info, err := os.Stat(x.pidFile())
+	if err != nil {
+		return time.Time{}, false
+	}
+	return info.ModTime(), true
+}
+
+// Version returns the version line of the binary that runs node (Xray-core
+// if node is nil), such as "Xray 1.8.4" or "sing-box 1.10.7"
+func (x *XrayManager) Version(node *Node) (string, error) {
+	binary, err := x.binaryFor(node)
+	if err != nil {
+		return "", err
 	}
+
+	out, err := exec.Command(binary, "version").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get version: %w", err)
+	}
+
+	// "Xray 1.8.4 (Xray, Penetrates Everything.) ..." / "sing-box version 1.10.7"
+	fields := strings.Fields(strings.SplitN(string(out), "\n", 2)[0])
+	if len(fields) >= 3 && fields[1] == "version" {
+		return fields[0] + " " + fields[2], nil
+	}
+	if len(fields) >= 2 {
+		return fields[0] + " " + fields[1], nil
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// ListenAddresses returns the SOCKS5 and HTTP listen addresses
+func (x *XrayManager) ListenAddresses() (socks, http string) {
+	host := x.listenAddress()
+	return net.JoinHostPort(host, fmt.Sprint(x.localPort)), net.JoinHostPort(host, fmt.Sprint(x.HTTPPort()))
 }
@@ -0,0 +1,93 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/boomyao/crosh/internal/logging"
+)
+
+// Policy says how often and how long apart an operation is retried
+type Policy struct {
+	Attempts int           // tries in total, including the first
+	Base     time.Duration // wait before the first retry, doubled after each
+	Max      time.Duration // longest wait between tries
+}
+
+// Default suits a download or API call: a flaky link usually recovers
+// within a few seconds
+var Default = Policy{Attempts: 4, Base: 500 * time.Millisecond, Max: 8 * time.Second}
+
+// Quick suits probes that measure latency, where a slow retry would only
+// hold the whole measurement up
+var Quick = Policy{Attempts: 2, Base: 200 * time.Millisecond, Max: time.Second}
+
+// permanentError marks an error that retrying can't fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks err as not worth retrying, like a 404 or a parse error
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+// TransientStatus checks if an HTTP status is worth retrying: server errors,
+// timeouts and rate limiting
+func TransientStatus(code int) bool {
+	return code >= 500 || code == http.StatusRequestTimeout || code == http.StatusTooManyRequests
+}
+
+// Do runs fn with the Default policy
+func Do(ctx context.Context, what string, fn func() error) error {
+	return Default.Do(ctx, what, fn)
+}
+
+// Do runs fn until it succeeds, returns a Permanent error, runs out of
+// attempts or ctx is cancelled, waiting a jittered, exponentially growing
+// delay between tries. what names the operation in the debug log. The last
+// error is returned with any Permanent mark removed.
+func (p Policy) Do(ctx context.Context, what string, fn func() error) error {
+	delay := p.Base
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil {
+			return nil
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return permanent.err
+		}
+		if attempt >= p.Attempts || ctx.Err() != nil {
+			return err
+		}
+
+		// Full jitter keeps concurrent retries from hitting a recovering
+		// server at the same moment
+		wait := time.Duration(rand.Int63n(int64(delay) + 1))
+		logging.Debug("retrying", "operation", what, "attempt", attempt, "wait", wait, "error", err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+		if delay *= 2; delay > p.Max {
+			delay = p.Max
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Shell identifies a shell syntax for environment variable exports
+type Shell string
+
+const (
+	Bash       Shell = "bash"
+	Zsh        Shell = "zsh"
+	Fish       Shell = "fish"
+	Nu         Shell = "nu"
+	Csh        Shell = "csh"
+	PowerShell Shell = "powershell"
+)
+
+// Detect guesses the user's shell from the environment
+func Detect() Shell {
+	if sh := os.Getenv("SHELL"); sh != "" {
+		if parsed, err := Parse(filepath.Base(sh)); err == nil {
+			return parsed
+		}
+	}
+
+	if runtime.GOOS == "windows" || os.Getenv("PSModulePath") != "" {
+		return PowerShell
+	}
+
+	return Bash
+}
+
+// Parse converts a shell name into a Shell
+func Parse(name string) (Shell, error) {
+	switch strings.ToLower(name) {
+	case "bash", "sh":
+		return Bash, nil
+	case "zsh":
+		return Zsh, nil
+	case "fish":
+		return Fish, nil
+	case "nu", "nushell":
+		return Nu, nil
+	case "csh", "tcsh":
+		return Csh, nil
+	case "powershell", "pwsh", "ps":
+		return PowerShell, nil
+	default:
+		return "", fmt.Errorf("unsupported shell: %s (supported: bash, zsh, fish, nu, csh, powershell)", name)
+	}
+}
+
+// ExportLines returns the commands that set vars in the given shell, sorted by
+// name. Nushell can't eval text, so it gets a single record for load-env.
+func ExportLines(sh Shell, vars map[string]string) []string {
+	if sh == Nu {
+		fields := make([]string, 0, len(vars))
+		for _, key := range sortedKeys(vars) {
+			fields = append(fields, fmt.Sprintf("%s: %s", key, nuQuote(vars[key])))
+		}
+		return []string{"{" + strings.Join(fields, ", ") + "}"}
+	}
+
+	lines := make([]string, 0, len(vars))
+	for _, key := range sortedKeys(vars) {
+		value := vars[key]
+		switch sh {
+		case Fish:
+			lines = append(lines, fmt.Sprintf("set -gx %s %s;", key, Quote(value)))
+		case Csh:
+			lines = append(lines, fmt.Sprintf("setenv %s %s;", key, Quote(value)))
+		case PowerShell:
+			lines = append(lines, fmt.Sprintf("$env:%s = \"%s\"", key, value))
+		default:
+			lines = append(lines, fmt.Sprintf("export %s=%s", key, Quote(value)))
+		}
+	}
+	return lines
+}
+
+// UnsetLines returns the commands that remove vars in the given shell. For
+// Nushell it is a list of the names, to be spread into hide-env.
+func UnsetLines(sh Shell, names []string) []string {
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+
+	if sh == Nu {
+		return []string{"[" + strings.Join(sorted, ", ") + "]"}
+	}
+
+	lines := make([]string, 0, len(sorted))
+	for _, name := range sorted {
+		switch sh {
+		case Fish:
+			lines = append(lines, fmt.Sprintf("set -e %s;", name))
+		case Csh:
+			lines = append(lines, fmt.Sprintf("unsetenv %s;", name))
+		case PowerShell:
+			lines = append(lines, fmt.Sprintf("Remove-Item Env:%s -ErrorAction SilentlyContinue", name))
+		default:
+			lines = append(lines, fmt.Sprintf("unset %s", name))
+		}
+	}
+	return lines
+}
+
+// nuQuote wraps a value in double quotes for Nushell
+func nuQuote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+// Quote wraps a value in single quotes for POSIX-like shells
+func Quote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+func sortedKeys(vars map[string]string) []string {
+	keys := make([]string, 0, len(vars))
+	for key := range vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,66 @@
+package sysenv
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+var (
+	rosettaOnce sync.Once
+	rosetta     bool
+)
+
+// UnderRosetta checks if this is the Intel build of crosh running on Apple
+// Silicon through Rosetta 2
+func UnderRosetta() bool {
+	rosettaOnce.Do(func() {
+		if runtime.GOOS != "darwin" || runtime.GOARCH != "amd64" {
+			return
+		}
+		out, err := exec.Command("sysctl", "-n", "sysctl.proc_translated").Output()
+		rosetta = err == nil && strings.TrimSpace(string(out)) == "1"
+	})
+	return rosetta
+}
+
+// Arch returns the CPU architecture of the machine in GOARCH terms, which
+// differs from runtime.GOARCH under Rosetta. Downloaded binaries should
+// match it so they don't run translated.
+func Arch() string {
+	if UnderRosetta() {
+		return "arm64"
+	}
+	return runtime.GOARCH
+}
+
+// HomebrewPrefix returns where Homebrew lives on this Mac: /opt/homebrew on
+// Apple Silicon and /usr/local on Intel
+func HomebrewPrefix() string {
+	if Arch() == "arm64" {
+		return "/opt/homebrew"
+	}
+	return "/usr/local"
+}
+
+// AddHomebrewPath appends Homebrew's bin directory to PATH on macOS when it
+// is missing, as in launchd jobs or a shell that didn't run "brew shellenv",
+// so npm, go and cargo installed with Homebrew are found
+func AddHomebrewPath() {
+	if runtime.GOOS != "darwin" {
+		return
+	}
+	bin := filepath.Join(HomebrewPrefix(), "bin")
+	path := os.Getenv("PATH")
+	for _, dir := range filepath.SplitList(path) {
+		if dir == bin {
+			return
+		}
+	}
+	if _, err := os.Stat(bin); err == nil {
+		os.Setenv("PATH", path+string(os.PathListSeparator)+bin)
+	}
+}
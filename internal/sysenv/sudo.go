@@ -0,0 +1,18 @@
+package sysenv
+
+import "os/exec"
+
+// SudoCommand returns the command that runs another as root: preferred if
+// it is "sudo" or "doas", otherwise sudo, or doas on systems that only have
+// doas such as OpenBSD and minimal Alpine installs
+func SudoCommand(preferred string) string {
+	if preferred == "sudo" || preferred == "doas" {
+		return preferred
+	}
+	if _, err := exec.LookPath("sudo"); err != nil {
+		if _, err := exec.LookPath("doas"); err == nil {
+			return "doas"
+		}
+	}
+	return "sudo"
+}
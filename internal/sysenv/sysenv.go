@@ -0,0 +1,68 @@
+package sysenv
+
+import (
+	"os"
+	"runtime"
+	"strings"
+)
+
+// ciEnvVars are set by CI systems (GitHub Actions, GitLab, Jenkins, Buildkite,
+// Azure Pipelines, TeamCity)
+var ciEnvVars = []string{"CI", "GITHUB_ACTIONS", "GITLAB_CI", "JENKINS_URL", "BUILDKITE", "TF_BUILD", "TEAMCITY_VERSION"}
+
+// cgroupHints appear in /proc/1/cgroup inside containers
+var cgroupHints = []string{"docker", "kubepods", "containerd", "lxc", "libpod"}
+
+// InCI checks the environment variables CI systems set
+func InCI() bool {
+	for _, name := range ciEnvVars {
+		if value := os.Getenv(name); value != "" && value != "false" && value != "0" {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRoot checks if crosh runs as root on Linux
+func IsRoot() bool {
+	return runtime.GOOS == "linux" && os.Geteuid() == 0
+}
+
+// InContainer checks if crosh runs in a Docker, Podman, Kubernetes or LXC container
+func InContainer() bool {
+	if runtime.GOOS != "linux" {
+		return false
+	}
+	for _, marker := range []string{"/.dockerenv", "/run/.containerenv"} {
+		if _, err := os.Stat(marker); err == nil {
+			return true
+		}
+	}
+	// Podman and systemd-nspawn set $container for the processes inside
+	if os.Getenv("container") != "" {
+		return true
+	}
+	data, err := os.ReadFile("/proc/1/cgroup")
+	if err != nil {
+		return false
+	}
+	for _, hint := range cgroupHints {
+		if strings.Contains(string(data), hint) {
+			return true
+		}
+	}
+	return false
+}
+
+// SystemWide reports whether configs should be written for the whole
+// system, e.g. /etc/pip.conf, rather than the user. That is the case for root,
+// which is who runs the RUN steps of a Dockerfile.
+func SystemWide() bool {
+	return IsRoot()
+}
+
+// Unattended reports whether nobody is there to follow instructions such as
+// "restart the Docker daemon", as in a container build or on CI
+func Unattended() bool {
+	return InContainer() || InCI()
+}
@@ -0,0 +1,238 @@
+package telemetry
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/boomyao/crosh/internal/config"
+	"github.com/boomyao/crosh/internal/fsys"
+	"github.com/boomyao/crosh/internal/httpclient"
+	"github.com/boomyao/crosh/internal/logging"
+	"github.com/boomyao/crosh/internal/sysenv"
+)
+
+// FS holds the queue; tests point it at fsys.Dir
+var FS = fsys.OS
+
+// DefaultEndpoint receives the events when telemetry.endpoint isn't set
+const DefaultEndpoint = "https://crosh.boomyao.com/api/telemetry"
+
+// sendInterval is how often queued events are sent. Sending happens as a
+// command exits, so without network a command waits for it once an hour
+// rather than every time.
+const sendInterval = time.Hour
+
+// sendTimeout bounds sending the queued events
+const sendTimeout = 2 * time.Second
+
+// maxQueued is how many events are kept while they can't be sent; older
+// ones are dropped
+const maxQueued = 500
+
+// Event is everything sent about one command. It holds nothing that
+// identifies the user, the machine or the network: no URLs, host or user
+// names, paths, or node, profile or container names.
+type Event struct {
+	Command  string   `json:"command"` // e.g. "mirror enable", or "subscription" for crosh <url>
+	Success  bool     `json:"success"`
+	ExitCode int      `json:"exit_code"`
+	Mirrors  []string `json:"mirrors,omitempty"` // the tools with a mirror enabled, e.g. npm
+	Version  string   `json:"version"`
+	OS       string   `json:"os"`
+	Arch     string   `json:"arch"`
+	Day      string   `json:"day"` // 2006-01-02, not the time of day
+}
+
+// NewEvent describes a command that exited with code, for the crosh
+// version and the mirrors enabled in cfg
+func NewEvent(cfg *config.Config, command, version string, code int) Event {
+	event := Event{
+		Command:  command,
+		Success:  code == 0,
+		ExitCode: code,
+		Version:  strings.TrimSpace(version),
+		OS:       runtime.GOOS,
+		Arch:     sysenv.Arch(),
+		Day:      time.Now().UTC().Format("2006-01-02"),
+	}
+	for _, tool := range config.MirrorToolNames {
+		if cfg.Mirror.Tool(tool).Enabled {
+			event.Mirrors = append(event.Mirrors, tool)
+		}
+	}
+	return event
+}
+
+// Enabled checks if the user turned telemetry on. DO_NOT_TRACK=1 turns it
+// off whatever the config says, e.g. for CI.
+func Enabled(cfg *config.Config) bool {
+	return cfg.Telemetry.Enabled && !DisabledByEnvironment()
+}
+
+// DisabledByEnvironment checks if DO_NOT_TRACK overrides the config
+func DisabledByEnvironment() bool {
+	value := os.Getenv("DO_NOT_TRACK")
+	return value != "" && value != "0"
+}
+
+// Endpoint returns the URL events are posted to
+func Endpoint(cfg *config.Config) string {
+	if cfg.Telemetry.Endpoint != "" {
+		return cfg.Telemetry.Endpoint
+	}
+	return DefaultEndpoint
+}
+
+// Record queues event if telemetry is on, and sends the queue if it wasn't
+// sent within sendInterval. Failures are only logged: telemetry never gets
+// in the way of a command.
+func Record(cfg *config.Config, event Event) {
+	if !Enabled(cfg) {
+		return
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	if err := appendQueue([][]byte{line}); err != nil {
+		logging.Debug("failed to queue telemetry", "error", err)
+		return
+	}
+
+	if info, err := FS.Stat(sentPath()); err == nil && time.Since(info.ModTime()) < sendInterval {
+		return
+	}
+	if err := send(Endpoint(cfg)); err != nil {
+		logging.Debug("failed to send telemetry", "error", err)
+	}
+}
+
+// dir holds the queue and the time of the last send
+func dir() string {
+	return filepath.Join(config.StateDir(), "telemetry")
+}
+
+// queuePath returns the events waiting to be sent, one JSON object a line
+func queuePath() string {
+	return filepath.Join(dir(), "queue.jsonl")
+}
+
+// sentPath returns the file whose modification time is the last send
+func sentPath() string {
+	return filepath.Join(dir(), "sent")
+}
+
+// appendQueue adds lines to the queue. Appends of single lines don't
+// interleave, so concurrent crosh commands don't need a lock.
+func appendQueue(lines [][]byte) error {
+	if err := FS.MkdirAll(dir(), 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir(), err)
+	}
+	f, err := FS.OpenFile(queuePath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", queuePath(), err)
+	}
+	defer f.Close()
+	for _, line := range lines {
+		if _, err := f.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("failed to write %s: %w", queuePath(), err)
+		}
+	}
+	return nil
+}
+
+// send posts the queued events to endpoint. The queue is taken over by
+// renaming it, so another crosh sending at the same time gets the events
+// queued since, and is put back if the post fails.
+func send(endpoint string) error {
+	// Whatever happens, wait sendInterval before the next attempt
+	FS.WriteFile(sentPath(), nil, 0600)
+	now := time.Now()
+	FS.Chtimes(sentPath(), now, now)
+
+	sending := fmt.Sprintf("%s.%d", queuePath(), os.Getpid())
+	if err := FS.Rename(queuePath(), sending); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to take the queue: %w", err)
+	}
+	defer FS.Remove(sending)
+
+	lines, err := readLines(sending)
+	if err != nil {
+		return err
+	}
+	if len(lines) > maxQueued {
+		lines = lines[len(lines)-maxQueued:]
+	}
+	if err := post(endpoint, lines); err != nil {
+		if err := appendQueue(lines); err != nil {
+			logging.Debug("failed to put telemetry back", "error", err)
+		}
+		return err
+	}
+	logging.Debug("sent telemetry", "events", len(lines), "endpoint", endpoint)
+	return nil
+}
+
+// readLines returns the events in a queue file, skipping torn lines
+func readLines(path string) ([][]byte, error) {
+	f, err := FS.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var lines [][]byte
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); json.Valid(line) {
+			lines = append(lines, append([]byte(nil), line...))
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// post sends events as {"events": [...]}
+func post(endpoint string, events [][]byte) error {
+	body, err := json.Marshal(map[string][]json.RawMessage{"events": rawMessages(events)})
+	if err != nil {
+		return fmt.Errorf("failed to encode telemetry: %w", err)
+	}
+
+	resp, err := httpclient.New(sendTimeout).Post(endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to post telemetry: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("telemetry endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+// rawMessages converts queued lines to JSON values
+func rawMessages(lines [][]byte) []json.RawMessage {
+	messages := make([]json.RawMessage, len(lines))
+	for i, line := range lines {
+		messages[i] = line
+	}
+	return messages
+}
+
+// Forget removes the queued events, so nothing recorded before turning
+// telemetry off is sent later
+func Forget() error {
+	if err := FS.RemoveAll(dir()); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", dir(), err)
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package update
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/boomyao/crosh/internal/hint"
+	"github.com/boomyao/crosh/internal/httpclient"
+	"github.com/boomyao/crosh/internal/progress"
+	"github.com/boomyao/crosh/internal/sysenv"
+)
+
+// repo is the GitHub repository crosh is released from
+const repo = "boomyao/crosh"
+
+// source is a place to fetch releases from
+type source struct {
+	Name       string
+	VersionURL string
+	// AssetURL formats a release asset URL from the version and file name
+	AssetURL func(version, name string) string
+}
+
+// sources are tried in order; the Cloudflare CDN is reachable from China
+// when GitHub isn't
+var sources = []source{
+	{
+		Name:       "GitHub",
+		VersionURL: "https://api.github.com/repos/" + repo + "/releases/latest",
+		AssetURL: func(version, name string) string {
+			return fmt.Sprintf("https://github.com/%s/releases/download/%s/%s", repo, version, name)
+		},
+	},
+	{
+		Name:       "Cloudflare CDN",
+		VersionURL: "https://crosh.boomyao.com/api/version?nocache=1",
+		AssetURL: func(version, name string) string {
+			return fmt.Sprintf("https://crosh.boomyao.com/dist/%s/%s", version, name)
+		},
+	},
+}
+
+// AssetName returns the release binary for this platform, e.g.
+// crosh-linux-amd64. Under Rosetta that's the Apple Silicon build.
+func AssetName() string {
+	name := fmt.Sprintf("crosh-%s-%s", runtime.GOOS, sysenv.Arch())
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// Latest returns the newest released version, such as v1.4.0
+func Latest(ctx context.Context) (string, error) {
+	var lastErr error
+	for _, src := range sources {
+		version, err := fetchVersion(ctx, src.VersionURL)
+		if err == nil {
+			return version, nil
+		}
+		if ctx.Err() != nil {
+			return "", err
+		}
+		lastErr = fmt.Errorf("%s: %w", src.Name, err)
+	}
+	return "", fmt.Errorf("failed to check the latest version: %w", lastErr)
+}
+
+// fetchVersion reads the version from a GitHub release or the CDN's
+// /api/version, which answer {"tag_name": ...} and {"version": ...}
+func fetchVersion(ctx context.Context, url string) (string, error) {
+	data, err := get(ctx, url, 1<<20)
+	if err != nil {
+		return "", err
+	}
+
+	var release struct {
+		TagName string `json:"tag_name"`
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(data, &release); err != nil {
+		return "", fmt.Errorf("invalid release info: %w", err)
+	}
+	if release.TagName != "" {
+		return release.TagName, nil
+	}
+	if release.Version != "" {
+		return release.Version, nil
+	}
+	return "", fmt.Errorf("release info has no version")
+}
+
+// Newer checks if version a is newer than b. Unparsable versions, such as
+// "dev", are older than any release.
+func Newer(a, b string) bool {
+	pa, okA := parseVersion(a)
+	pb, okB := parseVersion(b)
+	if !okA {
+		return false
+	}
+	if !okB {
+		return true
+	}
+	for i := range pa {
+		if pa[i] != pb[i] {
+			return pa[i] > pb[i]
+		}
+	}
+	return false
+}
+
+// parseVersion parses "v1.2.3" (pre-release and build suffixes ignored)
+func parseVersion(v string) ([3]int, bool) {
+	var parts [3]int
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	fields := strings.Split(v, ".")
+	if len(fields) != 3 {
+		return parts, false
+	}
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return parts, false
+		}
+		parts[i] = n
+	}
+	return parts, true
+}
+
+// Download fetches the binary for this platform at version, verifies it
+// against the release's checksums.txt and returns it
+func Download(ctx context.Context, version string) ([]byte, error) {
+	name := AssetName()
+
+	var lastErr error
+	for _, src := range sources {
+		sums, err := get(ctx, src.AssetURL(version, "checksums.txt"), 1<<20)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			lastErr = fmt.Errorf("%s: failed to fetch checksums: %w", src.Name, err)
+			continue
+		}
+		expected, err := findChecksum(sums, name)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := get(ctx, src.AssetURL(version, name), 200<<20)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			lastErr = fmt.Errorf("%s: failed to download %s: %w", src.Name, name, err)
+			continue
+		}
+
+		sum := sha256.Sum256(data)
+		if got := hex.EncodeToString(sum[:]); got != expected {
+			return nil, fmt.Errorf("checksum mismatch for %s: expected %s, got %s", name, expected, got)
+		}
+		return data, nil
+	}
+	return nil, lastErr
+}
+
+// findChecksum returns the sha256 of name from sha256sum output
+func findChecksum(sums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(strings.NewReader(string(sums)))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("checksums.txt has no entry for %s, this platform may not be released", name)
+}
+
+// get downloads url, refusing responses larger than limit
+func get(ctx context.Context, url string, limit int64) ([]byte, error) {
+	resp, err := httpclient.Get(ctx, httpclient.Download(), url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	body := progress.NewReader(resp.Body, path.Base(url), resp.ContentLength)
+	data, err := io.ReadAll(io.LimitReader(body, limit+1))
+	body.Finish()
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s is larger than %d bytes", url, limit)
+	}
+	return data, nil
+}
+
+// Executable returns the path of the running binary with symlinks resolved
+func Executable() (string, error) {
+	path, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the crosh executable: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	return path, nil
+}
+
+// Replace atomically swaps the binary at path for data. The new binary is
+// written next to it and renamed over it, so a failure leaves the old one in
+// place. Windows can't overwrite a running executable, so there the old one
+// is moved aside to <path>.old first and removed by RemoveOld later.
+func Replace(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".crosh-update-*")
+	if err != nil {
+		return hint.IfDenied(fmt.Errorf("failed to write next to %s: %w", path, err), hint.Sudo)
+	}
+	tmpPath := tmp.Name()
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, info.Mode().Perm()|0111)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write new binary: %w", err)
+	}
+
+	if runtime.GOOS == "windows" {
+		old := path + ".old"
+		os.Remove(old)
+		if err := os.Rename(path, old); err != nil {
+			os.Remove(tmpPath)
+			return fmt.Errorf("failed to move the old binary aside: %w", err)
+		}
+		if err := os.Rename(tmpPath, path); err != nil {
+			os.Rename(old, path)
+			os.Remove(tmpPath)
+			return fmt.Errorf("failed to replace %s: %w", path, err)
+		}
+		return nil
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
+
+// RemoveOld deletes the binary left behind by an update on Windows
+func RemoveOld() {
+	if runtime.GOOS != "windows" {
+		return
+	}
+	if path, err := Executable(); err == nil {
+		os.Remove(path + ".old")
+	}
+}
@@ -0,0 +1,160 @@
+package userfile
+
+import (
+	"fmt"
+	"strings"
+)
+
+// contextLines is how many unchanged lines are shown around each change
+const contextLines = 3
+
+// Diff returns the change from old to new as a unified diff, with "/dev/null"
+// standing in for a file that doesn't exist (nil) on one side
+func Diff(path string, old, new []byte) string {
+	from, to := path, path
+	if old == nil {
+		from = "/dev/null"
+	}
+	if new == nil {
+		to = "/dev/null"
+	}
+
+	a, b := splitLines(string(old)), splitLines(string(new))
+	ops := diffLines(a, b)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", from, to)
+
+	// Group the edits into hunks, merging those with little context between them
+	for start := 0; start < len(ops); {
+		if ops[start].kind == ' ' {
+			start++
+			continue
+		}
+
+		first := max(start-contextLines, 0)
+		end := start
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next == len(ops) || next-end > 2*contextLines {
+				break
+			}
+			end = next
+		}
+		last := min(end+contextLines, len(ops))
+
+		hunk := ops[first:last]
+		oldStart, newStart := hunk[0].oldLine, hunk[0].newLine
+		oldCount, newCount := 0, 0
+		for _, op := range hunk {
+			if op.kind != '+' {
+				oldCount++
+			}
+			if op.kind != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+		for _, op := range hunk {
+			fmt.Fprintf(&out, "%c%s\n", op.kind, op.text)
+		}
+		start = last
+	}
+	return out.String()
+}
+
+// lineOp is one line of a diff: ' ' kept, '-' removed or '+' added
+type lineOp struct {
+	kind    byte
+	text    string
+	oldLine int // 1-based line number before the change
+	newLine int // 1-based line number after the change
+}
+
+// diffLines finds the fewest removed and added lines turning a into b, using
+// the longest common subsequence of the lines between a common prefix and suffix
+func diffLines(a, b []string) []lineOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	// lcs[i][j] is the length of the common subsequence of midA[i:] and midB[j:]
+	lcs := make([][]int32, len(midA)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(midB)+1)
+	}
+	for i := len(midA) - 1; i >= 0; i-- {
+		for j := len(midB) - 1; j >= 0; j-- {
+			if midA[i] == midB[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []lineOp
+	oldLine, newLine := 1, 1
+	keep := func(text string) {
+		ops = append(ops, lineOp{' ', text, oldLine, newLine})
+		oldLine++
+		newLine++
+	}
+	for _, line := range a[:prefix] {
+		keep(line)
+	}
+	i, j := 0, 0
+	for i < len(midA) || j < len(midB) {
+		switch {
+		case i < len(midA) && j < len(midB) && midA[i] == midB[j]:
+			keep(midA[i])
+			i++
+			j++
+		case j == len(midB) || (i < len(midA) && lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, lineOp{'-', midA[i], oldLine, newLine})
+			oldLine++
+			i++
+		default:
+			ops = append(ops, lineOp{'+', midB[j], oldLine, newLine})
+			newLine++
+			j++
+		}
+	}
+	for _, line := range a[len(a)-suffix:] {
+		keep(line)
+	}
+	return ops
+}
+
+// splitLines splits s into lines without their line endings
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// hunkRange formats the "start,count" of a hunk header, where an empty range
+// starts at the line before it
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
@@ -0,0 +1,104 @@
+package userfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/boomyao/crosh/internal/hint"
+	"github.com/boomyao/crosh/internal/logging"
+)
+
+// nixStore is where home-manager links dotfiles into, read-only
+const nixStore = "/nix/store/"
+
+// homeManagerHint is shown for a file crosh can't change because
+// home-manager owns it
+const homeManagerHint = "set it in your home-manager configuration instead, or replace the link with a plain file to let crosh manage it"
+
+var (
+	warnedMu sync.Mutex
+	warned   = make(map[string]bool)
+)
+
+// resolve returns the file a write to path lands in: the file itself, or
+// the target when path is a symlink, as dotfile managers like GNU Stow
+// create. Writing to the target keeps the link intact. A warning is logged
+// once for a file that a dotfile manager may overwrite.
+func resolve(path string) (string, error) {
+	target, err := FS.EvalSymlinks(path)
+	if err != nil {
+		// A file that doesn't exist yet, or a dangling link, is written as is
+		target = path
+	}
+
+	if strings.HasPrefix(filepath.ToSlash(target), nixStore) {
+		return "", hint.Errorf(homeManagerHint, "%s is managed by home-manager (it links into /nix/store, which is read-only)", path)
+	}
+	switch {
+	case target != path:
+		warnOnce(path, "editing the file behind a symlink, commit the change to your dotfiles so the next sync keeps it", "target", target)
+	case chezmoiManages(path):
+		warnOnce(path, "file is managed by chezmoi, add crosh's change to its source or the next \"chezmoi apply\" overwrites it")
+	}
+	return target, nil
+}
+
+// chezmoiManages checks if chezmoi's source directory has a file for path,
+// which "chezmoi apply" would write over crosh's change. chezmoi names
+// ~/.zshrc dot_zshrc, possibly with attribute prefixes such as private_ and
+// a .tmpl suffix for templates.
+func chezmoiManages(path string) bool {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(homeDir, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return false
+	}
+
+	source := os.Getenv("XDG_DATA_HOME")
+	if source == "" {
+		source = filepath.Join(homeDir, ".local", "share")
+	}
+	dir := filepath.Join(source, "chezmoi")
+
+	parts := strings.Split(rel, string(filepath.Separator))
+	for _, part := range parts[:len(parts)-1] {
+		dir = filepath.Join(dir, chezmoiName(part))
+	}
+	name := chezmoiName(parts[len(parts)-1])
+	entries, err := FS.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		base := strings.TrimSuffix(entry.Name(), ".tmpl")
+		if base == name || strings.HasSuffix(base, "_"+name) {
+			return true
+		}
+	}
+	return false
+}
+
+// chezmoiName returns the name chezmoi's source directory uses for a file
+// or directory name in the home directory, without attribute prefixes
+func chezmoiName(name string) string {
+	if rest, ok := strings.CutPrefix(name, "."); ok {
+		return "dot_" + rest
+	}
+	return name
+}
+
+// warnOnce logs a warning about path, once per file
+func warnOnce(path, msg string, args ...any) {
+	warnedMu.Lock()
+	defer warnedMu.Unlock()
+	if warned[path] {
+		return
+	}
+	warned[path] = true
+	logging.Warn(msg, append([]any{"path", path}, args...)...)
+}
@@ -0,0 +1,194 @@
+package userfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boomyao/crosh/internal/config"
+	"github.com/boomyao/crosh/internal/logging"
+)
+
+// Journal records an operation that changes several of the user's files,
+// with what each file held before, from just before the first change until
+// the operation is done. An entry left behind means crosh was killed
+// halfway through, and holds what is needed to roll the changes back.
+type Journal struct {
+	Op      string        `json:"op"`             // e.g. "mirror.enable"
+	Args    []string      `json:"args,omitempty"` // e.g. the tool, for a single mirror
+	PID     int           `json:"pid"`
+	Started time.Time     `json:"started"`
+	Files   []JournalFile `json:"files"`
+
+	path  string // the entry file, once the first change is recorded
+	depth int    // operations started within this one, see Begin
+}
+
+// JournalFile is what a file held before the operation changed it
+type JournalFile struct {
+	Path    string      `json:"path"`
+	Existed bool        `json:"existed"`
+	Data    []byte      `json:"data,omitempty"`
+	Mode    os.FileMode `json:"mode,omitempty"`
+}
+
+// The operation being recorded, if any
+var (
+	journalMu sync.Mutex
+	active    *Journal
+)
+
+// journalDir returns the directory holding the entries of unfinished
+// operations. The entries hold copies of files like .npmrc, which may
+// contain tokens, so only the user can read them.
+func journalDir() string {
+	return filepath.Join(config.StateDir(), "journal")
+}
+
+// Begin starts recording op, returning the journal to call Done on. An
+// operation begun while another is recorded, like one mirror of "enable
+// all", becomes part of it.
+func Begin(op string, args ...string) *Journal {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	if active == nil {
+		active = &Journal{Op: op, Args: args, PID: os.Getpid(), Started: time.Now()}
+	}
+	active.depth++
+	return active
+}
+
+// Done marks the operation complete, whether it succeeded or reported an
+// error, and removes its entry
+func (j *Journal) Done() {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	if j.depth--; j.depth > 0 {
+		return
+	}
+	if active == j {
+		active = nil
+	}
+	if j.path != "" {
+		FS.Remove(j.path)
+	}
+}
+
+// record saves what path holds to the active journal before it is changed
+func record(path string) error {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	if active == nil {
+		return nil
+	}
+	for _, file := range active.Files {
+		if file.Path == path {
+			return nil
+		}
+	}
+
+	file := JournalFile{Path: path}
+	if info, err := FS.Stat(path); err == nil {
+		data, err := FS.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s for the journal: %w", path, err)
+		}
+		file.Existed, file.Data, file.Mode = true, data, info.Mode().Perm()
+	}
+	active.Files = append(active.Files, file)
+	return active.save()
+}
+
+// save writes the entry, replacing the previous one in a single rename so a
+// crash leaves either of them intact
+func (j *Journal) save() error {
+	if j.path == "" {
+		j.path = filepath.Join(journalDir(), fmt.Sprintf("%d-%d.json", j.Started.UnixNano(), j.PID))
+	}
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal the journal: %w", err)
+	}
+	if err := FS.MkdirAll(journalDir(), 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", journalDir(), err)
+	}
+	tmp := j.path + ".tmp"
+	if err := FS.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write the journal: %w", err)
+	}
+	if err := FS.Rename(tmp, j.path); err != nil {
+		return fmt.Errorf("failed to write the journal: %w", err)
+	}
+	return nil
+}
+
+// Incomplete returns the journals of operations that never finished, oldest
+// first. The caller holds the settings lock, so no other crosh process is
+// still working on them.
+func Incomplete() ([]*Journal, error) {
+	entries, err := FS.ReadDir(journalDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", journalDir(), err)
+	}
+
+	var journals []*Journal
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(journalDir(), entry.Name())
+		data, err := FS.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		j := &Journal{path: path}
+		if err := json.Unmarshal(data, j); err != nil {
+			logging.Warn("ignoring unreadable journal entry", "path", path, "error", err)
+			continue
+		}
+		if j.PID == os.Getpid() {
+			continue
+		}
+		journals = append(journals, j)
+	}
+	return journals, nil
+}
+
+// Rollback restores every file the operation changed to what it held
+// before, confirming each change like any other, and removes the entry once
+// all of them are restored
+func (j *Journal) Rollback() error {
+	for i := len(j.Files) - 1; i >= 0; i-- {
+		file := j.Files[i]
+		var err error
+		if file.Existed {
+			mode := file.Mode
+			if mode == 0 {
+				mode = 0644
+			}
+			err = Write(file.Path, file.Data, mode)
+		} else if err = Remove(file.Path); os.IsNotExist(err) {
+			err = nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to restore %s: %w", file.Path, err)
+		}
+	}
+	return j.Discard()
+}
+
+// Discard removes the entry and leaves the files as they are, once the
+// operation was finished another way
+func (j *Journal) Discard() error {
+	if err := FS.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %w", j.path, err)
+	}
+	return nil
+}
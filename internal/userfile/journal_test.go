@@ -0,0 +1,61 @@
+package userfile
+
+import (
+	"os"
+	"testing"
+
+	"github.com/boomyao/crosh/internal/fsys"
+)
+
+func TestJournalRollback(t *testing.T) {
+	oldFS := FS
+	t.Cleanup(func() { FS = oldFS })
+	root := t.TempDir()
+	FS = fsys.Dir(root)
+	t.Setenv("HOME", "/home/me")
+	t.Setenv("XDG_STATE_HOME", "/home/me/.local/state")
+	if err := FS.MkdirAll("/home/me", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := FS.WriteFile("/home/me/.npmrc", []byte("save-exact=true\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	j := Begin("mirror.enable", "all")
+	if err := Write("/home/me/.npmrc", []byte("registry=https://registry.npmmirror.com\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Write("/home/me/.bashrc", []byte("export GOPROXY=https://goproxy.cn\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// crosh is killed here: the entry is left behind by another process
+	j.PID = os.Getpid() + 1
+	if err := j.save(); err != nil {
+		t.Fatal(err)
+	}
+	active = nil
+
+	journals, err := Incomplete()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(journals) != 1 || journals[0].Op != "mirror.enable" || len(journals[0].Files) != 2 {
+		t.Fatalf("Incomplete() = %+v, want the mirror.enable entry with 2 files", journals)
+	}
+	if err := journals[0].Rollback(); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+
+	if data, err := FS.ReadFile("/home/me/.npmrc"); err != nil || string(data) != "save-exact=true\n" {
+		t.Errorf(".npmrc = %q, %v after Rollback, want it restored", data, err)
+	}
+	if _, err := FS.Stat("/home/me/.bashrc"); !os.IsNotExist(err) {
+		t.Errorf(".bashrc exists after Rollback, want it removed (err %v)", err)
+	}
+	if journals, err := Incomplete(); err != nil || len(journals) != 0 {
+		t.Errorf("Incomplete() = %d entries, %v after Rollback, want none", len(journals), err)
+	}
+	if _, err := os.Stat(root + "/home/me/.local/state/crosh/journal"); err != nil {
+		t.Errorf("journal wasn't kept in the scratch tree: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package userfile
+
+import (
+	"bytes"
+	"errors"
+	"os"
+
+	"github.com/boomyao/crosh/internal/fsys"
+	"github.com/boomyao/crosh/internal/hint"
+)
+
+// FS holds the user's files and the journal of changes to them. The mirror
+// handlers read and write through it too, so pointing it at fsys.Dir keeps
+// them off the real home directory.
+var FS = fsys.OS
+
+// ErrDeclined is returned when the user didn't confirm a change
+var ErrDeclined = hint.Wrap(errors.New("change not confirmed"), "rerun with --yes to apply changes without asking")
+
+// Confirm, when set, is shown the diff of every change to a user file before
+// it is made, and the change is skipped if it returns false
+var Confirm func(path, diff string) bool
+
+// Write replaces the contents of a file that belongs to the user, such as a
+// shell rc file or daemon.json, after confirming the change. A symlinked file
+// is written through, so the link stays in place. During an operation begun
+// with Begin, what the file held is saved to its journal first.
+func Write(path string, data []byte, perm os.FileMode) error {
+	path, err := resolve(path)
+	if err != nil {
+		return err
+	}
+	old, _ := FS.ReadFile(path)
+	if !bytes.Equal(old, data) {
+		if Confirm != nil && !Confirm(path, Diff(path, old, data)) {
+			return ErrDeclined
+		}
+		if err := record(path); err != nil {
+			return err
+		}
+	}
+	return FS.WriteFile(path, data, perm)
+}
+
+// Remove deletes a file that belongs to the user after confirming it. The
+// file behind a symlink is emptied instead, so the link doesn't dangle.
+func Remove(path string) error {
+	target, err := resolve(path)
+	if err != nil {
+		return err
+	}
+	old, err := FS.ReadFile(target)
+	if err == nil && Confirm != nil && !Confirm(target, Diff(target, old, nil)) {
+		return ErrDeclined
+	}
+	if err := record(target); err != nil {
+		return err
+	}
+	if target != path {
+		return FS.WriteFile(target, nil, 0644)
+	}
+	return FS.Remove(path)
+}
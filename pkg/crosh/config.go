@@ -0,0 +1,69 @@
+package crosh
+
+import (
+	"github.com/boomyao/crosh/internal/config"
+)
+
+// Config is crosh's configuration: the mirror of each tool and the proxy's
+// subscription and ports, as stored in config.yaml
+type Config struct {
+	cfg *config.Config
+}
+
+// LoadConfig reads config.yaml of the active profile, layered over the
+// system config, the same way the crosh command does
+func LoadConfig() (*Config, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+	return &Config{cfg: cfg}, nil
+}
+
+// DefaultConfig returns the configuration crosh uses before "crosh init"
+func DefaultConfig() *Config {
+	return &Config{cfg: config.NewConfig()}
+}
+
+// ConfigPath returns the path of config.yaml of the active profile
+func ConfigPath() (string, error) {
+	return config.GetConfigPath()
+}
+
+// Save writes the configuration to config.yaml of the active profile
+func (c *Config) Save() error {
+	return c.cfg.Save()
+}
+
+// MirrorURL returns the mirror configured for a tool (see Tools), or "" if
+// crosh leaves the tool alone
+func (c *Config) MirrorURL(tool string) string {
+	return c.cfg.Mirror.URL(tool)
+}
+
+// SetMirrorURL sets the mirror of a tool; for docker, url is a
+// comma-separated list of registry mirrors
+func (c *Config) SetMirrorURL(tool, url string) error {
+	return c.cfg.Mirror.SetURL(tool, url)
+}
+
+// MirrorEnabled checks if crosh enabled the mirror of a tool
+func (c *Config) MirrorEnabled(tool string) bool {
+	return c.cfg.Mirror.Tool(tool).Enabled
+}
+
+// SubscriptionURL returns the proxy subscription, "" if there is none
+func (c *Config) SubscriptionURL() string {
+	return c.cfg.Proxy.SubscriptionURL
+}
+
+// SetSubscriptionURL sets the proxy subscription
+func (c *Config) SetSubscriptionURL(url string) {
+	c.cfg.Proxy.SubscriptionURL = url
+}
+
+// Warnings returns the problems found while loading the config, such as
+// unknown keys
+func (c *Config) Warnings() []string {
+	return c.cfg.Warnings()
+}
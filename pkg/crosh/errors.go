@@ -0,0 +1,19 @@
+package crosh
+
+import "github.com/boomyao/crosh/internal/errs"
+
+// Kinds of failure returned by the functions of this package, to check with
+// errors.Is. Kind also recognizes errors that aren't marked with one.
+var (
+	ErrNotInstalled = errs.ErrNotInstalled // a tool such as git, go or Xray-core is missing
+	ErrPermission   = errs.ErrPermission   // root or administrator rights are needed; fs.ErrPermission
+	ErrParse        = errs.ErrParse        // a config, subscription or checksum file is malformed
+	ErrNetwork      = errs.ErrNetwork      // a download, subscription, mirror or node was unreachable
+)
+
+// Kind returns which of ErrNotInstalled, ErrPermission, ErrParse and
+// ErrNetwork err is, or nil if it is none of them. The crosh command picks
+// its exit code the same way.
+func Kind(err error) error {
+	return errs.Kind(err)
+}
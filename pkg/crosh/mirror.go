@@ -0,0 +1,84 @@
+package crosh
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/boomyao/crosh/internal/accelerator"
+	"github.com/boomyao/crosh/internal/config"
+	"github.com/boomyao/crosh/internal/fsys"
+	"github.com/boomyao/crosh/internal/mirror"
+	"github.com/boomyao/crosh/internal/userfile"
+)
+
+// Mirror points one package manager at a mirror by editing its config, and
+// puts it back
+type Mirror interface {
+	Enable() error
+	Disable() error
+	// Status reports whether the tool uses a mirror, and which
+	Status() (enabled bool, detail string, err error)
+}
+
+// Tools returns the package managers crosh can point at mirrors
+func Tools() []string {
+	return append([]string(nil), config.MirrorToolNames...)
+}
+
+// NewMirror returns the Mirror of a tool (see Tools). For docker, url is a
+// comma-separated list of registry mirrors.
+func NewMirror(tool, url string) (Mirror, error) {
+	switch tool {
+	case "npm":
+		return mirror.NewNPMMirror(url), nil
+	case "pip":
+		return mirror.NewPipMirror(url), nil
+	case "apt":
+		return mirror.NewAptMirror(url), nil
+	case "cargo":
+		return mirror.NewCargoMirror(url), nil
+	case "go":
+		return mirror.NewGoMirror(url), nil
+	case "docker":
+		var registries config.MirrorConfig
+		registries.SetURL("docker", url)
+		return mirror.NewDockerMirror(registries.Docker), nil
+	}
+	return nil, fmt.Errorf("unknown mirror tool: %s (supported: %s)", tool, strings.Join(Tools(), ", "))
+}
+
+// UseRoot makes the mirrors edit the files under dir instead of the real
+// ones, with home as the home directory inside it: ~/.npmrc becomes
+// dir/home/.npmrc and /etc/pip.conf becomes dir/etc/pip.conf. It is meant
+// for tests, which can fill dir with fixtures. Commands the mirrors run,
+// like "go env -w", still act on the real system. An empty dir undoes it.
+func UseRoot(dir, home string) {
+	if dir == "" {
+		userfile.FS = fsys.OS
+		mirror.SetHome("")
+		return
+	}
+	userfile.FS = fsys.Dir(dir)
+	mirror.SetHome(home)
+}
+
+// EnableMirrors enables the mirror of every tool in c that has one, like
+// "crosh on", recording which tools were enabled in c
+func EnableMirrors(c *Config) error {
+	return accelerator.NewManager(c.cfg).EnableMirrors()
+}
+
+// DisableMirrors disables every mirror, like "crosh off"
+func DisableMirrors(c *Config) error {
+	return accelerator.NewManager(c.cfg).DisableMirrors()
+}
+
+// MirrorStatus returns the state of each tool's mirror, keyed by tool name
+func MirrorStatus(c *Config) map[string]string {
+	status := accelerator.NewManager(c.cfg).GetMirrorStatus()
+	byTool := make(map[string]string, len(status))
+	for key, value := range status {
+		byTool[strings.ToLower(key)] = value // "NPM" -> "npm"
+	}
+	return byTool
+}
@@ -0,0 +1,114 @@
+package crosh
+
+import (
+	"github.com/boomyao/crosh/internal/accelerator"
+	"github.com/boomyao/crosh/internal/config"
+	"github.com/boomyao/crosh/internal/daemon"
+)
+
+// Proxy controls crosh's local proxy, the same Xray-core process "crosh on"
+// starts, so a running proxy is shared with the crosh command
+type Proxy struct {
+	config  *Config
+	manager *accelerator.Manager
+}
+
+// NewProxy creates a controller for the proxy described by c
+func NewProxy(c *Config) *Proxy {
+	return &Proxy{
+		config:  c,
+		manager: accelerator.NewManager(c.cfg),
+	}
+}
+
+// Configured checks if there is a subscription or manual nodes to connect through
+func (p *Proxy) Configured() bool {
+	return p.manager.HasProxySource()
+}
+
+// Start starts the proxy on the lowest-latency node, downloading Xray-core
+// first if it isn't installed, and remembers in the config that it is on.
+// If "crosh daemon" is running, it asks the daemon instead.
+func (p *Proxy) Start() error {
+	if client := p.daemon(); client != nil {
+		return p.viaDaemon(client.StartProxy)
+	}
+
+	p.config.cfg.Proxy.Enabled = true
+	err := p.manager.EnableProxy()
+	if err != nil && p.Configured() {
+		// Most likely Xray-core is missing
+		if downloadErr := p.manager.GetXrayManager().Download(); downloadErr != nil {
+			return err
+		}
+		err = p.manager.EnableProxy()
+	}
+	if err != nil {
+		return err
+	}
+	return p.config.Save()
+}
+
+// Stop stops the proxy and removes the git and package manager settings
+// pointing at it, through "crosh daemon" if it is running
+func (p *Proxy) Stop() error {
+	if client := p.daemon(); client != nil {
+		return p.viaDaemon(client.StopProxy)
+	}
+
+	if err := p.manager.DisableProxy(); err != nil {
+		return err
+	}
+	p.config.cfg.Proxy.Enabled = false
+	return p.config.Save()
+}
+
+// daemon returns a client for the running crosh daemon, or nil
+func (p *Proxy) daemon() *daemon.Client {
+	return daemon.Connect(p.manager.GetXrayManager().StateDir())
+}
+
+// viaDaemon saves the config for the daemon to see, runs op and reloads the
+// config with the daemon's changes
+func (p *Proxy) viaDaemon(op func() error) error {
+	if err := p.config.Save(); err != nil {
+		return err
+	}
+	err := op()
+	if reloaded, loadErr := config.Load(); loadErr == nil {
+		*p.config.cfg = *reloaded
+	}
+	return err
+}
+
+// Running checks if the proxy process is alive
+func (p *Proxy) Running() bool {
+	return p.manager.GetXrayManager().IsRunning()
+}
+
+// Node returns the name of the node the proxy connects through, "" when stopped
+func (p *Proxy) Node() string {
+	return p.config.cfg.Proxy.CurrentNode
+}
+
+// SwitchNode moves the running proxy to the node with the given name
+func (p *Proxy) SwitchNode(name string) error {
+	_, err := p.manager.SwitchNode(name)
+	return err
+}
+
+// HTTPURL returns the URL of the local HTTP proxy, e.g. http://127.0.0.1:7677
+func (p *Proxy) HTTPURL() string {
+	return p.manager.GetXrayManager().HTTPProxyURL()
+}
+
+// SOCKSURL returns the URL of the local SOCKS5 proxy, e.g. socks5://127.0.0.1:7676
+func (p *Proxy) SOCKSURL() string {
+	return p.manager.GetXrayManager().SocksProxyURL()
+}
+
+// Env returns the proxy environment variables (HTTP_PROXY, NO_PROXY, ...)
+// to set on commands that should go through the proxy
+func (p *Proxy) Env() map[string]string {
+	return p.manager.GetXrayManager().GetProxyEnvVars()
+}
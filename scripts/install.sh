@@ -32,14 +32,22 @@ detect_platform() {
         darwin)
             OS="darwin"
             ;;
+        freebsd)
+            OS="freebsd"
+            ;;
         *)
             echo -e "${RED}Error: Unsupported OS: $OS${NC}"
             exit 1
             ;;
     esac
 
+    # A shell running under Rosetta reports x86_64 on Apple Silicon
+    if [ "$OS" = "darwin" ] && [ "$(sysctl -n sysctl.proc_translated 2>/dev/null)" = "1" ]; then
+        ARCH="arm64"
+    fi
+
     case "$ARCH" in
-        x86_64)
+        x86_64|amd64)
             ARCH="amd64"
             ;;
         aarch64|arm64)
@@ -176,9 +184,12 @@ download_binary() {
 install_binary() {
     echo "Installing to $INSTALL_DIR..."
 
-    # Check if we need sudo
+    # Check if we need sudo (or doas, on systems that come without sudo)
     if [ -w "$INSTALL_DIR" ]; then
         SUDO=""
+    elif ! command -v sudo >/dev/null 2>&1 && command -v doas >/dev/null 2>&1; then
+        SUDO="doas"
+        echo "Need doas permission to install to $INSTALL_DIR"
     else
         SUDO="sudo"
         echo "Need sudo permission to install to $INSTALL_DIR"
@@ -6,7 +6,8 @@
  * - /api/version - Returns latest version from crosh GitHub API
  * - /dist/* - Serves crosh binaries from crosh Release Assets (boomyao/crosh)
  * - /xray/* - Serves Xray-core files from Xray Release Assets (XTLS/Xray-core)
- *             Also serves geoip.dat and geosite.dat from Loyalsoldier/v2ray-rules-dat
+ *             Also serves geoip.dat and geosite.dat (and their .sha256sum files)
+ *             from Loyalsoldier/v2ray-rules-dat
  * - /scripts/* - Serves scripts from crosh main branch
  */
 
@@ -48,7 +49,8 @@ async function handleRequest(request) {
     if (path.startsWith('/xray/')) {
       const filename = path.substring(6); // Remove '/xray/'
       // geoip.dat and geosite.dat come from a different repository
-      const isGeoFile = filename === 'geoip.dat' || filename === 'geosite.dat';
+      const geoName = filename.replace(/\.sha256sum$/, '');
+      const isGeoFile = geoName === 'geoip.dat' || geoName === 'geosite.dat';
       const repo = isGeoFile ? GEO_REPO : XRAY_REPO;
       return await proxyReleaseAsset(filename, request, repo);
     }